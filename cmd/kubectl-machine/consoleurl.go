@@ -0,0 +1,59 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/kubectlplugin"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// runConsoleURL implements the console-url command, which prints the URL of the instance of a machine in the
+// console of its cloud provider
+func runConsoleURL(args []string) int {
+	var cluster clusterFlags
+	fs := flag.NewFlagSet("console-url", flag.ContinueOnError)
+	cluster.register(fs)
+	name, _, code := parseMachineName(fs, args)
+	if code != 0 {
+		return code
+	}
+	client, err := cluster.client()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	machine := &clusterv1alpha1.Machine{}
+	if err := client.Get(context.Background(), types.NamespacedName{Namespace: cluster.namespace, Name: name}, machine); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get machine %s: %v\n", name, err)
+		return 1
+	}
+	consoleURL, err := kubectlplugin.ConsoleURL(machine)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(consoleURL)
+	return 0
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-machine is a kubectl plugin for the operations on machines which would otherwise need the console of
+// their cloud provider. Installed in the PATH, it is run as kubectl machine.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const usage = `Usage: kubectl machine <command> [flags] [arguments]
+
+Commands:
+  status [name...]             Show the phase, instance, address, node and error of machines
+  ssh <name> [-- ssh args]     Connect to the instance of a machine with the key of the machine-controller
+  console-url <name>           Print the URL of the instance of a machine in the console of its cloud provider
+  recreate <name>              Replace the instance of a machine by a new one
+
+Run kubectl machine <command> -h for the flags of a command.
+`
+
+var commands = map[string]func(args []string) int{
+	"status":      runStatus,
+	"ssh":         runSSH,
+	"console-url": runConsoleURL,
+	"recreate":    runRecreate,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "-h" && os.Args[1] != "--help" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		}
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	os.Exit(command(os.Args[2:]))
+}
+
+// clusterFlags are the flags of all commands to reach the cluster of the machines
+type clusterFlags struct {
+	namespace  string
+	kubeconfig string
+	masterURL  string
+}
+
+func (c *clusterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.namespace, "n", "kube-system", "The namespace of the machines.")
+	fs.StringVar(&c.kubeconfig, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to a kubeconfig of the cluster of the machines.")
+	fs.StringVar(&c.masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig.")
+}
+
+func (c *clusterFlags) client() (ctrlruntimeclient.Client, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = c.kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{ClusterInfo: clientcmdapi.Cluster{Server: c.masterURL}}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error building kubeconfig: %v", err)
+	}
+	if err := clusterv1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to add clusterv1alpha1 to scheme: %v", err)
+	}
+	client, err := ctrlruntimeclient.New(cfg, ctrlruntimeclient.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("error building ctrlruntime client: %v", err)
+	}
+	return client, nil
+}
+
+// parseMachineName parses the flags and returns the name of the single machine the command takes, or the
+// exit code on usage errors. The remaining arguments are returned as well.
+func parseMachineName(fs *flag.FlagSet, args []string) (string, []string, int) {
+	if err := fs.Parse(args); err != nil {
+		return "", nil, 2
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "the name of the machine is missing")
+		fs.Usage()
+		return "", nil, 2
+	}
+	return fs.Arg(0), fs.Args()[1:], 0
+}
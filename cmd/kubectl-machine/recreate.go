@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// runRecreate implements the recreate command. Machines of a MachineSet are deleted and replaced by the
+// MachineSet. Other machines are deleted, which drains their node and deletes their instance, and created
+// again with the same spec once they are gone.
+func runRecreate(args []string) int {
+	var (
+		cluster clusterFlags
+		timeout time.Duration
+	)
+	fs := flag.NewFlagSet("recreate", flag.ContinueOnError)
+	cluster.register(fs)
+	fs.DurationVar(&timeout, "timeout", 30*time.Minute, "How long to wait for the deletion of machines without MachineSet before they are created again.")
+	name, _, code := parseMachineName(fs, args)
+	if code != 0 {
+		return code
+	}
+	client, err := cluster.client()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	key := types.NamespacedName{Namespace: cluster.namespace, Name: name}
+	machine := &clusterv1alpha1.Machine{}
+	if err := client.Get(context.Background(), key, machine); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get machine %s: %v\n", name, err)
+		return 1
+	}
+	if machine.Annotations[machinecontroller.AnnotationDeleteProtection] == "true" {
+		fmt.Fprintf(os.Stderr, "machine %s has the %s annotation, remove it to recreate the machine\n", name, machinecontroller.AnnotationDeleteProtection)
+		return 1
+	}
+	if machine.DeletionTimestamp != nil {
+		fmt.Fprintf(os.Stderr, "machine %s is being deleted already\n", name)
+		return 1
+	}
+
+	if owner := metav1.GetControllerOf(machine); owner != nil && owner.Kind == "MachineSet" {
+		if err := client.Delete(context.Background(), machine); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete machine %s: %v\n", name, err)
+			return 1
+		}
+		fmt.Printf("Deleted machine %s, MachineSet %s creates a new one\n", name, owner.Name)
+		return 0
+	}
+
+	recreated := recreatedMachine(machine)
+	if err := client.Delete(context.Background(), machine); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to delete machine %s: %v\n", name, err)
+		return 1
+	}
+	fmt.Printf("Deleted machine %s, waiting for its node and instance to be deleted\n", name)
+	if err := waitForDeletion(client, key, timeout); err != nil {
+		fmt.Fprintf(os.Stderr, "failed waiting for the deletion of machine %s: %v\n", name, err)
+		return 1
+	}
+	if err := client.Create(context.Background(), recreated); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create machine %s again: %v\n", name, err)
+		return 1
+	}
+	fmt.Printf("Created machine %s again\n", name)
+	return 0
+}
+
+// recreatedMachine returns a copy of the machine without its status and the annotations of its current instance
+func recreatedMachine(machine *clusterv1alpha1.Machine) *clusterv1alpha1.Machine {
+	machine = machine.DeepCopy()
+	recreated := &clusterv1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            machine.Name,
+			Namespace:       machine.Namespace,
+			Labels:          machine.Labels,
+			Annotations:     machine.Annotations,
+			OwnerReferences: machine.OwnerReferences,
+		},
+		Spec: machine.Spec,
+	}
+	// The provider ID identifies the deleted instance
+	recreated.Spec.ProviderID = nil
+	for _, annotation := range []string{
+		machinecontroller.AnnotationInstanceCreationTimestamp,
+		machinecontroller.AnnotationAppliedSpecHash,
+		machinecontroller.AnnotationCreationApproved,
+		machinecontroller.AnnotationDeletionApproved,
+		machinecontroller.AnnotationK0sJoinAddresses,
+	} {
+		delete(recreated.Annotations, annotation)
+	}
+	return recreated
+}
+
+func waitForDeletion(client ctrlruntimeclient.Client, key types.NamespacedName, timeout time.Duration) error {
+	return wait.Poll(5*time.Second, timeout, func() (bool, error) {
+		err := client.Get(context.Background(), key, &clusterv1alpha1.Machine{})
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/kubectlplugin"
+
+	"golang.org/x/crypto/ssh"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// runSSH implements the ssh command, which connects to the instance of a machine with the private key of the
+// machine-controller-ssh-key secret. Without a private key in the secret, ssh uses the keys of the user.
+// Arguments after the name of the machine are passed to ssh.
+func runSSH(args []string) int {
+	var (
+		cluster         clusterFlags
+		internal        bool
+		user            string
+		secretName      string
+		secretNamespace string
+	)
+	fs := flag.NewFlagSet("ssh", flag.ContinueOnError)
+	cluster.register(fs)
+	fs.BoolVar(&internal, "internal", false, "Connect to the internal address of the instance, e.g. through a VPN, instead of its external one.")
+	fs.StringVar(&user, "l", "", "The user to log in as, defaults to the user of the sshSettings of the machine or the default user of its operating system.")
+	fs.StringVar(&secretName, "ssh-key-secret-name", "machine-controller-ssh-key", "The name of the secret with the SSH key of the machine-controller, its -ssh-key-secret-name.")
+	fs.StringVar(&secretNamespace, "ssh-key-secret-namespace", "kube-system", "The namespace of the secret with the SSH key of the machine-controller, its -ssh-key-secret-namespace.")
+	name, sshArgs, code := parseMachineName(fs, args)
+	if code != 0 {
+		return code
+	}
+	if len(sshArgs) > 0 && sshArgs[0] == "--" {
+		sshArgs = sshArgs[1:]
+	}
+	client, err := cluster.client()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	machine := &clusterv1alpha1.Machine{}
+	if err := client.Get(context.Background(), types.NamespacedName{Namespace: cluster.namespace, Name: name}, machine); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get machine %s: %v\n", name, err)
+		return 1
+	}
+	defaultUser, address, err := kubectlplugin.SSHTarget(machine, internal)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if user == "" {
+		user = defaultUser
+	}
+
+	secret := &corev1.Secret{}
+	err = client.Get(context.Background(), types.NamespacedName{Namespace: secretNamespace, Name: secretName}, secret)
+	if err != nil && !kerrors.IsNotFound(err) {
+		fmt.Fprintf(os.Stderr, "failed to get secret %s/%s: %v\n", secretNamespace, secretName, err)
+		return 1
+	}
+	command := []string{}
+	if privateKey := secret.Data["private-key"]; len(privateKey) > 0 {
+		keyFile, err := writePrivateKey(privateKey, secret.Data["passphrase"])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write the private key of secret %s/%s: %v\n", secretNamespace, secretName, err)
+			return 1
+		}
+		defer os.Remove(keyFile)
+		command = append(command, "-i", keyFile, "-o", "IdentitiesOnly=yes")
+	}
+	command = append(command, fmt.Sprintf("%s@%s", user, address))
+	command = append(command, sshArgs...)
+
+	cmd := exec.Command("ssh", command...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintf(os.Stderr, "failed to run ssh: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writePrivateKey writes the private key to a file only readable by the user and returns its path. Encrypted keys
+// are written decrypted in PKCS8 format, so ssh does not ask for the passphrase.
+func writePrivateKey(privateKey, passphrase []byte) (string, error) {
+	if len(passphrase) > 0 {
+		key, err := ssh.ParseRawPrivateKeyWithPassphrase(privateKey, passphrase)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt the private key: %v", err)
+		}
+		// x509 only marshals ed25519 keys as values
+		if ed25519Key, ok := key.(*ed25519.PrivateKey); ok {
+			key = *ed25519Key
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal the private key: %v", err)
+		}
+		privateKey = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+
+	file, err := ioutil.TempFile("", "kubectl-machine-ssh-key")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	// TempFile creates files with mode 0600 already, ssh refuses keys readable by others
+	if _, err := file.Write(privateKey); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/kubectlplugin"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// runStatus implements the status command, which shows the given machines or all machines of the namespace
+func runStatus(args []string) int {
+	var cluster clusterFlags
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	cluster.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	client, err := cluster.client()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var machines []clusterv1alpha1.Machine
+	if fs.NArg() == 0 {
+		list := &clusterv1alpha1.MachineList{}
+		if err := client.List(context.Background(), list, ctrlruntimeclient.InNamespace(cluster.namespace)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list machines: %v\n", err)
+			return 1
+		}
+		machines = list.Items
+		sort.Slice(machines, func(i, j int) bool { return machines[i].Name < machines[j].Name })
+	}
+	for _, name := range fs.Args() {
+		machine := clusterv1alpha1.Machine{}
+		if err := client.Get(context.Background(), types.NamespacedName{Namespace: cluster.namespace, Name: name}, &machine); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get machine %s: %v\n", name, err)
+			return 1
+		}
+		machines = append(machines, machine)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, strings.Join(kubectlplugin.StatusHeader, "\t"))
+	now := time.Now()
+	for i := range machines {
+		fmt.Fprintln(w, strings.Join(kubectlplugin.StatusRow(&machines[i], now), "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the status: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/backup"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+// runExport implements the export subcommand, which writes the machines of a namespace with the IDs of their
+// instances, and the MachineSets and MachineDeployments, to a bundle, so they can be imported into a new
+// management cluster after a disaster. It returns the exit code.
+func runExport(args []string) int {
+	var file, namespace, kubeconfig, masterURL string
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.StringVar(&file, "o", "-", "Path to write the bundle to, - writes it to stdout.")
+	fs.StringVar(&namespace, "namespace", "kube-system", "The namespace of the machines to export.")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig of the cluster.")
+	fs.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx := context.Background()
+	client, err := newBackupClient(masterURL, kubeconfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	cvr := providerconfig.NewConfigVarResolver(ctx, client)
+	bundle, err := backup.Export(ctx, client, namespace, func(machine *clusterv1alpha1.Machine) (instance.Instance, error) {
+		prov, err := providerForMachine(machine, cvr)
+		if err != nil {
+			return nil, err
+		}
+		return prov.Get(machine, &cloudprovidertypes.ProviderData{Ctx: ctx, Client: client})
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to export: %v\n", err)
+		return 1
+	}
+
+	content, err := kyaml.Marshal(bundle)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to marshal the bundle: %v\n", err)
+		return 1
+	}
+	if file == "-" {
+		_, err = os.Stdout.Write(content)
+	} else {
+		err = ioutil.WriteFile(file, content, 0600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the bundle: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runImport implements the import subcommand, which creates the objects of a bundle written by export and makes
+// the cloud providers identify the existing instances by the UIDs of the new machines, so no instance gets
+// created or deleted. It returns the exit code.
+func runImport(args []string) int {
+	var file, namespace, kubeconfig, masterURL string
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.StringVar(&file, "f", "", "Path to the bundle to import, - reads it from stdin.")
+	fs.StringVar(&namespace, "namespace", "", "The namespace to import the objects into, defaults to the namespace they were exported from.")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig of the cluster.")
+	fs.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "-f must be set")
+		fs.Usage()
+		return 2
+	}
+
+	var (
+		content []byte
+		err     error
+	)
+	if file == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", file, err)
+		return 2
+	}
+	bundle := &backup.Bundle{}
+	if err := kyaml.UnmarshalStrict(content, bundle); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse %s: %v\n", file, err)
+		return 2
+	}
+
+	ctx := context.Background()
+	client, err := newBackupClient(masterURL, kubeconfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	cvr := providerconfig.NewConfigVarResolver(ctx, client)
+	err = backup.Import(ctx, client, bundle, namespace, func(machine *clusterv1alpha1.Machine, newUID types.UID) error {
+		prov, err := providerForMachine(machine, cvr)
+		if err != nil {
+			return err
+		}
+		return prov.MigrateUID(machine, newUID)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to import: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Imported %d MachineDeployments, %d MachineSets and %d machines\n", len(bundle.MachineDeployments), len(bundle.MachineSets), len(bundle.Machines))
+	return 0
+}
+
+func newBackupClient(masterURL, kubeconfig string) (ctrlruntimeclient.Client, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("error building kubeconfig: %v", err)
+	}
+	if err := clusterv1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to add clusterv1alpha1 to scheme: %v", err)
+	}
+	client, err := ctrlruntimeclient.New(cfg, ctrlruntimeclient.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("error building ctrlruntime client: %v", err)
+	}
+	return client, nil
+}
+
+func providerForMachine(machine *clusterv1alpha1.Machine, cvr *providerconfig.ConfigVarResolver) (cloudprovidertypes.Provider, error) {
+	providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider config: %v", err)
+	}
+	prov, err := cloudprovider.ForProvider(providerConfig.CloudProvider, cvr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cloud provider %q: %v", providerConfig.CloudProvider, err)
+	}
+	return prov, nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/kubermatic/machine-controller/pkg/generate"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+// stringsFlag collects the values of a flag which can be given multiple times
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// runGenerate implements the generate subcommand, which writes the manifest of a machine or MachineDeployment for a
+// cloud provider and operating system. Fields without default are asked for with -interactive, otherwise they must
+// be given with -set. It returns the exit code: 1 if the manifest can't be generated, 2 on usage errors.
+func runGenerate(args []string) int {
+	var (
+		opts            generate.Options
+		provider        string
+		operatingSystem string
+		replicas        int
+		sshKeyFiles     stringsFlag
+		values          stringsFlag
+		interactive     bool
+		file            string
+		secretNameSet   bool
+	)
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.StringVar(&provider, "provider", "", fmt.Sprintf("The cloud provider of the machines, one of %v.", providerconfigtypes.AllCloudProviders))
+	fs.StringVar(&operatingSystem, "os", string(providerconfigtypes.OperatingSystemUbuntu), "The operating system of the machines.")
+	fs.StringVar(&opts.Kind, "kind", generate.KindMachineDeployment, "The kind of the manifest, MachineDeployment or Machine.")
+	fs.StringVar(&opts.Name, "name", "", "The name of the MachineDeployment or machine.")
+	fs.StringVar(&opts.Namespace, "namespace", "kube-system", "The namespace of the MachineDeployment or machine and of the secret with the credentials.")
+	fs.IntVar(&replicas, "replicas", 1, "The replicas of the MachineDeployment.")
+	fs.StringVar(&opts.KubeletVersion, "kubelet-version", "1.19.16", "The kubelet version of the machines.")
+	fs.StringVar(&opts.SecretName, "secret-name", "", "The name of the secret with the credentials of the cloud provider, defaults to machine-controller-<provider>.")
+	fs.Var(&sshKeyFiles, "ssh-public-key-file", "Path to an SSH public key added to the machines, can be given multiple times.")
+	fs.Var(&values, "set", "A field of the cloudProviderSpec as name=value, e.g. serverType=cx31 or networks=[net-1,net-2]. Can be given multiple times.")
+	fs.BoolVar(&interactive, "interactive", false, "Ask for the cloud provider, the name and the fields of the cloudProviderSpec which are not set.")
+	fs.StringVar(&file, "o", "-", "Path to write the manifest to, - writes it to stdout.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	fs.Visit(func(f *flag.Flag) { secretNameSet = secretNameSet || f.Name == "secret-name" })
+
+	in := bufio.NewReader(os.Stdin)
+	ask := func(question, defaultValue string) (string, error) {
+		if defaultValue != "" {
+			fmt.Fprintf(os.Stderr, "%s [%s]: ", question, defaultValue)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: ", question)
+		}
+		answer, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || answer == "") {
+			return "", err
+		}
+		if answer = strings.TrimSpace(answer); answer == "" {
+			return defaultValue, nil
+		}
+		return answer, nil
+	}
+
+	var err error
+	if interactive && provider == "" {
+		if provider, err = ask(fmt.Sprintf("Cloud provider %v", providerconfigtypes.AllCloudProviders), ""); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read the cloud provider: %v\n", err)
+			return 2
+		}
+	}
+	if interactive && opts.Name == "" {
+		if opts.Name, err = ask("Name", provider+"-workers"); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read the name: %v\n", err)
+			return 2
+		}
+	}
+	if provider == "" || opts.Name == "" {
+		fmt.Fprintln(os.Stderr, "-provider and -name must be set")
+		fs.Usage()
+		return 2
+	}
+	opts.CloudProvider = providerconfigtypes.CloudProvider(provider)
+	opts.OperatingSystem = providerconfigtypes.OperatingSystem(operatingSystem)
+	opts.Replicas = int32(replicas)
+	if !secretNameSet {
+		opts.SecretName = "machine-controller-" + provider
+	}
+
+	fields, err := generate.Fields(opts.CloudProvider)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", provider, err)
+		return 2
+	}
+	opts.Values = map[string]interface{}{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			fmt.Fprintf(os.Stderr, "-set must be name=value, got %q\n", value)
+			return 2
+		}
+		opts.Values[parts[0]] = generate.ParseValue(parts[1])
+	}
+	if interactive {
+		for _, field := range fields {
+			if _, set := opts.Values[field.Name]; set || field.Secret {
+				continue
+			}
+			defaultValue := ""
+			if field.Default != nil {
+				defaultValue = fmt.Sprint(field.Default)
+			}
+			answer, err := ask(fmt.Sprintf("%s (%s)", field.Name, field.Description), defaultValue)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", field.Name, err)
+				return 2
+			}
+			// Defaults keep their type
+			if answer != defaultValue {
+				opts.Values[field.Name] = generate.ParseValue(answer)
+			}
+		}
+	}
+	for _, keyFile := range sshKeyFiles {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", keyFile, err)
+			return 2
+		}
+		opts.SSHPublicKeys = append(opts.SSHPublicKeys, strings.TrimSpace(string(key)))
+	}
+
+	manifest, secretKeys, err := generate.Generate(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to generate the manifest: %v\n", err)
+		return 1
+	}
+	// The same checks as the validate subcommand without -online
+	_, spec, err := machineSpecFromDocument(manifest)
+	if err == nil {
+		err = validateMachineSpec(*spec, providerconfig.NewConfigVarResolver(context.Background(), noClusterClient{}), false)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "generated an invalid %s %s: %v\n", opts.Kind, opts.Name, err)
+		return 1
+	}
+
+	if file == "-" {
+		_, err = os.Stdout.Write(manifest)
+	} else {
+		err = ioutil.WriteFile(file, manifest, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the manifest: %v\n", err)
+		return 1
+	}
+	if len(secretKeys) > 0 {
+		fmt.Fprintf(os.Stderr, "The credentials are read from the keys %s of the secret %s/%s, e.g. created with\n  kubectl -n %s create secret generic %s --from-literal=%s=...\n",
+			strings.Join(secretKeys, ", "), opts.Namespace, opts.SecretName, opts.Namespace, opts.SecretName, secretKeys[0])
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/k0sctl"
+
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+// runK0sctl implements the k0sctl subcommand, which writes the machines of the k0s bootstrap flavor of a namespace
+// as hosts of a k0sctl configuration, so nodes of the machine-controller can be managed together with nodes managed
+// by k0sctl. It returns the exit code.
+func runK0sctl(args []string) int {
+	var file, namespace, name, keyPath, kubeconfig, masterURL string
+	fs := flag.NewFlagSet("k0sctl", flag.ContinueOnError)
+	fs.StringVar(&file, "o", "-", "Path to write the k0sctl configuration to, - writes it to stdout.")
+	fs.StringVar(&namespace, "namespace", "kube-system", "The namespace of the machines to export.")
+	fs.StringVar(&name, "name", "k0s-cluster", "The name of the cluster in the k0sctl configuration.")
+	fs.StringVar(&keyPath, "ssh-key-path", "", "Path to the private SSH key k0sctl connects to the hosts with, k0sctl defaults to ~/.ssh/id_rsa.")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig of the cluster.")
+	fs.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	client, err := newBackupClient(masterURL, kubeconfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	machines := &clusterv1alpha1.MachineList{}
+	if err := client.List(context.Background(), machines, ctrlruntimeclient.InNamespace(namespace)); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list machines: %v\n", err)
+		return 1
+	}
+
+	cluster, warnings := k0sctl.Export(name, keyPath, machines.Items)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	content, err := kyaml.Marshal(cluster)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to marshal the k0sctl configuration: %v\n", err)
+		return 1
+	}
+	if file == "-" {
+		_, err = os.Stdout.Write(content)
+	} else {
+		err = ioutil.WriteFile(file, content, 0600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the k0sctl configuration: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -47,35 +47,97 @@ import (
 
 	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1/migrations"
+	"github.com/kubermatic/machine-controller/pkg/approval"
+	"github.com/kubermatic/machine-controller/pkg/audit"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/common/ssh"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/clusterinfo"
+	"github.com/kubermatic/machine-controller/pkg/controller/autopilot"
+	"github.com/kubermatic/machine-controller/pkg/controller/bootstraptoken"
+	"github.com/kubermatic/machine-controller/pkg/controller/capimachine"
 	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+	"github.com/kubermatic/machine-controller/pkg/controller/machineclass"
 	machinedeploymentcontroller "github.com/kubermatic/machine-controller/pkg/controller/machinedeployment"
+	"github.com/kubermatic/machine-controller/pkg/controller/machinehealthcheck"
 	machinesetcontroller "github.com/kubermatic/machine-controller/pkg/controller/machineset"
 	"github.com/kubermatic/machine-controller/pkg/controller/nodecsrapprover"
+	"github.com/kubermatic/machine-controller/pkg/debug"
 	machinehealth "github.com/kubermatic/machine-controller/pkg/health"
 	machinesv1alpha1 "github.com/kubermatic/machine-controller/pkg/machines/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/nodedns"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	"github.com/kubermatic/machine-controller/pkg/signals"
+	"github.com/kubermatic/machine-controller/pkg/targetcluster"
+	"github.com/kubermatic/machine-controller/pkg/tracing"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+	"github.com/kubermatic/machine-controller/pkg/userdata/stub"
 
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/klog"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlruntimemetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 var (
 	masterURL                        string
 	kubeconfig                       string
+	targetMasterURL                  string
+	targetKubeconfig                 string
 	clusterDNSIPs                    string
 	listenAddress                    string
 	profiling                        bool
 	name                             string
+	namespace                        string
 	joinClusterTimeout               string
+	joinClusterTimeoutRecreate       bool
 	workerCount                      int
+	cloudProviderQPS                 float64
+	cloudProviderBurst               int
+	disableSSHKeys                   bool
+	sshKeySecretName                 string
+	sshKeySecretNamespace            string
 	externalCloudProvider            bool
+	cloudConfigSecretNamespace       string
+	nodeDNSProvider                  string
+	nodeDNSZone                      string
 	bootstrapTokenServiceAccountName string
+	bootstrapTokenTTL                time.Duration
+	k0sJoinControllerEndpoints       bool
+	k0sBinary                        string
+	k0sAdminKubeconfig               string
+	dryRun                           bool
+	chaos                            string
+	costReport                       bool
+	maxConcurrentDeletions           int
 	skipEvictionAfter                time.Duration
+	forceDeleteAfter                 time.Duration
+	paused                           bool
+	instanceCheckInterval            time.Duration
+	instanceCacheTTL                 time.Duration
+	instanceGoneRecreate             bool
+	machineDefaultsFile              string
+	vaultSettings                    providerconfig.VaultSettings
+	credentialProfilesSecret         string
+	otlpEndpoint                     string
+	auditLogFile                     string
+	auditWebhookURL                  string
+	approvalWebhookURL               string
+	approvalWebhookOperations        string
 	nodeCSRApprover                  bool
+	k0sAutopilot                     bool
+	capiMachines                     bool
+	leaderElect                      bool
+	shutdownTimeout                  time.Duration
+	reconcileLivenessTimeout         time.Duration
+	eventAggregationWindow           time.Duration
+	reconcileTimeout                 time.Duration
+	cloudProviderTimeout             time.Duration
+	resyncPeriod                     time.Duration
+	backoffSettings                  machinecontroller.BackoffSettings
+	migrateOnly                      bool
 
 	nodeHTTPProxy           string
 	nodeNoProxy             string
@@ -85,6 +147,15 @@ var (
 	nodeHyperkubeImage      string
 	nodeKubeletRepository   string
 	nodeKubeletFeatureGates string
+	nodeKubeReserved        string
+	nodeSystemReserved      string
+	nodeEvictionHard        string
+	nodeK0sReleaseURL       string
+
+	bootstrapUserDataURL           string
+	bootstrapUserDataListenAddress string
+	bootstrapUserDataTLSCertFile   string
+	bootstrapUserDataTLSKeyFile    string
 )
 
 const (
@@ -92,6 +163,14 @@ const (
 	defaultLeaderElectionLeaseDuration = 15 * time.Second
 	defaultLeaderElectionRenewDeadline = 10 * time.Second
 	defaultLeaderElectionRetryPeriod   = 2 * time.Second
+	defaultSSHKeySecretName            = "machine-controller-ssh-key"
+
+	// The liveness probe fails once the leader didn't renew its lease for this long after it expired
+	leaderElectionLivenessTimeout = 20 * time.Second
+
+	// profilingWriteTimeout bounds the responses of the internal server with profiling enabled, CPU profiles
+	// and traces are only written once their duration passed, 30 seconds by default
+	profilingWriteTimeout = 2 * time.Minute
 )
 
 // controllerRunOptions holds data that are required to create and run machine controller
@@ -108,6 +187,10 @@ type controllerRunOptions struct {
 	// name of the controller. When set the controller will only process machines with the label "machine.k8s.io/controller": name
 	name string
 
+	// namespace the controller watches. When set the controller will only process machines, MachineSets,
+	// MachineDeployments and MachineHealthChecks in it
+	namespace string
+
 	// Name of the ServiceAccount from which the bootstrap token secret will be fetched. A bootstrap token will be created
 	// if this is nil
 	bootstrapTokenServiceAccountName *types.NamespacedName
@@ -127,23 +210,121 @@ type controllerRunOptions struct {
 	// The cfg is used by the migration to conditionally spawn additional clients
 	cfg *restclient.Config
 
+	// The targetCfg points to the cluster the nodes join, if it differs from the one the machines live in
+	targetCfg *restclient.Config
+
 	// The timeout in which machines owned by a MachineSet must join the cluster to avoid being
-	// deleted by the machine-controller
+	// deleted by the machine-controller. Other machines are marked as failed
 	joinClusterTimeout *time.Duration
 
+	// Recreate the instances of machines without a MachineSet which did not join within joinClusterTimeout
+	joinClusterTimeoutRecreate bool
+
 	// Flag to initialize kubelets with --cloud-provider=external
 	externalCloudProvider bool
 
 	// Will instruct the machine-controller to skip the eviction if the machine deletion is older than skipEvictionAfter
 	skipEvictionAfter time.Duration
 
-	// Enable NodeCSRApprover controller to automatically approve node serving certificate requests.
+	// Will instruct the machine-controller to remove the finalizers of machines annotated for force deletion
+	// if the machine deletion is older than forceDeleteAfter
+	forceDeleteAfter time.Duration
+
+	// Stops the reconciliation of all machines
+	paused bool
+
+	// How often the instances of machines with a ready node are looked up at the cloud provider
+	instanceCheckInterval time.Duration
+
+	// How long the instances returned by the cloud providers are cached
+	instanceCacheTTL time.Duration
+
+	// Recreate instances which got deleted outside of the machine-controller instead of marking their machines as failed
+	instanceGoneRecreate bool
+
+	// Defaults stored in the specs of machines without an instance
+	machineDefaults *providerconfig.MachineDefaults
+
+	// Enable NodeCSRApprover controller to automatically approve node serving and client certificate requests.
 	nodeCSRApprover bool
 
+	// Enable the controller upgrading the k0s release of MachineDeployments in place with autopilot plans.
+	k0sAutopilot bool
+
+	// Enable the controller converting the Machines of upstream Cluster API into cluster.k8s.io Machines.
+	capiMachines bool
+
+	// Only start the controllers after acquiring the leader election lease
+	leaderElect bool
+
+	// The maximum duration to wait for in-flight reconciliations on shutdown
+	shutdownTimeout time.Duration
+
+	// The running reconciliations of machines, which the shutdown waits for
+	inFlight *machinecontroller.InFlightReconciles
+
+	// Whether the controllers run and their caches are synced, for the readiness probe
+	status *machinehealth.ControllerStatus
+
+	// The view of the machine controller on the machines, served on /debug/machines
+	debugState *machinecontroller.DebugState
+
+	// Fails the liveness probe if the leader stops renewing its lease
+	leaderElectionWatchdog *leaderelection.HealthzAdaptor
+
+	// Exit after migrating the existing objects instead of starting the controllers
+	migrateOnly bool
+
+	// Registers the addresses of machines in DNS, nil if disabled
+	nodeDNS *nodedns.Registrar
+
+	// Asks for the approval of creations and deletions of machines, nil if disabled
+	approvalGate *approval.Gate
+
+	// How long the bootstrap tokens of new instances are valid
+	bootstrapTokenTTL time.Duration
+
+	// Let k0s workers join with the addresses of all controllers
+	k0sJoinControllerEndpoints bool
+
+	// Creates the join tokens of k0s nodes with k0s, nil if they are encoded by the machine-controller
+	k0sTokens *machinecontroller.K0sTokenCreator
+
+	// Renders the userdata of new machines to ConfigMaps instead of creating their instances
+	dryRun bool
+
+	// Injects failures into the cloud provider calls, nil unless enabled
+	chaos *cloudprovider.ChaosSettings
+
+	// Reports the cost of the instances of the MachineSets in their status
+	costReport bool
+
+	// The number of machines deleted at once when a MachineSet scales down
+	maxConcurrentDeletions int
+
 	node machinecontroller.NodeSettings
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		os.Exit(runSchema(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "k0sctl" {
+		os.Exit(runK0sctl(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		os.Exit(runGenerate(os.Args[2:]))
+	}
+
 	klog.InitFlags(nil)
 	// This is also being registered in kubevirt.io/kubevirt/pkg/kubecli/kubecli.go so
 	// we have to guard it
@@ -154,15 +335,52 @@ func main() {
 	if flag.Lookup("master") == nil {
 		flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
 	}
+	flag.StringVar(&targetKubeconfig, "target-kubeconfig", "", "Path to a kubeconfig of the cluster the nodes join, if it differs from the cluster the machines live in, e.g. when running in a management cluster.")
+	flag.StringVar(&targetMasterURL, "target-master", "", "The address of the Kubernetes API server of the cluster the nodes join. Overrides any value in the target kubeconfig.")
 	flag.StringVar(&clusterDNSIPs, "cluster-dns", "10.10.10.10", "Comma-separated list of DNS server IP address.")
 	flag.IntVar(&workerCount, "worker-count", 5, "Number of workers to process machines. Using a high number with a lot of machines might cause getting rate-limited from your cloud provider.")
-	flag.StringVar(&listenAddress, "internal-listen-address", "127.0.0.1:8085", "The address on which the http server will listen on. The server exposes metrics on /metrics, liveness check on /live and readiness check on /ready")
+	flag.IntVar(&maxConcurrentDeletions, "max-concurrent-deletions", machinesetcontroller.DefaultMaxConcurrentDeletions, "Number of machines deleted at once when a MachineSet scales down. Their instances are then deleted by up to -worker-count workers in parallel.")
+	flag.Float64Var(&cloudProviderQPS, "cloud-provider-qps", 0, "Maximum number of requests per second to the API of a cloud provider, per credentials. Shared by all workers. Not applied on Alibaba. Disabled if 0.")
+	flag.IntVar(&cloudProviderBurst, "cloud-provider-burst", 10, "Maximum burst of requests to the API of a cloud provider on top of -cloud-provider-qps.")
+	flag.BoolVar(&disableSSHKeys, "disable-ssh-keys", false, "Do not grant SSH access to instances: Ignore the secret set by -ssh-key-secret-name and the sshPublicKeys of machines. Some providers still get a temporary key whose private key is thrown away.")
+	flag.StringVar(&sshKeySecretName, "ssh-key-secret-name", defaultSSHKeySecretName, "Name of the optional secret with the SSH key for instances. Must differ between machine-controllers sharing a cluster with different keys.")
+	flag.StringVar(&sshKeySecretNamespace, "ssh-key-secret-namespace", metav1.NamespaceSystem, "Namespace of the secret set by -ssh-key-secret-name. The machine-controller needs permission to get secrets in it.")
+	flag.StringVar(&listenAddress, "internal-listen-address", "127.0.0.1:8085", "The address on which the http server will listen on. The server exposes metrics on /metrics, liveness check on /healthz and readiness check on /readyz, also served on /live and /ready")
 	flag.StringVar(&name, "name", "", "When set, the controller will only process machines with the label \"machine.k8s.io/controller\": name")
-	flag.StringVar(&joinClusterTimeout, "join-cluster-timeout", "", "when set, machines that have an owner and do not join the cluster within the configured duration will be deleted, so the owner re-creats them")
-	flag.StringVar(&bootstrapTokenServiceAccountName, "bootstrap-token-service-account-name", "", "When set use the service account token from this SA as bootstrap token instead of creating a temporary one. Passed in namespace/name format")
+	flag.StringVar(&namespace, "namespace", "", "When set, the controller will only process machines, MachineSets, MachineDeployments and MachineHealthChecks in this namespace, so multiple controllers can share a cluster")
+	flag.StringVar(&joinClusterTimeout, "join-cluster-timeout", "", "when set, machines that have an owner and do not join the cluster within the configured duration will be deleted, so the owner re-creats them. Other machines are marked as failed")
+	flag.BoolVar(&joinClusterTimeoutRecreate, "join-cluster-timeout-recreate-instance", false, "when set, the instances of machines without a MachineSet which do not join the cluster within the -join-cluster-timeout are deleted and created again")
+	flag.StringVar(&bootstrapTokenServiceAccountName, "bootstrap-token-service-account-name", "", "When set use the service account token from this SA as bootstrap token instead of creating a temporary one. Passed in namespace/name format. Not recommended, the token does not expire and can be read from the userdata of the instances")
+	flag.DurationVar(&bootstrapTokenTTL, "bootstrap-token-ttl", time.Hour, "How long the bootstrap tokens, and the k0s join tokens wrapping them, in the userdata of new instances are valid. Tokens get revoked once the node joined and rotated for new instances if they expire within half of it, so it should leave instances enough time to boot and join.")
+	flag.StringVar(&k0sAdminKubeconfig, "k0s-admin-kubeconfig", "", "Path to an admin kubeconfig of the k0s cluster, e.g. a copy of /var/lib/k0s/pki/admin.conf of a controller. When set, the join tokens of k0s nodes are created with `k0s token create` of the -k0s-binary over it, as on the controllers, so their format matches the k0s release. Otherwise the machine-controller encodes them itself in the format of k0s v1.21.")
+	flag.StringVar(&k0sBinary, "k0s-binary", "k0s", "The k0s binary the join tokens are created with if -k0s-admin-kubeconfig is set, looked up in the PATH unless it is a path. The image of the machine-controller ships one.")
+	flag.BoolVar(&k0sJoinControllerEndpoints, "k0s-join-controller-endpoints", false, "Let k0s workers without joinAddresses join with the addresses of all controllers, as listed by the kubernetes Endpoints of the default namespace, instead of the address of the cluster-info ConfigMap. For control planes without load balancer. Instances of workers which didn't join yet are recreated when all of their controllers are gone.")
 	flag.BoolVar(&profiling, "enable-profiling", false, "when set, enables the endpoints on the http server under /debug/pprof/")
 	flag.BoolVar(&externalCloudProvider, "external-cloud-provider", false, "when set, kubelets will receive --cloud-provider=external flag")
+	flag.StringVar(&cloudConfigSecretNamespace, "cloud-config-secret-namespace", "", "Namespace of the target cluster in which the cloud configs of machines with an external cloud provider are published as secrets named machine-controller-cloud-config-<provider>, so out-of-tree cloud-controller-managers can mount them. Disabled if empty.")
+	flag.StringVar(&nodeDNSProvider, "node-dns-provider", "", "DNS provider the addresses of machines are registered at as A and AAAA records named like the machine in the -node-dns-zone, one of route53 or digitalocean. Its credentials are read from the environment. Disabled if empty.")
+	flag.StringVar(&nodeDNSZone, "node-dns-zone", "", "The zone the records of the -node-dns-provider are registered in, e.g. nodes.example.com.")
 	flag.DurationVar(&skipEvictionAfter, "skip-eviction-after", 2*time.Hour, "Skips the eviction if a machine is not gone after the specified duration.")
+	flag.DurationVar(&forceDeleteAfter, "force-delete-after", 3*time.Hour, "Removes the finalizers of machines annotated for force deletion if they are not gone after the specified duration.")
+	flag.DurationVar(&instanceCacheTTL, "instance-cache-ttl", time.Minute, "How long the instances returned by the cloud providers are cached, so repeated reconciliations of a machine don't look up its instance each time. The cache entry of a machine is dropped when its instance gets created, updated or deleted. Disabled if 0.")
+	flag.DurationVar(&instanceCheckInterval, "instance-check-interval", 10*time.Minute, "How often to verify that the instances of machines with a ready node still exist at the cloud provider, to notice instances deleted outside of the machine-controller. Disabled if 0, then only instances of nodes which are not ready are verified.")
+	flag.BoolVar(&instanceGoneRecreate, "instance-gone-recreate", false, "When set, instances of machines which got deleted outside of the machine-controller are recreated. Otherwise the machines are marked as failed.")
+	flag.StringVar(&machineDefaultsFile, "machine-defaults-file", "", "Path to a YAML file with the kubelet version, the provider spec defaults by cloud provider and the cost center labels, which are stored in machines missing them before their instance gets created. Should match the -machine-defaults of the webhook, which rejects later changes of the spec.")
+	flag.StringVar(&vaultSettings.Address, "vault-address", "", "Address of the HashiCorp Vault server credentials referenced with vaultKeyRef are read from, e.g. https://vault.example.com:8200")
+	flag.StringVar(&vaultSettings.AuthMount, "vault-auth-mount", "kubernetes", "Path the Kubernetes auth method is mounted at in Vault")
+	flag.StringVar(&vaultSettings.Role, "vault-role", "", "Role of the Vault Kubernetes auth method to log in with, unless a vaultKeyRef sets one")
+	flag.StringVar(&vaultSettings.TokenFile, "vault-token-file", providerconfig.DefaultVaultTokenFile, "Service account token to log in to Vault with")
+	flag.StringVar(&vaultSettings.CAFile, "vault-ca-file", "", "CA bundle to verify the certificate of the Vault server with instead of the system roots")
+	flag.StringVar(&credentialProfilesSecret, "credential-profiles-secret", "", "Secret with named sets of cloud provider credentials machines select with credentialProfile, passed in namespace/name format. Each key is a profile, its value a YAML map of environment variables like DO_TOKEN to their values.")
+	flag.StringVar(&auditLogFile, "audit-log-file", "", "File the audit records of the instances created and deleted at the cloud providers are appended to as JSON lines, in addition to the log. Disabled if empty.")
+	flag.StringVar(&auditWebhookURL, "audit-webhook-url", "", "URL the audit records of the instances created and deleted at the cloud providers are posted to as JSON, in addition to the log. Disabled if empty.")
+	flag.StringVar(&approvalWebhookURL, "approval-webhook-url", "", "URL of a webhook which must approve the operations of -approval-webhook-operations on machines before they are carried out, e.g. of a change-management system. A bearer token for it is read from the APPROVAL_WEBHOOK_TOKEN environment variable. Disabled if empty.")
+	flag.StringVar(&approvalWebhookOperations, "approval-webhook-operations", "delete", "Comma separated list of the operations which need the approval of the -approval-webhook-url, delete and create.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint of an OpenTelemetry collector the spans of the reconciliations of machines are exported to, e.g. http://otel-collector:4318. Tracing is disabled if empty.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Validates new machines, renders their userdata to the <machine>-dry-run ConfigMap in their namespace and checks the quotas of the cloud provider, but does not create their instances. Single machines can be dry-run with the machine-controller.kubermatic.io/dry-run annotation instead.")
+	flag.StringVar(&chaos, "chaos", os.Getenv("MACHINE_CONTROLLER_CHAOS"), "Injects errors, latency and partial failures into the cloud provider calls for machines labeled machine-controller.kubermatic.io/chaos=true, to test the retries, garbage collection and remediation, e.g. errorRate=0.2,partialFailureRate=0.1,latency=30s,operations=create+delete. machines=all injects them for all machines. Defaults to the MACHINE_CONTROLLER_CHAOS environment variable, disabled if empty. Never enable it in production.")
+	flag.BoolVar(&costReport, "cost-report", false, "Reports the number of instances of each MachineSet by instance type, their hourly price if the cloud provider publishes it, and the costCenterLabels of the -machine-defaults-file of its template in the status of the MachineSet and as metrics, for chargeback.")
+	flag.BoolVar(&paused, "paused", false, "Stops the reconciliation of all machines, e.g. during incident response. Single machines can be paused with the machine-controller.kubermatic.io/paused annotation instead.")
 	flag.StringVar(&nodeHTTPProxy, "node-http-proxy", "", "If set, it configures the 'HTTP_PROXY' & 'HTTPS_PROXY' environment variable on the nodes.")
 	flag.StringVar(&nodeNoProxy, "node-no-proxy", ".svc,.cluster.local,localhost,127.0.0.1", "If set, it configures the 'NO_PROXY' environment variable on the nodes.")
 	flag.StringVar(&nodeInsecureRegistries, "node-insecure-registries", "", "Comma separated list of registries which should be configured as insecure on the container runtime")
@@ -171,22 +389,105 @@ func main() {
 	flag.StringVar(&nodeHyperkubeImage, "node-hyperkube-image", "k8s.gcr.io/hyperkube-amd64", "Image for the hyperkube container excluding tag. Only has effect on CoreOS Container Linux and Flatcar Linux, and for kubernetes < 1.18.")
 	flag.StringVar(&nodeKubeletRepository, "node-kubelet-repository", "quay.io/poseidon/kubelet", "Repository for the kubelet container. Only has effect on Flatcar Linux, and for kubernetes >= 1.18.")
 	flag.StringVar(&nodeKubeletFeatureGates, "node-kubelet-feature-gates", "RotateKubeletServerCertificate=true", "Feature gates to set on the kubelet. Default: RotateKubeletServerCertificate=true")
-	flag.BoolVar(&nodeCSRApprover, "node-csr-approver", false, "Enable NodeCSRApprover controller to automatically approve node serving certificate requests.")
+	flag.StringVar(&nodeKubeReserved, "node-kube-reserved", "", "Comma separated list of resources to reserve for kubernetes components on the nodes, e.g. cpu=200m,memory=500Mi. Machines may override it.")
+	flag.StringVar(&nodeSystemReserved, "node-system-reserved", "", "Comma separated list of resources to reserve for system daemons on the nodes, e.g. cpu=200m,memory=500Mi. Machines may override it.")
+	flag.StringVar(&nodeEvictionHard, "node-eviction-hard", "", "Comma separated list of hard eviction thresholds of the kubelet on the nodes, e.g. memory.available<100Mi,nodefs.available<10%. Machines may override it.")
+	flag.StringVar(&nodeK0sReleaseURL, "node-k0s-release-url", userdatahelper.DefaultK0sReleaseURL, "Endpoint to download k0s releases from on nodes of the k0s bootstrap flavor. Mirrors must serve the binaries under the same layout as the GitHub releases.")
+	flag.StringVar(&bootstrapUserDataURL, "bootstrap-userdata-url", "", "URL under which instances of machines with fetchUserDataOnBoot fetch their userdata, e.g. https://userdata.example.com. Must be reachable from the instances and point to the -bootstrap-userdata-listen-address.")
+	flag.StringVar(&bootstrapUserDataListenAddress, "bootstrap-userdata-listen-address", "", "The address on which the http server serving the userdata of machines with fetchUserDataOnBoot will listen on. Disabled if empty.")
+	flag.StringVar(&bootstrapUserDataTLSCertFile, "bootstrap-userdata-tls-cert-file", "", "Certificate file of the userdata http server. The server serves plain http if empty.")
+	flag.StringVar(&bootstrapUserDataTLSKeyFile, "bootstrap-userdata-tls-key-file", "", "Private key file of the userdata http server.")
+	flag.BoolVar(&nodeCSRApprover, "node-csr-approver", false, "Enable NodeCSRApprover controller to automatically approve node serving and client certificate requests of machines.")
+	flag.BoolVar(&capiMachines, "capi-machines", false, "Enable the controller creating cluster.k8s.io Machines for the Machines of upstream Cluster API (cluster.x-k8s.io/v1beta1) with the machine-controller.kubermatic.io/provider-spec annotation and reporting their state in the status of the Cluster API Machines. Requires the CRDs of Cluster API.")
+	flag.BoolVar(&k0sAutopilot, "k0s-autopilot", false, "Enable the controller upgrading the nodes of MachineDeployments with the machine-controller.kubermatic.io/autopilot-k0s-version annotation in place with k0s autopilot plans, instead of replacing their machines.")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", time.Minute, "The maximum duration to wait for in-flight reconciliations to finish on shutdown, before the leadership gets released. Should be lower than the terminationGracePeriodSeconds of the pod.")
+	flag.DurationVar(&eventAggregationWindow, "event-aggregation-window", 5*time.Minute, "Repeated warning events of a machine with the same reason, e.g. the same provider error on every retry, are emitted at most once per window with the number of repeats. 0 disables the aggregation.")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", 20*time.Minute, "The maximum duration of a reconciliation of a machine. The calls to the cloud provider get cancelled once it is exceeded and the machine is retried with a backoff. Should be lower than the -reconcile-liveness-timeout. 0 disables the timeout.")
+	flag.DurationVar(&cloudProviderTimeout, "cloud-provider-timeout", 10*time.Minute, "The maximum duration of a single lookup, creation, update or deletion of an instance at the cloud provider, within the -reconcile-timeout. 0 disables the timeout.")
+	flag.DurationVar(&resyncPeriod, "resync-period", 5*time.Minute, "How often all machines, MachineSets, MachineDeployments and nodes are reconciled again without any change. Higher values reduce the load on the apiserver and the cloud providers in large installations.")
+	flag.DurationVar(&backoffSettings.Base, "reconcile-backoff-base", 5*time.Second, "The delay before the first retry of a failed reconciliation of a machine, which doubles with each consecutive failure.")
+	flag.DurationVar(&backoffSettings.Max, "reconcile-backoff-max", 10*time.Minute, "The maximum delay between retries of failed reconciliations of a machine, also used for errors which need to be resolved by hand.")
+	flag.IntVar(&backoffSettings.MaxRetries, "reconcile-max-retries", 0, "The number of retries of a failing machine after which it is only reconciled again once it changes or with the -resync-period. 0 retries forever.")
+	flag.DurationVar(&reconcileLivenessTimeout, "reconcile-liveness-timeout", 30*time.Minute, "The liveness check fails once a reconciliation of a machine runs for longer, e.g. because a call to the cloud provider hangs, so the machine-controller gets restarted. 0 disables the check.")
+	flag.BoolVar(&migrateOnly, "migrate-only", false, "Migrate existing machines, MachineSets and MachineDeployments to the current API version and exit without starting the controllers. Instances are kept.")
+	flag.BoolVar(&leaderElect, "leader-elect", true, "Enable leader election using a Lease in the kube-system namespace, so only one of multiple replicas is active. Must only be disabled when running a single replica.")
 
 	flag.Parse()
 	kubeconfig = flag.Lookup("kubeconfig").Value.(flag.Getter).Get().(string)
 	masterURL = flag.Lookup("master").Value.(flag.Getter).Get().(string)
 
+	if workerCount < 1 {
+		klog.Fatalf("-worker-count must be at least 1, got %d", workerCount)
+	}
+	if maxConcurrentDeletions < 1 {
+		klog.Fatalf("-max-concurrent-deletions must be at least 1, got %d", maxConcurrentDeletions)
+	}
+
+	if bootstrapTokenTTL < 10*time.Minute {
+		klog.Fatalf("-bootstrap-token-ttl must be at least 10m, got %v", bootstrapTokenTTL)
+	}
+	if resyncPeriod <= 0 {
+		klog.Fatalf("-resync-period must be positive, got %v", resyncPeriod)
+	}
+	if backoffSettings.Base <= 0 || backoffSettings.Max < backoffSettings.Base || backoffSettings.MaxRetries < 0 {
+		klog.Fatalf("-reconcile-backoff-base must be positive and at most -reconcile-backoff-max, and -reconcile-max-retries must not be negative, got %v, %v and %d", backoffSettings.Base, backoffSettings.Max, backoffSettings.MaxRetries)
+	}
+
+	if cloudProviderQPS < 0 || cloudProviderBurst < 1 {
+		klog.Fatalf("-cloud-provider-qps must not be negative and -cloud-provider-burst must be at least 1, got %v and %d", cloudProviderQPS, cloudProviderBurst)
+	}
+	cloudproviderutil.SetRateLimits(float32(cloudProviderQPS), cloudProviderBurst)
+
+	if err := providerconfig.SetVault(vaultSettings); err != nil {
+		klog.Fatalf("invalid vault settings: %v", err)
+	}
+	if err := providerconfig.SetCredentialProfilesSecret(credentialProfilesSecret); err != nil {
+		klog.Fatalf("invalid -credential-profiles-secret: %v", err)
+	}
+	if err := tracing.Setup(otlpEndpoint, "machine-controller"); err != nil {
+		klog.Fatalf("invalid -otlp-endpoint: %v", err)
+	}
+	if err := audit.Setup(auditLogFile, auditWebhookURL, name); err != nil {
+		klog.Fatalf("invalid audit settings: %v", err)
+	}
+
+	if (bootstrapUserDataTLSCertFile == "") != (bootstrapUserDataTLSKeyFile == "") {
+		klog.Fatalf("-bootstrap-userdata-tls-cert-file and -bootstrap-userdata-tls-key-file must be set together")
+	}
+
 	clusterDNSIPs, err := parseClusterDNSIPs(clusterDNSIPs)
 	if err != nil {
 		klog.Fatalf("invalid cluster dns specified: %v", err)
 	}
 
+	var machineDefaults *providerconfig.MachineDefaults
+	if machineDefaultsFile != "" {
+		machineDefaults, err = providerconfig.LoadMachineDefaults(machineDefaultsFile)
+		if err != nil {
+			klog.Fatalf("failed to load machine defaults: %v", err)
+		}
+	}
+
 	kubeletFeatureGates, err := parseKubeletFeatureGates(nodeKubeletFeatureGates)
 	if err != nil {
 		klog.Fatalf("invalid kubelet feature gates specified: %v", err)
 	}
 
+	kubeReserved, err := parseKubeletKeyValues(nodeKubeReserved, "=")
+	if err != nil {
+		klog.Fatalf("invalid kube reserved resources specified: %v", err)
+	}
+
+	systemReserved, err := parseKubeletKeyValues(nodeSystemReserved, "=")
+	if err != nil {
+		klog.Fatalf("invalid system reserved resources specified: %v", err)
+	}
+
+	evictionHard, err := parseKubeletKeyValues(nodeEvictionHard, "<")
+	if err != nil {
+		klog.Fatalf("invalid eviction thresholds specified: %v", err)
+	}
+
 	var parsedJoinClusterTimeout *time.Duration
 	if joinClusterTimeout != "" {
 		parsedJoinClusterTimeoutLiteral, err := time.ParseDuration(joinClusterTimeout)
@@ -196,6 +497,22 @@ func main() {
 		}
 	}
 
+	var k0sTokens *machinecontroller.K0sTokenCreator
+	if k0sAdminKubeconfig != "" {
+		k0sTokens, err = machinecontroller.NewK0sTokenCreator(k0sBinary, k0sAdminKubeconfig)
+		if err != nil {
+			klog.Fatalf("invalid -k0s-admin-kubeconfig or -k0s-binary: %v", err)
+		}
+	}
+
+	chaosSettings, err := cloudprovider.ParseChaosSettings(chaos)
+	if err != nil {
+		klog.Fatalf("invalid chaos settings: %v", err)
+	}
+	if chaosSettings != nil {
+		klog.Warningf("Injecting failures into the cloud provider calls: %s", chaos)
+	}
+
 	stopCh := signals.SetupSignalHandler()
 
 	// Needed for migrations
@@ -246,37 +563,109 @@ func main() {
 		klog.Fatalf("error building kubernetes clientset for kubeClient: %v", err)
 	}
 
+	if disableSSHKeys {
+		ssh.Disable()
+	} else {
+		sshKey := &sshKeySecret{namespace: sshKeySecretNamespace, name: sshKeySecretName}
+		if err := sshKey.load(kubeClient); err != nil {
+			klog.Fatalf("failed to load the ssh key: %v", err)
+		}
+		sshKey.watch(kubeClient, stopCh)
+	}
+
 	ctrlruntimeClient, err := ctrlruntimeclient.New(cfg, ctrlruntimeclient.Options{})
 	if err != nil {
 		klog.Fatalf("error building ctrlruntime client: %v", err)
 	}
 
+	// The nodes join the cluster the machines live in, unless a target cluster is configured
+	var targetCfg *restclient.Config
+	kubeconfigProvider := clusterinfo.New(cfg, kubeClient)
+	if namespace != "" {
+		// The cache of the manager only holds the watched namespace, nodes and bootstrap tokens
+		// need a cache of their own
+		targetCfg = cfg
+	}
+	if targetKubeconfig != "" || targetMasterURL != "" {
+		targetCfg, err = clientcmd.BuildConfigFromFlags(targetMasterURL, targetKubeconfig)
+		if err != nil {
+			klog.Fatalf("error building kubeconfig for the target cluster: %v", err)
+		}
+		targetKubeClient, err := kubernetes.NewForConfig(targetCfg)
+		if err != nil {
+			klog.Fatalf("error building kubernetes clientset for the target cluster: %v", err)
+		}
+		kubeconfigProvider = clusterinfo.New(targetCfg, targetKubeClient)
+	}
+
 	prometheusRegistry := prometheus.DefaultRegisterer
 
-	kubeconfigProvider := clusterinfo.New(cfg, kubeClient)
 	runOptions := controllerRunOptions{
 		kubeClient: kubeClient,
 		metrics:    machinecontroller.NewMachineControllerMetrics(),
 
-		kubeconfigProvider:    kubeconfigProvider,
-		name:                  name,
-		prometheusRegisterer:  prometheusRegistry,
-		cfg:                   machineCfg,
-		externalCloudProvider: externalCloudProvider,
-		skipEvictionAfter:     skipEvictionAfter,
-		nodeCSRApprover:       nodeCSRApprover,
+		kubeconfigProvider:         kubeconfigProvider,
+		name:                       name,
+		namespace:                  namespace,
+		prometheusRegisterer:       prometheusRegistry,
+		cfg:                        machineCfg,
+		targetCfg:                  targetCfg,
+		externalCloudProvider:      externalCloudProvider,
+		skipEvictionAfter:          skipEvictionAfter,
+		forceDeleteAfter:           forceDeleteAfter,
+		bootstrapTokenTTL:          bootstrapTokenTTL,
+		k0sJoinControllerEndpoints: k0sJoinControllerEndpoints,
+		k0sTokens:                  k0sTokens,
+		dryRun:                     dryRun,
+		chaos:                      chaosSettings,
+		costReport:                 costReport,
+		maxConcurrentDeletions:     maxConcurrentDeletions,
+		paused:                     paused,
+		instanceCheckInterval:      instanceCheckInterval,
+		instanceCacheTTL:           instanceCacheTTL,
+		instanceGoneRecreate:       instanceGoneRecreate,
+		machineDefaults:            machineDefaults,
+		nodeCSRApprover:            nodeCSRApprover,
+		k0sAutopilot:               k0sAutopilot,
+		capiMachines:               capiMachines,
+		leaderElect:                leaderElect,
+		shutdownTimeout:            shutdownTimeout,
+		inFlight:                   &machinecontroller.InFlightReconciles{},
+		status:                     &machinehealth.ControllerStatus{},
+		debugState:                 machinecontroller.NewDebugState(),
+		migrateOnly:                migrateOnly,
 		node: machinecontroller.NodeSettings{
-			ClusterDNSIPs:       clusterDNSIPs,
-			HTTPProxy:           nodeHTTPProxy,
-			NoProxy:             nodeNoProxy,
-			HyperkubeImage:      nodeHyperkubeImage,
-			KubeletRepository:   nodeKubeletRepository,
-			KubeletFeatureGates: kubeletFeatureGates,
-			PauseImage:          nodePauseImage,
+			ClusterDNSIPs:        clusterDNSIPs,
+			HTTPProxy:            nodeHTTPProxy,
+			NoProxy:              nodeNoProxy,
+			HyperkubeImage:       nodeHyperkubeImage,
+			KubeletRepository:    nodeKubeletRepository,
+			KubeletFeatureGates:  kubeletFeatureGates,
+			KubeReserved:         kubeReserved,
+			SystemReserved:       systemReserved,
+			EvictionHard:         evictionHard,
+			PauseImage:           nodePauseImage,
+			K0sReleaseURL:        nodeK0sReleaseURL,
+			BootstrapUserDataURL: bootstrapUserDataURL,
 		},
 	}
+	if nodeDNSProvider != "" {
+		provider, err := nodedns.New(nodeDNSProvider, nodeDNSZone)
+		if err != nil {
+			klog.Fatalf("invalid node dns settings: %v", err)
+		}
+		runOptions.nodeDNS = nodedns.NewRegistrar(provider)
+	}
+	if approvalWebhookURL != "" {
+		gate, err := approval.New(approvalWebhookURL, approvalWebhookOperations, os.Getenv("APPROVAL_WEBHOOK_TOKEN"), name)
+		if err != nil {
+			klog.Fatalf("invalid approval webhook settings: %v", err)
+		}
+		runOptions.approvalGate = gate
+	}
 	if parsedJoinClusterTimeout != nil {
 		runOptions.joinClusterTimeout = parsedJoinClusterTimeout
+		runOptions.joinClusterTimeoutRecreate = joinClusterTimeoutRecreate
 	}
 
 	for _, registry := range strings.Split(nodeInsecureRegistries, ",") {
@@ -297,14 +686,18 @@ func main() {
 			klog.Fatalf("Splitting the bootstrap-token-service-account-name flag value in '/' returned %d parts, expected exactly two", flagPartsLen)
 		}
 		runOptions.bootstrapTokenServiceAccountName = &types.NamespacedName{Namespace: flagParts[0], Name: flagParts[1]}
+		klog.Warningf("Using the long-lived token of ServiceAccount %s as bootstrap token, it can be read from the userdata of all instances", bootstrapTokenServiceAccountName)
 	}
 
 	ctx, ctxDone := context.WithCancel(context.Background())
 	var g run.Group
 	{
-		prometheusRegistry.MustRegister(machinecontroller.NewMachineCollector(ctx, ctrlruntimeClient))
+		prometheusRegistry.MustRegister(machinecontroller.NewMachineCollector(ctx, ctrlruntimeClient, namespace))
+		cloudprovider.RegisterMetrics(prometheusRegistry)
 
-		s := createUtilHTTPServer(kubeClient, kubeconfigProvider, prometheus.DefaultGatherer)
+		// The workqueue and reconcile metrics of controller-runtime are kept in a registry of their own
+		runOptions.leaderElectionWatchdog = leaderelection.NewLeaderHealthzAdaptor(leaderElectionLivenessTimeout)
+		s := createUtilHTTPServer(kubeClient, kubeconfigProvider, prometheus.Gatherers{prometheus.DefaultGatherer, ctrlruntimemetrics.Registry}, runOptions)
 		g.Add(func() error {
 			return s.ListenAndServe()
 		}, func(err error) {
@@ -316,6 +709,27 @@ func main() {
 			}
 		})
 	}
+	if bootstrapUserDataListenAddress != "" {
+		s := &http.Server{
+			Addr:         bootstrapUserDataListenAddress,
+			Handler:      stub.NewHandler(ctrlruntimeClient),
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		g.Add(func() error {
+			if bootstrapUserDataTLSCertFile != "" {
+				return s.ListenAndServeTLS(bootstrapUserDataTLSCertFile, bootstrapUserDataTLSKeyFile)
+			}
+			return s.ListenAndServe()
+		}, func(err error) {
+			klog.Warningf("shutting down userdata HTTP server due to: %s", err)
+			srvCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			if err = s.Shutdown(srvCtx); err != nil {
+				klog.Errorf("failed to shutdown userdata HTTP server: %s", err)
+			}
+		})
+	}
 	{
 		g.Add(func() error {
 			select {
@@ -340,14 +754,17 @@ func main() {
 	}
 
 	klog.Info(g.Run())
+	tracing.Shutdown()
+	audit.Shutdown()
 }
 
 // startControllerViaLeaderElection starts machine controller only if a proper lock was acquired.
 // This essentially means that we can have multiple instances and at the same time only one is operational.
-// The program terminates when the leadership was lost.
+// The program terminates when the leadership was lost. Without leader election the controller starts right away.
+// On shutdown, in-flight reconciliations may finish within the shutdown timeout before the leadership is released.
 func startControllerViaLeaderElection(runOptions controllerRunOptions) error {
-	mgrSyncPeriod := 5 * time.Minute
-	mgr, err := manager.New(runOptions.cfg, manager.Options{SyncPeriod: &mgrSyncPeriod})
+	mgrSyncPeriod := resyncPeriod
+	mgr, err := manager.New(runOptions.cfg, manager.Options{SyncPeriod: &mgrSyncPeriod, Namespace: runOptions.namespace})
 	if err != nil {
 		klog.Errorf("failed to create manager: %v", err)
 		runOptions.parentCtxDone()
@@ -366,25 +783,41 @@ func startControllerViaLeaderElection(runOptions controllerRunOptions) error {
 	if runOptions.name != "" {
 		leaderName = runOptions.name + "-" + leaderName
 	}
+	if runOptions.namespace != "" {
+		leaderName = runOptions.namespace + "-" + leaderName
+	}
 
-	rl := resourcelock.EndpointsLock{
-		EndpointsMeta: metav1.ObjectMeta{
+	rl := resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
 			Namespace: defaultLeaderElectionNamespace,
 			Name:      leaderName,
 		},
-		Client: runOptions.kubeClient.CoreV1(),
+		Client: runOptions.kubeClient.CoordinationV1(),
 		LockConfig: resourcelock.ResourceLockConfig{
 			Identity:      id + fmt.Sprintf("-%s", leaderName),
 			EventRecorder: mgr.GetEventRecorderFor("machine_controller_leader_election"),
 		},
 	}
 
+	// The controllers get a context which outlives the parent context, so in-flight reconciliations are
+	// not aborted on shutdown, which could leave half-created instances behind
+	controllerCtx, stopControllers := context.WithCancel(context.Background())
+	defer stopControllers()
+	inFlight := runOptions.inFlight
+
 	// I think this might be a bit paranoid but the fact the there is no way
 	// to stop the leader election library might cause synchronization issues.
 	// imagine that a user wants to shutdown the app but since there is no way of telling the library to stop it will eventually run `runController` method
 	// and bad things can happen - the fact it works at the moment doesn't mean it will in the future
 	runController := func(ctx context.Context) {
+		runOptions.status.SetLeading()
 
+		targetCluster, err := targetcluster.New(mgr, runOptions.targetCfg, mgrSyncPeriod)
+		if err != nil {
+			klog.Errorf("failed to create clients for the target cluster: %v", err)
+			runOptions.parentCtxDone()
+			return
+		}
 		providerData := &cloudprovidertypes.ProviderData{
 			Ctx:    ctx,
 			Update: cloudprovidertypes.GetMachineUpdater(ctx, mgr.GetClient()),
@@ -404,42 +837,86 @@ func startControllerViaLeaderElection(runOptions controllerRunOptions) error {
 			klog.Error("Timed out waiting for cache to sync")
 			return
 		}
+		if synced := targetCluster.WaitForCacheSync(cacheSyncContext.Done()); !synced {
+			klog.Error("Timed out waiting for the cache of the target cluster to sync")
+			return
+		}
+		runOptions.status.SetCachesSynced()
+
+		// A failed migration must result in a non-zero exit code when only migrating, e.g. in a Job
+		logMigrationError := klog.Errorf
+		if runOptions.migrateOnly {
+			logMigrationError = klog.Fatalf
+		}
 
 		// Migrate MachinesV1Alpha1Machine to ClusterV1Alpha1Machine
 		if err := migrations.MigrateMachinesv1Alpha1MachineToClusterv1Alpha1MachineIfNecessary(ctx, mgr.GetClient(), runOptions.kubeClient, providerData); err != nil {
-			klog.Errorf("Migration to clusterv1alpha1 failed: %v", err)
+			logMigrationError("Migration to clusterv1alpha1 failed: %v", err)
 			runOptions.parentCtxDone()
 			return
 		}
 
 		// Migrate providerConfig field to providerSpec field
 		if err := migrations.MigrateProviderConfigToProviderSpecIfNecesary(ctx, runOptions.cfg, mgr.GetClient()); err != nil {
-			klog.Errorf("Migration of providerConfig field to providerSpec field failed: %v", err)
+			logMigrationError("Migration of providerConfig field to providerSpec field failed: %v", err)
 			runOptions.parentCtxDone()
 			return
 		}
 
-		if err := machinecontroller.Add(
-			ctx,
-			mgr,
-			runOptions.kubeClient,
-			workerCount,
-			runOptions.metrics,
-			runOptions.prometheusRegisterer,
-			runOptions.kubeconfigProvider,
-			providerData,
-			runOptions.joinClusterTimeout,
-			runOptions.externalCloudProvider,
-			runOptions.name,
-			runOptions.bootstrapTokenServiceAccountName,
-			runOptions.skipEvictionAfter,
-			runOptions.node,
-		); err != nil {
+		if runOptions.migrateOnly {
+			klog.Info("Migrations finished, stopping as -migrate-only is set")
+			runOptions.parentCtxDone()
+			return
+		}
+
+		if err := machinecontroller.Add(ctx, mgr, machinecontroller.Options{
+			TargetCluster:                    targetCluster,
+			Workers:                          workerCount,
+			Metrics:                          runOptions.metrics,
+			PrometheusRegistry:               runOptions.prometheusRegisterer,
+			KubeconfigProvider:               runOptions.kubeconfigProvider,
+			ProviderData:                     providerData,
+			JoinClusterTimeout:               runOptions.joinClusterTimeout,
+			JoinClusterTimeoutRecreate:       runOptions.joinClusterTimeoutRecreate,
+			ExternalCloudProvider:            runOptions.externalCloudProvider,
+			Name:                             runOptions.name,
+			BootstrapTokenServiceAccountName: runOptions.bootstrapTokenServiceAccountName,
+			SkipEvictionAfter:                runOptions.skipEvictionAfter,
+			ForceDeleteAfter:                 runOptions.forceDeleteAfter,
+			Paused:                           runOptions.paused,
+			InstanceCheckInterval:            runOptions.instanceCheckInterval,
+			InstanceCacheTTL:                 runOptions.instanceCacheTTL,
+			InstanceGoneRecreate:             runOptions.instanceGoneRecreate,
+			MachineDefaults:                  runOptions.machineDefaults,
+			Node:                             runOptions.node,
+			InFlight:                         inFlight,
+			DebugState:                       runOptions.debugState,
+			EventAggregationWindow:           eventAggregationWindow,
+			ReconcileTimeout:                 reconcileTimeout,
+			CloudProviderTimeout:             cloudProviderTimeout,
+			Backoff:                          backoffSettings,
+			CloudConfigSecretNamespace:       cloudConfigSecretNamespace,
+			NodeDNS:                          runOptions.nodeDNS,
+			ApprovalGate:                     runOptions.approvalGate,
+			BootstrapTokenTTL:                runOptions.bootstrapTokenTTL,
+			K0sControllerEndpoints:           runOptions.k0sJoinControllerEndpoints,
+			K0sTokens:                        runOptions.k0sTokens,
+			DryRun:                           runOptions.dryRun,
+			Chaos:                            runOptions.chaos,
+		}); err != nil {
 			klog.Errorf("failed to add Machine controller to manager: %v", err)
 			runOptions.parentCtxDone()
 			return
 		}
-		if err := machinesetcontroller.Add(mgr); err != nil {
+		var costCenterLabels []string
+		if runOptions.machineDefaults != nil {
+			costCenterLabels = runOptions.machineDefaults.CostCenterLabels
+		}
+		if err := machinesetcontroller.Add(mgr, machinesetcontroller.Options{
+			CostReport:             runOptions.costReport,
+			CostCenterLabels:       costCenterLabels,
+			MaxConcurrentDeletions: runOptions.maxConcurrentDeletions,
+		}); err != nil {
 			klog.Errorf("failed to add MachineSet controller to manager: %v", err)
 			runOptions.parentCtxDone()
 			return
@@ -449,22 +926,65 @@ func startControllerViaLeaderElection(runOptions controllerRunOptions) error {
 			runOptions.parentCtxDone()
 			return
 		}
+		if err := bootstraptoken.Add(mgr, targetCluster); err != nil {
+			klog.Errorf("failed to add BootstrapToken controller to manager: %v", err)
+			runOptions.parentCtxDone()
+			return
+		}
+		if err := machineclass.Add(mgr); err != nil {
+			klog.Errorf("failed to add MachineClass controller to manager: %v", err)
+			runOptions.parentCtxDone()
+			return
+		}
+		if err := machinehealthcheck.Add(mgr, targetCluster); err != nil {
+			klog.Errorf("failed to add MachineHealthCheck controller to manager: %v", err)
+			runOptions.parentCtxDone()
+			return
+		}
 		if runOptions.nodeCSRApprover {
-			if err := nodecsrapprover.Add(mgr); err != nil {
+			if err := nodecsrapprover.Add(mgr, targetCluster); err != nil {
 				klog.Errorf("failed to add NodeCSRApprover controller to manager: %v", err)
 				runOptions.parentCtxDone()
 				return
 			}
 		}
+		if runOptions.k0sAutopilot {
+			if err := autopilot.Add(mgr, targetCluster, runOptions.node.K0sReleaseURL); err != nil {
+				klog.Errorf("failed to add k0s autopilot controller to manager: %v", err)
+				runOptions.parentCtxDone()
+				return
+			}
+		}
+		if runOptions.capiMachines {
+			if err := capimachine.Add(mgr); err != nil {
+				klog.Errorf("failed to add Cluster API Machine controller to manager: %v", err)
+				runOptions.parentCtxDone()
+				return
+			}
+		}
 
 		klog.Info("machine controller startup complete")
 	}
 
+	if !runOptions.leaderElect {
+		klog.Info("leader election is disabled, starting the controllers right away")
+		go runController(controllerCtx)
+
+		// The manager shuts the workqueues down once the parent context is done
+		<-runOptions.parentCtx.Done()
+		waitForInFlightReconciles(inFlight, runOptions.shutdownTimeout)
+		klog.Info("machine controller has been successfully stopped")
+		return nil
+	}
+
 	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
 		Lock:          &rl,
 		LeaseDuration: defaultLeaderElectionLeaseDuration,
 		RenewDeadline: defaultLeaderElectionRenewDeadline,
 		RetryPeriod:   defaultLeaderElectionRetryPeriod,
+		WatchDog:      runOptions.leaderElectionWatchdog,
+		// Releasing the lease on shutdown lets another replica take over right away
+		ReleaseOnCancel: true,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: runController,
 			OnStoppedLeading: func() {
@@ -475,17 +995,45 @@ func startControllerViaLeaderElection(runOptions controllerRunOptions) error {
 	if err != nil {
 		return err
 	}
-	go le.Run(runOptions.parentCtx)
-
+	leaderElectionDone := make(chan struct{})
+	go func() {
+		le.Run(controllerCtx)
+		close(leaderElectionDone)
+	}()
+
+	// The manager shuts the workqueues down once the parent context is done. The leadership must only be
+	// released after the in-flight reconciliations finished, so no other replica works on their machines.
+	// Reconciliations which did not start until then are refused, they get picked up by the next leader
 	<-runOptions.parentCtx.Done()
+	waitForInFlightReconciles(inFlight, runOptions.shutdownTimeout)
+	stopControllers()
+	<-leaderElectionDone
 	klog.Info("machine controller has been successfully stopped")
 	return nil
 }
 
+// waitForInFlightReconciles stops new reconciliations from starting and waits until the in-flight ones
+// finished, at most for the given timeout.
+func waitForInFlightReconciles(inFlight *machinecontroller.InFlightReconciles, timeout time.Duration) {
+	if inFlight.StopAndWait(timeout) {
+		klog.Info("all in-flight reconciliations finished")
+	} else {
+		klog.Warningf("in-flight reconciliations did not finish within %s", timeout)
+	}
+}
+
 // createUtilHTTPServer creates a new HTTP server
-func createUtilHTTPServer(kubeClient kubernetes.Interface, kubeconfigProvider machinecontroller.KubeconfigProvider, prometheusGatherer prometheus.Gatherer) *http.Server {
+func createUtilHTTPServer(kubeClient kubernetes.Interface, kubeconfigProvider machinecontroller.KubeconfigProvider, prometheusGatherer prometheus.Gatherer, runOptions controllerRunOptions) *http.Server {
 	health := healthcheck.NewHandler()
+	// Restarting the machine-controller only helps if it is wedged, not if the apiserver is unreachable
+	health.AddLivenessCheck("leader-election", func() error {
+		return runOptions.leaderElectionWatchdog.Check(nil)
+	})
+	health.AddLivenessCheck("machine-reconciliations", func() error {
+		return runOptions.inFlight.CheckHanging(reconcileLivenessTimeout)
+	})
 	health.AddReadinessCheck("apiserver-connection", machinehealth.ApiserverReachable(kubeClient))
+	health.AddReadinessCheck("caches-synced", machinehealth.CachesSynced(runOptions.status))
 
 	for name, c := range readinessChecks(kubeconfigProvider) {
 		health.AddReadinessCheck(name, c)
@@ -493,21 +1041,26 @@ func createUtilHTTPServer(kubeClient kubernetes.Interface, kubeconfigProvider ma
 
 	m := http.NewServeMux()
 	m.Handle("/metrics", promhttp.HandlerFor(prometheusGatherer, promhttp.HandlerOpts{}))
+	m.Handle("/healthz", http.HandlerFunc(health.LiveEndpoint))
+	m.Handle("/readyz", http.HandlerFunc(health.ReadyEndpoint))
 	m.Handle("/live", http.HandlerFunc(health.LiveEndpoint))
 	m.Handle("/ready", http.HandlerFunc(health.ReadyEndpoint))
+	m.Handle("/debug/machines", debug.Authorize(kubeClient, runOptions.debugState))
+	writeTimeout := 10 * time.Second
 	if profiling {
 		m.HandleFunc("/debug/pprof/", pprof.Index)
 		m.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
 		m.HandleFunc("/debug/pprof/profile", pprof.Profile)
 		m.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 		m.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		writeTimeout = profilingWriteTimeout
 	}
 
 	return &http.Server{
 		Addr:         listenAddress,
 		Handler:      m,
 		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: writeTimeout,
 	}
 }
 
@@ -576,3 +1129,21 @@ func parseKubeletFeatureGates(s string) (map[string]bool, error) {
 
 	return featureGates, nil
 }
+
+// parseKubeletKeyValues parses a comma separated list of key value pairs, like the
+// kubelet flags --kube-reserved (key=value) and --eviction-hard (key<value).
+func parseKubeletKeyValues(s, sep string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	values := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		sPair := strings.Split(strings.TrimSpace(pair), sep)
+		if len(sPair) != 2 || sPair[0] == "" || sPair[1] == "" {
+			return nil, fmt.Errorf("invalid key value pair: %q, expected key%svalue", pair, sep)
+		}
+		values[sPair[0]] = sPair[1]
+	}
+	return values, nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+// runSchema implements the schema subcommand, which prints the JSON schema of the provider spec of a
+// cloud provider, so editors and CI pipelines can check manifests without access to the webhook.
+// It returns the exit code.
+func runSchema(args []string) int {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: machine-controller schema <cloud provider>\n\nCloud providers: %v\n", providerconfigtypes.AllCloudProviders)
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	provider := providerconfigtypes.CloudProvider(fs.Arg(0))
+	schema, err := cloudprovider.ProviderSpecSchema(provider)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "no schema for cloud provider %q: %v\n", provider, err)
+		return 2
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(schema); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the schema: %v\n", err)
+		return 1
+	}
+	return 0
+}
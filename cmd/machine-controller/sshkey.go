@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/common/ssh"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// sshKeySecret is the secret with the keypair which is used for the instances instead of temporary
+// keypairs. It holds either the private key, optionally encrypted with a passphrase, or just the public
+// key, and optionally the name of the key at cloud providers.
+type sshKeySecret struct {
+	namespace string
+	name      string
+	// resourceVersion of the secret the configured key was read from
+	resourceVersion string
+}
+
+// load configures the key of the secret, if it exists
+func (s *sshKeySecret) load(kubeClient kubernetes.Interface) error {
+	secret, err := kubeClient.CoreV1().Secrets(s.namespace).Get(s.name, metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get secret %s/%s: %v", s.namespace, s.name, err)
+	}
+	return s.set(secret)
+}
+
+// watch reloads the key whenever the secret gets changed out of band, e.g. when external-secrets or
+// sealed-secrets rotated it, until the given channel is closed. Instances which exist already keep the
+// previous key. An invalid key is ignored and the previous one is kept, deleting the secret drops the key.
+func (s *sshKeySecret) watch(kubeClient kubernetes.Interface, stopCh <-chan struct{}) {
+	factory := informers.NewSharedInformerFactoryWithOptions(kubeClient, 0,
+		informers.WithNamespace(s.namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", s.name).String()
+		}),
+	)
+	factory.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			s.reload(obj.(*corev1.Secret))
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			s.reload(obj.(*corev1.Secret))
+		},
+		DeleteFunc: func(_ interface{}) {
+			ssh.ClearKey()
+			s.resourceVersion = ""
+			klog.Infof("The ssh key secret %s/%s got deleted, using temporary keypairs for new instances", s.namespace, s.name)
+		},
+	})
+	factory.Start(stopCh)
+}
+
+// reload configures the key of the given version of the secret unless it is configured already. The
+// handlers of the informer are called one after another, so no lock is needed.
+func (s *sshKeySecret) reload(secret *corev1.Secret) {
+	if secret.ResourceVersion == s.resourceVersion {
+		return
+	}
+	if err := s.set(secret); err != nil {
+		klog.Errorf("Failed to reload the ssh key, keeping the previous one: %v", err)
+	}
+}
+
+// set configures the key of the given secret
+func (s *sshKeySecret) set(secret *corev1.Secret) error {
+	var key *ssh.Pubkey
+	var err error
+	if privateKey := secret.Data["private-key"]; len(privateKey) > 0 {
+		key, err = ssh.ParsePrivateKey(privateKey, secret.Data["passphrase"])
+	} else if publicKey := secret.Data["public-key"]; len(publicKey) > 0 {
+		key, err = ssh.ParsePublicKey(publicKey)
+	} else {
+		return fmt.Errorf("secret %s/%s has neither a private-key nor a public-key", s.namespace, s.name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid key in secret %s/%s: %v", s.namespace, s.name, err)
+	}
+
+	ssh.SetKey(key, string(secret.Data["name"]))
+	s.resourceVersion = secret.ResourceVersion
+	klog.Infof("Using the ssh key with fingerprint %s of secret %s/%s for instances", key.FingerprintMD5, s.namespace, s.name)
+	return nil
+}
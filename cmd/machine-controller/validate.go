@@ -0,0 +1,200 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+// runValidate implements the validate subcommand, which checks the provider specs of the machines,
+// MachineSets and MachineDeployments of a manifest, so CI pipelines can catch invalid specs before
+// applying them. It returns the exit code: 1 if a spec is invalid, 2 on usage errors.
+func runValidate(args []string) int {
+	var (
+		file       string
+		online     bool
+		kubeconfig string
+		masterURL  string
+	)
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.StringVar(&file, "f", "", "Path to the manifest with the machines, MachineSets and MachineDeployments to validate, - reads it from stdin.")
+	fs.BoolVar(&online, "online", false, "Also default the specs and run the validation of the cloud providers like the webhook does. Talks to the cloud provider APIs and needs valid credentials.")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig of the cluster with the secrets and config maps the specs reference. Only used with -online, without it references can't be resolved.")
+	fs.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only used with -online.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "-f must be set")
+		fs.Usage()
+		return 2
+	}
+
+	var (
+		content []byte
+		err     error
+	)
+	if file == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", file, err)
+		return 2
+	}
+
+	var client ctrlruntimeclient.Client = noClusterClient{}
+	if online && (kubeconfig != "" || masterURL != "") {
+		cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error building kubeconfig: %v\n", err)
+			return 2
+		}
+		client, err = ctrlruntimeclient.New(cfg, ctrlruntimeclient.Options{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error building ctrlruntime client: %v\n", err)
+			return 2
+		}
+	}
+	cvr := providerconfig.NewConfigVarResolver(context.Background(), client)
+
+	invalid := 0
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+	for {
+		document, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", file, err)
+			return 2
+		}
+
+		object, spec, err := machineSpecFromDocument(document)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			invalid++
+			continue
+		}
+		if spec == nil {
+			continue
+		}
+		if err := validateMachineSpec(*spec, cvr, online); err != nil {
+			fmt.Printf("%s: %v\n", object, err)
+			invalid++
+			continue
+		}
+		fmt.Printf("%s: valid\n", object)
+	}
+
+	if invalid > 0 {
+		fmt.Fprintf(os.Stderr, "%d invalid objects in %s\n", invalid, file)
+		return 1
+	}
+	return 0
+}
+
+// machineSpecFromDocument returns the kind and name and the machine spec of the object in the given
+// manifest document. The spec is nil for empty documents and objects of other kinds.
+func machineSpecFromDocument(document []byte) (string, *clusterv1alpha1.MachineSpec, error) {
+	typeMeta := metav1.TypeMeta{}
+	if err := kyaml.Unmarshal(document, &typeMeta); err != nil {
+		return "", nil, fmt.Errorf("failed to parse document: %v", err)
+	}
+
+	switch typeMeta.Kind {
+	case "Machine":
+		machine := &clusterv1alpha1.Machine{}
+		if err := kyaml.UnmarshalStrict(document, machine); err != nil {
+			return "", nil, fmt.Errorf("failed to parse Machine: %v", err)
+		}
+		return "Machine " + machine.Name, &machine.Spec, nil
+	case "MachineSet":
+		machineSet := &clusterv1alpha1.MachineSet{}
+		if err := kyaml.UnmarshalStrict(document, machineSet); err != nil {
+			return "", nil, fmt.Errorf("failed to parse MachineSet: %v", err)
+		}
+		return "MachineSet " + machineSet.Name, &machineSet.Spec.Template.Spec, nil
+	case "MachineDeployment":
+		machineDeployment := &clusterv1alpha1.MachineDeployment{}
+		if err := kyaml.UnmarshalStrict(document, machineDeployment); err != nil {
+			return "", nil, fmt.Errorf("failed to parse MachineDeployment: %v", err)
+		}
+		return "MachineDeployment " + machineDeployment.Name, &machineDeployment.Spec.Template.Spec, nil
+	}
+	return "", nil, nil
+}
+
+// validateMachineSpec reads the provider config of the given spec and checks its cloud provider is
+// supported. Online, the spec also gets defaulted and validated by the cloud provider, which talks
+// to the provider API.
+func validateMachineSpec(spec clusterv1alpha1.MachineSpec, cvr *providerconfig.ConfigVarResolver, online bool) error {
+	if spec.ProviderSpec.ValueFrom != nil {
+		return errors.New("providerSpec.valueFrom can't be validated, MachineClasses are only resolved by the webhook")
+	}
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		return fmt.Errorf("failed to read machine.spec.providerSpec: %v", err)
+	}
+	prov, err := cloudprovider.ForProvider(providerConfig.CloudProvider, cvr)
+	if err != nil {
+		return fmt.Errorf("failed to get cloud provider %q: %v", providerConfig.CloudProvider, err)
+	}
+	if !online {
+		return nil
+	}
+
+	defaultedSpec, err := prov.AddDefaults(spec)
+	if err != nil {
+		return fmt.Errorf("failed to default machineSpec: %v", err)
+	}
+	if err := prov.Validate(defaultedSpec); err != nil {
+		return fmt.Errorf("validation failed: %v", err)
+	}
+	return nil
+}
+
+// noClusterClient is used without a kubeconfig, it fails to resolve references to secrets and
+// config maps instead of reaching out to a cluster
+type noClusterClient struct {
+	ctrlruntimeclient.Client
+}
+
+func (noClusterClient) Get(_ context.Context, key ctrlruntimeclient.ObjectKey, _ runtime.Object) error {
+	return fmt.Errorf("can't get %s without -kubeconfig", key)
+}
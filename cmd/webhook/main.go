@@ -18,21 +18,35 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"time"
 
 	"github.com/kubermatic/machine-controller/pkg/admission"
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
 	userdatamanager "github.com/kubermatic/machine-controller/pkg/userdata/manager"
 
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var (
-	masterURL              string
-	kubeconfig             string
-	admissionListenAddress string
-	admissionTLSCertPath   string
-	admissionTLSKeyPath    string
+	masterURL                string
+	kubeconfig               string
+	admissionListenAddress   string
+	admissionTLSCertPath     string
+	admissionTLSKeyPath      string
+	k0sReleaseURL            string
+	machineDefaultsPath      string
+	requireCredentialRefs    bool
+	vaultSettings            providerconfig.VaultSettings
+	credentialProfilesSecret string
+	validationTimeout        time.Duration
+	versionSkewPolicy        string
 )
 
 func main() {
@@ -46,26 +60,68 @@ func main() {
 	flag.StringVar(&admissionListenAddress, "listen-address", ":9876", "The address on which the MutatingWebhook will listen on")
 	flag.StringVar(&admissionTLSCertPath, "tls-cert-path", "/tmp/cert/cert.pem", "The path of the TLS cert for the MutatingWebhook")
 	flag.StringVar(&admissionTLSKeyPath, "tls-key-path", "/tmp/cert/key.pem", "The path of the TLS key for the MutatingWebhook")
+	flag.StringVar(&k0sReleaseURL, "k0s-release-url", userdatahelper.DefaultK0sReleaseURL, "The endpoint k0s versions of machines are validated against. Must match the -node-k0s-release-url of the machine-controller")
+	flag.StringVar(&machineDefaultsPath, "machine-defaults", "", "Path to a YAML file with the kubelet version, the provider spec defaults by cloud provider and the cost center labels, which are applied to machines")
+	flag.BoolVar(&requireCredentialRefs, "require-credential-refs", false, "Reject machines whose cloud provider credentials are set inline instead of referencing a secret with secretKeyRef or vaultKeyRef or being taken from the environment of the machine-controller")
+	flag.StringVar(&vaultSettings.Address, "vault-address", "", "Address of the HashiCorp Vault server credentials referenced with vaultKeyRef are read from, e.g. https://vault.example.com:8200")
+	flag.StringVar(&vaultSettings.AuthMount, "vault-auth-mount", "kubernetes", "Path the Kubernetes auth method is mounted at in Vault")
+	flag.StringVar(&vaultSettings.Role, "vault-role", "", "Role of the Vault Kubernetes auth method to log in with, unless a vaultKeyRef sets one")
+	flag.StringVar(&vaultSettings.TokenFile, "vault-token-file", providerconfig.DefaultVaultTokenFile, "Service account token to log in to Vault with")
+	flag.StringVar(&vaultSettings.CAFile, "vault-ca-file", "", "CA bundle to verify the certificate of the Vault server with instead of the system roots")
+	flag.StringVar(&credentialProfilesSecret, "credential-profiles-secret", "", "Secret with named sets of cloud provider credentials machines select with credentialProfile, passed in namespace/name format. Each key is a profile, its value a YAML map of environment variables like DO_TOKEN to their values.")
+	flag.DurationVar(&validationTimeout, "validation-timeout", 8*time.Second, "Maximum time the validations talking to the cloud provider or the k0s release endpoint may take per admission request. Must be below the timeoutSeconds of the webhook configuration, 0 disables the deadline")
+	flag.StringVar(&versionSkewPolicy, "version-skew-policy", admission.VersionSkewPolicyReject, fmt.Sprintf("What to do with new machines whose Kubernetes version, the one of their k0s release for the k0s bootstrap flavor, is outside of the supported skew of the running kube-apiserver: %q rejects them, %q only logs a warning", admission.VersionSkewPolicyReject, admission.VersionSkewPolicyWarn))
 	flag.Parse()
 	kubeconfig = flag.Lookup("kubeconfig").Value.(flag.Getter).Get().(string)
 	masterURL = flag.Lookup("master").Value.(flag.Getter).Get().(string)
 
+	if versionSkewPolicy != admission.VersionSkewPolicyReject && versionSkewPolicy != admission.VersionSkewPolicyWarn {
+		klog.Fatalf("-version-skew-policy must be %q or %q", admission.VersionSkewPolicyReject, admission.VersionSkewPolicyWarn)
+	}
+	if validationTimeout < 0 {
+		klog.Fatalf("-validation-timeout must not be negative")
+	}
+	if err := providerconfig.SetVault(vaultSettings); err != nil {
+		klog.Fatalf("invalid vault settings: %v", err)
+	}
+	if err := providerconfig.SetCredentialProfilesSecret(credentialProfilesSecret); err != nil {
+		klog.Fatalf("invalid -credential-profiles-secret: %v", err)
+	}
+
 	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 	if err != nil {
 		klog.Fatalf("error building kubeconfig: %v", err)
 	}
 
+	// Needed for reading OperatingSystemProfiles
+	if err := clusterv1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		klog.Fatalf("failed to add clusterv1alpha1 api to scheme: %v", err)
+	}
+
 	client, err := ctrlruntimeclient.New(cfg, ctrlruntimeclient.Options{})
 	if err != nil {
 		klog.Fatalf("failed to build client: %v", err)
 	}
 
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("failed to build kubernetes client: %v", err)
+	}
+
 	um, err := userdatamanager.New()
 	if err != nil {
 		klog.Fatalf("error initialising userdata plugins: %v", err)
 	}
 
-	s := admission.New(admissionListenAddress, client, um)
+	var machineDefaults *providerconfig.MachineDefaults
+	if machineDefaultsPath != "" {
+		machineDefaults, err = providerconfig.LoadMachineDefaults(machineDefaultsPath)
+		if err != nil {
+			klog.Fatalf("failed to load machine defaults: %v", err)
+		}
+	}
+
+	s := admission.New(admissionListenAddress, client, um, k0sReleaseURL, machineDefaults, requireCredentialRefs, validationTimeout, kubeClient.Discovery(), versionSkewPolicy)
 	if err := s.ListenAndServeTLS(admissionTLSCertPath, admissionTLSKeyPath); err != nil {
 		klog.Fatalf("Failed to start server: %v", err)
 	}
@@ -0,0 +1,87 @@
+#!/usr/bin/env bash
+
+# Copyright 2020 The Machine Controller Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Runs TestProviderMatrixE2E with the machine-controller and its webhook
+# deployed to a local kind cluster. kind acts as management cluster, the
+# nodes join the cluster of E2E_TARGET_KUBECONFIG, which must be reachable
+# by the instances of the providers.
+#
+# Providers only run when their credentials from the matrix are set, see
+# test/e2e/provisioning/testdata/provider-matrix.yaml.
+
+set -euo pipefail
+
+cd "$(dirname "$0")/.."
+
+KIND_CLUSTER_NAME="${KIND_CLUSTER_NAME:-machine-controller-e2e}"
+E2E_IMAGE="${E2E_IMAGE:-unixfox/machine-controller-k0s:e2e}"
+E2E_PROVIDER_MATRIX="${E2E_PROVIDER_MATRIX:-./testdata/provider-matrix.yaml}"
+E2E_PROVIDERS="${E2E_PROVIDERS:-}"
+E2E_IDENTIFIER="${E2E_IDENTIFIER:-${USER:-kind}}"
+
+if [[ -z "${E2E_TARGET_KUBECONFIG:-}" ]]; then
+  echo "E2E_TARGET_KUBECONFIG must be set to the kubeconfig of the cluster the nodes join"
+  exit 1
+fi
+E2E_TARGET_KUBECONFIG="$(realpath "${E2E_TARGET_KUBECONFIG}")"
+
+KIND_KUBECONFIG="$(mktemp)"
+function cleanup {
+  set +e
+  if [[ -z "${E2E_KEEP_CLUSTER:-}" ]]; then
+    kind delete cluster --name "${KIND_CLUSTER_NAME}"
+  fi
+  rm -f "${KIND_KUBECONFIG}"
+}
+trap cleanup EXIT
+
+if ! kind get clusters | grep -qx "${KIND_CLUSTER_NAME}"; then
+  kind create cluster --name "${KIND_CLUSTER_NAME}"
+fi
+kind get kubeconfig --name "${KIND_CLUSTER_NAME}" > "${KIND_KUBECONFIG}"
+export KUBECONFIG="${KIND_KUBECONFIG}"
+
+echo "Building and loading ${E2E_IMAGE}"
+make docker-image IMAGE_NAME="${E2E_IMAGE}"
+kind load docker-image "${E2E_IMAGE}" --name "${KIND_CLUSTER_NAME}"
+
+echo "Deploying the machine-controller"
+make examples/admission-cert.pem
+cat examples/machine-controller.yaml \
+  | sed "s/__admission_ca_cert__/$(base64 -w0 < examples/ca-cert.pem)/g" \
+  | sed "s/__admission_cert__/$(base64 -w0 < examples/admission-cert.pem)/g" \
+  | sed "s/__admission_key__/$(base64 -w0 < examples/admission-key.pem)/g" \
+  | sed "s#image: unixfox/machine-controller-k0s:latest#image: ${E2E_IMAGE}#g" \
+  | kubectl apply -f -
+
+kubectl -n kube-system create secret generic machine-controller-target-kubeconfig \
+  --from-file=kubeconfig="${E2E_TARGET_KUBECONFIG}" \
+  --dry-run -o yaml | kubectl apply -f -
+kubectl -n kube-system patch deployment machine-controller --type=json -p '[
+  {"op": "add", "path": "/spec/template/spec/volumes", "value": [{"name": "target-kubeconfig", "secret": {"secretName": "machine-controller-target-kubeconfig"}}]},
+  {"op": "add", "path": "/spec/template/spec/containers/0/volumeMounts", "value": [{"name": "target-kubeconfig", "mountPath": "/etc/target-kubeconfig", "readOnly": true}]},
+  {"op": "add", "path": "/spec/template/spec/containers/0/command/-", "value": "-target-kubeconfig=/etc/target-kubeconfig/kubeconfig"}
+]'
+kubectl -n kube-system rollout status deployment/machine-controller --timeout=5m
+kubectl -n kube-system rollout status deployment/machine-controller-webhook --timeout=5m
+
+echo "Running the provider matrix"
+go test -tags=e2e -v -timeout 60m -parallel 10 ./test/e2e/provisioning \
+  -run TestProviderMatrixE2E \
+  -provider-matrix "${E2E_PROVIDER_MATRIX}" \
+  -providers "${E2E_PROVIDERS}" \
+  -target-kubeconfig "${E2E_TARGET_KUBECONFIG}" \
+  -identifier "${E2E_IDENTIFIER}"
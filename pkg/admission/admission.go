@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/mattbaird/jsonpatch"
@@ -31,9 +32,14 @@ import (
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
 	"k8s.io/klog"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 	userdatamanager "github.com/kubermatic/machine-controller/pkg/userdata/manager"
 )
 
@@ -41,19 +47,39 @@ type admissionData struct {
 	ctx             context.Context
 	client          ctrlruntimeclient.Client
 	userDataManager *userdatamanager.Manager
+	k0sReleaseURL   string
+	machineDefaults *providerconfig.MachineDefaults
+	// requireCredentialRefs rejects credentials set inline in the cloud provider spec
+	requireCredentialRefs bool
+	// validationTimeout bounds the validations talking to remote APIs, 0 disables the deadline
+	validationTimeout time.Duration
+	// serverVersion is queried for the version of the kube-apiserver new machines must be within the skew of,
+	// nil disables the check
+	serverVersion     discovery.ServerVersionInterface
+	versionSkewPolicy string
 }
 
 var jsonPatch = admissionv1beta1.PatchTypeJSONPatch
 
-func New(listenAddress string, client ctrlruntimeclient.Client, um *userdatamanager.Manager) *http.Server {
+func New(listenAddress string, client ctrlruntimeclient.Client, um *userdatamanager.Manager, k0sReleaseURL string, machineDefaults *providerconfig.MachineDefaults, requireCredentialRefs bool, validationTimeout time.Duration, serverVersion discovery.ServerVersionInterface, versionSkewPolicy string) *http.Server {
 	m := http.NewServeMux()
 	ad := &admissionData{
+		ctx:             context.Background(),
 		client:          client,
 		userDataManager: um,
+		k0sReleaseURL:   k0sReleaseURL,
+		machineDefaults: machineDefaults,
+
+		requireCredentialRefs: requireCredentialRefs,
+		validationTimeout:     validationTimeout,
+		serverVersion:         serverVersion,
+		versionSkewPolicy:     versionSkewPolicy,
 	}
 	m.HandleFunc("/machinedeployments", handleFuncFactory(ad.mutateMachineDeployments))
+	m.HandleFunc("/machinesets", handleFuncFactory(ad.mutateMachineSets))
 	m.HandleFunc("/machines", handleFuncFactory(ad.mutateMachines))
 	m.HandleFunc("/healthz", healthZHandler)
+	m.HandleFunc("/schemas/", schemaHandler)
 
 	return &http.Server{
 		Addr:    listenAddress,
@@ -65,6 +91,20 @@ func healthZHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// schemaHandler serves the JSON schema of the provider spec of the cloud provider in /schemas/<provider>
+func schemaHandler(w http.ResponseWriter, r *http.Request) {
+	provider := providerconfigtypes.CloudProvider(strings.TrimPrefix(r.URL.Path, "/schemas/"))
+	schema, err := cloudprovider.ProviderSpecSchema(provider)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("no schema for cloud provider %q", provider), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	if err := json.NewEncoder(w).Encode(schema); err != nil {
+		klog.Errorf("failed to write the schema of cloud provider %s: %v", provider, err)
+	}
+}
+
 func newJSONPatch(original, current runtime.Object) ([]jsonpatch.JsonPatchOperation, error) {
 	originalGVK := original.GetObjectKind().GroupVersionKind()
 	currentGVK := current.GetObjectKind().GroupVersionKind()
@@ -75,12 +115,12 @@ func newJSONPatch(original, current runtime.Object) ([]jsonpatch.JsonPatchOperat
 	if err != nil {
 		return nil, err
 	}
-	klog.V(6).Infof("jsonpatch: Marshaled original: %s", string(ori))
+	klog.V(6).Infof("jsonpatch: Marshaled original: %s", redactedJSON(ori, original))
 	cur, err := json.Marshal(current)
 	if err != nil {
 		return nil, err
 	}
-	klog.V(6).Infof("jsonpatch: Marshaled target: %s", string(cur))
+	klog.V(6).Infof("jsonpatch: Marshaled target: %s", redactedJSON(cur, current))
 	return jsonpatch.CreatePatch(ori, cur)
 }
 
@@ -97,7 +137,7 @@ func createAdmissionResponse(original, mutated runtime.Object) (*admissionv1beta
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal json patch: %v", err)
 		}
-		klog.V(3).Infof("Produced jsonpatch: %s", string(patchRaw))
+		klog.V(3).Infof("Produced jsonpatch: %s", redactedJSON(patchRaw, mutated))
 
 		response.Patch = patchRaw
 		response.PatchType = &jsonPatch
@@ -105,6 +145,22 @@ func createAdmissionResponse(original, mutated runtime.Object) (*admissionv1beta
 	return response, nil
 }
 
+// redactedJSON returns the given JSON for logging, with the credentials of the provider spec of the
+// given object replaced. Credentials can also show up outside of the provider spec, e.g. in the
+// last-applied-configuration annotation or in patches.
+func redactedJSON(raw []byte, obj runtime.Object) string {
+	var providerSpec *runtime.RawExtension
+	switch o := obj.(type) {
+	case *clusterv1alpha1.Machine:
+		providerSpec = o.Spec.ProviderSpec.Value
+	case *clusterv1alpha1.MachineSet:
+		providerSpec = o.Spec.Template.Spec.ProviderSpec.Value
+	case *clusterv1alpha1.MachineDeployment:
+		providerSpec = o.Spec.Template.Spec.ProviderSpec.Value
+	}
+	return providerconfig.RedactMessage(string(providerconfig.RedactJSON(raw)), providerSpec)
+}
+
 type mutator func(admissionv1beta1.AdmissionReview) (*admissionv1beta1.AdmissionResponse, error)
 
 func handleFuncFactory(mutate mutator) func(http.ResponseWriter, *http.Request) {
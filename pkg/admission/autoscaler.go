@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// AutoscalerMinSizeAnnotation is the least number of replicas the cluster-autoscaler scales a
+	// MachineSet or MachineDeployment down to.
+	AutoscalerMinSizeAnnotation = "cluster.k8s.io/cluster-api-autoscaler-node-group-min-size"
+	// AutoscalerMaxSizeAnnotation is the most replicas the cluster-autoscaler scales a MachineSet or
+	// MachineDeployment up to.
+	AutoscalerMaxSizeAnnotation = "cluster.k8s.io/cluster-api-autoscaler-node-group-max-size"
+)
+
+// validateAutoscalerAnnotations verifies the node group size annotations of the cluster-autoscaler. It
+// ignores node groups with only one of them or invalid ones, so they would silently not be scaled.
+func validateAutoscalerAnnotations(annotations map[string]string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	minValue, hasMin := annotations[AutoscalerMinSizeAnnotation]
+	maxValue, hasMax := annotations[AutoscalerMaxSizeAnnotation]
+	if !hasMin && !hasMax {
+		return allErrs
+	}
+	if !hasMin || !hasMax {
+		return append(allErrs, field.Invalid(fldPath, annotations,
+			fmt.Sprintf("%s and %s must be set together", AutoscalerMinSizeAnnotation, AutoscalerMaxSizeAnnotation)))
+	}
+
+	minSize, err := strconv.Atoi(minValue)
+	if err != nil || minSize < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Key(AutoscalerMinSizeAnnotation), minValue, "must be a non-negative integer"))
+	}
+	maxSize, err := strconv.Atoi(maxValue)
+	if err != nil || maxSize < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Key(AutoscalerMaxSizeAnnotation), maxValue, "must be a non-negative integer"))
+	}
+	if len(allErrs) == 0 && minSize > maxSize {
+		allErrs = append(allErrs, field.Invalid(fldPath.Key(AutoscalerMaxSizeAnnotation), maxValue,
+			fmt.Sprintf("must not be less than the min size %d", minSize)))
+	}
+	return allErrs
+}
@@ -24,6 +24,7 @@ import (
 
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 func (ad *admissionData) mutateMachineDeployments(ar admissionv1beta1.AdmissionReview) (*admissionv1beta1.AdmissionResponse, error) {
@@ -39,6 +40,14 @@ func (ad *admissionData) mutateMachineDeployments(ar admissionv1beta1.AdmissionR
 		return nil, fmt.Errorf("validation failed: %v", errs)
 	}
 
+	// The class is applied on every admission, so updating the object is enough to take over
+	// changes of the class
+	if !machineClassAppliedByOwner(&machineDeployment.ObjectMeta) {
+		if err := ad.applyMachineClass(&machineDeployment.Spec.Template.ObjectMeta, &machineDeployment.Spec.Template.Spec); err != nil {
+			return nil, err
+		}
+	}
+
 	// Do not validate the spec if it hasn't changed
 	machineSpecNeedsValidation := true
 	if ar.Request.Operation == admissionv1beta1.Update {
@@ -52,7 +61,7 @@ func (ad *admissionData) mutateMachineDeployments(ar admissionv1beta1.AdmissionR
 	}
 
 	if machineSpecNeedsValidation {
-		if err := ad.defaultAndValidateMachineSpec(&machineDeployment.Spec.Template.Spec); err != nil {
+		if err := ad.defaultAndValidateMachineSpec(machineDeployment.Namespace, &machineDeployment.Spec.Template.Spec, field.NewPath("spec", "template", "spec")); err != nil {
 			return nil, err
 		}
 	}
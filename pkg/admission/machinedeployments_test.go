@@ -22,6 +22,7 @@ import (
 	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 func TestMachineDeploymentDefaulting(t *testing.T) {
@@ -63,3 +64,42 @@ func TestMachineDeploymentDefaulting(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateAutoscalerAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		isValid     bool
+	}{
+		{
+			name:    "no annotations",
+			isValid: true,
+		},
+		{
+			name:        "min and max size",
+			annotations: map[string]string{AutoscalerMinSizeAnnotation: "1", AutoscalerMaxSizeAnnotation: "10"},
+			isValid:     true,
+		},
+		{
+			name:        "only max size",
+			annotations: map[string]string{AutoscalerMaxSizeAnnotation: "10"},
+		},
+		{
+			name:        "invalid min size",
+			annotations: map[string]string{AutoscalerMinSizeAnnotation: "-1", AutoscalerMaxSizeAnnotation: "10"},
+		},
+		{
+			name:        "max size below min size",
+			annotations: map[string]string{AutoscalerMinSizeAnnotation: "5", AutoscalerMaxSizeAnnotation: "3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs := validateAutoscalerAnnotations(test.annotations, field.NewPath("metadata", "annotations"))
+			if test.isValid != (len(errs) == 0) {
+				t.Errorf("Expected annotations to be valid: %t but got %d errors: %v", test.isValid, len(errs), errs)
+			}
+		})
+	}
+}
@@ -31,6 +31,8 @@ import (
 func validateMachineDeployment(md v1alpha1.MachineDeployment) field.ErrorList {
 	allErrs := field.ErrorList{}
 	allErrs = append(allErrs, validateMachineDeploymentSpec(&md.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, validateAutoscalerAnnotations(md.Annotations, field.NewPath("metadata", "annotations"))...)
+	allErrs = append(allErrs, validatePlacementAnnotations(md.Annotations, field.NewPath("metadata", "annotations"))...)
 	return allErrs
 }
 
@@ -17,19 +17,49 @@ limitations under the License.
 package admission
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/Masterminds/semver"
 	"golang.org/x/crypto/ssh"
 
 	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/userdata/addons"
+	"github.com/kubermatic/machine-controller/pkg/userdata/flatcar"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+	userdatamanager "github.com/kubermatic/machine-controller/pkg/userdata/manager"
+	"github.com/kubermatic/machine-controller/pkg/userdata/profile"
 
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog"
+	kyaml "sigs.k8s.io/yaml"
 )
 
 // BypassSpecNoModificationRequirementAnnotation is used to bypass the "no machine.spec modification" allowed
@@ -47,10 +77,10 @@ func (ad *admissionData) mutateMachines(ar admissionv1beta1.AdmissionReview) (*a
 	klog.V(3).Infof("Defaulting and validating machine %s/%s", machine.Namespace, machine.Name)
 
 	// Mutating .Spec is never allowed
-	// Only hidden exception: the machine-controller may set the .Spec.Name to .Metadata.Name
+	// Only hidden exceptions: the machine-controller may set the .Spec.Name to .Metadata.Name
 	// because otherwise it can never add the delete finalizer as it internally defaults the Name
 	// as well, since on the CREATE request for machines, there is only Metadata.GenerateName set
-	// so we can't default it initially
+	// so we can't default it initially. It may also set the .Spec.ProviderID once the node joined
 	if ar.Request.Operation == admissionv1beta1.Update {
 		oldMachine := clusterv1alpha1.Machine{}
 		if err := json.Unmarshal(ar.Request.OldObject.Raw, &oldMachine); err != nil {
@@ -59,12 +89,34 @@ func (ad *admissionData) mutateMachines(ar admissionv1beta1.AdmissionReview) (*a
 		if oldMachine.Spec.Name != machine.Spec.Name && machine.Spec.Name == machine.Name {
 			oldMachine.Spec.Name = machine.Spec.Name
 		}
+		if oldMachine.Spec.ProviderID == nil {
+			oldMachine.Spec.ProviderID = machine.Spec.ProviderID
+		}
 		// Allow mutation when:
 		// * machine has the `MigrationBypassSpecNoModificationRequirementAnnotation` annotation (used for type migration)
+		// * only the providerSpec changed and the update strategy of the machine applies changes
 		bypassValidationForMigration := machine.Annotations[BypassSpecNoModificationRequirementAnnotation] == "true"
 		if !bypassValidationForMigration {
 			if equal := apiequality.Semantic.DeepEqual(machine.Spec, oldMachine.Spec); !equal {
-				return nil, fmt.Errorf("machine.spec is immutable")
+				updatable, err := providerSpecIsUpdatable(oldMachine.Spec, machine.Spec)
+				if err != nil {
+					return nil, err
+				}
+				if !updatable {
+					return nil, fmt.Errorf("machine.spec is immutable, set providerSpec.updateStrategy to %s or %s to allow changes of the providerSpec",
+						providerconfigtypes.UpdateStrategyRecreate, providerconfigtypes.UpdateStrategyInPlace)
+				}
+				if !machineClassAppliedByOwner(&machine.ObjectMeta) {
+					if err := ad.applyMachineClass(&machine.ObjectMeta, &machine.Spec); err != nil {
+						return nil, err
+					}
+				}
+				if err := ad.defaultAndValidateMachineSpec(machine.Namespace, &machine.Spec, field.NewPath("spec")); err != nil {
+					return nil, err
+				}
+				if err := ad.validateInPlaceUpdate(oldMachine.Spec, machine.Spec, field.NewPath("spec")); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
@@ -77,9 +129,14 @@ func (ad *admissionData) mutateMachines(ar admissionv1beta1.AdmissionReview) (*a
 	}
 
 	// Default and verify .Spec on CREATE only, its expensive and not required to do it on UPDATE
-	// as we disallow .Spec changes anyways
+	// as changes of the .Spec are validated above
 	if ar.Request.Operation == admissionv1beta1.Create {
-		if err := ad.defaultAndValidateMachineSpec(&machine.Spec); err != nil {
+		if !machineClassAppliedByOwner(&machine.ObjectMeta) {
+			if err := ad.applyMachineClass(&machine.ObjectMeta, &machine.Spec); err != nil {
+				return nil, err
+			}
+		}
+		if err := ad.defaultAndValidateMachineSpec(machine.Namespace, &machine.Spec, field.NewPath("spec")); err != nil {
 			return nil, err
 		}
 	}
@@ -87,52 +144,1080 @@ func (ad *admissionData) mutateMachines(ar admissionv1beta1.AdmissionReview) (*a
 	return createAdmissionResponse(machineOriginal, &machine)
 }
 
-func (ad *admissionData) defaultAndValidateMachineSpec(spec *clusterv1alpha1.MachineSpec) error {
+func (ad *admissionData) defaultAndValidateMachineSpec(namespace string, spec *clusterv1alpha1.MachineSpec, fldPath *field.Path) error {
+	if err := ad.machineDefaults.Apply(spec); err != nil {
+		return fmt.Errorf("failed to apply machine defaults: %v", err)
+	}
+
 	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
 	if err != nil {
 		return fmt.Errorf("failed to read machine.spec.providerSpec: %v", err)
 	}
+
+	if providerConfig.OperatingSystemProfile != "" {
+		if err := ad.applyOperatingSystemProfile(namespace, spec, providerConfig); err != nil {
+			return err
+		}
+	}
 	skg := providerconfig.NewConfigVarResolver(ad.ctx, ad.client)
 	prov, err := cloudprovider.ForProvider(providerConfig.CloudProvider, skg)
 	if err != nil {
 		return fmt.Errorf("failed to get cloud provider %q: %v", providerConfig.CloudProvider, err)
 	}
 
-	// Verify operating system.
-	if _, err := ad.userDataManager.ForOS(providerConfig.OperatingSystem); err != nil {
-		return fmt.Errorf("failed to get OS '%s': %v", providerConfig.OperatingSystem, err)
+	providerSpecPath := fldPath.Child("providerSpec", "value")
+	allErrs := field.ErrorList{}
+
+	if ad.requireCredentialRefs {
+		allErrs = append(allErrs, validateCredentialRefs(providerConfig.CloudProviderSpec, providerSpecPath.Child("cloudProviderSpec"))...)
+	}
+	if err := skg.ValidateCredentialProfile(providerConfig.CredentialProfile, namespace); err != nil {
+		allErrs = append(allErrs, field.Forbidden(providerSpecPath.Child("credentialProfile"), err.Error()))
+	}
+
+	// Verify operating system and bootstrap flavor.
+	if _, err := ad.userDataManager.ForOS(providerConfig.OperatingSystem, providerConfig.BootstrapFlavor); err != nil {
+		if providerConfig.BootstrapFlavor != "" {
+			allErrs = append(allErrs, field.Invalid(providerSpecPath.Child("bootstrapFlavor"), providerConfig.BootstrapFlavor, err.Error()))
+		} else {
+			allErrs = append(allErrs, field.Invalid(providerSpecPath.Child("operatingSystem"), providerConfig.OperatingSystem, err.Error()))
+		}
 	}
 
 	// Check kubelet version
 	if spec.Versions.Kubelet == "" {
-		return fmt.Errorf("Kubelet version must be set")
+		allErrs = append(allErrs, field.Required(fldPath.Child("versions", "kubelet"), "kubelet version must be set"))
+	}
+
+	// Validate CA bundle
+	if providerConfig.CABundle != nil {
+		caBundlePath := providerSpecPath.Child("caBundle")
+		if providerConfig.OperatingSystem != providerconfigtypes.OperatingSystemUbuntu && providerConfig.OperatingSystemProfile == "" {
+			allErrs = append(allErrs, field.Forbidden(caBundlePath, fmt.Sprintf("caBundle is only supported on %s", providerconfigtypes.OperatingSystemUbuntu)))
+		} else {
+			caBundle, err := skg.GetConfigVarStringValue(*providerConfig.CABundle)
+			if err != nil {
+				return fmt.Errorf("failed to get the value of \"caBundle\" field: %v", err)
+			}
+			if err := validateCABundle(caBundle); err != nil {
+				allErrs = append(allErrs, field.Invalid(caBundlePath, omittedValue, err.Error()))
+			}
+		}
 	}
 
-	// Validate SSH keys
-	if err := validatePublicKeys(providerConfig.SSHPublicKeys); err != nil {
-		return fmt.Errorf("Invalid public keys specified: %v", err)
+	allErrs = append(allErrs, ad.validateK0sSettings(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validateNodeRole(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validateProxySettings(providerConfig.Proxy, providerSpecPath.Child("proxy"))...)
+	allErrs = append(allErrs, validateKubeletSettings(providerConfig.Kubelet, providerSpecPath.Child("kubelet"))...)
+	allErrs = append(allErrs, validateHardening(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validateSwap(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validatePreJoinChecks(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validateSSH(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validateNodeNetwork(providerConfig.NodeNetwork, providerSpecPath.Child("nodeNetwork"))...)
+	allErrs = append(allErrs, validateNetwork(providerConfig.Network, providerSpecPath.Child("network"))...)
+	allErrs = append(allErrs, validateInstanceRequirements(providerConfig.InstanceRequirements, providerSpecPath.Child("instanceRequirements"))...)
+	allErrs = append(allErrs, validateUpdatePolicy(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validateUpdateStrategy(providerConfig.UpdateStrategy, providerSpecPath.Child("updateStrategy"))...)
+	allErrs = append(allErrs, validateKernel(providerConfig.Kernel, providerSpecPath.Child("kernel"))...)
+	allErrs = append(allErrs, validateGPU(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validateAddOns(providerConfig, providerSpecPath.Child("addOns"))...)
+	allErrs = append(allErrs, validateFiles(providerConfig.Files, providerSpecPath.Child("files"))...)
+	allErrs = append(allErrs, validateSystemdUnits(providerConfig.SystemdUnits, providerSpecPath.Child("systemdUnits"))...)
+	allErrs = append(allErrs, validateStaticPods(providerConfig.StaticPods, providerSpecPath.Child("staticPods"))...)
+	allErrs = append(allErrs, validateFetchUserDataOnBoot(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validateWindows(providerConfig, providerSpecPath)...)
+	allErrs = append(allErrs, validatePublicKeys(providerConfig.SSHPublicKeys, providerSpecPath.Child("sshPublicKeys"))...)
+
+	// The cloud provider validation talks to the provider API, so it's only done for otherwise valid specs
+	if len(allErrs) > 0 {
+		return allErrs.ToAggregate()
 	}
 
-	defaultedSpec, err := prov.AddDefaults(*spec)
+	// The validations talking to remote APIs are independent of each other, so they run concurrently.
+	// Errors of the cloud provider may echo the credentials it resolved.
+	var defaultedSpec clusterv1alpha1.MachineSpec
+	err = ad.validateConcurrently(
+		func(ctx context.Context) error {
+			return ad.validateK0sVersion(ctx, providerConfig, providerSpecPath)
+		},
+		func(_ context.Context) error {
+			return ad.validateVersionSkew(*spec, providerConfig, fldPath)
+		},
+		func(_ context.Context) error {
+			resolved, err := resolveInstanceType(prov, *spec, providerConfig.InstanceRequirements, providerSpecPath)
+			if err != nil {
+				return errors.New(providerconfig.RedactMessage(err.Error(), spec.ProviderSpec.Value, skg.ResolvedSecrets()...))
+			}
+			defaulted, err := prov.AddDefaults(resolved)
+			if err != nil {
+				return errors.New(providerconfig.RedactMessage(fmt.Sprintf("failed to default machineSpec: %v", err), spec.ProviderSpec.Value, skg.ResolvedSecrets()...))
+			}
+			if err := prov.Validate(defaulted); err != nil {
+				return errors.New(providerconfig.RedactMessage(providerValidationError(err, providerSpecPath).Error(), defaulted.ProviderSpec.Value, skg.ResolvedSecrets()...))
+			}
+			defaultedSpec = defaulted
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+	*spec = defaultedSpec
+
+	return nil
+}
+
+// resolveInstanceType lets the cloud provider pick the cheapest instance type meeting the instanceRequirements,
+// the picked type is written to the cloudProviderSpec, so all machines of a MachineSet get the same one
+func resolveInstanceType(prov cloudprovidertypes.Provider, spec clusterv1alpha1.MachineSpec, requirements *providerconfigtypes.InstanceRequirements, providerSpecPath *field.Path) (clusterv1alpha1.MachineSpec, error) {
+	if requirements == nil {
+		return spec, nil
+	}
+	resolver, ok := prov.(cloudprovidertypes.InstanceTypeResolver)
+	if !ok {
+		return spec, field.Forbidden(providerSpecPath.Child("instanceRequirements"), "the cloud provider can't pick instance types")
+	}
+	resolved, instanceType, err := resolver.ResolveInstanceType(spec)
+	if err == cloudprovidererrors.ErrInstanceTypeResolutionNotSupported {
+		return spec, field.Forbidden(providerSpecPath.Child("instanceRequirements"), "the cloud provider can't pick instance types")
+	}
 	if err != nil {
-		return fmt.Errorf("failed to default machineSpec: %v", err)
+		return spec, fmt.Errorf("failed to pick instance type: %v", err)
+	}
+	klog.V(4).Infof("Picked instance type %s for %d CPUs and %d MiB of memory", instanceType, requirements.CPUs, requirements.MemoryMB)
+	return resolved, nil
+}
+
+// remoteValidation is a validation talking to a remote API, e.g. the one of the cloud provider or the
+// k0s release endpoint. It should give up once the given context is done.
+type remoteValidation func(ctx context.Context) error
+
+type remoteValidationResult struct {
+	index int
+	err   error
+}
+
+// validateConcurrently runs the given validations in parallel and returns their aggregated errors in
+// the order of the validations. The API server gives up on the webhook after its timeout, so
+// validations which did not finish within the validation timeout are reported as failed instead of
+// waited for. Their results are discarded.
+func (ad *admissionData) validateConcurrently(validations ...remoteValidation) error {
+	ctx := ad.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ad.validationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ad.validationTimeout)
+		defer cancel()
+	}
+
+	// The channel is buffered, so validations which finish after the deadline don't block
+	results := make(chan remoteValidationResult, len(validations))
+	for i, validation := range validations {
+		go func(index int, validation remoteValidation) {
+			results <- remoteValidationResult{index: index, err: validation(ctx)}
+		}(i, validation)
+	}
+
+	errs := make([]error, len(validations))
+	for pending := len(validations); pending > 0; pending-- {
+		select {
+		case result := <-results:
+			errs[result.index] = result.err
+		case <-ctx.Done():
+			return fmt.Errorf("validation did not finish within %v, the cloud provider or the k0s release endpoint may be slow to respond", ad.validationTimeout)
+		}
 	}
-	spec = &defaultedSpec
+	return utilerrors.NewAggregate(errs)
+}
 
-	if err := prov.Validate(*spec); err != nil {
+// providerValidationError returns the given error of a cloud provider validation. Field errors
+// are relative to the provider config, so their path gets prefixed with the given one.
+func providerValidationError(err error, providerSpecPath *field.Path) error {
+	if aggregate, ok := err.(utilerrors.Aggregate); ok {
+		var errs []error
+		for _, err := range aggregate.Errors() {
+			errs = append(errs, prefixFieldError(err, providerSpecPath))
+		}
+		return utilerrors.NewAggregate(errs)
+	}
+	if _, ok := err.(*field.Error); !ok {
 		return fmt.Errorf("validation failed: %v", err)
 	}
+	return prefixFieldError(err, providerSpecPath)
+}
+
+// prefixFieldError prefixes the path of the given field error, other errors are returned as they are
+func prefixFieldError(err error, providerSpecPath *field.Path) error {
+	fieldErr, ok := err.(*field.Error)
+	if !ok {
+		return err
+	}
+	// The error may be cached by the provider, so it must not be modified
+	prefixed := *fieldErr
+	prefixed.Field = providerSpecPath.String() + "." + fieldErr.Field
+	return &prefixed
+}
+
+// applyMachineClass merges the provider spec of the MachineClass referenced by the given spec into
+// it. Fields set in the spec take precedence, objects are merged. The merged class spec is recorded
+// in the MachineClassSpecAnnotation of the given metadata. Fields still equal to the recorded spec
+// are taken from the current class instead, so changes of the class reach the spec whenever it is
+// admitted again.
+func (ad *admissionData) applyMachineClass(meta *metav1.ObjectMeta, spec *clusterv1alpha1.MachineSpec) error {
+	if spec.ProviderSpec.ValueFrom == nil || spec.ProviderSpec.ValueFrom.MachineClass == nil {
+		// Fields taken from a class which isn't referenced anymore become the ones of the object
+		delete(meta.Annotations, providerconfig.MachineClassSpecAnnotation)
+		return nil
+	}
+	ref := spec.ProviderSpec.ValueFrom.MachineClass
+	if ref.ObjectReference == nil || ref.Name == "" {
+		return errors.New("machine.spec.providerSpec.valueFrom.machineClass.name must be set")
+	}
+
+	// MachineClasses are cluster-scoped
+	machineClass := &clusterv1alpha1.MachineClass{}
+	if err := ad.client.Get(ad.ctx, types.NamespacedName{Name: ref.Name}, machineClass); err != nil {
+		return fmt.Errorf("failed to get machine class %q: %v", ref.Name, err)
+	}
+	classSpecAnnotation, err := providerconfig.MachineClassSpec(machineClass)
+	if err != nil {
+		return err
+	}
+	classSpec := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(classSpecAnnotation), &classSpec); err != nil {
+		return fmt.Errorf("failed to unmarshal the providerSpec of machine class %q: %v", ref.Name, err)
+	}
+
+	providerSpec := map[string]interface{}{}
+	if spec.ProviderSpec.Value != nil && len(spec.ProviderSpec.Value.Raw) > 0 {
+		if err := json.Unmarshal(spec.ProviderSpec.Value.Raw, &providerSpec); err != nil {
+			return fmt.Errorf("failed to unmarshal machine.spec.providerSpec: %v", err)
+		}
+	}
+	if previous, ok := meta.Annotations[providerconfig.MachineClassSpecAnnotation]; ok {
+		previousClassSpec := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(previous), &previousClassSpec); err != nil {
+			return fmt.Errorf("failed to unmarshal the %s annotation: %v", providerconfig.MachineClassSpecAnnotation, err)
+		}
+		providerconfig.StripDefaults(providerSpec, previousClassSpec)
+	}
+	providerconfig.MergeDefaults(providerSpec, classSpec)
+	if ref.Provider != "" && providerSpec["cloudProvider"] != ref.Provider {
+		return fmt.Errorf("machine class %q is intended for cloud provider %q, but the machine uses %v", ref.Name, ref.Provider, providerSpec["cloudProvider"])
+	}
+
+	raw, err := json.Marshal(providerSpec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal machine.spec.providerSpec: %v", err)
+	}
+	spec.ProviderSpec.Value = &runtime.RawExtension{Raw: raw}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[providerconfig.MachineClassSpecAnnotation] = classSpecAnnotation
+	return nil
+}
+
+// machineClassAppliedByOwner returns whether the given object is controlled by a MachineSet or a
+// MachineDeployment. Their template already got the MachineClass applied, applying it again to a
+// newer version of the class would make the object differ from the template.
+func machineClassAppliedByOwner(meta *metav1.ObjectMeta) bool {
+	owner := metav1.GetControllerOf(meta)
+	return owner != nil && (owner.Kind == "MachineSet" || owner.Kind == "MachineDeployment")
+}
+
+// applyOperatingSystemProfile validates the OperatingSystemProfile referenced by the given
+// provider config and defaults the operating system and the image of the spec from it.
+func (ad *admissionData) applyOperatingSystemProfile(namespace string, spec *clusterv1alpha1.MachineSpec, providerConfig *providerconfigtypes.Config) error {
+	osp := &clusterv1alpha1.OperatingSystemProfile{}
+	if err := ad.client.Get(ad.ctx, types.NamespacedName{Namespace: namespace, Name: providerConfig.OperatingSystemProfile}, osp); err != nil {
+		return fmt.Errorf("failed to get operating system profile %q: %v", providerConfig.OperatingSystemProfile, err)
+	}
+	if err := profile.Validate(osp); err != nil {
+		return err
+	}
+	if err := profile.ApplyToConfig(osp, providerConfig); err != nil {
+		return err
+	}
+
+	rawConfig, err := json.Marshal(providerConfig)
+	if err != nil {
+		return fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+	spec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return nil
+}
+
+// omittedValue replaces the value of field errors for multi-line values like certificates and
+// manifests, which would make the error unreadable.
+const omittedValue = "<omitted>"
+
+// validateK0sVersion verifies that the k0s release of the given config can be downloaded. It is
+// run with the other validations talking to remote APIs, once the k0s settings passed.
+func (ad *admissionData) validateK0sVersion(ctx context.Context, providerConfig *providerconfigtypes.Config, fldPath *field.Path) error {
+	if providerConfig.K0sVersion == "" {
+		return nil
+	}
+	if err := userdatahelper.ValidateK0sVersion(ctx, ad.k0sReleaseURL, providerConfig.K0sVersion); err != nil {
+		return field.Invalid(fldPath.Child("k0sVersion"), providerConfig.K0sVersion, err.Error())
+	}
+	return nil
+}
+
+// validateK0sSettings verifies the settings which are only used by the k0s bootstrap flavor.
+func (ad *admissionData) validateK0sSettings(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if providerConfig.K0sVersion == "" && providerConfig.AirgapBundleURL == "" && providerConfig.WorkerProfile == "" &&
+		len(providerConfig.JoinAddresses) == 0 && len(providerConfig.RegistryMirrors) == 0 && len(providerConfig.InsecureRegistries) == 0 &&
+		len(providerConfig.RegistryCredentials) == 0 {
+		return allErrs
+	}
+
+	flavor := providerConfig.BootstrapFlavor
+	if flavor == "" {
+		flavor = userdatamanager.DefaultBootstrapFlavor(providerConfig.OperatingSystem)
+	}
+	if flavor != providerconfigtypes.BootstrapFlavorK0s {
+		return append(allErrs, field.Invalid(fldPath.Child("bootstrapFlavor"), flavor,
+			fmt.Sprintf("k0sVersion, airgapBundleURL, workerProfile, joinAddresses and the registry settings are only supported with the %s bootstrap flavor", providerconfigtypes.BootstrapFlavorK0s)))
+	}
+
+	if providerConfig.WorkerProfile != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(providerConfig.WorkerProfile) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("workerProfile"), providerConfig.WorkerProfile, msg))
+		}
+		// Flags take precedence over the KubeletConfiguration of the profile, so the settings would silently win
+		if kubelet := providerConfig.Kubelet; kubelet != nil && (kubelet.MaxPods != nil || len(kubelet.EvictionHard) > 0 ||
+			len(kubelet.KubeReserved) > 0 || len(kubelet.SystemReserved) > 0 || len(kubelet.FeatureGates) > 0) {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("kubelet"),
+				"maxPods, evictionHard, kubeReserved, systemReserved and featureGates are configured by the workerProfile, only extraArgs can be set with it"))
+		}
+	}
+
+	if providerConfig.AirgapBundleURL != "" {
+		if err := validateHTTPURL(providerConfig.AirgapBundleURL); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("airgapBundleURL"), providerConfig.AirgapBundleURL, err.Error()))
+		}
+	}
+
+	for i, address := range providerConfig.JoinAddresses {
+		if err := validateJoinAddress(address); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("joinAddresses").Index(i), address, err.Error()))
+		}
+	}
+
+	for registry, mirrors := range providerConfig.RegistryMirrors {
+		mirrorsPath := fldPath.Child("registryMirrors").Key(registry)
+		if len(mirrors) == 0 {
+			allErrs = append(allErrs, field.Required(mirrorsPath, "at least one mirror must be set"))
+		}
+		for i, mirror := range mirrors {
+			if err := validateHTTPURL(mirror); err != nil {
+				allErrs = append(allErrs, field.Invalid(mirrorsPath.Index(i), mirror, err.Error()))
+			}
+		}
+	}
+
+	for registry, credentials := range providerConfig.RegistryCredentials {
+		credentialsPath := fldPath.Child("registryCredentials").Key(registry)
+		if credentials.Username == (providerconfigtypes.ConfigVarString{}) {
+			allErrs = append(allErrs, field.Required(credentialsPath.Child("username"), ""))
+		}
+		if credentials.Password == (providerconfigtypes.ConfigVarString{}) {
+			allErrs = append(allErrs, field.Required(credentialsPath.Child("password"), ""))
+		}
+	}
+
+	return allErrs
+}
+
+// validateNodeRole verifies the k0s role of the node and the settings of controllers.
+func validateNodeRole(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	switch providerConfig.Role {
+	case "", providerconfigtypes.NodeRoleWorker, providerconfigtypes.NodeRoleSingle:
+		if providerConfig.Controller != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("controller"), fmt.Sprintf("only supported with the %s role", providerconfigtypes.NodeRoleController)))
+		}
+		if providerConfig.Role != providerconfigtypes.NodeRoleSingle {
+			return allErrs
+		}
+	case providerconfigtypes.NodeRoleController:
+	default:
+		return append(allErrs, field.NotSupported(fldPath.Child("role"), providerConfig.Role,
+			[]string{string(providerconfigtypes.NodeRoleWorker), string(providerconfigtypes.NodeRoleController), string(providerconfigtypes.NodeRoleSingle)}))
+	}
+
+	flavor := providerConfig.BootstrapFlavor
+	if flavor == "" {
+		flavor = userdatamanager.DefaultBootstrapFlavor(providerConfig.OperatingSystem)
+	}
+	if flavor != providerconfigtypes.BootstrapFlavorK0s {
+		return append(allErrs, field.Invalid(fldPath.Child("bootstrapFlavor"), flavor,
+			fmt.Sprintf("the %s role is only supported with the %s bootstrap flavor", providerConfig.Role, providerconfigtypes.BootstrapFlavorK0s)))
+	}
+	// Controllers join through the k0s API of the existing controllers, not the kube-apiserver, single nodes join no cluster
+	if len(providerConfig.JoinAddresses) > 0 {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("joinAddresses"), fmt.Sprintf("not supported with the %s role", providerConfig.Role)))
+	}
+	if providerConfig.Role == providerconfigtypes.NodeRoleSingle {
+		return allErrs
+	}
+
+	// Controllers must run the release of the existing controllers, the default is only meant for workers.
+	// The etcd members of older releases can't be removed through the API when the machine gets deleted.
+	versionPath := fldPath.Child("k0sVersion")
+	if providerConfig.K0sVersion == "" {
+		return append(allErrs, field.Required(versionPath, fmt.Sprintf("the k0s release of the existing controllers must be set for the %s role", providerconfigtypes.NodeRoleController)))
+	}
+	version, err := semver.NewVersion(providerConfig.K0sVersion)
+	if err != nil {
+		return append(allErrs, field.Invalid(versionPath, providerConfig.K0sVersion, err.Error()))
+	}
+	if version.LessThan(semver.MustParse(userdatahelper.K0sControllerMinVersion)) {
+		allErrs = append(allErrs, field.Invalid(versionPath, providerConfig.K0sVersion,
+			fmt.Sprintf("the %s role requires k0s %s or newer", providerconfigtypes.NodeRoleController, userdatahelper.K0sControllerMinVersion)))
+	}
+	return allErrs
+}
+
+func validateCABundle(caBundle string) error {
+	rest := []byte(caBundle)
+	var certs int
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return fmt.Errorf("unexpected PEM block of type %q", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		certs++
+	}
+	if certs == 0 {
+		return errors.New("no PEM encoded certificate found")
+	}
+	return nil
+}
+
+func validateProxySettings(proxy *providerconfigtypes.ProxySettings, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if proxy == nil {
+		return allErrs
+	}
+	if proxy.HTTPProxy == "" && proxy.HTTPSProxy == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("httpProxy"), "httpProxy or httpsProxy must be set"))
+	}
+	if proxy.HTTPProxy != "" {
+		if err := validateHTTPURL(proxy.HTTPProxy); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("httpProxy"), proxy.HTTPProxy, err.Error()))
+		}
+	}
+	if proxy.HTTPSProxy != "" {
+		if err := validateHTTPURL(proxy.HTTPSProxy); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("httpsProxy"), proxy.HTTPSProxy, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+func validateKubeletSettings(kubelet *providerconfigtypes.KubeletSettings, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if kubelet == nil {
+		return allErrs
+	}
+	if kubelet.MaxPods != nil && *kubelet.MaxPods <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxPods"), *kubelet.MaxPods, "must be greater than 0"))
+	}
+	for name, reserved := range map[string]map[string]string{"kubeReserved": kubelet.KubeReserved, "systemReserved": kubelet.SystemReserved} {
+		for res, value := range reserved {
+			if _, err := resource.ParseQuantity(value); err != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child(name).Key(res), value, err.Error()))
+			}
+		}
+	}
+	for signal, value := range kubelet.EvictionHard {
+		if strings.HasSuffix(value, "%") {
+			if _, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64); err != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("evictionHard").Key(signal), value, "is not a percentage"))
+			}
+			continue
+		}
+		if _, err := resource.ParseQuantity(value); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("evictionHard").Key(signal), value, err.Error()))
+		}
+	}
+	for name, value := range kubelet.ExtraArgs {
+		if name == "" || strings.HasPrefix(name, "-") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("extraArgs"), name, "flags must be set without leading dashes"))
+			continue
+		}
+		// Flags get rendered into shell scripts and the k0s --kubelet-extra-args.
+		if strings.ContainsAny(name+value, " \t\n\"\\") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("extraArgs").Key(name), value, "must not contain whitespace, quotes or backslashes"))
+		}
+	}
+	return allErrs
+}
+
+func validateHardening(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if providerConfig.Hardening == "" {
+		return allErrs
+	}
+	if providerConfig.Hardening != providerconfigtypes.HardeningProfileCIS {
+		return append(allErrs, field.NotSupported(fldPath.Child("hardening"), providerConfig.Hardening,
+			[]string{string(providerconfigtypes.HardeningProfileCIS)}))
+	}
+	switch providerConfig.OperatingSystem {
+	case providerconfigtypes.OperatingSystemUbuntu,
+		providerconfigtypes.OperatingSystemCentOS,
+		providerconfigtypes.OperatingSystemRHEL,
+		providerconfigtypes.OperatingSystemRockyLinux,
+		providerconfigtypes.OperatingSystemAlmaLinux:
+		return allErrs
+	}
+	return append(allErrs, field.Forbidden(fldPath.Child("hardening"), fmt.Sprintf("not supported on %s", providerConfig.OperatingSystem)))
+}
+
+func validateInstanceRequirements(requirements *providerconfigtypes.InstanceRequirements, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if requirements == nil {
+		return allErrs
+	}
+	if requirements.CPUs < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("cpus"), requirements.CPUs, "must be at least 1"))
+	}
+	if requirements.MemoryMB < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("memoryMB"), requirements.MemoryMB, "must be at least 1"))
+	}
+	if requirements.GPUs < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("gpus"), requirements.GPUs, "must not be negative"))
+	}
+	return allErrs
+}
+
+func validateSwap(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	swap := providerConfig.Swap
+	if swap == nil {
+		return allErrs
+	}
+	swapPath := fldPath.Child("swap")
+	if _, err := userdatahelper.SwapSizeBytes(swap); err != nil {
+		allErrs = append(allErrs, field.Invalid(swapPath.Child("size"), swap.Size, "must be a quantity greater than 0"))
+	}
+	switch swap.SwapBehavior {
+	case "", "LimitedSwap", "UnlimitedSwap":
+	default:
+		allErrs = append(allErrs, field.NotSupported(swapPath.Child("swapBehavior"), swap.SwapBehavior, []string{"LimitedSwap", "UnlimitedSwap"}))
+	}
+	switch providerConfig.OperatingSystem {
+	case providerconfigtypes.OperatingSystemUbuntu,
+		providerconfigtypes.OperatingSystemCentOS,
+		providerconfigtypes.OperatingSystemRHEL,
+		providerconfigtypes.OperatingSystemRockyLinux,
+		providerconfigtypes.OperatingSystemAlmaLinux,
+		providerconfigtypes.OperatingSystemAmazonLinux2023:
+		return allErrs
+	}
+	return append(allErrs, field.Forbidden(swapPath, fmt.Sprintf("not supported on %s", providerConfig.OperatingSystem)))
+}
+
+var sshUserRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+
+func validateSSH(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	ssh := providerConfig.SSH
+	if ssh == nil {
+		return allErrs
+	}
+	sshPath := fldPath.Child("ssh")
+	if ssh.User != "" {
+		if ssh.User == "root" {
+			allErrs = append(allErrs, field.Invalid(sshPath.Child("user"), ssh.User, "must not be root"))
+		} else if len(ssh.User) > 32 || !sshUserRegexp.MatchString(ssh.User) {
+			allErrs = append(allErrs, field.Invalid(sshPath.Child("user"), ssh.User, "is not a valid username"))
+		}
+	}
+	if ssh.Disabled && ssh.PasswordAuthentication {
+		allErrs = append(allErrs, field.Forbidden(sshPath.Child("passwordAuthentication"), "must not be set if ssh is disabled"))
+	}
+	switch providerConfig.OperatingSystem {
+	case providerconfigtypes.OperatingSystemCoreos,
+		providerconfigtypes.OperatingSystemFlatcar,
+		providerconfigtypes.OperatingSystemFedoraCoreOS,
+		providerconfigtypes.OperatingSystemWindows:
+		allErrs = append(allErrs, field.Forbidden(sshPath, fmt.Sprintf("not supported on %s", providerConfig.OperatingSystem)))
+	}
+	return allErrs
+}
+
+// validatePreJoinChecks verifies the pre-join checks, which are run by the setup of the k0s bootstrap flavor.
+func validatePreJoinChecks(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	checks := providerConfig.PreJoinChecks
+	if checks == nil {
+		return allErrs
+	}
+	checksPath := fldPath.Child("preJoinChecks")
+	if checks.MinFreeDiskMB < 0 {
+		allErrs = append(allErrs, field.Invalid(checksPath.Child("minFreeDiskMB"), checks.MinFreeDiskMB, "must not be negative"))
+	}
+	flavor := providerConfig.BootstrapFlavor
+	if flavor == "" {
+		flavor = userdatamanager.DefaultBootstrapFlavor(providerConfig.OperatingSystem)
+	}
+	if flavor != providerconfigtypes.BootstrapFlavorK0s {
+		allErrs = append(allErrs, field.Forbidden(checksPath, fmt.Sprintf("only supported with the %s bootstrap flavor", providerconfigtypes.BootstrapFlavorK0s)))
+	}
+	return allErrs
+}
+
+func validateUpdatePolicy(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if providerConfig.UpdatePolicy == nil {
+		return allErrs
+	}
+	switch providerConfig.OperatingSystem {
+	case providerconfigtypes.OperatingSystemUbuntu,
+		providerconfigtypes.OperatingSystemCentOS,
+		providerconfigtypes.OperatingSystemRHEL,
+		providerconfigtypes.OperatingSystemRockyLinux,
+		providerconfigtypes.OperatingSystemAlmaLinux,
+		providerconfigtypes.OperatingSystemAmazonLinux2023:
+		return allErrs
+	}
+	return append(allErrs, field.Forbidden(fldPath.Child("updatePolicy"), fmt.Sprintf("not supported on %s", providerConfig.OperatingSystem)))
+}
+
+// providerSpecIsUpdatable returns whether the changes from the old to the new spec only affect the providerSpec
+// and are allowed by the update strategy of the old spec.
+func providerSpecIsUpdatable(oldSpec, newSpec clusterv1alpha1.MachineSpec) (bool, error) {
+	// The spec in effect decides, so the strategy can't be changed together with the spec it should apply to
+	oldConfig, err := providerconfigtypes.GetConfig(oldSpec.ProviderSpec)
+	if err != nil {
+		return false, fmt.Errorf("failed to read machine.spec.providerSpec: %v", err)
+	}
+	oldSpec.ProviderSpec = newSpec.ProviderSpec
+	if !apiequality.Semantic.DeepEqual(oldSpec, newSpec) {
+		return false, nil
+	}
+	switch oldConfig.UpdateStrategy {
+	case providerconfigtypes.UpdateStrategyRecreate, providerconfigtypes.UpdateStrategyInPlace:
+		return true, nil
+	}
+	return false, nil
+}
+
+// validateInPlaceUpdate rejects the changes from the old to the new spec which can't be applied to
+// the existing instance, if the update strategy of the old spec is InPlace. Only changes of the
+// cloudProviderSpec can be applied in place, and only those the cloud provider supports.
+func (ad *admissionData) validateInPlaceUpdate(oldSpec, newSpec clusterv1alpha1.MachineSpec, fldPath *field.Path) error {
+	oldConfig, err := providerconfigtypes.GetConfig(oldSpec.ProviderSpec)
+	if err != nil {
+		return fmt.Errorf("failed to read machine.spec.providerSpec: %v", err)
+	}
+	if oldConfig.UpdateStrategy != providerconfigtypes.UpdateStrategyInPlace {
+		return nil
+	}
+	if newSpec.ProviderSpec.Value == nil {
+		return fmt.Errorf("machine.spec.providerSpec.value is nil")
+	}
+	changed, err := cloudproviderutil.ChangedFields(oldSpec.ProviderSpec.Value.Raw, newSpec.ProviderSpec.Value.Raw)
+	if err != nil {
+		return fmt.Errorf("failed to compare machine.spec.providerSpec: %v", err)
+	}
 
+	providerSpecPath := fldPath.Child("providerSpec", "value")
+	allErrs := field.ErrorList{}
+	cloudProviderSpecChanged := false
+	for _, name := range changed {
+		switch name {
+		case "updateStrategy":
+			// The strategy of the old spec applies, so it can always be changed on its own
+		case "cloudProviderSpec":
+			cloudProviderSpecChanged = true
+		default:
+			allErrs = append(allErrs, field.Forbidden(providerSpecPath.Child(name),
+				fmt.Sprintf("can't be changed with the %s update strategy", providerconfigtypes.UpdateStrategyInPlace)))
+		}
+	}
+	if len(allErrs) > 0 || !cloudProviderSpecChanged {
+		return allErrs.ToAggregate()
+	}
+
+	prov, err := cloudprovider.ForProvider(oldConfig.CloudProvider, providerconfig.NewConfigVarResolver(ad.ctx, ad.client))
+	if err != nil {
+		return fmt.Errorf("failed to get cloud provider %q: %v", oldConfig.CloudProvider, err)
+	}
+	validator, ok := prov.(cloudprovidertypes.UpdateValidator)
+	if !ok {
+		err = cloudprovidererrors.ErrUpdateNotSupported
+	} else {
+		err = validator.ValidateUpdate(oldSpec, newSpec)
+	}
+	if err == cloudprovidererrors.ErrUpdateNotSupported {
+		return field.Forbidden(providerSpecPath.Child("cloudProviderSpec"),
+			fmt.Sprintf("can't be changed in place on %s, use the %s update strategy", oldConfig.CloudProvider, providerconfigtypes.UpdateStrategyRecreate))
+	}
+	if err != nil {
+		return providerValidationError(err, providerSpecPath)
+	}
 	return nil
 }
 
-func validatePublicKeys(keys []string) error {
-	for _, s := range keys {
+func validateUpdateStrategy(strategy providerconfigtypes.UpdateStrategy, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	switch strategy {
+	case "", providerconfigtypes.UpdateStrategyImmutable, providerconfigtypes.UpdateStrategyRecreate, providerconfigtypes.UpdateStrategyInPlace:
+		return allErrs
+	}
+	return append(allErrs, field.NotSupported(fldPath, strategy, []string{
+		string(providerconfigtypes.UpdateStrategyImmutable),
+		string(providerconfigtypes.UpdateStrategyRecreate),
+		string(providerconfigtypes.UpdateStrategyInPlace),
+	}))
+}
+
+var (
+	kernelModuleRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	sysctlNameRegexp   = regexp.MustCompile(`^[a-z0-9_]+([./][a-zA-Z0-9_-]+)+$`)
+)
+
+func validateKernel(kernel *providerconfigtypes.KernelSettings, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if kernel == nil {
+		return allErrs
+	}
+	for i, module := range kernel.Modules {
+		if !kernelModuleRegexp.MatchString(module) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("modules").Index(i), module, "is not a valid kernel module name"))
+		}
+	}
+	for name, value := range kernel.Sysctls {
+		if !sysctlNameRegexp.MatchString(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("sysctls"), name, "is not a valid sysctl name"))
+			continue
+		}
+		if strings.TrimSpace(value) == "" || strings.ContainsAny(value, "\n\r") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("sysctls").Key(name), value, "must be a single line value"))
+		}
+	}
+	return allErrs
+}
+
+var gpuDriverVersionRegexp = regexp.MustCompile(`^[0-9]+$`)
+
+func validateGPU(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	gpu := providerConfig.GPU
+	if gpu == nil {
+		return allErrs
+	}
+	gpuPath := fldPath.Child("gpu")
+	if gpu.Driver != providerconfigtypes.GPUDriverNvidia {
+		allErrs = append(allErrs, field.NotSupported(gpuPath.Child("driver"), gpu.Driver, []string{string(providerconfigtypes.GPUDriverNvidia)}))
+	}
+	if gpu.Version != "" && !gpuDriverVersionRegexp.MatchString(gpu.Version) {
+		allErrs = append(allErrs, field.Invalid(gpuPath.Child("version"), gpu.Version,
+			fmt.Sprintf("must be a driver branch, e.G. %q", userdatahelper.DefaultNvidiaDriverVersion)))
+	}
+	switch providerConfig.OperatingSystem {
+	case providerconfigtypes.OperatingSystemUbuntu,
+		providerconfigtypes.OperatingSystemCentOS,
+		providerconfigtypes.OperatingSystemRHEL,
+		providerconfigtypes.OperatingSystemRockyLinux,
+		providerconfigtypes.OperatingSystemAlmaLinux:
+		return allErrs
+	}
+	return append(allErrs, field.Forbidden(gpuPath, fmt.Sprintf("not supported on %s", providerConfig.OperatingSystem)))
+}
+
+var filePermissionsRegexp = regexp.MustCompile(`^0[0-7]{3}$`)
+
+func validateAddOns(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := sets.NewString()
+	for i, addOn := range providerConfig.AddOns {
+		namePath := fldPath.Index(i).Child("name")
+		if names.Has(addOn.Name) {
+			allErrs = append(allErrs, field.Duplicate(namePath, addOn.Name))
+			continue
+		}
+		names.Insert(addOn.Name)
+		if err := addons.Validate(addOn, providerConfig.OperatingSystem); err != nil {
+			allErrs = append(allErrs, field.Invalid(namePath, addOn.Name, err.Error()))
+		}
+	}
+	if len(allErrs) > 0 || len(providerConfig.AddOns) == 0 {
+		return allErrs
+	}
+	// The files and systemd units of the add-ons must not collide with the ones of the spec
+	config := *providerConfig
+	if err := addons.Apply(&config, ""); err != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath, err.Error()))
+	}
+	return allErrs
+}
+
+func validateFiles(files []providerconfigtypes.File, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	paths := sets.NewString()
+	for i, file := range files {
+		filePath := fldPath.Index(i)
+		if !path.IsAbs(file.Path) || path.Clean(file.Path) != file.Path {
+			allErrs = append(allErrs, field.Invalid(filePath.Child("path"), file.Path, "must be a clean absolute path"))
+		} else if paths.Has(file.Path) {
+			allErrs = append(allErrs, field.Duplicate(filePath.Child("path"), file.Path))
+		}
+		paths.Insert(file.Path)
+		if file.Permissions != "" && !filePermissionsRegexp.MatchString(file.Permissions) {
+			allErrs = append(allErrs, field.Invalid(filePath.Child("permissions"), file.Permissions, "must be four octal digits, e.G. 0644"))
+		}
+	}
+	return allErrs
+}
+
+var systemdUnitNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9:_.@-]+\.(service|socket|timer|path|mount|target)$`)
+
+func validateSystemdUnits(units []providerconfigtypes.SystemdUnit, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := sets.NewString()
+	for i, unit := range units {
+		namePath := fldPath.Index(i).Child("name")
+		if !systemdUnitNameRegexp.MatchString(unit.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, unit.Name, "is not a valid unit name"))
+		} else if names.Has(unit.Name) {
+			allErrs = append(allErrs, field.Duplicate(namePath, unit.Name))
+		}
+		names.Insert(unit.Name)
+	}
+	return allErrs
+}
+
+func validateStaticPods(pods []providerconfigtypes.StaticPod, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := sets.NewString()
+	for i, pod := range pods {
+		podPath := fldPath.Index(i)
+		if len(validation.IsDNS1123Subdomain(pod.Name)) > 0 {
+			allErrs = append(allErrs, field.Invalid(podPath.Child("name"), pod.Name, "must be a DNS-1123 subdomain"))
+		} else if names.Has(pod.Name) {
+			allErrs = append(allErrs, field.Duplicate(podPath.Child("name"), pod.Name))
+		}
+		names.Insert(pod.Name)
+		// manifests from secrets and configmaps get validated by the kubelet
+		if pod.Manifest.Value == "" {
+			continue
+		}
+		manifestPath := podPath.Child("manifest", "value")
+		manifest := corev1.Pod{}
+		if err := kyaml.Unmarshal([]byte(pod.Manifest.Value), &manifest); err != nil {
+			allErrs = append(allErrs, field.Invalid(manifestPath, omittedValue, fmt.Sprintf("failed to parse the manifest: %v", err)))
+			continue
+		}
+		if manifest.APIVersion != "v1" || manifest.Kind != "Pod" {
+			allErrs = append(allErrs, field.Invalid(manifestPath, omittedValue, "must be a v1 Pod"))
+		}
+	}
+	return allErrs
+}
+
+func validateHTTPURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+	return nil
+}
+
+// validateJoinAddress verifies that the given address is the https URL of a kube-apiserver.
+func validateJoinAddress(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return errors.New("scheme must be https")
+	}
+	if u.Host == "" {
+		return errors.New("host must be set")
+	}
+	if strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+		return errors.New("must not have a path or query")
+	}
+	return nil
+}
+
+func validatePublicKeys(keys []string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, s := range keys {
 		_, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s))
 		if err != nil {
-			return fmt.Errorf("invalid public key %q: %v", s, err)
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), s, err.Error()))
 		}
 	}
 
-	return nil
+	return allErrs
+}
+
+// validateCredentialRefs ensures credentials are not set inline in the cloud provider spec, but
+// referenced with secretKeyRef or taken from the environment of the machine-controller. The fields
+// holding credentials are the ones redacted from logs, see providerconfig.IsCredentialField.
+func validateCredentialRefs(cloudProviderSpec runtime.RawExtension, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	fields := map[string]json.RawMessage{}
+	if len(cloudProviderSpec.Raw) > 0 {
+		if err := json.Unmarshal(cloudProviderSpec.Raw, &fields); err != nil {
+			return append(allErrs, field.Invalid(fldPath, omittedValue, fmt.Sprintf("must be an object: %v", err)))
+		}
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		raw := fields[name]
+		if !providerconfig.IsCredentialField(name) || string(raw) == "null" {
+			continue
+		}
+		// The values are credentials, so they must not end up in the error
+		var value providerconfigtypes.ConfigVarString
+		if err := json.Unmarshal(raw, &value); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(name), omittedValue, err.Error()))
+			continue
+		}
+		if value.Value != "" || value.ConfigMapKeyRef.Name != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child(name), "must reference a secret with secretKeyRef or vaultKeyRef instead of being set inline"))
+		}
+	}
+	return allErrs
+}
+
+var resolvConfOptionRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]*(:[0-9]+)?$`)
+
+func validateNodeNetwork(network *providerconfigtypes.NodeNetworkSettings, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if network == nil {
+		return allErrs
+	}
+
+	minMTU := int32(576)
+	switch network.IPFamily {
+	case "", providerconfigtypes.NodeIPFamilyIPv4:
+	case providerconfigtypes.NodeIPFamilyIPv6, providerconfigtypes.NodeIPFamilyIPv4IPv6, providerconfigtypes.NodeIPFamilyIPv6IPv4:
+		minMTU = 1280
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("ipFamily"), network.IPFamily, []string{
+			string(providerconfigtypes.NodeIPFamilyIPv4), string(providerconfigtypes.NodeIPFamilyIPv6),
+			string(providerconfigtypes.NodeIPFamilyIPv4IPv6), string(providerconfigtypes.NodeIPFamilyIPv6IPv4),
+		}))
+	}
+
+	if network.MTU != 0 && (network.MTU < minMTU || network.MTU > 9216) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("mtu"), network.MTU, fmt.Sprintf("must be between %d and 9216", minMTU)))
+	}
+
+	if resolvConf := network.ResolvConf; resolvConf != nil {
+		resolvConfPath := fldPath.Child("resolvConf")
+		// the limit of glibc before 2.26
+		if len(resolvConf.Search) > 6 {
+			allErrs = append(allErrs, field.TooMany(resolvConfPath.Child("search"), len(resolvConf.Search), 6))
+		}
+		for i, domain := range resolvConf.Search {
+			if len(validation.IsDNS1123Subdomain(domain)) > 0 {
+				allErrs = append(allErrs, field.Invalid(resolvConfPath.Child("search").Index(i), domain, "must be a DNS-1123 subdomain"))
+			}
+		}
+		for i, option := range resolvConf.Options {
+			if !resolvConfOptionRegexp.MatchString(option) {
+				allErrs = append(allErrs, field.Invalid(resolvConfPath.Child("options").Index(i), option, "is not a valid resolv.conf option"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateNetwork validates the static network configuration, the address is only optional
+// if it gets allocated from an IP pool.
+func validateNetwork(network *providerconfigtypes.NetworkConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if network == nil {
+		return allErrs
+	}
+
+	if network.IPPool != "" {
+		if len(validation.IsDNS1123Subdomain(network.IPPool)) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ipPool"), network.IPPool, "must be the name of a configmap"))
+		}
+	} else if _, _, err := net.ParseCIDR(network.CIDR); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("cidr"), network.CIDR, "must be an address with prefix length, e.g. 10.0.0.10/24"))
+	}
+	if network.Gateway != "" && net.ParseIP(network.Gateway) == nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("gateway"), network.Gateway, "must be an IP address"))
+	}
+	for i, server := range network.DNS.Servers {
+		if net.ParseIP(server) == nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("dns", "servers").Index(i), server, "must be an IP address"))
+		}
+	}
+	return allErrs
+}
+
+func validateFetchUserDataOnBoot(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if !providerConfig.FetchUserDataOnBoot || providerConfig.OperatingSystem != providerconfigtypes.OperatingSystemFlatcar {
+		return allErrs
+	}
+	config, err := flatcar.LoadConfig(providerConfig.OperatingSystemSpec)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath.Child("operatingSystemSpec"), omittedValue, fmt.Sprintf("failed to parse flatcar config: %v", err)))
+	}
+	if config.ProvisioningUtility == flatcar.CloudInit {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("fetchUserDataOnBoot"), "the cloud-init provisioning utility of flatcar can not fetch userdata on boot"))
+	}
+	return allErrs
+}
+
+// validateWindows rejects the settings which only apply to Linux, the Windows userdata
+// would silently ignore them.
+func validateWindows(providerConfig *providerconfigtypes.Config, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if providerConfig.OperatingSystem != providerconfigtypes.OperatingSystemWindows {
+		return allErrs
+	}
+	const detail = "not supported on windows"
+	if providerConfig.Network != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("network"), detail))
+	}
+	if providerConfig.NodeNetwork != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("nodeNetwork"), detail))
+	}
+	if providerConfig.Kernel != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("kernel"), detail))
+	}
+	if len(providerConfig.Files) > 0 {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("files"), detail))
+	}
+	if len(providerConfig.SystemdUnits) > 0 {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("systemdUnits"), detail))
+	}
+	if len(providerConfig.StaticPods) > 0 {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("staticPods"), detail))
+	}
+	if providerConfig.FetchUserDataOnBoot {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("fetchUserDataOnBoot"), detail))
+	}
+	return allErrs
 }
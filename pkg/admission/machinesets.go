@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func (ad *admissionData) mutateMachineSets(ar admissionv1beta1.AdmissionReview) (*admissionv1beta1.AdmissionResponse, error) {
+
+	machineSet := clusterv1alpha1.MachineSet{}
+	if err := json.Unmarshal(ar.Request.Object.Raw, &machineSet); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %v", err)
+	}
+	machineSetOriginal := machineSet.DeepCopy()
+
+	if errs := machineSet.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("validation failed: %v", errs)
+	}
+	if errs := validateAutoscalerAnnotations(machineSet.Annotations, field.NewPath("metadata", "annotations")); len(errs) > 0 {
+		return nil, fmt.Errorf("validation failed: %v", errs)
+	}
+	if errs := validatePlacementAnnotations(machineSet.Annotations, field.NewPath("metadata", "annotations")); len(errs) > 0 {
+		return nil, fmt.Errorf("validation failed: %v", errs)
+	}
+
+	// The class is applied on every admission, so updating the object is enough to take over
+	// changes of the class
+	if !machineClassAppliedByOwner(&machineSet.ObjectMeta) {
+		if err := ad.applyMachineClass(&machineSet.Spec.Template.ObjectMeta, &machineSet.Spec.Template.Spec); err != nil {
+			return nil, err
+		}
+	}
+
+	// Do not validate the spec if it hasn't changed
+	machineSpecNeedsValidation := true
+	if ar.Request.Operation == admissionv1beta1.Update {
+		var oldMachineSet clusterv1alpha1.MachineSet
+		if err := json.Unmarshal(ar.Request.OldObject.Raw, &oldMachineSet); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal OldObject: %v", err)
+		}
+		if equal := apiequality.Semantic.DeepEqual(oldMachineSet.Spec.Template.Spec, machineSet.Spec.Template.Spec); equal {
+			machineSpecNeedsValidation = false
+		}
+	}
+
+	if machineSpecNeedsValidation {
+		if err := ad.defaultAndValidateMachineSpec(machineSet.Namespace, &machineSet.Spec.Template.Spec, field.NewPath("spec", "template", "spec")); err != nil {
+			return nil, err
+		}
+	}
+
+	return createAdmissionResponse(machineSetOriginal, &machineSet)
+}
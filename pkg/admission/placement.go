@@ -0,0 +1,33 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"github.com/kubermatic/machine-controller/pkg/placement"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validatePlacementAnnotations verifies the annotations spreading the machines of a MachineSet or
+// MachineDeployment across zones, which would otherwise only fail once it scales.
+func validatePlacementAnnotations(annotations map[string]string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if _, err := placement.Parse(annotations); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Key(placement.ZonesAnnotation), annotations[placement.ZonesAnnotation], err.Error()))
+	}
+	return allErrs
+}
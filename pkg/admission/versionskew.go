@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+	userdatamanager "github.com/kubermatic/machine-controller/pkg/userdata/manager"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog"
+)
+
+const (
+	// VersionSkewPolicyReject rejects machines whose version is outside of the supported skew of the control plane
+	VersionSkewPolicyReject = "reject"
+	// VersionSkewPolicyWarn only logs a warning for machines whose version is outside of the supported skew
+	VersionSkewPolicyWarn = "warn"
+
+	// maxKubeletMinorSkew is how many minor versions kubelets may be older than the kube-apiserver
+	maxKubeletMinorSkew = 2
+	// maxAPIServerMinorSkew is how many minor versions the kube-apiservers of a cluster may differ during upgrades
+	maxAPIServerMinorSkew = 1
+)
+
+// validateVersionSkew verifies that the Kubernetes version the machine gets, the one of its k0s release for the k0s
+// bootstrap flavor and its kubelet version otherwise, is within the supported skew of the running kube-apiserver.
+// It is run with the other validations talking to remote APIs.
+func (ad *admissionData) validateVersionSkew(spec clusterv1alpha1.MachineSpec, providerConfig *providerconfigtypes.Config, fldPath *field.Path) error {
+	// Single nodes are clusters of their own
+	if ad.serverVersion == nil || providerConfig.Role == providerconfigtypes.NodeRoleSingle {
+		return nil
+	}
+	info, err := ad.serverVersion.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get the version of the kube-apiserver: %v", err)
+	}
+	apiServerVersion, err := semver.NewVersion(info.GitVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse the version %q of the kube-apiserver: %v", info.GitVersion, err)
+	}
+
+	versionPath := fldPath.Child("versions", "kubelet")
+	rawVersion := spec.Versions.Kubelet
+	flavor := providerConfig.BootstrapFlavor
+	if flavor == "" {
+		flavor = userdatamanager.DefaultBootstrapFlavor(providerConfig.OperatingSystem)
+	}
+	if flavor == providerconfigtypes.BootstrapFlavorK0s {
+		versionPath = fldPath.Child("providerSpec", "value", "k0sVersion")
+		rawVersion = providerConfig.K0sVersion
+		if rawVersion == "" {
+			rawVersion = userdatahelper.DefaultK0sVersion
+		}
+	}
+	version, err := semver.NewVersion(rawVersion)
+	if err != nil {
+		return field.Invalid(versionPath, rawVersion, err.Error())
+	}
+
+	message := versionSkew(apiServerVersion, version, providerConfig.Role)
+	if message == "" {
+		return nil
+	}
+	if ad.versionSkewPolicy == VersionSkewPolicyWarn {
+		klog.Warningf("Admitting machine %s with version %s: %s", spec.Name, rawVersion, message)
+		return nil
+	}
+	return field.Invalid(versionPath, rawVersion, message)
+}
+
+// versionSkew describes why the given Kubernetes version of a node with the given role isn't supported with the
+// given version of the kube-apiserver, it returns an empty string for supported versions. Workers may be up to
+// two minor versions older than the kube-apiserver but not newer, the kube-apiservers of controllers may differ
+// by one minor version, so the control plane can be upgraded one machine after the other.
+func versionSkew(apiServer, node *semver.Version, role providerconfigtypes.NodeRole) string {
+	if node.Major() != apiServer.Major() {
+		return fmt.Sprintf("Kubernetes %d.%d is not supported with the kube-apiserver %d.%d", node.Major(), node.Minor(), apiServer.Major(), apiServer.Minor())
+	}
+	skew := apiServer.Minor() - node.Minor()
+	if role == providerconfigtypes.NodeRoleController {
+		if skew > maxAPIServerMinorSkew || -skew > maxAPIServerMinorSkew {
+			return fmt.Sprintf("the kube-apiserver of Kubernetes %d.%d can't run with the kube-apiserver %d.%d of the cluster, controllers may differ by at most %d minor version",
+				node.Major(), node.Minor(), apiServer.Major(), apiServer.Minor(), maxAPIServerMinorSkew)
+		}
+		return ""
+	}
+	if skew < 0 {
+		return fmt.Sprintf("the kubelet of Kubernetes %d.%d must not be newer than the kube-apiserver %d.%d", node.Major(), node.Minor(), apiServer.Major(), apiServer.Minor())
+	}
+	if skew > maxKubeletMinorSkew {
+		return fmt.Sprintf("the kubelet of Kubernetes %d.%d is more than %d minor versions older than the kube-apiserver %d.%d",
+			node.Major(), node.Minor(), maxKubeletMinorSkew, apiServer.Major(), apiServer.Minor())
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+func TestVersionSkew(t *testing.T) {
+	tests := []struct {
+		name      string
+		apiServer string
+		node      string
+		role      providerconfigtypes.NodeRole
+		supported bool
+	}{
+		{
+			name:      "same version",
+			apiServer: "v1.21.2+k0s",
+			node:      "v1.21.2+k0s.1",
+			supported: true,
+		},
+		{
+			name:      "worker two minor versions older",
+			apiServer: "v1.21.2",
+			node:      "1.19.9",
+			supported: true,
+		},
+		{
+			name:      "worker three minor versions older",
+			apiServer: "v1.21.2",
+			node:      "1.18.6",
+		},
+		{
+			name:      "worker newer",
+			apiServer: "v1.20.4",
+			node:      "v1.21.2+k0s.1",
+		},
+		{
+			name:      "worker newer patch release",
+			apiServer: "v1.21.1",
+			node:      "v1.21.2+k0s.1",
+			supported: true,
+		},
+		{
+			name:      "controller one minor version newer",
+			apiServer: "v1.20.4",
+			node:      "v1.21.2+k0s.1",
+			role:      providerconfigtypes.NodeRoleController,
+			supported: true,
+		},
+		{
+			name:      "controller two minor versions older",
+			apiServer: "v1.21.2",
+			node:      "v1.19.9+k0s.0",
+			role:      providerconfigtypes.NodeRoleController,
+		},
+		{
+			name:      "other major version",
+			apiServer: "v1.21.2",
+			node:      "2.21.2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := versionSkew(semver.MustParse(test.apiServer), semver.MustParse(test.node), test.role)
+			if supported := message == ""; supported != test.supported {
+				t.Errorf("expected supported to be %t, got %t: %s", test.supported, supported, message)
+			}
+		})
+	}
+}
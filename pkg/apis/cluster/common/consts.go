@@ -42,6 +42,21 @@ const (
 	// or running out of physical machines in an on-premise environment.
 	InsufficientResourcesMachineError MachineStatusError = "InsufficientResources"
 
+	// The cloud provider rejected the credentials of the machine, e.g.
+	// because they are invalid, expired or lack permissions. Retrying
+	// doesn't help until the credentials got fixed.
+	InvalidCredentialsMachineError MachineStatusError = "InvalidCredentials"
+
+	// A quota or limit of the account at the cloud provider is exhausted,
+	// e.g. the number of instances or cores. Retrying doesn't help until
+	// the quota got raised or other instances got deleted.
+	QuotaExceededMachineError MachineStatusError = "QuotaExceeded"
+
+	// The cloud provider has no capacity for the requested instance type
+	// in the zone or datacenter right now, the request may succeed later
+	// or with another instance type or zone.
+	InsufficientCapacityMachineError MachineStatusError = "InsufficientCapacity"
+
 	// There was an error while trying to create a Node to match this
 	// Machine. This may indicate a transient problem that will be fixed
 	// automatically with time, such as a service outage, or a terminal
@@ -74,6 +89,11 @@ const (
 	// not result in a Node joining the cluster within a given timeout
 	// and that are managed by a MachineSet
 	JoinClusterTimeoutMachineError = "JoinClusterTimeoutError"
+
+	// This error indicates that the instance of a machine whose node
+	// already joined the cluster was deleted at the cloud provider
+	// without the machine being deleted, e.g. in its web console
+	InstanceGoneMachineError MachineStatusError = "InstanceGoneError"
 )
 
 type ClusterStatusError string
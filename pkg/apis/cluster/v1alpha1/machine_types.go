@@ -41,8 +41,10 @@ const (
 // +kubebuilder:resource:shortName=ma
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="ProviderID",type="string",JSONPath=".spec.providerID",description="Provider ID"
-// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Machine status such as Terminating/Pending/Running/Failed etc"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Machine phase such as Provisioning/Provisioned/Running/Deleting/Failed"
 // +kubebuilder:printcolumn:name="NodeName",type="string",JSONPath=".status.nodeRef.name",description="Node name associated with this machine",priority=1
+// +kubebuilder:printcolumn:name="Instance",type="string",JSONPath=".status.providerStatus.instanceID",description="ID of the instance at the cloud provider",priority=1
+// +kubebuilder:printcolumn:name="InstanceStatus",type="string",JSONPath=".status.providerStatus.instanceStatus",description="Last observed status of the instance",priority=1
 type Machine struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -177,6 +179,8 @@ type MachineStatus struct {
 	// It is recommended that providers maintain their
 	// own versioned API types that should be
 	// serialized/deserialized from this field.
+	// The machine-controller sets the instanceID and the
+	// last observed instanceStatus in it.
 	// +optional
 	ProviderStatus *runtime.RawExtension `json:"providerStatus,omitempty"`
 
@@ -199,12 +203,54 @@ type MachineStatus struct {
 	// +optional
 	LastOperation *LastOperation `json:"lastOperation,omitempty"`
 
-	// Phase represents the current phase of machine actuation.
-	// E.g. Pending, Running, Terminating, Failed etc.
+	// Phase represents the current phase of machine actuation,
+	// one of Provisioning, Provisioned, Running, Deleting or Failed.
 	// +optional
 	Phase *string `json:"phase,omitempty"`
+
+	// InstanceMetadata describes the instance of the machine for inventory tooling, as far as its
+	// cloud provider reports it. It is updated whenever the instance is looked up.
+	// +optional
+	InstanceMetadata *InstanceMetadata `json:"instanceMetadata,omitempty"`
+}
+
+// InstanceMetadata describes the instance of a machine as reported by its cloud provider.
+type InstanceMetadata struct {
+	// Image is the name or ID of the image the instance was created from.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// CreationTimestamp is when the cloud provider created the instance.
+	// +optional
+	CreationTimestamp *metav1.Time `json:"creationTimestamp,omitempty"`
+
+	// Location is the region, zone or datacenter of the instance.
+	// +optional
+	Location string `json:"location,omitempty"`
+
+	// Host identifies the hypervisor or dedicated host the instance runs on.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Tags are the tags or labels of the instance at the cloud provider, e.g. for cost allocation.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
+// Phases of a machine, which are maintained by the machine-controller.
+const (
+	// MachinePhaseProvisioning means the instance of the machine is being created.
+	MachinePhaseProvisioning = "Provisioning"
+	// MachinePhaseProvisioned means the instance exists, but its node did not join yet.
+	MachinePhaseProvisioned = "Provisioned"
+	// MachinePhaseRunning means the node of the machine joined the cluster.
+	MachinePhaseRunning = "Running"
+	// MachinePhaseDeleting means the machine is being deleted.
+	MachinePhaseDeleting = "Deleting"
+	// MachinePhaseFailed means the machine has a terminal error, see its errorReason.
+	MachinePhaseFailed = "Failed"
+)
+
 // LastOperation represents the detail of the last performed operation on the MachineObject.
 type LastOperation struct {
 	// Description is the human-readable description of the last operation.
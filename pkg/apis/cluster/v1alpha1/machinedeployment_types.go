@@ -158,6 +158,11 @@ type MachineDeploymentStatus struct {
 	// that still have not been created.
 	// +optional
 	UnavailableReplicas int32 `json:"unavailableReplicas,omitempty" protobuf:"varint,5,opt,name=unavailableReplicas"`
+
+	// LabelSelector is the selector of the deployment in string form, which the scale
+	// subresource reports, e.g. to the cluster-autoscaler.
+	// +optional
+	LabelSelector string `json:"labelSelector,omitempty"`
 }
 
 /// [MachineDeploymentStatus]
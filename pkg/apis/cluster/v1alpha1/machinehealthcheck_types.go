@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MachineHealthCheck deletes the machines matching its selector once their node is
+// unhealthy, so the owning MachineSet replaces them.
+// +k8s:openapi-gen=true
+// +resource:path=machinehealthchecks
+// +kubebuilder:resource:shortName=mhc
+// +kubebuilder:subresource:status
+type MachineHealthCheck struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MachineHealthCheckSpec   `json:"spec"`
+	Status MachineHealthCheckStatus `json:"status,omitempty"`
+}
+
+// MachineHealthCheckSpec defines the desired state of a MachineHealthCheck.
+type MachineHealthCheckSpec struct {
+	// Selector of the machines to check. Only machines owned by a MachineSet get
+	// remediated, other machines would not be replaced.
+	Selector metav1.LabelSelector `json:"selector"`
+
+	// UnhealthyConditions are the node conditions which make a machine unhealthy once
+	// they lasted for their timeout.
+	UnhealthyConditions []UnhealthyCondition `json:"unhealthyConditions"`
+
+	// MaxUnhealthy is the number or percentage of unhealthy machines up to which
+	// machines get remediated. Beyond that the problem is likely not with the machines,
+	// e.g. a network outage, so nothing gets remediated. Defaults to 100%.
+	// +optional
+	MaxUnhealthy *intstr.IntOrString `json:"maxUnhealthy,omitempty"`
+
+	// NodeStartupTimeout is the duration after which machines without a node are
+	// unhealthy. Defaults to 10 minutes.
+	// +optional
+	NodeStartupTimeout *metav1.Duration `json:"nodeStartupTimeout,omitempty"`
+}
+
+// UnhealthyCondition is a node condition which makes a machine unhealthy once it
+// lasted for the timeout.
+type UnhealthyCondition struct {
+	Type    corev1.NodeConditionType `json:"type"`
+	Status  corev1.ConditionStatus   `json:"status"`
+	Timeout metav1.Duration          `json:"timeout"`
+}
+
+// MachineHealthCheckStatus defines the observed state of a MachineHealthCheck.
+type MachineHealthCheckStatus struct {
+	// ExpectedMachines is the number of machines matching the selector.
+	// +optional
+	ExpectedMachines int32 `json:"expectedMachines,omitempty"`
+
+	// CurrentHealthy is the number of healthy machines matching the selector.
+	// +optional
+	CurrentHealthy int32 `json:"currentHealthy,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MachineHealthCheckList contains a list of MachineHealthChecks
+type MachineHealthCheckList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MachineHealthCheck `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MachineHealthCheck{}, &MachineHealthCheckList{})
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
 	"k8s.io/apimachinery/pkg/labels"
@@ -141,6 +142,11 @@ type MachineSetStatus struct {
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
+	// LabelSelector is the selector of the MachineSet in string form, which the scale
+	// subresource reports, e.g. to the cluster-autoscaler.
+	// +optional
+	LabelSelector string `json:"labelSelector,omitempty"`
+
 	// In the event that there is a terminal problem reconciling the
 	// replicas, both ErrorReason and ErrorMessage will be set. ErrorReason
 	// will be populated with a succinct value suitable for machine
@@ -163,10 +169,111 @@ type MachineSetStatus struct {
 	ErrorReason *common.MachineSetStatusError `json:"errorReason,omitempty"`
 	// +optional
 	ErrorMessage *string `json:"errorMessage,omitempty"`
+
+	// Provisioning reports how the provisioning of the recent machines of this MachineSet went, so a
+	// degrading node pool can be noticed.
+	// +optional
+	Provisioning *MachineSetProvisioningStatus `json:"provisioning,omitempty"`
+
+	// Conditions of the MachineSet, e.g. whether the quotas of the cloud provider allow creating
+	// the missing replicas.
+	// +optional
+	Conditions []MachineSetCondition `json:"conditions,omitempty"`
+
+	// Cost reports the instances of this MachineSet by instance type and their price, for chargeback.
+	// Only set if the machine-controller runs with -cost-report.
+	// +optional
+	Cost *MachineSetCostStatus `json:"cost,omitempty"`
 }
 
 /// [MachineSetStatus]
 
+// MachineSetProvisioningStatus is the outcome of the provisioning of the recent machines of a MachineSet
+type MachineSetProvisioningStatus struct {
+	// Recent holds the recently provisioned machines, oldest first.
+	// +optional
+	Recent []MachineProvisioning `json:"recent,omitempty"`
+
+	// SucceededPercent is the percentage of the recent machines whose node joined the cluster.
+	SucceededPercent int32 `json:"succeededPercent"`
+
+	// AverageTimeToJoin is the average duration from the creation of the instances of the recent machines
+	// until their node joined the cluster.
+	// +optional
+	AverageTimeToJoin *metav1.Duration `json:"averageTimeToJoin,omitempty"`
+}
+
+// MachineProvisioning is the outcome of the provisioning of a single machine
+type MachineProvisioning struct {
+	MachineName string `json:"machineName"`
+
+	// Succeeded is true if the node of the machine joined the cluster, false if the machine failed.
+	Succeeded bool `json:"succeeded"`
+
+	// TimeToJoin is the duration from the creation of the instance until the node joined the cluster.
+	// +optional
+	TimeToJoin *metav1.Duration `json:"timeToJoin,omitempty"`
+}
+
+// MachineSetCostStatus is the cost of the instances of a MachineSet
+type MachineSetCostStatus struct {
+	// CostCenter holds the cost center labels of the machine template, see -cost-center-labels.
+	// +optional
+	CostCenter map[string]string `json:"costCenter,omitempty"`
+
+	// InstanceTypes holds the number of instances by instance type, ordered by the instance type.
+	// +optional
+	InstanceTypes []MachineSetInstanceTypeCost `json:"instanceTypes,omitempty"`
+
+	// HourlyPrice is the total hourly price of the instances, e.g. "0.0476". It is only set if the cloud
+	// provider publishes the prices of all instance types of the MachineSet.
+	// +optional
+	HourlyPrice string `json:"hourlyPrice,omitempty"`
+
+	// Currency of the prices, e.g. USD.
+	// +optional
+	Currency string `json:"currency,omitempty"`
+}
+
+// MachineSetInstanceTypeCost is the number of instances of an instance type of a MachineSet and their price
+type MachineSetInstanceTypeCost struct {
+	InstanceType string `json:"instanceType"`
+
+	// Instances is the number of machines of the instance type with an instance.
+	Instances int32 `json:"instances"`
+
+	// HourlyPrice is the hourly price of a single instance, if the cloud provider publishes it.
+	// +optional
+	HourlyPrice string `json:"hourlyPrice,omitempty"`
+}
+
+// MachineSetConditionType is the type of a condition of a MachineSet
+type MachineSetConditionType string
+
+const (
+	// MachineSetCapacityAvailable is false if the quotas of the cloud provider don't allow creating the
+	// missing replicas of the MachineSet, which then are not created until the quotas allow all of them.
+	MachineSetCapacityAvailable MachineSetConditionType = "CapacityAvailable"
+)
+
+// MachineSetCondition is a condition of a MachineSet
+type MachineSetCondition struct {
+	Type   MachineSetConditionType `json:"type"`
+	Status corev1.ConditionStatus  `json:"status"`
+
+	// LastTransitionTime is the time the status of the condition changed.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a machine readable reason of the status.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable message with the details of the status.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 func (m *MachineSet) Validate() field.ErrorList {
 	errors := field.ErrorList{}
 
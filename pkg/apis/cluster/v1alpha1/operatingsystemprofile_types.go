@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UserDataFormat is the format of the document rendered from an OperatingSystemProfile template.
+type UserDataFormat string
+
+const (
+	// UserDataFormatCloudInit is used for templates rendering a cloud-init document.
+	UserDataFormatCloudInit UserDataFormat = "cloud-init"
+	// UserDataFormatIgnition is used for templates rendering a config which gets converted to Ignition.
+	UserDataFormatIgnition UserDataFormat = "ignition"
+)
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// OperatingSystemProfile contains a templated userdata document and the images
+// to boot it with. Machines referencing a profile via
+// `providerSpec.value.operatingSystemProfile` get their userdata rendered from the
+// profile instead of the compiled in userdata plugin of their operating system.
+// +k8s:openapi-gen=true
+// +resource:path=operatingsystemprofiles
+// +kubebuilder:resource:shortName=osp
+type OperatingSystemProfile struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec OperatingSystemProfileSpec `json:"spec"`
+}
+
+// OperatingSystemProfileSpec defines the desired state of an OperatingSystemProfile.
+type OperatingSystemProfileSpec struct {
+	// OperatingSystem is the operating system the profile is based on, e.g. "ubuntu".
+	// Cloud providers rely on it for operating system specific defaults like
+	// the root device or the ssh user.
+	OperatingSystem string `json:"operatingSystem"`
+
+	// Format of the document rendered from the template. Ignition templates are
+	// Container Linux Configs, or Butane configs when the operating system is "fcos".
+	Format UserDataFormat `json:"format"`
+
+	// Template is a Go text/template rendering the userdata. It gets the same data
+	// and functions as the compiled in userdata plugins.
+	Template string `json:"template"`
+
+	// Images maps cloud provider names to the image to use on that cloud provider,
+	// e.g. an AMI ID on "aws". It is only used when the machine does not set an image itself.
+	// +optional
+	Images map[string]string `json:"images,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// OperatingSystemProfileList contains a list of OperatingSystemProfiles
+type OperatingSystemProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OperatingSystemProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatingSystemProfile{}, &OperatingSystemProfileList{})
+}
@@ -47,6 +47,7 @@ type UserDataRequest struct {
 	DNSIPs                []net.IP
 	ExternalCloudProvider bool
 	HTTPProxy             string
+	HTTPSProxy            string
 	NoProxy               string
 	InsecureRegistries    []string
 	RegistryMirrors       []string
@@ -54,6 +55,11 @@ type UserDataRequest struct {
 	HyperkubeImage        string
 	KubeletRepository     string
 	KubeletFeatureGates   map[string]bool
+	// K0sJoinToken is the token k0s workers join the cluster with,
+	// it is only set for the k0s bootstrap flavor.
+	K0sJoinToken string
+	// K0sReleaseURL is the endpoint k0s workers download k0s from.
+	K0sReleaseURL string
 }
 
 // UserDataResponse contains the responded user data.
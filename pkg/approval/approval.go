@@ -0,0 +1,162 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package approval asks an external HTTP endpoint, e.g. of a change-management system, to approve the deletion
+// and optionally the creation of machines before the machine-controller acts on them
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Operation is a change of a machine which needs an approval
+type Operation string
+
+const (
+	// OperationCreate is the creation of the instance of a machine
+	OperationCreate Operation = "Create"
+	// OperationDelete is the deletion of a machine, including the draining of its node and the deletion of its instance
+	OperationDelete Operation = "Delete"
+)
+
+// Request is posted as JSON to the approval webhook
+type Request struct {
+	Operation Operation         `json:"operation"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	UID       types.UID         `json:"uid"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// NodeName is the name of the node of the machine, empty if it has none
+	NodeName string `json:"nodeName,omitempty"`
+	// Controller is the name of the machine-controller asking
+	Controller string `json:"controller,omitempty"`
+}
+
+// Response is the answer of the approval webhook
+type Response struct {
+	Approved bool `json:"approved"`
+	// Reason is shown in the event of the machine
+	Reason string `json:"reason,omitempty"`
+}
+
+// Gate asks the approval webhook whether operations on machines may be carried out
+type Gate struct {
+	url        string
+	token      string
+	operations map[Operation]bool
+	controller string
+	client     *http.Client
+}
+
+// New returns a gate for the given operations, a comma separated list of create and delete. The token, if not
+// empty, is sent as bearer token.
+func New(webhookURL, operations, token, controller string) (*Gate, error) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the approval webhook URL: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("the approval webhook must be an http or https URL, got %q", webhookURL)
+	}
+
+	gate := &Gate{
+		url:        webhookURL,
+		token:      token,
+		operations: map[Operation]bool{},
+		controller: controller,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, operation := range strings.Split(operations, ",") {
+		switch strings.TrimSpace(strings.ToLower(operation)) {
+		case "create":
+			gate.operations[OperationCreate] = true
+		case "delete":
+			gate.operations[OperationDelete] = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown operation %q, must be create or delete", operation)
+		}
+	}
+	if len(gate.operations) == 0 {
+		return nil, fmt.Errorf("no operations to approve")
+	}
+	return gate, nil
+}
+
+// Gates returns whether the given operation needs an approval, which is false for a nil gate
+func (g *Gate) Gates(operation Operation) bool {
+	return g != nil && g.operations[operation]
+}
+
+// Review asks the webhook whether the operation on the machine is approved. Errors and responses other than 200
+// are returned as error, so the operation is not carried out if the webhook is unavailable.
+func (g *Gate) Review(ctx context.Context, operation Operation, machine *clusterv1alpha1.Machine) (*Response, error) {
+	request := Request{
+		Operation:  operation,
+		Namespace:  machine.Namespace,
+		Name:       machine.Name,
+		UID:        machine.UID,
+		Labels:     machine.Labels,
+		Controller: g.controller,
+	}
+	if machine.Status.NodeRef != nil {
+		request.NodeName = machine.Status.NodeRef.Name
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest, err := http.NewRequest(http.MethodPost, g.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest = httpRequest.WithContext(ctx)
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if g.token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+g.token)
+	}
+	httpResponse, err := g.client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	content, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response of the approval webhook: %v", err)
+	}
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the approval webhook responded with status code %d", httpResponse.StatusCode)
+	}
+
+	response := &Response{}
+	if err := json.Unmarshal(content, response); err != nil {
+		return nil, fmt.Errorf("failed to parse the response of the approval webhook: %v", err)
+	}
+	return response, nil
+}
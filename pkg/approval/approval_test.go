@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReview(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		request := Request{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch request.Name {
+		case "approved":
+			_ = json.NewEncoder(w).Encode(Response{Approved: true})
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_ = json.NewEncoder(w).Encode(Response{Reason: "change freeze"})
+		}
+	}))
+	defer server.Close()
+
+	gate, err := New(server.URL, "delete", "secret", "test")
+	if err != nil {
+		t.Fatalf("failed to create gate: %v", err)
+	}
+	if gate.Gates(OperationCreate) || !gate.Gates(OperationDelete) {
+		t.Errorf("expected only deletions to be gated")
+	}
+
+	tests := []struct {
+		name             string
+		expectedApproved bool
+		expectedReason   string
+		expectedError    bool
+	}{
+		{
+			name:             "approved",
+			expectedApproved: true,
+		},
+		{
+			name:           "denied",
+			expectedReason: "change freeze",
+		},
+		{
+			name:          "broken",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			machine := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: test.name, Namespace: "kube-system"}}
+			response, err := gate.Review(context.Background(), OperationDelete, machine)
+			if (err != nil) != test.expectedError {
+				t.Fatalf("expected error %t, got %v", test.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if response.Approved != test.expectedApproved || response.Reason != test.expectedReason {
+				t.Errorf("expected approved %t with reason %q, got %+v", test.expectedApproved, test.expectedReason, response)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("ftp://example.com", "delete", "", ""); err == nil {
+		t.Errorf("expected an error for a non-http URL")
+	}
+	if _, err := New("https://example.com", "update", "", ""); err == nil {
+		t.Errorf("expected an error for an unknown operation")
+	}
+	gate, err := New("https://example.com", "create, delete", "", "")
+	if err != nil {
+		t.Fatalf("failed to create gate: %v", err)
+	}
+	if !gate.Gates(OperationCreate) || !gate.Gates(OperationDelete) {
+		t.Errorf("expected creations and deletions to be gated")
+	}
+	var nilGate *Gate
+	if nilGate.Gates(OperationDelete) {
+		t.Errorf("expected a nil gate to gate nothing")
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records the instances the machine-controller creates and deletes at the cloud
+// providers, so the churn of nodes can be reviewed for compliance.
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// ActionCreate is the creation of an instance
+	ActionCreate = "Create"
+	// ActionDelete is a call deleting an instance, it is repeated until the instance is gone
+	ActionDelete = "Delete"
+	// ActionAdopt is the takeover of an existing instance which was not created by the machine-controller
+	ActionAdopt = "Adopt"
+
+	// ResultSuccess means the instance got created, adopted or is gone
+	ResultSuccess = "Success"
+	// ResultPending means the deletion of the instance was started, but it is not gone yet
+	ResultPending = "Pending"
+	// ResultFailure means the call to the cloud provider failed
+	ResultFailure = "Failure"
+)
+
+// Record is an action of the machine-controller at a cloud provider
+type Record struct {
+	Time time.Time `json:"time"`
+	// RequestID identifies the record
+	RequestID string `json:"requestID"`
+	// TraceID is the id of the trace of the reconciliation if tracing is enabled
+	TraceID string `json:"traceID,omitempty"`
+	// Controller is the name of the machine-controller, see its -name flag
+	Controller string `json:"controller,omitempty"`
+	Machine    string `json:"machine"`
+	MachineUID string `json:"machineUID"`
+	// Owner is the controller of the machine, e.g. MachineSet/workers-5b9c7
+	Owner      string `json:"owner,omitempty"`
+	Provider   string `json:"provider"`
+	Action     string `json:"action"`
+	InstanceID string `json:"instanceID,omitempty"`
+	Result     string `json:"result"`
+	// Error is the error of the cloud provider, with credentials redacted
+	Error string `json:"error,omitempty"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(record *Record) error
+	// Close writes the pending records
+	Close()
+}
+
+var (
+	lock       sync.RWMutex
+	sinks      []Sink
+	controller string
+)
+
+// Setup configures the sinks the records are written to in addition to the log. The file gets the
+// records appended as JSON lines, the webhook gets them posted as JSON. Either is disabled if empty.
+// The given name of the machine-controller is part of the records.
+func Setup(file, webhookURL, name string) error {
+	var configured []Sink
+	if file != "" {
+		sink, err := newFileSink(file)
+		if err != nil {
+			return err
+		}
+		configured = append(configured, sink)
+	}
+	if webhookURL != "" {
+		sink, err := newWebhookSink(webhookURL)
+		if err != nil {
+			return err
+		}
+		configured = append(configured, sink)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	sinks = configured
+	controller = name
+	return nil
+}
+
+// Shutdown writes the pending records and closes the sinks
+func Shutdown() {
+	lock.Lock()
+	closing := sinks
+	sinks = nil
+	lock.Unlock()
+
+	for _, sink := range closing {
+		sink.Close()
+	}
+}
+
+// NewRequestID returns a random id for a record
+func NewRequestID() string {
+	id := make([]byte, 8)
+	// crypto/rand only fails if the system has no source of randomness, the time still tells
+	// the records apart then
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+// Write logs the given record and writes it to the configured sinks. Records which can't be written
+// to a sink are logged as error, so they are never lost silently.
+func Write(record *Record) {
+	lock.RLock()
+	defer lock.RUnlock()
+	record.Controller = controller
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		klog.Errorf("Failed to marshal audit record %s: %v", record.RequestID, err)
+		return
+	}
+	klog.Infof("Audit: %s", raw)
+	for _, sink := range sinks {
+		if err := sink.Write(record); err != nil {
+			klog.Errorf("Failed to write audit record %s: %v", raw, err)
+		}
+	}
+}
+
+// fileSink appends the records as JSON lines to a file
+type fileSink struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log file: %v", err)
+	}
+	return &fileSink{file: file}, nil
+}
+
+func (s *fileSink) Write(record *Record) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// A single write per record, so records of several processes appending to the file don't interleave
+	_, err = s.file.Write(append(raw, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.file.Close(); err != nil {
+		klog.Errorf("Failed to close audit log file: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "audit.log")
+
+	received := make(chan Record, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record := Record{}
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Errorf("failed to decode record: %v", err)
+		}
+		received <- record
+	}))
+	defer server.Close()
+
+	if err := Setup(file, server.URL, "workers"); err != nil {
+		t.Fatalf("failed to set up the audit sinks: %v", err)
+	}
+	Write(&Record{RequestID: "1", Machine: "kube-system/machine-1", Provider: "hetzner", Action: ActionCreate, InstanceID: "42", Result: ResultSuccess})
+	Write(&Record{RequestID: "2", Machine: "kube-system/machine-1", Provider: "hetzner", Action: ActionDelete, Result: ResultPending})
+	Shutdown()
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("failed to open audit log file: %v", err)
+	}
+	defer f.Close()
+	var written []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("failed to unmarshal audit log line %q: %v", scanner.Text(), err)
+		}
+		written = append(written, record)
+	}
+	if len(written) != 2 || written[0].RequestID != "1" || written[1].RequestID != "2" {
+		t.Fatalf("expected both records to be appended to the file in order, got %+v", written)
+	}
+	if written[0].Controller != "workers" || written[0].Time.IsZero() {
+		t.Errorf("expected the controller and time to be set, got %+v", written[0])
+	}
+
+	for _, requestID := range []string{"1", "2"} {
+		if record := <-received; record.RequestID != requestID {
+			t.Errorf("expected the webhook to receive record %s, got %+v", requestID, record)
+		}
+	}
+}
+
+func TestSetupInvalidWebhook(t *testing.T) {
+	if err := Setup("", "ftp://audit.example.com", ""); err == nil {
+		t.Error("expected an error for a webhook which is not an http URL")
+	}
+}
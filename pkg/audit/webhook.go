@@ -0,0 +1,114 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// webhookQueueSize is the number of records which get queued at most while the webhook is slow
+	webhookQueueSize = 1024
+	// webhookRetries is the number of times a record is retried before it gets logged as lost
+	webhookRetries = 3
+)
+
+// webhookSink posts the records one by one as JSON to a webhook. They are sent in the background,
+// so a slow webhook doesn't block the reconciliations.
+type webhookSink struct {
+	url    string
+	client *http.Client
+	queue  chan *Record
+	done   chan struct{}
+}
+
+func newWebhookSink(webhookURL string) (*webhookSink, error) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the audit webhook URL: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("the audit webhook must be an http or https URL, got %q", webhookURL)
+	}
+
+	s := &webhookSink{
+		url:    webhookURL,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan *Record, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *webhookSink) Write(record *Record) error {
+	select {
+	case s.queue <- record:
+		return nil
+	default:
+		return errors.New("the queue of the audit webhook is full")
+	}
+}
+
+// Close sends the queued records and waits until they got sent
+func (s *webhookSink) Close() {
+	close(s.queue)
+	<-s.done
+}
+
+func (s *webhookSink) run() {
+	defer close(s.done)
+	for record := range s.queue {
+		var err error
+		for attempt := 0; attempt < webhookRetries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+			if err = s.send(record); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			raw, _ := json.Marshal(record)
+			klog.Errorf("Failed to send audit record %s to the webhook: %v", raw, err)
+		}
+	}
+}
+
+func (s *webhookSink) send(record *Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	response, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("the webhook responded with status code %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backup exports the machines of a cluster with the state of their instances to a bundle and imports
+// them again, e.g. into a new management cluster after the old one was lost, without recreating the instances
+package backup
+
+import (
+	"context"
+	"fmt"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// BundleAPIVersion is the API version of the bundles
+	BundleAPIVersion = "machine-controller.kubermatic.io/v1alpha1"
+	// BundleKind is the kind of the bundles
+	BundleKind = "MachineBundle"
+)
+
+// Bundle holds the exported MachineDeployments, MachineSets and machines of a namespace. Their metadata is
+// stripped of everything the apiserver sets, so they can be created in another cluster.
+type Bundle struct {
+	metav1.TypeMeta `json:",inline"`
+
+	MachineDeployments []clusterv1alpha1.MachineDeployment `json:"machineDeployments,omitempty"`
+	MachineSets        []clusterv1alpha1.MachineSet        `json:"machineSets,omitempty"`
+	Machines           []Machine                           `json:"machines,omitempty"`
+}
+
+// Machine is an exported machine with the state of its instance
+type Machine struct {
+	Machine clusterv1alpha1.Machine `json:"machine"`
+
+	// UID is the UID of the exported machine, which the cloud providers identify its instance by
+	UID types.UID `json:"uid"`
+	// InstanceID is the ID of the instance at the cloud provider, empty if the machine had no instance
+	InstanceID string `json:"instanceID,omitempty"`
+	// Addresses of the instance
+	Addresses map[string]corev1.NodeAddressType `json:"addresses,omitempty"`
+	// NodeName is the name of the node of the instance
+	NodeName string `json:"nodeName,omitempty"`
+}
+
+// InstanceGetter returns the instance of the given machine or ErrInstanceNotFound
+type InstanceGetter func(machine *clusterv1alpha1.Machine) (instance.Instance, error)
+
+// UIDMigrator makes the cloud provider identify the instance of the given machine by the new UID
+type UIDMigrator func(machine *clusterv1alpha1.Machine, newUID types.UID) error
+
+// Export returns the bundle of the MachineDeployments, MachineSets and machines of the namespace. Machines
+// being deleted are skipped.
+func Export(ctx context.Context, client ctrlruntimeclient.Client, namespace string, getInstance InstanceGetter) (*Bundle, error) {
+	bundle := &Bundle{TypeMeta: metav1.TypeMeta{APIVersion: BundleAPIVersion, Kind: BundleKind}}
+
+	machineDeployments := &clusterv1alpha1.MachineDeploymentList{}
+	if err := client.List(ctx, machineDeployments, ctrlruntimeclient.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list MachineDeployments: %v", err)
+	}
+	for _, machineDeployment := range machineDeployments.Items {
+		if machineDeployment.DeletionTimestamp != nil {
+			continue
+		}
+		machineDeployment.ObjectMeta = portableObjectMeta(machineDeployment.ObjectMeta)
+		machineDeployment.Status = clusterv1alpha1.MachineDeploymentStatus{}
+		bundle.MachineDeployments = append(bundle.MachineDeployments, machineDeployment)
+	}
+
+	machineSets := &clusterv1alpha1.MachineSetList{}
+	if err := client.List(ctx, machineSets, ctrlruntimeclient.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list MachineSets: %v", err)
+	}
+	for _, machineSet := range machineSets.Items {
+		if machineSet.DeletionTimestamp != nil {
+			continue
+		}
+		machineSet.ObjectMeta = portableObjectMeta(machineSet.ObjectMeta)
+		machineSet.Status = clusterv1alpha1.MachineSetStatus{}
+		bundle.MachineSets = append(bundle.MachineSets, machineSet)
+	}
+
+	machines := &clusterv1alpha1.MachineList{}
+	if err := client.List(ctx, machines, ctrlruntimeclient.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list machines: %v", err)
+	}
+	for i := range machines.Items {
+		machine := &machines.Items[i]
+		if machine.DeletionTimestamp != nil {
+			continue
+		}
+		exported := Machine{UID: machine.UID}
+		if machine.Status.NodeRef != nil {
+			exported.NodeName = machine.Status.NodeRef.Name
+		}
+		providerInstance, err := getInstance(machine)
+		switch {
+		case err == cloudprovidererrors.ErrInstanceNotFound:
+			klog.Warningf("Machine %s has no instance, it gets a new one when imported", machine.Name)
+		case err != nil:
+			return nil, fmt.Errorf("failed to get instance of machine %s: %v", machine.Name, err)
+		default:
+			exported.InstanceID = providerInstance.ID()
+			exported.Addresses = providerInstance.Addresses()
+		}
+
+		exported.Machine = *machine
+		exported.Machine.ObjectMeta = portableObjectMeta(machine.ObjectMeta)
+		exported.Machine.Status = clusterv1alpha1.MachineStatus{}
+		bundle.Machines = append(bundle.Machines, exported)
+	}
+	return bundle, nil
+}
+
+// Import creates the objects of the bundle in the given namespace, or in the namespace they were exported
+// from if it is empty. The machines are created paused first and their instances are migrated to the new
+// UIDs, then the MachineSets and MachineDeployments are created, which adopt the machines instead of creating
+// new ones, and finally the machines are unpaused. Objects which exist already are kept, so a failed import can
+// be run again.
+func Import(ctx context.Context, client ctrlruntimeclient.Client, bundle *Bundle, namespace string, migrateUID UIDMigrator) error {
+	if bundle.APIVersion != BundleAPIVersion || bundle.Kind != BundleKind {
+		return fmt.Errorf("not a bundle of kind %s/%s but %s/%s", BundleAPIVersion, BundleKind, bundle.APIVersion, bundle.Kind)
+	}
+
+	var unpause []*clusterv1alpha1.Machine
+	for _, exported := range bundle.Machines {
+		machine := exported.Machine.DeepCopy()
+		setNamespace(&machine.ObjectMeta, namespace)
+		paused := machine.Annotations[machinecontroller.AnnotationPaused] == "true"
+		if machine.Annotations == nil {
+			machine.Annotations = map[string]string{}
+		}
+		machine.Annotations[machinecontroller.AnnotationPaused] = "true"
+
+		if err := createOrGet(ctx, client, machine); err != nil {
+			return fmt.Errorf("failed to create machine %s: %v", machine.Name, err)
+		}
+		if exported.InstanceID != "" && machine.UID != exported.UID {
+			previous := exported.Machine.DeepCopy()
+			previous.UID = exported.UID
+			if err := migrateUID(previous, machine.UID); err != nil {
+				return fmt.Errorf("failed to migrate instance %s of machine %s to the new UID: %v", exported.InstanceID, machine.Name, err)
+			}
+		}
+		if !paused {
+			unpause = append(unpause, machine)
+		}
+	}
+
+	for i := range bundle.MachineSets {
+		machineSet := bundle.MachineSets[i].DeepCopy()
+		setNamespace(&machineSet.ObjectMeta, namespace)
+		if err := createOrGet(ctx, client, machineSet); err != nil {
+			return fmt.Errorf("failed to create MachineSet %s: %v", machineSet.Name, err)
+		}
+	}
+	for i := range bundle.MachineDeployments {
+		machineDeployment := bundle.MachineDeployments[i].DeepCopy()
+		setNamespace(&machineDeployment.ObjectMeta, namespace)
+		if err := createOrGet(ctx, client, machineDeployment); err != nil {
+			return fmt.Errorf("failed to create MachineDeployment %s: %v", machineDeployment.Name, err)
+		}
+	}
+
+	// The MachineSets update the machines when adopting them
+	for _, machine := range unpause {
+		err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+			if err := client.Get(ctx, types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name}, machine); err != nil {
+				return err
+			}
+			delete(machine.Annotations, machinecontroller.AnnotationPaused)
+			return client.Update(ctx, machine)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to unpause machine %s: %v", machine.Name, err)
+		}
+	}
+	return nil
+}
+
+// createOrGet creates the object or, if it exists already, reads it into the given object
+func createOrGet(ctx context.Context, client ctrlruntimeclient.Client, object runtime.Object) error {
+	err := client.Create(ctx, object)
+	if !kerrors.IsAlreadyExists(err) {
+		return err
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return err
+	}
+	return client.Get(ctx, types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}, object)
+}
+
+func setNamespace(objectMeta *metav1.ObjectMeta, namespace string) {
+	if namespace != "" {
+		objectMeta.Namespace = namespace
+	}
+}
+
+// portableObjectMeta returns the name, namespace, labels, annotations and finalizers of the given metadata.
+// Owner references are dropped, as the UIDs of the owners differ in another cluster, the MachineDeployments
+// and MachineSets adopt their objects again.
+func portableObjectMeta(objectMeta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:        objectMeta.Name,
+		Namespace:   objectMeta.Namespace,
+		Labels:      objectMeta.Labels,
+		Annotations: objectMeta.Annotations,
+		Finalizers:  objectMeta.Finalizers,
+	}
+}
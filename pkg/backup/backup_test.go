@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	fakectrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeInstance struct {
+	id string
+}
+
+func (i fakeInstance) Name() string { return i.id }
+func (i fakeInstance) ID() string   { return i.id }
+func (i fakeInstance) Addresses() map[string]corev1.NodeAddressType {
+	return map[string]corev1.NodeAddressType{"192.168.0.1": corev1.NodeInternalIP}
+}
+func (i fakeInstance) Status() instance.Status { return instance.StatusRunning }
+
+func TestExportImport(t *testing.T) {
+	if err := clusterv1alpha1.SchemeBuilder.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatalf("failed to add clusterv1alpha1 to scheme: %v", err)
+	}
+
+	machineSet := &clusterv1alpha1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: "kube-system", UID: "machineset-uid", ResourceVersion: "7"},
+	}
+	machine := &clusterv1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "workers-abc",
+			Namespace:       "kube-system",
+			UID:             "old-uid",
+			ResourceVersion: "42",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "MachineSet", Name: "workers", UID: "machineset-uid"}},
+		},
+		Status: clusterv1alpha1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "node-abc"}},
+	}
+	source := fakectrlruntimeclient.NewFakeClient(machineSet, machine)
+
+	bundle, err := Export(context.Background(), source, "kube-system", func(m *clusterv1alpha1.Machine) (instance.Instance, error) {
+		return fakeInstance{id: "4711"}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if len(bundle.Machines) != 1 || len(bundle.MachineSets) != 1 {
+		t.Fatalf("expected 1 machine and 1 MachineSet, got %d and %d", len(bundle.Machines), len(bundle.MachineSets))
+	}
+	exported := bundle.Machines[0]
+	if exported.UID != "old-uid" || exported.InstanceID != "4711" || exported.NodeName != "node-abc" {
+		t.Errorf("unexpected state of the exported machine: %+v", exported)
+	}
+	if exported.Machine.UID != "" || exported.Machine.ResourceVersion != "" || len(exported.Machine.OwnerReferences) != 0 {
+		t.Errorf("expected the metadata of the exported machine to be portable, got %+v", exported.Machine.ObjectMeta)
+	}
+
+	target := fakectrlruntimeclient.NewFakeClient()
+	var migrated []types.UID
+	err = Import(context.Background(), target, bundle, "", func(m *clusterv1alpha1.Machine, newUID types.UID) error {
+		migrated = append(migrated, m.UID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	if len(migrated) != 1 || migrated[0] != "old-uid" {
+		t.Errorf("expected the instance of the machine with UID old-uid to be migrated, got %v", migrated)
+	}
+
+	imported := &clusterv1alpha1.Machine{}
+	if err := target.Get(context.Background(), types.NamespacedName{Namespace: "kube-system", Name: "workers-abc"}, imported); err != nil {
+		t.Fatalf("failed to get imported machine: %v", err)
+	}
+	if _, paused := imported.Annotations[machinecontroller.AnnotationPaused]; paused {
+		t.Errorf("expected the imported machine to be unpaused")
+	}
+	if err := target.Get(context.Background(), types.NamespacedName{Namespace: "kube-system", Name: "workers"}, &clusterv1alpha1.MachineSet{}); err != nil {
+		t.Errorf("failed to get imported MachineSet: %v", err)
+	}
+}
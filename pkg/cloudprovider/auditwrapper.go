@@ -0,0 +1,144 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/audit"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/tracing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type auditWrapper struct {
+	optionalForwarder
+	ctx      context.Context
+	name     providerconfigtypes.CloudProvider
+	resolver *providerconfig.ConfigVarResolver
+}
+
+// NewAuditingCloudProvider returns a wrapped cloudprovider which writes an audit record for each
+// creation and deletion of an instance, see audit.Write. The given context holds the span of the
+// reconciliation, whose trace is part of the records. The credentials resolved by the given resolver
+// of the cloud provider are redacted from the records.
+func NewAuditingCloudProvider(ctx context.Context, name providerconfigtypes.CloudProvider, actualProvider cloudprovidertypes.Provider, resolver *providerconfig.ConfigVarResolver) cloudprovidertypes.Provider {
+	return &auditWrapper{ctx: ctx, name: name, optionalForwarder: optionalForwarder{actualProvider: actualProvider}, resolver: resolver}
+}
+
+// record writes the audit record of the given action for the given machine
+func (w *auditWrapper) record(action string, machine *v1alpha1.Machine, instanceID, result string, err error) {
+	record := &audit.Record{
+		RequestID:  audit.NewRequestID(),
+		TraceID:    tracing.TraceID(w.ctx),
+		Machine:    machine.Namespace + "/" + machine.Name,
+		MachineUID: string(machine.UID),
+		Provider:   string(w.name),
+		Action:     action,
+		InstanceID: instanceID,
+		Result:     result,
+	}
+	if owner := metav1.GetControllerOf(machine); owner != nil {
+		record.Owner = owner.Kind + "/" + owner.Name
+	}
+	if err != nil {
+		record.Result = audit.ResultFailure
+		record.Error = providerconfig.RedactMessage(err.Error(), machine.Spec.ProviderSpec.Value, w.resolver.ResolvedSecrets()...)
+	}
+	audit.Write(record)
+}
+
+// AddDefaults just calls the underlying cloudproviders AddDefaults
+func (w *auditWrapper) AddDefaults(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, error) {
+	return w.actualProvider.AddDefaults(spec)
+}
+
+// Validate just calls the underlying cloudproviders Validate
+func (w *auditWrapper) Validate(spec v1alpha1.MachineSpec) error {
+	return w.actualProvider.Validate(spec)
+}
+
+// Get just calls the underlying cloudproviders Get
+func (w *auditWrapper) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	return w.actualProvider.Get(machine, data)
+}
+
+// GetCloudConfig just calls the underlying cloudproviders GetCloudConfig
+func (w *auditWrapper) GetCloudConfig(spec v1alpha1.MachineSpec) (string, string, error) {
+	return w.actualProvider.GetCloudConfig(spec)
+}
+
+// Create calls the underlying cloudproviders Create and writes an audit record
+func (w *auditWrapper) Create(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData, cloudConfig string) (instance.Instance, error) {
+	instance, err := w.actualProvider.Create(m, mcd, cloudConfig)
+	var instanceID string
+	if err == nil && instance != nil {
+		instanceID = instance.ID()
+	}
+	w.record(audit.ActionCreate, m, instanceID, audit.ResultSuccess, err)
+	return instance, err
+}
+
+// Cleanup calls the underlying cloudproviders Cleanup and writes an audit record
+func (w *auditWrapper) Cleanup(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData) (bool, error) {
+	completelyGone, err := w.actualProvider.Cleanup(m, mcd)
+	result := audit.ResultPending
+	if completelyGone {
+		result = audit.ResultSuccess
+	}
+	w.record(audit.ActionDelete, m, "", result, err)
+	return completelyGone, err
+}
+
+// MigrateUID just calls the underlying cloudproviders MigrateUID
+func (w *auditWrapper) MigrateUID(m *v1alpha1.Machine, new types.UID) error {
+	return w.actualProvider.MigrateUID(m, new)
+}
+
+// Update just calls the underlying cloudproviders Update
+func (w *auditWrapper) Update(m *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
+	return w.actualProvider.Update(m, data)
+}
+
+// AdoptInstance calls the underlying cloudproviders AdoptInstance and writes an audit record,
+// providers not implementing it can't take over instances
+func (w *auditWrapper) AdoptInstance(m *v1alpha1.Machine, instanceID string, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	adopter, ok := w.actualProvider.(cloudprovidertypes.InstanceAdopter)
+	if !ok {
+		return nil, cloudprovidererrors.ErrAdoptionNotSupported
+	}
+	instance, err := adopter.AdoptInstance(m, instanceID, data)
+	w.record(audit.ActionAdopt, m, instanceID, audit.ResultSuccess, err)
+	return instance, err
+}
+
+// MachineMetricsLabels just calls the underlying cloudproviders MachineMetricsLabels
+func (w *auditWrapper) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
+	return w.actualProvider.MachineMetricsLabels(machine)
+}
+
+// SetMetricsForMachines just calls the underlying cloudproviders SetMetricsForMachines
+func (w *auditWrapper) SetMetricsForMachines(machines v1alpha1.MachineList) error {
+	return w.actualProvider.SetMetricsForMachines(machines)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// InstanceCache holds the instances of machines as returned by the cloud providers, by the UID of the machine
+type InstanceCache struct {
+	cache *gocache.Cache
+}
+
+// NewInstanceCache returns an empty InstanceCache
+func NewInstanceCache() *InstanceCache {
+	return &InstanceCache{cache: gocache.New(gocache.NoExpiration, 5*time.Minute)}
+}
+
+// Get returns the cached instance of the machine with the given UID and whether it was found
+func (c *InstanceCache) Get(uid types.UID) (instance.Instance, bool) {
+	val, found := c.cache.Get(string(uid))
+	if !found {
+		return nil, false
+	}
+	cached, ok := val.(instance.Instance)
+	return cached, ok
+}
+
+// Set caches the instance of the machine with the given UID for the given TTL
+func (c *InstanceCache) Set(uid types.UID, cached instance.Instance, ttl time.Duration) {
+	c.cache.Set(string(uid), cached, ttl)
+}
+
+// Invalidate drops the cached instance of the machine with the given UID
+func (c *InstanceCache) Invalidate(uid types.UID) {
+	c.cache.Delete(string(uid))
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+const (
+	// ChaosMachineLabel opts a machine into the failure injection unless it applies to all machines
+	ChaosMachineLabel = "machine-controller.kubermatic.io/chaos"
+
+	ChaosOperationGet    = "get"
+	ChaosOperationCreate = "create"
+	ChaosOperationDelete = "delete"
+	ChaosOperationUpdate = "update"
+	ChaosOperationAdopt  = "adopt"
+)
+
+var chaosOperations = sets.NewString(ChaosOperationGet, ChaosOperationCreate, ChaosOperationDelete, ChaosOperationUpdate, ChaosOperationAdopt)
+
+// ChaosSettings configures the failures injected into the calls of the cloud providers, to test the retries,
+// garbage collection and remediation of the machine-controller before trusting it in production
+type ChaosSettings struct {
+	// ErrorRate is the share of calls, from 0 to 1, which fail without reaching the cloud provider
+	ErrorRate float64
+	// PartialFailureRate is the share of calls, from 0 to 1, which fail after the cloud provider carried them
+	// out, e.g. creations whose instance exists although an error is returned. Lookups never fail partially.
+	PartialFailureRate float64
+	// Latency is the maximum latency added to the calls, each call is delayed by a random share of it
+	Latency time.Duration
+	// Operations are the operations failures are injected into, all if empty
+	Operations sets.String
+	// AllMachines injects the failures into the calls for all machines instead of only the ones with the
+	// ChaosMachineLabel set to "true"
+	AllMachines bool
+}
+
+// ParseChaosSettings parses comma separated settings like errorRate=0.2,latency=10s,operations=create+delete.
+// The keys are errorRate, partialFailureRate, latency, operations, separated by +, and machines, which is either
+// labeled or all. An empty string disables the failure injection and returns nil.
+func ParseChaosSettings(value string) (*ChaosSettings, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	settings := &ChaosSettings{Operations: sets.NewString()}
+	for _, setting := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(setting), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("chaos setting %q is not key=value", setting)
+		}
+		key, val := parts[0], parts[1]
+		var err error
+		switch key {
+		case "errorRate":
+			settings.ErrorRate, err = parseRate(val)
+		case "partialFailureRate":
+			settings.PartialFailureRate, err = parseRate(val)
+		case "latency":
+			settings.Latency, err = time.ParseDuration(val)
+		case "operations":
+			for _, operation := range strings.Split(val, "+") {
+				if !chaosOperations.Has(operation) {
+					return nil, fmt.Errorf("unknown chaos operation %q, must be one of %v", operation, chaosOperations.List())
+				}
+				settings.Operations.Insert(operation)
+			}
+		case "machines":
+			if val != "labeled" && val != "all" {
+				return nil, fmt.Errorf("chaos machines must be labeled or all, got %q", val)
+			}
+			settings.AllMachines = val == "all"
+		default:
+			return nil, fmt.Errorf("unknown chaos setting %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid chaos setting %s: %v", key, err)
+		}
+	}
+	if settings.ErrorRate+settings.PartialFailureRate > 1 {
+		return nil, fmt.Errorf("errorRate and partialFailureRate must not exceed 1 together")
+	}
+	return settings, nil
+}
+
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("must be between 0 and 1, got %v", rate)
+	}
+	return rate, nil
+}
+
+// chaosRandom is the source of the failures, shared by all wrappers
+var chaosRandom = struct {
+	sync.Mutex
+	float64 func() float64
+}{float64: rand.New(rand.NewSource(time.Now().UnixNano())).Float64}
+
+func chaosFloat64() float64 {
+	chaosRandom.Lock()
+	defer chaosRandom.Unlock()
+	return chaosRandom.float64()
+}
+
+// chaosOutcome is what happens to a call
+type chaosOutcome int
+
+const (
+	chaosNone chaosOutcome = iota
+	chaosError
+	chaosPartialFailure
+)
+
+type chaosWrapper struct {
+	optionalForwarder
+	settings *ChaosSettings
+}
+
+// NewChaosCloudProvider returns a wrapped cloudprovider which injects errors, latency and partial failures into
+// the calls of the cloud provider as configured by the settings. It returns the given provider if settings is nil.
+func NewChaosCloudProvider(actualProvider cloudprovidertypes.Provider, settings *ChaosSettings) cloudprovidertypes.Provider {
+	if settings == nil {
+		return actualProvider
+	}
+	return &chaosWrapper{settings: settings, optionalForwarder: optionalForwarder{actualProvider: actualProvider}}
+}
+
+// inject delays the call of the operation and returns whether and how it fails
+func (w *chaosWrapper) inject(ctx context.Context, machine *v1alpha1.Machine, operation string) chaosOutcome {
+	if w.settings.Operations.Len() > 0 && !w.settings.Operations.Has(operation) {
+		return chaosNone
+	}
+	if !w.settings.AllMachines && (machine == nil || machine.Labels[ChaosMachineLabel] != "true") {
+		return chaosNone
+	}
+
+	if w.settings.Latency > 0 {
+		latency := time.Duration(chaosFloat64() * float64(w.settings.Latency))
+		klog.V(2).Infof("Chaos: delaying the %s call for machine %s by %v", operation, machine.Name, latency)
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+		}
+	}
+
+	switch roll := chaosFloat64(); {
+	case roll < w.settings.ErrorRate:
+		klog.Infof("Chaos: injecting an error into the %s call for machine %s", operation, machine.Name)
+		return chaosError
+	case roll < w.settings.ErrorRate+w.settings.PartialFailureRate && operation != ChaosOperationGet:
+		klog.Infof("Chaos: injecting a partial failure into the %s call for machine %s", operation, machine.Name)
+		return chaosPartialFailure
+	}
+	return chaosNone
+}
+
+func chaosErr(operation string, outcome chaosOutcome) error {
+	if outcome == chaosPartialFailure {
+		return fmt.Errorf("chaos: injected failure after the %s call succeeded", operation)
+	}
+	return fmt.Errorf("chaos: injected failure of the %s call", operation)
+}
+
+// AddDefaults just calls the underlying cloudproviders AddDefaults
+func (w *chaosWrapper) AddDefaults(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, error) {
+	return w.actualProvider.AddDefaults(spec)
+}
+
+// Validate just calls the underlying cloudproviders Validate
+func (w *chaosWrapper) Validate(spec v1alpha1.MachineSpec) error {
+	return w.actualProvider.Validate(spec)
+}
+
+// Get calls the underlying cloudproviders Get unless an error is injected
+func (w *chaosWrapper) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	if outcome := w.inject(data.Context(), machine, ChaosOperationGet); outcome != chaosNone {
+		return nil, chaosErr(ChaosOperationGet, outcome)
+	}
+	return w.actualProvider.Get(machine, data)
+}
+
+// GetCloudConfig just calls the underlying cloudproviders GetCloudConfig
+func (w *chaosWrapper) GetCloudConfig(spec v1alpha1.MachineSpec) (string, string, error) {
+	return w.actualProvider.GetCloudConfig(spec)
+}
+
+// Create calls the underlying cloudproviders Create unless an error is injected. Partial failures create the
+// instance and return an error anyway.
+func (w *chaosWrapper) Create(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData, cloudConfig string) (instance.Instance, error) {
+	outcome := w.inject(mcd.Context(), m, ChaosOperationCreate)
+	if outcome == chaosError {
+		return nil, chaosErr(ChaosOperationCreate, outcome)
+	}
+	instance, err := w.actualProvider.Create(m, mcd, cloudConfig)
+	if err == nil && outcome == chaosPartialFailure {
+		return nil, chaosErr(ChaosOperationCreate, outcome)
+	}
+	return instance, err
+}
+
+// Cleanup calls the underlying cloudproviders Cleanup unless an error is injected. Partial failures delete the
+// instance and return an error anyway.
+func (w *chaosWrapper) Cleanup(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData) (bool, error) {
+	outcome := w.inject(mcd.Context(), m, ChaosOperationDelete)
+	if outcome == chaosError {
+		return false, chaosErr(ChaosOperationDelete, outcome)
+	}
+	completelyGone, err := w.actualProvider.Cleanup(m, mcd)
+	if err == nil && outcome == chaosPartialFailure {
+		return false, chaosErr(ChaosOperationDelete, outcome)
+	}
+	return completelyGone, err
+}
+
+// MigrateUID just calls the underlying cloudproviders MigrateUID
+func (w *chaosWrapper) MigrateUID(m *v1alpha1.Machine, new types.UID) error {
+	return w.actualProvider.MigrateUID(m, new)
+}
+
+// Update calls the underlying cloudproviders Update unless an error is injected. Partial failures update the
+// instance and return an error anyway.
+func (w *chaosWrapper) Update(m *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
+	outcome := w.inject(data.Context(), m, ChaosOperationUpdate)
+	if outcome == chaosError {
+		return false, chaosErr(ChaosOperationUpdate, outcome)
+	}
+	done, err := w.actualProvider.Update(m, data)
+	if err == nil && outcome == chaosPartialFailure {
+		return false, chaosErr(ChaosOperationUpdate, outcome)
+	}
+	return done, err
+}
+
+// AdoptInstance calls the underlying cloudproviders AdoptInstance unless an error is injected, providers not
+// implementing it can't take over instances
+func (w *chaosWrapper) AdoptInstance(m *v1alpha1.Machine, instanceID string, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	adopter, ok := w.actualProvider.(cloudprovidertypes.InstanceAdopter)
+	if !ok {
+		return nil, cloudprovidererrors.ErrAdoptionNotSupported
+	}
+	outcome := w.inject(data.Context(), m, ChaosOperationAdopt)
+	if outcome == chaosError {
+		return nil, chaosErr(ChaosOperationAdopt, outcome)
+	}
+	instance, err := adopter.AdoptInstance(m, instanceID, data)
+	if err == nil && outcome == chaosPartialFailure {
+		return nil, chaosErr(ChaosOperationAdopt, outcome)
+	}
+	return instance, err
+}
+
+// MachineMetricsLabels just calls the underlying cloudproviders MachineMetricsLabels
+func (w *chaosWrapper) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
+	return w.actualProvider.MachineMetricsLabels(machine)
+}
+
+func (w *chaosWrapper) SetMetricsForMachines(machines v1alpha1.MachineList) error {
+	return w.actualProvider.SetMetricsForMachines(machines)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// countingProvider counts the creations which reached it, the other methods are not implemented
+type countingProvider struct {
+	cloudprovidertypes.Provider
+	creations int
+}
+
+func (p *countingProvider) Create(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData, _ string) (instance.Instance, error) {
+	p.creations++
+	return nil, nil
+}
+
+func TestParseChaosSettings(t *testing.T) {
+	settings, err := ParseChaosSettings("errorRate=0.2,partialFailureRate=0.1,latency=5s,operations=create+delete,machines=all")
+	if err != nil {
+		t.Fatalf("failed to parse the settings: %v", err)
+	}
+	if settings.ErrorRate != 0.2 || settings.PartialFailureRate != 0.1 || settings.Latency != 5*time.Second ||
+		!settings.Operations.HasAll(ChaosOperationCreate, ChaosOperationDelete) || settings.Operations.Len() != 2 || !settings.AllMachines {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+
+	if settings, err := ParseChaosSettings(""); settings != nil || err != nil {
+		t.Errorf("expected no settings for an empty string, got %+v, %v", settings, err)
+	}
+
+	for _, invalid := range []string{"errorRate", "errorRate=2", "errorRate=0.6,partialFailureRate=0.6", "operations=reboot", "machines=some", "foo=bar", "latency=soon"} {
+		if _, err := ParseChaosSettings(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestChaosCloudProvider(t *testing.T) {
+	defer func(original func() float64) { chaosRandom.float64 = original }(chaosRandom.float64)
+	labeled := &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "labeled", Labels: map[string]string{ChaosMachineLabel: "true"}}}
+	unlabeled := &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"}}
+
+	testCases := []struct {
+		name              string
+		settings          string
+		roll              float64
+		machine           *v1alpha1.Machine
+		expectError       bool
+		expectedCreations int
+	}{
+		{
+			name:              "error",
+			settings:          "errorRate=0.5,partialFailureRate=0.2",
+			roll:              0.4,
+			machine:           labeled,
+			expectError:       true,
+			expectedCreations: 0,
+		},
+		{
+			name:              "partial failure",
+			settings:          "errorRate=0.5,partialFailureRate=0.2",
+			roll:              0.6,
+			machine:           labeled,
+			expectError:       true,
+			expectedCreations: 1,
+		},
+		{
+			name:              "no failure",
+			settings:          "errorRate=0.5,partialFailureRate=0.2",
+			roll:              0.8,
+			machine:           labeled,
+			expectedCreations: 1,
+		},
+		{
+			name:              "unlabeled machine",
+			settings:          "errorRate=1",
+			machine:           unlabeled,
+			expectedCreations: 1,
+		},
+		{
+			name:              "all machines",
+			settings:          "errorRate=1,machines=all",
+			machine:           unlabeled,
+			expectError:       true,
+			expectedCreations: 0,
+		},
+		{
+			name:              "other operation",
+			settings:          "errorRate=1,operations=delete",
+			machine:           labeled,
+			expectedCreations: 1,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			settings, err := ParseChaosSettings(test.settings)
+			if err != nil {
+				t.Fatalf("failed to parse the settings: %v", err)
+			}
+			roll := test.roll
+			chaosRandom.float64 = func() float64 { return roll }
+			actual := &countingProvider{}
+
+			_, err = NewChaosCloudProvider(actual, settings).Create(test.machine, nil, "")
+			if (err != nil) != test.expectError {
+				t.Errorf("expected error %v, got %v", test.expectError, err)
+			}
+			if actual.creations != test.expectedCreations {
+				t.Errorf("expected %d creations, got %d", test.expectedCreations, actual.creations)
+			}
+		})
+	}
+}
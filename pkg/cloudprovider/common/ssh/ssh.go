@@ -17,17 +17,34 @@ limitations under the License.
 package ssh
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
+	"strings"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 
 	"github.com/pborman/uuid"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
 )
 
 const privateRSAKeyBitSize = 4096
 
+var (
+	// keyLock guards configuredKey and configuredKeyName, which change when the key gets rotated
+	keyLock sync.RWMutex
+	// configuredKey is returned by NewKey and NewRSAKey instead of a new key if set
+	configuredKey *Pubkey
+	// configuredKeyName is the name of configuredKey, a random one is used for every instance if empty
+	configuredKeyName string
+	// disabled is set if instances must not be accessible via SSH
+	disabled bool
+)
+
 // Pubkey is only used to create temporary keypairs, thus we
 // do not need the Private key
 // The reason for not hardcoding a random public key is that
@@ -36,9 +53,70 @@ type Pubkey struct {
 	Name           string
 	PublicKey      string
 	FingerprintMD5 string
+	// OperatorProvided is set for keys configured with SetKey. They may exist at the cloud
+	// provider already and are kept there, as other instances may be created with them concurrently
+	OperatorProvided bool
+
+	keyType string
+}
+
+// SetKey makes NewKey and NewRSAKey return the given key instead of creating a new one, so operators
+// can access instances with their own keypair. NewRSAKey still creates a new key if the given one is no
+// RSA key. The key is registered at cloud providers with the given name, or with random names if
+// it is empty. It may be called again when the key got rotated, instances which exist already keep the
+// previous key.
+func SetKey(key *Pubkey, name string) {
+	key.OperatorProvided = true
+	keyLock.Lock()
+	defer keyLock.Unlock()
+	configuredKey = key
+	configuredKeyName = name
 }
 
+// ClearKey drops the key configured with SetKey, so NewKey and NewRSAKey create new keys again.
+func ClearKey() {
+	keyLock.Lock()
+	defer keyLock.Unlock()
+	configuredKey = nil
+	configuredKeyName = ""
+}
+
+// Disable makes NewKey and NewRSAKey ignore the key configured with SetKey and MergeKeys drop all
+// additional keys, so nobody can access instances via SSH. Temporary keypairs are still created, as
+// some cloud providers would set a root password and send it to the account owner otherwise.
+func Disable() {
+	disabled = true
+}
+
+// Disabled returns whether instances must not be accessible via SSH.
+func Disabled() bool {
+	return disabled
+}
+
+// NewKey returns the public key of a new ed25519 keypair.
 func NewKey() (*Pubkey, error) {
+	if key := copyConfiguredKey(); key != nil {
+		return key, nil
+	}
+
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create private ed25519 key: %v", err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ssh public key: %v", err)
+	}
+	return newPubkey(sshPublicKey), nil
+}
+
+// NewRSAKey returns the public key of a new RSA keypair, for cloud providers which
+// do not accept ed25519 keys.
+func NewRSAKey() (*Pubkey, error) {
+	if key := copyConfiguredKey(); key != nil && key.keyType == ssh.KeyAlgoRSA {
+		return key, nil
+	}
+
 	tmpRSAKeyPair, err := rsa.GenerateKey(rand.Reader, privateRSAKeyBitSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create private RSA key: %v", err)
@@ -48,14 +126,93 @@ func NewKey() (*Pubkey, error) {
 		return nil, fmt.Errorf("failed to validate private RSA key: %v", err)
 	}
 
-	pubKey, err := ssh.NewPublicKey(&tmpRSAKeyPair.PublicKey)
+	sshPublicKey, err := ssh.NewPublicKey(&tmpRSAKeyPair.PublicKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ssh public key: %v", err)
 	}
+	return newPubkey(sshPublicKey), nil
+}
 
+// ParsePrivateKey returns the public key of the given PEM encoded private key, which may be in any
+// format ssh-keygen writes, e.g. PKCS1, PKCS8 or OpenSSH. Encrypted keys need the passphrase.
+func ParsePrivateKey(privateKey, passphrase []byte) (*Pubkey, error) {
+	var signer ssh.Signer
+	var err error
+	if len(passphrase) > 0 {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(privateKey, passphrase)
+	} else {
+		signer, err = ssh.ParsePrivateKey(privateKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	return newPubkey(signer.PublicKey()), nil
+}
+
+// ParsePublicKey returns the given public key in authorized_keys format.
+func ParsePublicKey(publicKey []byte) (*Pubkey, error) {
+	sshPublicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	return newPubkey(sshPublicKey), nil
+}
+
+// MergeKeys returns the public key of the given keypair followed by the given keys in authorized_keys
+// format, for cloud providers which register several keys for an instance. Duplicates and invalid keys
+// are skipped, as are keys not of the given types if any are given. All keys are skipped if SSH access
+// is disabled.
+func MergeKeys(key *Pubkey, keys []string, keyTypes ...string) []string {
+	merged := []string{strings.TrimSpace(key.PublicKey)}
+	if disabled {
+		return merged
+	}
+	seen := sets.NewString(merged[0])
+	for _, k := range keys {
+		publicKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
+		if err != nil {
+			klog.V(4).Infof("Skipping invalid ssh public key %q: %v", k, err)
+			continue
+		}
+		if len(keyTypes) > 0 && !sets.NewString(keyTypes...).Has(publicKey.Type()) {
+			continue
+		}
+		// The comment does not make keys different
+		authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+		if seen.Has(authorizedKey) {
+			continue
+		}
+		seen.Insert(authorizedKey)
+		if comment != "" {
+			authorizedKey += " " + comment
+		}
+		merged = append(merged, authorizedKey)
+	}
+	return merged
+}
+
+func newPubkey(publicKey ssh.PublicKey) *Pubkey {
 	return &Pubkey{
 		Name:           uuid.New(),
-		PublicKey:      string(ssh.MarshalAuthorizedKey(pubKey)),
-		FingerprintMD5: ssh.FingerprintLegacyMD5(pubKey),
-	}, nil
+		PublicKey:      string(ssh.MarshalAuthorizedKey(publicKey)),
+		FingerprintMD5: ssh.FingerprintLegacyMD5(publicKey),
+		keyType:        publicKey.Type(),
+	}
+}
+
+// copyConfiguredKey returns a copy of the configured key with its configured name or a new random
+// one, as some cloud providers require unique names. It returns nil if no key is configured or SSH
+// access is disabled.
+func copyConfiguredKey() *Pubkey {
+	keyLock.RLock()
+	defer keyLock.RUnlock()
+	if configuredKey == nil || disabled {
+		return nil
+	}
+	copied := *configuredKey
+	copied.Name = configuredKeyName
+	if copied.Name == "" {
+		copied.Name = uuid.New()
+	}
+	return &copied
 }
@@ -0,0 +1,293 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNewKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		newKey  func() (*Pubkey, error)
+		keyType string
+	}{
+		{
+			name:    "ed25519 key",
+			newKey:  NewKey,
+			keyType: ssh.KeyAlgoED25519,
+		},
+		{
+			name:    "rsa key",
+			newKey:  NewRSAKey,
+			keyType: ssh.KeyAlgoRSA,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := test.newKey()
+			if err != nil {
+				t.Fatalf("failed to create key: %v", err)
+			}
+			publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.PublicKey))
+			if err != nil {
+				t.Fatalf("failed to parse public key %q: %v", key.PublicKey, err)
+			}
+			if publicKey.Type() != test.keyType {
+				t.Errorf("expected key of type %s, but got %s", test.keyType, publicKey.Type())
+			}
+			if key.FingerprintMD5 != ssh.FingerprintLegacyMD5(publicKey) {
+				t.Errorf("expected fingerprint %s, but got %s", ssh.FingerprintLegacyMD5(publicKey), key.FingerprintMD5)
+			}
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to create rsa key: %v", err)
+	}
+	rsaPublicKey, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to create ssh public key: %v", err)
+	}
+	pkcs1Block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}
+	encryptedBlock, err := x509.EncryptPEMBlock(rand.Reader, pkcs1Block.Type, pkcs1Block.Bytes, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("failed to encrypt rsa key: %v", err)
+	}
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to create ed25519 key: %v", err)
+	}
+	ed25519PublicKey, err := ssh.NewPublicKey(ed25519Key.Public())
+	if err != nil {
+		t.Fatalf("failed to create ssh public key: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ed25519Key)
+	if err != nil {
+		t.Fatalf("failed to marshal ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		privateKey []byte
+		passphrase []byte
+		publicKey  ssh.PublicKey
+		err        bool
+	}{
+		{
+			name:       "pkcs1 rsa key",
+			privateKey: pem.EncodeToMemory(pkcs1Block),
+			publicKey:  rsaPublicKey,
+		},
+		{
+			name:       "encrypted rsa key",
+			privateKey: pem.EncodeToMemory(encryptedBlock),
+			passphrase: []byte("secret"),
+			publicKey:  rsaPublicKey,
+		},
+		{
+			name:       "encrypted rsa key with wrong passphrase",
+			privateKey: pem.EncodeToMemory(encryptedBlock),
+			passphrase: []byte("wrong"),
+			err:        true,
+		},
+		{
+			name:       "encrypted rsa key without passphrase",
+			privateKey: pem.EncodeToMemory(encryptedBlock),
+			err:        true,
+		},
+		{
+			name:       "pkcs8 ed25519 key",
+			privateKey: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+			publicKey:  ed25519PublicKey,
+		},
+		{
+			name:       "no key",
+			privateKey: []byte("foo"),
+			err:        true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := ParsePrivateKey(test.privateKey, test.passphrase)
+			if (err != nil) != test.err {
+				t.Fatalf("expected err to be %v, but got %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if expected := string(ssh.MarshalAuthorizedKey(test.publicKey)); key.PublicKey != expected {
+				t.Errorf("expected public key %q, but got %q", expected, key.PublicKey)
+			}
+		})
+	}
+}
+
+func TestSetKey(t *testing.T) {
+	defer func() {
+		configuredKey = nil
+		configuredKeyName = ""
+	}()
+
+	generated, err := NewKey()
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	configured, err := ParsePublicKey([]byte(generated.PublicKey))
+	if err != nil {
+		t.Fatalf("failed to parse public key: %v", err)
+	}
+	SetKey(configured, "")
+
+	key, err := NewKey()
+	if err != nil {
+		t.Fatalf("failed to get key: %v", err)
+	}
+	if key.PublicKey != generated.PublicKey || !key.OperatorProvided {
+		t.Errorf("expected the configured key, but got %q", key.PublicKey)
+	}
+	if key.Name == configured.Name {
+		t.Errorf("expected a new name for the key, but got %s again", key.Name)
+	}
+
+	// The configured key is no RSA key
+	rsaKey, err := NewRSAKey()
+	if err != nil {
+		t.Fatalf("failed to get rsa key: %v", err)
+	}
+	if rsaKey.PublicKey == generated.PublicKey || rsaKey.OperatorProvided {
+		t.Errorf("expected a new rsa key, but got the configured key")
+	}
+
+	SetKey(configured, "operator")
+	key, err = NewKey()
+	if err != nil {
+		t.Fatalf("failed to get key: %v", err)
+	}
+	if key.Name != "operator" {
+		t.Errorf("expected the configured name operator, but got %s", key.Name)
+	}
+
+	ClearKey()
+	key, err = NewKey()
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	if key.PublicKey == generated.PublicKey || key.OperatorProvided {
+		t.Errorf("expected a new key after clearing the configured key")
+	}
+}
+
+func TestMergeKeys(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	ed25519Key, err := NewKey()
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	rsaKey, err := NewRSAKey()
+	if err != nil {
+		t.Fatalf("failed to create rsa key: %v", err)
+	}
+	trimmed := func(k *Pubkey) string { return strings.TrimSpace(k.PublicKey) }
+
+	tests := []struct {
+		name     string
+		keys     []string
+		keyTypes []string
+		expected []string
+	}{
+		{
+			name:     "no keys",
+			expected: []string{trimmed(key)},
+		},
+		{
+			name:     "keys",
+			keys:     []string{trimmed(ed25519Key) + " alice@example.com", rsaKey.PublicKey},
+			expected: []string{trimmed(key), trimmed(ed25519Key) + " alice@example.com", trimmed(rsaKey)},
+		},
+		{
+			name:     "duplicate keys",
+			keys:     []string{trimmed(rsaKey), trimmed(rsaKey) + " bob@example.com", trimmed(key)},
+			expected: []string{trimmed(key), trimmed(rsaKey)},
+		},
+		{
+			name:     "invalid key",
+			keys:     []string{"ssh-rsa foo", trimmed(rsaKey)},
+			expected: []string{trimmed(key), trimmed(rsaKey)},
+		},
+		{
+			name:     "rsa keys only",
+			keys:     []string{trimmed(ed25519Key), trimmed(rsaKey)},
+			keyTypes: []string{ssh.KeyAlgoRSA},
+			expected: []string{trimmed(key), trimmed(rsaKey)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := MergeKeys(key, test.keys, test.keyTypes...)
+			if !reflect.DeepEqual(merged, test.expected) {
+				t.Errorf("expected keys %v, but got %v", test.expected, merged)
+			}
+		})
+	}
+}
+
+func TestDisable(t *testing.T) {
+	defer func() {
+		configuredKey = nil
+		disabled = false
+	}()
+
+	configured, err := NewKey()
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	SetKey(configured, "")
+	Disable()
+
+	key, err := NewKey()
+	if err != nil {
+		t.Fatalf("failed to get key: %v", err)
+	}
+	if key.PublicKey == configured.PublicKey || key.OperatorProvided {
+		t.Errorf("expected a temporary key, but got the configured key")
+	}
+
+	merged := MergeKeys(key, []string{configured.PublicKey})
+	if expected := []string{strings.TrimSpace(key.PublicKey)}; !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected keys %v, but got %v", expected, merged)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type deadlineWrapper struct {
+	optionalForwarder
+	ctx     context.Context
+	timeout time.Duration
+}
+
+// NewDeadlineCloudProvider returns a wrapped cloudprovider which passes a context to Get, Create, Cleanup and
+// Update that ends after the given timeout, or with the given context, usually the one of a reconciliation.
+// The providers use it for their API calls, so a hanging API can't block a worker indefinitely.
+// A timeout of 0 only passes the given context.
+func NewDeadlineCloudProvider(ctx context.Context, actualProvider cloudprovidertypes.Provider, timeout time.Duration) cloudprovidertypes.Provider {
+	return &deadlineWrapper{ctx: ctx, timeout: timeout, optionalForwarder: optionalForwarder{actualProvider: actualProvider}}
+}
+
+// withDeadline returns a copy of the given data with the context of a call, which must be cancelled once it returns
+func (w *deadlineWrapper) withDeadline(data *cloudprovidertypes.ProviderData) (*cloudprovidertypes.ProviderData, context.CancelFunc) {
+	ctx, cancel := w.ctx, context.CancelFunc(func() {})
+	if w.timeout > 0 {
+		ctx, cancel = context.WithTimeout(w.ctx, w.timeout)
+	}
+	callData := &cloudprovidertypes.ProviderData{Ctx: ctx}
+	if data != nil {
+		callData.Update = data.Update
+		callData.Client = data.Client
+	}
+	return callData, cancel
+}
+
+// wrapError states that a call failed due to its deadline, the errors of the providers often don't tell
+func (w *deadlineWrapper) wrapError(ctx context.Context, operation string, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if w.ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s of the instance did not finish within the reconcile timeout: %v", operation, err)
+	}
+	return fmt.Errorf("%s of the instance did not finish within %v: %v", operation, w.timeout, err)
+}
+
+// AddDefaults just calls the underlying cloudproviders AddDefaults
+func (w *deadlineWrapper) AddDefaults(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, error) {
+	return w.actualProvider.AddDefaults(spec)
+}
+
+// Validate just calls the underlying cloudproviders Validate
+func (w *deadlineWrapper) Validate(spec v1alpha1.MachineSpec) error {
+	return w.actualProvider.Validate(spec)
+}
+
+// Get calls the underlying cloudproviders Get with a deadline. Instances which are not found are returned as is,
+// so callers can still compare the error with ErrInstanceNotFound.
+func (w *deadlineWrapper) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	callData, cancel := w.withDeadline(data)
+	defer cancel()
+	instance, err := w.actualProvider.Get(machine, callData)
+	if err == cloudprovidererrors.ErrInstanceNotFound {
+		return instance, err
+	}
+	return instance, w.wrapError(callData.Ctx, "Getting", err)
+}
+
+// GetCloudConfig just calls the underlying cloudproviders GetCloudConfig
+func (w *deadlineWrapper) GetCloudConfig(spec v1alpha1.MachineSpec) (string, string, error) {
+	return w.actualProvider.GetCloudConfig(spec)
+}
+
+// Create calls the underlying cloudproviders Create with a deadline
+func (w *deadlineWrapper) Create(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData, cloudConfig string) (instance.Instance, error) {
+	callData, cancel := w.withDeadline(mcd)
+	defer cancel()
+	instance, err := w.actualProvider.Create(m, callData, cloudConfig)
+	return instance, w.wrapError(callData.Ctx, "Creation", err)
+}
+
+// Cleanup calls the underlying cloudproviders Cleanup with a deadline
+func (w *deadlineWrapper) Cleanup(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData) (bool, error) {
+	callData, cancel := w.withDeadline(mcd)
+	defer cancel()
+	completelyGone, err := w.actualProvider.Cleanup(m, callData)
+	return completelyGone, w.wrapError(callData.Ctx, "Deletion", err)
+}
+
+// MigrateUID just calls the underlying cloudproviders MigrateUID
+func (w *deadlineWrapper) MigrateUID(m *v1alpha1.Machine, new types.UID) error {
+	return w.actualProvider.MigrateUID(m, new)
+}
+
+// Update calls the underlying cloudproviders Update with a deadline
+func (w *deadlineWrapper) Update(m *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
+	callData, cancel := w.withDeadline(data)
+	defer cancel()
+	done, err := w.actualProvider.Update(m, callData)
+	return done, w.wrapError(callData.Ctx, "Update", err)
+}
+
+// AdoptInstance calls the underlying cloudproviders AdoptInstance with a deadline, providers not
+// implementing it can't take over instances
+func (w *deadlineWrapper) AdoptInstance(m *v1alpha1.Machine, instanceID string, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	adopter, ok := w.actualProvider.(cloudprovidertypes.InstanceAdopter)
+	if !ok {
+		return nil, cloudprovidererrors.ErrAdoptionNotSupported
+	}
+	callData, cancel := w.withDeadline(data)
+	defer cancel()
+	instance, err := adopter.AdoptInstance(m, instanceID, callData)
+	return instance, w.wrapError(callData.Ctx, "Adoption", err)
+}
+
+// MachineMetricsLabels just calls the underlying cloudproviders MachineMetricsLabels
+func (w *deadlineWrapper) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
+	return w.actualProvider.MachineMetricsLabels(machine)
+}
+
+func (w *deadlineWrapper) SetMetricsForMachines(machines v1alpha1.MachineList) error {
+	return w.actualProvider.SetMetricsForMachines(machines)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+)
+
+// hangingProvider blocks in Create until the context of the call ends, the other methods are not implemented
+type hangingProvider struct {
+	cloudprovidertypes.Provider
+}
+
+func (hangingProvider) Create(_ *v1alpha1.Machine, data *cloudprovidertypes.ProviderData, _ string) (instance.Instance, error) {
+	<-data.Context().Done()
+	return nil, data.Context().Err()
+}
+
+func TestDeadlineCloudProvider(t *testing.T) {
+	prov := NewDeadlineCloudProvider(context.Background(), hangingProvider{}, 10*time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		_, err := prov.Create(&v1alpha1.Machine{}, nil, "")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "did not finish within 10ms") {
+			t.Errorf("expected the creation to time out, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("creation did not return after its deadline")
+	}
+}
+
+func TestDeadlineCloudProviderEndsWithParentContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	prov := NewDeadlineCloudProvider(ctx, hangingProvider{}, time.Hour)
+
+	_, err := prov.Create(&v1alpha1.Machine{}, nil, "")
+	if err == nil || !strings.Contains(err.Error(), "reconcile timeout") {
+		t.Errorf("expected the creation to end with the reconcile timeout, got %v", err)
+	}
+}
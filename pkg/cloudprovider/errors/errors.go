@@ -19,6 +19,7 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
 )
@@ -26,6 +27,22 @@ import (
 var (
 	// ErrInstanceNotFound tells that the requested instance was not found on the cloud provider
 	ErrInstanceNotFound = errors.New("instance not found")
+
+	// ErrUpdateNotSupported tells that the cloud provider can not update instances in-place
+	ErrUpdateNotSupported = errors.New("in-place update not supported")
+
+	// ErrAdoptionNotSupported tells that the cloud provider can not take over existing instances
+	ErrAdoptionNotSupported = errors.New("adoption of existing instances not supported")
+
+	// ErrInstanceTypeResolutionNotSupported tells that the cloud provider can not pick instance types
+	// from resource requirements
+	ErrInstanceTypeResolutionNotSupported = errors.New("instance type resolution not supported")
+
+	// ErrCapacityCheckNotSupported tells that the cloud provider can not check the quotas of the account
+	ErrCapacityCheckNotSupported = errors.New("capacity check not supported")
+
+	// ErrPricingNotSupported tells that the cloud provider does not publish the prices of its instance types
+	ErrPricingNotSupported = errors.New("pricing not supported")
 )
 
 func IsNotFound(err error) bool {
@@ -50,3 +67,64 @@ func IsTerminalError(err error) (bool, common.MachineStatusError, string) {
 	}
 	return true, tError.Reason, tError.Message
 }
+
+// classifications are the substrings of the lower-cased errors of the cloud providers and SDKs which
+// tell that retrying doesn't help, by the reason they are classified as. Errors of providers which
+// return typed errors are classified by the providers themselves.
+var classifications = []struct {
+	reason    common.MachineStatusError
+	fragments []string
+}{
+	{
+		reason: common.InvalidCredentialsMachineError,
+		fragments: []string{
+			"authfailure", "unauthorized", "invalidclienttokenid", "signaturedoesnotmatch", "invalid credentials",
+			"authentication failed", "invalid_grant", "invalid authentication token", "unable to authenticate",
+		},
+	},
+	{
+		reason: common.QuotaExceededMachineError,
+		fragments: []string{
+			"quota exceeded", "quotaexceeded", "quota_exceeded", "exceeded quota", "limitexceeded",
+			"resource_limit_exceeded", "operationnotallowed",
+		},
+	},
+	{
+		reason: common.InsufficientCapacityMachineError,
+		fragments: []string{
+			"insufficientinstancecapacity", "zone_resource_pool_exhausted", "skunotavailable", "allocationfailed",
+			"out of stock", "no valid host was found", "insufficient capacity",
+		},
+	},
+}
+
+// Classify returns a TerminalError for errors of the cloud providers which can't be resolved by retrying,
+// classified as InvalidCredentials, QuotaExceeded or InsufficientCapacity. Other errors, including ones
+// which are terminal already, are returned as they are.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	if ok, _, _ := IsTerminalError(err); ok {
+		return err
+	}
+	message := strings.ToLower(err.Error())
+	for _, classification := range classifications {
+		for _, fragment := range classification.fragments {
+			if strings.Contains(message, fragment) {
+				return TerminalError{Reason: classification.reason, Message: err.Error()}
+			}
+		}
+	}
+	return err
+}
+
+// IsClassified returns whether the given reason is one of the reasons errors get classified as, see Classify
+func IsClassified(reason common.MachineStatusError) bool {
+	for _, classification := range classifications {
+		if classification.reason == reason {
+			return true
+		}
+	}
+	return false
+}
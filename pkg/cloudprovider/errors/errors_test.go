@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errors
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedReason common.MachineStatusError
+	}{
+		{
+			name:           "azure quota",
+			err:            errors.New("compute.VirtualMachinesClient#CreateOrUpdate: Code=\"OperationNotAllowed\" Message=\"Operation results in exceeding quota limits of Core\""),
+			expectedReason: common.QuotaExceededMachineError,
+		},
+		{
+			name:           "gce capacity",
+			err:            errors.New("googleapi: Error 503: The zone does not have enough resources available, ZONE_RESOURCE_POOL_EXHAUSTED"),
+			expectedReason: common.InsufficientCapacityMachineError,
+		},
+		{
+			name:           "hetzner token",
+			err:            errors.New("failed to get server: unable to authenticate (unauthorized)"),
+			expectedReason: common.InvalidCredentialsMachineError,
+		},
+		{
+			name: "transient error",
+			err:  errors.New("dial tcp: i/o timeout"),
+		},
+		{
+			name: "instance not found",
+			err:  ErrInstanceNotFound,
+		},
+		{
+			name:           "terminal error",
+			err:            TerminalError{Reason: common.InvalidConfigurationMachineError, Message: "unknown instance type, quota exceeded"},
+			expectedReason: common.InvalidConfigurationMachineError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			classified := Classify(test.err)
+			terminal, reason, _ := IsTerminalError(classified)
+			if test.expectedReason == "" {
+				if classified != test.err {
+					t.Errorf("expected the error to be returned as is, got %v", classified)
+				}
+				return
+			}
+			if !terminal || reason != test.expectedReason {
+				t.Errorf("expected a terminal error with reason %s, got %v", test.expectedReason, classified)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+)
+
+// optionalForwarder implements the optional interfaces of cloud providers for the wrappers embedding it by
+// calling the wrapped provider, or returning the not supported error of the interface if the wrapped provider
+// doesn't implement it. Wrappers only override the methods they add behavior to.
+type optionalForwarder struct {
+	actualProvider cloudprovidertypes.Provider
+}
+
+// ValidateUpdate calls the underlying cloudproviders ValidateUpdate, providers not implementing it
+// can't apply any change in place
+func (f optionalForwarder) ValidateUpdate(oldSpec, newSpec v1alpha1.MachineSpec) error {
+	if validator, ok := f.actualProvider.(cloudprovidertypes.UpdateValidator); ok {
+		return validator.ValidateUpdate(oldSpec, newSpec)
+	}
+	return cloudprovidererrors.ErrUpdateNotSupported
+}
+
+// AdoptInstance calls the underlying cloudproviders AdoptInstance, providers not implementing it
+// can't take over instances
+func (f optionalForwarder) AdoptInstance(m *v1alpha1.Machine, instanceID string, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	if adopter, ok := f.actualProvider.(cloudprovidertypes.InstanceAdopter); ok {
+		return adopter.AdoptInstance(m, instanceID, data)
+	}
+	return nil, cloudprovidererrors.ErrAdoptionNotSupported
+}
+
+// ResolveInstanceType calls the underlying cloudproviders ResolveInstanceType, providers not
+// implementing it can't pick instance types
+func (f optionalForwarder) ResolveInstanceType(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, string, error) {
+	if resolver, ok := f.actualProvider.(cloudprovidertypes.InstanceTypeResolver); ok {
+		return resolver.ResolveInstanceType(spec)
+	}
+	return spec, "", cloudprovidererrors.ErrInstanceTypeResolutionNotSupported
+}
+
+// CheckCapacity calls the underlying cloudproviders CheckCapacity, providers not implementing it
+// can't check the quotas of the account
+func (f optionalForwarder) CheckCapacity(spec v1alpha1.MachineSpec, count int) error {
+	if checker, ok := f.actualProvider.(cloudprovidertypes.CapacityChecker); ok {
+		return checker.CheckCapacity(spec, count)
+	}
+	return cloudprovidererrors.ErrCapacityCheckNotSupported
+}
+
+// HourlyPrice calls the underlying cloudproviders HourlyPrice, providers not implementing it
+// don't publish their prices
+func (f optionalForwarder) HourlyPrice(spec v1alpha1.MachineSpec) (float64, string, error) {
+	if pricer, ok := f.actualProvider.(cloudprovidertypes.InstancePricer); ok {
+		return pricer.HourlyPrice(spec)
+	}
+	return 0, "", cloudprovidererrors.ErrPricingNotSupported
+}
@@ -16,7 +16,11 @@ limitations under the License.
 
 package instance
 
-import v1 "k8s.io/api/core/v1"
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
 
 // Instance represents a instance on the cloud provider
 type Instance interface {
@@ -24,12 +28,47 @@ type Instance interface {
 	Name() string
 	// ID returns the instance identifier.
 	ID() string
-	// Addresses returns a list of addresses associated with the instance.
+	// Addresses returns the addresses associated with the instance along with their type,
+	// e.g. InternalIP for addresses of the private network and ExternalIP for public ones.
 	Addresses() map[string]v1.NodeAddressType
 	// Status returns the instance status.
 	Status() Status
 }
 
+// ProviderIDInstance is implemented by instances whose provider ID, as set on their node by the cloud
+// controller manager, consists of more than the instance ID.
+type ProviderIDInstance interface {
+	// ProviderID returns the provider ID of the node of the instance.
+	ProviderID() string
+}
+
+// InterruptibleInstance is implemented by instances which may be reclaimed by the cloud provider, like
+// spot or preemptible instances.
+type InterruptibleInstance interface {
+	// Interrupted returns whether the cloud provider is reclaiming the instance.
+	Interrupted() bool
+}
+
+// MetadataInstance is implemented by instances whose cloud provider reports metadata for inventory tooling.
+type MetadataInstance interface {
+	// Metadata returns the metadata of the instance.
+	Metadata() Metadata
+}
+
+// Metadata of an instance, empty fields are not reported by the cloud provider.
+type Metadata struct {
+	// Image is the name or ID of the image the instance was created from.
+	Image string
+	// Created is when the cloud provider created the instance.
+	Created time.Time
+	// Location is the region, zone or datacenter of the instance.
+	Location string
+	// Host identifies the hypervisor or dedicated host the instance runs on.
+	Host string
+	// Tags are the tags or labels of the instance, e.g. for cost allocation.
+	Tags map[string]string
+}
+
 // Status represents the instance status.
 type Status string
 
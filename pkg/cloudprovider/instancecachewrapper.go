@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidercache "github.com/kubermatic/machine-controller/pkg/cloudprovider/cache"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+var (
+	instances = cloudprovidercache.NewInstanceCache()
+
+	instanceCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "machine_controller_instance_cache_requests_total",
+		Help: "The lookups of instances in the instance cache by result, hit or miss",
+	}, []string{"result"})
+)
+
+type instanceCachingWrapper struct {
+	optionalForwarder
+	ttl time.Duration
+}
+
+// NewInstanceCachingCloudProvider returns a wrapped cloudprovider which caches the instances returned by Get for
+// the given TTL, so repeated reconciliations don't look them up at the cloud provider each time. The instance of a
+// machine is dropped from the cache once it gets created, updated or cleaned up. Errors are never cached. A TTL of
+// 0 disables the cache.
+func NewInstanceCachingCloudProvider(actualProvider cloudprovidertypes.Provider, ttl time.Duration) cloudprovidertypes.Provider {
+	if ttl <= 0 {
+		return actualProvider
+	}
+	return &instanceCachingWrapper{optionalForwarder: optionalForwarder{actualProvider: actualProvider}, ttl: ttl}
+}
+
+// AddDefaults just calls the underlying cloudproviders AddDefaults
+func (w *instanceCachingWrapper) AddDefaults(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, error) {
+	return w.actualProvider.AddDefaults(spec)
+}
+
+// Validate just calls the underlying cloudproviders Validate
+func (w *instanceCachingWrapper) Validate(spec v1alpha1.MachineSpec) error {
+	return w.actualProvider.Validate(spec)
+}
+
+// Get returns the cached instance of the machine if there is one, otherwise it calls the underlying
+// cloudproviders Get and caches the instance
+func (w *instanceCachingWrapper) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	if cached, found := instances.Get(machine.UID); found {
+		klog.V(6).Infof("Got cache hit for the instance of machine %s", machine.Name)
+		instanceCacheRequests.WithLabelValues("hit").Inc()
+		return cached, nil
+	}
+
+	klog.V(6).Infof("Got cache miss for the instance of machine %s", machine.Name)
+	instanceCacheRequests.WithLabelValues("miss").Inc()
+	instance, err := w.actualProvider.Get(machine, data)
+	if err == nil {
+		instances.Set(machine.UID, instance, w.ttl)
+	}
+	return instance, err
+}
+
+// GetCloudConfig just calls the underlying cloudproviders GetCloudConfig
+func (w *instanceCachingWrapper) GetCloudConfig(spec v1alpha1.MachineSpec) (string, string, error) {
+	return w.actualProvider.GetCloudConfig(spec)
+}
+
+// Create drops the cached instance of the machine and calls the underlying cloudproviders Create
+func (w *instanceCachingWrapper) Create(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData, cloudConfig string) (instance.Instance, error) {
+	instances.Invalidate(m.UID)
+	return w.actualProvider.Create(m, mcd, cloudConfig)
+}
+
+// Cleanup drops the cached instance of the machine and calls the underlying cloudproviders Cleanup
+func (w *instanceCachingWrapper) Cleanup(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData) (bool, error) {
+	instances.Invalidate(m.UID)
+	return w.actualProvider.Cleanup(m, mcd)
+}
+
+// MigrateUID drops the cached instance of the machine and calls the underlying cloudproviders MigrateUID
+func (w *instanceCachingWrapper) MigrateUID(m *v1alpha1.Machine, new types.UID) error {
+	instances.Invalidate(m.UID)
+	instances.Invalidate(new)
+	return w.actualProvider.MigrateUID(m, new)
+}
+
+// Update drops the cached instance of the machine and calls the underlying cloudproviders Update
+func (w *instanceCachingWrapper) Update(m *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
+	instances.Invalidate(m.UID)
+	return w.actualProvider.Update(m, data)
+}
+
+// AdoptInstance drops the cached instance of the machine and calls the underlying cloudproviders
+// AdoptInstance, providers not implementing it can't take over instances
+func (w *instanceCachingWrapper) AdoptInstance(m *v1alpha1.Machine, instanceID string, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	instances.Invalidate(m.UID)
+	if adopter, ok := w.actualProvider.(cloudprovidertypes.InstanceAdopter); ok {
+		return adopter.AdoptInstance(m, instanceID, data)
+	}
+	return nil, cloudprovidererrors.ErrAdoptionNotSupported
+}
+
+// MachineMetricsLabels just calls the underlying cloudproviders MachineMetricsLabels
+func (w *instanceCachingWrapper) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
+	return w.actualProvider.MachineMetricsLabels(machine)
+}
+
+// SetMetricsForMachines just calls the underlying cloudproviders SetMetricsForMachines
+func (w *instanceCachingWrapper) SetMetricsForMachines(machines v1alpha1.MachineList) error {
+	return w.actualProvider.SetMetricsForMachines(machines)
+}
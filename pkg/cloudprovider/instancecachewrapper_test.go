@@ -0,0 +1,100 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type cachedInstance struct{}
+
+func (cachedInstance) Name() string                                 { return "instance" }
+func (cachedInstance) ID() string                                   { return "1" }
+func (cachedInstance) Addresses() map[string]corev1.NodeAddressType { return nil }
+func (cachedInstance) Status() instance.Status                      { return instance.StatusRunning }
+
+// countingProvider counts the lookups of instances, the other methods are not implemented
+type countingProvider struct {
+	cloudprovidertypes.Provider
+	gets int
+	err  error
+}
+
+func (p *countingProvider) Get(*v1alpha1.Machine, *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	p.gets++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return cachedInstance{}, nil
+}
+
+func (p *countingProvider) Create(*v1alpha1.Machine, *cloudprovidertypes.ProviderData, string) (instance.Instance, error) {
+	return cachedInstance{}, nil
+}
+
+func TestInstanceCachingCloudProvider(t *testing.T) {
+	actual := &countingProvider{}
+	prov := NewInstanceCachingCloudProvider(actual, time.Hour)
+	machine := &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine-1", UID: "instance-cache-1"}}
+
+	for i := 0; i < 3; i++ {
+		if _, err := prov.Get(machine, nil); err != nil {
+			t.Fatalf("failed to get instance: %v", err)
+		}
+	}
+	if actual.gets != 1 {
+		t.Errorf("expected the instance to be looked up once, got %d lookups", actual.gets)
+	}
+
+	if _, err := prov.Create(machine, nil, ""); err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	if _, err := prov.Get(machine, nil); err != nil {
+		t.Fatalf("failed to get instance: %v", err)
+	}
+	if actual.gets != 2 {
+		t.Errorf("expected the instance to be looked up again after its creation, got %d lookups", actual.gets)
+	}
+}
+
+func TestInstanceCachingCloudProviderSkipsErrors(t *testing.T) {
+	actual := &countingProvider{err: errors.New("request timed out")}
+	prov := NewInstanceCachingCloudProvider(actual, time.Hour)
+	machine := &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine-2", UID: "instance-cache-2"}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := prov.Get(machine, nil); err == nil {
+			t.Fatal("expected the error of the cloud provider")
+		}
+	}
+	if actual.gets != 2 {
+		t.Errorf("expected errors not to be cached, got %d lookups", actual.gets)
+	}
+
+	if disabled := NewInstanceCachingCloudProvider(actual, 0); disabled != actual {
+		t.Errorf("expected the provider to be returned as is with a TTL of 0, got %T", disabled)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	cloudProviderErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "machine_controller_cloud_provider_errors_total",
+		Help: "The total number of failed calls to the cloud providers by provider and operation",
+	}, []string{"provider", "operation"})
+	cloudProviderOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "machine_controller_cloud_provider_operation_duration_seconds",
+		Help:    "The duration of the calls to the cloud providers by provider and operation, which may send several requests",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 14),
+	}, []string{"provider", "operation"})
+	cloudProviderOperationsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "machine_controller_cloud_provider_operations_in_flight",
+		Help: "The calls to the cloud providers which did not return yet by provider and operation, including the ones the reconciliation gave up on",
+	}, []string{"provider", "operation"})
+)
+
+// RegisterMetrics registers the metrics of the calls to the cloud providers, the requests to their APIs and the
+// instance cache
+func RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(cloudProviderErrors, cloudProviderOperationDuration, cloudProviderOperationsInFlight, instanceCacheRequests)
+	registerer.MustRegister(cloudproviderutil.HTTPMetrics()...)
+}
+
+type metricsWrapper struct {
+	optionalForwarder
+	name providerconfigtypes.CloudProvider
+}
+
+// NewMetricsCloudProvider returns a wrapped cloudprovider which records the duration and the failures
+// of the calls to the cloud provider
+func NewMetricsCloudProvider(name providerconfigtypes.CloudProvider, actualProvider cloudprovidertypes.Provider) cloudprovidertypes.Provider {
+	return &metricsWrapper{name: name, optionalForwarder: optionalForwarder{actualProvider: actualProvider}}
+}
+
+// start records the start of a call of the given operation and returns the time it started at
+func (w *metricsWrapper) start(operation string) time.Time {
+	cloudProviderOperationsInFlight.WithLabelValues(string(w.name), operation).Inc()
+	return time.Now()
+}
+
+// observe records a call of the given operation which started at start
+func (w *metricsWrapper) observe(operation string, start time.Time, err error) {
+	cloudProviderOperationsInFlight.WithLabelValues(string(w.name), operation).Dec()
+	cloudProviderOperationDuration.WithLabelValues(string(w.name), operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		cloudProviderErrors.WithLabelValues(string(w.name), operation).Inc()
+	}
+}
+
+// AddDefaults just calls the underlying cloudproviders AddDefaults
+func (w *metricsWrapper) AddDefaults(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, error) {
+	return w.actualProvider.AddDefaults(spec)
+}
+
+// Validate calls the underlying cloudproviders Validate and records it
+func (w *metricsWrapper) Validate(spec v1alpha1.MachineSpec) error {
+	start := w.start("validate")
+	err := w.actualProvider.Validate(spec)
+	w.observe("validate", start, err)
+	return err
+}
+
+// Get calls the underlying cloudproviders Get and records it. Instances which are not found
+// are expected, e.g. before they got created, so they don't count as errors.
+func (w *metricsWrapper) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	start := w.start("get")
+	instance, err := w.actualProvider.Get(machine, data)
+	if err == cloudprovidererrors.ErrInstanceNotFound {
+		w.observe("get", start, nil)
+	} else {
+		w.observe("get", start, err)
+	}
+	return instance, err
+}
+
+// GetCloudConfig just calls the underlying cloudproviders GetCloudConfig
+func (w *metricsWrapper) GetCloudConfig(spec v1alpha1.MachineSpec) (string, string, error) {
+	return w.actualProvider.GetCloudConfig(spec)
+}
+
+// Create calls the underlying cloudproviders Create and records it
+func (w *metricsWrapper) Create(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData, cloudConfig string) (instance.Instance, error) {
+	start := w.start("create")
+	instance, err := w.actualProvider.Create(m, mcd, cloudConfig)
+	w.observe("create", start, err)
+	return instance, err
+}
+
+// Cleanup calls the underlying cloudproviders Cleanup and records it
+func (w *metricsWrapper) Cleanup(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData) (bool, error) {
+	start := w.start("cleanup")
+	completelyGone, err := w.actualProvider.Cleanup(m, mcd)
+	w.observe("cleanup", start, err)
+	return completelyGone, err
+}
+
+// MigrateUID calls the underlying cloudproviders MigrateUID and records it
+func (w *metricsWrapper) MigrateUID(m *v1alpha1.Machine, new types.UID) error {
+	start := w.start("migrate_uid")
+	err := w.actualProvider.MigrateUID(m, new)
+	w.observe("migrate_uid", start, err)
+	return err
+}
+
+// Update calls the underlying cloudproviders Update and records it
+func (w *metricsWrapper) Update(m *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
+	start := w.start("update")
+	done, err := w.actualProvider.Update(m, data)
+	w.observe("update", start, err)
+	return done, err
+}
+
+// AdoptInstance calls the underlying cloudproviders AdoptInstance and records it, providers not
+// implementing it can't take over instances
+func (w *metricsWrapper) AdoptInstance(m *v1alpha1.Machine, instanceID string, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	adopter, ok := w.actualProvider.(cloudprovidertypes.InstanceAdopter)
+	if !ok {
+		return nil, cloudprovidererrors.ErrAdoptionNotSupported
+	}
+	start := w.start("adopt")
+	instance, err := adopter.AdoptInstance(m, instanceID, data)
+	w.observe("adopt", start, err)
+	return instance, err
+}
+
+// MachineMetricsLabels just calls the underlying cloudproviders MachineMetricsLabels
+func (w *metricsWrapper) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
+	return w.actualProvider.MachineMetricsLabels(machine)
+}
+
+// ResolveInstanceType calls the underlying cloudproviders ResolveInstanceType and records it, providers
+// not implementing it can't pick instance types
+func (w *metricsWrapper) ResolveInstanceType(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, string, error) {
+	resolver, ok := w.actualProvider.(cloudprovidertypes.InstanceTypeResolver)
+	if !ok {
+		return spec, "", cloudprovidererrors.ErrInstanceTypeResolutionNotSupported
+	}
+	start := w.start("resolve_instance_type")
+	resolved, instanceType, err := resolver.ResolveInstanceType(spec)
+	w.observe("resolve_instance_type", start, err)
+	return resolved, instanceType, err
+}
+
+// CheckCapacity calls the underlying cloudproviders CheckCapacity and records it, providers not
+// implementing it can't check the quotas of the account
+func (w *metricsWrapper) CheckCapacity(spec v1alpha1.MachineSpec, count int) error {
+	checker, ok := w.actualProvider.(cloudprovidertypes.CapacityChecker)
+	if !ok {
+		return cloudprovidererrors.ErrCapacityCheckNotSupported
+	}
+	start := w.start("check_capacity")
+	err := checker.CheckCapacity(spec, count)
+	w.observe("check_capacity", start, err)
+	return err
+}
+
+// HourlyPrice calls the underlying cloudproviders HourlyPrice and records it, providers not implementing
+// it don't publish their prices
+func (w *metricsWrapper) HourlyPrice(spec v1alpha1.MachineSpec) (float64, string, error) {
+	pricer, ok := w.actualProvider.(cloudprovidertypes.InstancePricer)
+	if !ok {
+		return 0, "", cloudprovidererrors.ErrPricingNotSupported
+	}
+	start := w.start("hourly_price")
+	price, currency, err := pricer.HourlyPrice(spec)
+	w.observe("hourly_price", start, err)
+	return price, currency, err
+}
+
+func (w *metricsWrapper) SetMetricsForMachines(machines v1alpha1.MachineList) error {
+	return w.actualProvider.SetMetricsForMachines(machines)
+}
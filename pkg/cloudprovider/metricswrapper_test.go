@@ -0,0 +1,54 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+)
+
+func TestMetricsCloudProviderOperationsInFlight(t *testing.T) {
+	prov := NewMetricsCloudProvider("test", hangingProvider{})
+	inFlight := cloudProviderOperationsInFlight.WithLabelValues("test", "create")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_, _ = prov.Create(&v1alpha1.Machine{}, &cloudprovidertypes.ProviderData{Ctx: ctx}, "")
+		close(done)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for testutil.ToFloat64(inFlight) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the hanging creation to be in flight")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+	if count := testutil.ToFloat64(inFlight); count != 0 {
+		t.Errorf("expected no creation to be in flight once it returned, got %v", count)
+	}
+}
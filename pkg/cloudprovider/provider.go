@@ -92,9 +92,9 @@ var (
 )
 
 // ForProvider returns a CloudProvider actuator for the requested provider
-func ForProvider(p providerconfigtypes.CloudProvider, cvr *providerconfig.ConfigVarResolver) (cloudprovidertypes.Provider, error) {
-	if p, found := providers[p]; found {
-		return NewValidationCacheWrappingCloudProvider(p(cvr)), nil
+func ForProvider(providerName providerconfigtypes.CloudProvider, cvr *providerconfig.ConfigVarResolver) (cloudprovidertypes.Provider, error) {
+	if p, found := providers[providerName]; found {
+		return NewValidationCacheWrappingCloudProvider(NewMetricsCloudProvider(providerName, p(cvr))), nil
 	}
 	return nil, ErrProviderNotFound
 }
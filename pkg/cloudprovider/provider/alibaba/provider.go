@@ -36,9 +36,11 @@ import (
 	kuberneteshelper "github.com/kubermatic/machine-controller/pkg/kubernetes"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/userdata/convert"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 const (
@@ -115,35 +117,35 @@ func (p *provider) Validate(machineSpec v1alpha1.MachineSpec) error {
 	}
 
 	if c.AccessKeyID == "" {
-		return errors.New("accessKeyID is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("accessKeyID"), "")
 	}
 	if c.AccessKeySecret == "" {
-		return errors.New("accessKeySecret is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("accessKeySecret"), "")
 	}
 	if c.RegionID == "" {
-		return errors.New("regionID is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("regionID"), "")
 	}
 	if c.InstanceType == "" {
-		return errors.New("instanceType is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("instanceType"), "")
 	}
 	if c.VSwitchID == "" {
-		return errors.New("vSwitchID is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("vSwitchID"), "")
 	}
 	if c.InternetMaxBandwidthOut == "" {
-		return errors.New("internetMaxBandwidthOut is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("internetMaxBandwidthOut"), "")
 	}
 	if c.ZoneID == "" {
-		return errors.New("zoneID is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("zoneID"), "")
 	}
 	_, err = p.getImageIDForOS(machineSpec, pc.OperatingSystem)
 	if err != nil {
 		return fmt.Errorf("invalid/not supported operating system specified %q: %v", pc.OperatingSystem, err)
 	}
 	if c.DiskType == "" {
-		return errors.New("DiskType is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("diskType"), "")
 	}
 	if c.DiskSize == "" {
-		return errors.New("DiskSize is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("diskSize"), "")
 	}
 
 	return nil
@@ -222,6 +224,10 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 	createInstanceRequest.InstanceType = c.InstanceType
 	createInstanceRequest.VSwitchId = c.VSwitchID
 	createInstanceRequest.InternetMaxBandwidthOut = requests.Integer(c.InternetMaxBandwidthOut)
+	userdata, err = convert.GzipCloudInit(pc.OperatingSystem, userdata)
+	if err != nil {
+		return nil, err
+	}
 	encodedUserData := base64.StdEncoding.EncodeToString([]byte(userdata))
 	createInstanceRequest.UserData = encodedUserData
 	createInstanceRequest.SystemDiskCategory = c.DiskType
@@ -337,6 +343,10 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) SetMetricsForMachines(machines v1alpha1.MachineList) error {
 	return nil
 }
@@ -357,11 +367,12 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 	}
 
 	c := Config{}
-	c.AccessKeyID, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.AccessKeyID, "ALIBABA_ACCESS_KEY_ID")
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.AccessKeyID, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.AccessKeyID, "ALIBABA_ACCESS_KEY_ID")
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"AccessKeyID\" field, error = %v", err)
 	}
-	c.AccessKeySecret, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.AccessKeySecret, "ALIBABA_ACCESS_KEY_SECRET")
+	c.AccessKeySecret, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.AccessKeySecret, "ALIBABA_ACCESS_KEY_SECRET")
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"AccessKeySecret\" field, error = %v", err)
 	}
@@ -35,11 +35,13 @@ import (
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
 	anxtypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/anexia/types"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 type Config struct {
@@ -72,7 +74,8 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 	}
 
 	c := Config{}
-	c.Token, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.Token, anxtypes.AnxTokenEnv)
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pConfig.CredentialProfile)
+	c.Token, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.Token, anxtypes.AnxTokenEnv)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get 'token': %v", err)
 	}
@@ -117,37 +120,37 @@ func (p *provider) Validate(machinespec v1alpha1.MachineSpec) error {
 	}
 
 	if config.Token == "" {
-		return errors.New("token is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("token"), "")
 	}
 
 	if config.CPUs == 0 {
-		return errors.New("cpu count is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("cpus"), "")
 	}
 
 	if config.DiskSize == 0 {
-		return errors.New("disk size is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("diskSize"), "")
 	}
 
 	if config.Memory == 0 {
-		return errors.New("memory size is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("memory"), "")
 	}
 
 	if config.LocationID == "" {
-		return errors.New("location id is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("locationID"), "")
 	}
 
 	if config.TemplateID == "" {
-		return errors.New("template id is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("templateID"), "")
 	}
 
 	if config.VlanID == "" {
-		return errors.New("vlan id is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("vlanID"), "")
 	}
 
 	return nil
 }
 
-func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+func (p *provider) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
 	config, _, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, newError(common.InvalidConfigurationMachineError, "failed to parse MachineSpec: %v", err)
@@ -162,7 +165,7 @@ func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provider
 		return nil, cloudprovidererrors.ErrInstanceNotFound
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), anxtypes.GetRequestTimeout)
+	ctx, cancel := context.WithTimeout(data.Context(), anxtypes.GetRequestTimeout)
 	defer cancel()
 
 	info, err := apiClient.VSphere().Info().Get(ctx, status.InstanceID)
@@ -187,7 +190,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, providerData *cloudprovider
 	}
 
 	apiClient := getClient(config.Token)
-	ctx, cancel := context.WithTimeout(context.Background(), anxtypes.CreateRequestTimeout)
+	ctx, cancel := context.WithTimeout(providerData.Context(), anxtypes.CreateRequestTimeout)
 	defer cancel()
 
 	status, err := getStatus(machine.Status.ProviderStatus)
@@ -226,7 +229,8 @@ func (p *provider) Create(machine *v1alpha1.Machine, providerData *cloudprovider
 			[]byte(fmt.Sprintf("anexia: true\n\n%s", userdata)),
 		)
 
-		sshKey, err := ssh.NewKey()
+		// The provisioning API of Anexia is not documented to accept ed25519 keys
+		sshKey, err := ssh.NewRSAKey()
 		if err != nil {
 			return nil, newError(common.CreateMachineError, "failed to generate ssh key: %v", err)
 		}
@@ -257,7 +261,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, providerData *cloudprovider
 	return p.Get(machine, providerData)
 }
 
-func (p *provider) Cleanup(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
 	config, _, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return false, newError(common.InvalidConfigurationMachineError, "failed to parse MachineSpec: %v", err)
@@ -269,7 +273,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, _ *cloudprovidertypes.Prov
 		return false, newError(common.InvalidConfigurationMachineError, "failed to get machine status: %v", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), anxtypes.DeleteRequestTimeout)
+	ctx, cancel := context.WithTimeout(data.Context(), anxtypes.DeleteRequestTimeout)
 	defer cancel()
 
 	err = apiClient.VSphere().Provisioning().VM().Deprovision(ctx, status.InstanceID, false)
@@ -297,6 +301,10 @@ func (p *provider) MigrateUID(_ *v1alpha1.Machine, _ k8stypes.UID) error {
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
 	return map[string]string{}, nil
 }
@@ -306,7 +314,7 @@ func (p *provider) SetMetricsForMachines(machine v1alpha1.MachineList) error {
 }
 
 func getClient(token string) anx.API {
-	client := anxclient.NewTokenClient(token, nil)
+	client := anxclient.NewTokenClient(token, &http.Client{Transport: cloudproviderutil.NewTransport("anexia", nil, token)})
 	return anx.NewAPI(client)
 }
 
@@ -21,6 +21,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -40,6 +42,7 @@ import (
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
 	awstypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/aws/types"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 	"github.com/kubermatic/machine-controller/pkg/userdata/convert"
@@ -79,6 +82,9 @@ const (
 	machineUIDTag = "Machine-UID"
 
 	maxRetries = 100
+
+	// spotInstanceTerminationReason is the state reason of spot instances reclaimed by AWS
+	spotInstanceTerminationReason = "Server.SpotInstanceTermination"
 )
 
 var (
@@ -126,6 +132,39 @@ var (
 			// The AWS marketplace ID from AWS
 			owner: "075585003325",
 		},
+		providerconfigtypes.OperatingSystemRockyLinux: {
+			description: "Rocky-8-ec2-8*",
+			// The AWS marketplace ID from the Rocky Enterprise Software Foundation
+			owner: "792107900819",
+		},
+		providerconfigtypes.OperatingSystemAlmaLinux: {
+			description: "Official AlmaLinux OS 8*",
+			// The AWS marketplace ID from AlmaLinux
+			owner: "764336703387",
+		},
+		providerconfigtypes.OperatingSystemAmazonLinux2023: {
+			// Be as precise as possible - otherwise we might get the minimal image
+			description: "Amazon Linux 2023 AMI * x86_64 HVM kernel-*",
+			// The AWS marketplace ID from Amazon
+			owner: "137112412989",
+		},
+		providerconfigtypes.OperatingSystemFedoraCoreOS: {
+			description: "Fedora CoreOS stable*",
+			// The AWS account ID from the Fedora CoreOS project
+			owner: "125523088429",
+		},
+		providerconfigtypes.OperatingSystemOpenSUSE: {
+			// Be as precise as possible - otherwise we might get a nightly dev build
+			description: "openSUSE Leap 15.2 (HVM, 64-bit, SSD-Backed)",
+			// The AWS marketplace ID from SUSE
+			owner: "013907871322",
+		},
+		providerconfigtypes.OperatingSystemWindows: {
+			// Be as precise as possible - otherwise we might get an image without the containers feature
+			description: "Microsoft Windows Server 2019 Core with Containers Locale English AMI provided by Amazon",
+			// The AWS marketplace ID from Amazon
+			owner: "801119661308",
+		},
 	}
 
 	// cacheLock protects concurrent cache misses against a single key. This usually happens when multiple machines get created simultaneously
@@ -145,6 +184,8 @@ type Config struct {
 	SecurityGroupIDs   []string
 	InstanceProfile    string
 	IsSpotInstance     *bool
+	SpotMaxPrice       string
+	PlacementGroup     string
 	InstanceType       string
 	AMI                string
 	DiskSize           int64
@@ -253,6 +294,18 @@ func getDefaultRootDevicePath(os providerconfigtypes.OperatingSystem) (string, e
 		return rootDevicePathUbuntuCentOSRHEL, nil
 	case providerconfigtypes.OperatingSystemFlatcar:
 		return rootDevicePathCoreOSSLES, nil
+	case providerconfigtypes.OperatingSystemRockyLinux:
+		return rootDevicePathUbuntuCentOSRHEL, nil
+	case providerconfigtypes.OperatingSystemAlmaLinux:
+		return rootDevicePathUbuntuCentOSRHEL, nil
+	case providerconfigtypes.OperatingSystemAmazonLinux2023:
+		return rootDevicePathCoreOSSLES, nil
+	case providerconfigtypes.OperatingSystemFedoraCoreOS:
+		return rootDevicePathCoreOSSLES, nil
+	case providerconfigtypes.OperatingSystemOpenSUSE:
+		return rootDevicePathCoreOSSLES, nil
+	case providerconfigtypes.OperatingSystemWindows:
+		return rootDevicePathUbuntuCentOSRHEL, nil
 	}
 
 	return "", fmt.Errorf("no default root path found for %s operating system", os)
@@ -272,11 +325,12 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 		return nil, nil, nil, fmt.Errorf("failed to unmarshal: %v", err)
 	}
 	c := Config{}
-	c.AccessKeyID, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.AccessKeyID, "AWS_ACCESS_KEY_ID")
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.AccessKeyID, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.AccessKeyID, "AWS_ACCESS_KEY_ID")
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get the value of \"accessKeyId\" field, error = %v", err)
 	}
-	c.SecretAccessKey, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.SecretAccessKey, "AWS_SECRET_ACCESS_KEY")
+	c.SecretAccessKey, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.SecretAccessKey, "AWS_SECRET_ACCESS_KEY")
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get the value of \"secretAccessKey\" field, error = %v", err)
 	}
@@ -338,6 +392,14 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 	}
 	c.Tags = rawConfig.Tags
 	c.IsSpotInstance = rawConfig.IsSpotInstance
+	c.SpotMaxPrice, err = p.configVarResolver.GetConfigVarStringValue(rawConfig.SpotMaxPrice)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	c.PlacementGroup, err = p.configVarResolver.GetConfigVarStringValue(rawConfig.PlacementGroup)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	c.AssignPublicIP = rawConfig.AssignPublicIP
 
 	return &c, &pconfig, &rawConfig, err
@@ -348,6 +410,7 @@ func getSession(id, secret, token, region string) (*session.Session, error) {
 	config = config.WithRegion(region)
 	config = config.WithCredentials(credentials.NewStaticCredentials(id, secret, token))
 	config = config.WithMaxRetries(maxRetries)
+	config = config.WithHTTPClient(&http.Client{Transport: cloudproviderutil.NewTransport("aws", nil, id, region)})
 	return session.NewSession(config)
 }
 
@@ -400,6 +463,15 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 		return fmt.Errorf("instanceType must be specified")
 	}
 
+	if config.SpotMaxPrice != "" {
+		if config.IsSpotInstance == nil || !*config.IsSpotInstance {
+			return fmt.Errorf("spotMaxPrice requires isSpotInstance")
+		}
+		if price, err := strconv.ParseFloat(config.SpotMaxPrice, 64); err != nil || price <= 0 {
+			return fmt.Errorf("spotMaxPrice must be a positive price in USD per hour, e.g. 0.05, got %q", config.SpotMaxPrice)
+		}
+	}
+
 	// Not the best test as the minimum disk size depends on the AMI
 	// but the best we can do here
 	if config.DiskSize == 0 {
@@ -428,6 +500,13 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 		return fmt.Errorf("invalid zone %q specified: %v", config.AvailabilityZone, err)
 	}
 
+	if config.PlacementGroup != "" {
+		_, err = ec2Client.DescribePlacementGroups(&ec2.DescribePlacementGroupsInput{GroupNames: aws.StringSlice([]string{config.PlacementGroup})})
+		if err != nil {
+			return fmt.Errorf("invalid placement group %q specified: %v", config.PlacementGroup, err)
+		}
+	}
+
 	_, err = ec2Client.DescribeRegions(&ec2.DescribeRegionsInput{RegionNames: aws.StringSlice([]string{config.Region})})
 	if err != nil {
 		return fmt.Errorf("invalid region %q specified: %v", config.Region, err)
@@ -505,13 +584,9 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 		}
 	}
 
-	if pc.OperatingSystem != providerconfigtypes.OperatingSystemCoreos &&
-		pc.OperatingSystem != providerconfigtypes.OperatingSystemFlatcar {
-		// Gzip the userdata in case we don't use CoreOS and Flatcar
-		userdata, err = convert.GzipString(userdata)
-		if err != nil {
-			return nil, fmt.Errorf("failed to gzip the userdata")
-		}
+	userdata, err = convert.GzipCloudInit(pc.OperatingSystem, userdata)
+	if err != nil {
+		return nil, err
 	}
 
 	tags := []*ec2.Tag{
@@ -535,12 +610,24 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 	var instanceMarketOptions *ec2.InstanceMarketOptionsRequest
 	if config.IsSpotInstance != nil && *config.IsSpotInstance {
 		instanceMarketOptions = &ec2.InstanceMarketOptionsRequest{MarketType: aws.String(ec2.MarketTypeSpot)}
+		// Without a max price the on-demand price is the limit
+		if config.SpotMaxPrice != "" {
+			instanceMarketOptions.SpotOptions = &ec2.SpotMarketOptions{MaxPrice: aws.String(config.SpotMaxPrice)}
+		}
 	}
 
 	// By default we assign a public IP - We introduced this field later, so we made it a pointer & default to true.
 	// This must be done aside from the webhook defaulting as we might have machines which don't get defaulted before this
 	assignPublicIP := config.AssignPublicIP == nil || *config.AssignPublicIP
 
+	placement := &ec2.Placement{
+		AvailabilityZone: aws.String(config.AvailabilityZone),
+	}
+	// The group must already exist, its strategy decides whether the instances are spread or clustered
+	if config.PlacementGroup != "" {
+		placement.GroupName = aws.String(config.PlacementGroup)
+	}
+
 	instanceRequest := &ec2.RunInstancesInput{
 		ImageId:               aws.String(amiID),
 		InstanceMarketOptions: instanceMarketOptions,
@@ -560,9 +647,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 		MinCount:     aws.Int64(1),
 		InstanceType: aws.String(config.InstanceType),
 		UserData:     aws.String(base64.StdEncoding.EncodeToString([]byte(userdata))),
-		Placement: &ec2.Placement{
-			AvailabilityZone: aws.String(config.AvailabilityZone),
-		},
+		Placement:    placement,
 		NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{
 			{
 				DeviceIndex:              aws.Int64(0), // eth0
@@ -747,6 +832,10 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 type awsInstance struct {
 	instance *ec2.Instance
 }
@@ -759,6 +848,31 @@ func (d *awsInstance) ID() string {
 	return aws.StringValue(d.instance.InstanceId)
 }
 
+// ProviderID returns the provider ID the AWS cloud provider sets on the node of the instance,
+// which includes its availability zone.
+func (d *awsInstance) ProviderID() string {
+	if d.instance.Placement == nil || aws.StringValue(d.instance.Placement.AvailabilityZone) == "" {
+		return ""
+	}
+	return fmt.Sprintf("aws:///%s/%s", aws.StringValue(d.instance.Placement.AvailabilityZone), aws.StringValue(d.instance.InstanceId))
+}
+
+// Interrupted returns whether AWS is reclaiming the spot instance, which it stops or terminates
+// two minutes after the interruption notice
+func (d *awsInstance) Interrupted() bool {
+	if aws.StringValue(d.instance.InstanceLifecycle) != ec2.InstanceLifecycleTypeSpot {
+		return false
+	}
+	if d.instance.StateReason != nil && aws.StringValue(d.instance.StateReason.Code) == spotInstanceTerminationReason {
+		return true
+	}
+	switch aws.StringValue(d.instance.State.Name) {
+	case ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped:
+		return true
+	}
+	return false
+}
+
 func (d *awsInstance) Addresses() map[string]v1.NodeAddressType {
 	addresses := map[string]v1.NodeAddressType{
 		aws.StringValue(d.instance.PublicIpAddress):  v1.NodeExternalIP,
@@ -772,6 +886,25 @@ func (d *awsInstance) Addresses() map[string]v1.NodeAddressType {
 	return addresses
 }
 
+// Metadata returns the AMI, launch time, availability zone, dedicated host and tags of the instance
+func (d *awsInstance) Metadata() instance.Metadata {
+	metadata := instance.Metadata{
+		Image: aws.StringValue(d.instance.ImageId),
+		Tags:  map[string]string{},
+	}
+	if d.instance.LaunchTime != nil {
+		metadata.Created = *d.instance.LaunchTime
+	}
+	if d.instance.Placement != nil {
+		metadata.Location = aws.StringValue(d.instance.Placement.AvailabilityZone)
+		metadata.Host = aws.StringValue(d.instance.Placement.HostId)
+	}
+	for _, tag := range d.instance.Tags {
+		metadata.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return metadata
+}
+
 func (d *awsInstance) Status() instance.Status {
 	switch *d.instance.State.Name {
 	case ec2.InstanceStateNameRunning:
@@ -812,16 +945,20 @@ func awsErrorToTerminalError(err error, msg string) error {
 			return prepareAndReturnError()
 		}
 		switch aerr.Code() {
-		case "InstanceLimitExceeded":
+		case "InstanceLimitExceeded", "VcpuLimitExceeded":
 			return cloudprovidererrors.TerminalError{
-				Reason:  common.InsufficientResourcesMachineError,
+				Reason:  common.QuotaExceededMachineError,
 				Message: "You've reached the AWS quota for number of instances of this type",
 			}
-		case "AuthFailure":
+		case "InsufficientInstanceCapacity":
+			return cloudprovidererrors.TerminalError{
+				Reason:  common.InsufficientCapacityMachineError,
+				Message: "AWS has no capacity for instances of this type in the availability zone right now",
+			}
+		case "AuthFailure", "UnauthorizedOperation":
 			// authorization primitives come from MachineSpec
-			// thus we are setting InvalidConfigurationMachineError
 			return cloudprovidererrors.TerminalError{
-				Reason:  common.InvalidConfigurationMachineError,
+				Reason:  common.InvalidCredentialsMachineError,
 				Message: "A request has been rejected due to invalid credentials which were taken from the MachineSpec",
 			}
 		case "OptInRequired":
@@ -888,24 +1025,27 @@ func (p *provider) SetMetricsForMachines(machines v1alpha1.MachineList) error {
 
 	}
 
-	allReservations := []*ec2.Reservation{}
+	// The instances are counted page by page instead of keeping all reservations of the account
+	instanceCounts := map[string]float64{}
 	for _, cred := range credentials {
 		ec2Client, err := getEC2client(cred.acccessKeyID, cred.secretAccessKey, cred.region)
 		if err != nil {
 			errors = append(errors, fmt.Errorf("failed to get EC2 client: %v", err))
 			continue
 		}
-		inOut, err := ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{})
+		err = ec2Client.DescribeInstancesPages(&ec2.DescribeInstancesInput{}, func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+			countInstancesByMachineUID(page.Reservations, instanceCounts)
+			return true
+		})
 		if err != nil {
 			errors = append(errors, fmt.Errorf("failed to get EC2 instances: %v", err))
 			continue
 		}
-		allReservations = append(allReservations, inOut.Reservations...)
 	}
 
 	for _, machine := range machines.Items {
 		metricInstancesForMachines.WithLabelValues(fmt.Sprintf("%s/%s", machine.Namespace, machine.Name)).Set(
-			getIntanceCountForMachine(machine, allReservations))
+			instanceCounts[string(machine.UID)])
 	}
 
 	if len(errors) > 0 {
@@ -915,8 +1055,9 @@ func (p *provider) SetMetricsForMachines(machines v1alpha1.MachineList) error {
 	return nil
 }
 
-func getIntanceCountForMachine(machine v1alpha1.Machine, reservations []*ec2.Reservation) float64 {
-	var count float64
+// countInstancesByMachineUID adds the instances of the given reservations which are not terminated to the
+// counts of the machine UIDs they are tagged with
+func countInstancesByMachineUID(reservations []*ec2.Reservation, counts map[string]float64) {
 	for _, reservation := range reservations {
 		for _, i := range reservation.Instances {
 			if i.State == nil ||
@@ -930,14 +1071,11 @@ func getIntanceCountForMachine(machine v1alpha1.Machine, reservations []*ec2.Res
 					continue
 				}
 
-				if *tag.Value == string(machine.UID) {
-					count = count + 1
-				}
+				counts[*tag.Value]++
 				break
 			}
 		}
 	}
-	return count
 }
 
 func filterSupportedRHELImages(images []*ec2.Image) ([]*ec2.Image, error) {
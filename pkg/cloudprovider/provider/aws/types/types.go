@@ -31,6 +31,8 @@ type RawConfig struct {
 	SecurityGroupIDs   []providerconfigtypes.ConfigVarString `json:"securityGroupIDs,omitempty"`
 	InstanceProfile    providerconfigtypes.ConfigVarString   `json:"instanceProfile,omitempty"`
 	IsSpotInstance     *bool                                 `json:"isSpotInstance,omitempty"`
+	SpotMaxPrice       providerconfigtypes.ConfigVarString   `json:"spotMaxPrice,omitempty"`
+	PlacementGroup     providerconfigtypes.ConfigVarString   `json:"placementGroup,omitempty"`
 	InstanceType       providerconfigtypes.ConfigVarString   `json:"instanceType,omitempty"`
 	AMI                providerconfigtypes.ConfigVarString   `json:"ami,omitempty"`
 	DiskSize           int64                                 `json:"diskSize"`
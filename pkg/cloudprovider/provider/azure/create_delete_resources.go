@@ -294,6 +294,7 @@ func createOrUpdateNetworkInterface(ctx context.Context, ifName string, machineU
 		}
 		secGroupClient := network.NewSecurityGroupsClient(config.SubscriptionID)
 		secGroupClient.Authorizer = authorizer
+		secGroupClient.Sender = newSender(config)
 		secGroup, err := secGroupClient.Get(ctx, config.ResourceGroup, config.SecurityGroupName, "")
 		if err != nil {
 			return nil, fmt.Errorf("failed to get securityGroup %q: %v", config.SecurityGroupName, err)
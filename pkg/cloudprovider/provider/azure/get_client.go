@@ -18,15 +18,24 @@ package azure
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-06-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-06-01/network"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
+
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 )
 
+// newSender returns the sender of the clients, which rate limits the requests and records their metrics
+func newSender(c *config) *http.Client {
+	return &http.Client{Transport: cloudproviderutil.NewTransport("azure", nil, c.SubscriptionID, c.TenantID, c.ClientID)}
+}
+
 func getIPClient(c *config) (*network.PublicIPAddressesClient, error) {
 	var err error
 	ipClient := network.NewPublicIPAddressesClient(c.SubscriptionID)
+	ipClient.Sender = newSender(c)
 	ipClient.Authorizer, err = auth.NewClientCredentialsConfig(c.ClientID, c.ClientSecret, c.TenantID).Authorizer()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create authorizer: %s", err.Error())
@@ -38,6 +47,7 @@ func getIPClient(c *config) (*network.PublicIPAddressesClient, error) {
 func getIPConfigClient(c *config) (*network.InterfaceIPConfigurationsClient, error) {
 	var err error
 	ipConfigClient := network.NewInterfaceIPConfigurationsClient(c.SubscriptionID)
+	ipConfigClient.Sender = newSender(c)
 	ipConfigClient.Authorizer, err = auth.NewClientCredentialsConfig(c.ClientID, c.ClientSecret, c.TenantID).Authorizer()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create authorizer: %s", err.Error())
@@ -49,6 +59,7 @@ func getIPConfigClient(c *config) (*network.InterfaceIPConfigurationsClient, err
 func getSubnetsClient(c *config) (*network.SubnetsClient, error) {
 	var err error
 	subnetClient := network.NewSubnetsClient(c.SubscriptionID)
+	subnetClient.Sender = newSender(c)
 	subnetClient.Authorizer, err = auth.NewClientCredentialsConfig(c.ClientID, c.ClientSecret, c.TenantID).Authorizer()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create authorizer: %s", err.Error())
@@ -60,6 +71,7 @@ func getSubnetsClient(c *config) (*network.SubnetsClient, error) {
 func getVirtualNetworksClient(c *config) (*network.VirtualNetworksClient, error) {
 	var err error
 	virtualNetworksClient := network.NewVirtualNetworksClient(c.SubscriptionID)
+	virtualNetworksClient.Sender = newSender(c)
 	virtualNetworksClient.Authorizer, err = auth.NewClientCredentialsConfig(c.ClientID, c.ClientSecret, c.TenantID).Authorizer()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create authorizer: %v", err)
@@ -70,6 +82,7 @@ func getVirtualNetworksClient(c *config) (*network.VirtualNetworksClient, error)
 func getVMClient(c *config) (*compute.VirtualMachinesClient, error) {
 	var err error
 	vmClient := compute.NewVirtualMachinesClient(c.SubscriptionID)
+	vmClient.Sender = newSender(c)
 	vmClient.Authorizer, err = auth.NewClientCredentialsConfig(c.ClientID, c.ClientSecret, c.TenantID).Authorizer()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create authorizer: %s", err.Error())
@@ -81,6 +94,7 @@ func getVMClient(c *config) (*compute.VirtualMachinesClient, error) {
 func getInterfacesClient(c *config) (*network.InterfacesClient, error) {
 	var err error
 	ifClient := network.NewInterfacesClient(c.SubscriptionID)
+	ifClient.Sender = newSender(c)
 	ifClient.Authorizer, err = auth.NewClientCredentialsConfig(c.ClientID, c.ClientSecret, c.TenantID).Authorizer()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create authorizer: %s", err.Error())
@@ -92,6 +106,7 @@ func getInterfacesClient(c *config) (*network.InterfacesClient, error) {
 func getDisksClient(c *config) (*compute.DisksClient, error) {
 	var err error
 	disksClient := compute.NewDisksClient(c.SubscriptionID)
+	disksClient.Sender = newSender(c)
 	disksClient.Authorizer, err = auth.NewClientCredentialsConfig(c.ClientID, c.ClientSecret, c.TenantID).Authorizer()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create authorizer: %s", err.Error())
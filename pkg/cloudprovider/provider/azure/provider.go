@@ -18,15 +18,16 @@ package azure
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2018-06-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2018-06-01/network"
 	"github.com/Azure/go-autorest/autorest/to"
+	gossh "golang.org/x/crypto/ssh"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
@@ -39,9 +40,11 @@ import (
 	kuberneteshelper "github.com/kubermatic/machine-controller/pkg/kubernetes"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/userdata/convert"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog"
 	"k8s.io/utils/pointer"
 )
@@ -147,6 +150,30 @@ var imageReferences = map[providerconfigtypes.OperatingSystem]compute.ImageRefer
 		Sku:       to.StringPtr("stable"),
 		Version:   to.StringPtr("2345.3.0"),
 	},
+	providerconfigtypes.OperatingSystemRockyLinux: {
+		Publisher: to.StringPtr("erockyenterprisesoftwarefoundationinc1653071250513"),
+		Offer:     to.StringPtr("rockylinux"),
+		Sku:       to.StringPtr("free"),
+		Version:   to.StringPtr("latest"),
+	},
+	providerconfigtypes.OperatingSystemAlmaLinux: {
+		Publisher: to.StringPtr("almalinux"),
+		Offer:     to.StringPtr("almalinux"),
+		Sku:       to.StringPtr("8_5"),
+		Version:   to.StringPtr("latest"),
+	},
+	providerconfigtypes.OperatingSystemSLES: {
+		Publisher: to.StringPtr("SUSE"),
+		Offer:     to.StringPtr("sles-15-sp1"),
+		Sku:       to.StringPtr("gen1"),
+		Version:   to.StringPtr("latest"),
+	},
+	providerconfigtypes.OperatingSystemOpenSUSE: {
+		Publisher: to.StringPtr("SUSE"),
+		Offer:     to.StringPtr("opensuse-leap-15-2"),
+		Sku:       to.StringPtr("gen1"),
+		Version:   to.StringPtr("latest"),
+	},
 }
 
 var osPlans = map[providerconfigtypes.OperatingSystem]*compute.Plan{
@@ -155,6 +182,16 @@ var osPlans = map[providerconfigtypes.OperatingSystem]*compute.Plan{
 		Publisher: pointer.StringPtr("kinvolk"),
 		Product:   pointer.StringPtr("flatcar-container-linux"),
 	},
+	providerconfigtypes.OperatingSystemRockyLinux: {
+		Name:      pointer.StringPtr("free"),
+		Publisher: pointer.StringPtr("erockyenterprisesoftwarefoundationinc1653071250513"),
+		Product:   pointer.StringPtr("rockylinux"),
+	},
+	providerconfigtypes.OperatingSystemAlmaLinux: {
+		Name:      pointer.StringPtr("8_5"),
+		Publisher: pointer.StringPtr("almalinux"),
+		Product:   pointer.StringPtr("almalinux"),
+	},
 }
 
 func getOSImageReference(imageID string, os providerconfigtypes.OperatingSystem) (*compute.ImageReference, error) {
@@ -193,22 +230,23 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*config, *providerconfigt
 	}
 
 	c := config{}
-	c.SubscriptionID, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawCfg.SubscriptionID, envSubscriptionID)
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.SubscriptionID, err = credentialResolver.GetConfigVarStringValueOrEnv(rawCfg.SubscriptionID, envSubscriptionID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"subscriptionID\" field, error = %v", err)
 	}
 
-	c.TenantID, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawCfg.TenantID, envTenantID)
+	c.TenantID, err = credentialResolver.GetConfigVarStringValueOrEnv(rawCfg.TenantID, envTenantID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"tenantID\" field, error = %v", err)
 	}
 
-	c.ClientID, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawCfg.ClientID, envClientID)
+	c.ClientID, err = credentialResolver.GetConfigVarStringValueOrEnv(rawCfg.ClientID, envClientID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"clientID\" field, error = %v", err)
 	}
 
-	c.ClientSecret, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawCfg.ClientSecret, envClientSecret)
+	c.ClientSecret, err = credentialResolver.GetConfigVarStringValueOrEnv(rawCfg.ClientSecret, envClientSecret)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"clientSecret\" field, error = %v", err)
 	}
@@ -457,8 +495,14 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 		return nil, fmt.Errorf("failed to create VM client: %v", err)
 	}
 
-	// We genete a random SSH key, since Azure won't let us create a VM without an SSH key or a password
-	key, err := ssh.NewKey()
+	userdata, err = convert.GzipCloudInit(providerCfg.OperatingSystem, userdata)
+	if err != nil {
+		return nil, err
+	}
+
+	// We genete a random SSH key, since Azure won't let us create a VM without an SSH key or a password.
+	// Azure only accepts RSA keys
+	key, err := ssh.NewRSAKey()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ssh key: %v", err)
 	}
@@ -474,7 +518,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 		}); err != nil {
 			return nil, err
 		}
-		publicIP, err = createOrUpdatePublicIPAddress(context.TODO(), publicIPName, machine.UID, config)
+		publicIP, err = createOrUpdatePublicIPAddress(data.Context(), publicIPName, machine.UID, config)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create public IP: %v", err)
 		}
@@ -487,7 +531,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 	}); err != nil {
 		return nil, err
 	}
-	iface, err := createOrUpdateNetworkInterface(context.TODO(), ifaceName, machine.UID, config, publicIP)
+	iface, err := createOrUpdateNetworkInterface(data.Context(), ifaceName, machine.UID, config, publicIP)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate main network interface: %v", err)
 	}
@@ -508,6 +552,41 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 	if err != nil {
 		return nil, fmt.Errorf("failed to get StorageProfile: %v", err)
 	}
+	// The keys of the machine are registered as well, Azure only accepts RSA keys
+	var sshPublicKeys []compute.SSHPublicKey
+	for _, publicKey := range ssh.MergeKeys(key, providerCfg.SSHPublicKeys, gossh.KeyAlgoRSA) {
+		sshPublicKeys = append(sshPublicKeys, compute.SSHPublicKey{
+			Path:    to.StringPtr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", adminUserName)),
+			KeyData: to.StringPtr(publicKey),
+		})
+	}
+	osProfile := &compute.OSProfile{
+		AdminUsername: to.StringPtr(adminUserName),
+		ComputerName:  &machine.Name,
+		LinuxConfiguration: &compute.LinuxConfiguration{
+			DisablePasswordAuthentication: to.BoolPtr(true),
+			SSH: &compute.SSHConfiguration{
+				PublicKeys: &sshPublicKeys,
+			},
+		},
+		CustomData: to.StringPtr(base64.StdEncoding.EncodeToString([]byte(userdata))),
+	}
+	if providerCfg.OperatingSystem == providerconfigtypes.OperatingSystemWindows {
+		// Windows requires an admin password instead of an SSH key, nobody ever gets to know it
+		password, err := createRandomPassword()
+		if err != nil {
+			return nil, err
+		}
+		osProfile.AdminPassword = to.StringPtr(password)
+		osProfile.LinuxConfiguration = nil
+		osProfile.WindowsConfiguration = &compute.WindowsConfiguration{
+			ProvisionVMAgent: to.BoolPtr(true),
+		}
+		// The computer name of Windows is limited to 15 characters, the kubelet
+		// registers the node with the machine name instead.
+		osProfile.ComputerName = to.StringPtr(windowsComputerName(machine.UID))
+	}
+
 	vmSpec := compute.VirtualMachine{
 		Location: &config.Location,
 		Plan:     osPlane,
@@ -521,22 +600,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 					},
 				},
 			},
-			OsProfile: &compute.OSProfile{
-				AdminUsername: to.StringPtr(adminUserName),
-				ComputerName:  &machine.Name,
-				LinuxConfiguration: &compute.LinuxConfiguration{
-					DisablePasswordAuthentication: to.BoolPtr(true),
-					SSH: &compute.SSHConfiguration{
-						PublicKeys: &[]compute.SSHPublicKey{
-							{
-								Path:    to.StringPtr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", adminUserName)),
-								KeyData: &key.PublicKey,
-							},
-						},
-					},
-				},
-				CustomData: to.StringPtr(base64.StdEncoding.EncodeToString([]byte(userdata))),
-			},
+			OsProfile:      osProfile,
 			StorageProfile: storageProfile,
 		},
 		Tags:  tags,
@@ -561,12 +625,12 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 		return nil, err
 	}
 
-	future, err := vmClient.CreateOrUpdate(context.TODO(), config.ResourceGroup, machine.Name, vmSpec)
+	future, err := vmClient.CreateOrUpdate(data.Context(), config.ResourceGroup, machine.Name, vmSpec)
 	if err != nil {
 		return nil, fmt.Errorf("trying to create a VM: %v", err)
 	}
 
-	err = future.WaitForCompletionRef(context.TODO(), vmClient.Client)
+	err = future.WaitForCompletionRef(data.Context(), vmClient.Client)
 	if err != nil {
 		return nil, fmt.Errorf("waiting for operation returned: %v", err.Error())
 	}
@@ -577,17 +641,17 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 	}
 
 	// get the actual VM object filled in with additional data
-	vm, err = vmClient.Get(context.TODO(), config.ResourceGroup, machine.Name, "")
+	vm, err = vmClient.Get(data.Context(), config.ResourceGroup, machine.Name, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve updated data for VM %q: %v", machine.Name, err)
 	}
 
-	ipAddresses, err := getVMIPAddresses(context.TODO(), config, &vm)
+	ipAddresses, err := getVMIPAddresses(data.Context(), config, &vm)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve IP addresses for VM %q: %v", machine.Name, err.Error())
 	}
 
-	status, err := getVMStatus(context.TODO(), config, machine.Name)
+	status, err := getVMStatus(data.Context(), config, machine.Name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve status for VM %q: %v", machine.Name, err.Error())
 	}
@@ -601,7 +665,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.P
 		return false, fmt.Errorf("failed to parse MachineSpec: %v", err)
 	}
 
-	_, err = p.get(machine)
+	_, err = p.get(data.Context(), machine)
 	// If a defunct VM got created, the `Get` call returns an error - But not because the request
 	// failed but because the VM has an invalid config hence always delete except on err == cloudprovidererrors.ErrInstanceNotFound
 	if err != nil {
@@ -612,7 +676,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.P
 	}
 
 	klog.Infof("deleting VM %q", machine.Name)
-	if err = deleteVMsByMachineUID(context.TODO(), config, machine.UID); err != nil {
+	if err = deleteVMsByMachineUID(data.Context(), config, machine.UID); err != nil {
 		return false, fmt.Errorf("failed to delete instance for  machine %q: %v", machine.Name, err)
 	}
 
@@ -623,7 +687,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.P
 	}
 
 	klog.Infof("deleting disks of VM %q", machine.Name)
-	if err := deleteDisksByMachineUID(context.TODO(), config, machine.UID); err != nil {
+	if err := deleteDisksByMachineUID(data.Context(), config, machine.UID); err != nil {
 		return false, fmt.Errorf("failed to remove disks of machine %q: %v", machine.Name, err)
 	}
 	if err := data.Update(machine, func(updatedMachine *v1alpha1.Machine) {
@@ -633,7 +697,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.P
 	}
 
 	klog.Infof("deleting network interfaces of VM %q", machine.Name)
-	if err := deleteInterfacesByMachineUID(context.TODO(), config, machine.UID); err != nil {
+	if err := deleteInterfacesByMachineUID(data.Context(), config, machine.UID); err != nil {
 		return false, fmt.Errorf("failed to remove network interfaces of machine %q: %v", machine.Name, err)
 	}
 	if err := data.Update(machine, func(updatedMachine *v1alpha1.Machine) {
@@ -643,7 +707,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.P
 	}
 
 	klog.Infof("deleting public IP addresses of VM %q", machine.Name)
-	if err := deleteIPAddressesByMachineUID(context.TODO(), config, machine.UID); err != nil {
+	if err := deleteIPAddressesByMachineUID(data.Context(), config, machine.UID); err != nil {
 		return false, fmt.Errorf("failed to remove public IP addresses of machine %q: %v", machine.Name, err)
 	}
 	if err := data.Update(machine, func(updatedMachine *v1alpha1.Machine) {
@@ -739,17 +803,17 @@ func getVMStatus(ctx context.Context, c *config, vmName string) (instance.Status
 	}
 }
 
-func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (instance.Instance, error) {
-	return p.get(machine)
+func (p *provider) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	return p.get(data.Context(), machine)
 }
 
-func (p *provider) get(machine *v1alpha1.Machine) (*azureVM, error) {
+func (p *provider) get(ctx context.Context, machine *v1alpha1.Machine) (*azureVM, error) {
 	config, _, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse MachineSpec: %v", err)
 	}
 
-	vm, err := getVMByUID(context.TODO(), config, machine.UID)
+	vm, err := getVMByUID(ctx, config, machine.UID)
 	if err != nil {
 		if err == cloudprovidererrors.ErrInstanceNotFound {
 			return nil, cloudprovidererrors.ErrInstanceNotFound
@@ -758,12 +822,12 @@ func (p *provider) get(machine *v1alpha1.Machine) (*azureVM, error) {
 		return nil, fmt.Errorf("failed to find machine %q by its UID: %v", machine.UID, err)
 	}
 
-	ipAddresses, err := getVMIPAddresses(context.TODO(), config, vm)
+	ipAddresses, err := getVMIPAddresses(ctx, config, vm)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve IP addresses for VM %v: %v", vm.Name, err)
 	}
 
-	status, err := getVMStatus(context.TODO(), config, machine.Name)
+	status, err := getVMStatus(ctx, config, machine.Name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve status for VM %v: %v", vm.Name, err)
 	}
@@ -808,35 +872,35 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	}
 
 	if c.SubscriptionID == "" {
-		return errors.New("subscriptionID is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("subscriptionID"), "")
 	}
 
 	if c.TenantID == "" {
-		return errors.New("tenantID is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("tenantID"), "")
 	}
 
 	if c.ClientID == "" {
-		return errors.New("clientID is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("clientID"), "")
 	}
 
 	if c.ClientSecret == "" {
-		return errors.New("clientSecret is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("clientSecret"), "")
 	}
 
 	if c.ResourceGroup == "" {
-		return errors.New("resourceGroup is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("resourceGroup"), "")
 	}
 
 	if c.VMSize == "" {
-		return errors.New("vmSize is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("vmSize"), "")
 	}
 
 	if c.VNetName == "" {
-		return errors.New("vnetName is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("vnetName"), "")
 	}
 
 	if c.SubnetName == "" {
-		return errors.New("subnetName is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("subnetName"), "")
 	}
 
 	vmClient, err := getVMClient(c)
@@ -938,6 +1002,10 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
 	labels := make(map[string]string)
 
@@ -954,6 +1022,23 @@ func (p *provider) SetMetricsForMachines(machines v1alpha1.MachineList) error {
 	return nil
 }
 
+func createRandomPassword() (string, error) {
+	rawPassword := make([]byte, 24)
+	if _, err := rand.Read(rawPassword); err != nil {
+		return "", fmt.Errorf("failed to generate random password: %v", err)
+	}
+	// the suffix satisfies the complexity requirements of Azure in any case
+	return base64.StdEncoding.EncodeToString(rawPassword) + "Aa1!", nil
+}
+
+func windowsComputerName(uid types.UID) string {
+	name := strings.Replace(string(uid), "-", "", -1)
+	if len(name) > 15 {
+		name = name[:15]
+	}
+	return name
+}
+
 func getOSUsername(os providerconfigtypes.OperatingSystem) string {
 	switch os {
 	case providerconfigtypes.OperatingSystemFlatcar:
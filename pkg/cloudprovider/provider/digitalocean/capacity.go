@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+)
+
+// CheckCapacity checks that the droplet limit of the account leaves room for the given number of droplets
+func (p *provider) CheckCapacity(spec v1alpha1.MachineSpec, count int) error {
+	c, _, err := p.getConfig(spec.ProviderSpec)
+	if err != nil {
+		return fmt.Errorf("failed to parse config: %v", err)
+	}
+
+	ctx := context.TODO()
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	account, resp, err := client.Account.Get(ctx)
+	if err != nil {
+		return doStatusAndErrToTerminalError(responseStatus(resp), fmt.Errorf("failed to get account: %v", err))
+	}
+	droplets, err := p.listDroplets(ctx, c)
+	if err != nil {
+		return err
+	}
+	return checkDropletLimit(account.DropletLimit, len(droplets), count)
+}
+
+func checkDropletLimit(limit, existing, count int) error {
+	// Accounts without a limit report 0
+	if limit <= 0 || existing+count <= limit {
+		return nil
+	}
+	return cloudprovidererrors.TerminalError{
+		Reason:  common.QuotaExceededMachineError,
+		Message: fmt.Sprintf("creating %d droplets exceeds the droplet limit of the account: %d of %d droplets are in use", count, existing, limit),
+	}
+}
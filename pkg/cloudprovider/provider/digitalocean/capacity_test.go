@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package digitalocean
+
+import (
+	"testing"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+)
+
+func TestCheckDropletLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		existing      int
+		count         int
+		expectedError bool
+	}{
+		{
+			name:     "within the limit",
+			limit:    25,
+			existing: 20,
+			count:    5,
+		},
+		{
+			name:          "exceeding the limit",
+			limit:         25,
+			existing:      20,
+			count:         6,
+			expectedError: true,
+		},
+		{
+			name:     "no limit",
+			existing: 20,
+			count:    100,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkDropletLimit(test.limit, test.existing, test.count)
+			if (err != nil) != test.expectedError {
+				t.Fatalf("expected error %t, got %v", test.expectedError, err)
+			}
+			if err == nil {
+				return
+			}
+			terminalError, ok := err.(cloudprovidererrors.TerminalError)
+			if !ok || terminalError.Reason != common.QuotaExceededMachineError {
+				t.Errorf("expected a terminal quota error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package digitalocean
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/godo"
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// catalogTTL is how long the regions and sizes of an account are cached. They rarely change, but the
+// admission webhook validates every machine against them, which would exhaust the rate limit of the
+// API when hundreds of machines are created at once.
+const catalogTTL = 10 * time.Minute
+
+// catalogs caches the regions and sizes by the hash of the token, as the availability of sizes
+// may differ between accounts
+var catalogs = gocache.New(catalogTTL, catalogTTL)
+
+func catalogKey(kind, token string) string {
+	return fmt.Sprintf("%s-%x", kind, sha256.Sum256([]byte(token)))
+}
+
+// listRegions returns the regions of the account of the given token, which are cached for catalogTTL
+func listRegions(ctx context.Context, service godo.RegionsService, token string) ([]godo.Region, error) {
+	key := catalogKey("regions", token)
+	if cached, found := catalogs.Get(key); found {
+		return cached.([]godo.Region), nil
+	}
+	var regions []godo.Region
+	opt := &godo.ListOptions{PerPage: 200}
+	for {
+		page, resp, err := service.List(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		regions = append(regions, page...)
+		more, err := nextPage(resp, opt)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+	catalogs.SetDefault(key, regions)
+	return regions, nil
+}
+
+// listSizes returns the sizes of the account of the given token, which are cached for catalogTTL
+func listSizes(ctx context.Context, service godo.SizesService, token string) ([]godo.Size, error) {
+	key := catalogKey("sizes", token)
+	if cached, found := catalogs.Get(key); found {
+		return cached.([]godo.Size), nil
+	}
+	var sizes []godo.Size
+	opt := &godo.ListOptions{PerPage: 200}
+	for {
+		page, resp, err := service.List(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, page...)
+		more, err := nextPage(resp, opt)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+	catalogs.SetDefault(key, sizes)
+	return sizes, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package digitalocean
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/digitalocean/godo"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	digitaloceantypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/digitalocean/types"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ResolveInstanceType picks the cheapest size available in the region of the spec which meets its
+// instanceRequirements, unless the spec already sets a size
+func (p *provider) ResolveInstanceType(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, string, error) {
+	c, pc, err := p.getConfig(spec.ProviderSpec)
+	if err != nil {
+		return spec, "", fmt.Errorf("failed to parse config: %v", err)
+	}
+	if c.Size != "" || pc.InstanceRequirements == nil {
+		return spec, c.Size, nil
+	}
+	if c.Token == "" {
+		return spec, "", field.Required(providerconfigtypes.CloudProviderSpecPath.Child("token"), "")
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return spec, "", err
+	}
+	sizes, err := listSizes(context.TODO(), client.Sizes, c.Token)
+	if err != nil {
+		return spec, "", fmt.Errorf("failed to list sizes: %v", err)
+	}
+	size, err := cheapestSize(sizes, c.Region, *pc.InstanceRequirements)
+	if err != nil {
+		return spec, "", err
+	}
+
+	rawConfig := digitaloceantypes.RawConfig{}
+	if err := json.Unmarshal(pc.CloudProviderSpec.Raw, &rawConfig); err != nil {
+		return spec, "", err
+	}
+	rawConfig.Size.Value = size.Slug
+	spec.ProviderSpec.Value, err = setProviderSpec(rawConfig, spec.ProviderSpec)
+	return spec, size.Slug, err
+}
+
+// cheapestSize returns the size with the lowest hourly price which is available in the given region and
+// meets the requirements. The catalog of DigitalOcean has no sizes with GPUs.
+func cheapestSize(sizes []godo.Size, region string, requirements providerconfigtypes.InstanceRequirements) (*godo.Size, error) {
+	if requirements.GPUs > 0 {
+		return nil, fmt.Errorf("there are no sizes with GPUs")
+	}
+
+	var cheapest *godo.Size
+	for i := range sizes {
+		size := &sizes[i]
+		if !size.Available || !hasRegion(size, region) {
+			continue
+		}
+		if int32(size.Vcpus) < requirements.CPUs || int64(size.Memory) < requirements.MemoryMB {
+			continue
+		}
+		// Sizes with the same price are ordered by their slug, so the pick doesn't depend on the order of the listing
+		if cheapest == nil || size.PriceHourly < cheapest.PriceHourly ||
+			(size.PriceHourly == cheapest.PriceHourly && size.Slug < cheapest.Slug) {
+			cheapest = size
+		}
+	}
+	if cheapest == nil {
+		return nil, fmt.Errorf("no size in region %q has at least %d CPUs and %d MiB of memory", region, requirements.CPUs, requirements.MemoryMB)
+	}
+	return cheapest, nil
+}
+
+func hasRegion(size *godo.Size, region string) bool {
+	for _, sizeRegion := range size.Regions {
+		if sizeRegion == region {
+			return true
+		}
+	}
+	return false
+}
+
+func setProviderSpec(rawConfig digitaloceantypes.RawConfig, s v1alpha1.ProviderSpec) (*runtime.RawExtension, error) {
+	if s.Value == nil {
+		return nil, fmt.Errorf("machine.spec.providerconfig.value is nil")
+	}
+	pconfig := providerconfigtypes.Config{}
+	err := json.Unmarshal(s.Value.Raw, &pconfig)
+	if err != nil {
+		return nil, err
+	}
+	rawCloudProviderSpec, err := json.Marshal(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+	pconfig.CloudProviderSpec = runtime.RawExtension{Raw: rawCloudProviderSpec}
+	rawPconfig, err := json.Marshal(pconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runtime.RawExtension{Raw: rawPconfig}, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package digitalocean
+
+import (
+	"testing"
+
+	"github.com/digitalocean/godo"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+func TestCheapestSize(t *testing.T) {
+	sizes := []godo.Size{
+		{Slug: "s-1vcpu-1gb", Vcpus: 1, Memory: 1024, PriceHourly: 0.00744, Regions: []string{"fra1", "ams3"}, Available: true},
+		{Slug: "s-2vcpu-2gb", Vcpus: 2, Memory: 2048, PriceHourly: 0.02232, Regions: []string{"fra1", "ams3"}, Available: true},
+		{Slug: "s-2vcpu-4gb", Vcpus: 2, Memory: 4096, PriceHourly: 0.02976, Regions: []string{"fra1", "ams3"}, Available: true},
+		{Slug: "c-2", Vcpus: 2, Memory: 4096, PriceHourly: 0.0625, Regions: []string{"fra1"}, Available: true},
+		{Slug: "s-4vcpu-8gb", Vcpus: 4, Memory: 8192, PriceHourly: 0.05952, Regions: []string{"ams3"}, Available: true},
+		{Slug: "s-8vcpu-16gb", Vcpus: 8, Memory: 16384, PriceHourly: 0.11905, Regions: []string{"fra1"}, Available: false},
+	}
+
+	tests := []struct {
+		name         string
+		region       string
+		requirements providerconfigtypes.InstanceRequirements
+		expectedSlug string
+		expectError  bool
+	}{
+		{
+			name:         "smallest size",
+			region:       "fra1",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 1, MemoryMB: 512},
+			expectedSlug: "s-1vcpu-1gb",
+		},
+		{
+			name:         "memory rules out the cheaper size",
+			region:       "fra1",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 2, MemoryMB: 3072},
+			expectedSlug: "s-2vcpu-4gb",
+		},
+		{
+			name:         "size of another region",
+			region:       "ams3",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 4, MemoryMB: 8192},
+			expectedSlug: "s-4vcpu-8gb",
+		},
+		{
+			name:         "unavailable size",
+			region:       "fra1",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 8, MemoryMB: 16384},
+			expectError:  true,
+		},
+		{
+			name:         "GPUs",
+			region:       "fra1",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 1, MemoryMB: 1024, GPUs: 1},
+			expectError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			size, err := cheapestSize(sizes, test.region, test.requirements)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected an error, got size %s", size.Slug)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to pick size: %v", err)
+			}
+			if size.Slug != test.expectedSlug {
+				t.Errorf("expected size %s, got %s", test.expectedSlug, size.Slug)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+)
+
+// HourlyPrice returns the hourly price in USD of the size of the spec, using the cached sizes of the account
+func (p *provider) HourlyPrice(spec v1alpha1.MachineSpec) (float64, string, error) {
+	c, _, err := p.getConfig(spec.ProviderSpec)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to parse config: %v", err)
+	}
+	if c.Size == "" {
+		return 0, "", fmt.Errorf("spec has no size")
+	}
+
+	client, err := getClient(c)
+	if err != nil {
+		return 0, "", err
+	}
+	sizes, err := listSizes(context.TODO(), client.Sizes, c.Token)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to list sizes: %v", err)
+	}
+	for _, size := range sizes {
+		if size.Slug == c.Size {
+			return size.PriceHourly, "USD", nil
+		}
+	}
+	return 0, "", fmt.Errorf("size %q not found", c.Size)
+}
@@ -19,7 +19,6 @@ package digitalocean
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -35,12 +34,14 @@ import (
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
 	digitaloceantypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/digitalocean/types"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog"
 )
@@ -56,6 +57,7 @@ func New(configVarResolver *providerconfig.ConfigVarResolver) cloudprovidertypes
 
 type Config struct {
 	Token             string
+	APIEndpoint       string
 	Region            string
 	Size              string
 	Backups           bool
@@ -90,17 +92,32 @@ func getSlugForOS(os providerconfigtypes.OperatingSystem) (string, error) {
 		return "coreos-stable", nil
 	case providerconfigtypes.OperatingSystemCentOS:
 		return "centos-7-x64", nil
+	case providerconfigtypes.OperatingSystemRockyLinux:
+		return "rockylinux-8-x64", nil
+	case providerconfigtypes.OperatingSystemAlmaLinux:
+		return "almalinux-8-x64", nil
 	}
 	return "", providerconfigtypes.ErrOSNotSupported
 }
 
-func getClient(token string) *godo.Client {
-	tokenSource := &TokenSource{
-		AccessToken: token,
-	}
+// clients are the API clients per token and endpoint
+var clients = cloudproviderutil.NewClientPool("digitalocean")
 
-	oauthClient := oauth2.NewClient(context.Background(), tokenSource)
-	return godo.NewClient(oauthClient)
+func getClient(c *Config) (*godo.Client, error) {
+	client, err := clients.Get(c.APIEndpoint, []string{c.Token}, func(httpClient *http.Client) (interface{}, error) {
+		httpClient.Transport = &oauth2.Transport{
+			Base:   httpClient.Transport,
+			Source: &TokenSource{AccessToken: c.Token},
+		}
+		if c.APIEndpoint == "" {
+			return godo.NewClient(httpClient), nil
+		}
+		return godo.New(httpClient, godo.SetBaseURL(c.APIEndpoint))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for API endpoint %q: %v", c.APIEndpoint, err)
+	}
+	return client.(*godo.Client), nil
 }
 
 func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigtypes.Config, error) {
@@ -119,10 +136,15 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 	}
 
 	c := Config{}
-	c.Token, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.Token, "DO_TOKEN")
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.Token, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.Token, "DO_TOKEN")
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"token\" field, error = %v", err)
 	}
+	c.APIEndpoint, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.APIEndpoint, "DO_API_URL")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the value of \"apiEndpoint\" field, error = %v", err)
+	}
 	c.Region, err = p.configVarResolver.GetConfigVarStringValue(rawConfig.Region)
 	if err != nil {
 		return nil, nil, err
@@ -169,15 +191,15 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	}
 
 	if c.Token == "" {
-		return errors.New("token is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("token"), "")
 	}
 
 	if c.Region == "" {
-		return errors.New("region is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("region"), "")
 	}
 
 	if c.Size == "" {
-		return errors.New("size is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("size"), "")
 	}
 
 	_, err = getSlugForOS(pc.OperatingSystem)
@@ -186,9 +208,12 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	}
 
 	ctx := context.TODO()
-	client := getClient(c.Token)
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
 
-	regions, _, err := client.Regions.List(ctx, &godo.ListOptions{PerPage: 1000})
+	regions, err := listRegions(ctx, client.Regions, c.Token)
 	if err != nil {
 		return err
 	}
@@ -203,7 +228,7 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 		return fmt.Errorf("region %q not found", c.Region)
 	}
 
-	sizes, _, err := client.Sizes.List(ctx, &godo.ListOptions{PerPage: 1000})
+	sizes, err := listSizes(ctx, client.Sizes, c.Token)
 	if err != nil {
 		return err
 	}
@@ -237,18 +262,20 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	return nil
 }
 
-// uploadRandomSSHPublicKey generates a random key pair and uploads the public part of the key to
-// digital ocean because it is not possible to create a droplet without ssh key assigned
-// this method returns an error if the key already exists
-func uploadRandomSSHPublicKey(ctx context.Context, service godo.KeysService) (string, error) {
-	sshkey, err := ssh.NewKey()
+// uploadSSHPublicKey uploads the given public key to digital ocean because it is not possible to
+// create a droplet without ssh key assigned. Temporary keys must not exist yet. Keys provided by the
+// operator are uploaded only once and kept, as other droplets may be created with them concurrently.
+// It returns the fingerprint of the key and whether it got uploaded and has to be deleted again.
+func uploadSSHPublicKey(ctx context.Context, service godo.KeysService, sshkey *ssh.Pubkey) (string, bool, error) {
+	existingkey, err := getSSHPublicKey(ctx, service, sshkey.FingerprintMD5)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate ssh key: %v", err)
+		return "", false, err
 	}
-
-	existingkey, res, err := service.GetByFingerprint(ctx, sshkey.FingerprintMD5)
-	if err == nil && existingkey != nil && res.StatusCode >= http.StatusOK && res.StatusCode <= http.StatusAccepted {
-		return "", fmt.Errorf("failed to create ssh public key, the key already exists")
+	if existingkey != nil {
+		if sshkey.OperatorProvided {
+			return existingkey.Fingerprint, false, nil
+		}
+		return "", false, fmt.Errorf("failed to create ssh public key, the key already exists")
 	}
 
 	newDoKey, rsp, err := service.Create(ctx, &godo.KeyCreateRequest{
@@ -256,13 +283,43 @@ func uploadRandomSSHPublicKey(ctx context.Context, service godo.KeysService) (st
 		Name:      sshkey.Name,
 	})
 	if err != nil {
-		return "", doStatusAndErrToTerminalError(rsp.StatusCode, fmt.Errorf("failed to create ssh public key on digitalocean: %v", err))
+		status := responseStatus(rsp)
+		// Another worker or machine-controller may have uploaded the key in the meantime
+		if sshkey.OperatorProvided && status == http.StatusUnprocessableEntity {
+			existingkey, getErr := getSSHPublicKey(ctx, service, sshkey.FingerprintMD5)
+			if getErr == nil && existingkey != nil {
+				return existingkey.Fingerprint, false, nil
+			}
+		}
+		return "", false, doStatusAndErrToTerminalError(status, fmt.Errorf("failed to create ssh public key on digitalocean: %v", err))
+	}
+
+	return newDoKey.Fingerprint, !sshkey.OperatorProvided, nil
+}
+
+// getSSHPublicKey returns the key with the given fingerprint, or nil if it does not exist
+func getSSHPublicKey(ctx context.Context, service godo.KeysService, fingerprint string) (*godo.Key, error) {
+	key, rsp, err := service.GetByFingerprint(ctx, fingerprint)
+	status := responseStatus(rsp)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, doStatusAndErrToTerminalError(status, fmt.Errorf("failed to get ssh public key from digitalocean: %v", err))
 	}
+	return key, nil
+}
 
-	return newDoKey.Fingerprint, nil
+// responseStatus returns the status code of the given response, or 0 if the request failed before
+// a response was received
+func responseStatus(rsp *godo.Response) int {
+	if rsp == nil || rsp.Response == nil {
+		return 0
+	}
+	return rsp.StatusCode
 }
 
-func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData, userdata string) (instance.Instance, error) {
+func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData, userdata string) (instance.Instance, error) {
 	c, pc, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, cloudprovidererrors.TerminalError{
@@ -271,19 +328,28 @@ func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provi
 		}
 	}
 
-	ctx := context.TODO()
-	client := getClient(c.Token)
+	ctx := data.Context()
+	client, err := getClient(c)
+	if err != nil {
+		return nil, err
+	}
 
-	fingerprint, err := uploadRandomSSHPublicKey(ctx, client.Keys)
+	sshkey, err := ssh.NewKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ssh key: %v", err)
+	}
+	fingerprint, uploaded, err := uploadSSHPublicKey(ctx, client.Keys, sshkey)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_, err := client.Keys.DeleteByFingerprint(ctx, fingerprint)
-		if err != nil {
-			klog.Errorf("failed to remove a temporary ssh key with fingerprint = %v, due to = %v", fingerprint, err)
-		}
-	}()
+	if uploaded {
+		defer func() {
+			_, err := client.Keys.DeleteByFingerprint(ctx, fingerprint)
+			if err != nil {
+				klog.Errorf("failed to remove a temporary ssh key with fingerprint = %v, due to = %v", fingerprint, err)
+			}
+		}()
+	}
 
 	slug, err := getSlugForOS(pc.OperatingSystem)
 	if err != nil {
@@ -334,8 +400,8 @@ func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provi
 	return &doInstance{droplet: droplet}, err
 }
 
-func (p *provider) Cleanup(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
-	instance, err := p.get(machine)
+func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
+	instance, err := p.get(data.Context(), machine)
 	if err != nil {
 		if err == cloudprovidererrors.ErrInstanceNotFound {
 			return true, nil
@@ -350,8 +416,11 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, _ *cloudprovidertypes.Prov
 			Message: fmt.Sprintf("Failed to parse MachineSpec, due to %v", err),
 		}
 	}
-	ctx := context.TODO()
-	client := getClient(c.Token)
+	ctx := data.Context()
+	client, err := getClient(c)
+	if err != nil {
+		return false, err
+	}
 
 	doID, err := strconv.Atoi(instance.ID())
 	if err != nil {
@@ -366,11 +435,11 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, _ *cloudprovidertypes.Prov
 	return false, nil
 }
 
-func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (instance.Instance, error) {
-	return p.get(machine)
+func (p *provider) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	return p.get(data.Context(), machine)
 }
 
-func (p *provider) get(machine *v1alpha1.Machine) (*doInstance, error) {
+func (p *provider) get(ctx context.Context, machine *v1alpha1.Machine) (*doInstance, error) {
 	c, _, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, cloudprovidererrors.TerminalError{
@@ -379,7 +448,7 @@ func (p *provider) get(machine *v1alpha1.Machine) (*doInstance, error) {
 		}
 	}
 
-	droplets, err := p.listDroplets(c.Token)
+	droplets, err := p.listDroplets(ctx, c)
 	if err != nil {
 		return nil, err
 	}
@@ -393,9 +462,11 @@ func (p *provider) get(machine *v1alpha1.Machine) (*doInstance, error) {
 	return nil, cloudprovidererrors.ErrInstanceNotFound
 }
 
-func (p *provider) listDroplets(token string) ([]godo.Droplet, error) {
-	ctx := context.TODO()
-	client := getClient(token)
+func (p *provider) listDroplets(ctx context.Context, c *Config) ([]godo.Droplet, error) {
+	client, err := getClient(c)
+	if err != nil {
+		return nil, err
+	}
 	result := make([]godo.Droplet, 0)
 
 	opt := &godo.ListOptions{
@@ -410,19 +481,88 @@ func (p *provider) listDroplets(token string) ([]godo.Droplet, error) {
 
 		result = append(result, droplets...)
 
-		if resp.Links == nil || resp.Links.IsLastPage() {
+		more, err := nextPage(resp, opt)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
 			break
 		}
+	}
 
-		page, err := resp.Links.CurrentPage()
-		if err != nil {
-			return nil, err
+	return result, nil
+}
+
+// nextPage advances the given options to the page following the one of the response and
+// returns whether there is such a page
+func nextPage(resp *godo.Response, opt *godo.ListOptions) (bool, error) {
+	if resp == nil || resp.Links == nil || resp.Links.IsLastPage() {
+		return false, nil
+	}
+	page, err := resp.Links.CurrentPage()
+	if err != nil {
+		return false, err
+	}
+	opt.Page = page + 1
+	return true, nil
+}
+
+// AdoptInstance tags the droplet with the given ID with the UID of the machine, so get finds it. The droplet must
+// be named like the machine, as droplets are looked up by both.
+func (p *provider) AdoptInstance(machine *v1alpha1.Machine, instanceID string, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	c, _, err := p.getConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: fmt.Sprintf("Failed to parse MachineSpec, due to %v", err),
 		}
+	}
+	id, err := strconv.Atoi(instanceID)
+	if err != nil {
+		return nil, cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: fmt.Sprintf("Invalid droplet ID %q, it must be a number", instanceID),
+		}
+	}
+
+	ctx := data.Context()
+	client, err := getClient(c)
+	if err != nil {
+		return nil, err
+	}
 
-		opt.Page = page + 1
+	droplet, rsp, err := client.Droplets.Get(ctx, id)
+	if err != nil {
+		if rsp != nil && rsp.StatusCode == http.StatusNotFound {
+			return nil, cloudprovidererrors.ErrInstanceNotFound
+		}
+		if rsp != nil {
+			err = doStatusAndErrToTerminalError(rsp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("failed to get droplet %d: %v", id, err)
+	}
+	if droplet.Name != machine.Spec.Name {
+		return nil, cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: fmt.Sprintf("Droplet %d is named %q, it must be named like the machine, %q", id, droplet.Name, machine.Spec.Name),
+		}
 	}
 
-	return result, nil
+	// The create does not fail if that tag already exists
+	if _, rsp, err := client.Tags.Create(ctx, &godo.TagCreateRequest{Name: string(machine.UID)}); err != nil {
+		if rsp != nil {
+			err = doStatusAndErrToTerminalError(rsp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("failed to create UID tag: %v", err)
+	}
+	tagResourceRequest := &godo.TagResourcesRequest{
+		Resources: []godo.Resource{{ID: strconv.Itoa(droplet.ID), Type: godo.DropletResourceType}},
+	}
+	if _, err := client.Tags.TagResources(ctx, string(machine.UID), tagResourceRequest); err != nil {
+		return nil, fmt.Errorf("failed to tag droplet %d with the UID of the machine: %v", id, err)
+	}
+	droplet.Tags = append(droplet.Tags, string(machine.UID))
+	return &doInstance{droplet: droplet}, nil
 }
 
 func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
@@ -433,8 +573,11 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	if err != nil {
 		return fmt.Errorf("failed to decode providerconfig: %v", err)
 	}
-	client := getClient(c.Token)
-	droplets, _, err := client.Droplets.List(ctx, &godo.ListOptions{PerPage: 1000})
+	client, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	droplets, err := p.listDroplets(ctx, c)
 	if err != nil {
 		return fmt.Errorf("failed to list droplets: %v", err)
 	}
@@ -467,6 +610,88 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	return nil
 }
 
+// Update resizes the droplet to the configured size. As droplets can only be resized while they
+// are powered off, the droplet gets powered off, resized and powered on again, each step being
+// awaited by subsequent calls.
+func (p *provider) Update(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
+	instance, err := p.get(data.Context(), machine)
+	if err != nil {
+		return false, err
+	}
+
+	c, _, err := p.getConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return false, cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: fmt.Sprintf("Failed to parse MachineSpec, due to %v", err),
+		}
+	}
+	ctx := data.Context()
+	client, err := getClient(c)
+	if err != nil {
+		return false, err
+	}
+	droplet := instance.droplet
+
+	actions, rsp, err := client.Droplets.Actions(ctx, droplet.ID, &godo.ListOptions{PerPage: 200})
+	if err != nil {
+		return false, doStatusAndErrToTerminalError(rsp.StatusCode, fmt.Errorf("failed to list droplet actions: %v", err))
+	}
+	for _, action := range actions {
+		if action.Status == godo.ActionInProgress {
+			return false, nil
+		}
+	}
+
+	switch {
+	case droplet.SizeSlug != c.Size && droplet.Status == "active":
+		_, rsp, err = client.DropletActions.PowerOff(ctx, droplet.ID)
+		if err != nil {
+			return false, doStatusAndErrToTerminalError(rsp.StatusCode, fmt.Errorf("failed to power off droplet: %v", err))
+		}
+		return false, nil
+	case droplet.SizeSlug != c.Size && droplet.Status == "off":
+		// The disk is not resized, so the droplet can be resized down again
+		_, rsp, err = client.DropletActions.Resize(ctx, droplet.ID, c.Size, false)
+		if err != nil {
+			return false, doStatusAndErrToTerminalError(rsp.StatusCode, fmt.Errorf("failed to resize droplet to %s: %v", c.Size, err))
+		}
+		return false, nil
+	case droplet.Status == "off":
+		_, rsp, err = client.DropletActions.PowerOn(ctx, droplet.ID)
+		if err != nil {
+			return false, doStatusAndErrToTerminalError(rsp.StatusCode, fmt.Errorf("failed to power on droplet: %v", err))
+		}
+		return false, nil
+	}
+
+	return droplet.Status == "active", nil
+}
+
+// ValidateUpdate only allows changes of the size, Update can't apply any other change to an existing droplet
+func (p *provider) ValidateUpdate(oldSpec, newSpec v1alpha1.MachineSpec) error {
+	oldConfig, err := providerconfigtypes.GetConfig(oldSpec.ProviderSpec)
+	if err != nil {
+		return err
+	}
+	newConfig, err := providerconfigtypes.GetConfig(newSpec.ProviderSpec)
+	if err != nil {
+		return err
+	}
+	changed, err := cloudproviderutil.ChangedFields(oldConfig.CloudProviderSpec.Raw, newConfig.CloudProviderSpec.Raw)
+	if err != nil {
+		return err
+	}
+
+	allErrs := field.ErrorList{}
+	for _, name := range changed {
+		if name != "size" {
+			allErrs = append(allErrs, field.Forbidden(providerconfigtypes.CloudProviderSpecPath.Child(name), "can't be changed in place, only the size can"))
+		}
+	}
+	return allErrs.ToAggregate()
+}
+
 func (p *provider) GetCloudConfig(spec v1alpha1.MachineSpec) (config string, name string, err error) {
 	return "", "", nil
 }
@@ -514,6 +739,28 @@ func (d *doInstance) Addresses() map[string]v1.NodeAddressType {
 	return addresses
 }
 
+// Metadata returns the image, creation time, region and tags of the droplet. Tags of DigitalOcean have no
+// values, DigitalOcean doesn't expose the host of a droplet.
+func (d *doInstance) Metadata() instance.Metadata {
+	metadata := instance.Metadata{Tags: map[string]string{}}
+	if d.droplet.Image != nil {
+		metadata.Image = d.droplet.Image.Slug
+		if metadata.Image == "" {
+			metadata.Image = d.droplet.Image.Name
+		}
+	}
+	if created, err := time.Parse(time.RFC3339, d.droplet.Created); err == nil {
+		metadata.Created = created
+	}
+	if d.droplet.Region != nil {
+		metadata.Location = d.droplet.Region.Slug
+	}
+	for _, tag := range d.droplet.Tags {
+		metadata.Tags[tag] = ""
+	}
+	return metadata
+}
+
 func (d *doInstance) Status() instance.Status {
 	switch d.droplet.Status {
 	case "new":
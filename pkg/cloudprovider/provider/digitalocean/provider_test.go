@@ -0,0 +1,243 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package digitalocean
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/digitalocean/godo"
+
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/common/ssh"
+)
+
+// fakeKeysService holds the keys of an account by fingerprint. Only the methods used for
+// uploading keys are implemented.
+type fakeKeysService struct {
+	godo.KeysService
+
+	keys map[string]*godo.Key
+	// uploadedConcurrently is uploaded right before the next call to Create, like another worker would
+	uploadedConcurrently *godo.Key
+	createErr            error
+	creates              int
+}
+
+func response(status int) *godo.Response {
+	return &godo.Response{Response: &http.Response{StatusCode: status}}
+}
+
+func (f *fakeKeysService) GetByFingerprint(_ context.Context, fingerprint string) (*godo.Key, *godo.Response, error) {
+	key, exists := f.keys[fingerprint]
+	if !exists {
+		return nil, response(http.StatusNotFound), errors.New("not found")
+	}
+	return key, response(http.StatusOK), nil
+}
+
+func (f *fakeKeysService) Create(_ context.Context, req *godo.KeyCreateRequest) (*godo.Key, *godo.Response, error) {
+	f.creates++
+	if f.createErr != nil {
+		return nil, nil, f.createErr
+	}
+	if f.uploadedConcurrently != nil {
+		f.keys[f.uploadedConcurrently.Fingerprint] = f.uploadedConcurrently
+		f.uploadedConcurrently = nil
+		return nil, response(http.StatusUnprocessableEntity), errors.New("SSH Key is already in use on your account")
+	}
+	fingerprint := "fingerprint-" + req.Name
+	f.keys[fingerprint] = &godo.Key{Name: req.Name, Fingerprint: fingerprint, PublicKey: req.PublicKey}
+	return f.keys[fingerprint], response(http.StatusCreated), nil
+}
+
+func TestUploadSSHPublicKey(t *testing.T) {
+	newKey := func(operatorProvided bool) *ssh.Pubkey {
+		key, err := ssh.NewKey()
+		if err != nil {
+			t.Fatalf("failed to create key: %v", err)
+		}
+		key.OperatorProvided = operatorProvided
+		return key
+	}
+	temporaryKey := newKey(false)
+	operatorKey := newKey(true)
+
+	tests := []struct {
+		name                string
+		key                 *ssh.Pubkey
+		service             *fakeKeysService
+		expectedFingerprint string
+		expectedUploaded    bool
+		expectedCreates     int
+		err                 bool
+	}{
+		{
+			name:                "temporary key",
+			key:                 temporaryKey,
+			service:             &fakeKeysService{keys: map[string]*godo.Key{}},
+			expectedFingerprint: "fingerprint-" + temporaryKey.Name,
+			expectedUploaded:    true,
+			expectedCreates:     1,
+		},
+		{
+			name: "temporary key exists already",
+			key:  temporaryKey,
+			service: &fakeKeysService{keys: map[string]*godo.Key{
+				temporaryKey.FingerprintMD5: {Fingerprint: temporaryKey.FingerprintMD5},
+			}},
+			err: true,
+		},
+		{
+			name:                "operator key",
+			key:                 operatorKey,
+			service:             &fakeKeysService{keys: map[string]*godo.Key{}},
+			expectedFingerprint: "fingerprint-" + operatorKey.Name,
+			expectedCreates:     1,
+		},
+		{
+			name: "operator key exists already",
+			key:  operatorKey,
+			service: &fakeKeysService{keys: map[string]*godo.Key{
+				operatorKey.FingerprintMD5: {Fingerprint: operatorKey.FingerprintMD5},
+			}},
+			expectedFingerprint: operatorKey.FingerprintMD5,
+		},
+		{
+			name: "operator key uploaded concurrently",
+			key:  operatorKey,
+			service: &fakeKeysService{
+				keys:                 map[string]*godo.Key{},
+				uploadedConcurrently: &godo.Key{Fingerprint: operatorKey.FingerprintMD5},
+			},
+			expectedFingerprint: operatorKey.FingerprintMD5,
+			expectedCreates:     1,
+		},
+		{
+			name: "temporary key conflicts",
+			key:  temporaryKey,
+			service: &fakeKeysService{
+				keys:                 map[string]*godo.Key{},
+				uploadedConcurrently: &godo.Key{Fingerprint: temporaryKey.FingerprintMD5},
+			},
+			expectedCreates: 1,
+			err:             true,
+		},
+		{
+			name: "create fails without response",
+			key:  operatorKey,
+			service: &fakeKeysService{
+				keys:      map[string]*godo.Key{},
+				createErr: errors.New("connection refused"),
+			},
+			expectedCreates: 1,
+			err:             true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fingerprint, uploaded, err := uploadSSHPublicKey(context.Background(), test.service, test.key)
+			if (err != nil) != test.err {
+				t.Fatalf("expected err to be %v, but got %v", test.err, err)
+			}
+			if fingerprint != test.expectedFingerprint {
+				t.Errorf("expected fingerprint %q, but got %q", test.expectedFingerprint, fingerprint)
+			}
+			if uploaded != test.expectedUploaded {
+				t.Errorf("expected uploaded to be %v, but got %v", test.expectedUploaded, uploaded)
+			}
+			if test.service.creates != test.expectedCreates {
+				t.Errorf("expected %d calls to create, but got %d", test.expectedCreates, test.service.creates)
+			}
+		})
+	}
+}
+
+// fakeRegionsService counts the listings of the regions
+type fakeRegionsService struct {
+	godo.RegionsService
+
+	lists int
+	err   error
+}
+
+func (f *fakeRegionsService) List(context.Context, *godo.ListOptions) ([]godo.Region, *godo.Response, error) {
+	f.lists++
+	if f.err != nil {
+		return nil, response(http.StatusTooManyRequests), f.err
+	}
+	return []godo.Region{{Slug: "fra1"}}, response(http.StatusOK), nil
+}
+
+func TestListRegionsIsCachedPerToken(t *testing.T) {
+	service := &fakeRegionsService{}
+	for _, token := range []string{"catalog-token-1", "catalog-token-1", "catalog-token-2"} {
+		regions, err := listRegions(context.Background(), service, token)
+		if err != nil {
+			t.Fatalf("failed to list regions: %v", err)
+		}
+		if len(regions) != 1 || regions[0].Slug != "fra1" {
+			t.Errorf("expected region fra1, got %v", regions)
+		}
+	}
+	if service.lists != 2 {
+		t.Errorf("expected the regions to be listed once per token, got %d listings", service.lists)
+	}
+
+	failing := &fakeRegionsService{err: errors.New("too many requests")}
+	for i := 0; i < 2; i++ {
+		if _, err := listRegions(context.Background(), failing, "catalog-token-3"); err == nil {
+			t.Fatal("expected the error of the API")
+		}
+	}
+	if failing.lists != 2 {
+		t.Errorf("expected errors not to be cached, got %d listings", failing.lists)
+	}
+}
+
+// pagedSizesService serves two sizes on two pages
+type pagedSizesService struct {
+	godo.SizesService
+}
+
+func (f *pagedSizesService) List(_ context.Context, opt *godo.ListOptions) ([]godo.Size, *godo.Response, error) {
+	resp := response(http.StatusOK)
+	if opt.Page < 2 {
+		resp.Links = &godo.Links{Pages: &godo.Pages{
+			Next: "https://api.digitalocean.com/v2/sizes?page=2",
+			Last: "https://api.digitalocean.com/v2/sizes?page=2",
+		}}
+		return []godo.Size{{Slug: "s-1vcpu-1gb"}}, resp, nil
+	}
+	resp.Links = &godo.Links{Pages: &godo.Pages{
+		First: "https://api.digitalocean.com/v2/sizes?page=1",
+		Prev:  "https://api.digitalocean.com/v2/sizes?page=1",
+	}}
+	return []godo.Size{{Slug: "s-2vcpu-2gb"}}, resp, nil
+}
+
+func TestListSizesFollowsPages(t *testing.T) {
+	sizes, err := listSizes(context.Background(), &pagedSizesService{}, "catalog-token-paged")
+	if err != nil {
+		t.Fatalf("failed to list sizes: %v", err)
+	}
+	if len(sizes) != 2 || sizes[0].Slug != "s-1vcpu-1gb" || sizes[1].Slug != "s-2vcpu-2gb" {
+		t.Errorf("expected the sizes of both pages, got %v", sizes)
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 type RawConfig struct {
 	Token             providerconfigtypes.ConfigVarString   `json:"token,omitempty"`
+	APIEndpoint       providerconfigtypes.ConfigVarString   `json:"apiEndpoint,omitempty"`
 	Region            providerconfigtypes.ConfigVarString   `json:"region"`
 	Size              providerconfigtypes.ConfigVarString   `json:"size"`
 	Backups           providerconfigtypes.ConfigVarBool     `json:"backups"`
@@ -17,11 +17,17 @@ limitations under the License.
 package fake
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
@@ -33,23 +39,83 @@ import (
 
 type provider struct{}
 
+// CloudProviderSpec configures how the fake cloud provider simulates the instances of a machine. The
+// instances only exist in the memory of the process, they are gone after a restart.
 type CloudProviderSpec struct {
 	PassValidation bool `json:"passValidation"`
+
+	// CreateLatency is how long creating an instance takes, e.G. "2s".
+	CreateLatency string `json:"createLatency,omitempty"`
+	// BootLatency is how long a created instance is creating before it runs.
+	BootLatency string `json:"bootLatency,omitempty"`
+	// DeleteLatency is how long a deleted instance is deleting before it is gone.
+	DeleteLatency string `json:"deleteLatency,omitempty"`
+
+	// CreateFailureRate is the share of the calls to create an instance which fail, between 0 and 1.
+	CreateFailureRate float64 `json:"createFailureRate,omitempty"`
+	// GetFailureRate is the share of the calls to get an instance which fail, between 0 and 1.
+	GetFailureRate float64 `json:"getFailureRate,omitempty"`
+	// DeleteFailureRate is the share of the calls to delete an instance which fail, between 0 and 1.
+	DeleteFailureRate float64 `json:"deleteFailureRate,omitempty"`
 }
 
-type CloudProviderInstance struct{}
+type fakeConfig struct {
+	createLatency time.Duration
+	bootLatency   time.Duration
+	deleteLatency time.Duration
+
+	createFailureRate float64
+	getFailureRate    float64
+	deleteFailureRate float64
+}
+
+// CloudProviderInstance is an instance simulated by the fake cloud provider
+type CloudProviderInstance struct {
+	name     string
+	id       string
+	address  string
+	created  time.Time
+	running  time.Time
+	deleting *time.Time
+	gone     time.Time
+}
 
 func (f CloudProviderInstance) Name() string {
-	return ""
+	return f.name
 }
 func (f CloudProviderInstance) ID() string {
-	return ""
+	return f.id
 }
 func (f CloudProviderInstance) Addresses() map[string]v1.NodeAddressType {
-	return nil
+	if f.address == "" {
+		return nil
+	}
+	return map[string]v1.NodeAddressType{f.address: v1.NodeInternalIP}
 }
 func (f CloudProviderInstance) Status() instance.Status {
-	return instance.StatusUnknown
+	now := time.Now()
+	switch {
+	case f.deleting != nil:
+		return instance.StatusDeleting
+	case now.Before(f.running):
+		return instance.StatusCreating
+	default:
+		return instance.StatusRunning
+	}
+}
+func (f CloudProviderInstance) Metadata() instance.Metadata {
+	return instance.Metadata{Created: f.created, Location: "fake"}
+}
+
+// instances holds the simulated instances of all machines by their UID. The providers are created
+// for every reconciliation, so it lives as long as the process.
+var instances = &instanceStore{instances: map[types.UID]*CloudProviderInstance{}}
+
+type instanceStore struct {
+	lock      sync.Mutex
+	instances map[types.UID]*CloudProviderInstance
+	// created counts the created instances for their IDs and addresses
+	created int
 }
 
 // New returns a fake cloud provider
@@ -57,21 +123,89 @@ func New(_ *providerconfig.ConfigVarResolver) cloudprovidertypes.Provider {
 	return &provider{}
 }
 
+func getConfig(spec v1alpha1.ProviderSpec) (*fakeConfig, *CloudProviderSpec, error) {
+	if spec.Value == nil {
+		return nil, nil, fmt.Errorf("machine.spec.providerconfig.value is nil")
+	}
+	pconfig := providerconfigtypes.Config{}
+	if err := json.Unmarshal(spec.Value.Raw, &pconfig); err != nil {
+		return nil, nil, err
+	}
+	fakeCloudProviderSpec := CloudProviderSpec{}
+	if err := json.Unmarshal(pconfig.CloudProviderSpec.Raw, &fakeCloudProviderSpec); err != nil {
+		return nil, nil, err
+	}
+
+	c := &fakeConfig{
+		createFailureRate: fakeCloudProviderSpec.CreateFailureRate,
+		getFailureRate:    fakeCloudProviderSpec.GetFailureRate,
+		deleteFailureRate: fakeCloudProviderSpec.DeleteFailureRate,
+	}
+	var err error
+	if c.createLatency, err = parseLatency(fakeCloudProviderSpec.CreateLatency); err != nil {
+		return nil, nil, fmt.Errorf("invalid createLatency: %v", err)
+	}
+	if c.bootLatency, err = parseLatency(fakeCloudProviderSpec.BootLatency); err != nil {
+		return nil, nil, fmt.Errorf("invalid bootLatency: %v", err)
+	}
+	if c.deleteLatency, err = parseLatency(fakeCloudProviderSpec.DeleteLatency); err != nil {
+		return nil, nil, fmt.Errorf("invalid deleteLatency: %v", err)
+	}
+	return c, &fakeCloudProviderSpec, nil
+}
+
+func parseLatency(latency string) (time.Duration, error) {
+	if latency == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(latency)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return d, nil
+}
+
+// injectFailure returns an error for the given share of the calls of the given operation
+func injectFailure(operation string, rate float64) error {
+	if rate > 0 && rand.Float64() < rate {
+		return fmt.Errorf("injected failure of the %s operation", operation)
+	}
+	return nil
+}
+
+// wait simulates the latency of a call to the cloud provider, it gives up once the context is done
+func wait(ctx context.Context, latency time.Duration) error {
+	if latency == 0 {
+		return nil
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (p *provider) AddDefaults(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, error) {
 	return spec, nil
 }
 
 // Validate returns success or failure based according to its FakeCloudProviderSpec
 func (p *provider) Validate(machinespec v1alpha1.MachineSpec) error {
-	pconfig := providerconfigtypes.Config{}
-	err := json.Unmarshal(machinespec.ProviderSpec.Value.Raw, &pconfig)
+	c, fakeCloudProviderSpec, err := getConfig(machinespec.ProviderSpec)
 	if err != nil {
 		return err
 	}
 
-	fakeCloudProviderSpec := CloudProviderSpec{}
-	if err = json.Unmarshal(pconfig.CloudProviderSpec.Raw, &fakeCloudProviderSpec); err != nil {
-		return err
+	for name, rate := range map[string]float64{"createFailureRate": c.createFailureRate, "getFailureRate": c.getFailureRate, "deleteFailureRate": c.deleteFailureRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s must be between 0 and 1", name)
+		}
 	}
 
 	if fakeCloudProviderSpec.PassValidation {
@@ -84,7 +218,25 @@ func (p *provider) Validate(machinespec v1alpha1.MachineSpec) error {
 }
 
 func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (instance.Instance, error) {
-	return CloudProviderInstance{}, nil
+	c, _, err := getConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, err
+	}
+	if err := injectFailure("get", c.getFailureRate); err != nil {
+		return nil, err
+	}
+
+	instances.lock.Lock()
+	defer instances.lock.Unlock()
+	inst, found := instances.instances[machine.UID]
+	if !found {
+		return nil, cloudprovidererrors.ErrInstanceNotFound
+	}
+	if inst.deleting != nil && !time.Now().Before(inst.gone) {
+		delete(instances.instances, machine.UID)
+		return nil, cloudprovidererrors.ErrInstanceNotFound
+	}
+	return *inst, nil
 }
 
 func (p *provider) GetCloudConfig(spec v1alpha1.MachineSpec) (string, string, error) {
@@ -92,18 +244,74 @@ func (p *provider) GetCloudConfig(spec v1alpha1.MachineSpec) (string, string, er
 }
 
 // Create creates a cloud instance according to the given machine
-func (p *provider) Create(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData, _ string) (instance.Instance, error) {
-	return CloudProviderInstance{}, nil
+func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData, _ string) (instance.Instance, error) {
+	c, _, err := getConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, err
+	}
+	if err := wait(data.Context(), c.createLatency); err != nil {
+		return nil, err
+	}
+	if err := injectFailure("create", c.createFailureRate); err != nil {
+		return nil, err
+	}
+
+	instances.lock.Lock()
+	defer instances.lock.Unlock()
+	instances.created++
+	now := time.Now()
+	inst := &CloudProviderInstance{
+		name:    machine.Spec.Name,
+		id:      fmt.Sprintf("fake-%d", instances.created),
+		address: fmt.Sprintf("10.%d.%d.%d", instances.created>>16&0xff, instances.created>>8&0xff, instances.created&0xff),
+		created: now,
+		running: now.Add(c.bootLatency),
+	}
+	instances.instances[machine.UID] = inst
+	return *inst, nil
 }
 
-func (p *provider) Cleanup(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+func (p *provider) Cleanup(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	instances.lock.Lock()
+	defer instances.lock.Unlock()
+	inst, found := instances.instances[machine.UID]
+	if !found {
+		return true, nil
+	}
+
+	c, _, err := getConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return false, err
+	}
+	if err := injectFailure("delete", c.deleteFailureRate); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if inst.deleting == nil {
+		inst.deleting = &now
+		inst.gone = now.Add(c.deleteLatency)
+	}
+	if now.Before(inst.gone) {
+		return false, nil
+	}
+	delete(instances.instances, machine.UID)
 	return true, nil
 }
 
 func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
+	instances.lock.Lock()
+	defer instances.lock.Unlock()
+	if inst, found := instances.instances[machine.UID]; found {
+		delete(instances.instances, machine.UID)
+		instances.instances[new] = inst
+	}
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
 	return map[string]string{}, nil
 }
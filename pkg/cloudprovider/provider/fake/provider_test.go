@@ -0,0 +1,114 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func testMachine(t *testing.T, uid types.UID, spec CloudProviderSpec) *v1alpha1.Machine {
+	rawSpec, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawConfig, err := json.Marshal(providerconfigtypes.Config{
+		CloudProvider:     providerconfigtypes.CloudProviderFake,
+		CloudProviderSpec: runtime.RawExtension{Raw: rawSpec},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &v1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: string(uid), UID: uid},
+		Spec: v1alpha1.MachineSpec{
+			ObjectMeta:   metav1.ObjectMeta{Name: string(uid)},
+			ProviderSpec: v1alpha1.ProviderSpec{Value: &runtime.RawExtension{Raw: rawConfig}},
+		},
+	}
+}
+
+func TestInstanceLifecycle(t *testing.T) {
+	p := New(nil)
+	machine := testMachine(t, "lifecycle", CloudProviderSpec{PassValidation: true, BootLatency: "1h", DeleteLatency: "1h"})
+
+	if _, err := p.Get(machine, nil); err != cloudprovidererrors.ErrInstanceNotFound {
+		t.Fatalf("expected the instance not to be found before it got created, got %v", err)
+	}
+	if _, err := p.Create(machine, nil, ""); err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	inst, err := p.Get(machine, nil)
+	if err != nil {
+		t.Fatalf("failed to get instance: %v", err)
+	}
+	if inst.Status() != instance.StatusCreating {
+		t.Errorf("expected the instance to be creating during its boot latency, got %s", inst.Status())
+	}
+	if len(inst.Addresses()) != 1 {
+		t.Errorf("expected the instance to have one address, got %v", inst.Addresses())
+	}
+
+	done, err := p.Cleanup(machine, nil)
+	if err != nil || done {
+		t.Fatalf("expected the cleanup to wait for the delete latency, got done %t and error %v", done, err)
+	}
+	inst, err = p.Get(machine, nil)
+	if err != nil {
+		t.Fatalf("failed to get instance: %v", err)
+	}
+	if inst.Status() != instance.StatusDeleting {
+		t.Errorf("expected the instance to be deleting, got %s", inst.Status())
+	}
+
+	// the instance is gone once the delete latency passed
+	instances.instances[machine.UID].gone = time.Now()
+	done, err = p.Cleanup(machine, nil)
+	if err != nil || !done {
+		t.Fatalf("expected the cleanup to be done, got done %t and error %v", done, err)
+	}
+	if _, err := p.Get(machine, nil); err != cloudprovidererrors.ErrInstanceNotFound {
+		t.Errorf("expected the instance not to be found after the cleanup, got %v", err)
+	}
+}
+
+func TestFailureInjection(t *testing.T) {
+	p := New(nil)
+	machine := testMachine(t, "failures", CloudProviderSpec{PassValidation: true, CreateFailureRate: 1})
+
+	if _, err := p.Create(machine, nil, ""); err == nil {
+		t.Error("expected the create to fail with a failure rate of 1")
+	}
+	if _, err := p.Get(machine, nil); err != cloudprovidererrors.ErrInstanceNotFound {
+		t.Errorf("expected no instance after the failed create, got %v", err)
+	}
+
+	invalid := testMachine(t, "invalid", CloudProviderSpec{PassValidation: true, GetFailureRate: 2})
+	if err := p.Validate(invalid.Spec); err == nil {
+		t.Error("expected a failure rate above 1 to be invalid")
+	}
+}
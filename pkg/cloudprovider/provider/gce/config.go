@@ -42,14 +42,20 @@ const (
 
 // imageProjects maps the OS to the Google Cloud image projects
 var imageProjects = map[providerconfigtypes.OperatingSystem]string{
-	providerconfigtypes.OperatingSystemCoreos: "coreos-cloud",
-	providerconfigtypes.OperatingSystemUbuntu: "ubuntu-os-cloud",
+	providerconfigtypes.OperatingSystemCoreos:       "coreos-cloud",
+	providerconfigtypes.OperatingSystemUbuntu:       "ubuntu-os-cloud",
+	providerconfigtypes.OperatingSystemFedoraCoreOS: "fedora-coreos-cloud",
+	providerconfigtypes.OperatingSystemSLES:         "suse-cloud",
+	providerconfigtypes.OperatingSystemOpenSUSE:     "opensuse-cloud",
 }
 
 // imageFamilies maps the OS to the Google Cloud image projects
 var imageFamilies = map[providerconfigtypes.OperatingSystem]string{
-	providerconfigtypes.OperatingSystemCoreos: "coreos-stable",
-	providerconfigtypes.OperatingSystemUbuntu: "ubuntu-1804-lts",
+	providerconfigtypes.OperatingSystemCoreos:       "coreos-stable",
+	providerconfigtypes.OperatingSystemUbuntu:       "ubuntu-1804-lts",
+	providerconfigtypes.OperatingSystemFedoraCoreOS: "fedora-coreos-stable",
+	providerconfigtypes.OperatingSystemSLES:         "sles-15",
+	providerconfigtypes.OperatingSystemOpenSUSE:     "opensuse-leap",
 }
 
 // diskTypes are the disk types of the Google Cloud. Map is used for
@@ -123,7 +129,7 @@ func newConfig(resolver *providerconfig.ConfigVarResolver, spec v1alpha1.Provide
 		diskSize:       cpSpec.DiskSize,
 	}
 
-	cfg.serviceAccount, err = resolver.GetConfigVarStringValueOrEnv(cpSpec.ServiceAccount, envGoogleServiceAccount)
+	cfg.serviceAccount, err = resolver.ForCredentialProfile(providerConfig.CredentialProfile).GetConfigVarStringValueOrEnv(cpSpec.ServiceAccount, envGoogleServiceAccount)
 	if err != nil {
 		return nil, fmt.Errorf("cannot retrieve service account: %v", err)
 	}
@@ -115,3 +115,16 @@ func (gi *googleInstance) Status() instance.Status {
 	// Must not happen.
 	return instance.StatusUnknown
 }
+
+// Interrupted implements instance.InterruptibleInstance. Preempted instances are stopped by GCE
+// and stay terminated.
+func (gi *googleInstance) Interrupted() bool {
+	if gi.ci.Scheduling == nil || !gi.ci.Scheduling.Preemptible {
+		return false
+	}
+	switch gi.ci.Status {
+	case statusInstanceStopping, statusInstanceStopped, statusInstanceTerminated:
+		return true
+	}
+	return false
+}
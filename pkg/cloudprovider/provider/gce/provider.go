@@ -360,6 +360,10 @@ func (p *Provider) MigrateUID(machine *v1alpha1.Machine, newUID types.UID) error
 	return nil
 }
 
+func (p *Provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, errors.ErrUpdateNotSupported
+}
+
 // SetMetricsForMachines allows providers to provide provider-specific metrics.
 func (p *Provider) SetMetricsForMachines(machines v1alpha1.MachineList) error {
 	return nil
@@ -21,12 +21,16 @@ limitations under the License.
 package gce
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"golang.org/x/oauth2"
 	"google.golang.org/api/compute/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 )
 
 const (
@@ -51,7 +55,11 @@ type service struct {
 
 // connectComputeService establishes a service connection to the Compute Engine.
 func connectComputeService(cfg *config) (*service, error) {
-	svc, err := compute.New(cfg.jwtConfig.Client(oauth2.NoContext))
+	// The client of the context is used to get the tokens and to send the requests
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{
+		Transport: cloudproviderutil.NewTransport("gce", nil, cfg.jwtConfig.Email),
+	})
+	svc, err := compute.New(cfg.jwtConfig.Client(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("cannot connect to Google Cloud: %v", err)
 	}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hetzner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	hetznertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/hetzner/types"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ResolveInstanceType picks the cheapest server type which meets the instanceRequirements of the spec,
+// unless the spec already sets a server type. The prices of the location of the spec are compared, or
+// the lowest price of each server type if the spec has no location.
+func (p *provider) ResolveInstanceType(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, string, error) {
+	c, pc, err := p.getConfig(spec.ProviderSpec)
+	if err != nil {
+		return spec, "", fmt.Errorf("failed to parse config: %v", err)
+	}
+	if c.ServerType != "" || pc.InstanceRequirements == nil {
+		return spec, c.ServerType, nil
+	}
+	if c.Token == "" {
+		return spec, "", field.Required(providerconfigtypes.CloudProviderSpecPath.Child("token"), "")
+	}
+
+	ctx := context.TODO()
+	client := getClient(c.Token)
+
+	location, err := configLocation(ctx, client, c)
+	if err != nil {
+		return spec, "", err
+	}
+
+	serverTypes, err := client.ServerType.All(ctx)
+	if err != nil {
+		return spec, "", fmt.Errorf("failed to list server types: %v", err)
+	}
+	serverType, err := cheapestServerType(serverTypes, location, *pc.InstanceRequirements)
+	if err != nil {
+		return spec, "", err
+	}
+
+	rawConfig := hetznertypes.RawConfig{}
+	if err := json.Unmarshal(pc.CloudProviderSpec.Raw, &rawConfig); err != nil {
+		return spec, "", err
+	}
+	rawConfig.ServerType.Value = serverType.Name
+	spec.ProviderSpec.Value, err = setProviderSpec(rawConfig, spec.ProviderSpec)
+	return spec, serverType.Name, err
+}
+
+// configLocation returns the location of the config, which is the one of its datacenter if it sets one
+func configLocation(ctx context.Context, client *hcloud.Client, c *Config) (string, error) {
+	if c.Datacenter == "" {
+		return c.Location, nil
+	}
+	datacenter, _, err := client.Datacenter.Get(ctx, c.Datacenter)
+	if err != nil {
+		return "", fmt.Errorf("failed to get datacenter: %v", err)
+	}
+	if datacenter == nil {
+		return "", fmt.Errorf("datacenter %q not found", c.Datacenter)
+	}
+	return datacenter.Location.Name, nil
+}
+
+// cheapestServerType returns the server type with the lowest net hourly price which meets the requirements.
+// The catalog of Hetzner has no server types with GPUs.
+func cheapestServerType(serverTypes []*hcloud.ServerType, location string, requirements providerconfigtypes.InstanceRequirements) (*hcloud.ServerType, error) {
+	if requirements.GPUs > 0 {
+		return nil, fmt.Errorf("there are no server types with GPUs")
+	}
+
+	// Server types with the same price are ordered by their name, so the pick doesn't depend on the order of the listing
+	sorted := make([]*hcloud.ServerType, len(serverTypes))
+	copy(sorted, serverTypes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var cheapest *hcloud.ServerType
+	var cheapestPrice float64
+	for _, serverType := range sorted {
+		if serverType.Cores < int(requirements.CPUs) || int64(serverType.Memory*1024) < requirements.MemoryMB {
+			continue
+		}
+		price, found, err := hourlyPrice(serverType, location)
+		if err != nil {
+			return nil, err
+		}
+		if found && (cheapest == nil || price < cheapestPrice) {
+			cheapest, cheapestPrice = serverType, price
+		}
+	}
+	if cheapest == nil {
+		return nil, fmt.Errorf("no server type has at least %d CPUs and %d MiB of memory", requirements.CPUs, requirements.MemoryMB)
+	}
+	return cheapest, nil
+}
+
+// hourlyPrice returns the net hourly price of the server type in the given location, or its lowest price
+// if the location is empty. Server types which are not offered in the location have no price.
+func hourlyPrice(serverType *hcloud.ServerType, location string) (float64, bool, error) {
+	var lowest float64
+	var found bool
+	for _, pricing := range serverType.Pricings {
+		if location != "" && (pricing.Location == nil || pricing.Location.Name != location) {
+			continue
+		}
+		price, err := strconv.ParseFloat(pricing.Hourly.Net, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to parse price %q of server type %s: %v", pricing.Hourly.Net, serverType.Name, err)
+		}
+		if !found || price < lowest {
+			lowest, found = price, true
+		}
+	}
+	return lowest, found, nil
+}
+
+func setProviderSpec(rawConfig hetznertypes.RawConfig, s v1alpha1.ProviderSpec) (*runtime.RawExtension, error) {
+	if s.Value == nil {
+		return nil, fmt.Errorf("machine.spec.providerconfig.value is nil")
+	}
+	pconfig := providerconfigtypes.Config{}
+	err := json.Unmarshal(s.Value.Raw, &pconfig)
+	if err != nil {
+		return nil, err
+	}
+	rawCloudProviderSpec, err := json.Marshal(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+	pconfig.CloudProviderSpec = runtime.RawExtension{Raw: rawCloudProviderSpec}
+	rawPconfig, err := json.Marshal(pconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runtime.RawExtension{Raw: rawPconfig}, nil
+}
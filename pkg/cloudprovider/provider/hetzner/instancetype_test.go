@@ -0,0 +1,100 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hetzner
+
+import (
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+func TestCheapestServerType(t *testing.T) {
+	pricing := func(location, hourly string) hcloud.ServerTypeLocationPricing {
+		return hcloud.ServerTypeLocationPricing{
+			Location: &hcloud.Location{Name: location},
+			Hourly:   hcloud.Price{Currency: "EUR", Net: hourly},
+		}
+	}
+	serverTypes := []*hcloud.ServerType{
+		{Name: "cx11", Cores: 1, Memory: 2, Pricings: []hcloud.ServerTypeLocationPricing{pricing("fsn1", "0.0050"), pricing("hel1", "0.0050")}},
+		{Name: "cpx11", Cores: 2, Memory: 2, Pricings: []hcloud.ServerTypeLocationPricing{pricing("fsn1", "0.0070"), pricing("hel1", "0.0070")}},
+		{Name: "cx21", Cores: 2, Memory: 4, Pricings: []hcloud.ServerTypeLocationPricing{pricing("fsn1", "0.0090"), pricing("hel1", "0.0085")}},
+		{Name: "cpx21", Cores: 3, Memory: 4, Pricings: []hcloud.ServerTypeLocationPricing{pricing("fsn1", "0.0080")}},
+		{Name: "cx31", Cores: 2, Memory: 8, Pricings: []hcloud.ServerTypeLocationPricing{pricing("fsn1", "0.0150"), pricing("hel1", "0.0150")}},
+	}
+
+	tests := []struct {
+		name         string
+		location     string
+		requirements providerconfigtypes.InstanceRequirements
+		expectedName string
+		expectError  bool
+	}{
+		{
+			name:         "smallest server type",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 1, MemoryMB: 1024},
+			expectedName: "cx11",
+		},
+		{
+			name:         "memory rules out the cheaper server types",
+			location:     "hel1",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 2, MemoryMB: 4096},
+			expectedName: "cx21",
+		},
+		{
+			name:         "prices differ between locations",
+			location:     "fsn1",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 2, MemoryMB: 4096},
+			expectedName: "cpx21",
+		},
+		{
+			name:         "lowest price without location",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 2, MemoryMB: 4096},
+			expectedName: "cpx21",
+		},
+		{
+			name:         "too large",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 4, MemoryMB: 16384},
+			expectError:  true,
+		},
+		{
+			name:         "GPUs",
+			requirements: providerconfigtypes.InstanceRequirements{CPUs: 1, MemoryMB: 1024, GPUs: 1},
+			expectError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serverType, err := cheapestServerType(serverTypes, test.location, test.requirements)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected an error, got server type %s", serverType.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to pick server type: %v", err)
+			}
+			if serverType.Name != test.expectedName {
+				t.Errorf("expected server type %s, got %s", test.expectedName, serverType.Name)
+			}
+		})
+	}
+}
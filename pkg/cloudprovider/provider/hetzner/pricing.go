@@ -0,0 +1,58 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hetzner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+)
+
+// HourlyPrice returns the net hourly price in EUR of the server type of the spec in its location, or the
+// lowest price of the server type if the spec has no location
+func (p *provider) HourlyPrice(spec v1alpha1.MachineSpec) (float64, string, error) {
+	c, _, err := p.getConfig(spec.ProviderSpec)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to parse config: %v", err)
+	}
+	if c.ServerType == "" {
+		return 0, "", fmt.Errorf("spec has no server type")
+	}
+
+	ctx := context.TODO()
+	client := getClient(c.Token)
+	location, err := configLocation(ctx, client, c)
+	if err != nil {
+		return 0, "", err
+	}
+	serverType, _, err := client.ServerType.Get(ctx, c.ServerType)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get server type: %v", err)
+	}
+	if serverType == nil {
+		return 0, "", fmt.Errorf("server type %q not found", c.ServerType)
+	}
+	price, found, err := hourlyPrice(serverType, location)
+	if err != nil {
+		return 0, "", err
+	}
+	if !found {
+		return 0, "", fmt.Errorf("server type %q has no price in location %q", c.ServerType, location)
+	}
+	return price, "EUR", nil
+}
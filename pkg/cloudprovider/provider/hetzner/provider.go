@@ -19,7 +19,6 @@ package hetzner
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -33,11 +32,13 @@ import (
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
 	hetznertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/hetzner/types"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog"
 )
 
@@ -70,12 +71,23 @@ func getNameForOS(os providerconfigtypes.OperatingSystem) (string, error) {
 		return "ubuntu-18.04", nil
 	case providerconfigtypes.OperatingSystemCentOS:
 		return "centos-7", nil
+	case providerconfigtypes.OperatingSystemRockyLinux:
+		return "rocky-8", nil
+	case providerconfigtypes.OperatingSystemAlmaLinux:
+		return "alma-8", nil
 	}
 	return "", providerconfigtypes.ErrOSNotSupported
 }
 
+// clients are the API clients per token
+var clients = cloudproviderutil.NewClientPool("hetzner")
+
 func getClient(token string) *hcloud.Client {
-	return hcloud.NewClient(hcloud.WithToken(token))
+	// Building an hcloud client does not fail
+	client, _ := clients.Get("", []string{token}, func(httpClient *http.Client) (interface{}, error) {
+		return hcloud.NewClient(hcloud.WithToken(token), hcloud.WithHTTPClient(httpClient)), nil
+	})
+	return client.(*hcloud.Client)
 }
 
 func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigtypes.Config, error) {
@@ -94,7 +106,8 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 	}
 
 	c := Config{}
-	c.Token, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.Token, "HZ_TOKEN")
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.Token, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.Token, "HZ_TOKEN")
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"token\" field, error = %v", err)
 	}
@@ -138,7 +151,7 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	}
 
 	if c.Token == "" {
-		return errors.New("token is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("token"), "")
 	}
 
 	_, err = getNameForOS(pc.OperatingSystem)
@@ -186,7 +199,7 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	return nil
 }
 
-func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData, userdata string) (instance.Instance, error) {
+func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData, userdata string) (instance.Instance, error) {
 	c, pc, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, cloudprovidererrors.TerminalError{
@@ -195,7 +208,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provi
 		}
 	}
 
-	ctx := context.TODO()
+	ctx := data.Context()
 	client := getClient(c.Token)
 
 	if c.Image == "" {
@@ -263,22 +276,36 @@ func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provi
 		return nil, fmt.Errorf("failed to generate ssh key: %v", err)
 	}
 
-	hkey, res, err := client.SSHKey.Create(ctx, hcloud.SSHKeyCreateOpts{
-		Name:      sshkey.Name,
-		PublicKey: sshkey.PublicKey,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("creating temporary ssh key failed with error %v", err)
-	}
-	if res.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("got invalid http status code when creating ssh key: expected=%d, god=%d", http.StatusCreated, res.StatusCode)
+	var hkey *hcloud.SSHKey
+	if sshkey.OperatorProvided {
+		// Keys must be unique, the key of the operator may have been uploaded already
+		hkey, _, err = client.SSHKey.GetByFingerprint(ctx, sshkey.FingerprintMD5)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ssh key by fingerprint: %v", err)
+		}
 	}
-	defer func() {
-		_, err := client.SSHKey.Delete(ctx, hkey)
+	if hkey == nil {
+		var res *hcloud.Response
+		hkey, res, err = client.SSHKey.Create(ctx, hcloud.SSHKeyCreateOpts{
+			Name:      sshkey.Name,
+			PublicKey: sshkey.PublicKey,
+		})
 		if err != nil {
-			klog.Errorf("Failed to delete temporary ssh key: %v", err)
+			return nil, fmt.Errorf("creating temporary ssh key failed with error %v", err)
+		}
+		if res.StatusCode != http.StatusCreated {
+			return nil, fmt.Errorf("got invalid http status code when creating ssh key: expected=%d, god=%d", http.StatusCreated, res.StatusCode)
 		}
-	}()
+		// The key of the operator is kept, as other servers may be created with it concurrently
+		if !sshkey.OperatorProvided {
+			defer func() {
+				_, err := client.SSHKey.Delete(ctx, hkey)
+				if err != nil {
+					klog.Errorf("Failed to delete temporary ssh key: %v", err)
+				}
+			}()
+		}
+	}
 	serverCreateOpts.SSHKeys = []*hcloud.SSHKey{hkey}
 
 	serverCreateRes, res, err := client.Server.Create(ctx, serverCreateOpts)
@@ -309,7 +336,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.P
 		}
 	}
 
-	ctx := context.TODO()
+	ctx := data.Context()
 	client := getClient(c.Token)
 
 	res, err := client.Server.Delete(ctx, instance.(*hetznerServer).server)
@@ -326,7 +353,7 @@ func (p *provider) AddDefaults(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec,
 	return spec, nil
 }
 
-func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+func (p *provider) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
 	c, _, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, cloudprovidererrors.TerminalError{
@@ -335,10 +362,11 @@ func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provider
 		}
 	}
 
-	ctx := context.TODO()
+	ctx := data.Context()
 	client := getClient(c.Token)
 
-	servers, _, err := client.Server.List(ctx, hcloud.ServerListOpts{ListOpts: hcloud.ListOpts{
+	// AllWithOpts follows the pages of the result, List only returns the first one
+	servers, err := client.Server.AllWithOpts(ctx, hcloud.ServerListOpts{ListOpts: hcloud.ListOpts{
 		LabelSelector: machineUIDLabelKey + "==" + string(machine.UID),
 	}})
 	if err != nil {
@@ -354,6 +382,52 @@ func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provider
 	return nil, cloudprovidererrors.ErrInstanceNotFound
 }
 
+// AdoptInstance labels the server with the given ID with the UID of the machine, so Get finds it
+func (p *provider) AdoptInstance(machine *v1alpha1.Machine, instanceID string, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	c, _, err := p.getConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: fmt.Sprintf("Failed to parse MachineSpec, due to %v", err),
+		}
+	}
+	id, err := strconv.Atoi(instanceID)
+	if err != nil {
+		return nil, cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: fmt.Sprintf("Invalid server ID %q, it must be a number", instanceID),
+		}
+	}
+
+	ctx := data.Context()
+	client := getClient(c.Token)
+
+	server, _, err := client.Server.GetByID(ctx, id)
+	if err != nil {
+		return nil, hzErrorToTerminalError(err, "failed to get server")
+	}
+	if server == nil {
+		return nil, cloudprovidererrors.ErrInstanceNotFound
+	}
+	if uid, labeled := server.Labels[machineUIDLabelKey]; labeled && uid != string(machine.UID) {
+		return nil, cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: fmt.Sprintf("Server %d belongs to the machine with UID %s already", id, uid),
+		}
+	}
+
+	labels := map[string]string{}
+	for key, value := range server.Labels {
+		labels[key] = value
+	}
+	labels[machineUIDLabelKey] = string(machine.UID)
+	server, _, err = client.Server.Update(ctx, server, hcloud.ServerUpdateOpts{Labels: labels})
+	if err != nil {
+		return nil, hzErrorToTerminalError(err, "failed to label server")
+	}
+	return &hetznerServer{server: server}, nil
+}
+
 func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -394,6 +468,10 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) GetCloudConfig(spec v1alpha1.MachineSpec) (config string, name string, err error) {
 	return "", "", nil
 }
@@ -436,6 +514,25 @@ func (s *hetznerServer) Addresses() map[string]v1.NodeAddressType {
 	return addresses
 }
 
+// Metadata returns the image, creation time, datacenter and labels of the server. Hetzner doesn't
+// expose the host of a server.
+func (s *hetznerServer) Metadata() instance.Metadata {
+	metadata := instance.Metadata{
+		Created: s.server.Created,
+		Tags:    s.server.Labels,
+	}
+	if s.server.Image != nil {
+		metadata.Image = s.server.Image.Name
+		if metadata.Image == "" {
+			metadata.Image = strconv.Itoa(s.server.Image.ID)
+		}
+	}
+	if s.server.Datacenter != nil {
+		metadata.Location = s.server.Datacenter.Name
+	}
+	return metadata
+}
+
 func (s *hetznerServer) Status() instance.Status {
 	switch s.server.Status {
 	case hcloud.ServerStatusInitializing:
@@ -21,11 +21,9 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/linode/linodego"
@@ -38,12 +36,14 @@ import (
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
 	linodetypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/linode/types"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 type provider struct {
@@ -101,18 +101,21 @@ func getSlugForOS(os providerconfigtypes.OperatingSystem) (string, error) {
 	return "", providerconfigtypes.ErrOSNotSupported
 }
 
-func getClient(token string) linodego.Client {
-	tokenSource := &TokenSource{
-		AccessToken: token,
-	}
-
-	oauthClient := oauth2.NewClient(context.Background(), tokenSource)
+// clients are the API clients per token
+var clients = cloudproviderutil.NewClientPool("linode")
 
-	client := linodego.NewClient(oauthClient)
-	ua := fmt.Sprintf("Kubermatic linodego/%s", linodego.Version)
-	client.SetUserAgent(ua)
-
-	return client
+func getClient(token string) linodego.Client {
+	// Building a linodego client does not fail
+	client, _ := clients.Get("", []string{token}, func(httpClient *http.Client) (interface{}, error) {
+		httpClient.Transport = &oauth2.Transport{
+			Base:   httpClient.Transport,
+			Source: &TokenSource{AccessToken: token},
+		}
+		client := linodego.NewClient(httpClient)
+		client.SetUserAgent(fmt.Sprintf("Kubermatic linodego/%s", linodego.Version))
+		return client, nil
+	})
+	return client.(linodego.Client)
 }
 
 func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigtypes.Config, error) {
@@ -131,7 +134,8 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 	}
 
 	c := Config{}
-	c.Token, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.Token, "LINODE_TOKEN")
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.Token, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.Token, "LINODE_TOKEN")
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"token\" field, error = %v", err)
 	}
@@ -174,15 +178,15 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	}
 
 	if c.Token == "" {
-		return errors.New("token is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("token"), "")
 	}
 
 	if c.Region == "" {
-		return errors.New("region is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("region"), "")
 	}
 
 	if c.Type == "" {
-		return errors.New("type is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("type"), "")
 	}
 
 	_, err = getSlugForOS(pc.OperatingSystem)
@@ -216,7 +220,7 @@ func createRandomPassword() (string, error) {
 	return rootPass, nil
 }
 
-func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData, userdata string) (instance.Instance, error) {
+func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData, userdata string) (instance.Instance, error) {
 	c, pc, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, cloudprovidererrors.TerminalError{
@@ -225,7 +229,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provi
 		}
 	}
 
-	ctx := context.TODO()
+	ctx := data.Context()
 	client := getClient(c.Token)
 
 	sshkey, err := ssh.NewKey()
@@ -257,7 +261,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provi
 		PrivateIP:      c.PrivateNetworking,
 		RootPass:       randomPassword,
 		BackupsEnabled: c.Backups,
-		AuthorizedKeys: []string{strings.TrimSpace(sshkey.PublicKey)},
+		AuthorizedKeys: ssh.MergeKeys(sshkey, pc.SSHPublicKeys),
 		Tags:           append(c.Tags, string(machine.UID)),
 		StackScriptID:  cloudinitStackScriptID,
 		StackScriptData: map[string]string{
@@ -294,7 +298,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.P
 			Message: fmt.Sprintf("Failed to parse MachineSpec, due to %v", err),
 		}
 	}
-	ctx := context.TODO()
+	ctx := data.Context()
 	client := getClient(c.Token)
 
 	linodeID, err := strconv.Atoi(instance.ID())
@@ -319,7 +323,7 @@ func getListOptions(name string) *linodego.ListOptions {
 	return listOptions
 }
 
-func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+func (p *provider) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
 	c, _, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, cloudprovidererrors.TerminalError{
@@ -328,7 +332,7 @@ func (p *provider) Get(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provider
 		}
 	}
 
-	ctx := context.TODO()
+	ctx := data.Context()
 	client := getClient(c.Token)
 
 	listOptions := getListOptions(machine.Spec.Name)
@@ -386,6 +390,10 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) GetCloudConfig(spec v1alpha1.MachineSpec) (config string, name string, err error) {
 	return "", "", nil
 }
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	goopenstack "github.com/gophercloud/gophercloud/openstack"
+	oslimits "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/limits"
+	osflavors "github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+)
+
+// CheckCapacity checks that the instance, vCPU and RAM quotas of the project leave room for the given
+// number of servers of the flavor of the spec
+func (p *provider) CheckCapacity(spec v1alpha1.MachineSpec, count int) error {
+	c, _, _, err := p.getConfig(spec.ProviderSpec)
+	if err != nil {
+		return fmt.Errorf("failed to parse config: %v", err)
+	}
+
+	client, err := p.clientGetter(c)
+	if err != nil {
+		return osErrorToTerminalError(err, "failed to get a openstack client")
+	}
+	flavor, err := getFlavor(client, c.Region, c.Flavor)
+	if err != nil {
+		return osErrorToTerminalError(err, fmt.Sprintf("failed to get flavor %q", c.Flavor))
+	}
+	computeClient, err := goopenstack.NewComputeV2(client, gophercloud.EndpointOpts{Availability: gophercloud.AvailabilityPublic, Region: c.Region})
+	if err != nil {
+		return osErrorToTerminalError(err, "failed to get compute client")
+	}
+	limits, err := oslimits.Get(computeClient, nil).Extract()
+	if err != nil {
+		return osErrorToTerminalError(err, "failed to get limits")
+	}
+	return checkLimits(limits.Absolute, flavor, count)
+}
+
+// checkLimits returns a quota error listing every quota the servers would exceed, negative limits are unlimited
+func checkLimits(limits oslimits.Absolute, flavor *osflavors.Flavor, count int) error {
+	var exceeded []string
+	check := func(name string, max, used, requested int) {
+		if max >= 0 && used+requested > max {
+			exceeded = append(exceeded, fmt.Sprintf("%s (%d requested, %d of %d in use)", name, requested, used, max))
+		}
+	}
+	check("instances", limits.MaxTotalInstances, limits.TotalInstancesUsed, count)
+	check("vCPUs", limits.MaxTotalCores, limits.TotalCoresUsed, count*flavor.VCPUs)
+	check("RAM in MiB", limits.MaxTotalRAMSize, limits.TotalRAMUsed, count*flavor.RAM)
+	if len(exceeded) == 0 {
+		return nil
+	}
+	return cloudprovidererrors.TerminalError{
+		Reason:  common.QuotaExceededMachineError,
+		Message: fmt.Sprintf("creating %d servers of flavor %q exceeds the quotas of the project: %s", count, flavor.Name, strings.Join(exceeded, ", ")),
+	}
+}
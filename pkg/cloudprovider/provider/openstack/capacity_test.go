@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"testing"
+
+	oslimits "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/limits"
+	osflavors "github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+)
+
+func TestCheckLimits(t *testing.T) {
+	flavor := &osflavors.Flavor{Name: "m1.small", VCPUs: 2, RAM: 2048}
+	tests := []struct {
+		name          string
+		limits        oslimits.Absolute
+		count         int
+		expectedError string
+	}{
+		{
+			name: "within the quotas",
+			limits: oslimits.Absolute{
+				MaxTotalInstances: 10, TotalInstancesUsed: 5,
+				MaxTotalCores: 20, TotalCoresUsed: 10,
+				MaxTotalRAMSize: 20480, TotalRAMUsed: 10240,
+			},
+			count: 5,
+		},
+		{
+			name: "exceeding the vCPU quota",
+			limits: oslimits.Absolute{
+				MaxTotalInstances: 10, TotalInstancesUsed: 5,
+				MaxTotalCores: 16, TotalCoresUsed: 10,
+				MaxTotalRAMSize: 20480, TotalRAMUsed: 10240,
+			},
+			count:         5,
+			expectedError: `creating 5 servers of flavor "m1.small" exceeds the quotas of the project: vCPUs (10 requested, 10 of 16 in use)`,
+		},
+		{
+			name: "unlimited",
+			limits: oslimits.Absolute{
+				MaxTotalInstances: -1, TotalInstancesUsed: 50,
+				MaxTotalCores: -1, TotalCoresUsed: 100,
+				MaxTotalRAMSize: -1, TotalRAMUsed: 102400,
+			},
+			count: 50,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkLimits(test.limits, flavor, test.count)
+			if test.expectedError == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			_, reason, message := cloudprovidererrors.IsTerminalError(err)
+			if reason != common.QuotaExceededMachineError || message != test.expectedError {
+				t.Errorf("expected quota error %q, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/gophercloud/gophercloud"
 	goopenstack "github.com/gophercloud/gophercloud/openstack"
 	osavailabilityzones "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
+	osservergroups "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
 	osflavors "github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
 	osimages "github.com/gophercloud/gophercloud/openstack/compute/v2/images"
 	osregions "github.com/gophercloud/gophercloud/openstack/identity/v3/regions"
@@ -105,6 +106,31 @@ func getAvailabilityZone(client *gophercloud.ProviderClient, region, name string
 	return nil, errNotFound
 }
 
+// getServerGroup returns the server group with the given name or ID
+func getServerGroup(client *gophercloud.ProviderClient, region, nameOrID string) (*osservergroups.ServerGroup, error) {
+	computeClient, err := goopenstack.NewComputeV2(client, gophercloud.EndpointOpts{Region: region})
+	if err != nil {
+		return nil, err
+	}
+
+	allPages, err := osservergroups.List(computeClient).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := osservergroups.ExtractServerGroups(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range groups {
+		if g.ID == nameOrID || g.Name == nameOrID {
+			return &g, nil
+		}
+	}
+
+	return nil, errNotFound
+}
+
 func getImageByName(client *gophercloud.ProviderClient, region, name string) (*osimages.Image, error) {
 	computeClient, err := goopenstack.NewComputeV2(client, gophercloud.EndpointOpts{Region: region})
 	if err != nil {
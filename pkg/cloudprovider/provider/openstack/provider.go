@@ -28,6 +28,7 @@ import (
 	goopenstack "github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/bootfromvolume"
 	osextendedstatus "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/extendedstatus"
+	osschedulerhints "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/schedulerhints"
 	osservers "github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	osfloatingips "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
 	osnetworks "github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
@@ -42,6 +43,7 @@ import (
 	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/userdata/convert"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -97,6 +99,7 @@ type Config struct {
 	Subnet                string
 	FloatingIPPool        string
 	AvailabilityZone      string
+	ServerGroup           string
 	TrustDevicePath       bool
 	RootDiskSizeGB        *int
 	NodeVolumeAttachLimit *uint
@@ -130,20 +133,21 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 		return nil, nil, nil, err
 	}
 	c := Config{}
-	c.IdentityEndpoint, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.IdentityEndpoint, "OS_AUTH_URL")
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.IdentityEndpoint, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.IdentityEndpoint, "OS_AUTH_URL")
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get the value of \"identityEndpoint\" field, error = %v", err)
 	}
-	c.Username, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.Username, "OS_USER_NAME")
+	c.Username, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.Username, "OS_USER_NAME")
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get the value of \"username\" field, error = %v", err)
 	}
-	c.Password, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.Password, "OS_PASSWORD")
+	c.Password, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.Password, "OS_PASSWORD")
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get the value of \"password\" field, error = %v", err)
 	}
 	// Ignore Region not found as Region might not be found and we can default it later
-	c.Region, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.Region, "OS_REGION_NAME")
+	c.Region, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.Region, "OS_REGION_NAME")
 	if err != nil {
 		klog.V(6).Infof("Region from configuration or environment variable not found")
 	}
@@ -186,16 +190,16 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 	}
 
 	// We ignore errors here because the OS domain is only required when using Identity API V3
-	c.DomainName, _ = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.DomainName, "OS_DOMAIN_NAME")
-	c.TenantName, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.TenantName, "OS_TENANT_NAME")
+	c.DomainName, _ = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.DomainName, "OS_DOMAIN_NAME")
+	c.TenantName, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.TenantName, "OS_TENANT_NAME")
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get the value of \"tenantName\" field, error = %v", err)
 	}
-	c.TenantID, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.TenantID, "OS_TENANT_ID")
+	c.TenantID, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.TenantID, "OS_TENANT_ID")
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get the value of \"tenantID\" field, error = %v", err)
 	}
-	c.TokenID, err = p.configVarResolver.GetConfigVarStringValue(rawConfig.TokenID)
+	c.TokenID, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.TokenID, "OS_TOKEN")
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -230,6 +234,10 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	c.ServerGroup, err = p.configVarResolver.GetConfigVarStringValue(rawConfig.ServerGroup)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	c.TrustDevicePath, err = p.configVarResolver.GetConfigVarBoolValue(rawConfig.TrustDevicePath)
 	if err != nil {
 		return nil, nil, nil, err
@@ -279,7 +287,11 @@ func getClient(c *Config) (*gophercloud.ProviderClient, error) {
 
 	pc, err := goopenstack.AuthenticatedClient(opts)
 	if pc != nil {
-		pc.HTTPClient = cloudproviderutil.HTTPClientConfig{LogPrefix: "[OpenStack API]"}.New()
+		pc.HTTPClient = cloudproviderutil.HTTPClientConfig{
+			LogPrefix:   "[OpenStack API]",
+			Provider:    "openstack",
+			Credentials: []string{c.IdentityEndpoint, c.DomainName, c.TenantName, c.TenantID, c.Username, c.TokenID},
+		}.New()
 	}
 
 	return pc, err
@@ -449,6 +461,12 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 		}
 	}
 
+	if c.ServerGroup != "" {
+		if _, err := getServerGroup(client, c.Region, c.ServerGroup); err != nil {
+			return fmt.Errorf("failed to get server group %q: %v", c.ServerGroup, err)
+		}
+	}
+
 	// validate reserved tags
 	if _, ok := c.Tags[machineUIDMetaKey]; ok {
 		return fmt.Errorf("the tag with the given name =%s is reserved, choose a different one", machineUIDMetaKey)
@@ -458,7 +476,7 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 }
 
 func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData, userdata string) (instance.Instance, error) {
-	c, _, _, err := p.getConfig(machine.Spec.ProviderSpec)
+	c, pc, _, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, cloudprovidererrors.TerminalError{
 			Reason:  common.InvalidConfigurationMachineError,
@@ -466,6 +484,11 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 		}
 	}
 
+	userdata, err = convert.GzipCloudInit(pc.OperatingSystem, userdata)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := p.clientGetter(c)
 	if err != nil {
 		return nil, osErrorToTerminalError(err, "failed to get a openstack client")
@@ -515,6 +538,16 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 		Metadata:         allTags,
 	}
 
+	// The policy of the server group, e.g. anti-affinity, is enforced by the scheduler of nova
+	var serverGroupID string
+	if c.ServerGroup != "" {
+		serverGroup, err := getServerGroup(client, c.Region, c.ServerGroup)
+		if err != nil {
+			return nil, osErrorToTerminalError(err, fmt.Sprintf("failed to get server group %q", c.ServerGroup))
+		}
+		serverGroupID = serverGroup.ID
+	}
+
 	var server serverWithExt
 	if c.RootDiskSizeGB != nil {
 		blockDevices := []bootfromvolume.BlockDevice{
@@ -528,7 +561,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 			},
 		}
 		createOpts := bootfromvolume.CreateOptsExt{
-			CreateOptsBuilder: serverOpts,
+			CreateOptsBuilder: withServerGroup(serverOpts, serverGroupID),
 			BlockDevice:       blockDevices,
 		}
 		if err := bootfromvolume.Create(computeClient, createOpts).ExtractInto(&server); err != nil {
@@ -539,7 +572,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 		// mapping is not used. Otherwish an error may occur with some
 		// OpenStack providers/versions .e.g. OpenTelekom Cloud
 		serverOpts.ImageRef = image.ID
-		if err := osservers.Create(computeClient, serverOpts).ExtractInto(&server); err != nil {
+		if err := osservers.Create(computeClient, withServerGroup(serverOpts, serverGroupID)).ExtractInto(&server); err != nil {
 			return nil, osErrorToTerminalError(err, "failed to create server")
 		}
 	}
@@ -742,6 +775,10 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) GetCloudConfig(spec v1alpha1.MachineSpec) (config string, name string, err error) {
 	c, _, _, err := p.getConfig(spec.ProviderSpec)
 	if err != nil {
@@ -814,13 +851,32 @@ func (d *osInstance) Addresses() map[string]v1.NodeAddressType {
 	for _, networkAddresses := range d.server.Addresses {
 		for _, element := range networkAddresses.([]interface{}) {
 			address := element.(map[string]interface{})
-			addresses[address["addr"].(string)] = ""
+			// Floating IPs are reachable from outside of the network of the instance
+			addressType := v1.NodeInternalIP
+			if address["OS-EXT-IPS:type"] == "floating" {
+				addressType = v1.NodeExternalIP
+			}
+			addresses[address["addr"].(string)] = addressType
 		}
 	}
 
 	return addresses
 }
 
+// Metadata returns the image ID, creation time, metadata and host ID of the server. The host ID is an
+// opaque hash of the hypervisor, which is the same for servers of the project on the same hypervisor.
+func (d *osInstance) Metadata() instance.Metadata {
+	metadata := instance.Metadata{
+		Created: d.server.Created,
+		Host:    d.server.HostID,
+		Tags:    d.server.Metadata,
+	}
+	if id, ok := d.server.Image["id"].(string); ok {
+		metadata.Image = id
+	}
+	return metadata
+}
+
 func (d *osInstance) Status() instance.Status {
 	switch d.server.Status {
 	case "IN_PROGRESS":
@@ -832,6 +888,17 @@ func (d *osInstance) Status() instance.Status {
 	}
 }
 
+// withServerGroup adds the scheduler hint which places the server into the given server group
+func withServerGroup(opts osservers.CreateOptsBuilder, serverGroupID string) osservers.CreateOptsBuilder {
+	if serverGroupID == "" {
+		return opts
+	}
+	return osschedulerhints.CreateOptsExt{
+		CreateOptsBuilder: opts,
+		SchedulerHints:    osschedulerhints.SchedulerHints{Group: serverGroupID},
+	}
+}
+
 // osErrorToTerminalError judges if the given error
 // can be qualified as a "terminal" error, for more info see v1alpha1.MachineStatus
 //
@@ -839,7 +906,7 @@ func (d *osInstance) Status() instance.Status {
 func osErrorToTerminalError(err error, msg string) error {
 	if errUnauthorized, ok := err.(gophercloud.ErrDefault401); ok {
 		return cloudprovidererrors.TerminalError{
-			Reason:  common.InvalidConfigurationMachineError,
+			Reason:  common.InvalidCredentialsMachineError,
 			Message: fmt.Sprintf("A request has been rejected due to invalid credentials which were taken from the MachineSpec: %v", errUnauthorized),
 		}
 	}
@@ -862,7 +929,7 @@ func osErrorToTerminalError(err error, msg string) error {
 		if info.Forbidden.Message != "" {
 			terr.Message = fmt.Sprintf("%s. The request against the OpenStack API is forbidden: %s", msg, info.Forbidden.Message)
 			if strings.Contains(info.Forbidden.Message, "Quota exceeded") {
-				terr.Reason = common.InsufficientResourcesMachineError
+				terr.Reason = common.QuotaExceededMachineError
 			}
 		}
 
@@ -102,9 +102,40 @@ const expectedBlockDeviceBootRequest = `{
   }
 }`
 
+const expectedServerGroupRequest = `{
+  "server": {
+	  "availability_zone": "eu-de-01",
+	  "flavorRef": "1",
+	  "imageRef": "f3e4a95d-1f4f-4989-97ce-f3a1fb8c04d7",
+	  "metadata": {
+		"kubernetes-cluster": "xyz",
+		"machine-uid": "",
+		"system-cluster": "zyx",
+		"system-project": "xxx"
+	  },
+	  "name": "test",
+	  "networks": [
+		{
+		  "uuid": "d32019d3-bc6e-4319-9c1d-6722fc136a22"
+		}
+	  ],
+	  "security_groups": [
+		{
+		  "name": "kubernetes-xyz"
+		}
+	  ],
+	  "user_data": "ZmFrZS11c2VyZGF0YQ=="
+  },
+  "os:scheduler_hints": {
+	  "group": "616fb98f-46ca-475e-917e-2563e5a8cd19"
+  }
+}
+`
+
 type openstackProviderSpecConf struct {
 	IdentityEndpointURL string
 	RootDiskSizeGB      *int32
+	ServerGroup         string
 }
 
 func (o openstackProviderSpecConf) rawProviderSpec(t *testing.T) []byte {
@@ -126,6 +157,9 @@ func (o openstackProviderSpecConf) rawProviderSpec(t *testing.T) []byte {
 		{{- if .RootDiskSizeGB }}
 		"rootDiskSizeGB": {{ .RootDiskSizeGB }},
 		{{- end }}
+		{{- if .ServerGroup }}
+		"serverGroup": "{{ .ServerGroup }}",
+		{{- end }}
 		"securityGroups": [
 			"kubernetes-xyz"
 		],
@@ -180,6 +214,12 @@ func TestCreateServer(t *testing.T) {
 			userdata:      "fake-userdata",
 			wantServerReq: expectedBlockDeviceBootRequest,
 		},
+		{
+			name:          "Server group",
+			specConf:      openstackProviderSpecConf{ServerGroup: "control-plane"},
+			userdata:      "fake-userdata",
+			wantServerReq: expectedServerGroupRequest,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -347,6 +387,28 @@ func ExpectServerCreated(t *testing.T, expectedServer string) {
 			t.Fatalf("Unexpected marker: [%s]", marker)
 		}
 	})
+	// Handle listing server groups.
+	th.Mux.HandleFunc("/os-server-groups", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		th.TestHeader(t, r, "X-Auth-Token", client.TokenID)
+
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `
+			{
+				"server_groups": [
+					{
+						"id": "616fb98f-46ca-475e-917e-2563e5a8cd19",
+						"name": "control-plane",
+						"policies": [
+							"anti-affinity"
+						],
+						"members": [],
+						"metadata": {}
+					}
+				]
+			}
+		`)
+	})
 	// Handle listing networks.
 	th.Mux.HandleFunc("/v2.0/networks", func(w http.ResponseWriter, r *http.Request) {
 		th.TestMethod(t, r, "GET")
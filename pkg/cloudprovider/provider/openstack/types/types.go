@@ -41,6 +41,7 @@ type RawConfig struct {
 	Subnet                providerconfigtypes.ConfigVarString   `json:"subnet,omitempty"`
 	FloatingIPPool        providerconfigtypes.ConfigVarString   `json:"floatingIpPool,omitempty"`
 	AvailabilityZone      providerconfigtypes.ConfigVarString   `json:"availabilityZone,omitempty"`
+	ServerGroup           providerconfigtypes.ConfigVarString   `json:"serverGroup,omitempty"`
 	TrustDevicePath       providerconfigtypes.ConfigVarBool     `json:"trustDevicePath"`
 	RootDiskSizeGB        *int                                  `json:"rootDiskSizeGB"`
 	NodeVolumeAttachLimit *uint                                 `json:"nodeVolumeAttachLimit"`
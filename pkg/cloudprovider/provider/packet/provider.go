@@ -18,8 +18,8 @@ package packet
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
+	"net/http"
 	"reflect"
 	"strings"
 
@@ -31,12 +31,14 @@ import (
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
 	packettypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/packet/types"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog"
 )
 
@@ -93,11 +95,12 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *packettypes.Raw
 	}
 
 	c := Config{}
-	c.APIKey, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.APIKey, "PACKET_API_KEY")
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.APIKey, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.APIKey, "PACKET_API_KEY")
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get the value of \"apiKey\" field, error = %v", err)
 	}
-	c.ProjectID, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.ProjectID, "PACKET_PROJECT_ID")
+	c.ProjectID, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.ProjectID, "PACKET_PROJECT_ID")
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get the value of \"projectID\" field, error = %v", err)
 	}
@@ -154,13 +157,13 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	}
 
 	if c.APIKey == "" {
-		return errors.New("apiKey is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("apiKey"), "")
 	}
 	if c.InstanceType == "" {
-		return errors.New("instanceType is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("instanceType"), "")
 	}
 	if c.ProjectID == "" {
-		return errors.New("projectID is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("projectID"), "")
 	}
 
 	_, err = getNameForOS(pc.OperatingSystem)
@@ -325,6 +328,10 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, newID types.UID) error
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) GetCloudConfig(spec v1alpha1.MachineSpec) (config string, name string, err error) {
 	return "", "", nil
 }
@@ -431,12 +438,17 @@ func getNameForOS(os providerconfigtypes.OperatingSystem) (string, error) {
 		return "coreos_stable", nil
 	case providerconfigtypes.OperatingSystemFlatcar:
 		return "flatcar_stable", nil
+	case providerconfigtypes.OperatingSystemRockyLinux:
+		return "rocky_8", nil
+	case providerconfigtypes.OperatingSystemAlmaLinux:
+		return "alma_8", nil
 	}
 	return "", providerconfigtypes.ErrOSNotSupported
 }
 
 func getClient(apiKey string) *packngo.Client {
-	return packngo.NewClientWithAuth("kubermatic", apiKey, nil)
+	httpClient := &http.Client{Transport: cloudproviderutil.NewTransport("packet", nil, apiKey)}
+	return packngo.NewClientWithAuth("kubermatic", apiKey, httpClient)
 }
 
 func generateTag(ID string) string {
@@ -19,8 +19,8 @@ package scaleway
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/scaleway/scaleway-sdk-go/api/instance/v1"
@@ -33,12 +33,14 @@ import (
 	cloudInstance "github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
 	scalewaytypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/scaleway/types"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog"
 )
 
@@ -67,6 +69,7 @@ func (c *Config) getInstanceAPI() (*instance.API, error) {
 		scw.WithDefaultZone(scw.Zone(c.Zone)),
 		scw.WithDefaultProjectID(c.ProjectID),
 		scw.WithUserAgent("kubermatic/machine-controller"),
+		scw.WithHTTPClient(&http.Client{Transport: cloudproviderutil.NewTransport("scaleway", nil, c.AccessKey)}),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize the scaleway client: %s", err.Error())
@@ -103,15 +106,16 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 	}
 
 	c := Config{}
-	c.AccessKey, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.AccessKey, scw.ScwAccessKeyEnv)
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.AccessKey, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.AccessKey, scw.ScwAccessKeyEnv)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"access_key\" field, error = %v", err)
 	}
-	c.SecretKey, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.SecretKey, scw.ScwSecretKeyEnv)
+	c.SecretKey, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.SecretKey, scw.ScwSecretKeyEnv)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"secret_key\" field, error = %v", err)
 	}
-	c.ProjectID, err = p.configVarResolver.GetConfigVarStringValue(rawConfig.ProjectID)
+	c.ProjectID, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.ProjectID, "SCW_DEFAULT_PROJECT_ID")
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the value of \"project_id\" field, error = %v", err)
 	}
@@ -158,7 +162,7 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	}
 
 	if c.CommercialType == "" {
-		return errors.New("commercial type is missing")
+		return field.Required(providerconfigtypes.CloudProviderSpecPath.Child("commercialType"), "")
 	}
 
 	_, err = getImageNameForOS(pc.OperatingSystem)
@@ -169,7 +173,7 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 	return nil
 }
 
-func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData, userdata string) (cloudInstance.Instance, error) {
+func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData, userdata string) (cloudInstance.Instance, error) {
 	c, pc, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, cloudprovidererrors.TerminalError{
@@ -178,7 +182,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provi
 		}
 	}
 
-	ctx := context.TODO()
+	ctx := data.Context()
 	api, err := c.getInstanceAPI()
 	if err != nil {
 		return nil, err
@@ -218,7 +222,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, _ *cloudprovidertypes.Provi
 	return &scwServer{server: serverResp.Server}, err
 }
 
-func (p *provider) Cleanup(machine *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
 	i, err := p.get(machine)
 	if err != nil {
 		if err == cloudprovidererrors.ErrInstanceNotFound {
@@ -234,7 +238,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, _ *cloudprovidertypes.Prov
 			Message: fmt.Sprintf("Failed to parse MachineSpec, due to %v", err),
 		}
 	}
-	ctx := context.TODO()
+	ctx := data.Context()
 	api, err := c.getInstanceAPI()
 	if err != nil {
 		return false, err
@@ -350,6 +354,10 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new types.UID) error {
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) GetCloudConfig(spec v1alpha1.MachineSpec) (config string, name string, err error) {
 	return "", "", nil
 }
@@ -417,7 +425,7 @@ func scalewayErrToTerminalError(err error) error {
 	switch err.(type) {
 	case *scw.PermissionsDeniedError:
 		return cloudprovidererrors.TerminalError{
-			Reason:  common.InvalidConfigurationMachineError,
+			Reason:  common.InvalidCredentialsMachineError,
 			Message: "A request has been rejected due to invalid credentials which were taken from the MachineSpec",
 		}
 	case *scw.InvalidArgumentsError:
@@ -427,12 +435,12 @@ func scalewayErrToTerminalError(err error) error {
 		}
 	case *scw.OutOfStockError:
 		return cloudprovidererrors.TerminalError{
-			Reason:  common.InsufficientResourcesMachineError,
+			Reason:  common.InsufficientCapacityMachineError,
 			Message: "A request has been rejected due to out of stocks",
 		}
 	case *scw.QuotasExceededError:
 		return cloudprovidererrors.TerminalError{
-			Reason:  common.InsufficientResourcesMachineError,
+			Reason:  common.QuotaExceededMachineError,
 			Message: "A request has been rejected due to insufficient quotas",
 		}
 	default:
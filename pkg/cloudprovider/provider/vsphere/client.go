@@ -26,6 +26,11 @@ import (
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+
+	cloudproviderutil "github.com/kubermatic/machine-controller/pkg/cloudprovider/util"
 )
 
 type Session struct {
@@ -42,10 +47,20 @@ func NewSession(ctx context.Context, config *Config) (*Session, error) {
 	}
 	clientURL.User = url.UserPassword(config.Username, config.Password)
 
-	client, err := govmomi.NewClient(ctx, clientURL, config.AllowInsecure)
+	// Like govmomi.NewClient, but rate limits the requests and records their metrics
+	soapClient := soap.NewClient(clientURL, config.AllowInsecure)
+	soapClient.Transport = cloudproviderutil.NewTransport("vsphere", soapClient.Transport, config.VSphereURL, config.Username)
+	vimClient, err := vim25.NewClient(ctx, soapClient)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build client: %v", err)
 	}
+	client := &govmomi.Client{
+		Client:         vimClient,
+		SessionManager: session.NewManager(vimClient),
+	}
+	if err := client.Login(ctx, clientURL.User); err != nil {
+		return nil, fmt.Errorf("failed to login: %v", err)
+	}
 
 	finder := find.NewFinder(client.Client, true)
 	dc, err := finder.Datacenter(ctx, config.Datacenter)
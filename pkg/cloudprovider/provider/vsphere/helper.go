@@ -26,6 +26,7 @@ import (
 	"math"
 	"os"
 	"os/exec"
+	"sync"
 	"text/template"
 
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
@@ -38,6 +39,10 @@ import (
 	"k8s.io/klog"
 )
 
+// antiAffinityRuleLock serializes the updates of anti-affinity rules, as a rule is replaced as a whole and
+// concurrent updates would drop VMs from it
+var antiAffinityRuleLock sync.Mutex
+
 const (
 	localTempDir     = "/tmp"
 	metaDataTemplate = `instance-id: {{ .InstanceID}}
@@ -141,7 +146,7 @@ func createClonedVM(ctx context.Context, vmName string, config *Config, session
 		case providerconfigtypes.OperatingSystemCoreos:
 			guestInfoUserData = "guestinfo.coreos.config.data"
 			guestInfoUserDataEncoding = "guestinfo.coreos.config.data.encoding"
-		case providerconfigtypes.OperatingSystemFlatcar:
+		case providerconfigtypes.OperatingSystemFlatcar, providerconfigtypes.OperatingSystemFedoraCoreOS:
 			guestInfoUserData = "guestinfo.ignition.config.data"
 			guestInfoUserDataEncoding = "guestinfo.ignition.config.data.encoding"
 		}
@@ -460,3 +465,60 @@ func resolveResourcePoolRef(ctx context.Context, config *Config, session *Sessio
 	}
 	return nil, nil
 }
+
+// addToAntiAffinityRule adds the VM to the DRS anti-affinity rule of the given name in the cluster, the rule is
+// created if it doesn't exist yet. DRS then keeps the VMs of the rule on different hosts.
+func addToAntiAffinityRule(ctx context.Context, session *Session, clusterName, ruleName string, vm *object.VirtualMachine) error {
+	antiAffinityRuleLock.Lock()
+	defer antiAffinityRuleLock.Unlock()
+
+	cluster, err := session.Finder.ClusterComputeResource(ctx, clusterName)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster %q: %v", clusterName, err)
+	}
+
+	var clusterMo mo.ClusterComputeResource
+	if err := cluster.Properties(ctx, cluster.Reference(), []string{"configurationEx"}, &clusterMo); err != nil {
+		return fmt.Errorf("failed to get configuration of cluster %q: %v", clusterName, err)
+	}
+	clusterConfig, ok := clusterMo.ConfigurationEx.(*types.ClusterConfigInfoEx)
+	if !ok {
+		return fmt.Errorf("unexpected configuration type %T of cluster %q", clusterMo.ConfigurationEx, clusterName)
+	}
+
+	ruleSpec := types.ClusterRuleSpec{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+		Info: &types.ClusterAntiAffinityRuleSpec{
+			ClusterRuleInfo: types.ClusterRuleInfo{
+				Name:    ruleName,
+				Enabled: types.NewBool(true),
+			},
+			Vm: []types.ManagedObjectReference{vm.Reference()},
+		},
+	}
+	for _, rule := range clusterConfig.Rule {
+		antiAffinityRule, ok := rule.(*types.ClusterAntiAffinityRuleSpec)
+		if !ok || antiAffinityRule.Name != ruleName {
+			continue
+		}
+		for _, ref := range antiAffinityRule.Vm {
+			if ref == vm.Reference() {
+				return nil
+			}
+		}
+		antiAffinityRule.Vm = append(antiAffinityRule.Vm, vm.Reference())
+		ruleSpec.Operation = types.ArrayUpdateOperationEdit
+		ruleSpec.Info = antiAffinityRule
+		break
+	}
+
+	task, err := cluster.Reconfigure(ctx, &types.ClusterConfigSpecEx{RulesSpec: []types.ClusterRuleSpec{ruleSpec}}, true)
+	if err != nil {
+		return fmt.Errorf("failed to reconfigure cluster %q: %v", clusterName, err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return fmt.Errorf("error when waiting for result of cluster reconfiguration: %v", err)
+	}
+	klog.V(2).Infof("Added vm %s to anti-affinity rule %s of cluster %s", vm.Name(), ruleName, clusterName)
+	return nil
+}
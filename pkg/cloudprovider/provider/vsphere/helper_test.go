@@ -26,6 +26,7 @@ import (
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/simulator"
 	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/soap"
 	"github.com/vmware/govmomi/vim25/types"
 )
@@ -243,3 +244,68 @@ func TestResolveResourcePoolRef(t *testing.T) {
 		})
 	}
 }
+
+func TestAddToAntiAffinityRule(t *testing.T) {
+	ctx := context.Background()
+
+	model := simulator.VPX()
+	defer model.Remove()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := model.Service.NewServer()
+	defer s.Close()
+
+	config := &Config{
+		VSphereURL: strings.TrimSuffix(s.URL.String(), "/sdk"),
+		Username:   simulator.DefaultLogin.Username(),
+		Datacenter: "DC0",
+	}
+	config.Password, _ = simulator.DefaultLogin.Password()
+
+	session, err := NewSession(ctx, config)
+	if err != nil {
+		t.Fatalf("error creating session: %v", err)
+	}
+	defer session.Logout()
+
+	vms, err := session.Finder.VirtualMachineList(ctx, "DC0_C0_*")
+	if err != nil {
+		t.Fatalf("error getting virtual machines: %v", err)
+	}
+	if len(vms) < 2 {
+		t.Fatalf("expected at least two virtual machines in the cluster, got %d", len(vms))
+	}
+
+	// Adding a vm twice must not duplicate it
+	for _, vm := range []*object.VirtualMachine{vms[0], vms[1], vms[1]} {
+		if err := addToAntiAffinityRule(ctx, session, "DC0_C0", "control-plane", vm); err != nil {
+			t.Fatalf("error adding vm %s to anti-affinity rule: %v", vm.Name(), err)
+		}
+	}
+
+	cluster, err := session.Finder.ClusterComputeResource(ctx, "DC0_C0")
+	if err != nil {
+		t.Fatalf("error getting cluster: %v", err)
+	}
+	var clusterMo mo.ClusterComputeResource
+	if err := cluster.Properties(ctx, cluster.Reference(), []string{"configurationEx"}, &clusterMo); err != nil {
+		t.Fatalf("error getting cluster configuration: %v", err)
+	}
+	var rules []*types.ClusterAntiAffinityRuleSpec
+	for _, rule := range clusterMo.ConfigurationEx.(*types.ClusterConfigInfoEx).Rule {
+		if antiAffinityRule, ok := rule.(*types.ClusterAntiAffinityRuleSpec); ok {
+			rules = append(rules, antiAffinityRule)
+		}
+	}
+	if len(rules) != 1 {
+		t.Fatalf("expected exactly one anti-affinity rule, got %d", len(rules))
+	}
+	if rules[0].Name != "control-plane" {
+		t.Errorf("expected rule control-plane, got %s", rules[0].Name)
+	}
+	if len(rules[0].Vm) != 2 || rules[0].Vm[0] != vms[0].Reference() || rules[0].Vm[1] != vms[1].Reference() {
+		t.Errorf("expected rule to contain %v and %v, got %v", vms[0].Reference(), vms[1].Reference(), rules[0].Vm)
+	}
+}
@@ -68,6 +68,7 @@ type Config struct {
 	ResourcePool     string
 	Datastore        string
 	DatastoreCluster string
+	AntiAffinityRule string
 	AllowInsecure    bool
 	CPUs             int32
 	MemoryMB         int64
@@ -135,17 +136,18 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 		return nil, nil, nil, err
 	}
 
-	c.Username, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.Username, "VSPHERE_USERNAME")
+	credentialResolver := p.configVarResolver.ForCredentialProfile(pconfig.CredentialProfile)
+	c.Username, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.Username, "VSPHERE_USERNAME")
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	c.Password, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.Password, "VSPHERE_PASSWORD")
+	c.Password, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.Password, "VSPHERE_PASSWORD")
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	c.VSphereURL, err = p.configVarResolver.GetConfigVarStringValueOrEnv(rawConfig.VSphereURL, "VSPHERE_ADDRESS")
+	c.VSphereURL, err = credentialResolver.GetConfigVarStringValueOrEnv(rawConfig.VSphereURL, "VSPHERE_ADDRESS")
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -180,7 +182,12 @@ func (p *provider) getConfig(s v1alpha1.ProviderSpec) (*Config, *providerconfigt
 		return nil, nil, nil, err
 	}
 
-	c.AllowInsecure, err = p.configVarResolver.GetConfigVarBoolValueOrEnv(rawConfig.AllowInsecure, "VSPHERE_ALLOW_INSECURE")
+	c.AntiAffinityRule, err = p.configVarResolver.GetConfigVarStringValue(rawConfig.VMAntiAffinityRule)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	c.AllowInsecure, err = credentialResolver.GetConfigVarBoolValueOrEnv(rawConfig.AllowInsecure, "VSPHERE_ALLOW_INSECURE")
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -220,6 +227,10 @@ func (p *provider) Validate(spec v1alpha1.MachineSpec) error {
 		return fmt.Errorf("one between datastore and datastore cluster should be specified: %v", err)
 	}
 
+	if config.AntiAffinityRule != "" && config.Cluster == "" {
+		return fmt.Errorf("a cluster must be specified to use a vm anti-affinity rule")
+	}
+
 	if _, err := session.Finder.ClusterComputeResource(ctx, config.Cluster); err != nil {
 		return fmt.Errorf("failed to get cluster: %s: %v", config.Cluster, err)
 	}
@@ -270,7 +281,7 @@ func machineInvalidConfigurationTerminalError(err error) error {
 }
 
 func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData, userdata string) (instance.Instance, error) {
-	vm, err := p.create(machine, userdata)
+	vm, err := p.create(data.Context(), machine, userdata)
 	if err != nil {
 		_, cleanupErr := p.Cleanup(machine, data)
 		if cleanupErr != nil {
@@ -281,9 +292,7 @@ func (p *provider) Create(machine *v1alpha1.Machine, data *cloudprovidertypes.Pr
 	return vm, nil
 }
 
-func (p *provider) create(machine *v1alpha1.Machine, userdata string) (instance.Instance, error) {
-	ctx := context.Background()
-
+func (p *provider) create(ctx context.Context, machine *v1alpha1.Machine, userdata string) (instance.Instance, error) {
 	config, pc, _, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse config: %v", err)
@@ -297,7 +306,8 @@ func (p *provider) create(machine *v1alpha1.Machine, userdata string) (instance.
 
 	var containerLinuxUserdata string
 	if pc.OperatingSystem == providerconfigtypes.OperatingSystemCoreos ||
-		pc.OperatingSystem == providerconfigtypes.OperatingSystemFlatcar {
+		pc.OperatingSystem == providerconfigtypes.OperatingSystemFlatcar ||
+		pc.OperatingSystem == providerconfigtypes.OperatingSystemFedoraCoreOS {
 		containerLinuxUserdata = userdata
 	}
 
@@ -313,7 +323,8 @@ func (p *provider) create(machine *v1alpha1.Machine, userdata string) (instance.
 	}
 
 	if pc.OperatingSystem != providerconfigtypes.OperatingSystemCoreos &&
-		pc.OperatingSystem != providerconfigtypes.OperatingSystemFlatcar {
+		pc.OperatingSystem != providerconfigtypes.OperatingSystemFlatcar &&
+		pc.OperatingSystem != providerconfigtypes.OperatingSystemFedoraCoreOS {
 		localUserdataIsoFilePath, err := generateLocalUserdataISO(userdata, machine.Spec.Name)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate local userdadata iso: %v", err)
@@ -339,6 +350,20 @@ func (p *provider) create(machine *v1alpha1.Machine, userdata string) (instance.
 		}
 	}
 
+	if config.AntiAffinityRule != "" {
+		if err := addToAntiAffinityRule(ctx, session, config.Cluster, config.AntiAffinityRule, virtualMachine); err != nil {
+			// Destroy VM to avoid a leftover which would never be added to the rule.
+			destroyTask, vmErr := virtualMachine.Destroy(ctx)
+			if vmErr != nil {
+				return nil, fmt.Errorf("failed to destroy vm %s after failing to add it to anti-affinity rule: %v / %v", virtualMachine.Name(), err, vmErr)
+			}
+			if vmErr := destroyTask.Wait(ctx); vmErr != nil {
+				return nil, fmt.Errorf("failed to destroy vm %s after failing to add it to anti-affinity rule: %v / %v", virtualMachine.Name(), err, vmErr)
+			}
+			return nil, fmt.Errorf("failed to add vm to anti-affinity rule %q: %v", config.AntiAffinityRule, err)
+		}
+	}
+
 	powerOnTask, err := virtualMachine.PowerOn(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to power on machine: %v", err)
@@ -352,7 +377,7 @@ func (p *provider) create(machine *v1alpha1.Machine, userdata string) (instance.
 }
 
 func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(data.Context())
 	defer cancel()
 
 	config, pc, _, err := p.getConfig(machine.Spec.ProviderSpec)
@@ -430,7 +455,8 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.P
 	}
 
 	if pc.OperatingSystem != providerconfigtypes.OperatingSystemCoreos &&
-		pc.OperatingSystem != providerconfigtypes.OperatingSystemFlatcar {
+		pc.OperatingSystem != providerconfigtypes.OperatingSystemFlatcar &&
+		pc.OperatingSystem != providerconfigtypes.OperatingSystemFedoraCoreOS {
 		filemanager := datastore.NewFileManager(session.Datacenter, false)
 
 		if err := filemanager.Delete(ctx, virtualMachine.Name()); err != nil {
@@ -446,7 +472,7 @@ func (p *provider) Cleanup(machine *v1alpha1.Machine, data *cloudprovidertypes.P
 }
 
 func (p *provider) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
-	ctx := context.Background()
+	ctx := data.Context()
 
 	config, _, _, err := p.getConfig(machine.Spec.ProviderSpec)
 	if err != nil {
@@ -500,7 +526,7 @@ func (p *provider) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.Provi
 			for _, address := range nic.IpAddress {
 				// Exclude ipv6 link-local addresses and default Docker bridge
 				if !strings.HasPrefix(address, "fe80:") && !strings.HasPrefix(address, "172.17.") {
-					addresses[address] = ""
+					addresses[address] = corev1.NodeInternalIP
 				}
 			}
 		}
@@ -515,6 +541,10 @@ func (p *provider) MigrateUID(machine *v1alpha1.Machine, new ktypes.UID) error {
 	return nil
 }
 
+func (p *provider) Update(_ *v1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (bool, error) {
+	return false, cloudprovidererrors.ErrUpdateNotSupported
+}
+
 func (p *provider) GetCloudConfig(spec v1alpha1.MachineSpec) (config string, name string, err error) {
 	c, _, _, err := p.getConfig(spec.ProviderSpec)
 	if err != nil {
@@ -32,6 +32,9 @@ type RawConfig struct {
 	Folder         providerconfigtypes.ConfigVarString `json:"folder"`
 	ResourcePool   providerconfigtypes.ConfigVarString `json:"resourcePool"`
 
+	// VMs with the same anti-affinity rule are kept on different hosts of the cluster by DRS.
+	VMAntiAffinityRule providerconfigtypes.ConfigVarString `json:"vmAntiAffinityRule,omitempty"`
+
 	// Either Datastore or DatastoreCluster have to be provided.
 	DatastoreCluster providerconfigtypes.ConfigVarString `json:"datastoreCluster"`
 	Datastore        providerconfigtypes.ConfigVarString `json:"datastore"`
@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	alibabatypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/alibaba/types"
+	anexiatypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/anexia/types"
+	awstypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/aws/types"
+	azuretypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/azure/types"
+	digitaloceantypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/digitalocean/types"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/fake"
+	gcetypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/gce/types"
+	hetznertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/hetzner/types"
+	kubevirttypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/kubevirt/types"
+	linodetypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/linode/types"
+	openstacktypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/openstack/types"
+	packettypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/packet/types"
+	scalewaytypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/scaleway/types"
+	vspheretypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/vsphere/types"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var (
+	// cloudProviderSpecs are the types the cloud providers unmarshal their cloudProviderSpec into
+	cloudProviderSpecs = map[providerconfigtypes.CloudProvider]interface{}{
+		providerconfigtypes.CloudProviderAlibaba:      alibabatypes.RawConfig{},
+		providerconfigtypes.CloudProviderAnexia:       anexiatypes.RawConfig{},
+		providerconfigtypes.CloudProviderAWS:          awstypes.RawConfig{},
+		providerconfigtypes.CloudProviderAzure:        azuretypes.RawConfig{},
+		providerconfigtypes.CloudProviderDigitalocean: digitaloceantypes.RawConfig{},
+		providerconfigtypes.CloudProviderFake:         fake.CloudProviderSpec{},
+		providerconfigtypes.CloudProviderGoogle:       gcetypes.CloudProviderSpec{},
+		providerconfigtypes.CloudProviderHetzner:      hetznertypes.RawConfig{},
+		providerconfigtypes.CloudProviderKubeVirt:     kubevirttypes.RawConfig{},
+		providerconfigtypes.CloudProviderLinode:       linodetypes.RawConfig{},
+		providerconfigtypes.CloudProviderOpenstack:    openstacktypes.RawConfig{},
+		providerconfigtypes.CloudProviderPacket:       packettypes.RawConfig{},
+		providerconfigtypes.CloudProviderScaleway:     scalewaytypes.RawConfig{},
+		providerconfigtypes.CloudProviderVsphere:      vspheretypes.RawConfig{},
+	}
+
+	configVarStringType = reflect.TypeOf(providerconfigtypes.ConfigVarString{})
+	configVarBoolType   = reflect.TypeOf(providerconfigtypes.ConfigVarBool{})
+	rawExtensionType    = reflect.TypeOf(runtime.RawExtension{})
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// ProviderSpecSchema returns the JSON schema of the providerSpec.value of machines of the given cloud
+// provider, including its cloudProviderSpec. Unknown fields are not allowed, so editors and CI pipelines
+// notice typos which the machine-controller silently ignores.
+func ProviderSpecSchema(provider providerconfigtypes.CloudProvider) (map[string]interface{}, error) {
+	cloudProviderSpec, found := cloudProviderSpecs[provider]
+	if !found {
+		return nil, ErrProviderNotFound
+	}
+
+	schema := structSchema(reflect.TypeOf(providerconfigtypes.Config{}))
+	properties := schema["properties"].(map[string]interface{})
+	properties["cloudProvider"] = map[string]interface{}{"type": "string", "enum": []string{string(provider)}}
+	properties["cloudProviderSpec"] = typeSchema(reflect.TypeOf(cloudProviderSpec))
+	schema["required"] = []string{"cloudProvider", "cloudProviderSpec"}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = fmt.Sprintf("Provider spec of %s machines", provider)
+	return schema, nil
+}
+
+// typeSchema returns the JSON schema of the values encoding/json unmarshals into the given type
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case configVarStringType:
+		// Any JSON scalar is taken as value, see ConfigVarString.UnmarshalJSON
+		return map[string]interface{}{"oneOf": []interface{}{
+			map[string]interface{}{"type": []string{"string", "number", "boolean"}},
+			structSchema(t),
+		}}
+	case configVarBoolType:
+		return map[string]interface{}{"oneOf": []interface{}{
+			map[string]interface{}{"type": "boolean"},
+			structSchema(t),
+		}}
+	case rawExtensionType:
+		return map[string]interface{}{}
+	}
+	// Other types with their own unmarshalling may accept anything
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// base64 encoded
+			return map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the JSON schema of the given struct without taking its own unmarshalling into account
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	addFieldSchemas(t, properties)
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func addFieldSchemas(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		// The fields of embedded structs are promoted, e.G. with json:",inline"
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				addFieldSchemas(fieldType, properties)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"encoding/json"
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+func TestProviderSpecSchema(t *testing.T) {
+	for _, provider := range providerconfigtypes.AllCloudProviders {
+		schema, err := ProviderSpecSchema(provider)
+		if err != nil {
+			t.Errorf("expected a schema for cloud provider %s, got %v", provider, err)
+			continue
+		}
+		if _, err := json.Marshal(schema); err != nil {
+			t.Errorf("failed to marshal the schema of cloud provider %s: %v", provider, err)
+		}
+	}
+
+	if _, err := ProviderSpecSchema("unknown"); err != ErrProviderNotFound {
+		t.Errorf("expected ErrProviderNotFound for an unknown cloud provider, got %v", err)
+	}
+
+	schema, err := ProviderSpecSchema(providerconfigtypes.CloudProviderDigitalocean)
+	if err != nil {
+		t.Fatalf("failed to get the schema: %v", err)
+	}
+	cloudProviderSpec := schema["properties"].(map[string]interface{})["cloudProviderSpec"].(map[string]interface{})
+	if cloudProviderSpec["additionalProperties"] != false {
+		t.Errorf("expected unknown fields of the cloudProviderSpec to be rejected")
+	}
+	token, ok := cloudProviderSpec["properties"].(map[string]interface{})["token"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected the cloudProviderSpec to have a token property")
+	}
+	refs := token["oneOf"].([]interface{})[1].(map[string]interface{})["properties"].(map[string]interface{})
+	secretKeyRef := refs["secretKeyRef"].(map[string]interface{})["properties"].(map[string]interface{})
+	for _, property := range []string{"namespace", "name", "key"} {
+		if _, found := secretKeyRef[property]; !found {
+			t.Errorf("expected secretKeyRef to have the property %q", property)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/tracing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type tracingWrapper struct {
+	optionalForwarder
+	ctx      context.Context
+	name     providerconfigtypes.CloudProvider
+	resolver *providerconfig.ConfigVarResolver
+}
+
+// NewTracingCloudProvider returns a wrapped cloudprovider which records a span for each call to the
+// cloud provider as a child of the span of the given context, usually the one of a reconciliation.
+// The credentials resolved by the given resolver of the cloud provider are redacted from the spans.
+func NewTracingCloudProvider(ctx context.Context, name providerconfigtypes.CloudProvider, actualProvider cloudprovidertypes.Provider, resolver *providerconfig.ConfigVarResolver) cloudprovidertypes.Provider {
+	return &tracingWrapper{ctx: ctx, name: name, optionalForwarder: optionalForwarder{actualProvider: actualProvider}, resolver: resolver}
+}
+
+// start starts the span of a call of the given operation for the given machine
+func (w *tracingWrapper) start(operation string, machine *v1alpha1.Machine) *tracing.Span {
+	_, span := tracing.Start(w.ctx, "CloudProvider."+operation)
+	span.SetAttribute("provider", string(w.name))
+	if machine != nil {
+		span.SetAttribute("machine", machine.Namespace+"/"+machine.Name)
+	}
+	return span
+}
+
+// endSpan ends the span of a call, errors of the cloud provider may echo credentials of the machine
+func (w *tracingWrapper) endSpan(span *tracing.Span, machine *v1alpha1.Machine, err error) {
+	if err != nil && machine != nil {
+		err = errors.New(providerconfig.RedactMessage(err.Error(), machine.Spec.ProviderSpec.Value, w.resolver.ResolvedSecrets()...))
+	}
+	span.End(err)
+}
+
+// AddDefaults just calls the underlying cloudproviders AddDefaults
+func (w *tracingWrapper) AddDefaults(spec v1alpha1.MachineSpec) (v1alpha1.MachineSpec, error) {
+	return w.actualProvider.AddDefaults(spec)
+}
+
+// Validate just calls the underlying cloudproviders Validate
+func (w *tracingWrapper) Validate(spec v1alpha1.MachineSpec) error {
+	return w.actualProvider.Validate(spec)
+}
+
+// Get calls the underlying cloudproviders Get and records a span. Instances which are not found
+// are expected, e.g. before they got created, so they don't fail the span.
+func (w *tracingWrapper) Get(machine *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	span := w.start("Get", machine)
+	instance, err := w.actualProvider.Get(machine, data)
+	if err == cloudprovidererrors.ErrInstanceNotFound {
+		span.SetAttribute("instance.found", "false")
+		w.endSpan(span, machine, nil)
+	} else {
+		w.endSpan(span, machine, err)
+	}
+	return instance, err
+}
+
+// GetCloudConfig just calls the underlying cloudproviders GetCloudConfig
+func (w *tracingWrapper) GetCloudConfig(spec v1alpha1.MachineSpec) (string, string, error) {
+	return w.actualProvider.GetCloudConfig(spec)
+}
+
+// Create calls the underlying cloudproviders Create and records a span
+func (w *tracingWrapper) Create(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData, cloudConfig string) (instance.Instance, error) {
+	span := w.start("Create", m)
+	instance, err := w.actualProvider.Create(m, mcd, cloudConfig)
+	w.endSpan(span, m, err)
+	return instance, err
+}
+
+// Cleanup calls the underlying cloudproviders Cleanup and records a span
+func (w *tracingWrapper) Cleanup(m *v1alpha1.Machine, mcd *cloudprovidertypes.ProviderData) (bool, error) {
+	span := w.start("Cleanup", m)
+	completelyGone, err := w.actualProvider.Cleanup(m, mcd)
+	w.endSpan(span, m, err)
+	return completelyGone, err
+}
+
+// MigrateUID calls the underlying cloudproviders MigrateUID and records a span
+func (w *tracingWrapper) MigrateUID(m *v1alpha1.Machine, new types.UID) error {
+	span := w.start("MigrateUID", m)
+	err := w.actualProvider.MigrateUID(m, new)
+	w.endSpan(span, m, err)
+	return err
+}
+
+// Update calls the underlying cloudproviders Update and records a span
+func (w *tracingWrapper) Update(m *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
+	span := w.start("Update", m)
+	done, err := w.actualProvider.Update(m, data)
+	w.endSpan(span, m, err)
+	return done, err
+}
+
+// AdoptInstance calls the underlying cloudproviders AdoptInstance and records a span, providers not
+// implementing it can't take over instances
+func (w *tracingWrapper) AdoptInstance(m *v1alpha1.Machine, instanceID string, data *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	adopter, ok := w.actualProvider.(cloudprovidertypes.InstanceAdopter)
+	if !ok {
+		return nil, cloudprovidererrors.ErrAdoptionNotSupported
+	}
+	span := w.start("AdoptInstance", m)
+	instance, err := adopter.AdoptInstance(m, instanceID, data)
+	w.endSpan(span, m, err)
+	return instance, err
+}
+
+// MachineMetricsLabels just calls the underlying cloudproviders MachineMetricsLabels
+func (w *tracingWrapper) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
+	return w.actualProvider.MachineMetricsLabels(machine)
+}
+
+func (w *tracingWrapper) SetMetricsForMachines(machines v1alpha1.MachineList) error {
+	return w.actualProvider.SetMetricsForMachines(machines)
+}
@@ -71,11 +71,55 @@ type Provider interface {
 	// All cloud providers that use Machine.UID to uniquely identify resources must implement this
 	MigrateUID(machine *clusterv1alpha1.Machine, new types.UID) error
 
+	// Update applies the spec of the machine to its existing instance.
+	// Like Cleanup it returns false as long as asynchronous operations are not done yet.
+	// Providers which can not update instances in-place return errors.ErrUpdateNotSupported
+	Update(machine *clusterv1alpha1.Machine, data *ProviderData) (bool, error)
+
 	// SetMetricsForMachines allows providers to provide provider-specific metrics. This may be implemented
 	// as no-op
 	SetMetricsForMachines(machines clusterv1alpha1.MachineList) error
 }
 
+// UpdateValidator is implemented by providers which support the InPlace update strategy, so changes
+// they can't apply to existing instances get rejected instead of being ignored
+type UpdateValidator interface {
+	// ValidateUpdate returns an error if the change from the old to the new spec can't be applied
+	// to an existing instance
+	ValidateUpdate(oldSpec, newSpec clusterv1alpha1.MachineSpec) error
+}
+
+// InstanceAdopter is implemented by providers which can take over instances they did not create,
+// e.g. ones created by Terraform or by hand
+type InstanceAdopter interface {
+	// AdoptInstance tags the existing instance with the given ID with the UID of the machine, so Get
+	// finds it like an instance created for the machine, and returns it
+	AdoptInstance(machine *clusterv1alpha1.Machine, instanceID string, data *ProviderData) (instance.Instance, error)
+}
+
+// InstanceTypeResolver is implemented by providers which can pick the instance type of a machine from
+// the instanceRequirements of its providerSpec, using the catalog and the prices of the cloud provider
+type InstanceTypeResolver interface {
+	// ResolveInstanceType returns the spec with the cheapest instance type meeting the requirements set
+	// and the name of the type. A type which is already set in the spec is kept.
+	ResolveInstanceType(spec clusterv1alpha1.MachineSpec) (clusterv1alpha1.MachineSpec, string, error)
+}
+
+// CapacityChecker is implemented by providers which can check the quotas of the account before instances get
+// created, so a MachineSet scaling up by many replicas fails once instead of once per machine
+type CapacityChecker interface {
+	// CheckCapacity returns a TerminalError with the QuotaExceededMachineError reason if the quotas of the
+	// account don't allow creating the given number of instances of the spec
+	CheckCapacity(spec clusterv1alpha1.MachineSpec, count int) error
+}
+
+// InstancePricer is implemented by providers whose API publishes the prices of their instance types, so the
+// cost of MachineSets can be reported for chargeback
+type InstancePricer interface {
+	// HourlyPrice returns the hourly price of a single instance of the spec and its currency, e.g. USD
+	HourlyPrice(spec clusterv1alpha1.MachineSpec) (float64, string, error)
+}
+
 // MachineModifier defines a function to modify a machine
 type MachineModifier func(*clusterv1alpha1.Machine)
 
@@ -89,6 +133,15 @@ type ProviderData struct {
 	Client ctrlruntimeclient.Client
 }
 
+// Context returns the context for the API calls of the operation, which ends with its deadline. It falls
+// back to the background context if the data or its context is nil, e.g. in tests.
+func (d *ProviderData) Context() context.Context {
+	if d == nil || d.Ctx == nil {
+		return context.Background()
+	}
+	return d.Ctx
+}
+
 // GetMachineUpdater returns an MachineUpdater based on the passed in context and ctrlruntimeclient.Client
 func GetMachineUpdater(ctx context.Context, client ctrlruntimeclient.Client) MachineUpdater {
 	return func(machine *clusterv1alpha1.Machine, modifiers ...MachineModifier) error {
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+const (
+	// clientIdleTime is how long a pooled client is kept after its last use, so clients of rotated
+	// credentials are eventually dropped
+	clientIdleTime = time.Hour
+	// pooledClientTimeout bounds each request of a pooled client, including reading the response body
+	pooledClientTimeout = time.Minute
+)
+
+// sharedTransport sends the requests of all pooled clients, so connections to the APIs are kept alive
+// and reused instead of being established for every client
+var sharedTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   10,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 30 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+// ClientPool keeps the API clients of a cloud provider per endpoint and credentials. Building a client
+// for every operation throws away its connections, so each request pays for a new TLS handshake.
+type ClientPool struct {
+	provider string
+
+	lock    sync.Mutex
+	clients *gocache.Cache
+}
+
+// NewClientPool returns an empty pool for the clients of the given provider
+func NewClientPool(provider string) *ClientPool {
+	return &ClientPool{
+		provider: provider,
+		clients:  gocache.New(clientIdleTime, clientIdleTime),
+	}
+}
+
+// Get returns the client for the given endpoint and credentials. An empty endpoint stands for the default
+// endpoint of the provider. The client is built by newClient on first use, with an HTTP client which sends
+// the requests through the shared transport, limits their rate and records their metrics, see NewTransport.
+func (p *ClientPool) Get(endpoint string, credentials []string, newClient func(*http.Client) (interface{}, error)) (interface{}, error) {
+	key := endpoint + "/" + CredentialsID(credentials...)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if client, found := p.clients.Get(key); found {
+		// Extend the idle time
+		p.clients.SetDefault(key, client)
+		return client, nil
+	}
+
+	client, err := newClient(&http.Client{
+		Transport: NewTransport(p.provider, sharedTransport, credentials...),
+		Timeout:   pooledClientTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.clients.SetDefault(key, client)
+	return client, nil
+}
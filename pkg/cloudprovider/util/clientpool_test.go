@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestClientPool(t *testing.T) {
+	pool := NewClientPool("test")
+	built := 0
+	newClient := func(httpClient *http.Client) (interface{}, error) {
+		built++
+		return httpClient, nil
+	}
+	get := func(endpoint, token string) *http.Client {
+		client, err := pool.Get(endpoint, []string{token}, newClient)
+		if err != nil {
+			t.Fatalf("failed to get client: %v", err)
+		}
+		return client.(*http.Client)
+	}
+
+	first := get("", "token-a")
+	if get("", "token-a") != first {
+		t.Error("expected the client of the same credentials to be reused")
+	}
+	if get("", "token-b") == first {
+		t.Error("expected a separate client for other credentials")
+	}
+	if get("https://api.example.com", "token-a") == first {
+		t.Error("expected a separate client for another endpoint")
+	}
+	if built != 3 {
+		t.Errorf("expected 3 clients to be built, got %d", built)
+	}
+	if first.Timeout != pooledClientTimeout {
+		t.Errorf("expected a timeout of %v, got %v", pooledClientTimeout, first.Timeout)
+	}
+
+	if _, err := pool.Get("", []string{"token-c"}, func(*http.Client) (interface{}, error) {
+		return nil, errors.New("invalid endpoint")
+	}); err == nil {
+		t.Error("expected the error of building the client")
+	}
+	if get("", "token-c") == nil || built != 4 {
+		t.Error("expected a failed build not to be pooled")
+	}
+}
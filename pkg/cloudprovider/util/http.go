@@ -21,19 +21,47 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httputil"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/klog"
 )
 
 const defaultClientTimeout = 15 * time.Second
 
+// credentialHeaders matches the headers in dumps of requests and responses which carry credentials
+var credentialHeaders = regexp.MustCompile(`(?im)^((?:Proxy-)?Authorization|X-Auth-Token|X-Subject-Token|X-Vault-Token|X-Auth-Key|Cookie|Set-Cookie):.*$`)
+
+var (
+	cloudProviderRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "machine_controller_cloud_provider_requests_total",
+		Help: "The total number of requests to the APIs of the cloud providers by provider, method and status code",
+	}, []string{"provider", "method", "code"})
+	cloudProviderRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "machine_controller_cloud_provider_request_duration_seconds",
+		Help:    "The latency of the requests to the APIs of the cloud providers by provider and method",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider", "method"})
+)
+
+// HTTPMetrics returns the metrics of the requests sent through NewMetricsTransport
+func HTTPMetrics() []prometheus.Collector {
+	return []prometheus.Collector{cloudProviderRequests, cloudProviderRequestDuration}
+}
+
 type HTTPClientConfig struct {
 	// LogPrefix is pre-pended to request/response logs
 	LogPrefix string
 	// Global timeout used by the client
 	Timeout time.Duration
+	// Provider the requests are rate limited and their metrics are recorded for, see NewTransport.
+	// Neither happens if empty.
+	Provider string
+	// Credentials the rate limit of the requests applies to
+	Credentials []string
 }
 
 // New return a custom HTTP client that allows for logging
@@ -44,15 +72,47 @@ func (c HTTPClientConfig) New() http.Client {
 	if timeout <= 0 {
 		timeout = defaultClientTimeout
 	}
+	transport := http.DefaultTransport
+	if c.Provider != "" {
+		transport = NewTransport(c.Provider, transport, c.Credentials...)
+	}
 	return http.Client{
 		Transport: &LogRoundTripper{
 			logPrefix: c.LogPrefix,
-			rt:        http.DefaultTransport,
+			rt:        transport,
 		},
 		Timeout: timeout,
 	}
 }
 
+// NewMetricsTransport returns a transport recording the status codes and latencies of the requests to
+// the API of the given cloud provider, which are sent with rt or the default transport if it is nil.
+// Requests failing without a response are recorded with the code "error".
+func NewMetricsTransport(provider string, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &metricsRoundTripper{provider: provider, rt: rt}
+}
+
+type metricsRoundTripper struct {
+	provider string
+	rt       http.RoundTripper
+}
+
+func (m *metricsRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := m.rt.RoundTrip(request)
+	cloudProviderRequestDuration.WithLabelValues(m.provider, request.Method).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if response != nil {
+		code = strconv.Itoa(response.StatusCode)
+	}
+	cloudProviderRequests.WithLabelValues(m.provider, request.Method, code).Inc()
+	return response, err
+}
+
 // LogRoundTripper is used to log information about requests and responses that
 // may be useful for debugging purposes.
 // Note that setting log level >5 results in full dumps of requests and
@@ -84,7 +144,7 @@ func (lrt *LogRoundTripper) RoundTrip(request *http.Request) (*http.Response, er
 			request.URL.RequestURI(), request.ProtoMajor, request.ProtoMinor)
 		log = b.Bytes()
 	}
-	klog.V(1).Infof("%s request sent [%s]: %s\n", lrt.logPrefix, id.String(), string(log))
+	klog.V(1).Infof("%s request sent [%s]: %s\n", lrt.logPrefix, id.String(), redactHeaders(log))
 
 	response, err := lrt.rt.RoundTrip(request)
 	if response == nil {
@@ -107,11 +167,17 @@ func (lrt *LogRoundTripper) RoundTrip(request *http.Request) (*http.Response, er
 		fmt.Fprintf(&b, "HTTP/%d.%d %03d", response.ProtoMajor, response.ProtoMinor, response.StatusCode)
 		log = b.Bytes()
 	}
-	klog.V(1).Infof("%s request received [%s]: %s\n", lrt.logPrefix, id.String(), string(log))
+	klog.V(1).Infof("%s request received [%s]: %s\n", lrt.logPrefix, id.String(), redactHeaders(log))
 
 	return response, nil
 }
 
+// redactHeaders returns the given dump with the values of headers carrying credentials, like the
+// bearer token of the cloud provider, replaced
+func redactHeaders(dump []byte) string {
+	return credentialHeaders.ReplaceAllString(string(dump), "$1: <redacted>")
+}
+
 // Return value if nonempty, def otherwise.
 func valueOrDefault(value, def string) string {
 	if value != "" {
@@ -0,0 +1,51 @@
+/*
+Copyright 2019 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewMetricsTransport("test", nil)}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	response.Body.Close()
+
+	if count := testutil.ToFloat64(cloudProviderRequests.WithLabelValues("test", http.MethodGet, "429")); count != 1 {
+		t.Errorf("expected one request with status code 429 to be recorded, got %v", count)
+	}
+
+	server.Close()
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatalf("expected the request to the closed server to fail")
+	}
+	if count := testutil.ToFloat64(cloudProviderRequests.WithLabelValues("test", http.MethodGet, "error")); count != 1 {
+		t.Errorf("expected one failed request to be recorded, got %v", count)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog"
+)
+
+// minLimiterIdleTime is the minimum time a rate limiter is kept after its last use
+const minLimiterIdleTime = time.Minute
+
+var limiters = &rateLimiters{limiters: map[string]*rateLimiter{}}
+
+// SetRateLimits limits the requests sent through NewRateLimitTransport to qps per second with the
+// given burst. The limit applies per provider and credentials. A qps of 0 disables the limit.
+func SetRateLimits(qps float32, burst int) {
+	limiters.mu.Lock()
+	defer limiters.mu.Unlock()
+	limiters.qps = qps
+	limiters.burst = burst
+	limiters.limiters = map[string]*rateLimiter{}
+}
+
+type rateLimiter struct {
+	*rate.Limiter
+	// idleSince is the time the last reservation of the limiter is due
+	idleSince time.Time
+}
+
+type rateLimiters struct {
+	mu        sync.Mutex
+	qps       float32
+	burst     int
+	limiters  map[string]*rateLimiter
+	lastSweep time.Time
+}
+
+// reserve reserves a request for the given key and returns how long it has to wait for it. The
+// reservation is nil if rate limiting is disabled.
+func (l *rateLimiters) reserve(key string, now time.Time) (*rate.Reservation, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.qps <= 0 {
+		return nil, 0
+	}
+
+	// Limiters idle for longer than it takes to refill their burst are dropped, a new one behaves the same
+	idleTime := time.Duration(float64(l.burst) / float64(l.qps) * float64(time.Second))
+	if idleTime < minLimiterIdleTime {
+		idleTime = minLimiterIdleTime
+	}
+	if now.Sub(l.lastSweep) > idleTime {
+		for k, limiter := range l.limiters {
+			if now.Sub(limiter.idleSince) > idleTime {
+				delete(l.limiters, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	limiter, exists := l.limiters[key]
+	if !exists {
+		limiter = &rateLimiter{Limiter: rate.NewLimiter(rate.Limit(l.qps), l.burst)}
+		l.limiters[key] = limiter
+	}
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	limiter.idleSince = now.Add(delay)
+	return reservation, delay
+}
+
+// NewRateLimitTransport returns a transport which waits for the rate limit configured with SetRateLimits
+// before sending a request with rt, or the default transport if it is nil. Requests to the given provider
+// with the same credentials share the limit, see CredentialsID. Waiting ends with the context of the
+// request.
+func NewRateLimitTransport(provider, credentialsID string, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &rateLimitRoundTripper{provider: provider, key: provider + "/" + credentialsID, rt: rt}
+}
+
+type rateLimitRoundTripper struct {
+	provider string
+	key      string
+	rt       http.RoundTripper
+}
+
+func (r *rateLimitRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	if err := r.wait(request.Context()); err != nil {
+		return nil, err
+	}
+	return r.rt.RoundTrip(request)
+}
+
+func (r *rateLimitRoundTripper) wait(ctx context.Context) error {
+	reservation, delay := limiters.reserve(r.key, time.Now())
+	if delay == 0 {
+		return nil
+	}
+
+	klog.V(4).Infof("Waiting %v for the rate limit of cloud provider %s", delay, r.provider)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the slot back to the other requests
+		reservation.Cancel()
+		return fmt.Errorf("failed to wait for the rate limit of cloud provider %s: %v", r.provider, ctx.Err())
+	}
+}
+
+// NewTransport returns a transport for the requests to the API of the given cloud provider, which are sent
+// with rt or the default transport if it is nil. The requests are rate limited per provider and the given
+// credentials, see NewRateLimitTransport, and their metrics are recorded, see NewMetricsTransport.
+func NewTransport(provider string, rt http.RoundTripper, credentials ...string) http.RoundTripper {
+	// The time spent waiting for the rate limit is not part of the request latency
+	return NewRateLimitTransport(provider, CredentialsID(credentials...), NewMetricsTransport(provider, rt))
+}
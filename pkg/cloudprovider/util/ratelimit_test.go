@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	// Allows a single request per credentials during the test
+	SetRateLimits(0.0001, 1)
+	defer SetRateLimits(0, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	get := func(transport http.RoundTripper, timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		response, err := transport.RoundTrip(request.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		return response.Body.Close()
+	}
+
+	transport := NewRateLimitTransport("test", "a", nil)
+	if err := get(transport, time.Minute); err != nil {
+		t.Fatalf("failed to send the first request: %v", err)
+	}
+	if err := get(transport, 10*time.Millisecond); err == nil {
+		t.Error("expected the second request with credentials a to wait for the rate limit until its context ends")
+	}
+	if err := get(NewRateLimitTransport("test", "b", nil), time.Minute); err != nil {
+		t.Errorf("expected credentials b to have their own limit, but got %v", err)
+	}
+}
+
+func TestRateLimitersDropIdleLimiters(t *testing.T) {
+	l := &rateLimiters{qps: 1, burst: 1, limiters: map[string]*rateLimiter{}}
+	start := time.Now()
+
+	l.reserve("a", start)
+	l.reserve("b", start.Add(90*time.Second))
+	// The last reservation of c is due two seconds later
+	for i := 0; i < 3; i++ {
+		l.reserve("c", start.Add(90*time.Second))
+	}
+	if _, exists := l.limiters["a"]; exists {
+		t.Error("expected the limiter of a to be dropped after being idle for more than a minute")
+	}
+
+	l.reserve("d", start.Add(152*time.Second))
+	if _, exists := l.limiters["b"]; exists {
+		t.Error("expected the limiter of b to be dropped after being idle for more than a minute")
+	}
+	if _, exists := l.limiters["c"]; !exists {
+		t.Error("expected the limiter of c to be kept until a minute after its last reservation is due")
+	}
+}
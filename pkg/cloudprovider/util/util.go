@@ -17,11 +17,18 @@ limitations under the License.
 package util
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
 	kuberneteshelper "github.com/kubermatic/machine-controller/pkg/kubernetes"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 )
 
 // RemoveFinalizerOnInstanceNotFound checks whether a finalizer exists and removes it on demand.
@@ -42,3 +49,39 @@ func RemoveFinalizerOnInstanceNotFound(finalizer string,
 
 	return true, nil
 }
+
+// CredentialsID returns an identifier of the given credentials which does not reveal them.
+func CredentialsID(credentials ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(credentials, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ChangedFields returns the sorted names of the top-level fields which differ between the given
+// JSON objects. Empty input is treated as an empty object.
+func ChangedFields(oldRaw, newRaw []byte) ([]string, error) {
+	oldFields, newFields := map[string]interface{}{}, map[string]interface{}{}
+	if len(oldRaw) > 0 {
+		if err := json.Unmarshal(oldRaw, &oldFields); err != nil {
+			return nil, err
+		}
+	}
+	if len(newRaw) > 0 {
+		if err := json.Unmarshal(newRaw, &newFields); err != nil {
+			return nil, err
+		}
+	}
+
+	var changed []string
+	for name, value := range oldFields {
+		if newValue, exists := newFields[name]; !exists || !apiequality.Semantic.DeepEqual(value, newValue) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range newFields {
+		if _, exists := oldFields[name]; !exists {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
@@ -99,3 +99,41 @@ func TestRemoveFinalizerOnInstanceNotFound(t *testing.T) {
 		})
 	}
 }
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldRaw  string
+		newRaw  string
+		changed []string
+	}{
+		{
+			name:   "no changes",
+			oldRaw: `{"region":"fra1","size":"s-1vcpu-1gb"}`,
+			newRaw: `{"size":"s-1vcpu-1gb","region":"fra1"}`,
+		},
+		{
+			name:    "changed, added and removed fields",
+			oldRaw:  `{"region":"fra1","size":"s-1vcpu-1gb","tags":["a"]}`,
+			newRaw:  `{"region":"ams3","size":"s-1vcpu-1gb","ipv6":true}`,
+			changed: []string{"ipv6", "region", "tags"},
+		},
+		{
+			name:    "empty old object",
+			newRaw:  `{"size":"s-1vcpu-1gb"}`,
+			changed: []string{"size"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changed, err := ChangedFields([]byte(test.oldRaw), []byte(test.newRaw))
+			if err != nil {
+				t.Fatalf("failed to compare the objects: %v", err)
+			}
+			if !reflect.DeepEqual(changed, test.changed) {
+				t.Errorf("Expected changed fields to be %v, but got %v", test.changed, changed)
+			}
+		})
+	}
+}
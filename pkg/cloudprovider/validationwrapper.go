@@ -28,12 +28,12 @@ import (
 )
 
 type cachingValidationWrapper struct {
-	actualProvider cloudprovidertypes.Provider
+	optionalForwarder
 }
 
 // NewValidationCacheWrappingCloudProvider returns a wrapped cloudprovider
 func NewValidationCacheWrappingCloudProvider(actualProvider cloudprovidertypes.Provider) cloudprovidertypes.Provider {
-	return &cachingValidationWrapper{actualProvider: actualProvider}
+	return &cachingValidationWrapper{optionalForwarder: optionalForwarder{actualProvider: actualProvider}}
 }
 
 // AddDefaults just calls the underlying cloudproviders AddDefaults
@@ -87,6 +87,11 @@ func (w *cachingValidationWrapper) MigrateUID(m *v1alpha1.Machine, new types.UID
 	return w.actualProvider.MigrateUID(m, new)
 }
 
+// Update just calls the underlying cloudproviders Update
+func (w *cachingValidationWrapper) Update(m *v1alpha1.Machine, data *cloudprovidertypes.ProviderData) (bool, error) {
+	return w.actualProvider.Update(m, data)
+}
+
 // MachineMetricsLabels just calls the underlying cloudproviders MachineMetricsLabels
 func (w *cachingValidationWrapper) MachineMetricsLabels(machine *v1alpha1.Machine) (map[string]string, error) {
 	return w.actualProvider.MachineMetricsLabels(machine)
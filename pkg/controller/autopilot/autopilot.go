@@ -0,0 +1,384 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autopilot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/targetcluster"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// ControllerName is name of the autopilot controller
+	ControllerName = "k0s_autopilot_controller"
+
+	// AnnotationK0sVersion requests an in place upgrade of the nodes of a MachineDeployment to the given
+	// k0s release. Once autopilot upgraded all nodes, the release gets set in the template of the
+	// MachineDeployment and its MachineSets, so new machines get it without replacing the existing ones.
+	AnnotationK0sVersion = "machine-controller.kubermatic.io/autopilot-k0s-version"
+	// AnnotationConcurrency limits how many workers autopilot upgrades at the same time. Defaults to 1,
+	// controllers always get upgraded one at a time.
+	AnnotationConcurrency = "machine-controller.kubermatic.io/autopilot-concurrency"
+
+	// annotationPaused marks MachineDeployments the controller paused to update their templates
+	annotationPaused = "machine-controller.kubermatic.io/autopilot-paused"
+	// annotationPlanOwner holds the namespace/name of the MachineDeployment a plan was created for
+	annotationPlanOwner = "machine-controller.kubermatic.io/machine-deployment"
+
+	// planName is the only name autopilot accepts plans with, so only one plan runs at a time
+	planName = "autopilot"
+	// planStateCompleted is the state of plans which upgraded all their nodes
+	planStateCompleted = "Completed"
+
+	recheckInterval = 30 * time.Second
+)
+
+// planGVK is the kind of the plans of k0s autopilot
+var planGVK = schema.GroupVersionKind{Group: "autopilot.k0sproject.io", Version: "v1beta2", Kind: "Plan"}
+
+type reconciler struct {
+	client.Client
+	// targetClient accesses the cluster the nodes join, which runs autopilot
+	targetClient client.Client
+	recorder     record.EventRecorder
+	// releaseURL is the endpoint nodes download k0s from
+	releaseURL string
+}
+
+func Add(mgr manager.Manager, targetCluster *targetcluster.Cluster, releaseURL string) error {
+	r := &reconciler{
+		Client:       mgr.GetClient(),
+		targetClient: targetCluster.Client,
+		recorder:     mgr.GetEventRecorderFor(ControllerName),
+		releaseURL:   releaseURL,
+	}
+	c, err := controller.New(ControllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return fmt.Errorf("failed to construct controller: %v", err)
+	}
+	// The progress of the plans is polled, so they need no watch
+	return c.Watch(&source.Kind{Type: &clusterv1alpha1.MachineDeployment{}}, &handler.EnqueueRequestForObject{})
+}
+
+func (r *reconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deployment := &clusterv1alpha1.MachineDeployment{}
+	if err := r.Get(ctx, request.NamespacedName, deployment); err != nil {
+		if kerrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	result, err := r.reconcile(ctx, deployment)
+	if err != nil {
+		klog.Errorf("Reconciliation of the autopilot upgrade of MachineDeployment %s failed: %v", request.NamespacedName.String(), err)
+	}
+	return result, err
+}
+
+func (r *reconciler) reconcile(ctx context.Context, deployment *clusterv1alpha1.MachineDeployment) (reconcile.Result, error) {
+	version := deployment.Annotations[AnnotationK0sVersion]
+	if version == "" || deployment.DeletionTimestamp != nil {
+		return reconcile.Result{}, nil
+	}
+	providerConfig, err := providerconfigtypes.GetConfig(deployment.Spec.Template.Spec.ProviderSpec)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to get provider config: %v", err)
+	}
+	if providerConfig.K0sVersion == version {
+		// A previous reconciliation updated the template, but failed to resume the rollouts
+		return reconcile.Result{}, r.resume(ctx, deployment)
+	}
+	if providerConfig.Role == providerconfigtypes.NodeRoleSingle {
+		r.recorder.Event(deployment, corev1.EventTypeWarning, "AutopilotUnsupported", "Single nodes run clusters of their own, which the autopilot of this cluster can't upgrade")
+		return reconcile.Result{}, nil
+	}
+	if !strings.HasPrefix(version, "v") {
+		r.recorder.Eventf(deployment, corev1.EventTypeWarning, "AutopilotInvalidVersion", "The k0s version %q of the %q annotation must start with a 'v'", version, AnnotationK0sVersion)
+		return reconcile.Result{}, nil
+	}
+	workerConcurrency, err := concurrency(deployment)
+	if err != nil {
+		r.recorder.Eventf(deployment, corev1.EventTypeWarning, "AutopilotInvalidConcurrency", "%v", err)
+		return reconcile.Result{}, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&deployment.Spec.Selector)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to parse selector: %v", err)
+	}
+	machines := &clusterv1alpha1.MachineList{}
+	if err := r.List(ctx, machines, &client.ListOptions{Namespace: deployment.Namespace, LabelSelector: selector}); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to list machines: %v", err)
+	}
+	controllers, workers, settled := nodesByRole(machines.Items)
+	// The plan covers exactly the nodes of the MachineDeployment, so it can only be created once they are known
+	if !settled {
+		klog.V(4).Infof("Waiting for the machines of MachineDeployment %s/%s to settle before upgrading them", deployment.Namespace, deployment.Name)
+		return reconcile.Result{RequeueAfter: recheckInterval}, nil
+	}
+
+	id := planID(deployment, version)
+	plan := &unstructured.Unstructured{}
+	plan.SetGroupVersionKind(planGVK)
+	if err := r.targetClient.Get(ctx, types.NamespacedName{Name: planName}, plan); err != nil {
+		if meta.IsNoMatchError(err) {
+			r.recorder.Event(deployment, corev1.EventTypeWarning, "AutopilotUnavailable", "The cluster has no autopilot Plans, autopilot must be enabled on the controllers")
+			return reconcile.Result{}, nil
+		}
+		if !kerrors.IsNotFound(err) {
+			return reconcile.Result{}, fmt.Errorf("failed to get autopilot plan: %v", err)
+		}
+		plan = newPlan(id, version, r.releaseURL, controllers, workers, workerConcurrency)
+		plan.SetAnnotations(map[string]string{annotationPlanOwner: deployment.Namespace + "/" + deployment.Name})
+		if err := r.targetClient.Create(ctx, plan); err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to create autopilot plan: %v", err)
+		}
+		r.recorder.Eventf(deployment, corev1.EventTypeNormal, "AutopilotPlanCreated", "Upgrading %d controllers and %d workers to k0s %s", len(controllers), len(workers), version)
+		return reconcile.Result{RequeueAfter: recheckInterval}, nil
+	}
+
+	currentID, _, _ := unstructured.NestedString(plan.Object, "spec", "id")
+	state, _, _ := unstructured.NestedString(plan.Object, "status", "state")
+	if currentID != id {
+		// Autopilot only runs one plan at a time, finished plans of the machine-controller make room for the next
+		if _, owned := plan.GetAnnotations()[annotationPlanOwner]; owned && !planRunning(state) {
+			if err := r.targetClient.Delete(ctx, plan); err != nil && !kerrors.IsNotFound(err) {
+				return reconcile.Result{}, fmt.Errorf("failed to delete finished autopilot plan %s: %v", currentID, err)
+			}
+			return reconcile.Result{Requeue: true}, nil
+		}
+		r.recorder.Eventf(deployment, corev1.EventTypeNormal, "AutopilotPlanPending", "Waiting for the autopilot plan %s to finish", currentID)
+		return reconcile.Result{RequeueAfter: recheckInterval}, nil
+	}
+
+	switch {
+	case state == planStateCompleted:
+		return reconcile.Result{}, r.applyVersion(ctx, deployment, version)
+	case planRunning(state):
+		return reconcile.Result{RequeueAfter: recheckInterval}, nil
+	default:
+		// Failed plans need a look by an operator, removing the plan or changing the annotation retries
+		r.recorder.Eventf(deployment, corev1.EventTypeWarning, "AutopilotPlanFailed", "The autopilot plan %s failed with state %s", currentID, state)
+		return reconcile.Result{}, nil
+	}
+}
+
+// applyVersion sets the given k0s release in the template of the MachineDeployment and its MachineSets. The
+// MachineDeployment is paused meanwhile, so it doesn't roll out a new MachineSet for the changed template.
+func (r *reconciler) applyVersion(ctx context.Context, deployment *clusterv1alpha1.MachineDeployment, version string) error {
+	if !deployment.Spec.Paused {
+		deployment.Spec.Paused = true
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+		deployment.Annotations[annotationPaused] = "true"
+		if err := r.Update(ctx, deployment); err != nil {
+			return fmt.Errorf("failed to pause MachineDeployment: %v", err)
+		}
+	}
+
+	machineSets := &clusterv1alpha1.MachineSetList{}
+	if err := r.List(ctx, machineSets, client.InNamespace(deployment.Namespace)); err != nil {
+		return fmt.Errorf("failed to list MachineSets: %v", err)
+	}
+	for i := range machineSets.Items {
+		machineSet := &machineSets.Items[i]
+		if !metav1.IsControlledBy(machineSet, deployment) {
+			continue
+		}
+		changed, err := setK0sVersion(&machineSet.Spec.Template.Spec, version)
+		if err != nil {
+			return fmt.Errorf("failed to set k0s version of MachineSet %s: %v", machineSet.Name, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := r.Update(ctx, machineSet); err != nil {
+			return fmt.Errorf("failed to update MachineSet %s: %v", machineSet.Name, err)
+		}
+	}
+
+	if _, err := setK0sVersion(&deployment.Spec.Template.Spec, version); err != nil {
+		return fmt.Errorf("failed to set k0s version of MachineDeployment: %v", err)
+	}
+	if err := r.Update(ctx, deployment); err != nil {
+		return fmt.Errorf("failed to update MachineDeployment: %v", err)
+	}
+	r.recorder.Eventf(deployment, corev1.EventTypeNormal, "AutopilotUpgraded", "Upgraded all nodes to k0s %s", version)
+	return r.resume(ctx, deployment)
+}
+
+// resume unpauses the MachineDeployment if the controller paused it
+func (r *reconciler) resume(ctx context.Context, deployment *clusterv1alpha1.MachineDeployment) error {
+	if deployment.Annotations[annotationPaused] != "true" {
+		return nil
+	}
+	deployment.Spec.Paused = false
+	delete(deployment.Annotations, annotationPaused)
+	if err := r.Update(ctx, deployment); err != nil {
+		return fmt.Errorf("failed to resume MachineDeployment: %v", err)
+	}
+	return nil
+}
+
+// concurrency returns the number of workers autopilot may upgrade at the same time
+func concurrency(deployment *clusterv1alpha1.MachineDeployment) (int64, error) {
+	value, ok := deployment.Annotations[AnnotationConcurrency]
+	if !ok {
+		return 1, nil
+	}
+	concurrency, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || concurrency < 1 {
+		return 0, fmt.Errorf("the %q annotation must be a positive number, got %q", AnnotationConcurrency, value)
+	}
+	return concurrency, nil
+}
+
+// nodesByRole returns the sorted names of the nodes of the given machines by their k0s role and
+// whether all machines have a node and none is being deleted.
+func nodesByRole(machines []clusterv1alpha1.Machine) (controllers, workers []string, settled bool) {
+	for _, machine := range machines {
+		if machine.DeletionTimestamp != nil || machine.Status.NodeRef == nil {
+			return nil, nil, false
+		}
+		providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
+		if err != nil {
+			return nil, nil, false
+		}
+		if providerConfig.Role == providerconfigtypes.NodeRoleController {
+			controllers = append(controllers, machine.Status.NodeRef.Name)
+		} else {
+			workers = append(workers, machine.Status.NodeRef.Name)
+		}
+	}
+	sort.Strings(controllers)
+	sort.Strings(workers)
+	return controllers, workers, true
+}
+
+// planID identifies the plan upgrading the given MachineDeployment to the given release
+func planID(deployment *clusterv1alpha1.MachineDeployment, version string) string {
+	return fmt.Sprintf("%s-%s-%s", deployment.Namespace, deployment.Name, version)
+}
+
+// planRunning returns whether autopilot is still working on a plan with the given state
+func planRunning(state string) bool {
+	switch state {
+	case "", "Schedulable", "SchedulableWait":
+		return true
+	}
+	return false
+}
+
+// newPlan returns the autopilot plan updating the given nodes to the given k0s release. Autopilot upgrades
+// the controllers one by one before the workers, which it upgrades concurrency at a time.
+func newPlan(id, version, releaseURL string, controllers, workers []string, concurrency int64) *unstructured.Unstructured {
+	targets := map[string]interface{}{}
+	if len(controllers) > 0 {
+		targets["controllers"] = map[string]interface{}{
+			"discovery": staticDiscovery(controllers),
+		}
+	}
+	if len(workers) > 0 {
+		targets["workers"] = map[string]interface{}{
+			"limits":    map[string]interface{}{"concurrent": concurrency},
+			"discovery": staticDiscovery(workers),
+		}
+	}
+
+	// The nodes may run on any architecture k0s is released for
+	platforms := map[string]interface{}{}
+	for _, arch := range userdatahelper.K0sArchitectures {
+		platforms["linux-"+arch] = map[string]interface{}{"url": userdatahelper.K0sBinaryURL(releaseURL, version, arch)}
+	}
+
+	plan := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"id":        id,
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"commands": []interface{}{
+				map[string]interface{}{
+					"k0supdate": map[string]interface{}{
+						"version":   version,
+						"platforms": platforms,
+						"targets":   targets,
+					},
+				},
+			},
+		},
+	}}
+	plan.SetGroupVersionKind(planGVK)
+	plan.SetName(planName)
+	return plan
+}
+
+func staticDiscovery(nodes []string) map[string]interface{} {
+	names := make([]interface{}, len(nodes))
+	for i, node := range nodes {
+		names[i] = node
+	}
+	return map[string]interface{}{"static": map[string]interface{}{"nodes": names}}
+}
+
+// setK0sVersion sets the given k0s release in the provider spec of the given machine spec and
+// returns whether it changed.
+func setK0sVersion(spec *clusterv1alpha1.MachineSpec, version string) (bool, error) {
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		return false, err
+	}
+	if providerConfig.K0sVersion == version {
+		return false, nil
+	}
+	providerConfig.K0sVersion = version
+	rawConfig, err := json.Marshal(providerConfig)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+	spec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return true, nil
+}
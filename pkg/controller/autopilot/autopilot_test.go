@@ -0,0 +1,132 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autopilot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestNodesByRole(t *testing.T) {
+	machine := func(role, nodeName string) clusterv1alpha1.Machine {
+		m := clusterv1alpha1.Machine{}
+		m.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(`{"role":"` + role + `"}`)}
+		if nodeName != "" {
+			m.Status.NodeRef = &corev1.ObjectReference{Name: nodeName}
+		}
+		return m
+	}
+	deleted := machine("", "node-d")
+	deleted.DeletionTimestamp = &metav1.Time{}
+
+	tests := []struct {
+		name                string
+		machines            []clusterv1alpha1.Machine
+		expectedControllers []string
+		expectedWorkers     []string
+		expectedSettled     bool
+	}{
+		{
+			name:                "mixed roles",
+			machines:            []clusterv1alpha1.Machine{machine("", "node-c"), machine("controller", "controller-b"), machine("worker", "node-a"), machine("controller", "controller-a")},
+			expectedControllers: []string{"controller-a", "controller-b"},
+			expectedWorkers:     []string{"node-a", "node-c"},
+			expectedSettled:     true,
+		},
+		{
+			name:            "machine without node",
+			machines:        []clusterv1alpha1.Machine{machine("", "node-a"), machine("", "")},
+			expectedSettled: false,
+		},
+		{
+			name:            "machine being deleted",
+			machines:        []clusterv1alpha1.Machine{machine("", "node-a"), deleted},
+			expectedSettled: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			controllers, workers, settled := nodesByRole(test.machines)
+			if settled != test.expectedSettled {
+				t.Fatalf("expected settled to be %v, got %v", test.expectedSettled, settled)
+			}
+			if !reflect.DeepEqual(controllers, test.expectedControllers) {
+				t.Errorf("expected controllers %v, got %v", test.expectedControllers, controllers)
+			}
+			if !reflect.DeepEqual(workers, test.expectedWorkers) {
+				t.Errorf("expected workers %v, got %v", test.expectedWorkers, workers)
+			}
+		})
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	plan := newPlan("kube-system-workers-v1.30.2+k0s.0", "v1.30.2+k0s.0", "https://example.com/k0s", []string{"controller-a"}, []string{"node-a", "node-b"}, 2)
+	if plan.GetName() != planName || plan.GroupVersionKind() != planGVK {
+		t.Fatalf("unexpected plan %s of kind %s", plan.GetName(), plan.GroupVersionKind())
+	}
+
+	// The plan must survive the round trip through the API
+	raw, err := json.Marshal(plan.Object)
+	if err != nil {
+		t.Fatalf("failed to marshal plan: %v", err)
+	}
+	decoded := &unstructured.Unstructured{}
+	if err := json.Unmarshal(raw, &decoded.Object); err != nil {
+		t.Fatalf("failed to unmarshal plan: %v", err)
+	}
+	commands, _, _ := unstructured.NestedSlice(decoded.Object, "spec", "commands")
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 command, got %d", len(commands))
+	}
+	update := commands[0].(map[string]interface{})["k0supdate"].(map[string]interface{})
+
+	if version, _, _ := unstructured.NestedString(update, "version"); version != "v1.30.2+k0s.0" {
+		t.Errorf("expected version v1.30.2+k0s.0, got %q", version)
+	}
+	if url, _, _ := unstructured.NestedString(update, "platforms", "linux-amd64", "url"); url != "https://example.com/k0s/v1.30.2+k0s.0/k0s-v1.30.2+k0s.0-amd64" {
+		t.Errorf("expected the amd64 binary url, got %q", url)
+	}
+	if url, _, _ := unstructured.NestedString(update, "platforms", "linux-arm64", "url"); url != "https://example.com/k0s/v1.30.2+k0s.0/k0s-v1.30.2+k0s.0-arm64" {
+		t.Errorf("expected the arm64 binary url, got %q", url)
+	}
+	if controllers, _, _ := unstructured.NestedStringSlice(update, "targets", "controllers", "discovery", "static", "nodes"); !reflect.DeepEqual(controllers, []string{"controller-a"}) {
+		t.Errorf("expected controllers [controller-a], got %v", controllers)
+	}
+	if workers, _, _ := unstructured.NestedStringSlice(update, "targets", "workers", "discovery", "static", "nodes"); !reflect.DeepEqual(workers, []string{"node-a", "node-b"}) {
+		t.Errorf("expected workers [node-a node-b], got %v", workers)
+	}
+	if concurrent, _, _ := unstructured.NestedFloat64(update, "targets", "workers", "limits", "concurrent"); concurrent != 2 {
+		t.Errorf("expected 2 concurrent workers, got %v", concurrent)
+	}
+
+	onlyWorkers := newPlan("id", "v1.30.2+k0s.0", "https://example.com/k0s", nil, []string{"node-a"}, 1)
+	onlyWorkersCommands, _, _ := unstructured.NestedSlice(onlyWorkers.Object, "spec", "commands")
+	targets := onlyWorkersCommands[0].(map[string]interface{})["k0supdate"].(map[string]interface{})["targets"].(map[string]interface{})
+	if _, ok := targets["controllers"]; ok {
+		t.Errorf("expected no controller targets without controllers")
+	}
+}
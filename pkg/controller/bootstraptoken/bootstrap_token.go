@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstraptoken
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/targetcluster"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// ControllerName is name of the BootstrapToken controller
+	ControllerName = "bootstrap_token_controller"
+
+	// SecretTypeBootstrapToken is the type of bootstrap token secrets
+	SecretTypeBootstrapToken corev1.SecretType = "bootstrap.kubernetes.io/token"
+	// MachineNameLabelKey is the label which holds the name of the machine a bootstrap token was created for
+	MachineNameLabelKey = "machine.k8s.io/machine.name"
+	// ExpirationKey is the key of the expiration time in bootstrap token secrets
+	ExpirationKey = "expiration"
+)
+
+type reconciler struct {
+	client.Client
+	// targetClient accesses the cluster the nodes join, which holds the bootstrap tokens and nodes
+	targetClient client.Client
+}
+
+func Add(mgr manager.Manager, targetCluster *targetcluster.Cluster) error {
+	r := &reconciler{Client: mgr.GetClient(), targetClient: targetCluster.Client}
+	c, err := controller.New(ControllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return fmt.Errorf("failed to construct controller: %v", err)
+	}
+	secretSource, err := targetCluster.Source(&corev1.Secret{})
+	if err != nil {
+		return err
+	}
+	return c.Watch(
+		secretSource,
+		&handler.EnqueueRequestForObject{},
+		predicate.Funcs{
+			CreateFunc: func(e event.CreateEvent) bool {
+				return isMachineBootstrapToken(e.Meta, e.Object)
+			},
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return isMachineBootstrapToken(e.MetaNew, e.ObjectNew)
+			},
+			// Nothing left to revoke
+			DeleteFunc: func(e event.DeleteEvent) bool {
+				return false
+			},
+			GenericFunc: func(e event.GenericEvent) bool {
+				return isMachineBootstrapToken(e.Meta, e.Object)
+			},
+		},
+	)
+}
+
+func isMachineBootstrapToken(meta metav1.Object, obj interface{}) bool {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || secret.Type != SecretTypeBootstrapToken {
+		return false
+	}
+	_, ok = meta.GetLabels()[MachineNameLabelKey]
+	return ok
+}
+
+func (r *reconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result, err := r.reconcile(ctx, request)
+	if err != nil {
+		klog.Errorf("Reconciliation of bootstrap token %s failed: %v", request.NamespacedName.String(), err)
+	}
+	return result, err
+}
+
+func (r *reconciler) reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	secret := &corev1.Secret{}
+	if err := r.targetClient.Get(ctx, request.NamespacedName, secret); err != nil {
+		if kerrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if !isMachineBootstrapToken(secret, secret) {
+		return reconcile.Result{}, nil
+	}
+	machineName := secret.Labels[MachineNameLabelKey]
+
+	// The token cleaner of the kube-controller-manager does the same, but it is not
+	// enabled in all clusters
+	expirationTime, err := time.Parse(time.RFC3339, string(secret.Data[ExpirationKey]))
+	if err != nil {
+		return reconcile.Result{}, r.revoke(ctx, secret, "it has no valid expiration time")
+	}
+	if !time.Now().Before(expirationTime) {
+		return reconcile.Result{}, r.revoke(ctx, secret, "it expired")
+	}
+
+	pending, err := r.machineIsJoining(ctx, machineName)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !pending {
+		return reconcile.Result{}, r.revoke(ctx, secret, fmt.Sprintf("no machine named %s is waiting for its node to join", machineName))
+	}
+
+	return reconcile.Result{RequeueAfter: time.Until(expirationTime)}, nil
+}
+
+// machineIsJoining returns whether a machine with the given name exists and has no ready node.
+// The label of the token only holds the name of the machine, so machines with the same name
+// in other namespaces keep the token alive as well.
+func (r *reconciler) machineIsJoining(ctx context.Context, name string) (bool, error) {
+	machines := &clusterv1alpha1.MachineList{}
+	if err := r.List(ctx, machines); err != nil {
+		return false, fmt.Errorf("failed to list machines: %v", err)
+	}
+	for _, machine := range machines.Items {
+		if machine.Name != name || machine.DeletionTimestamp != nil {
+			continue
+		}
+		if machine.Status.NodeRef == nil {
+			return true, nil
+		}
+		// The machine controller replaces instances whose node is not ready anymore
+		node := &corev1.Node{}
+		if err := r.targetClient.Get(ctx, types.NamespacedName{Name: machine.Status.NodeRef.Name}, node); err != nil {
+			if kerrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, fmt.Errorf("failed to get node %s: %v", machine.Status.NodeRef.Name, err)
+		}
+		if !nodeIsReady(node) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func nodeIsReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (r *reconciler) revoke(ctx context.Context, secret *corev1.Secret, reason string) error {
+	if err := r.targetClient.Delete(ctx, secret); err != nil && !kerrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete bootstrap token secret: %v", err)
+	}
+	klog.V(3).Infof("Revoked bootstrap token %s/%s because %s", secret.Namespace, secret.Name, reason)
+	return nil
+}
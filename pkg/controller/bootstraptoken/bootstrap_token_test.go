@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstraptoken
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog"
+	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func init() {
+	if err := clusterv1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		klog.Fatalf("failed to add clusterv1alpha1 api to scheme: %v", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	machine := func(nodeName string) *clusterv1alpha1.Machine {
+		m := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine1", Namespace: metav1.NamespaceSystem}}
+		if nodeName != "" {
+			m.Status.NodeRef = &corev1.ObjectReference{Name: nodeName}
+		}
+		return m
+	}
+	node := func(ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		expirationTime time.Time
+		objects        []runtime.Object
+		shouldRevoke   bool
+	}{
+		{
+			name:           "machine waiting for its node",
+			expirationTime: time.Now().Add(1 * time.Hour),
+			objects:        []runtime.Object{machine("")},
+			shouldRevoke:   false,
+		},
+		{
+			name:           "machine replacing a node which is not ready",
+			expirationTime: time.Now().Add(1 * time.Hour),
+			objects:        []runtime.Object{machine("node1"), node(corev1.ConditionFalse)},
+			shouldRevoke:   false,
+		},
+		{
+			name:           "machine with ready node",
+			expirationTime: time.Now().Add(1 * time.Hour),
+			objects:        []runtime.Object{machine("node1"), node(corev1.ConditionTrue)},
+			shouldRevoke:   true,
+		},
+		{
+			name:           "machine is gone",
+			expirationTime: time.Now().Add(1 * time.Hour),
+			shouldRevoke:   true,
+		},
+		{
+			name:           "expired token",
+			expirationTime: time.Now().Add(-5 * time.Minute),
+			objects:        []runtime.Object{machine("")},
+			shouldRevoke:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "bootstrap-token-abcdef",
+					Namespace: metav1.NamespaceSystem,
+					Labels:    map[string]string{MachineNameLabelKey: "machine1"},
+				},
+				Type: SecretTypeBootstrapToken,
+				Data: map[string][]byte{
+					ExpirationKey: []byte(test.expirationTime.Format(time.RFC3339)),
+				},
+			}
+			client := ctrlruntimefake.NewFakeClient(append(test.objects, secret)...)
+			r := &reconciler{Client: client, targetClient: client}
+
+			name := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+			result, err := r.reconcile(context.Background(), reconcile.Request{NamespacedName: name})
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+
+			err = client.Get(context.Background(), name, &corev1.Secret{})
+			if revoked := kerrors.IsNotFound(err); revoked != test.shouldRevoke {
+				t.Errorf("Expected token to be revoked: %t, but revoked: %t (err: %v)", test.shouldRevoke, revoked, err)
+			}
+			if !test.shouldRevoke && result.RequeueAfter <= 0 {
+				t.Error("Expected the token to be requeued for its expiration")
+			}
+		})
+	}
+}
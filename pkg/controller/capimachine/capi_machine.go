@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capimachine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// ControllerName is name of the Cluster API Machine controller
+	ControllerName = "capi_machine_controller"
+
+	// ProviderSpecAnnotation holds the provider spec of a Cluster API Machine, in the format of the
+	// providerSpec.value of cluster.k8s.io Machines. Cluster API Machines without it are ignored.
+	ProviderSpecAnnotation = "machine-controller.kubermatic.io/provider-spec"
+)
+
+// machineGVK is the kind of the Machines of upstream Cluster API
+var machineGVK = schema.GroupVersionKind{Group: "cluster.x-k8s.io", Version: "v1beta1", Kind: "Machine"}
+
+func newCAPIMachine() *unstructured.Unstructured {
+	capiMachine := &unstructured.Unstructured{}
+	capiMachine.SetGroupVersionKind(machineGVK)
+	return capiMachine
+}
+
+type reconciler struct {
+	client.Client
+	recorder record.EventRecorder
+}
+
+func Add(mgr manager.Manager) error {
+	r := &reconciler{Client: mgr.GetClient(), recorder: mgr.GetEventRecorderFor(ControllerName)}
+	c, err := controller.New(ControllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return fmt.Errorf("failed to construct controller: %v", err)
+	}
+	if err := c.Watch(&source.Kind{Type: newCAPIMachine()}, &handler.EnqueueRequestForObject{}); err != nil {
+		return fmt.Errorf("failed to watch Cluster API Machines: %v", err)
+	}
+	return c.Watch(&source.Kind{Type: &clusterv1alpha1.Machine{}}, &handler.EnqueueRequestForOwner{OwnerType: newCAPIMachine(), IsController: true})
+}
+
+func (r *reconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	capiMachine := newCAPIMachine()
+	if err := r.Get(ctx, request.NamespacedName, capiMachine); err != nil {
+		if kerrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if err := r.reconcile(ctx, capiMachine); err != nil {
+		klog.Errorf("Reconciliation of Cluster API Machine %s failed: %v", request.NamespacedName.String(), err)
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// reconcile creates the Machine of the given Cluster API Machine and reports its state. Like the instances of
+// Cluster API Machines, the Machine is not updated, changes require a new Cluster API Machine. The Machine is
+// owned by the Cluster API Machine, so the garbage collector deletes it along with it, which deletes its instance.
+func (r *reconciler) reconcile(ctx context.Context, capiMachine *unstructured.Unstructured) error {
+	if capiMachine.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	machine := &clusterv1alpha1.Machine{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: capiMachine.GetNamespace(), Name: capiMachine.GetName()}, machine)
+	if kerrors.IsNotFound(err) {
+		return r.create(ctx, capiMachine)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get Machine: %v", err)
+	}
+	if owner := metav1.GetControllerOf(machine); owner == nil || owner.UID != capiMachine.GetUID() {
+		r.recorder.Eventf(capiMachine, corev1.EventTypeWarning, "MachineExists", "Machine %s/%s of the cluster.k8s.io API exists already and is not controlled by this Machine", machine.Namespace, machine.Name)
+		return nil
+	}
+
+	updated := capiMachine.DeepCopy()
+	if err := setStatus(updated, machine); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(capiMachine.Object["status"], updated.Object["status"]) {
+		return nil
+	}
+	if err := r.Status().Update(ctx, updated); err != nil {
+		return fmt.Errorf("failed to update status: %v", err)
+	}
+	return nil
+}
+
+func (r *reconciler) create(ctx context.Context, capiMachine *unstructured.Unstructured) error {
+	machine, err := convert(capiMachine)
+	if err != nil {
+		// Only a change of the Cluster API Machine can fix this, which triggers a new reconciliation anyway
+		r.recorder.Event(capiMachine, corev1.EventTypeWarning, "ConversionFailed", err.Error())
+		return nil
+	}
+	if err := r.Create(ctx, machine); err != nil {
+		return fmt.Errorf("failed to create Machine: %v", err)
+	}
+	klog.V(2).Infof("Created Machine %s/%s for Cluster API Machine", machine.Namespace, machine.Name)
+	return nil
+}
+
+// convert returns the Machine of the cluster.k8s.io API for the given Cluster API Machine. It gets the name,
+// namespace and labels of the Cluster API Machine, its provider spec from the ProviderSpecAnnotation and its
+// kubelet version from spec.version.
+func convert(capiMachine *unstructured.Unstructured) (*clusterv1alpha1.Machine, error) {
+	providerSpec := capiMachine.GetAnnotations()[ProviderSpecAnnotation]
+	if providerSpec == "" {
+		return nil, fmt.Errorf("the provider spec must be set in the %q annotation", ProviderSpecAnnotation)
+	}
+	if !json.Valid([]byte(providerSpec)) {
+		return nil, fmt.Errorf("the provider spec of the %q annotation is no valid JSON", ProviderSpecAnnotation)
+	}
+	version, _, err := unstructured.NestedString(capiMachine.Object, "spec", "version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get spec.version: %v", err)
+	}
+	if version == "" {
+		return nil, fmt.Errorf("spec.version must be set")
+	}
+
+	return &clusterv1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            capiMachine.GetName(),
+			Namespace:       capiMachine.GetNamespace(),
+			Labels:          capiMachine.GetLabels(),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(capiMachine, machineGVK)},
+		},
+		Spec: clusterv1alpha1.MachineSpec{
+			ProviderSpec: clusterv1alpha1.ProviderSpec{Value: &runtime.RawExtension{Raw: []byte(providerSpec)}},
+			Versions:     clusterv1alpha1.MachineVersionInfo{Kubelet: strings.TrimPrefix(version, "v")},
+		},
+	}, nil
+}
+
+// setStatus sets the status fields of the given Cluster API Machine the state of the given Machine maps to.
+// The machine-controller bootstraps the node itself, so the bootstrap data is always ready.
+func setStatus(capiMachine *unstructured.Unstructured, machine *clusterv1alpha1.Machine) error {
+	status := map[string]interface{}{}
+	if existing, ok := capiMachine.Object["status"].(map[string]interface{}); ok {
+		status = existing
+	}
+	for _, field := range []string{"phase", "nodeRef", "addresses", "failureReason", "failureMessage"} {
+		delete(status, field)
+	}
+
+	var phase string
+	if machine.Status.Phase != nil {
+		phase = *machine.Status.Phase
+		status["phase"] = phase
+	}
+	status["bootstrapReady"] = true
+	status["infrastructureReady"] = phase == clusterv1alpha1.MachinePhaseProvisioned || phase == clusterv1alpha1.MachinePhaseRunning
+	if nodeRef := machine.Status.NodeRef; nodeRef != nil {
+		status["nodeRef"] = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Node",
+			"name":       nodeRef.Name,
+			"uid":        string(nodeRef.UID),
+		}
+	}
+	if len(machine.Status.Addresses) > 0 {
+		addresses := make([]interface{}, 0, len(machine.Status.Addresses))
+		for _, address := range machine.Status.Addresses {
+			addresses = append(addresses, map[string]interface{}{"type": string(address.Type), "address": address.Address})
+		}
+		status["addresses"] = addresses
+	}
+	if machine.Status.ErrorReason != nil {
+		status["failureReason"] = string(*machine.Status.ErrorReason)
+	}
+	if machine.Status.ErrorMessage != nil {
+		status["failureMessage"] = *machine.Status.ErrorMessage
+	}
+
+	if err := unstructured.SetNestedMap(capiMachine.Object, status, "status"); err != nil {
+		return fmt.Errorf("failed to set status: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capimachine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestConvert(t *testing.T) {
+	const providerSpec = `{"cloudProvider":"hetzner","operatingSystem":"ubuntu"}`
+	capiMachine := func(annotation, version string) *unstructured.Unstructured {
+		capiMachine := newCAPIMachine()
+		capiMachine.SetName("worker-a")
+		capiMachine.SetNamespace("default")
+		capiMachine.SetUID(types.UID("capi-uid"))
+		capiMachine.SetLabels(map[string]string{"cluster.x-k8s.io/cluster-name": "my-cluster"})
+		if annotation != "" {
+			capiMachine.SetAnnotations(map[string]string{ProviderSpecAnnotation: annotation})
+		}
+		if version != "" {
+			if err := unstructured.SetNestedField(capiMachine.Object, version, "spec", "version"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return capiMachine
+	}
+
+	tests := []struct {
+		name        string
+		capiMachine *unstructured.Unstructured
+		expectErr   bool
+	}{
+		{
+			name:        "converted",
+			capiMachine: capiMachine(providerSpec, "v1.19.4"),
+		},
+		{
+			name:        "no provider spec",
+			capiMachine: capiMachine("", "v1.19.4"),
+			expectErr:   true,
+		},
+		{
+			name:        "invalid provider spec",
+			capiMachine: capiMachine(`{"cloudProvider":`, "v1.19.4"),
+			expectErr:   true,
+		},
+		{
+			name:        "no version",
+			capiMachine: capiMachine(providerSpec, ""),
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			machine, err := convert(test.capiMachine)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("Expected error to be %t, but got %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if machine.Name != "worker-a" || machine.Namespace != "default" || machine.Labels["cluster.x-k8s.io/cluster-name"] != "my-cluster" {
+				t.Errorf("Expected the metadata of the Cluster API Machine, got %v", machine.ObjectMeta)
+			}
+			if string(machine.Spec.ProviderSpec.Value.Raw) != providerSpec {
+				t.Errorf("Expected the provider spec of the annotation, got %s", machine.Spec.ProviderSpec.Value.Raw)
+			}
+			if machine.Spec.Versions.Kubelet != "1.19.4" {
+				t.Errorf("Expected kubelet version 1.19.4, got %q", machine.Spec.Versions.Kubelet)
+			}
+			if len(machine.OwnerReferences) != 1 || machine.OwnerReferences[0].UID != "capi-uid" || machine.OwnerReferences[0].Kind != "Machine" || machine.OwnerReferences[0].APIVersion != "cluster.x-k8s.io/v1beta1" {
+				t.Errorf("Expected the Cluster API Machine as controller, got %v", machine.OwnerReferences)
+			}
+		})
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	phase := clusterv1alpha1.MachinePhaseRunning
+	reason := common.MachineStatusError("CreateError")
+	message := "quota exceeded"
+	machine := &clusterv1alpha1.Machine{Status: clusterv1alpha1.MachineStatus{
+		Phase:        &phase,
+		NodeRef:      &corev1.ObjectReference{Kind: "Node", Name: "worker-a", UID: types.UID("node-uid")},
+		Addresses:    []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.2"}},
+		ErrorReason:  &reason,
+		ErrorMessage: &message,
+	}}
+	capiMachine := newCAPIMachine()
+	capiMachine.Object["status"] = map[string]interface{}{"observedGeneration": int64(2), "failureMessage": "outdated"}
+
+	if err := setStatus(capiMachine, machine); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"observedGeneration":  int64(2),
+		"phase":               "Running",
+		"bootstrapReady":      true,
+		"infrastructureReady": true,
+		"nodeRef":             map[string]interface{}{"apiVersion": "v1", "kind": "Node", "name": "worker-a", "uid": "node-uid"},
+		"addresses":           []interface{}{map[string]interface{}{"type": "InternalIP", "address": "10.0.0.2"}},
+		"failureReason":       "CreateError",
+		"failureMessage":      "quota exceeded",
+	}
+	if !reflect.DeepEqual(capiMachine.Object["status"], expected) {
+		t.Errorf("Expected status %v, got %v", expected, capiMachine.Object["status"])
+	}
+
+	// Fields of a former state are removed
+	provisioning := clusterv1alpha1.MachinePhaseProvisioning
+	if err := setStatus(capiMachine, &clusterv1alpha1.Machine{Status: clusterv1alpha1.MachineStatus{Phase: &provisioning}}); err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]interface{}{
+		"observedGeneration":  int64(2),
+		"phase":               "Provisioning",
+		"bootstrapReady":      true,
+		"infrastructureReady": false,
+	}
+	if !reflect.DeepEqual(capiMachine.Object["status"], expected) {
+		t.Errorf("Expected status %v, got %v", expected, capiMachine.Object["status"])
+	}
+}
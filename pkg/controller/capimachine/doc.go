@@ -0,0 +1,22 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package capimachine contains a controller converting the Machines of upstream Cluster API (cluster.x-k8s.io) into
+Machines of the cluster.k8s.io API, so the providers of the machine-controller create their instances, and reporting
+their state back in the status of the Cluster API Machines.
+*/
+package capimachine
@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/approval"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// AnnotationDeletionApproved holds when the approval webhook approved the deletion of a machine
+	AnnotationDeletionApproved = "machine-controller.kubermatic.io/deletion-approved"
+	// AnnotationCreationApproved holds when the approval webhook approved the creation of the next instance of a
+	// machine. It is removed once the instance got created, so every instance needs an approval
+	AnnotationCreationApproved = "machine-controller.kubermatic.io/creation-approved"
+
+	// approvalRecheckInterval is how long a machine whose operation was not approved waits before the approval
+	// webhook is asked again
+	approvalRecheckInterval = time.Minute
+)
+
+// ensureApproved returns nil if the operation on the machine needs no approval or the approval webhook approved it.
+// Approvals are recorded in the given annotation, so the webhook is not asked again on the next reconciliation.
+// Otherwise, also if the webhook is unavailable, the machine is requeued to ask again.
+func (r *Reconciler) ensureApproved(machine *clusterv1alpha1.Machine, operation approval.Operation, annotation string) (*reconcile.Result, error) {
+	if !r.approvalGate.Gates(operation) || machine.Annotations[annotation] != "" {
+		return nil, nil
+	}
+
+	response, err := r.approvalGate.Review(r.ctx, operation, machine)
+	if err != nil {
+		klog.Errorf("Failed to ask for the approval of the %s of machine %q: %v", operation, machine.Name, err)
+		r.recorder.Eventf(machine, corev1.EventTypeWarning, "ApprovalFailed", "Failed to ask for the approval of the %s: %v", operation, err)
+		return &reconcile.Result{RequeueAfter: approvalRecheckInterval}, nil
+	}
+	if !response.Approved {
+		klog.V(3).Infof("The %s of machine %q was not approved: %s", operation, machine.Name, response.Reason)
+		r.recorder.Eventf(machine, corev1.EventTypeWarning, "NotApproved", "The %s was not approved: %s", operation, response.Reason)
+		return &reconcile.Result{RequeueAfter: approvalRecheckInterval}, nil
+	}
+
+	if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+		if m.Annotations == nil {
+			m.Annotations = map[string]string{}
+		}
+		m.Annotations[annotation] = time.Now().UTC().Format(time.RFC3339)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record the approval of the %s: %v", operation, err)
+	}
+	r.recorder.Eventf(machine, corev1.EventTypeNormal, "Approved", "The %s was approved: %s", operation, response.Reason)
+	return nil, nil
+}
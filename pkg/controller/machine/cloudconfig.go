@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// cloudConfigSecretPrefix is the prefix of the names of the published cloud config secrets, which
+	// are suffixed with the name of the cloud provider
+	cloudConfigSecretPrefix = "machine-controller-cloud-config-"
+	// cloudConfigSecretKey holds the cloud config in the published secrets
+	cloudConfigSecretKey = "config"
+)
+
+// cloudConfigPublisher publishes the cloud configs rendered for machines as secrets in the target cluster,
+// so out-of-tree cloud-controller-managers can mount them. Secrets are only written if their content changed
+// since they were last published by this process.
+type cloudConfigPublisher struct {
+	client    kubernetes.Interface
+	namespace string
+
+	// published holds the hash of the cloud config last published, keyed by the name of the secret
+	published sync.Map
+}
+
+// newCloudConfigPublisher returns a publisher for the given namespace, an empty namespace disables the publication
+func newCloudConfigPublisher(client kubernetes.Interface, namespace string) *cloudConfigPublisher {
+	if namespace == "" {
+		return nil
+	}
+	return &cloudConfigPublisher{client: client, namespace: namespace}
+}
+
+// publish creates or refreshes the secret of the given cloud provider. Empty cloud configs are not published.
+func (p *cloudConfigPublisher) publish(cloudProviderName, cloudConfig string) error {
+	if p == nil || cloudProviderName == "" || cloudConfig == "" {
+		return nil
+	}
+	name := cloudConfigSecretPrefix + cloudProviderName
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(cloudConfig)))
+	if published, ok := p.published.Load(name); ok && published.(string) == hash {
+		return nil
+	}
+
+	secrets := p.client.CoreV1().Secrets(p.namespace)
+	secret, err := secrets.Get(name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: p.namespace,
+			},
+			Data: map[string][]byte{cloudConfigSecretKey: []byte(cloudConfig)},
+		}
+		if _, err := secrets.Create(secret); err != nil {
+			return fmt.Errorf("failed to create secret %s/%s: %v", p.namespace, name, err)
+		}
+		klog.V(2).Infof("Published the cloud config of %s in secret %s/%s", cloudProviderName, p.namespace, name)
+		p.published.Store(name, hash)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %v", p.namespace, name, err)
+	}
+
+	if string(secret.Data[cloudConfigSecretKey]) != cloudConfig {
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[cloudConfigSecretKey] = []byte(cloudConfig)
+		if _, err := secrets.Update(secret); err != nil {
+			return fmt.Errorf("failed to update secret %s/%s: %v", p.namespace, name, err)
+		}
+		klog.V(2).Infof("Refreshed the cloud config of %s in secret %s/%s", cloudProviderName, p.namespace, name)
+	}
+	p.published.Store(name, hash)
+	return nil
+}
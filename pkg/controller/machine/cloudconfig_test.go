@@ -0,0 +1,63 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCloudConfigPublisher(t *testing.T) {
+	if publisher := newCloudConfigPublisher(fake.NewSimpleClientset(), ""); publisher != nil {
+		t.Fatal("Expected no publisher without a namespace")
+	}
+
+	client := fake.NewSimpleClientset()
+	publisher := newCloudConfigPublisher(client, "kube-system")
+	if err := publisher.publish("openstack", ""); err != nil {
+		t.Fatalf("failed to skip empty cloud config: %v", err)
+	}
+	if len(client.Actions()) != 0 {
+		t.Fatalf("Expected no requests for an empty cloud config, got %d", len(client.Actions()))
+	}
+
+	for _, config := range []string{"[Global]\nregion=one", "[Global]\nregion=one", "[Global]\nregion=two"} {
+		if err := publisher.publish("openstack", config); err != nil {
+			t.Fatalf("failed to publish cloud config: %v", err)
+		}
+		secret, err := client.CoreV1().Secrets("kube-system").Get("machine-controller-cloud-config-openstack", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get secret: %v", err)
+		}
+		if published := string(secret.Data["config"]); published != config {
+			t.Errorf("Expected the secret to hold %q, got %q", config, published)
+		}
+	}
+
+	// Publishing an unchanged cloud config again does not write the secret
+	writes := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "create" || action.GetVerb() == "update" {
+			writes++
+		}
+	}
+	if writes != 2 {
+		t.Errorf("Expected the secret to be written twice, got %d writes", writes)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+// MachineDebugState is the view of the controller on a machine, as of its last reconciliation
+type MachineDebugState struct {
+	Machine           string    `json:"machine"`
+	LastReconcile     time.Time `json:"lastReconcile"`
+	ReconcileDuration string    `json:"reconcileDuration"`
+	InstanceID        string    `json:"instanceID,omitempty"`
+	InstanceStatus    string    `json:"instanceStatus,omitempty"`
+	// InstanceLookup is when the instance was last looked up at the cloud provider
+	InstanceLookup *time.Time `json:"instanceLookup,omitempty"`
+	// InstanceError is the error of the last lookup of the instance, with credentials redacted
+	InstanceError string `json:"instanceError,omitempty"`
+	// NextReconcile is when the machine gets requeued, unset if it waits for a change
+	NextReconcile *time.Time `json:"nextReconcile,omitempty"`
+	// LastError is the error of the last reconciliation, with credentials redacted
+	LastError string `json:"lastError,omitempty"`
+}
+
+// DebugState holds the view of the controller on the machines it reconciled, so it can be inspected
+// without raising the log level. A nil DebugState records nothing.
+type DebugState struct {
+	lock     sync.Mutex
+	machines map[types.NamespacedName]*MachineDebugState
+}
+
+// NewDebugState returns an empty DebugState
+func NewDebugState() *DebugState {
+	return &DebugState{machines: map[types.NamespacedName]*MachineDebugState{}}
+}
+
+// machine returns the state of the given machine, the lock must be held
+func (s *DebugState) machine(name types.NamespacedName) *MachineDebugState {
+	state, found := s.machines[name]
+	if !found {
+		state = &MachineDebugState{Machine: name.String()}
+		s.machines[name] = state
+	}
+	return state
+}
+
+// recordInstance records the response of the cloud provider to the lookup of the instance of the given machine
+func (s *DebugState) recordInstance(name types.NamespacedName, providerInstance instance.Instance, errMessage string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state := s.machine(name)
+	now := time.Now()
+	state.InstanceLookup = &now
+	state.InstanceError = errMessage
+	state.InstanceID = ""
+	state.InstanceStatus = ""
+	if providerInstance != nil {
+		state.InstanceID = providerInstance.ID()
+		state.InstanceStatus = string(providerInstance.Status())
+	}
+}
+
+// recordReconcile records the outcome of a reconciliation of the given machine, which started at the given time
+func (s *DebugState) recordReconcile(name types.NamespacedName, started time.Time, requeueAfter time.Duration, errMessage string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	state := s.machine(name)
+	state.LastReconcile = started
+	state.ReconcileDuration = time.Since(started).Round(time.Millisecond).String()
+	state.LastError = errMessage
+	state.NextReconcile = nil
+	if requeueAfter > 0 {
+		next := time.Now().Add(requeueAfter)
+		state.NextReconcile = &next
+	}
+}
+
+// forget drops the state of a machine which is gone
+func (s *DebugState) forget(name types.NamespacedName) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.machines, name)
+}
+
+// Machines returns the state of all machines, ordered by namespace and name
+func (s *DebugState) Machines() []MachineDebugState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	machines := make([]MachineDebugState, 0, len(s.machines))
+	for _, state := range s.machines {
+		machines = append(machines, *state)
+	}
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Machine < machines[j].Machine
+	})
+	return machines
+}
+
+// ServeHTTP writes the state of all machines as JSON
+func (s *DebugState) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s.Machines()); err != nil {
+		klog.Errorf("Failed to write the debug state of the machines: %v", err)
+	}
+}
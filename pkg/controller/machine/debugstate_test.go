@@ -0,0 +1,53 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDebugState(t *testing.T) {
+	state := NewDebugState()
+	machine1 := types.NamespacedName{Namespace: "kube-system", Name: "machine-1"}
+	machine2 := types.NamespacedName{Namespace: "kube-system", Name: "machine-2"}
+
+	state.recordInstance(machine2, nil, "instance not found")
+	state.recordReconcile(machine2, time.Now(), time.Minute, "failed to create instance")
+	state.recordReconcile(machine1, time.Now(), 0, "")
+
+	machines := state.Machines()
+	if len(machines) != 2 || machines[0].Machine != machine1.String() || machines[1].Machine != machine2.String() {
+		t.Fatalf("expected the state of both machines ordered by name, got %+v", machines)
+	}
+	if machines[0].NextReconcile != nil || machines[0].InstanceLookup != nil {
+		t.Errorf("expected machine-1 to wait for a change without an instance lookup, got %+v", machines[0])
+	}
+	if machines[1].NextReconcile == nil || machines[1].LastError != "failed to create instance" || machines[1].InstanceError != "instance not found" {
+		t.Errorf("expected machine-2 to be requeued with its errors, got %+v", machines[1])
+	}
+
+	state.forget(machine2)
+	if machines := state.Machines(); len(machines) != 1 {
+		t.Errorf("expected the state of the deleted machine to be dropped, got %+v", machines)
+	}
+
+	var disabled *DebugState
+	disabled.recordReconcile(machine1, time.Now(), 0, "")
+}
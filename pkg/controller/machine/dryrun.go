@@ -0,0 +1,150 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// AnnotationDryRun makes the machine-controller render the userdata of a machine to a ConfigMap and check
+	// the quotas of the cloud provider instead of creating its instance while it is set to "true"
+	AnnotationDryRun = "machine-controller.kubermatic.io/dry-run"
+
+	// DryRunConfigMapUserdataKey is the key of the rendered userdata in the dry-run ConfigMap of a machine
+	DryRunConfigMapUserdataKey = "userdata"
+	// DryRunConfigMapCapacityKey is the key of the result of the quota check in the dry-run ConfigMap of a machine
+	DryRunConfigMapCapacityKey = "capacity"
+
+	dryRunMachineLabelKey = "machine-controller.kubermatic.io/dry-run-machine"
+)
+
+// DryRunConfigMapName returns the name of the ConfigMap holding the result of the dry-run of the given machine
+func DryRunConfigMapName(machineName string) string {
+	return machineName + "-dry-run"
+}
+
+// isDryRun returns whether the instance of the given machine must not be created
+func (r *Reconciler) isDryRun(machine *clusterv1alpha1.Machine) bool {
+	return r.dryRun || machine.Annotations[AnnotationDryRun] == "true"
+}
+
+// dryRunCreate stores the rendered userdata of the machine and the result of the quota check in its dry-run
+// ConfigMap instead of creating the instance. The credentials of the userdata are redacted and the bootstrap
+// token created for it is deleted, as no instance is going to use it. The machine is not requeued, removing
+// the annotation or the flag lets the next reconciliation create the instance.
+func (r *Reconciler) dryRunCreate(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine, userdata string, kubeconfig *clientcmdapi.Config, k0sJoinToken string) (*reconcile.Result, error) {
+	capacity := "not supported by the cloud provider"
+	if checker, ok := prov.(cloudprovidertypes.CapacityChecker); ok {
+		if err := checker.CheckCapacity(machine.Spec, 1); err == nil {
+			capacity = "available"
+		} else if err != cloudprovidererrors.ErrCapacityCheckNotSupported {
+			capacity = r.redact(machine, err.Error())
+			r.recorder.Eventf(machine, corev1.EventTypeWarning, "DryRunCapacity", "Quota check failed: %s", capacity)
+		}
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            DryRunConfigMapName(machine.Name),
+			Namespace:       machine.Namespace,
+			Labels:          map[string]string{dryRunMachineLabelKey: machine.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(machine, clusterv1alpha1.SchemeGroupVersion.WithKind("Machine"))},
+		},
+		Data: map[string]string{
+			DryRunConfigMapUserdataKey: r.redactUserdata(machine, redactKubeconfigCredentials(userdata, kubeconfig, k0sJoinToken)),
+			DryRunConfigMapCapacityKey: capacity,
+		},
+	}
+	existing := &corev1.ConfigMap{}
+	err := r.client.Get(r.ctx, types.NamespacedName{Namespace: configMap.Namespace, Name: configMap.Name}, existing)
+	switch {
+	case kerrors.IsNotFound(err):
+		err = r.client.Create(r.ctx, configMap)
+	case err == nil:
+		existing.Labels = configMap.Labels
+		existing.OwnerReferences = configMap.OwnerReferences
+		existing.Data = configMap.Data
+		err = r.client.Update(r.ctx, existing)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write the dry-run ConfigMap %s: %v", configMap.Name, err)
+	}
+
+	if err := r.deleteBootstrapToken(machine.Name); err != nil {
+		return nil, fmt.Errorf("failed to delete the bootstrap token of the dry-run: %v", err)
+	}
+	r.recorder.Eventf(machine, corev1.EventTypeNormal, "DryRun", "Rendered the userdata to ConfigMap %s instead of creating an instance", configMap.Name)
+	klog.V(3).Infof("Dry-run of machine %s finished, wrote ConfigMap %s", machine.Name, configMap.Name)
+	return nil, nil
+}
+
+// redactUserdata replaces the inline credentials of the machine and the ones resolved for it in the userdata.
+// Resolved values are replaced as they are, quoted, base64 encoded and line by line, as multi-line values like
+// the contents of files get indented by the templates.
+func (r *Reconciler) redactUserdata(machine *clusterv1alpha1.Machine, userdata string) string {
+	var secrets []string
+	for _, secret := range r.resolvedSecrets(machine) {
+		quoted := strconv.Quote(secret)
+		secrets = append(secrets, secret, quoted[1:len(quoted)-1], base64.StdEncoding.EncodeToString([]byte(secret)))
+		if strings.Contains(secret, "\n") {
+			for _, line := range strings.Split(secret, "\n") {
+				secrets = append(secrets, strings.TrimSpace(line))
+			}
+		}
+	}
+	return providerconfig.RedactMessage(userdata, machine.Spec.ProviderSpec.Value, secrets...)
+}
+
+// redactKubeconfigCredentials replaces the credentials of the kubeconfig and the k0s join token in the userdata,
+// both as they are and base64 encoded
+func redactKubeconfigCredentials(userdata string, kubeconfig *clientcmdapi.Config, k0sJoinToken string) string {
+	var credentials []string
+	if k0sJoinToken != "" {
+		credentials = append(credentials, k0sJoinToken)
+	}
+	if kubeconfig != nil {
+		for _, authInfo := range kubeconfig.AuthInfos {
+			for _, credential := range []string{authInfo.Token, authInfo.Password, string(authInfo.ClientKeyData)} {
+				if credential != "" {
+					credentials = append(credentials, credential)
+				}
+			}
+		}
+	}
+	for _, credential := range credentials {
+		userdata = strings.ReplaceAll(userdata, credential, providerconfig.Redacted)
+		userdata = strings.ReplaceAll(userdata, base64.StdEncoding.EncodeToString([]byte(credential)), providerconfig.Redacted)
+	}
+	return userdata
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/record"
+	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDryRunCreate(t *testing.T) {
+	machine := &clusterv1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "machine",
+			Namespace:   "kube-system",
+			UID:         "machine-uid",
+			Annotations: map[string]string{AnnotationDryRun: "true"},
+		},
+	}
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "bootstrap-token-abcdef",
+			Namespace: metav1.NamespaceSystem,
+			Labels:    map[string]string{machineNameLabelKey: "machine"},
+		},
+		Type: secretTypeBootstrapToken,
+	}
+	kubeconfig := &clientcmdapi.Config{
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{"": {Token: "abcdef.0123456789abcdef"}},
+	}
+	userdata := strings.Join([]string{
+		"token: abcdef.0123456789abcdef",
+		"encoded: " + base64.StdEncoding.EncodeToString([]byte("abcdef.0123456789abcdef")),
+		"k0s: k0s-join-token",
+	}, "\n")
+	client := ctrlruntimefake.NewFakeClient()
+	reconciler := Reconciler{
+		ctx:          context.Background(),
+		client:       client,
+		targetClient: ctrlruntimefake.NewFakeClient(token),
+		recorder:     record.NewFakeRecorder(10),
+	}
+	if !reconciler.isDryRun(machine) {
+		t.Fatalf("Expected the annotated machine to be dry-run")
+	}
+
+	// Dry-runs are repeatable, the ConfigMap gets updated
+	for i := 0; i < 2; i++ {
+		result, err := reconciler.dryRunCreate(nil, machine, userdata, kubeconfig, "k0s-join-token")
+		if err != nil {
+			t.Fatalf("Unexpected error running dryRunCreate: %v", err)
+		}
+		if result != nil {
+			t.Errorf("Expected the machine not to be requeued, got %+v", result)
+		}
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := client.Get(reconciler.ctx, types.NamespacedName{Namespace: "kube-system", Name: "machine-dry-run"}, configMap); err != nil {
+		t.Fatalf("Failed to get the dry-run ConfigMap: %v", err)
+	}
+	expected := "token: <redacted>\nencoded: <redacted>\nk0s: <redacted>"
+	if configMap.Data[DryRunConfigMapUserdataKey] != expected {
+		t.Errorf("Expected userdata %q, got %q", expected, configMap.Data[DryRunConfigMapUserdataKey])
+	}
+	if configMap.Data[DryRunConfigMapCapacityKey] != "not supported by the cloud provider" {
+		t.Errorf("Expected the capacity check to be unsupported, got %q", configMap.Data[DryRunConfigMapCapacityKey])
+	}
+	if len(configMap.OwnerReferences) != 1 || configMap.OwnerReferences[0].UID != machine.UID {
+		t.Errorf("Expected the ConfigMap to be owned by the machine, got %+v", configMap.OwnerReferences)
+	}
+	secret, err := reconciler.getSecretIfExists("machine")
+	if err != nil {
+		t.Fatalf("Unexpected error getting the token secret: %v", err)
+	}
+	if secret != nil {
+		t.Errorf("Expected the bootstrap token of the dry-run to be deleted")
+	}
+}
+
+func TestDryRunRedactsResolvedSecrets(t *testing.T) {
+	machine := &clusterv1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "kube-system", UID: "machine-uid"},
+	}
+	machine.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(`{"cloudProvider":"fake","operatingSystem":"ubuntu",
+		"registryCredentials":{"registry.example.com":{"username":"puller",
+		"password":{"secretKeyRef":{"namespace":"kube-system","name":"registry","key":"password"}}}}}`)}
+	registrySecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "kube-system"},
+		Data:       map[string][]byte{"password": []byte(`s3cr3t"pass`)},
+	}
+	client := ctrlruntimefake.NewFakeClient(registrySecret)
+	reconciler := Reconciler{
+		ctx:          context.Background(),
+		client:       client,
+		targetClient: ctrlruntimefake.NewFakeClient(),
+		recorder:     record.NewFakeRecorder(10),
+	}
+
+	spec, err := resolveNodeConfigVars(reconciler.configVarResolver(machine), machine.Spec)
+	if err != nil {
+		t.Fatalf("Failed to resolve the node settings: %v", err)
+	}
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		t.Fatalf("Failed to get the provider config: %v", err)
+	}
+	userdata, err := userdatahelper.K0sContainerdConfig(nil, nil, providerConfig.RegistryCredentials)
+	if err != nil {
+		t.Fatalf("Failed to render the containerd config: %v", err)
+	}
+	if !strings.Contains(userdata, `s3cr3t\"pass`) {
+		t.Fatalf("Expected the rendered userdata to contain the password, got %q", userdata)
+	}
+
+	if _, err := reconciler.dryRunCreate(nil, machine, userdata, nil, ""); err != nil {
+		t.Fatalf("Unexpected error running dryRunCreate: %v", err)
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := client.Get(reconciler.ctx, types.NamespacedName{Namespace: "kube-system", Name: "machine-dry-run"}, configMap); err != nil {
+		t.Fatalf("Failed to get the dry-run ConfigMap: %v", err)
+	}
+	if rendered := configMap.Data[DryRunConfigMapUserdataKey]; strings.Contains(rendered, "s3cr3t") || !strings.Contains(rendered, `password = "<redacted>"`) {
+		t.Errorf("Expected the registry password to be redacted, got %q", rendered)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+// aggregatingRecorder emits a warning event of an object at most once per window for each reason. The repeats
+// within the window are counted and reported with the next event of the reason, so a machine failing every few
+// seconds produces a single event per window, which the event correlator of client-go then keeps updating,
+// instead of hundreds. Normal events are passed through.
+type aggregatingRecorder struct {
+	record.EventRecorder
+	window time.Duration
+
+	lock      sync.Mutex
+	warnings  map[aggregationKey]*aggregatedWarning
+	lastSweep time.Time
+}
+
+type aggregationKey struct {
+	uid    string
+	reason string
+}
+
+type aggregatedWarning struct {
+	emitted time.Time
+	repeats int
+}
+
+// newAggregatingRecorder wraps the given recorder, a window of 0 disables the aggregation
+func newAggregatingRecorder(recorder record.EventRecorder, window time.Duration) record.EventRecorder {
+	if window <= 0 {
+		return recorder
+	}
+	return &aggregatingRecorder{
+		EventRecorder: recorder,
+		window:        window,
+		warnings:      map[aggregationKey]*aggregatedWarning{},
+		lastSweep:     time.Now(),
+	}
+}
+
+func (r *aggregatingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if message, ok := r.aggregate(object, eventtype, reason, message); ok {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (r *aggregatingRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *aggregatingRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	if message, ok := r.aggregate(object, eventtype, reason, fmt.Sprintf(messageFmt, args...)); ok {
+		r.EventRecorder.PastEventf(object, timestamp, eventtype, reason, "%s", message)
+	}
+}
+
+func (r *aggregatingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if message, ok := r.aggregate(object, eventtype, reason, fmt.Sprintf(messageFmt, args...)); ok {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	}
+}
+
+// aggregate returns the message to emit and whether the event should be emitted
+func (r *aggregatingRecorder) aggregate(object runtime.Object, eventtype, reason, message string) (string, bool) {
+	if eventtype != corev1.EventTypeWarning {
+		return message, true
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		klog.V(4).Infof("Not aggregating event %s of an object without metadata: %v", reason, err)
+		return message, true
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	r.sweep(now)
+
+	key := aggregationKey{uid: string(accessor.GetUID()), reason: reason}
+	warning, found := r.warnings[key]
+	if found && now.Sub(warning.emitted) < r.window {
+		warning.repeats++
+		return "", false
+	}
+	if found && warning.repeats > 0 {
+		message = fmt.Sprintf("%s (occurred %d more times in the last %s)", message, warning.repeats, now.Sub(warning.emitted).Round(time.Second))
+	}
+	r.warnings[key] = &aggregatedWarning{emitted: now}
+	return message, true
+}
+
+// sweep drops the warnings of objects which had no repeats for a while, the lock must be held
+func (r *aggregatingRecorder) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.window {
+		return
+	}
+	r.lastSweep = now
+	for key, warning := range r.warnings {
+		if now.Sub(warning.emitted) >= 2*r.window {
+			delete(r.warnings, key)
+		}
+	}
+}
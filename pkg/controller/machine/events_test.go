@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestAggregatingRecorder(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	recorder := newAggregatingRecorder(fake, time.Hour).(*aggregatingRecorder)
+	machine1 := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine-1", UID: "1"}}
+	machine2 := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine-2", UID: "2"}}
+
+	for i := 0; i < 3; i++ {
+		recorder.Event(machine1, corev1.EventTypeWarning, "ReconcilingError", "quota exceeded")
+		recorder.Eventf(machine1, corev1.EventTypeNormal, "Created", "Successfully created instance")
+	}
+	recorder.Event(machine1, corev1.EventTypeWarning, "CreateFailed", "quota exceeded")
+	recorder.Event(machine2, corev1.EventTypeWarning, "ReconcilingError", "quota exceeded")
+
+	// 1 aggregated warning, 3 normal events and 2 warnings of other reasons or machines
+	if len(fake.Events) != 6 {
+		t.Fatalf("expected 6 events, got %d", len(fake.Events))
+	}
+
+	// Once the window passed, the next warning reports the repeats
+	recorder.warnings[aggregationKey{uid: "1", reason: "ReconcilingError"}].emitted = time.Now().Add(-2 * time.Hour)
+	recorder.Event(machine1, corev1.EventTypeWarning, "ReconcilingError", "quota exceeded")
+	for len(fake.Events) > 1 {
+		<-fake.Events
+	}
+	if event := <-fake.Events; !strings.Contains(event, "quota exceeded (occurred 2 more times") {
+		t.Errorf("expected the event to report the 2 repeats, got %q", event)
+	}
+}
+
+func TestAggregatingRecorderDisabled(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	if recorder := newAggregatingRecorder(fake, 0); recorder != fake {
+		t.Errorf("expected the recorder to be returned as is with a window of 0, got %T", recorder)
+	}
+}
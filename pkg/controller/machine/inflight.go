@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// InFlightReconciles tracks the running reconciliations of machines, so the shutdown can wait for
+// instances being created or deleted before the leadership gets released, and the liveness probe
+// can tell reconciliations which hang. The zero value is ready to use.
+type InFlightReconciles struct {
+	lock    sync.Mutex
+	stopped bool
+	running sync.WaitGroup
+	// started holds when the running reconciliations started by machine, controller-runtime never
+	// reconciles a machine concurrently
+	started map[types.NamespacedName]time.Time
+}
+
+// start registers a reconciliation of the given machine, it returns false once the shutdown began,
+// then the machine must not be reconciled anymore.
+func (f *InFlightReconciles) start(name types.NamespacedName) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.stopped {
+		return false
+	}
+	if f.started == nil {
+		f.started = map[types.NamespacedName]time.Time{}
+	}
+	f.started[name] = time.Now()
+	f.running.Add(1)
+	return true
+}
+
+// done unregisters a reconciliation registered with start
+func (f *InFlightReconciles) done(name types.NamespacedName) {
+	f.lock.Lock()
+	delete(f.started, name)
+	f.lock.Unlock()
+	f.running.Done()
+}
+
+// CheckHanging returns an error if a reconciliation is running for longer than the given timeout,
+// e.g. because a call to the cloud provider never returns. A timeout of 0 disables the check.
+func (f *InFlightReconciles) CheckHanging(timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for name, started := range f.started {
+		if running := time.Since(started); running > timeout {
+			return fmt.Errorf("the reconciliation of machine %s is running for %s", name.String(), running.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// StopAndWait stops new reconciliations from starting and waits until the running ones finished, at most
+// for the given timeout. It returns whether they finished. The workqueues should be shut down before,
+// as reconciliations which are refused here are lost.
+func (f *InFlightReconciles) StopAndWait(timeout time.Duration) bool {
+	f.lock.Lock()
+	f.stopped = true
+	f.lock.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		f.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var inFlightTestMachine = types.NamespacedName{Namespace: "kube-system", Name: "machine-1"}
+
+func TestInFlightReconciles(t *testing.T) {
+	inFlight := &InFlightReconciles{}
+	if !inFlight.start(inFlightTestMachine) {
+		t.Fatal("Expected a reconciliation to start before the shutdown")
+	}
+
+	stopped := make(chan bool)
+	go func() {
+		stopped <- inFlight.StopAndWait(time.Minute)
+	}()
+
+	// The shutdown began once further reconciliations are refused
+	for inFlight.start(inFlightTestMachine) {
+		inFlight.done(inFlightTestMachine)
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("Expected the shutdown to wait for the running reconciliation")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	inFlight.done(inFlightTestMachine)
+	if finished := <-stopped; !finished {
+		t.Error("Expected the running reconciliation to have finished")
+	}
+
+	timedOut := &InFlightReconciles{}
+	timedOut.start(inFlightTestMachine)
+	defer timedOut.done(inFlightTestMachine)
+	if timedOut.StopAndWait(time.Millisecond) {
+		t.Error("Expected the shutdown to time out while a reconciliation is running")
+	}
+}
+
+func TestInFlightReconcilesCheckHanging(t *testing.T) {
+	inFlight := &InFlightReconciles{}
+	if err := inFlight.CheckHanging(time.Minute); err != nil {
+		t.Errorf("Expected no error without reconciliations, got %v", err)
+	}
+
+	inFlight.start(inFlightTestMachine)
+	inFlight.started[inFlightTestMachine] = time.Now().Add(-2 * time.Minute)
+	if err := inFlight.CheckHanging(time.Minute); err == nil {
+		t.Error("Expected an error for a reconciliation running for longer than the timeout")
+	}
+	if err := inFlight.CheckHanging(0); err != nil {
+		t.Errorf("Expected the check to be disabled with a timeout of 0, got %v", err)
+	}
+
+	inFlight.done(inFlightTestMachine)
+	if err := inFlight.CheckHanging(time.Minute); err != nil {
+		t.Errorf("Expected no error once the reconciliation finished, got %v", err)
+	}
+}
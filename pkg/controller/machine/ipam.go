@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/ipam"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// recentAllocationTTL is how long an allocated address is remembered, it only needs to
+// cover the time until the annotation of the machine reached the cache
+const recentAllocationTTL = time.Minute
+
+// recentAllocations are the addresses allocated recently, keyed by <namespace>/<pool>/<address>.
+// The annotations of their machines may not have reached the cache yet when the next machine
+// of the pool gets an address.
+var recentAllocations = struct {
+	sync.Mutex
+	allocated map[string]time.Time
+}{allocated: map[string]time.Time{}}
+
+// allocateStaticAddress returns a copy of the given machine spec whose network configuration contains
+// the address of the machine from its IP pool. An address is allocated and recorded in the annotations
+// of the machine if it has none yet.
+func (r *Reconciler) allocateStaticAddress(machine *clusterv1alpha1.Machine, spec clusterv1alpha1.MachineSpec) (clusterv1alpha1.MachineSpec, error) {
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get provider config: %v", err)
+	}
+	if providerConfig.Network == nil || providerConfig.Network.IPPool == "" {
+		return spec, nil
+	}
+
+	poolName := providerConfig.Network.IPPool
+	configMap := &corev1.ConfigMap{}
+	if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: machine.Namespace, Name: poolName}, configMap); err != nil {
+		return spec, fmt.Errorf("failed to get ip pool %s: %v", poolName, err)
+	}
+	pool, err := ipam.ParsePool(configMap)
+	if err != nil {
+		return spec, fmt.Errorf("invalid ip pool %s: %v", poolName, err)
+	}
+
+	ip := net.ParseIP(machine.Annotations[ipam.AnnotationAddress])
+	if ip == nil || machine.Annotations[ipam.AnnotationPool] != poolName || !pool.Network.Contains(ip) {
+		ip, err = r.allocateFromPool(machine, pool)
+		if err != nil {
+			return spec, err
+		}
+	}
+	providerConfig.Network = pool.NetworkConfig(ip, *providerConfig.Network)
+
+	rawConfig, err := json.Marshal(providerConfig)
+	if err != nil {
+		return spec, fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+	updatedSpec := spec.DeepCopy()
+	updatedSpec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return *updatedSpec, nil
+}
+
+// allocateFromPool allocates an address which no other machine of the namespace uses and records
+// it in the annotations of the given machine
+func (r *Reconciler) allocateFromPool(machine *clusterv1alpha1.Machine, pool *ipam.Pool) (net.IP, error) {
+	recentAllocations.Lock()
+	defer recentAllocations.Unlock()
+
+	machines := &clusterv1alpha1.MachineList{}
+	if err := r.client.List(r.ctx, machines, ctrlruntimeclient.InNamespace(machine.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list machines: %v", err)
+	}
+	used := sets.NewString()
+	for _, m := range machines.Items {
+		if m.UID != machine.UID && m.Annotations[ipam.AnnotationPool] == pool.Name {
+			used.Insert(m.Annotations[ipam.AnnotationAddress])
+		}
+	}
+
+	prefix := fmt.Sprintf("%s/%s/", machine.Namespace, pool.Name)
+	now := time.Now()
+	for key, allocated := range recentAllocations.allocated {
+		if now.Sub(allocated) > recentAllocationTTL {
+			delete(recentAllocations.allocated, key)
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			used.Insert(strings.TrimPrefix(key, prefix))
+		}
+	}
+
+	ip, err := pool.Allocate(used)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+		if m.Annotations == nil {
+			m.Annotations = map[string]string{}
+		}
+		m.Annotations[ipam.AnnotationAddress] = ip.String()
+		m.Annotations[ipam.AnnotationPool] = pool.Name
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record the allocated address: %v", err)
+	}
+	recentAllocations.allocated[prefix+ip.String()] = now
+	klog.V(2).Infof("Allocated address %s of ip pool %s to machine %s", ip, pool.Name, machine.Name)
+	return ip, nil
+}
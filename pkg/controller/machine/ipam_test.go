@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	"github.com/kubermatic/machine-controller/pkg/ipam"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAllocateStaticAddress(t *testing.T) {
+	pool := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "vlan-10"},
+		Data: map[string]string{
+			"cidr":    "10.0.10.0/24",
+			"range":   "10.0.10.10-10.0.10.20",
+			"gateway": "10.0.10.1",
+			"dns":     "10.0.0.53",
+		},
+	}
+	providerSpec := `{"network":{"ipPool":"vlan-10"}}`
+	newMachine := func(name, address string) *clusterv1alpha1.Machine {
+		machine := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "team-a",
+			Name:      name,
+			UID:       types.UID(name),
+		}}
+		machine.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(providerSpec)}
+		if address != "" {
+			machine.Annotations = map[string]string{ipam.AnnotationAddress: address, ipam.AnnotationPool: "vlan-10"}
+		}
+		return machine
+	}
+
+	tests := []struct {
+		name            string
+		machine         *clusterv1alpha1.Machine
+		others          []runtime.Object
+		expectedAddress string
+	}{
+		{
+			name:            "first address of the range",
+			machine:         newMachine("a", ""),
+			expectedAddress: "10.0.10.10",
+		},
+		{
+			name:            "addresses of other machines are skipped",
+			machine:         newMachine("b", ""),
+			others:          []runtime.Object{newMachine("c", "10.0.10.10"), newMachine("d", "10.0.10.11")},
+			expectedAddress: "10.0.10.12",
+		},
+		{
+			name:            "allocated address is kept",
+			machine:         newMachine("e", "10.0.10.15"),
+			others:          []runtime.Object{newMachine("f", "10.0.10.10")},
+			expectedAddress: "10.0.10.15",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recentAllocations.Lock()
+			recentAllocations.allocated = map[string]time.Time{}
+			recentAllocations.Unlock()
+
+			ctx := context.Background()
+			client := ctrlruntimefake.NewFakeClient(append(test.others, pool, test.machine)...)
+			reconciler := Reconciler{
+				ctx:          ctx,
+				client:       client,
+				providerData: &cloudprovidertypes.ProviderData{Ctx: ctx, Update: cloudprovidertypes.GetMachineUpdater(ctx, client), Client: client},
+			}
+
+			spec, err := reconciler.allocateStaticAddress(test.machine, test.machine.Spec)
+			if err != nil {
+				t.Fatalf("failed to allocate a static address: %v", err)
+			}
+			providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+			if err != nil {
+				t.Fatalf("failed to get provider config: %v", err)
+			}
+			network := providerConfig.Network
+			if network.CIDR != test.expectedAddress+"/24" || network.Gateway != "10.0.10.1" || len(network.DNS.Servers) != 1 {
+				t.Errorf("expected address %s/24 with the gateway and the DNS server of the pool, got %+v", test.expectedAddress, network)
+			}
+
+			machine := &clusterv1alpha1.Machine{}
+			if err := client.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: test.machine.Name}, machine); err != nil {
+				t.Fatalf("failed to get machine: %v", err)
+			}
+			if address := machine.Annotations[ipam.AnnotationAddress]; address != test.expectedAddress {
+				t.Errorf("expected the address %s to be recorded, got %q", test.expectedAddress, address)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// AnnotationK0sJoinAddresses holds the controller addresses the instance of a k0s worker was created to
+	// join with, if they were taken from the controller endpoints
+	AnnotationK0sJoinAddresses = "machine-controller.kubermatic.io/k0s-join-addresses"
+
+	controllerEndpointsPollInterval = 30 * time.Second
+)
+
+// controllerEndpoints tracks the addresses of the kube-apiservers of the k0s controllers, which the kubernetes
+// Endpoints of the default namespace list. Only this object is read, watching all Endpoints of the cluster
+// would cache them.
+type controllerEndpoints struct {
+	kubeClient kubernetes.Interface
+
+	lock      sync.RWMutex
+	addresses []string
+}
+
+func newControllerEndpoints(kubeClient kubernetes.Interface) *controllerEndpoints {
+	return &controllerEndpoints{kubeClient: kubeClient}
+}
+
+// get returns the current addresses as https URLs, sorted
+func (e *controllerEndpoints) get() []string {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.addresses
+}
+
+// refresh reads the addresses and returns whether they changed
+func (e *controllerEndpoints) refresh() (bool, error) {
+	endpoints, err := e.kubeClient.CoreV1().Endpoints(metav1.NamespaceDefault).Get("kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get the kubernetes endpoints: %v", err)
+	}
+	addresses := endpointsAddresses(endpoints)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if reflect.DeepEqual(addresses, e.addresses) {
+		return false, nil
+	}
+	klog.Infof("The addresses of the k0s controllers changed from %v to %v", e.addresses, addresses)
+	e.addresses = addresses
+	return true, nil
+}
+
+// run refreshes the addresses until the context is done and calls onChange when they changed
+func (e *controllerEndpoints) run(ctx context.Context, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := e.refresh()
+		if err != nil {
+			klog.Errorf("Failed to refresh the addresses of the k0s controllers: %v", err)
+			continue
+		}
+		if changed {
+			onChange()
+		}
+	}
+}
+
+// endpointsAddresses returns the https URLs of the ready addresses of the given kubernetes Endpoints, sorted
+func endpointsAddresses(endpoints *corev1.Endpoints) []string {
+	var addresses []string
+	for _, subset := range endpoints.Subsets {
+		port := int32(0)
+		for _, p := range subset.Ports {
+			if p.Name == "https" || port == 0 {
+				port = p.Port
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, address := range subset.Addresses {
+			addresses = append(addresses, "https://"+net.JoinHostPort(address.IP, strconv.Itoa(int(port))))
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// joinAddressesGone returns whether none of the given comma separated addresses a worker was created to join
+// with is a current address of the controllers
+func joinAddressesGone(recorded string, current []string) bool {
+	if recorded == "" || len(current) == 0 {
+		return false
+	}
+	for _, address := range strings.Split(recorded, ",") {
+		for _, currentAddress := range current {
+			if address == currentAddress {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// discoveredJoinAddresses returns the addresses of the controllers for k0s workers without join addresses,
+// if the controller endpoints are tracked
+func (r *Reconciler) discoveredJoinAddresses(providerConfig *providerconfigtypes.Config) []string {
+	if r.controllerEndpoints == nil || len(providerConfig.JoinAddresses) > 0 ||
+		bootstrapFlavor(providerConfig) != providerconfigtypes.BootstrapFlavorK0s ||
+		nodeRole(providerConfig) != providerconfigtypes.NodeRoleWorker {
+		return nil
+	}
+	return r.controllerEndpoints.get()
+}
+
+// pendingMachineEvents sends an event for each machine whose node didn't join yet, so they get checked for
+// join addresses which are gone
+func (r *Reconciler) pendingMachineEvents(events chan<- event.GenericEvent) {
+	machines, err := r.indexedMachines()
+	if err != nil {
+		klog.Errorf("Failed to list machines: %v", err)
+		return
+	}
+	for _, machine := range machines.machinesWithoutNodeRef() {
+		m := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: machine.name.Namespace, Name: machine.name.Name}}
+		events <- event.GenericEvent{Meta: m, Object: m}
+	}
+}
+
+// refreshJoinAddresses recreates the instance of a k0s worker which didn't join yet, if none of the controllers it
+// was created to join with is left. It would never join otherwise.
+func (r *Reconciler) refreshJoinAddresses(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
+	if r.controllerEndpoints == nil || machine.Status.NodeRef != nil {
+		return nil, nil
+	}
+	recorded := machine.Annotations[AnnotationK0sJoinAddresses]
+	if !joinAddressesGone(recorded, r.controllerEndpoints.get()) {
+		return nil, nil
+	}
+
+	r.recorder.Eventf(machine, corev1.EventTypeWarning, "JoinAddressesGone", "None of the controllers %s the instance was created to join with is left, recreating the instance", recorded)
+	completelyGone, err := prov.Cleanup(machine, r.providerData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete instance of machine %s whose join addresses are gone: %v", machine.Name, err)
+	}
+	if !completelyGone {
+		return &reconcile.Result{RequeueAfter: deletionRetryWaitPeriod}, nil
+	}
+	// The next reconciliation doesn't find the instance anymore and creates a new one with the current addresses
+	return &reconcile.Result{Requeue: true}, nil
+}
+
+// withJoinAddresses returns the given spec with the given join addresses in its provider spec
+func withJoinAddresses(spec clusterv1alpha1.MachineSpec, addresses []string) (clusterv1alpha1.MachineSpec, error) {
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get provider config: %v", err)
+	}
+	providerConfig.JoinAddresses = addresses
+	rawConfig, err := json.Marshal(providerConfig)
+	if err != nil {
+		return spec, fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+	spec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return spec, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestEndpointsAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints *corev1.Endpoints
+		expected  []string
+	}{
+		{
+			name:      "no subsets",
+			endpoints: &corev1.Endpoints{},
+		},
+		{
+			name: "sorted addresses",
+			endpoints: &corev1.Endpoints{Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.11"}, {IP: "10.0.0.10"}},
+				Ports:     []corev1.EndpointPort{{Name: "https", Port: 6443}},
+			}}},
+			expected: []string{"https://10.0.0.10:6443", "https://10.0.0.11:6443"},
+		},
+		{
+			name: "https port preferred",
+			endpoints: &corev1.Endpoints{Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.10"}},
+				Ports:     []corev1.EndpointPort{{Name: "konnectivity", Port: 8132}, {Name: "https", Port: 6443}},
+			}}},
+			expected: []string{"https://10.0.0.10:6443"},
+		},
+		{
+			name: "ipv6",
+			endpoints: &corev1.Endpoints{Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "fd00::10"}},
+				Ports:     []corev1.EndpointPort{{Name: "https", Port: 6443}},
+			}}},
+			expected: []string{"https://[fd00::10]:6443"},
+		},
+		{
+			name: "subset without ports",
+			endpoints: &corev1.Endpoints{Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.10"}},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addresses := endpointsAddresses(test.endpoints)
+			if !reflect.DeepEqual(addresses, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, addresses)
+			}
+		})
+	}
+}
+
+func TestJoinAddressesGone(t *testing.T) {
+	tests := []struct {
+		name     string
+		recorded string
+		current  []string
+		expected bool
+	}{
+		{
+			name:    "nothing recorded",
+			current: []string{"https://10.0.0.10:6443"},
+		},
+		{
+			name:     "no current controllers",
+			recorded: "https://10.0.0.10:6443",
+		},
+		{
+			name:     "one controller left",
+			recorded: "https://10.0.0.10:6443,https://10.0.0.11:6443",
+			current:  []string{"https://10.0.0.11:6443", "https://10.0.0.12:6443"},
+		},
+		{
+			name:     "all controllers gone",
+			recorded: "https://10.0.0.10:6443,https://10.0.0.11:6443",
+			current:  []string{"https://10.0.0.12:6443"},
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if gone := joinAddressesGone(test.recorded, test.current); gone != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, gone)
+			}
+		})
+	}
+}
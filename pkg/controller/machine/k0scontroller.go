@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// k0sAPIPort is the port of the k0s API, which joining controllers fetch the
+	// certificates and the etcd membership of the cluster from.
+	k0sAPIPort = "9443"
+
+	// etcdMemberRecheckInterval is the interval etcd members which are leaving the
+	// cluster get checked with.
+	etcdMemberRecheckInterval = 10 * time.Second
+)
+
+// etcdMemberGVK is the kind k0s reflects the members of its etcd cluster with, each named
+// like the controller it runs on. Setting spec.leave makes k0s remove the member.
+var etcdMemberGVK = schema.GroupVersionKind{Group: "etcd.k0sproject.io", Version: "v1beta1", Kind: "EtcdMember"}
+
+// nodeRole returns the k0s role of the node of the given config.
+func nodeRole(providerConfig *providerconfigtypes.Config) providerconfigtypes.NodeRole {
+	if providerConfig.Role != "" {
+		return providerConfig.Role
+	}
+	return providerconfigtypes.NodeRoleWorker
+}
+
+// createControllerJoinKubeconfig returns the kubeconfig a k0s controller joins with, which is what
+// `k0s token create --role=controller` encodes: it points to the k0s API of the existing controllers,
+// which only accept bootstrap tokens with the controller join usage.
+func (r *Reconciler) createControllerJoinKubeconfig(name string) (*clientcmdapi.Config, error) {
+	token, err := r.createBootstrapToken(name, providerconfigtypes.NodeRoleController)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create controller join token: %v", err)
+	}
+	infoKubeconfig, err := r.kubeconfigProvider.GetKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+
+	kubeconfig := kubeconfigWithToken(infoKubeconfig, token)
+	for _, cluster := range kubeconfig.Clusters {
+		server, err := k0sAPIServer(cluster.Server)
+		if err != nil {
+			return nil, err
+		}
+		cluster.Server = server
+	}
+	return kubeconfig, nil
+}
+
+// k0sAPIServer returns the URL of the k0s API on the host of the given kube-apiserver URL.
+func k0sAPIServer(apiServer string) (string, error) {
+	serverURL, err := url.Parse(apiServer)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the kube-apiserver URL %q: %v", apiServer, err)
+	}
+	serverURL.Host = net.JoinHostPort(serverURL.Hostname(), k0sAPIPort)
+	return serverURL.String(), nil
+}
+
+// removeEtcdMember makes the etcd member of the controller of the given machine leave the cluster
+// before its instance gets deleted, so the remaining members keep their quorum. Members only leave
+// one at a time and only while all other members joined, the last member never leaves. The machine
+// gets requeued until the member left.
+func (r *Reconciler) removeEtcdMember(machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
+	// The controller never registered a node, so it never got to join etcd either
+	if machine.Status.NodeRef == nil {
+		return nil, nil
+	}
+	name := machine.Status.NodeRef.Name
+
+	members := &unstructured.UnstructuredList{}
+	members.SetGroupVersionKind(etcdMemberGVK.GroupVersion().WithKind(etcdMemberGVK.Kind + "List"))
+	if err := r.targetClient.List(r.ctx, members); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, fmt.Errorf("the cluster has no EtcdMember resources to remove the etcd member of controller %s with, k0s %s or newer is required", name, userdatahelper.K0sControllerMinVersion)
+		}
+		return nil, fmt.Errorf("failed to list etcd members: %v", err)
+	}
+
+	var member *unstructured.Unstructured
+	for i := range members.Items {
+		if members.Items[i].GetName() == name {
+			member = &members.Items[i]
+		}
+	}
+	// Members which are not part of the etcd cluster, including those which left, have no quorum to keep
+	if member == nil || !etcdMemberJoined(member) {
+		return nil, nil
+	}
+
+	joinedMembers := 0
+	for i := range members.Items {
+		other := &members.Items[i]
+		if etcdMemberJoined(other) {
+			joinedMembers++
+		}
+		if other == member {
+			continue
+		}
+		joining := !etcdMemberJoined(other) && !etcdMemberLeaving(other)
+		leaving := etcdMemberJoined(other) && etcdMemberLeaving(other)
+		if joining || leaving {
+			r.recorder.Eventf(machine, corev1.EventTypeWarning, "EtcdMemberRemovalBlocked",
+				"Waiting for etcd member %s to finish joining or leaving before removing etcd member %s", other.GetName(), name)
+			return &reconcile.Result{RequeueAfter: etcdMemberRecheckInterval}, nil
+		}
+	}
+	if joinedMembers == 1 {
+		r.recorder.Eventf(machine, corev1.EventTypeWarning, "EtcdMemberRemovalBlocked",
+			"Not removing etcd member %s, it is the last one and holds the only copy of the cluster state. Set the %q annotation to delete the machine anyway", name, AnnotationForceDelete)
+		return &reconcile.Result{RequeueAfter: etcdMemberRecheckInterval}, nil
+	}
+
+	if !etcdMemberLeaving(member) {
+		if err := unstructured.SetNestedField(member.Object, true, "spec", "leave"); err != nil {
+			return nil, fmt.Errorf("failed to set leave on etcd member %s: %v", name, err)
+		}
+		if err := r.targetClient.Update(r.ctx, member); err != nil {
+			if kerrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to update etcd member %s: %v", name, err)
+		}
+		klog.V(3).Infof("Removing etcd member %s of machine %s", name, machine.Name)
+		r.recorder.Eventf(machine, corev1.EventTypeNormal, "EtcdMemberLeaving", "Removing etcd member %s", name)
+	}
+	return &reconcile.Result{RequeueAfter: etcdMemberRecheckInterval}, nil
+}
+
+// etcdMemberJoined returns whether the given etcd member is part of the etcd cluster.
+func etcdMemberJoined(member *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(member.Object, "status", "conditions")
+	for _, condition := range conditions {
+		condition, ok := condition.(map[string]interface{})
+		if ok && condition["type"] == "Joined" {
+			return condition["status"] == string(corev1.ConditionTrue)
+		}
+	}
+	return false
+}
+
+// etcdMemberLeaving returns whether the given etcd member was asked to leave the etcd cluster.
+func etcdMemberLeaving(member *unstructured.Unstructured) bool {
+	leave, _, _ := unstructured.NestedBool(member.Object, "spec", "leave")
+	return leave
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestK0sAPIServer(t *testing.T) {
+	tests := []struct {
+		apiServer string
+		expected  string
+	}{
+		{
+			apiServer: "https://10.0.0.1:6443",
+			expected:  "https://10.0.0.1:9443",
+		},
+		{
+			apiServer: "https://k0s.example.com",
+			expected:  "https://k0s.example.com:9443",
+		},
+		{
+			apiServer: "https://[fd00::1]:6443",
+			expected:  "https://[fd00::1]:9443",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.apiServer, func(t *testing.T) {
+			server, err := k0sAPIServer(test.apiServer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if server != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, server)
+			}
+		})
+	}
+}
+
+func TestEtcdMemberState(t *testing.T) {
+	tests := []struct {
+		name    string
+		member  map[string]interface{}
+		joined  bool
+		leaving bool
+	}{
+		{
+			name:   "joining",
+			member: map[string]interface{}{},
+		},
+		{
+			name: "joined",
+			member: map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Joined", "status": "True"},
+					},
+				},
+			},
+			joined: true,
+		},
+		{
+			name: "leaving",
+			member: map[string]interface{}{
+				"spec": map[string]interface{}{"leave": true},
+				"status": map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Joined", "status": "True"},
+					},
+				},
+			},
+			joined:  true,
+			leaving: true,
+		},
+		{
+			name: "left",
+			member: map[string]interface{}{
+				"spec": map[string]interface{}{"leave": true},
+				"status": map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Joined", "status": "False"},
+					},
+				},
+			},
+			leaving: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			member := &unstructured.Unstructured{Object: test.member}
+			if joined := etcdMemberJoined(member); joined != test.joined {
+				t.Errorf("expected joined to be %t, got %t", test.joined, joined)
+			}
+			if leaving := etcdMemberLeaving(member); leaving != test.leaving {
+				t.Errorf("expected leaving to be %t, got %t", test.leaving, leaving)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// k0sTokenConfigTpl is the k0s config `k0s token create` takes the address of the kube-apiserver the
+// tokens point to from, the k0s API of the controllers listens on the same host.
+const k0sTokenConfigTpl = `apiVersion: k0s.k0sproject.io/v1beta1
+kind: Cluster
+metadata:
+  name: k0s
+spec:
+  api:
+    externalAddress: %s
+    port: %s
+`
+
+// K0sTokenCreator creates the join tokens of k0s nodes with `k0s token create` over an admin kubeconfig of the
+// cluster, the way they are created on the k0s controllers. As the k0s binary creates them, their format always
+// matches its release.
+type K0sTokenCreator struct {
+	// Binary is the path of the k0s binary.
+	Binary string
+	// AdminKubeconfig is the path of an admin kubeconfig of the k0s cluster, e.g. a copy of the
+	// /var/lib/k0s/pki/admin.conf of a controller.
+	AdminKubeconfig string
+
+	// run runs the given command and returns its output
+	run func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// NewK0sTokenCreator returns a K0sTokenCreator running the given k0s binary, which is looked up in the PATH
+// unless it is a path, with the given admin kubeconfig.
+func NewK0sTokenCreator(binary, adminKubeconfig string) (*K0sTokenCreator, error) {
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the k0s binary %q: %v", binary, err)
+	}
+	if _, err := clientcmd.LoadFromFile(adminKubeconfig); err != nil {
+		return nil, fmt.Errorf("failed to load the admin kubeconfig %q: %v", adminKubeconfig, err)
+	}
+	return &K0sTokenCreator{Binary: path, AdminKubeconfig: adminKubeconfig, run: runCommand}, nil
+}
+
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Create returns a new join token of the given role which expires after the given duration. k0s stores it as
+// bootstrap token in the cluster, so it shows up in `k0s token list` on the controllers.
+func (c *K0sTokenCreator) Create(ctx context.Context, role providerconfigtypes.NodeRole, expiry time.Duration) (string, error) {
+	dataDir, err := ioutil.TempDir("", "k0s-token")
+	if err != nil {
+		return "", fmt.Errorf("failed to create the k0s data directory: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	configPath, err := c.writeDataDir(dataDir)
+	if err != nil {
+		return "", err
+	}
+	out, err := c.run(ctx, c.Binary, "token", "create",
+		"--role="+string(role),
+		"--expiry="+expiry.String(),
+		"--data-dir="+dataDir,
+		"--config="+configPath)
+	if err != nil {
+		return "", fmt.Errorf("k0s token create failed: %v", err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", errors.New("k0s token create returned no token")
+	}
+	return token, nil
+}
+
+// writeDataDir lays out the files `k0s token create` reads in the given data directory: the admin kubeconfig
+// and the CA certificate of the cluster in its pki directory, and the k0s config with the address of the
+// kube-apiserver, whose path is returned.
+func (c *K0sTokenCreator) writeDataDir(dataDir string) (string, error) {
+	kubeconfig, err := clientcmd.LoadFromFile(c.AdminKubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to load the admin kubeconfig: %v", err)
+	}
+	// The files referenced by the kubeconfig are relative to its own location
+	if err := clientcmdapi.FlattenConfig(kubeconfig); err != nil {
+		return "", fmt.Errorf("failed to inline the files of the admin kubeconfig: %v", err)
+	}
+	kubeContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return "", errors.New("the admin kubeconfig has no current context")
+	}
+	cluster, ok := kubeconfig.Clusters[kubeContext.Cluster]
+	if !ok || len(cluster.CertificateAuthorityData) == 0 {
+		return "", fmt.Errorf("the cluster %q of the admin kubeconfig has no CA certificate", kubeContext.Cluster)
+	}
+	server, err := url.Parse(cluster.Server)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the server %q of the admin kubeconfig: %v", cluster.Server, err)
+	}
+	port := server.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	pkiDir := filepath.Join(dataDir, "pki")
+	if err := os.MkdirAll(pkiDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create the pki directory: %v", err)
+	}
+	if err := clientcmd.WriteToFile(*kubeconfig, filepath.Join(pkiDir, "admin.conf")); err != nil {
+		return "", fmt.Errorf("failed to write the admin kubeconfig: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkiDir, "ca.crt"), cluster.CertificateAuthorityData, 0600); err != nil {
+		return "", fmt.Errorf("failed to write the CA certificate: %v", err)
+	}
+	configPath := filepath.Join(dataDir, "k0s.yaml")
+	if err := ioutil.WriteFile(configPath, []byte(fmt.Sprintf(k0sTokenConfigTpl, server.Hostname(), port)), 0600); err != nil {
+		return "", fmt.Errorf("failed to write the k0s config: %v", err)
+	}
+	return configPath, nil
+}
+
+// mintK0sJoinToken creates the join token of the k0s node of the machine with the given name with k0s and
+// returns it along with the kubeconfig it wraps. Each instance gets a new token which expires after the
+// bootstrapTokenTTL, the token of the previous instance gets revoked as it may have leaked via its userdata.
+func (r *Reconciler) mintK0sJoinToken(name string, role providerconfigtypes.NodeRole) (string, *clientcmdapi.Config, error) {
+	if err := r.deleteBootstrapToken(name); err != nil {
+		return "", nil, fmt.Errorf("failed to revoke the previous join token of machine %s: %v", name, err)
+	}
+	token, err := r.k0sTokens.Create(r.ctx, role, r.bootstrapTokenTTL)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create the k0s join token of machine %s: %v", name, err)
+	}
+	kubeconfig, err := decodeK0sJoinToken(token)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode the k0s join token of machine %s: %v", name, err)
+	}
+	if err := r.labelK0sJoinToken(name, kubeconfig); err != nil {
+		return "", nil, err
+	}
+	return token, kubeconfig, nil
+}
+
+// labelK0sJoinToken labels the bootstrap token secret k0s stored the join token of the machine with the given
+// name as, so it gets revoked like the bootstrap tokens of other machines once the node joined or the machine
+// gets deleted. The secret is read without the cache, as k0s just created it.
+func (r *Reconciler) labelK0sJoinToken(name string, kubeconfig *clientcmdapi.Config) error {
+	tokenID, err := k0sJoinTokenID(kubeconfig)
+	if err != nil {
+		return err
+	}
+	secrets := r.kubeClient.CoreV1().Secrets(metav1.NamespaceSystem)
+	secret, err := secrets.Get(bootstrapTokenSecretPrefix+tokenID, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the bootstrap token secret of the k0s join token of machine %s: %v", name, err)
+	}
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[machineNameLabelKey] = name
+	if _, err := secrets.Update(secret); err != nil {
+		return fmt.Errorf("failed to label the bootstrap token secret of the k0s join token of machine %s: %v", name, err)
+	}
+	return nil
+}
+
+// k0sJoinTokenID returns the ID of the bootstrap token the given join kubeconfig authenticates with.
+func k0sJoinTokenID(kubeconfig *clientcmdapi.Config) (string, error) {
+	for _, authInfo := range kubeconfig.AuthInfos {
+		if parts := strings.SplitN(authInfo.Token, ".", 2); len(parts) == 2 && parts[0] != "" {
+			return parts[0], nil
+		}
+	}
+	return "", errors.New("the k0s join token has no bootstrap token")
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestK0sTokenCreator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-token-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The CA is referenced relative to the kubeconfig
+	if err := ioutil.WriteFile(filepath.Join(dir, "ca.crt"), []byte("my-ca"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	adminKubeconfig := filepath.Join(dir, "admin.conf")
+	if err := clientcmd.WriteToFile(clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"k0s": {Server: "https://k0s.example.com:6443", CertificateAuthority: "ca.crt"}},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"admin": {Token: "admin-token"}},
+		Contexts:       map[string]*clientcmdapi.Context{"k0s": {Cluster: "k0s", AuthInfo: "admin"}},
+		CurrentContext: "k0s",
+	}, adminKubeconfig); err != nil {
+		t.Fatal(err)
+	}
+
+	joinKubeconfig := &clientcmdapi.Config{
+		Clusters:  map[string]*clientcmdapi.Cluster{"k0s": {Server: "https://k0s.example.com:6443"}},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{"kubelet-bootstrap": {Token: "abcdef.0123456789abcdef"}},
+	}
+	joinToken, err := createK0sJoinToken(joinKubeconfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var args []string
+	creator := &K0sTokenCreator{
+		Binary:          "k0s",
+		AdminKubeconfig: adminKubeconfig,
+		run: func(_ context.Context, _ string, arguments ...string) ([]byte, error) {
+			args = arguments
+			var dataDir string
+			for _, arg := range arguments {
+				if strings.HasPrefix(arg, "--data-dir=") {
+					dataDir = strings.TrimPrefix(arg, "--data-dir=")
+				}
+			}
+			ca, err := ioutil.ReadFile(filepath.Join(dataDir, "pki", "ca.crt"))
+			if err != nil || string(ca) != "my-ca" {
+				t.Errorf("expected the CA of the admin kubeconfig in the data directory, got %q (err: %v)", ca, err)
+			}
+			if _, err := clientcmd.LoadFromFile(filepath.Join(dataDir, "pki", "admin.conf")); err != nil {
+				t.Errorf("expected the admin kubeconfig in the data directory: %v", err)
+			}
+			config, err := ioutil.ReadFile(filepath.Join(dataDir, "k0s.yaml"))
+			if err != nil || !strings.Contains(string(config), "externalAddress: k0s.example.com\n    port: 6443\n") {
+				t.Errorf("expected the address of the kube-apiserver in the k0s config, got %q (err: %v)", config, err)
+			}
+			return []byte(joinToken + "\n"), nil
+		},
+	}
+	// The token of the previous instance of the machine and the one k0s stores the new token as
+	previousToken := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      "bootstrap-token-123456",
+		Namespace: metav1.NamespaceSystem,
+		Labels:    map[string]string{machineNameLabelKey: "my-machine"},
+	}}
+	newToken := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-abcdef", Namespace: metav1.NamespaceSystem}}
+	kubeClient := fake.NewSimpleClientset(newToken)
+	r := &Reconciler{
+		ctx:               context.Background(),
+		targetClient:      ctrlruntimefake.NewFakeClient(previousToken),
+		kubeClient:        kubeClient,
+		k0sTokens:         creator,
+		bootstrapTokenTTL: time.Hour,
+	}
+
+	token, kubeconfig, err := r.mintK0sJoinToken("my-machine", providerconfigtypes.NodeRoleWorker)
+	if err != nil {
+		t.Fatalf("failed to mint the join token: %v", err)
+	}
+	if token != joinToken {
+		t.Errorf("expected the token returned by k0s, got %q", token)
+	}
+	if kubeconfig.AuthInfos["kubelet-bootstrap"].Token != "abcdef.0123456789abcdef" {
+		t.Errorf("expected the kubeconfig of the token, got %v", kubeconfig.AuthInfos)
+	}
+	if got := strings.Join(args[:4], " "); got != "token create --role=worker --expiry=1h0m0s" {
+		t.Errorf("expected k0s token create of a worker token with the bootstrap token TTL, got %q", got)
+	}
+	if err := r.targetClient.Get(r.ctx, types.NamespacedName{Namespace: metav1.NamespaceSystem, Name: previousToken.Name}, &corev1.Secret{}); !kerrors.IsNotFound(err) {
+		t.Errorf("expected the token of the previous instance to be revoked, got %v", err)
+	}
+	secret, err := kubeClient.CoreV1().Secrets(metav1.NamespaceSystem).Get(newToken.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Labels[machineNameLabelKey] != "my-machine" {
+		t.Errorf("expected the token created by k0s to be labeled with the machine, got %v", secret.Labels)
+	}
+}
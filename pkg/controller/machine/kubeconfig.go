@@ -17,12 +17,21 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"time"
 
+	"github.com/kubermatic/machine-controller/pkg/controller/bootstraptoken"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/userdata/convert"
+
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
@@ -31,17 +40,25 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
-	secretTypeBootstrapToken corev1.SecretType = "bootstrap.kubernetes.io/token"
-	machineNameLabelKey      string            = "machine.k8s.io/machine.name"
+	secretTypeBootstrapToken corev1.SecretType = bootstraptoken.SecretTypeBootstrapToken
+	machineNameLabelKey      string            = bootstraptoken.MachineNameLabelKey
 	tokenIDKey               string            = "token-id"
 	tokenSecretKey           string            = "token-secret"
-	expirationKey            string            = "expiration"
+	expirationKey            string            = bootstraptoken.ExpirationKey
 	tokenFormatter           string            = "%s.%s"
+	// bootstrapTokenSecretPrefix is the prefix of the names of bootstrap token secrets, followed by the token ID
+	bootstrapTokenSecretPrefix string = "bootstrap-token-"
+	// The usage the k0s API checks the tokens of joining controllers for
+	controllerJoinUsageKey string = "usage-controller-join"
+	// Short lived, as the token can be read from the userdata via the metadata API of the instance
+	defaultBootstrapTokenTTL time.Duration = 1 * time.Hour
 	// Keep this short, userdata is limited
 	contextIdentifier string = "k0s"
 )
@@ -56,7 +73,7 @@ func (r *Reconciler) createBootstrapKubeconfig(name string) (*clientcmdapi.Confi
 			return nil, fmt.Errorf("failed to get token from ServiceAccount %s/%s: %v", r.bootstrapTokenServiceAccountName.Namespace, r.bootstrapTokenServiceAccountName.Name, err)
 		}
 	} else {
-		token, err = r.createBootstrapToken(name)
+		token, err = r.createBootstrapToken(name, providerconfigtypes.NodeRoleWorker)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create bootstrap token: %v", err)
 		}
@@ -66,7 +83,12 @@ func (r *Reconciler) createBootstrapKubeconfig(name string) (*clientcmdapi.Confi
 	if err != nil {
 		return nil, err
 	}
+	return kubeconfigWithToken(infoKubeconfig, token), nil
+}
 
+// kubeconfigWithToken returns a copy of the given cluster-info kubeconfig which
+// authenticates with the given token.
+func kubeconfigWithToken(infoKubeconfig *clientcmdapi.Config, token string) *clientcmdapi.Config {
 	outConfig := infoKubeconfig.DeepCopy()
 
 	// Some consumers expect a valid `Contexts` map and the serialization
@@ -92,7 +114,58 @@ func (r *Reconciler) createBootstrapKubeconfig(name string) (*clientcmdapi.Confi
 	outConfig.Contexts = map[string]*clientcmdapi.Context{contextIdentifier: {Cluster: contextIdentifier, AuthInfo: contextIdentifier}}
 	outConfig.CurrentContext = contextIdentifier
 
-	return outConfig, nil
+	return outConfig
+}
+
+// kubeconfigWithServer returns a copy of the given bootstrap kubeconfig which
+// connects to the given server.
+func kubeconfigWithServer(kubeconfig *clientcmdapi.Config, server string) *clientcmdapi.Config {
+	outConfig := kubeconfig.DeepCopy()
+	for _, cluster := range outConfig.Clusters {
+		cluster.Server = server
+	}
+	return outConfig
+}
+
+// k0sJoinTokenVersion is the k0s release whose join token format createK0sJoinToken
+// implements, the one of JoinEncode in its pkg/token. k0s is not vendored to create the
+// tokens, as it pulls in its whole module. The tokens are only encoded here if no
+// K0sTokenCreator is configured, or to point the tokens it created to a join address.
+// It must match userdatahelper.DefaultK0sVersion, check the format of the new release
+// before bumping either.
+const k0sJoinTokenVersion = "v1.21.2+k0s.1"
+
+// createK0sJoinToken encodes the given bootstrap kubeconfig as k0s worker join
+// token, which is what `k0s token create --role=worker` of k0sJoinTokenVersion
+// returns: the gzipped kubeconfig, base64 encoded.
+func createK0sJoinToken(kubeconfig *clientcmdapi.Config) (string, error) {
+	kubeconfigBytes, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to write kubeconfig: %v", err)
+	}
+	compressed, err := convert.GzipString(string(kubeconfigBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to compress kubeconfig: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString([]byte(compressed)), nil
+}
+
+// decodeK0sJoinToken returns the kubeconfig the given k0s join token wraps, the way
+// JoinDecode of k0s does.
+func decodeK0sJoinToken(token string) (*clientcmdapi.Config, error) {
+	compressed, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode token: %v", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress token: %v", err)
+	}
+	kubeconfigBytes, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress token: %v", err)
+	}
+	return clientcmd.Load(kubeconfigBytes)
 }
 
 func (r *Reconciler) getTokenFromServiceAccount(name types.NamespacedName) (string, error) {
@@ -117,13 +190,24 @@ func (r *Reconciler) getTokenFromServiceAccount(name types.NamespacedName) (stri
 	return "", errors.New("no serviceAccountSecret found")
 }
 
-func (r *Reconciler) createBootstrapToken(name string) (string, error) {
+// createBootstrapToken returns the bootstrap token of the machine with the given name,
+// creating it if needed. Worker tokens authenticate against the kube-apiserver, controller
+// tokens only against the k0s API of the existing controllers.
+func (r *Reconciler) createBootstrapToken(name string, role providerconfigtypes.NodeRole) (string, error) {
 	existingSecret, err := r.getSecretIfExists(name)
 	if err != nil {
 		return "", err
 	}
 	if existingSecret != nil {
-		return r.updateSecretExpirationAndGetToken(existingSecret)
+		isControllerToken := string(existingSecret.Data[controllerJoinUsageKey]) == "true"
+		if token, valid := bootstrapTokenIfValid(existingSecret, r.bootstrapTokenTTL/2); valid && isControllerToken == (role == providerconfigtypes.NodeRoleController) {
+			return token, nil
+		}
+		// Rotate instead of extending the token, it may have leaked via the userdata
+		// of a previous instance which never joined
+		if err := r.targetClient.Delete(r.ctx, existingSecret); err != nil && !kerrors.IsNotFound(err) {
+			return "", fmt.Errorf("failed to delete expiring bootstrap token secret: %v", err)
+		}
 	}
 
 	tokenID := rand.String(6)
@@ -131,53 +215,60 @@ func (r *Reconciler) createBootstrapToken(name string) (string, error) {
 
 	secret := corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("bootstrap-token-%s", tokenID),
+			Name:      bootstrapTokenSecretPrefix + tokenID,
 			Namespace: metav1.NamespaceSystem,
 			Labels:    map[string]string{machineNameLabelKey: name},
 		},
 		Type: secretTypeBootstrapToken,
 		Data: map[string][]byte{
-			"description":                    []byte("bootstrap token for " + name),
-			tokenIDKey:                       []byte(tokenID),
-			tokenSecretKey:                   []byte(tokenSecret),
-			expirationKey:                    []byte(metav1.Now().Add(1 * time.Hour).Format(time.RFC3339)),
-			"usage-bootstrap-authentication": []byte("true"),
-			"usage-bootstrap-signing":        []byte("true"),
-			"auth-extra-groups":              []byte("system:bootstrappers:machine-controller:default-node-token"),
+			tokenIDKey:     []byte(tokenID),
+			tokenSecretKey: []byte(tokenSecret),
+			expirationKey:  []byte(metav1.Now().Add(r.bootstrapTokenTTL).Format(time.RFC3339)),
 		},
 	}
+	if role == providerconfigtypes.NodeRoleController {
+		secret.Data["description"] = []byte("controller join token for " + name)
+		secret.Data[controllerJoinUsageKey] = []byte("true")
+	} else {
+		secret.Data["description"] = []byte("bootstrap token for " + name)
+		secret.Data["usage-bootstrap-authentication"] = []byte("true")
+		secret.Data["auth-extra-groups"] = []byte("system:bootstrappers:machine-controller:default-node-token")
+	}
 
-	if err := r.client.Create(r.ctx, &secret); err != nil {
+	if err := r.targetClient.Create(r.ctx, &secret); err != nil {
 		return "", fmt.Errorf("failed to create bootstrap token secret: %v", err)
 	}
 
 	return fmt.Sprintf(tokenFormatter, tokenID, tokenSecret), nil
 }
 
-func (r *Reconciler) updateSecretExpirationAndGetToken(secret *corev1.Secret) (string, error) {
-	if secret.Data == nil {
-		secret.Data = map[string][]byte{}
+// bootstrapTokenIfValid returns the token of the given secret and whether it is valid
+// for at least minValidity, so a new instance has enough time to join with it. Tokens
+// which expire earlier get rotated.
+func bootstrapTokenIfValid(secret *corev1.Secret, minValidity time.Duration) (string, bool) {
+	expirationTime, err := time.Parse(time.RFC3339, string(secret.Data[expirationKey]))
+	if err != nil || time.Until(expirationTime) < minValidity {
+		return "", false
 	}
-	tokenID := string(secret.Data[tokenIDKey])
-	tokenSecret := string(secret.Data[tokenSecretKey])
-	token := fmt.Sprintf(tokenFormatter, tokenID, tokenSecret)
+	return fmt.Sprintf(tokenFormatter, secret.Data[tokenIDKey], secret.Data[tokenSecretKey]), true
+}
 
-	expirationTime, err := time.Parse(time.RFC3339, string(secret.Data[expirationKey]))
+// deleteBootstrapToken invalidates the bootstrap token of the given machine. Nodes
+// which joined authenticate with their own client certificate, so the token in the
+// userdata is of no further use.
+func (r *Reconciler) deleteBootstrapToken(name string) error {
+	secret, err := r.getSecretIfExists(name)
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	//If the token is close to expire, reset it's expiration time
-	if time.Until(expirationTime).Minutes() < 30 {
-		secret.Data[expirationKey] = []byte(metav1.Now().Add(1 * time.Hour).Format(time.RFC3339))
-	} else {
-		return token, nil
+	if secret == nil {
+		return nil
 	}
-
-	if err := r.client.Update(r.ctx, secret); err != nil {
-		return "", fmt.Errorf("failed to update secret: %v", err)
+	if err := r.targetClient.Delete(r.ctx, secret); err != nil && !kerrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete bootstrap token secret: %v", err)
 	}
-	return token, nil
+	klog.V(3).Infof("Deleted bootstrap token of machine %s", name)
+	return nil
 }
 
 func (r *Reconciler) getSecretIfExists(name string) (*corev1.Secret, error) {
@@ -187,20 +278,28 @@ func (r *Reconciler) getSecretIfExists(name string) (*corev1.Secret, error) {
 	}
 	selector := labels.NewSelector().Add(*req)
 	secrets := &corev1.SecretList{}
-	if err := r.client.List(r.ctx, secrets,
+	if err := r.targetClient.List(r.ctx, secrets,
 		&ctrlruntimeclient.ListOptions{
 			Namespace:     metav1.NamespaceSystem,
 			LabelSelector: selector}); err != nil {
 		return nil, err
 	}
 
-	if len(secrets.Items) == 0 {
+	// The label is shared with other secrets of the machine, e.g. its stored userdata
+	var tokenSecrets []corev1.Secret
+	for _, secret := range secrets.Items {
+		if secret.Type == secretTypeBootstrapToken {
+			tokenSecrets = append(tokenSecrets, secret)
+		}
+	}
+
+	if len(tokenSecrets) == 0 {
 		return nil, nil
 	}
-	if len(secrets.Items) > 1 {
-		return nil, fmt.Errorf("expected to find exactly one secret for the given machine name =%s but found %d", name, len(secrets.Items))
+	if len(tokenSecrets) > 1 {
+		return nil, fmt.Errorf("expected to find exactly one secret for the given machine name =%s but found %d", name, len(tokenSecrets))
 	}
-	return &secrets.Items[0], nil
+	return &tokenSecrets[0], nil
 }
 
 // getAsUnstructured is a helper to get an object as unstrucuted.Unstructered from the client.
@@ -226,7 +325,7 @@ func (r *Reconciler) getAsUnstructured(obj runtime.Object) (runtime.Object, erro
 	target.SetKind(kind)
 	name := types.NamespacedName{Name: metaObj.GetName(), Namespace: metaObj.GetNamespace()}
 
-	if err := r.client.Get(r.ctx, name, target); err != nil {
+	if err := r.targetClient.Get(r.ctx, name, target); err != nil {
 		return nil, fmt.Errorf("failed to get object: %v", err)
 	}
 
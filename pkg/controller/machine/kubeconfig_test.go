@@ -18,78 +18,176 @@ package controller
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"io/ioutil"
 	"testing"
 	"time"
 
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
-func TestUpdateSecretExpirationAndGetToken(t *testing.T) {
+func TestCreateBootstrapToken(t *testing.T) {
 	tests := []struct {
-		initialExperirationTime time.Time
-		shouldRenew             bool
+		name           string
+		expirationTime time.Time
+		shouldRotate   bool
 	}{
 		{
-			initialExperirationTime: time.Now().Add(1 * time.Hour),
-			shouldRenew:             false,
+			name:           "valid token",
+			expirationTime: time.Now().Add(1 * time.Hour),
+			shouldRotate:   false,
 		},
 		{
-			initialExperirationTime: time.Now().Add(25 * time.Minute),
-			shouldRenew:             true,
+			name:           "token close to expiration",
+			expirationTime: time.Now().Add(25 * time.Minute),
+			shouldRotate:   true,
 		},
 		{
-			initialExperirationTime: time.Now().Add(-25 * time.Minute),
-			shouldRenew:             true,
+			name:           "expired token",
+			expirationTime: time.Now().Add(-25 * time.Minute),
+			shouldRotate:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "bootstrap-token-abcdef",
+					Namespace: metav1.NamespaceSystem,
+					Labels:    map[string]string{machineNameLabelKey: "machine"},
+				},
+				Type: secretTypeBootstrapToken,
+				Data: map[string][]byte{
+					tokenIDKey:     []byte("abcdef"),
+					tokenSecretKey: []byte("0123456789abcdef"),
+					expirationKey:  []byte(test.expirationTime.Format(time.RFC3339)),
+				},
+			}
+			reconciler := Reconciler{ctx: context.Background(), targetClient: ctrlruntimefake.NewFakeClient(runtime.Object(secret)), bootstrapTokenTTL: defaultBootstrapTokenTTL}
+
+			token, err := reconciler.createBootstrapToken("machine", providerconfigtypes.NodeRoleWorker)
+			if err != nil {
+				t.Fatalf("Unexpected error running createBootstrapToken: %v", err)
+			}
+			if rotated := token != "abcdef.0123456789abcdef"; rotated != test.shouldRotate {
+				t.Errorf("Expected token rotation to be %t, got token %q", test.shouldRotate, token)
+			}
+
+			err = reconciler.targetClient.Get(reconciler.ctx, types.NamespacedName{Namespace: metav1.NamespaceSystem, Name: secret.Name}, &corev1.Secret{})
+			if exists := err == nil; exists == test.shouldRotate {
+				t.Errorf("Expected old token secret to be deleted on rotation, got error %v", err)
+			}
+
+			newSecret, err := reconciler.getSecretIfExists("machine")
+			if err != nil {
+				t.Fatalf("Unexpected error getting token secret: %v", err)
+			}
+			if _, valid := bootstrapTokenIfValid(newSecret, defaultBootstrapTokenTTL/2); !valid {
+				t.Errorf("Expected token secret to be valid")
+			}
+			if _, ok := newSecret.Data["usage-bootstrap-signing"]; ok {
+				t.Errorf("Expected token to not be usable for signing")
+			}
+		})
+	}
+}
+
+func TestDeleteBootstrapToken(t *testing.T) {
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "bootstrap-token-abcdef",
+			Namespace: metav1.NamespaceSystem,
+			Labels:    map[string]string{machineNameLabelKey: "machine"},
 		},
+		Type: secretTypeBootstrapToken,
 	}
-	reconciler := Reconciler{ctx: context.Background()}
-
-	for _, testCase := range tests {
-		secret := &corev1.Secret{}
-		secret.Name = "secret"
-		secret.Namespace = metav1.NamespaceSystem
-		data := map[string][]byte{}
-		data[tokenSecretKey] = []byte("tokenSecret")
-		data[tokenIDKey] = []byte("tokenID")
-		data[expirationKey] = []byte(testCase.initialExperirationTime.Format(time.RFC3339))
-		secret.Data = data
-		reconciler.client = ctrlruntimefake.NewFakeClient(runtime.Object(secret))
-
-		if _, err := reconciler.updateSecretExpirationAndGetToken(secret); err != nil {
-			t.Fatalf("Unexpected error running updateSecretExpirationAndGetToken: %v", err)
-		}
-
-		updatedSecret := &corev1.Secret{}
-		if err := reconciler.client.Get(reconciler.ctx, types.NamespacedName{
+	userdata := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "machine-userdata-abcdef",
 			Namespace: metav1.NamespaceSystem,
-			Name:      "secret",
-		}, updatedSecret); err != nil {
-			t.Fatalf("Unsexpected error getting secret: %v", err)
-		}
-
-		if testCase.shouldRenew &&
-			bytes.Equal(updatedSecret.Data[expirationKey], []byte(testCase.initialExperirationTime.Format(time.RFC3339))) {
-			t.Errorf("Error, token secret did not update but was expected to!")
-		}
-
-		if !testCase.shouldRenew &&
-			!bytes.Equal(updatedSecret.Data[expirationKey], []byte(testCase.initialExperirationTime.Format(time.RFC3339))) {
-			t.Errorf("Error, token secret was expected to get updated, but did not happen!")
-		}
-
-		expirationTimeParsed, err := time.Parse(time.RFC3339, string(secret.Data[expirationKey]))
-		if err != nil {
-			t.Fatalf("Failed to parse timestamp from secret: %v", err)
-		}
-
-		if time.Until(expirationTimeParsed).Minutes() < 0 {
-			t.Errorf("Error, secret expiration is in the past!")
-		}
+			Labels:    map[string]string{machineNameLabelKey: "machine"},
+		},
+		Type: "machine-controller/userdata",
+	}
+	reconciler := Reconciler{ctx: context.Background(), targetClient: ctrlruntimefake.NewFakeClient(token, userdata)}
 
+	if err := reconciler.deleteBootstrapToken("machine"); err != nil {
+		t.Fatalf("Unexpected error running deleteBootstrapToken: %v", err)
+	}
+	if err := reconciler.targetClient.Get(reconciler.ctx, types.NamespacedName{Namespace: metav1.NamespaceSystem, Name: token.Name}, &corev1.Secret{}); !kerrors.IsNotFound(err) {
+		t.Errorf("Expected token secret to be deleted, got error %v", err)
+	}
+	if err := reconciler.targetClient.Get(reconciler.ctx, types.NamespacedName{Namespace: metav1.NamespaceSystem, Name: userdata.Name}, &corev1.Secret{}); err != nil {
+		t.Errorf("Expected other secrets of the machine to be kept, got error %v", err)
+	}
+
+	// Deleting a token which does not exist is a no-op
+	if err := reconciler.deleteBootstrapToken("machine"); err != nil {
+		t.Errorf("Unexpected error running deleteBootstrapToken: %v", err)
+	}
+}
+
+func TestK0sJoinTokenVersion(t *testing.T) {
+	if userdatahelper.DefaultK0sVersion != k0sJoinTokenVersion {
+		t.Errorf("DefaultK0sVersion %s differs from %s, whose join token format createK0sJoinToken implements. Check that `k0s token create --role=worker` of %s still returns a gzipped and base64 encoded kubeconfig, then update k0sJoinTokenVersion",
+			userdatahelper.DefaultK0sVersion, k0sJoinTokenVersion, userdatahelper.DefaultK0sVersion)
+	}
+}
+
+// TestCreateK0sJoinToken decodes the token the way JoinDecode of k0s does
+func TestCreateK0sJoinToken(t *testing.T) {
+	kubeconfig := &clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			contextIdentifier: {
+				Server: "https://server:6443",
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			contextIdentifier: {
+				Token: "abcdef.0123456789abcdef",
+			},
+		},
+	}
+
+	token, err := createK0sJoinToken(kubeconfig)
+	if err != nil {
+		t.Fatalf("failed to create join token: %v", err)
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatalf("failed to decode join token: %v", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("failed to decompress join token: %v", err)
+	}
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress join token: %v", err)
+	}
+	decoded, err := clientcmd.Load(raw)
+	if err != nil {
+		t.Fatalf("failed to load kubeconfig from join token: %v", err)
+	}
+
+	if server := decoded.Clusters[contextIdentifier].Server; server != "https://server:6443" {
+		t.Errorf("expected server %q, got %q", "https://server:6443", server)
+	}
+	if token := decoded.AuthInfos[contextIdentifier].Token; token != "abcdef.0123456789abcdef" {
+		t.Errorf("expected token %q, got %q", "abcdef.0123456789abcdef", token)
 	}
 }
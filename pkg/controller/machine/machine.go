@@ -18,44 +18,61 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/heptiolabs/healthcheck"
 	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/kubermatic/machine-controller/pkg/admission"
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
 	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/approval"
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/common/ssh"
 	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
 	"github.com/kubermatic/machine-controller/pkg/node/eviction"
+	"github.com/kubermatic/machine-controller/pkg/nodedns"
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 	"github.com/kubermatic/machine-controller/pkg/rhsm"
+	"github.com/kubermatic/machine-controller/pkg/targetcluster"
+	"github.com/kubermatic/machine-controller/pkg/tracing"
+	"github.com/kubermatic/machine-controller/pkg/userdata"
+	"github.com/kubermatic/machine-controller/pkg/userdata/addons"
 	userdatamanager "github.com/kubermatic/machine-controller/pkg/userdata/manager"
-	userdataplugin "github.com/kubermatic/machine-controller/pkg/userdata/plugin"
+	"github.com/kubermatic/machine-controller/pkg/userdata/profile"
 	"github.com/kubermatic/machine-controller/pkg/userdata/rhel"
+	"github.com/kubermatic/machine-controller/pkg/userdata/stub"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/tools/reference"
 	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -81,34 +98,122 @@ const (
 
 	deletionRetryWaitPeriod = 10 * time.Second
 
+	// Failed reconciliations of a machine are retried with an exponential backoff between
+	// reconcileBackoffBase and reconcileBackoffMax, which is jittered by reconcileBackoffJitter.
+	// The base and max are the defaults of BackoffSettings
+	reconcileBackoffBase   = 5 * time.Second
+	reconcileBackoffMax    = 10 * time.Minute
+	reconcileBackoffJitter = 0.2
+
 	controllerNameLabelKey = "machine.k8s.io/controller"
 	NodeOwnerLabelName     = "machine-controller/owned-by"
 
 	// AnnotationAutoscalerIdentifier is used by the cluster-autoscaler
 	// cluster-api provider to match Nodes to Machines
 	AnnotationAutoscalerIdentifier = "cluster.k8s.io/machine"
+
+	// AnnotationDeleteProtection blocks the deletion of a machine while it is set to "true".
+	// The machine keeps its finalizers and gets deleted once the annotation is removed
+	AnnotationDeleteProtection = "machine-controller.kubermatic.io/delete-protection"
+
+	// AnnotationForceDelete allows removing the finalizers of a machine whose deletion is stuck,
+	// e.g. because the cloud provider is unavailable. It only takes effect after forceDeleteAfter
+	AnnotationForceDelete = "machine-controller.kubermatic.io/force-delete"
+
+	// AnnotationInstanceCreationTimestamp holds when the machine-controller created the current instance
+	// of a machine, from which on the join cluster timeout applies
+	AnnotationInstanceCreationTimestamp = "machine-controller.kubermatic.io/instance-creation-timestamp"
+
+	// AnnotationAppliedSpecHash holds the hash of the provider spec the current instance of a machine
+	// conforms to, so changes of the spec can be applied according to its update strategy
+	AnnotationAppliedSpecHash = "machine-controller.kubermatic.io/applied-spec-hash"
+
+	// AnnotationPaused stops the reconciliation of a machine while it is set to "true", e.g. to
+	// repair its instance manually
+	AnnotationPaused = "machine-controller.kubermatic.io/paused"
+
+	// AnnotationAdoptInstance holds the ID of an existing instance, e.g. one created by Terraform, which
+	// the machine takes over instead of creating a new one. It is removed once the instance is adopted
+	AnnotationAdoptInstance = "machine-controller.kubermatic.io/adopt-instance"
+
+	// SSHPublicKeysSecretName is the name of an optional secret in the namespace of machines whose
+	// values are added to the SSH public keys of their instances, one or more keys per value
+	SSHPublicKeysSecretName = "machine-controller-ssh-public-keys"
+)
+
+// interruptionTaints are the taints termination handlers put on nodes whose spot or preemptible instance
+// is about to be reclaimed, e.g. the aws-node-termination-handler and the GCP k8s-node-termination-handler
+var interruptionTaints = sets.NewString(
+	"aws-node-termination-handler/spot-itn",
+	"cloud.google.com/impending-node-termination",
 )
 
 // Reconciler is the controller implementation for machine resources
 type Reconciler struct {
-	ctx        context.Context
-	kubeClient kubernetes.Interface
-	client     ctrlruntimeclient.Client
-
-	recorder record.EventRecorder
+	ctx    context.Context
+	client ctrlruntimeclient.Client
+	// targetClient and kubeClient access the cluster the nodes join, which holds
+	// the nodes and bootstrap tokens
+	targetClient ctrlruntimeclient.Client
+	kubeClient   kubernetes.Interface
+	// stubClient stores the userdata fetched on boot in kube-system, it is not cached
+	// as the cache of the manager may be restricted to a namespace
+	stubClient ctrlruntimeclient.Client
+
+	recorder   record.EventRecorder
+	backoff    workqueue.RateLimiter
+	inFlight   *InFlightReconciles
+	debugState *DebugState
+	nodeIndex  *nodeIndex
+	// machineIndex holds what the node events are matched against, so they don't list all machines
+	machineIndex *machineIndex
+	// cloudConfigPublisher is nil unless the cloud configs get published for cloud-controller-managers
+	cloudConfigPublisher *cloudConfigPublisher
+	// nodeDNS is nil unless the addresses of machines get registered in DNS
+	nodeDNS *nodedns.Registrar
+	// approvalGate is nil unless creations or deletions of machines need an external approval
+	approvalGate *approval.Gate
+	// bootstrapTokenTTL is how long the bootstrap tokens of new instances are valid
+	bootstrapTokenTTL time.Duration
+	// k0sTokens is nil unless the join tokens of k0s nodes are created with k0s
+	k0sTokens *K0sTokenCreator
+	// controllerEndpoints is nil unless k0s workers join with the addresses of all controllers
+	controllerEndpoints *controllerEndpoints
+	// dryRun renders the userdata of all new machines to ConfigMaps instead of creating their instances
+	dryRun bool
+	// chaos injects failures into the cloud provider calls, nil unless enabled
+	chaos *cloudprovider.ChaosSettings
 
 	metrics                          *MetricsCollection
 	kubeconfigProvider               KubeconfigProvider
 	providerData                     *cloudprovidertypes.ProviderData
 	userDataManager                  *userdatamanager.Manager
 	joinClusterTimeout               *time.Duration
+	joinClusterTimeoutRecreate       bool
 	externalCloudProvider            bool
 	name                             string
 	bootstrapTokenServiceAccountName *types.NamespacedName
 	skipEvictionAfter                time.Duration
+	forceDeleteAfter                 time.Duration
+	paused                           bool
+	instanceCheckInterval            time.Duration
+	instanceCacheTTL                 time.Duration
+	instanceGoneRecreate             bool
+	backoffSettings                  BackoffSettings
+	reconcileTimeout                 time.Duration
+	cloudProviderTimeout             time.Duration
+	machineDefaults                  *providerconfig.MachineDefaults
 	nodeSettings                     NodeSettings
 	redhatSubscriptionManager        rhsm.RedHatSubscriptionManager
 	satelliteSubscriptionManager     rhsm.SatelliteSubscriptionManager
+
+	// lastInstanceChecks holds when the instances of machines with a ready node were
+	// last found at the cloud provider, keyed by the namespaced name of the machine
+	lastInstanceChecks sync.Map
+	// secretResolvers holds the resolver of the cloud provider of the machines being
+	// reconciled, keyed by their namespaced name, so the credentials it resolved get
+	// redacted from errors
+	secretResolvers sync.Map
 }
 
 type NodeSettings struct {
@@ -131,6 +236,26 @@ type NodeSettings struct {
 	// Translates to feature gates on the kubelet.
 	// Default: RotateKubeletServerCertificate=true
 	KubeletFeatureGates map[string]bool
+	// Translates to kubeReserved, systemReserved and evictionHard on the kubelet,
+	// unless the machine sets them itself.
+	KubeReserved   map[string]string
+	SystemReserved map[string]string
+	EvictionHard   map[string]string
+	// The endpoint k0s workers download k0s from.
+	K0sReleaseURL string
+	// The URL instances fetch their userdata from on boot, if the machine requests it.
+	BootstrapUserDataURL string
+}
+
+// BackoffSettings tune the retries of failed reconciliations of machines
+type BackoffSettings struct {
+	// The delay before the first retry, which doubles with each consecutive failure. Defaults to 5 seconds.
+	Base time.Duration
+	// The maximum delay between retries, also used for terminal errors. Defaults to 10 minutes.
+	Max time.Duration
+	// The number of consecutive failures after which a machine is only reconciled again once it changes or
+	// the caches resync. 0 retries forever.
+	MaxRetries int
 }
 
 type KubeconfigProvider interface {
@@ -140,42 +265,118 @@ type KubeconfigProvider interface {
 // MetricsCollection is a struct of all metrics used in
 // this controller.
 type MetricsCollection struct {
-	Workers prometheus.Gauge
-	Errors  prometheus.Counter
+	Workers              prometheus.Gauge
+	Errors               prometheus.Counter
+	ReconcileDuration    prometheus.Histogram
+	ProvisioningDuration *prometheus.HistogramVec
+	TerminalErrors       *prometheus.CounterVec
 }
 
-func Add(
-	ctx context.Context,
-	mgr manager.Manager,
-	kubeClient kubernetes.Interface,
-	numWorkers int,
-	metrics *MetricsCollection,
-	prometheusRegistry prometheus.Registerer,
-	kubeconfigProvider KubeconfigProvider,
-	providerData *cloudprovidertypes.ProviderData,
-	joinClusterTimeout *time.Duration,
-	externalCloudProvider bool,
-	name string,
-	bootstrapTokenServiceAccountName *types.NamespacedName,
-	skipEvictionAfter time.Duration,
-	nodeSettings NodeSettings) error {
-
-	if prometheusRegistry != nil {
-		prometheusRegistry.MustRegister(metrics.Errors, metrics.Workers)
+// Options configure the machine controller added by Add. Zero values disable the optional features.
+type Options struct {
+	// The cluster the nodes of the machines join.
+	TargetCluster *targetcluster.Cluster
+	// The number of machines reconciled in parallel.
+	Workers int
+	Metrics *MetricsCollection
+	// The registry the metrics get registered at, they are not registered if nil.
+	PrometheusRegistry prometheus.Registerer
+	KubeconfigProvider KubeconfigProvider
+	ProviderData       *cloudprovidertypes.ProviderData
+	// Machines whose node does not join within the timeout get deleted if they are owned by a MachineSet, or marked
+	// as failed, or recreated if JoinClusterTimeoutRecreate is set.
+	JoinClusterTimeout         *time.Duration
+	JoinClusterTimeoutRecreate bool
+	ExternalCloudProvider      bool
+	// The machines processed by the controller have the machine.k8s.io/controller label set to the name, all
+	// machines without the label are processed if empty.
+	Name string
+	// The service account whose token is used as bootstrap token instead of a temporary one.
+	BootstrapTokenServiceAccountName *types.NamespacedName
+	SkipEvictionAfter                time.Duration
+	ForceDeleteAfter                 time.Duration
+	Paused                           bool
+	InstanceCheckInterval            time.Duration
+	InstanceCacheTTL                 time.Duration
+	InstanceGoneRecreate             bool
+	MachineDefaults                  *providerconfig.MachineDefaults
+	Node                             NodeSettings
+	InFlight                         *InFlightReconciles
+	DebugState                       *DebugState
+	EventAggregationWindow           time.Duration
+	ReconcileTimeout                 time.Duration
+	CloudProviderTimeout             time.Duration
+	Backoff                          BackoffSettings
+	// The namespace of the target cluster the cloud configs get published in, they are not published if empty.
+	CloudConfigSecretNamespace string
+	NodeDNS                    *nodedns.Registrar
+	ApprovalGate               *approval.Gate
+	// How long bootstrap tokens are valid. Defaults to 1 hour.
+	BootstrapTokenTTL time.Duration
+	// Let k0s workers join with the addresses of all controllers instead of the cluster-info address.
+	K0sControllerEndpoints bool
+	DryRun                 bool
+	// Creates the join tokens of k0s nodes with k0s, they are encoded by the controller if nil.
+	K0sTokens *K0sTokenCreator
+	// Injects failures into the cloud provider calls, disabled if nil.
+	Chaos *cloudprovider.ChaosSettings
+}
+
+// Add creates a new machine controller with the given options and adds it to the manager.
+func Add(ctx context.Context, mgr manager.Manager, opts Options) error {
+	backoffSettings := opts.Backoff
+	if backoffSettings.Base <= 0 {
+		backoffSettings.Base = reconcileBackoffBase
+	}
+	bootstrapTokenTTL := opts.BootstrapTokenTTL
+	if bootstrapTokenTTL <= 0 {
+		bootstrapTokenTTL = defaultBootstrapTokenTTL
+	}
+	if backoffSettings.Max <= 0 {
+		backoffSettings.Max = reconcileBackoffMax
+	}
+
+	if opts.PrometheusRegistry != nil {
+		opts.PrometheusRegistry.MustRegister(opts.Metrics.Errors, opts.Metrics.Workers, opts.Metrics.ReconcileDuration, opts.Metrics.ProvisioningDuration, opts.Metrics.TerminalErrors)
 	}
+	targetCluster := opts.TargetCluster
 	reconciler := &Reconciler{
-		kubeClient:                       kubeClient,
+		ctx:                              ctx,
 		client:                           mgr.GetClient(),
-		recorder:                         mgr.GetEventRecorderFor(ControllerName),
-		metrics:                          metrics,
-		kubeconfigProvider:               kubeconfigProvider,
-		providerData:                     providerData,
-		joinClusterTimeout:               joinClusterTimeout,
-		externalCloudProvider:            externalCloudProvider,
-		name:                             name,
-		bootstrapTokenServiceAccountName: bootstrapTokenServiceAccountName,
-		skipEvictionAfter:                skipEvictionAfter,
-		nodeSettings:                     nodeSettings,
+		targetClient:                     targetCluster.Client,
+		kubeClient:                       targetCluster.KubeClient,
+		recorder:                         newAggregatingRecorder(mgr.GetEventRecorderFor(ControllerName), opts.EventAggregationWindow),
+		backoff:                          workqueue.NewItemExponentialFailureRateLimiter(backoffSettings.Base, backoffSettings.Max),
+		backoffSettings:                  backoffSettings,
+		metrics:                          opts.Metrics,
+		kubeconfigProvider:               opts.KubeconfigProvider,
+		providerData:                     opts.ProviderData,
+		joinClusterTimeout:               opts.JoinClusterTimeout,
+		joinClusterTimeoutRecreate:       opts.JoinClusterTimeoutRecreate,
+		externalCloudProvider:            opts.ExternalCloudProvider,
+		name:                             opts.Name,
+		bootstrapTokenServiceAccountName: opts.BootstrapTokenServiceAccountName,
+		skipEvictionAfter:                opts.SkipEvictionAfter,
+		forceDeleteAfter:                 opts.ForceDeleteAfter,
+		paused:                           opts.Paused,
+		instanceCheckInterval:            opts.InstanceCheckInterval,
+		instanceCacheTTL:                 opts.InstanceCacheTTL,
+		instanceGoneRecreate:             opts.InstanceGoneRecreate,
+		reconcileTimeout:                 opts.ReconcileTimeout,
+		cloudProviderTimeout:             opts.CloudProviderTimeout,
+		machineDefaults:                  opts.MachineDefaults,
+		nodeSettings:                     opts.Node,
+		inFlight:                         opts.InFlight,
+		debugState:                       opts.DebugState,
+		nodeIndex:                        newNodeIndex(),
+		machineIndex:                     newMachineIndex(),
+		cloudConfigPublisher:             newCloudConfigPublisher(targetCluster.KubeClient, opts.CloudConfigSecretNamespace),
+		nodeDNS:                          opts.NodeDNS,
+		approvalGate:                     opts.ApprovalGate,
+		bootstrapTokenTTL:                bootstrapTokenTTL,
+		k0sTokens:                        opts.K0sTokens,
+		dryRun:                           opts.DryRun,
+		chaos:                            opts.Chaos,
 		redhatSubscriptionManager:        rhsm.NewRedHatSubscriptionManager(),
 		satelliteSubscriptionManager:     rhsm.NewSatelliteSubscriptionManager(),
 	}
@@ -184,26 +385,80 @@ func Add(
 		return fmt.Errorf("failed to create userdatamanager: %v", err)
 	}
 	reconciler.userDataManager = m
+	reconciler.stubClient, err = ctrlruntimeclient.New(mgr.GetConfig(), ctrlruntimeclient.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return fmt.Errorf("failed to create client for the userdata stubs: %v", err)
+	}
 
 	utilruntime.ErrorHandlers = append(utilruntime.ErrorHandlers, func(error) {
 		reconciler.metrics.Errors.Add(1)
 	})
 
 	c, err := controller.New(ControllerName, mgr,
-		controller.Options{Reconciler: reconciler, MaxConcurrentReconciles: numWorkers})
+		controller.Options{Reconciler: reconciler, MaxConcurrentReconciles: opts.Workers})
 	if err != nil {
 		return err
 	}
 	if err := c.Watch(&source.Kind{Type: &clusterv1alpha1.Machine{}}, &handler.EnqueueRequestForObject{}); err != nil {
 		return err
 	}
+	machineInformer, err := mgr.GetCache().GetInformer(&clusterv1alpha1.Machine{})
+	if err != nil {
+		return fmt.Errorf("failed to get the machine informer: %v", err)
+	}
+	machineInformer.AddEventHandler(reconciler.machineIndex.handler())
+
+	if opts.K0sControllerEndpoints {
+		reconciler.controllerEndpoints = newControllerEndpoints(targetCluster.KubeClient)
+		if _, err := reconciler.controllerEndpoints.refresh(); err != nil {
+			return err
+		}
+		// Workers which didn't join yet may wait for controllers which are gone
+		pendingMachines := make(chan event.GenericEvent)
+		go reconciler.controllerEndpoints.run(ctx, controllerEndpointsPollInterval, func() {
+			reconciler.pendingMachineEvents(pendingMachines)
+		})
+		if err := c.Watch(&source.Channel{Source: pendingMachines}, &handler.EnqueueRequestForObject{}); err != nil {
+			return err
+		}
+	}
+
+	// Credentials are resolved on every call to the cloud provider. Machines referencing a changed secret are
+	// reconciled right away instead of after their backoff, so rotated credentials take effect immediately
+	if err := c.Watch(
+		&source.Kind{Type: &corev1.Secret{}},
+		&handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(secret handler.MapObject) []reconcile.Request {
+				return reconciler.machinesReferencingSecret(secret.Meta.GetNamespace(), secret.Meta.GetName())
+			}),
+		},
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return !reflect.DeepEqual(e.ObjectOld.(*corev1.Secret).Data, e.ObjectNew.(*corev1.Secret).Data)
+			},
+			DeleteFunc: func(event.DeleteEvent) bool {
+				return false
+			},
+		},
+	); err != nil {
+		return err
+	}
 
+	nodeInformer, err := targetCluster.Informer(&corev1.Node{})
+	if err != nil {
+		return err
+	}
+	nodeInformer.AddEventHandler(reconciler.nodeIndex.handler())
+	nodeSource, err := targetCluster.Source(&corev1.Node{})
+	if err != nil {
+		return err
+	}
 	return c.Watch(
-		&source.Kind{Type: &corev1.Node{}},
+		nodeSource,
 		&handler.EnqueueRequestsFromMapFunc{
 			ToRequests: handler.ToRequestsFunc(func(node handler.MapObject) (result []reconcile.Request) {
-				machinesList := &clusterv1alpha1.MachineList{}
-				if err := mgr.GetClient().List(ctx, machinesList); err != nil {
+				machines, err := reconciler.indexedMachines()
+				if err != nil {
 					utilruntime.HandleError(fmt.Errorf("Failed to list machines in lister: %v", err))
 					return
 				}
@@ -214,27 +469,20 @@ func Add(
 					ownerUIDString, exists = labels[NodeOwnerLabelName]
 				}
 				if !exists {
-					// We get triggered by node{Add,Update}, so enqeue machines if they
-					// have no nodeRef yet to make matching happen ASAP
-					for _, machine := range machinesList.Items {
-						if machine.Status.NodeRef == nil {
-							result = append(result, reconcile.Request{
-								NamespacedName: types.NamespacedName{
-									Namespace: machine.Namespace,
-									Name:      machine.Name}})
+					// We get triggered by node{Add,Update}, so enqeue the machines the node may
+					// belong to if they have no nodeRef yet to make matching happen ASAP
+					nodeObject, _ := node.Object.(*corev1.Node)
+					for _, machine := range machines.machinesWithoutNodeRef() {
+						if mayOwnNode(machine.addresses, nodeObject) {
+							result = append(result, reconcile.Request{NamespacedName: machine.name})
 						}
 					}
 					return
 				}
 
-				for _, machine := range machinesList.Items {
-					if string(machine.UID) == ownerUIDString {
-						klog.V(6).Infof("Processing node: %s (machine=%s)", node.Meta.GetName(), machine.Name)
-						return []reconcile.Request{{NamespacedName: types.NamespacedName{
-							Namespace: machine.Namespace,
-							Name:      machine.Name,
-						}}}
-					}
+				if machineName, found := machines.machineWithUID(types.UID(ownerUIDString)); found {
+					klog.V(6).Infof("Processing node: %s (machine=%s)", node.Meta.GetName(), machineName.Name)
+					return []reconcile.Request{{NamespacedName: machineName}}
 				}
 				return
 			}),
@@ -245,6 +493,10 @@ func Add(
 			if newNode.ResourceVersion == oldNode.ResourceVersion {
 				return false
 			}
+			// The node may only match its machine once the cloud controller manager set these
+			if newNode.Spec.ProviderID != oldNode.Spec.ProviderID || !equality.Semantic.DeepEqual(newNode.Status.Addresses, oldNode.Status.Addresses) {
+				return true
+			}
 			// Dont do anything if the ready condition hasnt changed
 			for _, newCondition := range newNode.Status.Conditions {
 				if newCondition.Type != corev1.NodeReady {
@@ -264,9 +516,52 @@ func Add(
 	)
 }
 
+// mayOwnNode returns whether the given node may belong to the instance of a machine with the given addresses,
+// which is the case if they share an address or the addresses of the instance are not known yet
+func mayOwnNode(machineAddresses []corev1.NodeAddress, node *corev1.Node) bool {
+	if len(machineAddresses) == 0 || node == nil {
+		return true
+	}
+	for _, machineAddress := range machineAddresses {
+		for _, nodeAddress := range node.Status.Addresses {
+			if machineAddress.Address == nodeAddress.Address {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// machinesReferencingSecret returns the requests for the machines of this controller whose provider spec
+// references the given secret. Their backoff is reset, as their errors may be caused by outdated credentials.
+func (r *Reconciler) machinesReferencingSecret(namespace, name string) []reconcile.Request {
+	machines := &clusterv1alpha1.MachineList{}
+	if err := r.client.List(r.ctx, machines); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to list machines: %v", err))
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, machine := range machines.Items {
+		if machine.Labels[controllerNameLabelKey] != r.name || !providerconfig.ReferencesSecret(machine.Spec.ProviderSpec.Value, namespace, name) {
+			continue
+		}
+		klog.V(4).Infof("Reconciling machine %s/%s because its secret %s/%s changed", machine.Namespace, machine.Name, namespace, name)
+		machineName := types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name}
+		r.backoff.Forget(machineName)
+		requests = append(requests, reconcile.Request{NamespacedName: machineName})
+	}
+	return requests
+}
+
 // clearMachineError is a convenience function to remove a error on the machine if its set.
 // It does not return an error as it's used around the sync handler
 func (r *Reconciler) clearMachineError(machine *clusterv1alpha1.Machine) {
+	// The instance of a machine which did not join in time may get recreated, which is a successful
+	// reconciliation, the error is kept until a node joins
+	if reason := machine.Status.ErrorReason; reason != nil && *reason == common.JoinClusterTimeoutMachineError && machine.Status.NodeRef == nil {
+		return
+	}
 	if machine.Status.ErrorMessage != nil || machine.Status.ErrorReason != nil {
 		if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
 			m.Status.ErrorMessage = nil
@@ -277,6 +572,57 @@ func (r *Reconciler) clearMachineError(machine *clusterv1alpha1.Machine) {
 	}
 }
 
+// updateMachinePhase sets the phase of the machine according to its current state. Machines
+// which are gone after their deletion are ignored.
+func (r *Reconciler) updateMachinePhase(machine *clusterv1alpha1.Machine) {
+	if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+		phase := machinePhase(m)
+		m.Status.Phase = &phase
+	}); err != nil && !kerrors.IsNotFound(err) {
+		utilruntime.HandleError(fmt.Errorf("failed to update phase of machine %s: %v", machine.Name, err))
+	}
+}
+
+func machinePhase(machine *clusterv1alpha1.Machine) string {
+	switch {
+	case machine.DeletionTimestamp != nil:
+		return clusterv1alpha1.MachinePhaseDeleting
+	case machine.Status.ErrorReason != nil:
+		return clusterv1alpha1.MachinePhaseFailed
+	case machine.Status.NodeRef != nil:
+		return clusterv1alpha1.MachinePhaseRunning
+	case HasInstance(machine):
+		return clusterv1alpha1.MachinePhaseProvisioned
+	default:
+		return clusterv1alpha1.MachinePhaseProvisioning
+	}
+}
+
+// machineProvider returns the cloud provider of the machine for the metrics, "unknown" if its spec is invalid
+func machineProvider(machine *clusterv1alpha1.Machine) string {
+	providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return "unknown"
+	}
+	return string(providerConfig.CloudProvider)
+}
+
+// HasInstance returns whether an instance got created for the machine or was found at the cloud provider.
+func HasInstance(machine *clusterv1alpha1.Machine) bool {
+	if machine.Annotations[AnnotationInstanceCreationTimestamp] != "" {
+		return true
+	}
+	if machine.Status.ProviderStatus == nil || len(machine.Status.ProviderStatus.Raw) == 0 {
+		return false
+	}
+	status := map[string]interface{}{}
+	if err := json.Unmarshal(machine.Status.ProviderStatus.Raw, &status); err != nil {
+		return false
+	}
+	_, found := status["instanceStatus"]
+	return found
+}
+
 func nodeIsReady(node *corev1.Node) bool {
 	for _, condition := range node.Status.Conditions {
 		if condition.Type == corev1.NodeReady {
@@ -290,12 +636,42 @@ func nodeIsReady(node *corev1.Node) bool {
 
 func (r *Reconciler) getNodeByNodeRef(nodeRef *corev1.ObjectReference) (*corev1.Node, error) {
 	node := &corev1.Node{}
-	if err := r.client.Get(r.ctx, types.NamespacedName{Name: nodeRef.Name}, node); err != nil {
+	if err := r.targetClient.Get(r.ctx, types.NamespacedName{Name: nodeRef.Name}, node); err != nil {
 		return nil, err
 	}
 	return node, nil
 }
 
+// applyMachineDefaults stores the machine defaults missing in the spec of the given machine. Only
+// machines without an instance get defaulted, changed defaults do not affect existing instances.
+func (r *Reconciler) applyMachineDefaults(machine *clusterv1alpha1.Machine) error {
+	if r.machineDefaults == nil {
+		return nil
+	}
+	spec := machine.Spec.DeepCopy()
+	if err := r.machineDefaults.Apply(spec); err != nil {
+		return fmt.Errorf("failed to apply machine defaults: %v", err)
+	}
+	if equality.Semantic.DeepEqual(machine.Spec, *spec) {
+		return nil
+	}
+
+	klog.V(3).Infof("Applying the machine defaults to machine %s", machine.Name)
+	var applyErr error
+	if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+		applyErr = r.machineDefaults.Apply(&m.Spec)
+		// The webhook rejects changes of the spec otherwise, e.g. if its defaults differ from the ones of the
+		// controller. It removes the annotation again.
+		if m.Annotations == nil {
+			m.Annotations = map[string]string{}
+		}
+		m.Annotations[admission.BypassSpecNoModificationRequirementAnnotation] = "true"
+	}); err != nil {
+		return fmt.Errorf("failed to update machine with its defaults: %v", err)
+	}
+	return applyErr
+}
+
 func (r *Reconciler) updateMachine(m *clusterv1alpha1.Machine, modify ...cloudprovidertypes.MachineModifier) error {
 	return r.providerData.Update(m, modify...)
 }
@@ -303,17 +679,55 @@ func (r *Reconciler) updateMachine(m *clusterv1alpha1.Machine, modify ...cloudpr
 // updateMachine updates machine's ErrorMessage and ErrorReason regardless if they were set or not
 // this essentially overwrites previous values
 func (r *Reconciler) updateMachineError(machine *clusterv1alpha1.Machine, reason common.MachineStatusError, message string) error {
+	message = r.redact(machine, message)
+	r.recorder.Event(machine, corev1.EventTypeWarning, string(reason), message)
 	return r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
 		m.Status.ErrorMessage = &message
 		m.Status.ErrorReason = &reason
 	})
 }
 
+// recordInstanceLookup records the response of the cloud provider to the lookup of the instance of
+// the given machine for the debug endpoint
+func (r *Reconciler) recordInstanceLookup(machine *clusterv1alpha1.Machine, providerInstance instance.Instance, err error) {
+	var message string
+	if err != nil {
+		message = r.redact(machine, err.Error())
+	}
+	r.debugState.recordInstance(types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name}, providerInstance, message)
+}
+
+// redact replaces the inline credentials of the given machine in the message, as well as the ones
+// resolved for it during the current reconciliation, e.g. from a secret or the environment
+func (r *Reconciler) redact(machine *clusterv1alpha1.Machine, message string) string {
+	return providerconfig.RedactMessage(message, machine.Spec.ProviderSpec.Value, r.resolvedSecrets(machine)...)
+}
+
+// configVarResolver returns the resolver of the machine for the current reconciliation, which is registered
+// on first use. All secrets of the machine must be resolved with it, so redact knows them.
+func (r *Reconciler) configVarResolver(machine *clusterv1alpha1.Machine) *providerconfig.ConfigVarResolver {
+	resolver, _ := r.secretResolvers.LoadOrStore(types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name}, providerconfig.NewConfigVarResolver(r.ctx, r.client))
+	return resolver.(*providerconfig.ConfigVarResolver)
+}
+
+// resolvedSecrets returns the credentials resolved for the machine during the current reconciliation
+func (r *Reconciler) resolvedSecrets(machine *clusterv1alpha1.Machine) []string {
+	resolver, ok := r.secretResolvers.Load(types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name})
+	if !ok {
+		return nil
+	}
+	return resolver.(*providerconfig.ConfigVarResolver).ResolvedSecrets()
+}
+
 // updateMachineErrorIfTerminalError is a convenience method that will update machine's Status if the given err is terminal
 // and at the same time terminal error will be returned to the caller
-// otherwise it will return formatted error according to errMsg
+// otherwise it will return formatted error according to errMsg. The reason of errors classified as invalid credentials,
+// exceeded quota or insufficient capacity takes precedence over the given one.
 func (r *Reconciler) updateMachineErrorIfTerminalError(machine *clusterv1alpha1.Machine, stReason common.MachineStatusError, stMessage string, err error, errMsg string) error {
-	if ok, _, _ := cloudprovidererrors.IsTerminalError(err); ok {
+	if ok, reason, _ := cloudprovidererrors.IsTerminalError(err); ok {
+		if cloudprovidererrors.IsClassified(reason) {
+			stReason = reason
+		}
 		if errNested := r.updateMachineError(machine, stReason, stMessage); errNested != nil {
 			return fmt.Errorf("failed to update machine error after due to %v, terminal error = %v", errNested, stMessage)
 		}
@@ -322,24 +736,104 @@ func (r *Reconciler) updateMachineErrorIfTerminalError(machine *clusterv1alpha1.
 	return fmt.Errorf("%s, due to %v", errMsg, err)
 }
 
+// userdataStub stores the given userdata and returns the userdata which makes the
+// instance fetch it on boot.
+func (r *Reconciler) userdataStub(machine *clusterv1alpha1.Machine, os providerconfigtypes.OperatingSystem, userdata string) (string, error) {
+	if r.nodeSettings.BootstrapUserDataURL == "" {
+		return "", cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: "fetchUserDataOnBoot requires the machine-controller to be started with -bootstrap-userdata-url",
+		}
+	}
+
+	token, err := stub.Store(r.ctx, r.stubClient, machine.Name, userdata, stub.TTL)
+	if err != nil {
+		return "", err
+	}
+
+	url := strings.TrimSuffix(r.nodeSettings.BootstrapUserDataURL, "/") + "/" + token
+	out, err := stub.Stub(os, userdata, url)
+	if err != nil {
+		return "", cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: fmt.Sprintf("failed to stub userdata: %v", err),
+		}
+	}
+	return out, nil
+}
+
 func (r *Reconciler) createProviderInstance(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine, userdata string) (instance.Instance, error) {
 	// Ensure finalizer is there
 	_, err := r.ensureDeleteFinalizerExists(machine)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add %q finalizer: %v", FinalizerDeleteInstance, err)
 	}
+	r.recorder.Event(machine, corev1.EventTypeNormal, "Creating", "Creating instance")
 	instance, err := prov.Create(machine, r.providerData, userdata)
-	if err != nil {
+	if err = cloudprovidererrors.Classify(err); err != nil {
+		r.recorder.Eventf(machine, corev1.EventTypeWarning, "CreateFailed", "Failed to create instance: %s", r.redact(machine, err.Error()))
 		return nil, err
 	}
 	return instance, nil
 }
 
+// adoptInstance takes over the existing instance with the given ID for the machine instead of creating a new one
+func (r *Reconciler) adoptInstance(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine, instanceID string) (*reconcile.Result, error) {
+	adopter, ok := prov.(cloudprovidertypes.InstanceAdopter)
+	if !ok {
+		return nil, r.adoptionFailed(machine, instanceID, cloudprovidererrors.ErrAdoptionNotSupported)
+	}
+
+	// The adopted instance gets deleted with the machine
+	machine, err := r.ensureDeleteFinalizerExists(machine)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add %q finalizer: %v", FinalizerDeleteInstance, err)
+	}
+	r.recorder.Eventf(machine, corev1.EventTypeNormal, "Adopting", "Adopting instance %s", instanceID)
+	if _, err := adopter.AdoptInstance(machine, instanceID, r.providerData); err != nil {
+		return nil, r.adoptionFailed(machine, instanceID, cloudprovidererrors.Classify(err))
+	}
+
+	if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+		delete(m.Annotations, AnnotationAdoptInstance)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to remove the %s annotation after adopting instance %s: %v", AnnotationAdoptInstance, instanceID, err)
+	}
+	r.recorder.Eventf(machine, corev1.EventTypeNormal, "Adopted", "Successfully adopted instance %s", instanceID)
+	klog.V(3).Infof("Adopted instance %s for machine %s", instanceID, machine.Name)
+	// Requeue the machine to find the adopted instance through the cloud provider
+	return &reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+}
+
+// adoptionFailed emits an event for the failed adoption and sets the machine error if it can not succeed on a retry
+func (r *Reconciler) adoptionFailed(machine *clusterv1alpha1.Machine, instanceID string, err error) error {
+	if err == cloudprovidererrors.ErrAdoptionNotSupported || err == cloudprovidererrors.ErrInstanceNotFound {
+		err = cloudprovidererrors.TerminalError{
+			Reason:  common.InvalidConfigurationMachineError,
+			Message: fmt.Sprintf("failed to adopt instance %s: %v", instanceID, err),
+		}
+	}
+	r.recorder.Eventf(machine, corev1.EventTypeWarning, "AdoptFailed", "Failed to adopt instance %s: %s", instanceID, r.redact(machine, err.Error()))
+	message := fmt.Sprintf("%v. Unable to adopt the instance.", err)
+	return r.updateMachineErrorIfTerminalError(machine, common.CreateMachineError, message, err, "failed to adopt instance at cloudprovider")
+}
+
 func (r *Reconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	// Tracked so the shutdown can wait for instances being created or deleted. The leadership gets
+	// released after the shutdown, so no reconciliation must start anymore
+	if !r.inFlight.start(request.NamespacedName) {
+		klog.V(3).Infof("Not reconciling machine %q during the shutdown", request.NamespacedName.String())
+		return reconcile.Result{}, nil
+	}
+	defer r.inFlight.done(request.NamespacedName)
+
 	machine := &clusterv1alpha1.Machine{}
 	if err := r.client.Get(r.ctx, request.NamespacedName, machine); err != nil {
 		if kerrors.IsNotFound(err) {
 			klog.V(2).Infof("machine %q in work queue no longer exists", request.NamespacedName.String())
+			r.backoff.Forget(request.NamespacedName)
+			r.lastInstanceChecks.Delete(request.NamespacedName)
+			r.debugState.forget(request.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		return reconcile.Result{}, err
@@ -355,22 +849,96 @@ func (r *Reconciler) Reconcile(request reconcile.Request) (reconcile.Result, err
 		return reconcile.Result{}, nil
 	}
 
+	if r.paused || machine.Annotations[AnnotationPaused] == "true" {
+		// Removing the annotation triggers an update event, so there is no need to requeue
+		klog.V(3).Infof("Ignoring machine %q because the reconciliation is paused", machine.Name)
+		return reconcile.Result{}, nil
+	}
+
 	recorderMachine := machine.DeepCopy()
-	result, err := r.reconcile(machine)
+	defer r.secretResolvers.Delete(request.NamespacedName)
+	ctx, cancel := r.reconcileContext()
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "Reconcile")
+	span.SetAttribute("machine", request.NamespacedName.String())
+	reconcileStart := time.Now()
+	result, err := r.reconcile(ctx, machine)
+	r.metrics.ReconcileDuration.Observe(time.Since(reconcileStart).Seconds())
+	r.updateMachinePhase(machine)
 	if err != nil {
 		// We have no guarantee that machine is non-nil after reconciliation
-		klog.Errorf("Failed to reconcile machine %q: %v", recorderMachine.Name, err)
-		r.recorder.Eventf(recorderMachine, corev1.EventTypeWarning, "ReconcilingError", "%v", err)
-	} else {
-		r.clearMachineError(machine)
+		message := r.redact(recorderMachine, err.Error())
+		span.End(errors.New(message))
+		klog.Errorf("Failed to reconcile machine %q: %s", recorderMachine.Name, message)
+		r.recorder.Event(recorderMachine, corev1.EventTypeWarning, "ReconcilingError", message)
+		// The error is not returned, as the workqueue would retry within milliseconds. Repeated
+		// provider errors like an exceeded quota or an invalid token would hammer the cloud API.
+		// controller-runtime doesn't count it then, so it's counted here
+		r.metrics.Errors.Add(1)
+		terminal, reason, _ := cloudprovidererrors.IsTerminalError(err)
+		if terminal {
+			r.metrics.TerminalErrors.WithLabelValues(machineProvider(recorderMachine), string(reason)).Inc()
+		}
+		if r.retriesExhausted(request.NamespacedName) {
+			klog.Errorf("Giving up on machine %q after %d retries, it is reconciled again once it changes or the caches resync", recorderMachine.Name, r.backoffSettings.MaxRetries)
+			r.debugState.recordReconcile(request.NamespacedName, reconcileStart, 0, message)
+			return reconcile.Result{}, nil
+		}
+		requeueAfter := r.backoffAfter(request.NamespacedName)
+		if terminal {
+			// Retrying right away doesn't help, the error needs to be resolved first
+			requeueAfter = wait.Jitter(r.maxBackoff(), reconcileBackoffJitter)
+		}
+		r.debugState.recordReconcile(request.NamespacedName, reconcileStart, requeueAfter, message)
+		return reconcile.Result{RequeueAfter: requeueAfter}, nil
 	}
+	span.End(nil)
+	r.clearMachineError(machine)
+	r.backoff.Forget(request.NamespacedName)
 	if result == nil {
 		result = &reconcile.Result{}
 	}
-	return *result, err
+	r.debugState.recordReconcile(request.NamespacedName, reconcileStart, result.RequeueAfter, "")
+	return *result, nil
+}
+
+// reconcileContext returns the context of a reconciliation, which ends after the reconcile timeout
+func (r *Reconciler) reconcileContext() (context.Context, context.CancelFunc) {
+	if r.reconcileTimeout <= 0 {
+		return context.WithCancel(r.ctx)
+	}
+	return context.WithTimeout(r.ctx, r.reconcileTimeout)
+}
+
+// retriesExhausted returns whether the given machine failed at least as often in a row as the configured maximum
+// number of retries, its failures are only reset by a successful reconciliation.
+func (r *Reconciler) retriesExhausted(name types.NamespacedName) bool {
+	return r.backoffSettings.MaxRetries > 0 && r.backoff.NumRequeues(name) >= r.backoffSettings.MaxRetries
+}
+
+// maxBackoff returns the maximum delay between retries of a machine
+func (r *Reconciler) maxBackoff() time.Duration {
+	if r.backoffSettings.Max <= 0 {
+		return reconcileBackoffMax
+	}
+	return r.backoffSettings.Max
+}
+
+// backoffAfter returns the jittered duration after which a machine gets reconciled again
+// after a failed reconciliation, which grows exponentially with its consecutive failures.
+func (r *Reconciler) backoffAfter(name types.NamespacedName) time.Duration {
+	return wait.Jitter(r.backoff.When(name), reconcileBackoffJitter)
 }
 
-func (r *Reconciler) reconcile(machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
+// reconcile reconciles the given machine, ctx holds the span of the reconciliation
+func (r *Reconciler) reconcile(ctx context.Context, machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
+
+	// Machines which were not created through the webhook lack the defaults
+	if machine.DeletionTimestamp == nil && !HasInstance(machine) {
+		if err := r.applyMachineDefaults(machine); err != nil {
+			return nil, err
+		}
+	}
 
 	// This must stay in the controller, it can not be moved into the webhook
 	// as the webhook does not get the name of machineset controller generated
@@ -380,36 +948,59 @@ func (r *Reconciler) reconcile(machine *clusterv1alpha1.Machine) (*reconcile.Res
 		machine.Spec.Name = machine.Name
 	}
 
+	_, parseSpan := tracing.Start(ctx, "ParseProviderConfig")
 	providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
+	parseSpan.End(err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get provider config: %v", err)
 	}
-	skg := providerconfig.NewConfigVarResolver(r.ctx, r.client)
+	skg := r.configVarResolver(machine)
 	prov, err := cloudprovider.ForProvider(providerConfig.CloudProvider, skg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cloud provider %q: %v", providerConfig.CloudProvider, err)
 	}
+	prov = cloudprovider.NewChaosCloudProvider(prov, r.chaos)
+	prov = cloudprovider.NewDeadlineCloudProvider(ctx, prov, r.cloudProviderTimeout)
+	prov = cloudprovider.NewInstanceCachingCloudProvider(prov, r.instanceCacheTTL)
+	prov = cloudprovider.NewAuditingCloudProvider(ctx, providerConfig.CloudProvider, prov, skg)
+	prov = cloudprovider.NewTracingCloudProvider(ctx, providerConfig.CloudProvider, prov, skg)
 
 	// step 2: check if a user requested to delete the machine
 	if machine.DeletionTimestamp != nil {
 		return r.deleteMachine(prov, machine)
 	}
 
+	// Deleting stays possible once the profile got restricted, the instance was created with its credentials
+	if err := skg.ValidateCredentialProfile(providerConfig.CredentialProfile, machine.Namespace); err != nil {
+		return nil, r.updateMachineErrorIfTerminalError(machine, common.InvalidConfigurationMachineError, err.Error(), err, "failed to validate the credential profile")
+	}
+
+	if result, err := r.applySpecChanges(prov, machine, providerConfig); result != nil || err != nil {
+		return result, err
+	}
+
 	// Step 3: Essentially creates an instance for the given machine.
-	userdataPlugin, err := r.userDataManager.ForOS(providerConfig.OperatingSystem)
+	userdataPlugin, err := r.userdataProvider(machine, providerConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to userdata provider for '%s': %v", providerConfig.OperatingSystem, err)
 	}
 
 	// case 3.2: creates an instance if there is no node associated with the given machine
 	if machine.Status.NodeRef == nil {
-		return r.ensureInstanceExistsForMachine(prov, machine, userdataPlugin, providerConfig)
+		return r.ensureInstanceExistsForMachine(ctx, prov, machine, userdataPlugin, providerConfig)
 	}
 
+	_, nodeSpan := tracing.Start(ctx, "GetNode")
 	node, err := r.getNodeByNodeRef(machine.Status.NodeRef)
+	nodeSpan.End(err)
 	if err != nil {
 		//In case we cannot find a node for the NodeRef we must remove the NodeRef & recreate an instance on the next sync
 		if kerrors.IsNotFound(err) {
+			// The node may be gone because the instance got deleted, e.g. by the node lifecycle controller
+			// of a cloud controller manager. That must not lead to a silent recreation
+			if result, err := r.checkInstanceExists(prov, machine); result != nil || err != nil {
+				return result, err
+			}
 			klog.V(3).Infof("found invalid NodeRef on machine %s. Deleting reference...", machine.Name)
 			return nil, r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
 				m.Status.NodeRef = nil
@@ -424,13 +1015,52 @@ func (r *Reconciler) reconcile(machine *clusterv1alpha1.Machine) (*reconcile.Res
 		if err := r.ensureMachineHasNodeReadyCondition(machine); err != nil {
 			return nil, fmt.Errorf("failed to set nodeReady condition on machine: %v", err)
 		}
+		if err := r.deleteBootstrapToken(machine.Name); err != nil {
+			return nil, fmt.Errorf("failed to invalidate bootstrap token of machine: %v", err)
+		}
+		if nodeInterrupted(node) {
+			return r.handleInstanceInterrupted(machine)
+		}
+		if r.instanceCheckDue(machine) {
+			if result, err := r.checkInstanceExists(prov, machine); result != nil || err != nil {
+				return result, err
+			}
+		}
 	} else {
 		// Node is not ready anymore? Maybe it got deleted
-		return r.ensureInstanceExistsForMachine(prov, machine, userdataPlugin, providerConfig)
+		return r.ensureInstanceExistsForMachine(ctx, prov, machine, userdataPlugin, providerConfig)
 	}
 
 	// case 3.3: if the node exists make sure if it has labels and taints attached to it.
-	return nil, r.ensureNodeLabelsAnnotationsAndTaints(node, machine)
+	if err := r.ensureNodeLabelsAnnotationsAndTaints(node, machine); err != nil {
+		return nil, err
+	}
+	if r.instanceCheckInterval > 0 {
+		// Nothing else triggers a sync while the node stays ready
+		return &reconcile.Result{RequeueAfter: r.instanceCheckInterval}, nil
+	}
+	return nil, nil
+}
+
+// userdataProvider returns the provider rendering the userdata of the given machine, which is either
+// its OperatingSystemProfile or the userdata plugin of its operating system and bootstrap flavor.
+func (r *Reconciler) userdataProvider(machine *clusterv1alpha1.Machine, providerConfig *providerconfigtypes.Config) (userdata.Provider, error) {
+	if providerConfig.OperatingSystemProfile == "" {
+		userdataPlugin, err := r.userDataManager.ForOS(providerConfig.OperatingSystem, providerConfig.BootstrapFlavor)
+		if err != nil {
+			return nil, err
+		}
+		return userdataPlugin, nil
+	}
+
+	osp := &clusterv1alpha1.OperatingSystemProfile{}
+	if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: machine.Namespace, Name: providerConfig.OperatingSystemProfile}, osp); err != nil {
+		return nil, fmt.Errorf("failed to get operating system profile %q: %v", providerConfig.OperatingSystemProfile, err)
+	}
+	if err := profile.Validate(osp); err != nil {
+		return nil, err
+	}
+	return profile.New(osp), nil
 }
 
 func (r *Reconciler) ensureMachineHasNodeReadyCondition(machine *clusterv1alpha1.Machine) error {
@@ -452,6 +1082,7 @@ func (r *Reconciler) shouldEvict(machine *clusterv1alpha1.Machine) (bool, error)
 	// We assume here that the eviction is blocked by misconfiguration or a misbehaving kubelet and/or controller-runtime
 	if time.Since(machine.DeletionTimestamp.Time) > r.skipEvictionAfter {
 		klog.V(0).Infof("Skipping eviction for machine %q since the deletion got triggered %.2f minutes ago", machine.Name, r.skipEvictionAfter.Minutes())
+		r.recorder.Eventf(machine, corev1.EventTypeWarning, "EvictionSkipped", "Skipping the eviction since the deletion got triggered more than %s ago", r.skipEvictionAfter)
 		return false, nil
 	}
 
@@ -462,7 +1093,7 @@ func (r *Reconciler) shouldEvict(machine *clusterv1alpha1.Machine) (bool, error)
 	}
 
 	node := &corev1.Node{}
-	if err := r.client.Get(r.ctx, types.NamespacedName{Name: machine.Status.NodeRef.Name}, node); err != nil {
+	if err := r.targetClient.Get(r.ctx, types.NamespacedName{Name: machine.Status.NodeRef.Name}, node); err != nil {
 		// Node does not exist  - Nothing to evict
 		if kerrors.IsNotFound(err) {
 			klog.V(4).Infof("Skipping eviction for machine %q since it does not have a node", machine.Name)
@@ -475,17 +1106,15 @@ func (r *Reconciler) shouldEvict(machine *clusterv1alpha1.Machine) (bool, error)
 	// An eviction is possible when either:
 	// * There is at least one machine without a valid NodeRef because that means it probably just got created
 	// * There is at least one Node that is schedulable (`.Spec.Unschedulable == false`)
-	machines := &clusterv1alpha1.MachineList{}
-	if err := r.client.List(r.ctx, machines); err != nil {
+	machines, err := r.indexedMachines()
+	if err != nil {
 		return false, fmt.Errorf("failed to get machines from lister: %v", err)
 	}
-	for _, machine := range machines.Items {
-		if machine.Status.NodeRef == nil {
-			return true, nil
-		}
+	if len(machines.machinesWithoutNodeRef()) > 0 {
+		return true, nil
 	}
 	nodes := &corev1.NodeList{}
-	if err := r.client.List(r.ctx, nodes); err != nil {
+	if err := r.targetClient.List(r.ctx, nodes); err != nil {
 		return false, fmt.Errorf("failed to get nodes from lister: %v", err)
 	}
 	for _, node := range nodes.Items {
@@ -504,15 +1133,38 @@ func (r *Reconciler) shouldEvict(machine *clusterv1alpha1.Machine) (bool, error)
 	return false, nil
 }
 
+// IsDeleteProtected returns whether the machine has the AnnotationDeleteProtection. Controllers must not delete
+// protected machines, as their deletion doesn't finish until the annotation is removed.
+func IsDeleteProtected(machine *clusterv1alpha1.Machine) bool {
+	return machine.Annotations[AnnotationDeleteProtection] == "true"
+}
+
 // deleteMachine makes sure that an instance has gone in a series of steps.
 func (r *Reconciler) deleteMachine(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
+	if IsDeleteProtected(machine) {
+		// Removing the annotation triggers an update event, so there is no need to requeue
+		klog.V(3).Infof("Not deleting machine %q because it has the %q annotation", machine.Name, AnnotationDeleteProtection)
+		r.recorder.Eventf(machine, corev1.EventTypeWarning, "DeletionProtected", "Remove the %q annotation to delete the machine", AnnotationDeleteProtection)
+		return nil, nil
+	}
+
+	// Force deletions need an approval as well
+	if result, err := r.ensureApproved(machine, approval.OperationDelete, AnnotationDeletionApproved); result != nil || err != nil {
+		return result, err
+	}
+
+	if machine.Annotations[AnnotationForceDelete] == "true" && time.Since(machine.DeletionTimestamp.Time) > r.forceDeleteAfter {
+		return nil, r.forceDeleteMachine(machine)
+	}
+
 	shouldEvict, err := r.shouldEvict(machine)
 	if err != nil {
 		return nil, err
 	}
 
 	if shouldEvict {
-		evictedSomething, err := eviction.New(r.ctx, machine.Status.NodeRef.Name, r.client, r.kubeClient).Run()
+		r.recorder.Eventf(machine, corev1.EventTypeNormal, "Evicting", "Evicting the pods of node %s", machine.Status.NodeRef.Name)
+		evictedSomething, err := eviction.New(r.ctx, machine.Status.NodeRef.Name, r.targetClient, r.kubeClient).Run()
 		if err != nil {
 			return nil, fmt.Errorf("failed to evict node %s: %v", machine.Status.NodeRef.Name, err)
 		}
@@ -521,10 +1173,25 @@ func (r *Reconciler) deleteMachine(prov cloudprovidertypes.Provider, machine *cl
 		}
 	}
 
+	providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider config: %v", err)
+	}
+	// The etcd member must leave while its controller is still around to confirm it
+	if nodeRole(providerConfig) == providerconfigtypes.NodeRoleController && sets.NewString(machine.Finalizers...).Has(FinalizerDeleteInstance) {
+		if result, err := r.removeEtcdMember(machine); result != nil || err != nil {
+			return result, err
+		}
+	}
+
 	if result, err := r.deleteCloudProviderInstance(prov, machine); result != nil || err != nil {
 		return result, err
 	}
 
+	if err := r.deleteBootstrapToken(machine.Name); err != nil {
+		return nil, fmt.Errorf("failed to invalidate bootstrap token of machine: %v", err)
+	}
+
 	// Delete the node object only after the instance is gone, `deleteCloudProviderInstance`
 	// returns with a nil-error after it triggers the instance deletion but it is async for
 	// some providers hence the instance deletion may not been executed yet
@@ -537,6 +1204,27 @@ func (r *Reconciler) deleteMachine(prov cloudprovidertypes.Provider, machine *cl
 	return nil, r.deleteNodeForMachine(machine)
 }
 
+// forceDeleteMachine removes the finalizers of the machine without draining its node or deleting its
+// instance, which may have to be cleaned up manually.
+func (r *Reconciler) forceDeleteMachine(machine *clusterv1alpha1.Machine) error {
+	klog.Warningf("Force deleting machine %q since its deletion got triggered more than %.2f minutes ago", machine.Name, r.forceDeleteAfter.Minutes())
+	r.recorder.Eventf(machine, corev1.EventTypeWarning, "ForceDeleted",
+		"Removing finalizers since the deletion did not finish within %s, the instance may have to be deleted manually", r.forceDeleteAfter)
+
+	// The node is only an API object, so it can be deleted even if the cloud provider is unavailable
+	if err := r.deleteNodeForMachine(machine); err != nil {
+		klog.Errorf("Failed to delete node of force deleted machine %q: %v", machine.Name, err)
+	}
+	if err := rhsm.RemoveRHELSubscriptionFinalizer(machine, r.updateMachine); err != nil {
+		return fmt.Errorf("failed to remove redhat subscription finalizer: %v", err)
+	}
+	return r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+		finalizers := sets.NewString(m.Finalizers...)
+		finalizers.Delete(FinalizerDeleteInstance, FinalizerDeleteNode)
+		m.Finalizers = finalizers.List()
+	})
+}
+
 func (r *Reconciler) deleteCloudProviderInstance(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
 	finalizers := sets.NewString(machine.Finalizers...)
 	if !finalizers.Has(FinalizerDeleteInstance) {
@@ -544,6 +1232,7 @@ func (r *Reconciler) deleteCloudProviderInstance(prov cloudprovidertypes.Provide
 	}
 
 	// Delete the instance
+	r.recorder.Event(machine, corev1.EventTypeNormal, "Deleting", "Deleting instance")
 	completelyGone, err := prov.Cleanup(machine, r.providerData)
 	if err != nil {
 		message := fmt.Sprintf("%v. Please manually delete %s finalizer from the machine object.", err, FinalizerDeleteInstance)
@@ -554,6 +1243,12 @@ func (r *Reconciler) deleteCloudProviderInstance(prov cloudprovidertypes.Provide
 		// As the instance is not completely gone yet, we need to recheck in a few seconds.
 		return &reconcile.Result{RequeueAfter: deletionRetryWaitPeriod}, nil
 	}
+	r.recorder.Event(machine, corev1.EventTypeNormal, "Deleted", "Successfully deleted instance")
+	if r.nodeDNS != nil {
+		if err := r.nodeDNS.Deregister(r.ctx, machine.Name); err != nil {
+			return nil, err
+		}
+	}
 
 	machineConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
 	if err != nil {
@@ -608,7 +1303,7 @@ func (r *Reconciler) deleteNodeForMachine(machine *clusterv1alpha1.Machine) erro
 		objKey := ctrlruntimeclient.ObjectKey{Name: machine.Status.NodeRef.Name}
 		node := &corev1.Node{}
 		nodeFound := true
-		if err := r.client.Get(r.ctx, objKey, node); err != nil {
+		if err := r.targetClient.Get(r.ctx, objKey, node); err != nil {
 			if !kerrors.IsNotFound(err) {
 				return fmt.Errorf("failed to get node %s: %v", machine.Status.NodeRef.Name, err)
 			}
@@ -617,11 +1312,13 @@ func (r *Reconciler) deleteNodeForMachine(machine *clusterv1alpha1.Machine) erro
 		}
 
 		if nodeFound {
-			if err := r.client.Delete(r.ctx, node); err != nil {
+			if err := r.targetClient.Delete(r.ctx, node); err != nil {
 				if !kerrors.IsNotFound(err) {
 					return err
 				}
 				klog.V(2).Infof("node %q does not longer exist for machine %q", machine.Status.NodeRef.Name, machine.Spec.Name)
+			} else {
+				r.recorder.Eventf(machine, corev1.EventTypeNormal, "NodeDeleted", "Deleted node %s", node.Name)
 			}
 		}
 	} else {
@@ -631,7 +1328,7 @@ func (r *Reconciler) deleteNodeForMachine(machine *clusterv1alpha1.Machine) erro
 		}
 		listOpts := &ctrlruntimeclient.ListOptions{LabelSelector: selector}
 		nodes := &corev1.NodeList{}
-		if err := r.client.List(r.ctx, nodes, listOpts); err != nil {
+		if err := r.targetClient.List(r.ctx, nodes, listOpts); err != nil {
 			return fmt.Errorf("failed to list nodes: %v", err)
 		}
 		if len(nodes.Items) == 0 {
@@ -641,9 +1338,10 @@ func (r *Reconciler) deleteNodeForMachine(machine *clusterv1alpha1.Machine) erro
 		}
 
 		for _, node := range nodes.Items {
-			if err := r.client.Delete(r.ctx, &node); err != nil {
+			if err := r.targetClient.Delete(r.ctx, &node); err != nil {
 				return err
 			}
+			r.recorder.Eventf(machine, corev1.EventTypeNormal, "NodeDeleted", "Deleted node %s", node.Name)
 		}
 	}
 
@@ -658,34 +1356,131 @@ func (r *Reconciler) deleteNodeForMachine(machine *clusterv1alpha1.Machine) erro
 }
 
 func (r *Reconciler) ensureInstanceExistsForMachine(
-	prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine, userdataPlugin userdataplugin.Provider, providerConfig *providerconfigtypes.Config) (*reconcile.Result, error) {
+	ctx context.Context,
+	prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine, userdataPlugin userdata.Provider, providerConfig *providerconfigtypes.Config) (*reconcile.Result, error) {
 	klog.V(6).Infof("Requesting instance for machine '%s' from cloudprovider because no associated node with status ready found...", machine.Name)
 
 	providerInstance, err := prov.Get(machine, r.providerData)
+	r.recordInstanceLookup(machine, providerInstance, err)
+	err = cloudprovidererrors.Classify(err)
 
 	// case 2: retrieving instance from provider was not successful
 	if err != nil {
 
 		// case 2.1: instance was not found and we are going to create one
 		if err == cloudprovidererrors.ErrInstanceNotFound {
+			// A node of the instance joined already, so it got deleted outside of the machine-controller
+			if machine.Status.NodeRef != nil {
+				return r.handleInstanceGone(machine)
+			}
+			if instanceID := machine.Annotations[AnnotationAdoptInstance]; instanceID != "" {
+				return r.adoptInstance(prov, machine, instanceID)
+			}
+			// Dry-runs create nothing, their userdata can be inspected before the creation is approved
+			dryRun := r.isDryRun(machine)
+			if !dryRun {
+				if result, err := r.ensureApproved(machine, approval.OperationCreate, AnnotationCreationApproved); result != nil || err != nil {
+					return result, err
+				}
+			}
 			klog.V(3).Infof("Validated machine spec of %s", machine.Name)
 
-			kubeconfig, err := r.createBootstrapKubeconfig(machine.Name)
+			joinsK0s := bootstrapFlavor(providerConfig) == providerconfigtypes.BootstrapFlavorK0s && nodeRole(providerConfig) != providerconfigtypes.NodeRoleSingle
+			var kubeconfig *clientcmdapi.Config
+			var k0sJoinToken string
+			switch {
+			case joinsK0s && r.k0sTokens != nil:
+				k0sJoinToken, kubeconfig, err = r.mintK0sJoinToken(machine.Name, nodeRole(providerConfig))
+			case nodeRole(providerConfig) == providerconfigtypes.NodeRoleController:
+				kubeconfig, err = r.createControllerJoinKubeconfig(machine.Name)
+			case nodeRole(providerConfig) == providerconfigtypes.NodeRoleSingle:
+				// Single nodes run a cluster of their own, they get no token of this one
+				kubeconfig, err = r.kubeconfigProvider.GetKubeconfig()
+			default:
+				kubeconfig, err = r.createBootstrapKubeconfig(machine.Name)
+			}
 			if err != nil {
 				return nil, fmt.Errorf("failed to create bootstrap kubeconfig: %v", err)
 			}
+			joinAddresses := providerConfig.JoinAddresses
+			discoveredJoinAddresses := r.discoveredJoinAddresses(providerConfig)
+			if len(discoveredJoinAddresses) > 0 {
+				joinAddresses = discoveredJoinAddresses
+			}
+			if len(joinAddresses) > 0 {
+				// With several addresses, the userdata switches to the first one which responds on boot
+				kubeconfig = kubeconfigWithServer(kubeconfig, joinAddresses[0])
+				// The join token gets encoded again with the address
+				k0sJoinToken = ""
+			}
 
 			cloudConfig, cloudProviderName, err := prov.GetCloudConfig(machine.Spec)
 			if err != nil {
 				return nil, fmt.Errorf("failed to render cloud config: %v", err)
 			}
 
+			if joinsK0s && k0sJoinToken == "" {
+				k0sJoinToken, err = createK0sJoinToken(kubeconfig)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create k0s join token: %v", err)
+				}
+			}
+
+			machineSpec := machine.Spec
+			if providerConfig.OperatingSystem == providerconfigtypes.OperatingSystemRHEL {
+				machineSpec, err = resolveRHELSubscriptionConfigVars(r.configVarResolver(machine), machine.Spec, providerConfig)
+				if err != nil {
+					return nil, fmt.Errorf("failed to resolve rhel subscription settings: %v", err)
+				}
+			}
+			if len(providerConfig.RegistryCredentials) > 0 || providerConfig.CABundle != nil ||
+				len(providerConfig.Files) > 0 || len(providerConfig.SystemdUnits) > 0 || len(providerConfig.StaticPods) > 0 ||
+				len(providerConfig.AddOns) > 0 {
+				machineSpec, err = resolveNodeConfigVars(r.configVarResolver(machine), machineSpec)
+				if err != nil {
+					return nil, fmt.Errorf("failed to resolve node settings: %v", err)
+				}
+			}
+			if len(providerConfig.AddOns) > 0 {
+				machineSpec, err = applyAddOns(machineSpec, bootstrapFlavor(providerConfig))
+				if err != nil {
+					return nil, fmt.Errorf("failed to apply add-ons: %v", err)
+				}
+			}
+			machineSpec, err = r.defaultKubeletSettings(machineSpec)
+			if err != nil {
+				return nil, fmt.Errorf("failed to default kubelet settings: %v", err)
+			}
+			if ssh.Disabled() {
+				machineSpec, err = removeSSHPublicKeys(machineSpec)
+				if err != nil {
+					return nil, fmt.Errorf("failed to remove the ssh public keys: %v", err)
+				}
+			} else {
+				machineSpec, err = r.addNamespaceSSHPublicKeys(machine.Namespace, machineSpec)
+				if err != nil {
+					return nil, fmt.Errorf("failed to add the ssh public keys of namespace %s: %v", machine.Namespace, err)
+				}
+			}
+
+			machineSpec, err = r.allocateStaticAddress(machine, machineSpec)
+			if err != nil {
+				return nil, fmt.Errorf("failed to allocate a static address: %v", err)
+			}
+			if len(discoveredJoinAddresses) > 0 {
+				machineSpec, err = withJoinAddresses(machineSpec, discoveredJoinAddresses)
+				if err != nil {
+					return nil, fmt.Errorf("failed to set the join addresses: %v", err)
+				}
+			}
+
+			httpProxy, httpsProxy, noProxy := r.proxySettings(providerConfig)
 			req := plugin.UserDataRequest{
-				MachineSpec:           machine.Spec,
+				MachineSpec:           machineSpec,
 				Kubeconfig:            kubeconfig,
 				CloudConfig:           cloudConfig,
 				CloudProviderName:     cloudProviderName,
-				ExternalCloudProvider: r.externalCloudProvider,
+				ExternalCloudProvider: r.isExternalCloudProvider(providerConfig),
 				DNSIPs:                r.nodeSettings.ClusterDNSIPs,
 				InsecureRegistries:    r.nodeSettings.InsecureRegistries,
 				RegistryMirrors:       r.nodeSettings.RegistryMirrors,
@@ -693,15 +1488,28 @@ func (r *Reconciler) ensureInstanceExistsForMachine(
 				HyperkubeImage:        r.nodeSettings.HyperkubeImage,
 				KubeletRepository:     r.nodeSettings.KubeletRepository,
 				KubeletFeatureGates:   r.nodeSettings.KubeletFeatureGates,
-				NoProxy:               r.nodeSettings.NoProxy,
-				HTTPProxy:             r.nodeSettings.HTTPProxy,
+				NoProxy:               noProxy,
+				HTTPProxy:             httpProxy,
+				HTTPSProxy:            httpsProxy,
+				K0sJoinToken:          k0sJoinToken,
+				K0sReleaseURL:         r.nodeSettings.K0sReleaseURL,
 			}
 			userdata, err := userdataPlugin.UserData(req)
 			if err != nil {
 				return nil, fmt.Errorf("failed get userdata: %v", err)
 			}
-
-			// Create the instance
+			if dryRun {
+				return r.dryRunCreate(prov, machine, userdata, kubeconfig, k0sJoinToken)
+			}
+			if providerConfig.FetchUserDataOnBoot {
+				userdata, err = r.userdataStub(machine, providerConfig.OperatingSystem, userdata)
+				if err != nil {
+					message := fmt.Sprintf("%v. Unable to create a machine.", err)
+					return nil, r.updateMachineErrorIfTerminalError(machine, common.CreateMachineError, message, err, "failed to stub userdata")
+				}
+			}
+
+			// Create the instance
 			if _, err = r.createProviderInstance(prov, machine, userdata); err != nil {
 				message := fmt.Sprintf("%v. Unable to create a machine.", err)
 				return nil, r.updateMachineErrorIfTerminalError(machine, common.CreateMachineError, message, err, "failed to create machine at cloudprovider")
@@ -711,6 +1519,20 @@ func (r *Reconciler) ensureInstanceExistsForMachine(
 					return nil, fmt.Errorf("failed to add redhat subscription finalizer: %v", err)
 				}
 			}
+			if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+				if m.Annotations == nil {
+					m.Annotations = map[string]string{}
+				}
+				m.Annotations[AnnotationInstanceCreationTimestamp] = time.Now().UTC().Format(time.RFC3339)
+				delete(m.Annotations, AnnotationCreationApproved)
+				if len(discoveredJoinAddresses) > 0 {
+					m.Annotations[AnnotationK0sJoinAddresses] = strings.Join(discoveredJoinAddresses, ",")
+				} else {
+					delete(m.Annotations, AnnotationK0sJoinAddresses)
+				}
+			}); err != nil {
+				return nil, fmt.Errorf("failed to update machine after setting the instance creation timestamp: %v", err)
+			}
 			r.recorder.Event(machine, corev1.EventTypeNormal, "Created", "Successfully created instance")
 			klog.V(3).Infof("Created machine %s at cloud provider", machine.Name)
 			// Reqeue the machine to make sure we notice if creation failed silently
@@ -733,23 +1555,343 @@ func (r *Reconciler) ensureInstanceExistsForMachine(
 	}
 
 	// case 3: retrieving the instance from cloudprovider was successful
+	if machine.Status.NodeRef != nil && instanceInterrupted(providerInstance) {
+		return r.handleInstanceInterrupted(machine)
+	}
 	// Emit an event and update .Status.Addresses
 	addresses := providerInstance.Addresses()
 	eventMessage := fmt.Sprintf("Found instance at cloud provider, addresses: %v", addresses)
 	r.recorder.Event(machine, corev1.EventTypeNormal, "InstanceFound", eventMessage)
+	if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+		m.Status.Addresses = machineAddresses(addresses)
+		m.Status.ProviderStatus = withInstanceProviderStatus(m.Status.ProviderStatus, providerInstance)
+		m.Status.InstanceMetadata = instanceMetadata(providerInstance)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update machine after setting .status.addresses: %v", err)
+	}
+	if r.cloudConfigPublisher != nil && r.isExternalCloudProvider(providerConfig) {
+		cloudConfig, cloudProviderName, err := prov.GetCloudConfig(machine.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render cloud config: %v", err)
+		}
+		if err := r.cloudConfigPublisher.publish(cloudProviderName, cloudConfig); err != nil {
+			return nil, fmt.Errorf("failed to publish cloud config: %v", err)
+		}
+	}
+	if r.nodeDNS != nil {
+		if err := r.nodeDNS.Register(ctx, machine.Name, machineAddresses(addresses)); err != nil {
+			return nil, err
+		}
+	}
+	if result, err := r.refreshJoinAddresses(prov, machine); result != nil || err != nil {
+		return result, err
+	}
+	// The node of a single node cluster never joins this one, so there is no node to match or to wait for
+	if nodeRole(providerConfig) == providerconfigtypes.NodeRoleSingle {
+		if r.instanceCheckInterval > 0 {
+			return &reconcile.Result{RequeueAfter: r.instanceCheckInterval}, nil
+		}
+		return nil, nil
+	}
+	_, nodeSpan := tracing.Start(ctx, "EnsureNode")
+	result, err := r.ensureNodeOwnerRefAndConfigSource(prov, providerInstance, machine, providerConfig)
+	nodeSpan.End(err)
+	return result, err
+}
+
+// addressTypeOrder is the order of the addresses in the machine status, which matches the one of the
+// kubelet for node addresses
+var addressTypeOrder = map[corev1.NodeAddressType]int{
+	corev1.NodeInternalIP:  1,
+	corev1.NodeExternalIP:  2,
+	corev1.NodeInternalDNS: 3,
+	corev1.NodeExternalDNS: 4,
+	corev1.NodeHostName:    5,
+}
+
+// machineAddresses returns the given instance addresses sorted by their type and address, so
+// the status of the machine does not change on every reconciliation.
+func machineAddresses(addresses map[string]corev1.NodeAddressType) []corev1.NodeAddress {
 	machineAddresses := []corev1.NodeAddress{}
 	for address, addressType := range addresses {
 		machineAddresses = append(machineAddresses, corev1.NodeAddress{Address: address, Type: addressType})
 	}
-	if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
-		m.Status.Addresses = machineAddresses
-	}); err != nil {
-		return nil, fmt.Errorf("failed to update machine after setting .status.addresses: %v", err)
+	sort.Slice(machineAddresses, func(i, j int) bool {
+		if machineAddresses[i].Type != machineAddresses[j].Type {
+			return addressTypeOrder[machineAddresses[i].Type] < addressTypeOrder[machineAddresses[j].Type]
+		}
+		return machineAddresses[i].Address < machineAddresses[j].Address
+	})
+	return machineAddresses
+}
+
+// proxySettings returns the HTTP, HTTPS and no proxy settings of the node. The proxy
+// settings of the machine replace the node-wide ones.
+func (r *Reconciler) proxySettings(providerConfig *providerconfigtypes.Config) (string, string, string) {
+	httpProxy, httpsProxy, noProxy := r.nodeSettings.HTTPProxy, "", r.nodeSettings.NoProxy
+	if proxy := providerConfig.Proxy; proxy != nil {
+		httpProxy, httpsProxy, noProxy = proxy.HTTPProxy, proxy.HTTPSProxy, proxy.NoProxy
+	}
+	if httpsProxy == "" {
+		httpsProxy = httpProxy
+	}
+	return httpProxy, httpsProxy, noProxy
+}
+
+// isExternalCloudProvider returns whether the kubelet of the given machine runs with
+// --cloud-provider=external. The setting of the machine takes precedence.
+func (r *Reconciler) isExternalCloudProvider(providerConfig *providerconfigtypes.Config) bool {
+	if providerConfig.ExternalCloudProvider != nil {
+		return *providerConfig.ExternalCloudProvider
+	}
+	return r.externalCloudProvider
+}
+
+// defaultKubeletSettings returns a copy of the given machine spec with the node-wide
+// kubelet resource reservations and eviction thresholds set, unless the machine
+// configures them itself or through a k0s worker profile.
+func (r *Reconciler) defaultKubeletSettings(spec clusterv1alpha1.MachineSpec) (clusterv1alpha1.MachineSpec, error) {
+	if len(r.nodeSettings.KubeReserved) == 0 && len(r.nodeSettings.SystemReserved) == 0 && len(r.nodeSettings.EvictionHard) == 0 {
+		return spec, nil
+	}
+
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get provider config: %v", err)
+	}
+	if providerConfig.WorkerProfile != "" {
+		return spec, nil
+	}
+
+	if providerConfig.Kubelet == nil {
+		providerConfig.Kubelet = &providerconfigtypes.KubeletSettings{}
+	}
+	if len(providerConfig.Kubelet.KubeReserved) == 0 {
+		providerConfig.Kubelet.KubeReserved = r.nodeSettings.KubeReserved
+	}
+	if len(providerConfig.Kubelet.SystemReserved) == 0 {
+		providerConfig.Kubelet.SystemReserved = r.nodeSettings.SystemReserved
+	}
+	if len(providerConfig.Kubelet.EvictionHard) == 0 {
+		providerConfig.Kubelet.EvictionHard = r.nodeSettings.EvictionHard
+	}
+
+	rawConfig, err := json.Marshal(providerConfig)
+	if err != nil {
+		return spec, fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+
+	defaultedSpec := spec.DeepCopy()
+	defaultedSpec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return *defaultedSpec, nil
+}
+
+// addNamespaceSSHPublicKeys adds the keys of the SSHPublicKeysSecretName secret in the given namespace to
+// the SSH public keys of the spec, so the keys of all machines of a team can be managed in one place.
+func (r *Reconciler) addNamespaceSSHPublicKeys(namespace string, spec clusterv1alpha1.MachineSpec) (clusterv1alpha1.MachineSpec, error) {
+	secret := &corev1.Secret{}
+	if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: namespace, Name: SSHPublicKeysSecretName}, secret); err != nil {
+		if kerrors.IsNotFound(err) {
+			return spec, nil
+		}
+		return spec, fmt.Errorf("failed to get secret %s: %v", SSHPublicKeysSecretName, err)
+	}
+
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get provider config: %v", err)
+	}
+	keys := sets.NewString(providerConfig.SSHPublicKeys...)
+	names := make([]string, 0, len(secret.Data))
+	for name := range secret.Data {
+		names = append(names, name)
+	}
+	// Keep the order of the keys stable, so the userdata only changes with the keys
+	sort.Strings(names)
+	for _, name := range names {
+		for _, key := range strings.Split(string(secret.Data[name]), "\n") {
+			key = strings.TrimSpace(key)
+			if key == "" || strings.HasPrefix(key, "#") || keys.Has(key) {
+				continue
+			}
+			keys.Insert(key)
+			providerConfig.SSHPublicKeys = append(providerConfig.SSHPublicKeys, key)
+		}
+	}
+
+	rawConfig, err := json.Marshal(providerConfig)
+	if err != nil {
+		return spec, fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+	updatedSpec := spec.DeepCopy()
+	updatedSpec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return *updatedSpec, nil
+}
+
+// removeSSHPublicKeys removes the SSH public keys of the spec, so none end up in the userdata
+// if SSH access to instances is disabled.
+func removeSSHPublicKeys(spec clusterv1alpha1.MachineSpec) (clusterv1alpha1.MachineSpec, error) {
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get provider config: %v", err)
 	}
-	return r.ensureNodeOwnerRefAndConfigSource(providerInstance, machine, providerConfig)
+	if len(providerConfig.SSHPublicKeys) == 0 {
+		return spec, nil
+	}
+	providerConfig.SSHPublicKeys = nil
+
+	rawConfig, err := json.Marshal(providerConfig)
+	if err != nil {
+		return spec, fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+	updatedSpec := spec.DeepCopy()
+	updatedSpec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return *updatedSpec, nil
 }
 
-func (r *Reconciler) ensureNodeOwnerRefAndConfigSource(providerInstance instance.Instance, machine *clusterv1alpha1.Machine, providerConfig *providerconfigtypes.Config) (*reconcile.Result, error) {
+// applyAddOns returns a copy of the given machine spec with the files and systemd units of its
+// add-ons added, whose settings must have been resolved already.
+func applyAddOns(spec clusterv1alpha1.MachineSpec, flavor providerconfigtypes.BootstrapFlavor) (clusterv1alpha1.MachineSpec, error) {
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get provider config: %v", err)
+	}
+	if err := addons.Apply(providerConfig, flavor); err != nil {
+		return spec, err
+	}
+
+	rawConfig, err := json.Marshal(providerConfig)
+	if err != nil {
+		return spec, fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+	updatedSpec := spec.DeepCopy()
+	updatedSpec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return *updatedSpec, nil
+}
+
+// bootstrapFlavor returns the bootstrap flavor of the given provider config,
+// defaulting to the one of its operating system.
+func bootstrapFlavor(providerConfig *providerconfigtypes.Config) providerconfigtypes.BootstrapFlavor {
+	if providerConfig.BootstrapFlavor != "" {
+		return providerConfig.BootstrapFlavor
+	}
+	return userdatamanager.DefaultBootstrapFlavor(providerConfig.OperatingSystem)
+}
+
+// resolveNodeConfigVars returns a copy of the given machine spec with the secret and
+// configmap references of the registry credentials, the CA bundle, the files, the
+// systemd units, the static pods and the settings of the add-ons replaced by their values.
+func resolveNodeConfigVars(resolver *providerconfig.ConfigVarResolver, spec clusterv1alpha1.MachineSpec) (clusterv1alpha1.MachineSpec, error) {
+	providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get provider config: %v", err)
+	}
+
+	credentials := map[string]providerconfigtypes.RegistryCredentials{}
+	for registry, c := range providerConfig.RegistryCredentials {
+		username, err := resolver.GetConfigVarStringValue(c.Username)
+		if err != nil {
+			return spec, fmt.Errorf("failed to get the username of registry %q: %v", registry, err)
+		}
+		password, err := resolver.GetConfigVarStringValue(c.Password)
+		if err != nil {
+			return spec, fmt.Errorf("failed to get the password of registry %q: %v", registry, err)
+		}
+		credentials[registry] = providerconfigtypes.RegistryCredentials{
+			Username: providerconfigtypes.ConfigVarString{Value: username},
+			Password: providerconfigtypes.ConfigVarString{Value: password},
+		}
+	}
+	providerConfig.RegistryCredentials = credentials
+
+	if providerConfig.CABundle != nil {
+		caBundle, err := resolver.GetConfigVarStringValue(*providerConfig.CABundle)
+		if err != nil {
+			return spec, fmt.Errorf("failed to get the value of \"caBundle\" field, error = %v", err)
+		}
+		providerConfig.CABundle = &providerconfigtypes.ConfigVarString{Value: caBundle}
+	}
+
+	for i, file := range providerConfig.Files {
+		content, err := resolver.GetConfigVarStringValue(file.Content)
+		if err != nil {
+			return spec, fmt.Errorf("failed to get the content of file %q: %v", file.Path, err)
+		}
+		providerConfig.Files[i].Content = providerconfigtypes.ConfigVarString{Value: content}
+	}
+	for i, unit := range providerConfig.SystemdUnits {
+		content, err := resolver.GetConfigVarStringValue(unit.Content)
+		if err != nil {
+			return spec, fmt.Errorf("failed to get the content of systemd unit %q: %v", unit.Name, err)
+		}
+		providerConfig.SystemdUnits[i].Content = providerconfigtypes.ConfigVarString{Value: content}
+	}
+	for i, pod := range providerConfig.StaticPods {
+		manifest, err := resolver.GetConfigVarStringValue(pod.Manifest)
+		if err != nil {
+			return spec, fmt.Errorf("failed to get the manifest of static pod %q: %v", pod.Name, err)
+		}
+		providerConfig.StaticPods[i].Manifest = providerconfigtypes.ConfigVarString{Value: manifest}
+	}
+	for i, addOn := range providerConfig.AddOns {
+		settings := map[string]providerconfigtypes.ConfigVarString{}
+		for name, setting := range addOn.Settings {
+			value, err := resolver.GetConfigVarStringValue(setting)
+			if err != nil {
+				return spec, fmt.Errorf("failed to get the setting %q of add-on %q: %v", name, addOn.Name, err)
+			}
+			settings[name] = providerconfigtypes.ConfigVarString{Value: value}
+		}
+		providerConfig.AddOns[i].Settings = settings
+	}
+
+	rawConfig, err := json.Marshal(providerConfig)
+	if err != nil {
+		return spec, fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+
+	resolvedSpec := spec.DeepCopy()
+	resolvedSpec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return *resolvedSpec, nil
+}
+
+// resolveRHELSubscriptionConfigVars returns a copy of the given machine spec with the
+// secret and configmap references of the RHEL subscription settings replaced by their
+// values, as the userdata plugins have no access to the cluster.
+func resolveRHELSubscriptionConfigVars(resolver *providerconfig.ConfigVarResolver, spec clusterv1alpha1.MachineSpec, providerConfig *providerconfigtypes.Config) (clusterv1alpha1.MachineSpec, error) {
+	rhelConfig, err := rhel.LoadConfig(providerConfig.OperatingSystemSpec)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get rhel os specs: %v", err)
+	}
+
+	organizationName, err := resolver.GetConfigVarStringValue(rhelConfig.RHELOrganizationName)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get the value of \"rhelOrganizationName\" field, error = %v", err)
+	}
+	activationKey, err := resolver.GetConfigVarStringValue(rhelConfig.RHELActivationKey)
+	if err != nil {
+		return spec, fmt.Errorf("failed to get the value of \"rhelActivationKey\" field, error = %v", err)
+	}
+	rhelConfig.RHELOrganizationName = providerconfigtypes.ConfigVarString{Value: organizationName}
+	rhelConfig.RHELActivationKey = providerconfigtypes.ConfigVarString{Value: activationKey}
+
+	osSpec, err := rhelConfig.Spec()
+	if err != nil {
+		return spec, fmt.Errorf("failed to marshal rhel os specs: %v", err)
+	}
+	resolvedConfig := *providerConfig
+	resolvedConfig.OperatingSystemSpec = *osSpec
+	rawConfig, err := json.Marshal(resolvedConfig)
+	if err != nil {
+		return spec, fmt.Errorf("failed to marshal provider config: %v", err)
+	}
+
+	resolvedSpec := spec.DeepCopy()
+	resolvedSpec.ProviderSpec.Value = &runtime.RawExtension{Raw: rawConfig}
+	return *resolvedSpec, nil
+}
+
+func (r *Reconciler) ensureNodeOwnerRefAndConfigSource(prov cloudprovidertypes.Provider, providerInstance instance.Instance, machine *clusterv1alpha1.Machine, providerConfig *providerconfigtypes.Config) (*reconcile.Result, error) {
 	node, exists, err := r.getNode(providerInstance, providerConfig.CloudProvider)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get node for machine %s: %v", machine.Name, err)
@@ -764,6 +1906,24 @@ func (r *Reconciler) ensureNodeOwnerRefAndConfigSource(providerInstance instance
 			}
 		}
 
+		// Without a cloud controller manager nothing sets the provider ID, which is needed to
+		// correlate the node with its instance, e.g. by the cluster-autoscaler and CSI drivers
+		if providerID, ok := nodeProviderID(providerInstance, providerConfig.CloudProvider); ok && node.Spec.ProviderID == "" {
+			if err := r.updateNode(node, func(n *corev1.Node) {
+				n.Spec.ProviderID = providerID
+			}); err != nil {
+				return nil, fmt.Errorf("failed to update node %s after setting the provider ID: %v", node.Name, err)
+			}
+			klog.V(3).Infof("Set provider ID %s on node %s (machine %s)", providerID, node.Name, machine.Name)
+		}
+		if machine.Spec.ProviderID == nil && node.Spec.ProviderID != "" {
+			if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+				m.Spec.ProviderID = &node.Spec.ProviderID
+			}); err != nil {
+				return nil, fmt.Errorf("failed to update machine after setting the provider ID: %v", err)
+			}
+		}
+
 		if node.Spec.ConfigSource == nil && machine.Spec.ConfigSource != nil {
 			if err := r.updateNode(node, func(n *corev1.Node) {
 				n.Spec.ConfigSource = machine.Spec.ConfigSource
@@ -776,24 +1936,273 @@ func (r *Reconciler) ensureNodeOwnerRefAndConfigSource(providerInstance instance
 			return nil, fmt.Errorf("failed to update machine status: %v", err)
 		}
 	} else {
-		// If the machine has an owner Ref and joinClusterTimeout is configured and reached, delete it to have it re-created by the MachineSet controller
-		// Check if the machine is a potential candidate for triggering deletion
-		if r.joinClusterTimeout != nil && ownerReferencesHasMachineSetKind(machine.OwnerReferences) {
-			if time.Since(machine.CreationTimestamp.Time) > *r.joinClusterTimeout {
+		// If joinClusterTimeout is configured and reached, machines owned by a MachineSet get deleted to have them re-created by
+		// the MachineSet controller, other machines are marked as failed
+		if r.joinClusterTimeout != nil {
+			if remaining := *r.joinClusterTimeout - time.Since(instanceCreationTime(machine)); remaining >= 0 {
+				// The node informer enqueues the machine once its node joins. Re-enqueue it for the timeout,
+				// because if it never joins the cluster nothing will trigger another sync on it
+				return &reconcile.Result{RequeueAfter: remaining + time.Second}, nil
+			}
+			// Protected machines are marked as failed instead, their deletion would not finish
+			if ownerReferencesHasMachineSetKind(machine.OwnerReferences) && !IsDeleteProtected(machine) {
 				klog.V(3).Infof("Join cluster timeout expired for machine %s, deleting it", machine.Name)
+				// The error makes the MachineSet controller count the machine as failed provisioning
+				if err := r.updateMachineError(machine, common.JoinClusterTimeoutMachineError, r.joinClusterTimeoutMessage()); err != nil {
+					return nil, fmt.Errorf("failed to update machine error: %v", err)
+				}
 				if err := r.client.Delete(r.ctx, machine); err != nil {
 					return nil, fmt.Errorf("failed to delete machine %s/%s that didn't join cluster within expected period of %s: %v",
 						machine.Namespace, machine.Name, r.joinClusterTimeout.String(), err)
 				}
 				return nil, nil
 			}
-			// Re-enqueue the machine, because if it never joins the cluster nothing will trigger another sync on it once the timeout is reached
-			return &reconcile.Result{RequeueAfter: 1 * time.Minute}, nil
+			return r.handleJoinClusterTimeout(prov, machine)
+		}
+	}
+	return nil, nil
+}
+
+// joinClusterTimeoutMessage is the error of machines whose node did not join the cluster in time
+func (r *Reconciler) joinClusterTimeoutMessage() string {
+	return fmt.Sprintf("No node joined the cluster within %s after the instance got created", r.joinClusterTimeout.String())
+}
+
+// handleJoinClusterTimeout marks a machine without a MachineSet whose node did not join the cluster in time
+// as failed and recreates its instance if configured. The error is cleared once a node joins.
+func (r *Reconciler) handleJoinClusterTimeout(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
+	message := r.joinClusterTimeoutMessage()
+	if err := r.updateMachineError(machine, common.JoinClusterTimeoutMachineError, message); err != nil {
+		return nil, fmt.Errorf("failed to update machine error: %v", err)
+	}
+	if !r.joinClusterTimeoutRecreate {
+		// Returning an error keeps the error on the machine
+		return nil, errors.New(message)
+	}
+
+	klog.V(3).Infof("Join cluster timeout expired for machine %s, recreating its instance", machine.Name)
+	r.recorder.Eventf(machine, corev1.EventTypeWarning, "JoinClusterTimeout", "%s, recreating the instance", message)
+	completelyGone, err := prov.Cleanup(machine, r.providerData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete instance of machine %s that didn't join the cluster: %v", machine.Name, err)
+	}
+	if !completelyGone {
+		return &reconcile.Result{RequeueAfter: deletionRetryWaitPeriod}, nil
+	}
+	// The next reconciliation doesn't find the instance anymore and creates a new one
+	return &reconcile.Result{Requeue: true}, nil
+}
+
+// instanceCheckDue returns whether the instance of the given machine with a ready node should be looked up
+// at the cloud provider again, to notice when it gets deleted outside of the machine-controller.
+func (r *Reconciler) instanceCheckDue(machine *clusterv1alpha1.Machine) bool {
+	if r.instanceCheckInterval <= 0 {
+		return false
+	}
+	lastCheck, found := r.lastInstanceChecks.Load(types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name})
+	return !found || time.Since(lastCheck.(time.Time)) >= r.instanceCheckInterval
+}
+
+// checkInstanceExists looks up the instance of the given machine, whose node joined the cluster already,
+// at the cloud provider and handles it being gone.
+func (r *Reconciler) checkInstanceExists(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
+	providerInstance, err := prov.Get(machine, r.providerData)
+	r.recordInstanceLookup(machine, providerInstance, err)
+	if err != nil {
+		if err == cloudprovidererrors.ErrInstanceNotFound {
+			return r.handleInstanceGone(machine)
 		}
+		return nil, fmt.Errorf("failed to get instance from provider: %v", err)
 	}
+	if instanceInterrupted(providerInstance) {
+		return r.handleInstanceInterrupted(machine)
+	}
+	r.lastInstanceChecks.Store(types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name}, time.Now())
 	return nil, nil
 }
 
+// instanceInterrupted returns whether the cloud provider is reclaiming the given spot or preemptible instance
+func instanceInterrupted(providerInstance instance.Instance) bool {
+	interruptible, ok := providerInstance.(instance.InterruptibleInstance)
+	return ok && interruptible.Interrupted()
+}
+
+// nodeInterrupted returns whether the given node got tainted by a termination handler, like the
+// aws-node-termination-handler, on the interruption notice of its spot or preemptible instance
+func nodeInterrupted(node *corev1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if interruptionTaints.Has(taint.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInstanceInterrupted replaces a machine whose spot or preemptible instance gets reclaimed by the cloud
+// provider. Machines owned by a MachineSet get deleted, which drains their node, so the MachineSet creates a
+// new machine right away. Other machines only get an event, as they are not replaced.
+func (r *Reconciler) handleInstanceInterrupted(machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
+	if !ownerReferencesHasMachineSetKind(machine.OwnerReferences) || IsDeleteProtected(machine) {
+		r.recorder.Event(machine, corev1.EventTypeWarning, "InstanceInterrupted", "The cloud provider is reclaiming the instance")
+		return nil, nil
+	}
+	klog.V(3).Infof("Instance of machine %s gets reclaimed by the cloud provider, deleting the machine", machine.Name)
+	r.recorder.Event(machine, corev1.EventTypeWarning, "InstanceInterrupted", "The cloud provider is reclaiming the instance, deleting the machine to replace it")
+	if err := r.client.Delete(r.ctx, machine); err != nil {
+		return nil, fmt.Errorf("failed to delete machine %s/%s whose instance got interrupted: %v", machine.Namespace, machine.Name, err)
+	}
+	return nil, nil
+}
+
+// handleInstanceGone deletes the node of a machine whose instance got deleted outside of the machine-controller,
+// as it never comes back. The machine is marked as failed, or its instance gets recreated if configured.
+func (r *Reconciler) handleInstanceGone(machine *clusterv1alpha1.Machine) (*reconcile.Result, error) {
+	r.lastInstanceChecks.Delete(types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name})
+	message := "The instance of the machine got deleted at the cloud provider"
+	// Unlike deleteNodeForMachine this keeps the node finalizer, as a new instance registers a node again
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: machine.Status.NodeRef.Name}}
+	if err := r.targetClient.Delete(r.ctx, node); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to delete node %s: %v", node.Name, err)
+		}
+	} else {
+		r.recorder.Eventf(machine, corev1.EventTypeNormal, "NodeDeleted", "Deleted node %s", node.Name)
+	}
+
+	if !r.instanceGoneRecreate {
+		// updateMachineError emits the event, only once, as every retry ends up here again
+		if reason := machine.Status.ErrorReason; reason == nil || *reason != common.InstanceGoneMachineError {
+			if err := r.updateMachineError(machine, common.InstanceGoneMachineError, message); err != nil {
+				return nil, fmt.Errorf("failed to update machine error: %v", err)
+			}
+		}
+		// Returning an error keeps the error on the machine
+		return nil, errors.New(message)
+	}
+
+	klog.V(3).Infof("Instance of machine %s got deleted at the cloud provider, recreating it", machine.Name)
+	r.recorder.Eventf(machine, corev1.EventTypeWarning, "InstanceGone", "%s, recreating it", message)
+	// The next reconciliation creates a new instance
+	return &reconcile.Result{Requeue: true}, r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
+		delete(m.Annotations, AnnotationInstanceCreationTimestamp)
+		m.Status.NodeRef = nil
+	})
+}
+
+// applySpecChanges applies changes of the provider spec to the instance of the machine according to its
+// update strategy. The hash of the applied spec is kept in the AnnotationAppliedSpecHash annotation.
+func (r *Reconciler) applySpecChanges(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine, providerConfig *providerconfigtypes.Config) (*reconcile.Result, error) {
+	hash, err := specHash(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, err
+	}
+	appliedHash := machine.Annotations[AnnotationAppliedSpecHash]
+	if appliedHash == hash {
+		return nil, nil
+	}
+
+	setAppliedHash := func(m *clusterv1alpha1.Machine) {
+		if m.Annotations == nil {
+			m.Annotations = map[string]string{}
+		}
+		m.Annotations[AnnotationAppliedSpecHash] = hash
+	}
+
+	// Machines created before the annotation existed and machines without an instance conform to their spec.
+	// Changes of immutable machines only pass the webhook when it is bypassed, e.g. by the migrations
+	if appliedHash == "" || !HasInstance(machine) {
+		return nil, r.updateMachine(machine, setAppliedHash)
+	}
+
+	switch providerConfig.UpdateStrategy {
+	case providerconfigtypes.UpdateStrategyRecreate:
+		return r.recreateInstance(prov, machine, setAppliedHash)
+	case providerconfigtypes.UpdateStrategyInPlace:
+		done, err := prov.Update(machine, r.providerData)
+		if err == cloudprovidererrors.ErrUpdateNotSupported {
+			message := fmt.Sprintf("The cloud provider %s does not support the %s update strategy", providerConfig.CloudProvider, providerConfig.UpdateStrategy)
+			if err := r.updateMachineError(machine, common.UpdateMachineError, message); err != nil {
+				return nil, fmt.Errorf("failed to update machine error: %v", err)
+			}
+			// Returning an error keeps the error on the machine
+			return nil, errors.New(message)
+		}
+		if err != nil {
+			return nil, r.updateMachineErrorIfTerminalError(machine, common.UpdateMachineError, err.Error(), err, "failed to update instance")
+		}
+		if !done {
+			return &reconcile.Result{RequeueAfter: deletionRetryWaitPeriod}, nil
+		}
+		r.recorder.Event(machine, corev1.EventTypeNormal, "Updated", "Applied the changed spec to the instance")
+		return nil, r.updateMachine(machine, setAppliedHash)
+	default:
+		klog.V(3).Infof("Not applying the changed spec of machine %s since its update strategy is %s", machine.Name, providerconfigtypes.UpdateStrategyImmutable)
+		return nil, r.updateMachine(machine, setAppliedHash)
+	}
+}
+
+// recreateInstance drains the node of the machine and deletes its instance and node, so the next
+// reconciliation creates a new instance from the changed spec.
+func (r *Reconciler) recreateInstance(prov cloudprovidertypes.Provider, machine *clusterv1alpha1.Machine, setAppliedHash cloudprovidertypes.MachineModifier) (*reconcile.Result, error) {
+	// The instance finalizer is removed once the instance is gone, the node must not be evicted afterwards
+	if machine.Status.NodeRef != nil && sets.NewString(machine.Finalizers...).Has(FinalizerDeleteInstance) {
+		_, err := r.getNodeByNodeRef(machine.Status.NodeRef)
+		if err != nil && !kerrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get node %s: %v", machine.Status.NodeRef.Name, err)
+		}
+		if err == nil {
+			r.recorder.Eventf(machine, corev1.EventTypeNormal, "Evicting", "Evicting the pods of node %s", machine.Status.NodeRef.Name)
+			evictedSomething, err := eviction.New(r.ctx, machine.Status.NodeRef.Name, r.targetClient, r.kubeClient).Run()
+			if err != nil {
+				return nil, fmt.Errorf("failed to evict node %s: %v", machine.Status.NodeRef.Name, err)
+			}
+			if evictedSomething {
+				return &reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+		}
+	}
+
+	r.recorder.Event(machine, corev1.EventTypeNormal, "Recreating", "Recreating the instance since the spec changed")
+	if result, err := r.deleteCloudProviderInstance(prov, machine); result != nil || err != nil {
+		return result, err
+	}
+	if err := r.deleteNodeForMachine(machine); err != nil {
+		return nil, fmt.Errorf("failed to delete node of machine: %v", err)
+	}
+
+	// The next reconciliation creates a new instance
+	return &reconcile.Result{Requeue: true}, r.updateMachine(machine, setAppliedHash, func(m *clusterv1alpha1.Machine) {
+		delete(m.Annotations, AnnotationInstanceCreationTimestamp)
+		m.Status.NodeRef = nil
+	})
+}
+
+// specHash returns a hash of the provider spec which doesn't depend on the order of its fields.
+func specHash(spec clusterv1alpha1.ProviderSpec) (string, error) {
+	if spec.Value == nil {
+		return "", nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(spec.Value.Raw, &value); err != nil {
+		return "", fmt.Errorf("failed to unmarshal provider spec: %v", err)
+	}
+	// Maps are marshalled with sorted keys
+	normalized, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal provider spec: %v", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(normalized)), nil
+}
+
+// instanceCreationTime returns when the current instance of the machine was created, which is the creation of the
+// machine itself for machines created by older versions.
+func instanceCreationTime(machine *clusterv1alpha1.Machine) time.Time {
+	if created, err := time.Parse(time.RFC3339, machine.Annotations[AnnotationInstanceCreationTimestamp]); err == nil {
+		return created
+	}
+	return machine.CreationTimestamp.Time
+}
+
 func ownerReferencesHasMachineSetKind(ownerReferences []metav1.OwnerReference) bool {
 	for _, ownerReference := range ownerReferences {
 		if ownerReference.Kind == "MachineSet" {
@@ -879,12 +2288,18 @@ func (r *Reconciler) updateMachineStatus(machine *clusterv1alpha1.Machine, node
 	if !equality.Semantic.DeepEqual(machine.Status.NodeRef, ref) ||
 		machine.Status.Versions == nil ||
 		machine.Status.Versions.Kubelet != node.Status.NodeInfo.KubeletVersion {
+		joined := machine.Status.NodeRef == nil
 		if err := r.updateMachine(machine, func(m *clusterv1alpha1.Machine) {
 			m.Status.NodeRef = ref
 			m.Status.Versions = &clusterv1alpha1.MachineVersionInfo{Kubelet: node.Status.NodeInfo.KubeletVersion}
 		}); err != nil {
 			return fmt.Errorf("failed to update machine after setting its status: %v", err)
 		}
+		if created, err := time.Parse(time.RFC3339, machine.Annotations[AnnotationInstanceCreationTimestamp]); joined && err == nil {
+			if providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec); err == nil {
+				r.metrics.ProvisioningDuration.WithLabelValues(string(providerConfig.CloudProvider)).Observe(time.Since(created).Seconds())
+			}
+		}
 	}
 
 	return nil
@@ -894,22 +2309,27 @@ func (r *Reconciler) getNode(instance instance.Instance, provider providerconfig
 	if instance == nil {
 		return nil, false, fmt.Errorf("getNode called with nil provider instance")
 	}
-	nodes := &corev1.NodeList{}
-	if err := r.client.List(r.ctx, nodes); err != nil {
-		return nil, false, err
-	}
 
 	// We trim leading slashes in raw ID, since we always want three slashes in full ID
-	providerID := fmt.Sprintf("%s:///%s", provider, strings.TrimLeft(instance.ID(), "/"))
-	for _, node := range nodes.Items {
-		if provider == providerconfigtypes.CloudProviderAzure {
-			// Azure IDs are case-insensitive
-			if strings.EqualFold(node.Spec.ProviderID, providerID) {
-				return node.DeepCopy(), true, nil
-			}
-		} else {
-			if node.Spec.ProviderID == providerID {
-				return node.DeepCopy(), true, nil
+	providerIDs := []string{fmt.Sprintf("%s:///%s", provider, strings.TrimLeft(instance.ID(), "/"))}
+	if providerID, ok := nodeProviderID(instance, provider); ok {
+		providerIDs = append(providerIDs, providerID)
+	}
+	nodes, err := r.candidateNodes(providerIDs, instance)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, node := range nodes {
+		for _, providerID := range providerIDs {
+			if provider == providerconfigtypes.CloudProviderAzure {
+				// Azure IDs are case-insensitive
+				if strings.EqualFold(node.Spec.ProviderID, providerID) {
+					return node.DeepCopy(), true, nil
+				}
+			} else {
+				if node.Spec.ProviderID == providerID {
+					return node.DeepCopy(), true, nil
+				}
 			}
 		}
 		// If we were unable to find Node by ProviderID, fallback to IP address matching.
@@ -946,6 +2366,131 @@ func (r *Reconciler) getNode(instance instance.Instance, provider providerconfig
 	return nil, false, nil
 }
 
+// withInstanceProviderStatus returns the provider status with the ID and the status of the given instance.
+// The provider status is used by some cloud providers as well, so their fields are kept.
+func withInstanceProviderStatus(providerStatus *runtime.RawExtension, providerInstance instance.Instance) *runtime.RawExtension {
+	status := map[string]interface{}{}
+	if providerStatus != nil && len(providerStatus.Raw) > 0 {
+		if err := json.Unmarshal(providerStatus.Raw, &status); err != nil {
+			klog.Errorf("Failed to parse provider status, not updating it: %v", err)
+			return providerStatus
+		}
+	}
+	if id := providerInstance.ID(); id != "" {
+		status["instanceID"] = id
+	}
+	status["instanceStatus"] = string(providerInstance.Status())
+
+	raw, err := json.Marshal(status)
+	if err != nil {
+		klog.Errorf("Failed to marshal provider status, not updating it: %v", err)
+		return providerStatus
+	}
+	return &runtime.RawExtension{Raw: raw}
+}
+
+// instanceMetadata returns the metadata the cloud provider reports for the given instance, nil if it reports none
+func instanceMetadata(providerInstance instance.Instance) *clusterv1alpha1.InstanceMetadata {
+	withMetadata, ok := providerInstance.(instance.MetadataInstance)
+	if !ok {
+		return nil
+	}
+	metadata := withMetadata.Metadata()
+	result := &clusterv1alpha1.InstanceMetadata{
+		Image:    metadata.Image,
+		Location: metadata.Location,
+		Host:     metadata.Host,
+	}
+	if !metadata.Created.IsZero() {
+		created := metav1.NewTime(metadata.Created)
+		result.CreationTimestamp = &created
+	}
+	if len(metadata.Tags) > 0 {
+		result.Tags = map[string]string{}
+		for key, value := range metadata.Tags {
+			result.Tags[key] = value
+		}
+	}
+	return result
+}
+
+// indexedMachines returns the index of the machines, which is populated from a list of all machines as long as
+// the informer did not replay them yet.
+func (r *Reconciler) indexedMachines() (*machineIndex, error) {
+	index := r.machineIndex
+	if index != nil && index.isSynced() {
+		return index, nil
+	}
+	machines := &clusterv1alpha1.MachineList{}
+	if err := r.client.List(r.ctx, machines); err != nil {
+		return nil, err
+	}
+	if index == nil {
+		index = newMachineIndex()
+	}
+	index.populate(machines.Items)
+	return index, nil
+}
+
+// candidateNodes returns the nodes which may belong to the given instance with one of the given provider IDs.
+// These are the nodes the index holds under the provider IDs or addresses of the instance, or all nodes as long
+// as the index is not synced yet.
+func (r *Reconciler) candidateNodes(providerIDs []string, instance instance.Instance) ([]corev1.Node, error) {
+	if r.nodeIndex == nil || !r.nodeIndex.isSynced() {
+		nodes := &corev1.NodeList{}
+		if err := r.targetClient.List(r.ctx, nodes); err != nil {
+			return nil, err
+		}
+		if r.nodeIndex != nil {
+			r.nodeIndex.populate(nodes.Items)
+		}
+		return nodes.Items, nil
+	}
+
+	var addresses []string
+	for address := range instance.Addresses() {
+		addresses = append(addresses, address)
+	}
+	var nodes []corev1.Node
+	for _, name := range r.nodeIndex.nodeNames(providerIDs, addresses) {
+		node := &corev1.Node{}
+		if err := r.targetClient.Get(r.ctx, types.NamespacedName{Name: name}, node); err != nil {
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		nodes = append(nodes, *node)
+	}
+	return nodes, nil
+}
+
+// nodeProviderIDFormats are the formats of the provider IDs the cloud controller managers set on the nodes.
+// Other providers are missing, as their provider IDs consist of more than the instance ID. Their instances
+// may implement instance.ProviderIDInstance instead, e.g. AWS, whose provider IDs include the availability zone.
+var nodeProviderIDFormats = map[providerconfigtypes.CloudProvider]string{
+	providerconfigtypes.CloudProviderAzure:        "azure:///%s",
+	providerconfigtypes.CloudProviderDigitalocean: "digitalocean://%s",
+	providerconfigtypes.CloudProviderHetzner:      "hcloud://%s",
+	providerconfigtypes.CloudProviderLinode:       "linode://%s",
+	providerconfigtypes.CloudProviderOpenstack:    "openstack:///%s",
+	providerconfigtypes.CloudProviderPacket:       "packet://%s",
+}
+
+// nodeProviderID returns the provider ID the cloud controller manager of the provider would set on the node
+// of the given instance, or false if it is unknown.
+func nodeProviderID(providerInstance instance.Instance, provider providerconfigtypes.CloudProvider) (string, bool) {
+	if withProviderID, ok := providerInstance.(instance.ProviderIDInstance); ok {
+		providerID := withProviderID.ProviderID()
+		return providerID, providerID != ""
+	}
+	format, ok := nodeProviderIDFormats[provider]
+	if !ok || providerInstance.ID() == "" {
+		return "", false
+	}
+	return fmt.Sprintf(format, strings.TrimLeft(providerInstance.ID(), "/")), true
+}
+
 func (r *Reconciler) ReadinessChecks() map[string]healthcheck.Check {
 	return map[string]healthcheck.Check{
 		"valid-info-kubeconfig": func() error {
@@ -996,12 +2541,12 @@ func (r *Reconciler) updateNode(node *corev1.Node, modifiers ...func(*corev1.Nod
 	// Store name here, because the object can be nil if an update failed
 	name := types.NamespacedName{Name: node.Name}
 	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
-		if err := r.client.Get(r.ctx, name, node); err != nil {
+		if err := r.targetClient.Get(r.ctx, name, node); err != nil {
 			return err
 		}
 		for _, modify := range modifiers {
 			modify(node)
 		}
-		return r.client.Update(r.ctx, node)
+		return r.targetClient.Update(r.ctx, node)
 	})
 }
@@ -17,28 +17,42 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/go-test/deep"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
+	"github.com/kubermatic/machine-controller/pkg/admission"
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
 	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
 	"github.com/kubermatic/machine-controller/pkg/cloudprovider/instance"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider/provider/fake"
 	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 func init() {
@@ -70,6 +84,24 @@ func (i *fakeInstance) Addresses() map[string]corev1.NodeAddressType {
 	return i.addresses
 }
 
+type fakeProviderIDInstance struct {
+	*fakeInstance
+	providerID string
+}
+
+func (i *fakeProviderIDInstance) ProviderID() string {
+	return i.providerID
+}
+
+type fakeMetadataInstance struct {
+	*fakeInstance
+	metadata instance.Metadata
+}
+
+func (i *fakeMetadataInstance) Metadata() instance.Metadata {
+	return i.metadata
+}
+
 func getTestNode(id, provider string) corev1.Node {
 	providerID := ""
 	if provider != "" {
@@ -102,7 +134,9 @@ func TestController_GetNode(t *testing.T) {
 	node2 := getTestNode("2", "openstack")
 	node3 := getTestNode("3", "")
 	node4 := getTestNode("4", "hetzner")
-	nodeList := []*corev1.Node{&node1, &node2, &node3, &node4}
+	node5 := getTestNode("5", "")
+	node5.Spec.ProviderID = "digitalocean://5"
+	nodeList := []*corev1.Node{&node1, &node2, &node3, &node4, &node5}
 
 	tests := []struct {
 		name     string
@@ -184,6 +218,14 @@ func TestController_GetNode(t *testing.T) {
 			err:      nil,
 			instance: &fakeInstance{id: "4", addresses: map[string]corev1.NodeAddressType{"": ""}},
 		},
+		{
+			name:     "digitalocean node found by provider id of the cloud controller manager",
+			provider: "digitalocean",
+			resNode:  &node5,
+			exists:   true,
+			err:      nil,
+			instance: &fakeInstance{id: "5", addresses: map[string]corev1.NodeAddressType{"": ""}},
+		},
 	}
 
 	for _, test := range tests {
@@ -193,7 +235,7 @@ func TestController_GetNode(t *testing.T) {
 				nodes = append(nodes, node)
 			}
 			client := ctrlruntimefake.NewFakeClient(nodes...)
-			reconciler := Reconciler{client: client}
+			reconciler := Reconciler{client: client, targetClient: client}
 
 			node, exists, err := reconciler.getNode(test.instance, test.provider)
 			if diff := deep.Equal(err, test.err); diff != nil {
@@ -214,6 +256,30 @@ func TestController_GetNode(t *testing.T) {
 				t.Errorf("expected to get %v instead got: %v", test.resNode, node)
 			}
 		})
+
+		t.Run(test.name+" with node index", func(t *testing.T) {
+			nodes := []runtime.Object{}
+			index := newNodeIndex()
+			for _, node := range nodeList {
+				nodes = append(nodes, node)
+				index.set(node)
+			}
+			// Marks the index as synced
+			index.populate(nil)
+			client := ctrlruntimefake.NewFakeClient(nodes...)
+			reconciler := Reconciler{client: client, targetClient: client, nodeIndex: index}
+
+			node, exists, err := reconciler.getNode(test.instance, test.provider)
+			if err != nil {
+				t.Fatalf("failed to get node: %v", err)
+			}
+			if exists != test.exists {
+				t.Fatalf("expected to get %v instead got: %v", test.exists, exists)
+			}
+			if exists && node.Name != test.resNode.Name {
+				t.Errorf("expected to get node %s instead got: %s", test.resNode.Name, node.Name)
+			}
+		})
 	}
 }
 
@@ -225,6 +291,8 @@ func TestControllerDeletesMachinesOnJoinTimeout(t *testing.T) {
 		ownerReferences   []metav1.OwnerReference
 		hasOwner          bool
 		getsDeleted       bool
+		failsToJoin       bool
+		recreate          bool
 		joinTimeoutConfig *time.Duration
 	}{
 		{
@@ -235,10 +303,19 @@ func TestControllerDeletesMachinesOnJoinTimeout(t *testing.T) {
 			joinTimeoutConfig: durationPtr(10 * time.Minute),
 		},
 		{
-			name:              "machine without owner ref does not get deleted",
+			name:              "machine without owner ref does not get deleted but fails",
+			creationTimestamp: metav1.Time{Time: time.Now().Add(-20 * time.Minute)},
+			hasNode:           false,
+			getsDeleted:       false,
+			failsToJoin:       true,
+			joinTimeoutConfig: durationPtr(10 * time.Minute),
+		},
+		{
+			name:              "machine without owner ref gets its instance recreated",
 			creationTimestamp: metav1.Time{Time: time.Now().Add(-20 * time.Minute)},
 			hasNode:           false,
 			getsDeleted:       false,
+			recreate:          true,
 			joinTimeoutConfig: durationPtr(10 * time.Minute),
 		},
 		{
@@ -264,6 +341,7 @@ func TestControllerDeletesMachinesOnJoinTimeout(t *testing.T) {
 			hasNode:           false,
 			ownerReferences:   []metav1.OwnerReference{{Name: "owner", Kind: "Cat"}},
 			getsDeleted:       false,
+			failsToJoin:       true,
 			joinTimeoutConfig: durationPtr(10 * time.Minute),
 		},
 		{
@@ -287,34 +365,340 @@ func TestControllerDeletesMachinesOnJoinTimeout(t *testing.T) {
 			node := &corev1.Node{}
 			instance := &fakeInstance{}
 			if test.hasNode {
-				literalNode := getTestNode("test-id", "")
+				literalNode := getTestNode("1", "")
 				node = &literalNode
-				instance.id = "test-id"
+				instance.id = "1"
+				instance.addresses = map[string]corev1.NodeAddressType{"192.168.1.1": corev1.NodeInternalIP}
 			}
 
 			providerConfig := &providerconfigtypes.Config{CloudProvider: providerconfigtypes.CloudProviderFake}
 
+			ctx := context.Background()
 			client := ctrlruntimefake.NewFakeClient(node, machine)
 
 			reconciler := Reconciler{
-				client:             client,
-				recorder:           &record.FakeRecorder{},
-				joinClusterTimeout: test.joinTimeoutConfig,
+				ctx:                        ctx,
+				client:                     client,
+				targetClient:               client,
+				recorder:                   &record.FakeRecorder{},
+				providerData:               &cloudprovidertypes.ProviderData{Ctx: ctx, Update: cloudprovidertypes.GetMachineUpdater(ctx, client), Client: client},
+				joinClusterTimeout:         test.joinTimeoutConfig,
+				joinClusterTimeoutRecreate: test.recreate,
 			}
 
-			if _, err := reconciler.ensureNodeOwnerRefAndConfigSource(instance, machine, providerConfig); err != nil {
-				t.Fatalf("failed to call ensureNodeOwnerRefAndConfigSource: %v", err)
+			result, err := reconciler.ensureNodeOwnerRefAndConfigSource(fake.New(nil), instance, machine, providerConfig)
+			if (err != nil) != test.failsToJoin {
+				t.Fatalf("Expected ensureNodeOwnerRefAndConfigSource to fail: %v, but got error: %v", test.failsToJoin, err)
+			}
+			if test.recreate && (result == nil || !result.Requeue) {
+				t.Error("Expected the machine to be requeued to recreate its instance")
 			}
 
-			err := client.Get(context.Background(), types.NamespacedName{Name: machine.Name}, &clusterv1alpha1.Machine{})
+			updated := &clusterv1alpha1.Machine{}
+			err = client.Get(context.Background(), types.NamespacedName{Name: machine.Name}, updated)
 			wasDeleted := kerrors.IsNotFound(err)
 
 			if wasDeleted != test.getsDeleted {
 				t.Errorf("Machine was deleted: %v, but expectedDeletion: %v", wasDeleted, test.getsDeleted)
 			}
+			if failed := !wasDeleted && updated.Status.ErrorReason != nil; failed != (test.failsToJoin || test.recreate) {
+				t.Errorf("Machine was marked as failed: %v, but expected: %v", failed, test.failsToJoin || test.recreate)
+			}
+			if test.hasNode && (updated.Status.NodeRef == nil || updated.Status.NodeRef.Name != node.Name) {
+				t.Errorf("Expected the machine to reference node %s, got %v", node.Name, updated.Status.NodeRef)
+			}
+
+			// The error of a machine whose instance gets recreated is kept until a node joins
+			if test.recreate {
+				reconciler.clearMachineError(updated)
+				if updated.Status.ErrorReason == nil {
+					t.Error("Expected the join cluster timeout error to be kept until a node joins")
+				}
+			}
+		})
+	}
+
+}
+
+type goneInstanceProvider struct {
+	cloudprovidertypes.Provider
+	gone bool
+}
+
+func (p *goneInstanceProvider) Get(_ *clusterv1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	if p.gone {
+		return nil, cloudprovidererrors.ErrInstanceNotFound
+	}
+	return &fakeInstance{id: "test-id"}, nil
+}
+
+func TestControllerCheckInstanceExists(t *testing.T) {
+	tests := []struct {
+		name         string
+		gone         bool
+		recreate     bool
+		expectError  bool
+		expectNode   bool
+		expectFailed bool
+	}{
+		{
+			name:       "existing instance",
+			expectNode: true,
+		},
+		{
+			name:         "gone instance marks the machine as failed",
+			gone:         true,
+			expectError:  true,
+			expectFailed: true,
+		},
+		{
+			name:     "gone instance gets recreated",
+			gone:     true,
+			recreate: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := getTestNode("test-id", "")
+			machine := &clusterv1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "my-machine",
+					Annotations: map[string]string{AnnotationInstanceCreationTimestamp: time.Now().Format(time.RFC3339)},
+				},
+				Status: clusterv1alpha1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: node.Name}},
+			}
+			ctx := context.Background()
+			client := ctrlruntimefake.NewFakeClient(&node, machine)
+			recorder := record.NewFakeRecorder(10)
+			reconciler := Reconciler{
+				ctx:                   ctx,
+				client:                client,
+				targetClient:          client,
+				recorder:              recorder,
+				providerData:          &cloudprovidertypes.ProviderData{Ctx: ctx, Update: cloudprovidertypes.GetMachineUpdater(ctx, client), Client: client},
+				instanceCheckInterval: time.Hour,
+				instanceGoneRecreate:  test.recreate,
+			}
+
+			if !reconciler.instanceCheckDue(machine) {
+				t.Fatal("Expected the instance check to be due for a machine which was not checked yet")
+			}
+			result, err := reconciler.checkInstanceExists(&goneInstanceProvider{gone: test.gone}, machine)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Expected checkInstanceExists to fail: %v, but got error: %v", test.expectError, err)
+			}
+			if test.recreate && (result == nil || !result.Requeue) {
+				t.Error("Expected the machine to be requeued to recreate its instance")
+			}
+			if due := reconciler.instanceCheckDue(machine); due != test.gone {
+				t.Errorf("Expected the instance check to be due: %v, but was: %v", test.gone, due)
+			}
+
+			err = client.Get(context.Background(), types.NamespacedName{Name: node.Name}, &corev1.Node{})
+			if nodeExists := err == nil; nodeExists != test.expectNode {
+				t.Errorf("Expected node to exist: %v, but exists: %v (err: %v)", test.expectNode, nodeExists, err)
+			}
+
+			updated := &clusterv1alpha1.Machine{}
+			if err := client.Get(context.Background(), types.NamespacedName{Name: machine.Name}, updated); err != nil {
+				t.Fatalf("failed to get machine: %v", err)
+			}
+			if failed := updated.Status.ErrorReason != nil && *updated.Status.ErrorReason == common.InstanceGoneMachineError; failed != test.expectFailed {
+				t.Errorf("Expected machine to be marked as failed: %v, but was: %v", test.expectFailed, failed)
+			}
+			if cleared := updated.Status.NodeRef == nil; cleared != test.recreate {
+				t.Errorf("Expected the node ref to be cleared: %v, but was: %v", test.recreate, cleared)
+			}
+
+			// A retry must not emit the events of the failure again
+			if test.expectFailed {
+				events := len(recorder.Events)
+				if _, err := reconciler.checkInstanceExists(&goneInstanceProvider{gone: test.gone}, updated); err == nil {
+					t.Error("Expected the retry to fail as well")
+				}
+				if len(recorder.Events) != events {
+					t.Errorf("Expected no further events on retry, got %d", len(recorder.Events)-events)
+				}
+			}
+		})
+	}
+}
+
+type interruptedInstance struct {
+	fakeInstance
+}
+
+func (i *interruptedInstance) Interrupted() bool {
+	return true
+}
+
+type interruptedInstanceProvider struct {
+	cloudprovidertypes.Provider
+}
+
+func (p *interruptedInstanceProvider) Get(_ *clusterv1alpha1.Machine, _ *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	return &interruptedInstance{fakeInstance{id: "test-id"}}, nil
+}
+
+func TestControllerInstanceInterrupted(t *testing.T) {
+	tests := []struct {
+		name          string
+		ownedBySet    bool
+		protected     bool
+		expectDeleted bool
+	}{
+		{
+			name:          "machine of a MachineSet gets replaced",
+			ownedBySet:    true,
+			expectDeleted: true,
+		},
+		{
+			name: "standalone machine is kept",
+		},
+		{
+			name:       "protected machine of a MachineSet is kept",
+			ownedBySet: true,
+			protected:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			machine := &clusterv1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-machine"},
+				Status:     clusterv1alpha1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "my-node"}},
+			}
+			if test.ownedBySet {
+				machine.OwnerReferences = []metav1.OwnerReference{{Kind: "MachineSet", Name: "my-set"}}
+			}
+			if test.protected {
+				machine.Annotations = map[string]string{AnnotationDeleteProtection: "true"}
+			}
+			ctx := context.Background()
+			client := ctrlruntimefake.NewFakeClient(machine)
+			recorder := record.NewFakeRecorder(10)
+			reconciler := Reconciler{
+				ctx:          ctx,
+				client:       client,
+				recorder:     recorder,
+				providerData: &cloudprovidertypes.ProviderData{Ctx: ctx, Update: cloudprovidertypes.GetMachineUpdater(ctx, client), Client: client},
+			}
+
+			if _, err := reconciler.checkInstanceExists(&interruptedInstanceProvider{}, machine); err != nil {
+				t.Fatalf("failed to check instance: %v", err)
+			}
+			err := client.Get(ctx, types.NamespacedName{Name: machine.Name}, &clusterv1alpha1.Machine{})
+			if deleted := kerrors.IsNotFound(err); deleted != test.expectDeleted {
+				t.Errorf("Expected machine to be deleted: %v, but was: %v (err: %v)", test.expectDeleted, deleted, err)
+			}
+			if len(recorder.Events) != 1 {
+				t.Errorf("Expected an event about the interruption, got %d events", len(recorder.Events))
+			}
 		})
 	}
+}
+
+func TestNodeInterrupted(t *testing.T) {
+	node := &corev1.Node{}
+	if nodeInterrupted(node) {
+		t.Error("Expected a node without taints not to be interrupted")
+	}
+	node.Spec.Taints = []corev1.Taint{{Key: "aws-node-termination-handler/spot-itn", Effect: corev1.TaintEffectNoSchedule}}
+	if !nodeInterrupted(node) {
+		t.Error("Expected a node tainted by the termination handler to be interrupted")
+	}
+}
+
+type adoptingProvider struct {
+	cloudprovidertypes.Provider
+	adopted string
+	err     error
+}
+
+func (p *adoptingProvider) AdoptInstance(_ *clusterv1alpha1.Machine, instanceID string, _ *cloudprovidertypes.ProviderData) (instance.Instance, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.adopted = instanceID
+	return &fakeInstance{id: instanceID}, nil
+}
+
+func TestControllerAdoptInstance(t *testing.T) {
+	tests := []struct {
+		name         string
+		provider     cloudprovidertypes.Provider
+		expectError  bool
+		expectFailed bool
+	}{
+		{
+			name:     "instance gets adopted",
+			provider: &adoptingProvider{},
+		},
+		{
+			name:         "provider without adoption support",
+			provider:     &goneInstanceProvider{gone: true},
+			expectError:  true,
+			expectFailed: true,
+		},
+		{
+			name:         "missing instance",
+			provider:     &adoptingProvider{err: cloudprovidererrors.ErrInstanceNotFound},
+			expectError:  true,
+			expectFailed: true,
+		},
+		{
+			name:        "transient error gets retried",
+			provider:    &adoptingProvider{err: fmt.Errorf("rate limited")},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			machine := &clusterv1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "my-machine",
+					Annotations: map[string]string{AnnotationAdoptInstance: "4711"},
+				},
+			}
+			ctx := context.Background()
+			client := ctrlruntimefake.NewFakeClient(machine)
+			reconciler := Reconciler{
+				ctx:          ctx,
+				client:       client,
+				recorder:     record.NewFakeRecorder(10),
+				providerData: &cloudprovidertypes.ProviderData{Ctx: ctx, Update: cloudprovidertypes.GetMachineUpdater(ctx, client), Client: client},
+			}
 
+			result, err := reconciler.adoptInstance(test.provider, machine, "4711")
+			if (err != nil) != test.expectError {
+				t.Fatalf("Expected adoptInstance to fail: %v, but got error: %v", test.expectError, err)
+			}
+			if !test.expectError && (result == nil || result.RequeueAfter == 0) {
+				t.Error("Expected the machine to be requeued after the adoption")
+			}
+
+			updated := &clusterv1alpha1.Machine{}
+			if err := client.Get(ctx, types.NamespacedName{Name: machine.Name}, updated); err != nil {
+				t.Fatalf("failed to get machine: %v", err)
+			}
+			if _, pending := updated.Annotations[AnnotationAdoptInstance]; pending != test.expectError {
+				t.Errorf("Expected the adoption to be pending: %v, but was: %v", test.expectError, pending)
+			}
+			if failed := updated.Status.ErrorReason != nil; failed != test.expectFailed {
+				t.Errorf("Expected machine to be marked as failed: %v, but was: %v", test.expectFailed, failed)
+			}
+			if adopter, ok := test.provider.(*adoptingProvider); ok && adopter.err == nil {
+				if adopter.adopted != "4711" {
+					t.Errorf("Expected instance 4711 to be adopted, got %q", adopter.adopted)
+				}
+				if !sets.NewString(updated.Finalizers...).Has(FinalizerDeleteInstance) {
+					t.Error("Expected the adopted instance to be deleted with the machine")
+				}
+			}
+		})
+	}
 }
 
 func durationPtr(d time.Duration) *time.Duration {
@@ -448,6 +832,8 @@ func TestControllerShouldEvict(t *testing.T) {
 
 			reconciler := &Reconciler{
 				client:            client,
+				targetClient:      client,
+				recorder:          &record.FakeRecorder{},
 				skipEvictionAfter: 2 * time.Hour,
 			}
 
@@ -585,6 +971,7 @@ func TestControllerDeleteNodeForMachine(t *testing.T) {
 
 			reconciler := &Reconciler{
 				client:       client,
+				targetClient: client,
 				recorder:     &record.FakeRecorder{},
 				providerData: providerData,
 			}
@@ -615,3 +1002,697 @@ func TestControllerDeleteNodeForMachine(t *testing.T) {
 		})
 	}
 }
+
+func TestControllerDeleteMachineAnnotations(t *testing.T) {
+	tests := []struct {
+		name               string
+		annotations        map[string]string
+		expectedFinalizers []string
+		shouldDeleteNode   bool
+	}{
+		{
+			name:               "delete protection keeps the finalizers",
+			annotations:        map[string]string{AnnotationDeleteProtection: "true"},
+			expectedFinalizers: []string{FinalizerDeleteInstance, FinalizerDeleteNode},
+		},
+		{
+			name:               "delete protection takes precedence over force deletion",
+			annotations:        map[string]string{AnnotationDeleteProtection: "true", AnnotationForceDelete: "true"},
+			expectedFinalizers: []string{FinalizerDeleteInstance, FinalizerDeleteNode},
+		},
+		{
+			name:             "force deletion removes the finalizers",
+			annotations:      map[string]string{AnnotationForceDelete: "true"},
+			shouldDeleteNode: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deletionTimestamp := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+			machine := &clusterv1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "machine-1",
+					DeletionTimestamp: &deletionTimestamp,
+					Annotations:       test.annotations,
+					Finalizers:        []string{FinalizerDeleteInstance, FinalizerDeleteNode},
+				},
+				Status: clusterv1alpha1.MachineStatus{
+					NodeRef: &corev1.ObjectReference{Name: "node-1"},
+				},
+			}
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+			ctx := context.Background()
+			client := ctrlruntimefake.NewFakeClient(machine, node)
+
+			reconciler := Reconciler{
+				ctx:              ctx,
+				client:           client,
+				targetClient:     client,
+				recorder:         &record.FakeRecorder{},
+				providerData:     &cloudprovidertypes.ProviderData{Ctx: ctx, Update: cloudprovidertypes.GetMachineUpdater(ctx, client), Client: client},
+				forceDeleteAfter: time.Hour,
+			}
+
+			// The provider must not be used for protected or force deleted machines
+			if _, err := reconciler.deleteMachine(nil, machine); err != nil {
+				t.Fatalf("failed to call deleteMachine: %v", err)
+			}
+
+			updated := &clusterv1alpha1.Machine{}
+			if err := client.Get(context.Background(), types.NamespacedName{Name: machine.Name}, updated); err != nil {
+				t.Fatalf("failed to get machine: %v", err)
+			}
+			if diff := deep.Equal(updated.Finalizers, test.expectedFinalizers); diff != nil {
+				t.Errorf("Expected finalizers to be %v, got %v", test.expectedFinalizers, updated.Finalizers)
+			}
+			err := client.Get(context.Background(), types.NamespacedName{Name: node.Name}, &corev1.Node{})
+			if wasDeleted := kerrors.IsNotFound(err); wasDeleted != test.shouldDeleteNode {
+				t.Errorf("Node was deleted: %v, but expectedDeletion: %v", wasDeleted, test.shouldDeleteNode)
+			}
+		})
+	}
+}
+
+func TestControllerPaused(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		paused      bool
+	}{
+		{
+			name:        "paused machine",
+			annotations: map[string]string{AnnotationPaused: "true"},
+		},
+		{
+			name:   "paused controller",
+			paused: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deletionTimestamp := metav1.NewTime(time.Now())
+			machine := &clusterv1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "machine-1",
+					DeletionTimestamp: &deletionTimestamp,
+					Annotations:       test.annotations,
+					Finalizers:        []string{FinalizerDeleteInstance, FinalizerDeleteNode},
+				},
+			}
+			client := ctrlruntimefake.NewFakeClient(machine)
+			recorder := record.NewFakeRecorder(10)
+
+			reconciler := Reconciler{
+				ctx:      context.Background(),
+				client:   client,
+				recorder: recorder,
+				inFlight: &InFlightReconciles{},
+				paused:   test.paused,
+			}
+
+			result, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: machine.Name}})
+			if err != nil {
+				t.Fatalf("failed to reconcile: %v", err)
+			}
+			if result.Requeue || result.RequeueAfter > 0 {
+				t.Errorf("Expected the paused machine to not be requeued, got %+v", result)
+			}
+			// Reconciling the machine would fail as it has no provider spec
+			if len(recorder.Events) > 0 {
+				t.Errorf("Expected no events for the paused machine, got %q", <-recorder.Events)
+			}
+
+			updated := &clusterv1alpha1.Machine{}
+			if err := client.Get(context.Background(), types.NamespacedName{Name: machine.Name}, updated); err != nil {
+				t.Fatalf("failed to get machine: %v", err)
+			}
+			if diff := deep.Equal(updated.Finalizers, machine.Finalizers); diff != nil {
+				t.Errorf("Expected finalizers to be %v, got %v", machine.Finalizers, updated.Finalizers)
+			}
+		})
+	}
+}
+
+func TestControllerCountsReconcileErrors(t *testing.T) {
+	ctx := context.Background()
+	// Reconciling the machine fails as it has no provider spec
+	machine := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine-1"}}
+	client := ctrlruntimefake.NewFakeClient(machine)
+
+	reconciler := Reconciler{
+		ctx:          ctx,
+		client:       client,
+		recorder:     record.NewFakeRecorder(10),
+		backoff:      workqueue.NewItemExponentialFailureRateLimiter(reconcileBackoffBase, reconcileBackoffMax),
+		inFlight:     &InFlightReconciles{},
+		metrics:      NewMachineControllerMetrics(),
+		providerData: &cloudprovidertypes.ProviderData{Ctx: ctx, Update: cloudprovidertypes.GetMachineUpdater(ctx, client), Client: client},
+	}
+
+	result, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: machine.Name}})
+	if err != nil {
+		t.Fatalf("Expected the error to be handled by requeueing the machine, got %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Errorf("Expected the machine to be requeued after the backoff, got %+v", result)
+	}
+	if count := testutil.ToFloat64(reconciler.metrics.Errors); count != 1 {
+		t.Errorf("Expected the error to be counted once, got %v", count)
+	}
+}
+
+func TestControllerBackoffAfter(t *testing.T) {
+	reconciler := Reconciler{
+		backoff: workqueue.NewItemExponentialFailureRateLimiter(reconcileBackoffBase, reconcileBackoffMax),
+	}
+	name := types.NamespacedName{Namespace: "kube-system", Name: "machine-1"}
+	maxBackoff := time.Duration(float64(reconcileBackoffMax) * (1 + reconcileBackoffJitter))
+
+	var previous time.Duration
+	for i := 0; i < 20; i++ {
+		backoff := reconciler.backoffAfter(name)
+		if backoff < previous && backoff < reconcileBackoffMax {
+			t.Errorf("Expected backoff to grow, but got %s after %s", backoff, previous)
+		}
+		if backoff > maxBackoff {
+			t.Errorf("Expected backoff to be capped at %s, but got %s", maxBackoff, backoff)
+		}
+		previous = backoff
+	}
+
+	reconciler.backoff.Forget(name)
+	if backoff := reconciler.backoffAfter(name); backoff > 2*reconcileBackoffBase {
+		t.Errorf("Expected backoff to be reset, but got %s", backoff)
+	}
+}
+
+func TestControllerRetriesExhausted(t *testing.T) {
+	reconciler := Reconciler{
+		backoff:         workqueue.NewItemExponentialFailureRateLimiter(reconcileBackoffBase, reconcileBackoffMax),
+		backoffSettings: BackoffSettings{MaxRetries: 3},
+	}
+	name := types.NamespacedName{Namespace: "kube-system", Name: "machine-1"}
+
+	for i := 0; i < 3; i++ {
+		if reconciler.retriesExhausted(name) {
+			t.Fatalf("Expected retry %d to be allowed", i+1)
+		}
+		reconciler.backoffAfter(name)
+	}
+	if !reconciler.retriesExhausted(name) {
+		t.Error("Expected the retries to be exhausted after 3 retries")
+	}
+
+	reconciler.backoff.Forget(name)
+	if reconciler.retriesExhausted(name) {
+		t.Error("Expected the retries to be reset")
+	}
+
+	reconciler.backoffSettings.MaxRetries = 0
+	for i := 0; i < 10; i++ {
+		reconciler.backoffAfter(name)
+	}
+	if reconciler.retriesExhausted(name) {
+		t.Error("Expected unlimited retries without a maximum")
+	}
+}
+
+func TestControllerMachinesReferencingSecret(t *testing.T) {
+	newMachine := func(name, controller, providerSpec string) *clusterv1alpha1.Machine {
+		machine := &clusterv1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "kube-system",
+				Name:      name,
+				Labels:    map[string]string{controllerNameLabelKey: controller},
+			},
+		}
+		machine.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(providerSpec)}
+		return machine
+	}
+	referencing := `{"cloudProviderSpec":{"token":{"secretKeyRef":{"namespace":"kube-system","name":"machine-controller-digitalocean","key":"token"}}}}`
+
+	reconciler := Reconciler{
+		ctx: context.Background(),
+		client: ctrlruntimefake.NewFakeClient(
+			newMachine("referencing", "", referencing),
+			newMachine("other-secret", "", `{"cloudProviderSpec":{"token":{"secretKeyRef":{"namespace":"kube-system","name":"machine-controller-hetzner","key":"token"}}}}`),
+			newMachine("inline", "", `{"cloudProviderSpec":{"token":"machine-controller-digitalocean"}}`),
+			newMachine("other-controller", "other", referencing),
+		),
+		backoff: workqueue.NewItemExponentialFailureRateLimiter(reconcileBackoffBase, reconcileBackoffMax),
+	}
+	name := types.NamespacedName{Namespace: "kube-system", Name: "referencing"}
+	for i := 0; i < 10; i++ {
+		reconciler.backoffAfter(name)
+	}
+
+	requests := reconciler.machinesReferencingSecret("kube-system", "machine-controller-digitalocean")
+	expected := []reconcile.Request{{NamespacedName: name}}
+	if diff := deep.Equal(requests, expected); diff != nil {
+		t.Errorf("Expected requests %v, got %v", expected, requests)
+	}
+	if backoff := reconciler.backoffAfter(name); backoff > 2*reconcileBackoffBase {
+		t.Errorf("Expected backoff to be reset, but got %s", backoff)
+	}
+}
+
+func TestControllerApplyMachineDefaults(t *testing.T) {
+	defaults := &providerconfig.MachineDefaults{
+		KubeletVersion: "1.17.3",
+		ProviderSpecs: map[string]map[string]interface{}{
+			"hetzner": {
+				"operatingSystem": "ubuntu",
+				"cloudProviderSpec": map[string]interface{}{
+					"location": "fsn1",
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name                 string
+		defaults             *providerconfig.MachineDefaults
+		kubeletVersion       string
+		providerSpec         string
+		expectedKubelet      string
+		expectedProviderSpec string
+	}{
+		{
+			name:                 "no defaults",
+			providerSpec:         `{"cloudProvider":"hetzner"}`,
+			expectedProviderSpec: `{"cloudProvider":"hetzner"}`,
+		},
+		{
+			name:                 "missing fields get stored",
+			defaults:             defaults,
+			providerSpec:         `{"cloudProvider":"hetzner","cloudProviderSpec":{"serverType":"cx21"}}`,
+			expectedKubelet:      "1.17.3",
+			expectedProviderSpec: `{"cloudProvider":"hetzner","cloudProviderSpec":{"location":"fsn1","serverType":"cx21"},"operatingSystem":"ubuntu"}`,
+		},
+		{
+			name:                 "complete spec is kept as is",
+			defaults:             defaults,
+			kubeletVersion:       "1.18.0",
+			providerSpec:         `{"operatingSystem":"centos","cloudProvider":"hetzner","cloudProviderSpec":{"location":"nbg1"}}`,
+			expectedKubelet:      "1.18.0",
+			expectedProviderSpec: `{"operatingSystem":"centos","cloudProvider":"hetzner","cloudProviderSpec":{"location":"nbg1"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			machine := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "machine-1"}}
+			machine.Spec.Versions.Kubelet = test.kubeletVersion
+			machine.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(test.providerSpec)}
+			client := ctrlruntimefake.NewFakeClient(machine)
+			reconciler := Reconciler{
+				ctx:             ctx,
+				client:          client,
+				providerData:    &cloudprovidertypes.ProviderData{Ctx: ctx, Update: cloudprovidertypes.GetMachineUpdater(ctx, client), Client: client},
+				machineDefaults: test.defaults,
+			}
+
+			original := machine.DeepCopy()
+			if err := reconciler.applyMachineDefaults(machine); err != nil {
+				t.Fatalf("failed to apply machine defaults: %v", err)
+			}
+
+			stored := &clusterv1alpha1.Machine{}
+			if err := client.Get(ctx, types.NamespacedName{Namespace: "kube-system", Name: "machine-1"}, stored); err != nil {
+				t.Fatalf("failed to get machine: %v", err)
+			}
+			if stored.Spec.Versions.Kubelet != test.expectedKubelet {
+				t.Errorf("Expected kubelet version %q, but got %q", test.expectedKubelet, stored.Spec.Versions.Kubelet)
+			}
+			if providerSpec := string(stored.Spec.ProviderSpec.Value.Raw); providerSpec != test.expectedProviderSpec {
+				t.Errorf("Expected provider spec %s, but got %s", test.expectedProviderSpec, providerSpec)
+			}
+
+			// The webhook has no defaults, it must not reject the update of the controller
+			if response := admitMachineUpdate(t, original, stored); !response.Allowed {
+				t.Errorf("Expected the webhook to allow the update, got %v", response.Result)
+			}
+		})
+	}
+}
+
+// admitMachineUpdate sends the update of the given machine to the webhook and returns its response
+func admitMachineUpdate(t *testing.T, oldMachine, machine *clusterv1alpha1.Machine) *admissionv1beta1.AdmissionResponse {
+	oldRaw, err := json.Marshal(oldMachine)
+	if err != nil {
+		t.Fatalf("failed to marshal machine: %v", err)
+	}
+	raw, err := json.Marshal(machine)
+	if err != nil {
+		t.Fatalf("failed to marshal machine: %v", err)
+	}
+	body, err := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{
+		Operation: admissionv1beta1.Update,
+		Object:    runtime.RawExtension{Raw: raw},
+		OldObject: runtime.RawExtension{Raw: oldRaw},
+	}})
+	if err != nil {
+		t.Fatalf("failed to marshal admission review: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/machines", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	admission.New("", nil, nil, "", nil, false, 0, nil, "").Handler.ServeHTTP(recorder, request)
+
+	review := admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &review); err != nil {
+		t.Fatalf("failed to unmarshal admission review: %v", err)
+	}
+	return review.Response
+}
+
+func TestControllerSetsProviderID(t *testing.T) {
+	tests := []struct {
+		name               string
+		provider           providerconfigtypes.CloudProvider
+		instanceProviderID string
+		nodeProviderID     string
+		expectedProviderID string
+	}{
+		{
+			name:               "provider ID gets set",
+			provider:           providerconfigtypes.CloudProviderDigitalocean,
+			expectedProviderID: "digitalocean://12345",
+		},
+		{
+			name:               "provider ID of the instance gets set",
+			provider:           providerconfigtypes.CloudProviderAWS,
+			instanceProviderID: "aws:///eu-central-1a/12345",
+			expectedProviderID: "aws:///eu-central-1a/12345",
+		},
+		{
+			name:     "empty provider ID of the instance is not set",
+			provider: providerconfigtypes.CloudProviderAWS,
+		},
+		{
+			name:               "provider ID of the cloud controller manager is kept",
+			provider:           providerconfigtypes.CloudProviderDigitalocean,
+			nodeProviderID:     "digitalocean:///12345",
+			expectedProviderID: "digitalocean:///12345",
+		},
+		{
+			name:     "provider ID of unknown format is not set",
+			provider: providerconfigtypes.CloudProviderGoogle,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			machine := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine-1"}}
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{}},
+				Spec:       corev1.NodeSpec{ProviderID: test.nodeProviderID},
+				Status: corev1.NodeStatus{
+					Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.1.1"}},
+				},
+			}
+			var providerInstance instance.Instance = &fakeInstance{id: "12345", addresses: map[string]corev1.NodeAddressType{"192.168.1.1": corev1.NodeInternalIP}}
+			if test.provider == providerconfigtypes.CloudProviderAWS {
+				providerInstance = &fakeProviderIDInstance{fakeInstance: providerInstance.(*fakeInstance), providerID: test.instanceProviderID}
+			}
+			ctx := context.Background()
+			client := ctrlruntimefake.NewFakeClient(node, machine)
+			reconciler := Reconciler{
+				ctx:          ctx,
+				client:       client,
+				targetClient: client,
+				recorder:     &record.FakeRecorder{},
+				providerData: &cloudprovidertypes.ProviderData{Ctx: ctx, Update: cloudprovidertypes.GetMachineUpdater(ctx, client), Client: client},
+			}
+
+			providerConfig := &providerconfigtypes.Config{CloudProvider: test.provider}
+			if _, err := reconciler.ensureNodeOwnerRefAndConfigSource(fake.New(nil), providerInstance, machine, providerConfig); err != nil {
+				t.Fatalf("failed to call ensureNodeOwnerRefAndConfigSource: %v", err)
+			}
+
+			updatedNode := &corev1.Node{}
+			if err := client.Get(context.Background(), types.NamespacedName{Name: node.Name}, updatedNode); err != nil {
+				t.Fatalf("failed to get node: %v", err)
+			}
+			if updatedNode.Spec.ProviderID != test.expectedProviderID {
+				t.Errorf("Expected node provider ID to be %q, got %q", test.expectedProviderID, updatedNode.Spec.ProviderID)
+			}
+
+			updatedMachine := &clusterv1alpha1.Machine{}
+			if err := client.Get(context.Background(), types.NamespacedName{Name: machine.Name}, updatedMachine); err != nil {
+				t.Fatalf("failed to get machine: %v", err)
+			}
+			var machineProviderID string
+			if updatedMachine.Spec.ProviderID != nil {
+				machineProviderID = *updatedMachine.Spec.ProviderID
+			}
+			if machineProviderID != test.expectedProviderID {
+				t.Errorf("Expected machine provider ID to be %q, got %q", test.expectedProviderID, machineProviderID)
+			}
+		})
+	}
+}
+
+func TestWithInstanceProviderStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		providerStatus *runtime.RawExtension
+		expected       string
+	}{
+		{
+			name:     "empty provider status",
+			expected: `{"instanceID":"1234","instanceStatus":"running"}`,
+		},
+		{
+			name:           "fields of the provider are kept",
+			providerStatus: &runtime.RawExtension{Raw: []byte(`{"provisioningID":"5678","instanceStatus":"creating"}`)},
+			expected:       `{"instanceID":"1234","instanceStatus":"running","provisioningID":"5678"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			providerInstance := &fakeInstance{id: "1234", status: instance.StatusRunning}
+			providerStatus := withInstanceProviderStatus(test.providerStatus, providerInstance)
+			if string(providerStatus.Raw) != test.expected {
+				t.Errorf("Expected provider status to be\n%s\ninstead got\n%s", test.expected, string(providerStatus.Raw))
+			}
+		})
+	}
+}
+
+func TestInstanceMetadata(t *testing.T) {
+	if metadata := instanceMetadata(&fakeInstance{id: "1234"}); metadata != nil {
+		t.Errorf("Expected no metadata for an instance without metadata, got %+v", metadata)
+	}
+
+	created := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	providerInstance := &fakeMetadataInstance{
+		fakeInstance: &fakeInstance{id: "1234"},
+		metadata: instance.Metadata{
+			Image:    "ubuntu-18.04",
+			Created:  created,
+			Location: "fsn1-dc14",
+			Tags:     map[string]string{"cost-center": "4711"},
+		},
+	}
+	metadata := instanceMetadata(providerInstance)
+	if metadata == nil {
+		t.Fatal("Expected metadata")
+	}
+	if metadata.Image != "ubuntu-18.04" || metadata.Location != "fsn1-dc14" || metadata.Host != "" {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+	if metadata.CreationTimestamp == nil || !metadata.CreationTimestamp.Time.Equal(created) {
+		t.Errorf("Expected creation timestamp %v, got %v", created, metadata.CreationTimestamp)
+	}
+	if metadata.Tags["cost-center"] != "4711" {
+		t.Errorf("Expected the tags to be copied, got %v", metadata.Tags)
+	}
+}
+
+func TestMachineAddresses(t *testing.T) {
+	addresses := map[string]corev1.NodeAddressType{
+		"node1.example.com": corev1.NodeHostName,
+		"203.0.113.10":      corev1.NodeExternalIP,
+		"10.0.0.2":          corev1.NodeInternalIP,
+		"10.0.0.1":          corev1.NodeInternalIP,
+		"node1.internal":    corev1.NodeInternalDNS,
+	}
+	expected := []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+		{Type: corev1.NodeExternalIP, Address: "203.0.113.10"},
+		{Type: corev1.NodeInternalDNS, Address: "node1.internal"},
+		{Type: corev1.NodeHostName, Address: "node1.example.com"},
+	}
+
+	if diff := deep.Equal(machineAddresses(addresses), expected); diff != nil {
+		t.Errorf("Unexpected machine addresses: %v", diff)
+	}
+}
+
+func TestMachinePhase(t *testing.T) {
+	now := metav1.Now()
+	reason := common.CreateMachineError
+
+	tests := []struct {
+		name     string
+		machine  *clusterv1alpha1.Machine
+		expected string
+	}{
+		{
+			name:     "new machine",
+			machine:  &clusterv1alpha1.Machine{},
+			expected: clusterv1alpha1.MachinePhaseProvisioning,
+		},
+		{
+			name: "instance created",
+			machine: &clusterv1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{AnnotationInstanceCreationTimestamp: now.Format(time.RFC3339)},
+				},
+			},
+			expected: clusterv1alpha1.MachinePhaseProvisioned,
+		},
+		{
+			name: "instance found",
+			machine: &clusterv1alpha1.Machine{
+				Status: clusterv1alpha1.MachineStatus{
+					ProviderStatus: &runtime.RawExtension{Raw: []byte(`{"instanceID":"1234","instanceStatus":"running"}`)},
+				},
+			},
+			expected: clusterv1alpha1.MachinePhaseProvisioned,
+		},
+		{
+			name: "node joined",
+			machine: &clusterv1alpha1.Machine{
+				Status: clusterv1alpha1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "node1"}},
+			},
+			expected: clusterv1alpha1.MachinePhaseRunning,
+		},
+		{
+			name: "failed machine",
+			machine: &clusterv1alpha1.Machine{
+				Status: clusterv1alpha1.MachineStatus{
+					NodeRef:     &corev1.ObjectReference{Name: "node1"},
+					ErrorReason: &reason,
+				},
+			},
+			expected: clusterv1alpha1.MachinePhaseFailed,
+		},
+		{
+			name: "deleted machine",
+			machine: &clusterv1alpha1.Machine{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Status:     clusterv1alpha1.MachineStatus{ErrorReason: &reason},
+			},
+			expected: clusterv1alpha1.MachinePhaseDeleting,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if phase := machinePhase(test.machine); phase != test.expected {
+				t.Errorf("Expected phase %s, but got %s", test.expected, phase)
+			}
+		})
+	}
+}
+
+func TestSpecHash(t *testing.T) {
+	spec := func(raw string) clusterv1alpha1.ProviderSpec {
+		return clusterv1alpha1.ProviderSpec{Value: &runtime.RawExtension{Raw: []byte(raw)}}
+	}
+
+	hash, err := specHash(spec(`{"cloudProvider":"digitalocean","cloudProviderSpec":{"size":"s-1vcpu-1gb","region":"fra1"}}`))
+	if err != nil {
+		t.Fatalf("failed to hash spec: %v", err)
+	}
+	reordered, err := specHash(spec(`{"cloudProviderSpec":{"region":"fra1","size":"s-1vcpu-1gb"}, "cloudProvider":"digitalocean"}`))
+	if err != nil {
+		t.Fatalf("failed to hash spec: %v", err)
+	}
+	if hash != reordered {
+		t.Errorf("Expected the hash to not depend on the order of the fields, but got %s and %s", hash, reordered)
+	}
+	changed, err := specHash(spec(`{"cloudProvider":"digitalocean","cloudProviderSpec":{"size":"s-2vcpu-2gb","region":"fra1"}}`))
+	if err != nil {
+		t.Fatalf("failed to hash spec: %v", err)
+	}
+	if hash == changed {
+		t.Errorf("Expected the hash to change with the spec, but got %s for both", hash)
+	}
+}
+
+func TestAddNamespaceSSHPublicKeys(t *testing.T) {
+	tests := []struct {
+		name         string
+		secret       *corev1.Secret
+		providerSpec string
+		expectedKeys []string
+	}{
+		{
+			name:         "no secret",
+			providerSpec: `{"sshPublicKeys":["ssh-rsa machine"]}`,
+			expectedKeys: []string{"ssh-rsa machine"},
+		},
+		{
+			name: "keys of the namespace are added",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: SSHPublicKeysSecretName},
+				Data: map[string][]byte{
+					"bob":   []byte("ssh-ed25519 bob"),
+					"alice": []byte("# alice\nssh-rsa alice-1\n\nssh-rsa alice-2\n"),
+				},
+			},
+			providerSpec: `{"sshPublicKeys":["ssh-rsa machine"]}`,
+			expectedKeys: []string{"ssh-rsa machine", "ssh-rsa alice-1", "ssh-rsa alice-2", "ssh-ed25519 bob"},
+		},
+		{
+			name: "duplicate keys are skipped",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: SSHPublicKeysSecretName},
+				Data:       map[string][]byte{"machine": []byte("ssh-rsa machine")},
+			},
+			providerSpec: `{"sshPublicKeys":["ssh-rsa machine"]}`,
+			expectedKeys: []string{"ssh-rsa machine"},
+		},
+		{
+			name: "secret of another namespace",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: SSHPublicKeysSecretName},
+				Data:       map[string][]byte{"bob": []byte("ssh-ed25519 bob")},
+			},
+			providerSpec: `{}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if test.secret != nil {
+				objects = append(objects, test.secret)
+			}
+			reconciler := Reconciler{ctx: context.Background(), client: ctrlruntimefake.NewFakeClient(objects...)}
+
+			spec := clusterv1alpha1.MachineSpec{}
+			spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(test.providerSpec)}
+			spec, err := reconciler.addNamespaceSSHPublicKeys("team-a", spec)
+			if err != nil {
+				t.Fatalf("failed to add ssh public keys: %v", err)
+			}
+			providerConfig, err := providerconfigtypes.GetConfig(spec.ProviderSpec)
+			if err != nil {
+				t.Fatalf("failed to get provider config: %v", err)
+			}
+			if diff := deep.Equal(providerConfig.SSHPublicKeys, test.expectedKeys); diff != nil {
+				t.Errorf("Expected ssh public keys %v, got %v", test.expectedKeys, providerConfig.SSHPublicKeys)
+			}
+		})
+	}
+}
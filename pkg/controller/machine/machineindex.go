@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// machineIndex holds the few fields of the machines the node events are matched with. Listing machines from the
+// cache copies them with their whole spec, which for thousands of machines on every node heartbeat is what drives
+// up the memory of the controller. The index is kept up to date by the machine informer instead.
+type machineIndex struct {
+	lock sync.RWMutex
+	// synced is set once all machines got indexed, the informer replays the existing machines asynchronously
+	synced   bool
+	machines map[types.NamespacedName]indexedMachine
+	byUID    map[types.UID]types.NamespacedName
+}
+
+// indexedMachine is the part of a machine the index keeps. The addresses are shared with the cached machine,
+// which is never modified, so they must not be modified either.
+type indexedMachine struct {
+	name       types.NamespacedName
+	uid        types.UID
+	hasNodeRef bool
+	addresses  []corev1.NodeAddress
+}
+
+func newMachineIndex() *machineIndex {
+	return &machineIndex{
+		machines: map[types.NamespacedName]indexedMachine{},
+		byUID:    map[types.UID]types.NamespacedName{},
+	}
+}
+
+// handler returns the event handler which keeps the index up to date
+func (i *machineIndex) handler() toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if machine, ok := obj.(*clusterv1alpha1.Machine); ok {
+				i.set(machine)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if machine, ok := obj.(*clusterv1alpha1.Machine); ok {
+				i.set(machine)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if machine, ok := obj.(*clusterv1alpha1.Machine); ok {
+				i.delete(types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name})
+			}
+		},
+	}
+}
+
+// set indexes the given machine, replacing its previous entry
+func (i *machineIndex) set(machine *clusterv1alpha1.Machine) {
+	entry := indexedMachine{
+		name:       types.NamespacedName{Namespace: machine.Namespace, Name: machine.Name},
+		uid:        machine.UID,
+		hasNodeRef: machine.Status.NodeRef != nil,
+		addresses:  machine.Status.Addresses,
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.deleteLocked(entry.name)
+	i.machines[entry.name] = entry
+	i.byUID[entry.uid] = entry.name
+}
+
+// populate indexes the given machines, which must be all machines, and marks the index as synced
+func (i *machineIndex) populate(machines []clusterv1alpha1.Machine) {
+	for idx := range machines {
+		i.set(&machines[idx])
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.synced = true
+}
+
+func (i *machineIndex) isSynced() bool {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return i.synced
+}
+
+func (i *machineIndex) delete(name types.NamespacedName) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.deleteLocked(name)
+}
+
+// deleteLocked drops the entry of the given machine, the lock must be held
+func (i *machineIndex) deleteLocked(name types.NamespacedName) {
+	entry, found := i.machines[name]
+	if !found {
+		return
+	}
+	if i.byUID[entry.uid] == name {
+		delete(i.byUID, entry.uid)
+	}
+	delete(i.machines, name)
+}
+
+// machineWithUID returns the name of the machine with the given UID
+func (i *machineIndex) machineWithUID(uid types.UID) (types.NamespacedName, bool) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	name, found := i.byUID[uid]
+	return name, found
+}
+
+// machinesWithoutNodeRef returns the machines which have no node yet
+func (i *machineIndex) machinesWithoutNodeRef() []indexedMachine {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	var machines []indexedMachine
+	for _, machine := range i.machines {
+		if !machine.hasNodeRef {
+			machines = append(machines, machine)
+		}
+	}
+	return machines
+}
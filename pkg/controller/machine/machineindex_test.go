@@ -0,0 +1,64 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+func TestMachineIndex(t *testing.T) {
+	index := newMachineIndex()
+	handler := index.handler()
+	machineName := types.NamespacedName{Namespace: "kube-system", Name: "machine-1"}
+	machine := &clusterv1alpha1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: machineName.Namespace, Name: machineName.Name, UID: "uid-1"},
+		Status: clusterv1alpha1.MachineStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}},
+		},
+	}
+
+	handler.OnAdd(machine)
+	if name, found := index.machineWithUID("uid-1"); !found || name != machineName {
+		t.Errorf("expected the machine to be found by its UID, got %v", name)
+	}
+	unmatched := index.machinesWithoutNodeRef()
+	if len(unmatched) != 1 || unmatched[0].name != machineName || unmatched[0].addresses[0].Address != "10.0.0.1" {
+		t.Errorf("expected the machine without node to be returned with its addresses, got %v", unmatched)
+	}
+
+	updated := machine.DeepCopy()
+	updated.Status.NodeRef = &corev1.ObjectReference{Name: "node-1"}
+	handler.OnUpdate(machine, updated)
+	if unmatched := index.machinesWithoutNodeRef(); len(unmatched) != 0 {
+		t.Errorf("expected the machine with a node not to be returned, got %v", unmatched)
+	}
+
+	handler.OnDelete(toolscache.DeletedFinalStateUnknown{Key: "kube-system/machine-1", Obj: updated})
+	if _, found := index.machineWithUID("uid-1"); found {
+		t.Error("expected the deleted machine to be dropped")
+	}
+	if len(index.machines) != 0 || len(index.byUID) != 0 {
+		t.Errorf("expected the index to be empty, got %v and %v", index.machines, index.byUID)
+	}
+}
@@ -19,6 +19,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -50,6 +51,20 @@ func NewMachineControllerMetrics() *MetricsCollection {
 			Name: metricsPrefix + "errors_total",
 			Help: "The total number or unexpected errors the controller encountered",
 		}),
+		ReconcileDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    metricsPrefix + "reconcile_duration_seconds",
+			Help:    "The duration of the reconciliations of machines",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+		}),
+		ProvisioningDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    metricsPrefix + "provisioning_duration_seconds",
+			Help:    "The duration from the creation of instances until their node joined the cluster",
+			Buckets: []float64{30, 60, 90, 120, 180, 240, 300, 450, 600, 900, 1200, 1800, 3600},
+		}, []string{"provider"}),
+		TerminalErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: metricsPrefix + "terminal_errors_total",
+			Help: "The failed reconciliations of machines with an error which retrying doesn't resolve, by cloud provider and reason",
+		}, []string{"provider", "reason"}),
 	}
 
 	// Set default values, so that these metrics always show up
@@ -60,12 +75,21 @@ func NewMachineControllerMetrics() *MetricsCollection {
 }
 
 type MachineCollector struct {
-	ctx    context.Context
-	client ctrlruntimeclient.Client
-
-	machines       *prometheus.Desc
-	machineCreated *prometheus.Desc
-	machineDeleted *prometheus.Desc
+	ctx       context.Context
+	client    ctrlruntimeclient.Client
+	namespace string
+
+	machines        *prometheus.Desc
+	machineCreated  *prometheus.Desc
+	machineDeleted  *prometheus.Desc
+	machinePhase    *prometheus.Desc
+	machinesByPhase *prometheus.Desc
+
+	machineSetProvisioningSuccess *prometheus.Desc
+	machineSetTimeToJoin          *prometheus.Desc
+	machineSetInstances           *prometheus.Desc
+	machineSetHourlyPrice         *prometheus.Desc
+	machineSetCostCenter          *prometheus.Desc
 }
 
 type machineMetricLabels struct {
@@ -110,22 +134,20 @@ func (l *machineMetricLabels) Counter(value uint) prometheus.Counter {
 	return counter
 }
 
-func NewMachineCollector(ctx context.Context, client ctrlruntimeclient.Client) *MachineCollector {
+// NewMachineCollector returns a collector for the machines in the given namespace, which are all machines if it is empty.
+func NewMachineCollector(ctx context.Context, client ctrlruntimeclient.Client, namespace string) *MachineCollector {
 
 	// Start periodically calling the providers SetMetricsForMachines in a dedicated go routine
 	skg := providerconfig.NewConfigVarResolver(ctx, client)
 	go func() {
 		metricGatheringExecutor := func() {
 			machines := &clusterv1alpha1.MachineList{}
-			if err := client.List(ctx, machines); err != nil {
+			if err := client.List(ctx, machines, ctrlruntimeclient.InNamespace(namespace)); err != nil {
 				utilruntime.HandleError(fmt.Errorf("faild to list machines for SetMetricsForMachines: %v", err))
 				return
 			}
-			var machineList clusterv1alpha1.MachineList
-			for _, machine := range machines.Items {
-				machineList.Items = append(machineList.Items, *machine.DeepCopy())
-			}
-			if len(machineList.Items) < 1 {
+			// The list is a copy of the cache already, so the machines are passed to the providers without copying them again
+			if len(machines.Items) < 1 {
 				return
 			}
 
@@ -162,8 +184,9 @@ func NewMachineCollector(ctx context.Context, client ctrlruntimeclient.Client) *
 	}()
 
 	return &MachineCollector{
-		ctx:    ctx,
-		client: client,
+		ctx:       ctx,
+		client:    client,
+		namespace: namespace,
 
 		machines: prometheus.NewDesc(
 			metricsPrefix+"machines",
@@ -180,6 +203,41 @@ func NewMachineCollector(ctx context.Context, client ctrlruntimeclient.Client) *
 			"Timestamp of the machine's deletion time",
 			[]string{"machine"}, nil,
 		),
+		machinePhase: prometheus.NewDesc(
+			metricsPrefix+"machine_phase",
+			"The current phase of the machine",
+			[]string{"machine", "phase"}, nil,
+		),
+		machinesByPhase: prometheus.NewDesc(
+			metricsPrefix+"machines_by_phase",
+			"The number of machines by cloud provider and phase",
+			[]string{"provider", "phase"}, nil,
+		),
+		machineSetProvisioningSuccess: prometheus.NewDesc(
+			metricsPrefix+"machineset_provisioning_success_ratio",
+			"The ratio of the recently provisioned machines of the MachineSet whose node joined the cluster",
+			[]string{"namespace", "machineset"}, nil,
+		),
+		machineSetTimeToJoin: prometheus.NewDesc(
+			metricsPrefix+"machineset_time_to_join_seconds",
+			"The average duration from the creation of the instances of the recently provisioned machines of the MachineSet until their node joined the cluster",
+			[]string{"namespace", "machineset"}, nil,
+		),
+		machineSetInstances: prometheus.NewDesc(
+			metricsPrefix+"machineset_instances",
+			"The number of instances of the MachineSet by instance type",
+			[]string{"namespace", "machineset", "instance_type"}, nil,
+		),
+		machineSetHourlyPrice: prometheus.NewDesc(
+			metricsPrefix+"machineset_hourly_price",
+			"The total hourly price of the instances of the MachineSet, if the cloud provider publishes its prices",
+			[]string{"namespace", "machineset", "currency"}, nil,
+		),
+		machineSetCostCenter: prometheus.NewDesc(
+			metricsPrefix+"machineset_cost_center_info",
+			"The cost center labels of the MachineSet, to join with its instances and price",
+			[]string{"namespace", "machineset", "label", "value"}, nil,
+		),
 	}
 }
 
@@ -188,17 +246,25 @@ func (mc MachineCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- mc.machines
 	ch <- mc.machineCreated
 	ch <- mc.machineDeleted
+	ch <- mc.machinePhase
+	ch <- mc.machinesByPhase
+	ch <- mc.machineSetProvisioningSuccess
+	ch <- mc.machineSetTimeToJoin
+	ch <- mc.machineSetInstances
+	ch <- mc.machineSetHourlyPrice
+	ch <- mc.machineSetCostCenter
 }
 
 // Collect implements the prometheus.Collector interface.
 func (mc MachineCollector) Collect(ch chan<- prometheus.Metric) {
 	machines := &clusterv1alpha1.MachineList{}
-	if err := mc.client.List(mc.ctx, machines); err != nil {
+	if err := mc.client.List(mc.ctx, machines, ctrlruntimeclient.InNamespace(mc.namespace)); err != nil {
 		return
 	}
 
 	cvr := providerconfig.NewConfigVarResolver(mc.ctx, mc.client)
 	machineCountByLabels := make(map[*machineMetricLabels]uint)
+	machineCountByPhase := make(map[[2]string]uint)
 
 	for _, machine := range machines.Items {
 		ch <- prometheus.MustNewConstMetric(
@@ -217,12 +283,25 @@ func (mc MachineCollector) Collect(ch chan<- prometheus.Metric) {
 			)
 		}
 
+		if machine.Status.Phase != nil {
+			ch <- prometheus.MustNewConstMetric(
+				mc.machinePhase,
+				prometheus.GaugeValue,
+				1,
+				machine.Name,
+				*machine.Status.Phase,
+			)
+		}
+
 		providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
 		if err != nil {
 			utilruntime.HandleError(fmt.Errorf("failed to determine providerSpec for machine %s: %v", machine.Name, err))
 			continue
 		}
 
+		// The phase is computed, as machines of other controllers or paused ones may lack it
+		machineCountByPhase[[2]string{string(providerConfig.CloudProvider), machinePhase(&machine)}]++
+
 		provider, err := cloudprovider.ForProvider(providerConfig.CloudProvider, cvr)
 		if err != nil {
 			utilruntime.HandleError(fmt.Errorf("failed to determine provider provider: %v", err))
@@ -266,4 +345,88 @@ func (mc MachineCollector) Collect(ch chan<- prometheus.Metric) {
 	for info, count := range machineCountByLabels {
 		ch <- info.Counter(count)
 	}
+
+	for providerAndPhase, count := range machineCountByPhase {
+		ch <- prometheus.MustNewConstMetric(
+			mc.machinesByPhase,
+			prometheus.GaugeValue,
+			float64(count),
+			providerAndPhase[0],
+			providerAndPhase[1],
+		)
+	}
+
+	mc.collectMachineSets(ch)
+}
+
+// collectMachineSets exposes the provisioning status and the cost of the MachineSets, see
+// MachineSetStatus.Provisioning and MachineSetStatus.Cost
+func (mc MachineCollector) collectMachineSets(ch chan<- prometheus.Metric) {
+	machineSets := &clusterv1alpha1.MachineSetList{}
+	if err := mc.client.List(mc.ctx, machineSets, ctrlruntimeclient.InNamespace(mc.namespace)); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to list MachineSets for metrics: %v", err))
+		return
+	}
+
+	for _, machineSet := range machineSets.Items {
+		mc.collectMachineSetCost(ch, machineSet)
+		provisioning := machineSet.Status.Provisioning
+		if provisioning == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			mc.machineSetProvisioningSuccess,
+			prometheus.GaugeValue,
+			float64(provisioning.SucceededPercent)/100,
+			machineSet.Namespace,
+			machineSet.Name,
+		)
+		if provisioning.AverageTimeToJoin != nil {
+			ch <- prometheus.MustNewConstMetric(
+				mc.machineSetTimeToJoin,
+				prometheus.GaugeValue,
+				provisioning.AverageTimeToJoin.Seconds(),
+				machineSet.Namespace,
+				machineSet.Name,
+			)
+		}
+	}
+}
+
+func (mc MachineCollector) collectMachineSetCost(ch chan<- prometheus.Metric, machineSet clusterv1alpha1.MachineSet) {
+	cost := machineSet.Status.Cost
+	if cost == nil {
+		return
+	}
+	for _, instanceType := range cost.InstanceTypes {
+		ch <- prometheus.MustNewConstMetric(
+			mc.machineSetInstances,
+			prometheus.GaugeValue,
+			float64(instanceType.Instances),
+			machineSet.Namespace,
+			machineSet.Name,
+			instanceType.InstanceType,
+		)
+	}
+	if price, err := strconv.ParseFloat(cost.HourlyPrice, 64); err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			mc.machineSetHourlyPrice,
+			prometheus.GaugeValue,
+			price,
+			machineSet.Namespace,
+			machineSet.Name,
+			cost.Currency,
+		)
+	}
+	for label, value := range cost.CostCenter {
+		ch <- prometheus.MustNewConstMetric(
+			mc.machineSetCostCenter,
+			prometheus.GaugeValue,
+			1,
+			machineSet.Namespace,
+			machineSet.Name,
+			label,
+			value,
+		)
+	}
 }
@@ -0,0 +1,162 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// nodeIndex keys the names of the nodes by their provider IDs and addresses. It is kept up to date by the
+// node informer, so the node of an instance is found without listing all nodes, which is what makes
+// matching nodes expensive in clusters with thousands of nodes.
+type nodeIndex struct {
+	lock sync.RWMutex
+	// synced is set once all nodes got indexed, the informer replays the existing nodes asynchronously
+	synced       bool
+	byProviderID map[string]sets.String
+	byAddress    map[string]sets.String
+	// keys holds the provider ID and addresses each node is indexed under, so they can be dropped again
+	keys map[string]indexedNode
+}
+
+type indexedNode struct {
+	providerID string
+	addresses  []string
+}
+
+func newNodeIndex() *nodeIndex {
+	return &nodeIndex{
+		byProviderID: map[string]sets.String{},
+		byAddress:    map[string]sets.String{},
+		keys:         map[string]indexedNode{},
+	}
+}
+
+// handler returns the event handler which keeps the index up to date
+func (i *nodeIndex) handler() toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok {
+				i.set(node)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok {
+				i.set(node)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if node, ok := obj.(*corev1.Node); ok {
+				i.delete(node.Name)
+			}
+		},
+	}
+}
+
+// set indexes the given node, replacing its previous keys
+func (i *nodeIndex) set(node *corev1.Node) {
+	keys := indexedNode{providerID: strings.ToLower(node.Spec.ProviderID)}
+	for _, address := range node.Status.Addresses {
+		keys.addresses = append(keys.addresses, address.Address)
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.deleteLocked(node.Name)
+	if keys.providerID != "" {
+		addKey(i.byProviderID, keys.providerID, node.Name)
+	}
+	for _, address := range keys.addresses {
+		addKey(i.byAddress, address, node.Name)
+	}
+	i.keys[node.Name] = keys
+}
+
+// populate indexes the given nodes, which must be all nodes, and marks the index as synced
+func (i *nodeIndex) populate(nodes []corev1.Node) {
+	for idx := range nodes {
+		i.set(&nodes[idx])
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.synced = true
+}
+
+func (i *nodeIndex) isSynced() bool {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return i.synced
+}
+
+func (i *nodeIndex) delete(name string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.deleteLocked(name)
+}
+
+// deleteLocked drops the keys of the given node, the lock must be held
+func (i *nodeIndex) deleteLocked(name string) {
+	keys, found := i.keys[name]
+	if !found {
+		return
+	}
+	removeKey(i.byProviderID, keys.providerID, name)
+	for _, address := range keys.addresses {
+		removeKey(i.byAddress, address, name)
+	}
+	delete(i.keys, name)
+}
+
+// nodeNames returns the names of the nodes with one of the given provider IDs, compared case-insensitively,
+// or one of the given addresses
+func (i *nodeIndex) nodeNames(providerIDs []string, addresses []string) []string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	names := sets.NewString()
+	for _, providerID := range providerIDs {
+		names = names.Union(i.byProviderID[strings.ToLower(providerID)])
+	}
+	for _, address := range addresses {
+		names = names.Union(i.byAddress[address])
+	}
+	return names.List()
+}
+
+func addKey(index map[string]sets.String, key, name string) {
+	if index[key] == nil {
+		index[key] = sets.NewString()
+	}
+	index[key].Insert(name)
+}
+
+func removeKey(index map[string]sets.String, key, name string) {
+	if index[key] == nil {
+		return
+	}
+	index[key].Delete(name)
+	if index[key].Len() == 0 {
+		delete(index, key)
+	}
+}
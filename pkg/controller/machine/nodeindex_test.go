@@ -0,0 +1,75 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+func TestNodeIndex(t *testing.T) {
+	index := newNodeIndex()
+	handler := index.handler()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}},
+		},
+	}
+
+	handler.OnAdd(node)
+	if names := index.nodeNames(nil, []string{"10.0.0.1"}); !reflect.DeepEqual(names, []string{"node-1"}) {
+		t.Errorf("expected the node to be found by its address, got %v", names)
+	}
+
+	updated := node.DeepCopy()
+	updated.Spec.ProviderID = "Azure:///Subscriptions/VM-1"
+	updated.Status.Addresses[0].Address = "10.0.0.2"
+	handler.OnUpdate(node, updated)
+	if names := index.nodeNames([]string{"azure:///subscriptions/vm-1"}, nil); !reflect.DeepEqual(names, []string{"node-1"}) {
+		t.Errorf("expected the node to be found by its provider ID regardless of the case, got %v", names)
+	}
+	if names := index.nodeNames(nil, []string{"10.0.0.1"}); len(names) != 0 {
+		t.Errorf("expected the previous address to be dropped, got %v", names)
+	}
+
+	handler.OnDelete(toolscache.DeletedFinalStateUnknown{Key: "node-1", Obj: updated})
+	if names := index.nodeNames([]string{"azure:///subscriptions/vm-1"}, []string{"10.0.0.2"}); len(names) != 0 {
+		t.Errorf("expected the deleted node to be dropped, got %v", names)
+	}
+	if len(index.byProviderID) != 0 || len(index.byAddress) != 0 || len(index.keys) != 0 {
+		t.Errorf("expected the index to be empty, got %v, %v and %v", index.byProviderID, index.byAddress, index.keys)
+	}
+}
+
+func TestMayOwnNode(t *testing.T) {
+	node := &corev1.Node{Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Address: "10.0.0.1"}}}}
+
+	if !mayOwnNode(nil, node) {
+		t.Error("expected a machine without known addresses to possibly own the node")
+	}
+	if !mayOwnNode([]corev1.NodeAddress{{Address: "10.0.0.1"}}, node) {
+		t.Error("expected a machine sharing an address to possibly own the node")
+	}
+	if mayOwnNode([]corev1.NodeAddress{{Address: "10.0.0.2"}}, node) {
+		t.Error("expected a machine with other addresses not to own the node")
+	}
+}
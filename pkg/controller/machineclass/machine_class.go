@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machineclass
+
+import (
+	"context"
+	"fmt"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// ControllerName is name of the MachineClass controller
+const ControllerName = "machine_class_controller"
+
+type reconciler struct {
+	client.Client
+	recorder record.EventRecorder
+}
+
+func Add(mgr manager.Manager) error {
+	r := &reconciler{Client: mgr.GetClient(), recorder: mgr.GetEventRecorderFor(ControllerName)}
+	c, err := controller.New(ControllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return fmt.Errorf("failed to construct controller: %v", err)
+	}
+	return c.Watch(&source.Kind{Type: &clusterv1alpha1.MachineClass{}}, &handler.EnqueueRequestForObject{})
+}
+
+func (r *reconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	machineClass := &clusterv1alpha1.MachineClass{}
+	if err := r.Get(ctx, request.NamespacedName, machineClass); err != nil {
+		if kerrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if err := r.reconcile(ctx, machineClass); err != nil {
+		klog.Errorf("Reconciliation of MachineClass %s failed: %v", machineClass.Name, err)
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// reconcile updates the MachineDeployments and MachineSets whose template got an older version of
+// the given class applied. The webhook applies the class on every update, which rolls out the
+// MachineDeployments. MachineSets controlled by a MachineDeployment get the class through it.
+func (r *reconciler) reconcile(ctx context.Context, machineClass *clusterv1alpha1.MachineClass) error {
+	classSpec, err := providerconfig.MachineClassSpec(machineClass)
+	if err != nil {
+		// Only a change of the class can fix this, which triggers a new reconciliation anyway
+		r.recorder.Event(machineClass, corev1.EventTypeWarning, "InvalidProviderSpec", err.Error())
+		return nil
+	}
+
+	machineDeployments := &clusterv1alpha1.MachineDeploymentList{}
+	if err := r.List(ctx, machineDeployments); err != nil {
+		return fmt.Errorf("failed to list MachineDeployments: %v", err)
+	}
+	machineSets := &clusterv1alpha1.MachineSetList{}
+	if err := r.List(ctx, machineSets); err != nil {
+		return fmt.Errorf("failed to list MachineSets: %v", err)
+	}
+
+	var errs []error
+	for i := range machineDeployments.Items {
+		machineDeployment := &machineDeployments.Items[i]
+		if outdated(&machineDeployment.Spec.Template, machineClass.Name, classSpec) {
+			errs = append(errs, r.refresh(ctx, machineClass, "MachineDeployment", machineDeployment, &machineDeployment.ObjectMeta))
+		}
+	}
+	for i := range machineSets.Items {
+		machineSet := &machineSets.Items[i]
+		if owner := metav1.GetControllerOf(machineSet); owner != nil && owner.Kind == "MachineDeployment" {
+			continue
+		}
+		if outdated(&machineSet.Spec.Template, machineClass.Name, classSpec) {
+			errs = append(errs, r.refresh(ctx, machineClass, "MachineSet", machineSet, &machineSet.ObjectMeta))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// refresh updates the given object unchanged, so the webhook applies the current class.
+func (r *reconciler) refresh(ctx context.Context, machineClass *clusterv1alpha1.MachineClass, kind string, obj runtime.Object, meta *metav1.ObjectMeta) error {
+	if err := r.Update(ctx, obj); err != nil {
+		r.recorder.Eventf(machineClass, corev1.EventTypeWarning, "UpdateFailed", "Failed to apply the class to %s %s/%s: %v", kind, meta.Namespace, meta.Name, err)
+		return fmt.Errorf("failed to update %s %s/%s: %v", kind, meta.Namespace, meta.Name, err)
+	}
+	klog.V(2).Infof("Applied MachineClass %s to %s %s/%s", machineClass.Name, kind, meta.Namespace, meta.Name)
+	return nil
+}
+
+// outdated returns whether the given template references the class, but got a different version of
+// it applied.
+func outdated(template *clusterv1alpha1.MachineTemplateSpec, className, classSpec string) bool {
+	valueFrom := template.Spec.ProviderSpec.ValueFrom
+	if valueFrom == nil || valueFrom.MachineClass == nil || valueFrom.MachineClass.ObjectReference == nil || valueFrom.MachineClass.Name != className {
+		return false
+	}
+	return template.Annotations[providerconfig.MachineClassSpecAnnotation] != classSpec
+}
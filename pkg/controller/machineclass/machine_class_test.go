@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machineclass
+
+import (
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestOutdated(t *testing.T) {
+	const classSpec = `{"cloudProvider":"hetzner","operatingSystem":"ubuntu"}`
+	template := func(className, annotation string) *clusterv1alpha1.MachineTemplateSpec {
+		template := &clusterv1alpha1.MachineTemplateSpec{}
+		if className != "" {
+			template.Spec.ProviderSpec.ValueFrom = &clusterv1alpha1.ProviderSpecSource{
+				MachineClass: &clusterv1alpha1.MachineClassRef{ObjectReference: &corev1.ObjectReference{Name: className}},
+			}
+		}
+		if annotation != "" {
+			template.Annotations = map[string]string{providerconfig.MachineClassSpecAnnotation: annotation}
+		}
+		return template
+	}
+
+	tests := []struct {
+		name     string
+		template *clusterv1alpha1.MachineTemplateSpec
+		outdated bool
+	}{
+		{
+			name:     "no machine class",
+			template: template("", ""),
+		},
+		{
+			name:     "other machine class",
+			template: template("aws-t3", `{"cloudProvider":"aws"}`),
+		},
+		{
+			name:     "current machine class",
+			template: template("hetzner-cx21", classSpec),
+		},
+		{
+			name:     "changed machine class",
+			template: template("hetzner-cx21", `{"cloudProvider":"hetzner","operatingSystem":"flatcar"}`),
+			outdated: true,
+		},
+		{
+			name:     "machine class never applied",
+			template: template("hetzner-cx21", ""),
+			outdated: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if outdated := outdated(test.template, "hetzner-cx21", classSpec); outdated != test.outdated {
+				t.Errorf("Expected outdated to be %t, but got %t", test.outdated, outdated)
+			}
+		})
+	}
+}
@@ -363,6 +363,10 @@ func calculateStatus(allMSs []*clusterv1alpha1.MachineSet, newMS *clusterv1alpha
 		AvailableReplicas:   availableReplicas,
 		UnavailableReplicas: unavailableReplicas,
 	}
+	// The scale subresource reports the selector, the webhook already rejected invalid ones
+	if selector, err := metav1.LabelSelectorAsSelector(&deployment.Spec.Selector); err == nil {
+		status.LabelSelector = selector.String()
+	}
 
 	return status
 }
@@ -132,7 +132,7 @@ func MaxRevision(allMSs []*v1alpha1.MachineSet) int64 {
 	for _, ms := range allMSs {
 		if v, err := Revision(ms); err != nil {
 			// Skip the machine sets when it failed to parse their revision information
-			klog.V(4).Infof("Error: %v. Couldn't parse revision for machine set %#v, deployment controller will skip it when reconciling revisions.", err, ms)
+			klog.V(4).Infof("Error: %v. Couldn't parse revision for machine set %s/%s, deployment controller will skip it when reconciling revisions.", err, ms.Namespace, ms.Name)
 		} else if v > max {
 			max = v
 		}
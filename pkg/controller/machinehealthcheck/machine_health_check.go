@@ -0,0 +1,282 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinehealthcheck
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+	"github.com/kubermatic/machine-controller/pkg/targetcluster"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// ControllerName is name of the MachineHealthCheck controller
+	ControllerName = "machine_health_check_controller"
+
+	defaultNodeStartupTimeout = 10 * time.Minute
+)
+
+var defaultMaxUnhealthy = intstr.FromString("100%")
+
+type reconciler struct {
+	client.Client
+	// targetClient accesses the cluster the nodes join
+	targetClient client.Client
+	recorder     record.EventRecorder
+}
+
+func Add(mgr manager.Manager, targetCluster *targetcluster.Cluster) error {
+	r := &reconciler{Client: mgr.GetClient(), targetClient: targetCluster.Client, recorder: mgr.GetEventRecorderFor(ControllerName)}
+	c, err := controller.New(ControllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return fmt.Errorf("failed to construct controller: %v", err)
+	}
+
+	if err := c.Watch(&source.Kind{Type: &clusterv1alpha1.MachineHealthCheck{}}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+	if err := c.Watch(
+		&source.Kind{Type: &clusterv1alpha1.Machine{}},
+		&handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(machine handler.MapObject) []reconcile.Request {
+				return r.healthChecksInNamespace(machine.Meta.GetNamespace())
+			}),
+		},
+	); err != nil {
+		return err
+	}
+	// The timeouts are covered by requeueing, so only changes of the node conditions matter
+	nodeSource, err := targetCluster.Source(&corev1.Node{})
+	if err != nil {
+		return err
+	}
+	return c.Watch(
+		nodeSource,
+		&handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(node handler.MapObject) []reconcile.Request {
+				return r.healthChecksInNamespace(metav1.NamespaceAll)
+			}),
+		},
+		predicate.Funcs{UpdateFunc: func(e event.UpdateEvent) bool {
+			return !conditionsEqual(e.ObjectOld.(*corev1.Node).Status.Conditions, e.ObjectNew.(*corev1.Node).Status.Conditions)
+		}},
+	)
+}
+
+func (r *reconciler) healthChecksInNamespace(namespace string) []reconcile.Request {
+	healthChecks := &clusterv1alpha1.MachineHealthCheckList{}
+	if err := r.List(context.Background(), healthChecks, client.InNamespace(namespace)); err != nil {
+		utilruntime.HandleError(fmt.Errorf("failed to list MachineHealthChecks: %v", err))
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, healthCheck := range healthChecks.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: healthCheck.Namespace,
+			Name:      healthCheck.Name,
+		}})
+	}
+	return requests
+}
+
+func conditionsEqual(old, new []corev1.NodeCondition) bool {
+	if len(old) != len(new) {
+		return false
+	}
+	for i := range old {
+		if old[i].Type != new[i].Type || old[i].Status != new[i].Status {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *reconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	healthCheck := &clusterv1alpha1.MachineHealthCheck{}
+	if err := r.Get(ctx, request.NamespacedName, healthCheck); err != nil {
+		if kerrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	result, err := r.reconcile(ctx, healthCheck, time.Now())
+	if err != nil {
+		klog.Errorf("Reconciliation of MachineHealthCheck %s failed: %v", request.NamespacedName.String(), err)
+	}
+	return result, err
+}
+
+func (r *reconciler) reconcile(ctx context.Context, healthCheck *clusterv1alpha1.MachineHealthCheck, now time.Time) (reconcile.Result, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&healthCheck.Spec.Selector)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to parse selector: %v", err)
+	}
+	machines := &clusterv1alpha1.MachineList{}
+	if err := r.List(ctx, machines, &client.ListOptions{Namespace: healthCheck.Namespace, LabelSelector: selector}); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to list machines: %v", err)
+	}
+
+	var (
+		targets   int
+		unhealthy = map[*clusterv1alpha1.Machine]string{}
+		recheck   time.Duration
+	)
+	for i := range machines.Items {
+		machine := &machines.Items[i]
+		// Deleting other machines would not get them replaced
+		if machine.DeletionTimestamp != nil || !ownedByMachineSet(machine) {
+			continue
+		}
+		targets++
+
+		node, err := r.getNode(ctx, machine)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		reason, after := machineHealth(healthCheck, machine, node, now)
+		if reason != "" {
+			unhealthy[machine] = reason
+		} else if after > 0 && (recheck == 0 || after < recheck) {
+			recheck = after
+		}
+	}
+
+	if err := r.updateStatus(ctx, healthCheck, int32(targets), int32(targets-len(unhealthy))); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	maxUnhealthy := &defaultMaxUnhealthy
+	if healthCheck.Spec.MaxUnhealthy != nil {
+		maxUnhealthy = healthCheck.Spec.MaxUnhealthy
+	}
+	max, err := intstr.GetValueFromIntOrPercent(maxUnhealthy, targets, false)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("invalid maxUnhealthy: %v", err)
+	}
+	if len(unhealthy) > max {
+		r.recorder.Eventf(healthCheck, corev1.EventTypeWarning, "RemediationRestricted",
+			"Not remediating, %d of %d machines are unhealthy which exceeds maxUnhealthy %s", len(unhealthy), targets, maxUnhealthy.String())
+		return reconcile.Result{RequeueAfter: recheck}, nil
+	}
+
+	for machine, reason := range unhealthy {
+		// Deleting protected machines would leave them deleting until the annotation is removed
+		if machinecontroller.IsDeleteProtected(machine) {
+			r.recorder.Eventf(machine, corev1.EventTypeWarning, "RemediationSkipped", "Not deleted by MachineHealthCheck %s because of the %q annotation: %s",
+				healthCheck.Name, machinecontroller.AnnotationDeleteProtection, reason)
+			continue
+		}
+		klog.V(2).Infof("Deleting unhealthy machine %s/%s: %s", machine.Namespace, machine.Name, reason)
+		if err := r.Delete(ctx, machine); err != nil && !kerrors.IsNotFound(err) {
+			return reconcile.Result{}, fmt.Errorf("failed to delete unhealthy machine %s: %v", machine.Name, err)
+		}
+		r.recorder.Eventf(machine, corev1.EventTypeNormal, "MachineUnhealthy", "Deleted by MachineHealthCheck %s: %s", healthCheck.Name, reason)
+	}
+	return reconcile.Result{RequeueAfter: recheck}, nil
+}
+
+func ownedByMachineSet(machine *clusterv1alpha1.Machine) bool {
+	owner := metav1.GetControllerOf(machine)
+	return owner != nil && owner.Kind == "MachineSet"
+}
+
+func (r *reconciler) getNode(ctx context.Context, machine *clusterv1alpha1.Machine) (*corev1.Node, error) {
+	if machine.Status.NodeRef == nil {
+		return nil, nil
+	}
+	node := &corev1.Node{}
+	if err := r.targetClient.Get(ctx, types.NamespacedName{Name: machine.Status.NodeRef.Name}, node); err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get node %s: %v", machine.Status.NodeRef.Name, err)
+	}
+	return node, nil
+}
+
+// machineHealth returns why the given machine is unhealthy, or when it has to be checked again
+// because one of its node conditions or its startup is about to time out.
+func machineHealth(healthCheck *clusterv1alpha1.MachineHealthCheck, machine *clusterv1alpha1.Machine, node *corev1.Node, now time.Time) (string, time.Duration) {
+	if machine.Status.NodeRef == nil {
+		timeout := defaultNodeStartupTimeout
+		if healthCheck.Spec.NodeStartupTimeout != nil {
+			timeout = healthCheck.Spec.NodeStartupTimeout.Duration
+		}
+		elapsed := now.Sub(machine.CreationTimestamp.Time)
+		if elapsed >= timeout {
+			return fmt.Sprintf("no node joined within %s", timeout), 0
+		}
+		return "", timeout - elapsed
+	}
+	if node == nil {
+		return fmt.Sprintf("node %s is gone", machine.Status.NodeRef.Name), 0
+	}
+
+	var recheck time.Duration
+	for _, unhealthyCondition := range healthCheck.Spec.UnhealthyConditions {
+		for _, condition := range node.Status.Conditions {
+			if condition.Type != unhealthyCondition.Type || condition.Status != unhealthyCondition.Status {
+				continue
+			}
+			elapsed := now.Sub(condition.LastTransitionTime.Time)
+			if elapsed >= unhealthyCondition.Timeout.Duration {
+				return fmt.Sprintf("node condition %s has been %s for more than %s", condition.Type, condition.Status, unhealthyCondition.Timeout.Duration), 0
+			}
+			if remaining := unhealthyCondition.Timeout.Duration - elapsed; recheck == 0 || remaining < recheck {
+				recheck = remaining
+			}
+		}
+	}
+	return "", recheck
+}
+
+func (r *reconciler) updateStatus(ctx context.Context, healthCheck *clusterv1alpha1.MachineHealthCheck, expected, healthy int32) error {
+	if healthCheck.Status.ExpectedMachines == expected && healthCheck.Status.CurrentHealthy == healthy {
+		return nil
+	}
+	updated := healthCheck.DeepCopy()
+	updated.Status.ExpectedMachines = expected
+	updated.Status.CurrentHealthy = healthy
+	if err := r.Status().Update(ctx, updated); err != nil {
+		return fmt.Errorf("failed to update status: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machinehealthcheck
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func init() {
+	if err := clusterv1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		klog.Fatalf("failed to add clusterv1alpha1 api to scheme: %v", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Now()
+	machine := func(name, nodeName string, age time.Duration) *clusterv1alpha1.Machine {
+		m := &clusterv1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         metav1.NamespaceSystem,
+				Labels:            map[string]string{"pool": "workers"},
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: clusterv1alpha1.SchemeGroupVersion.String(),
+					Kind:       "MachineSet",
+					Name:       "workers",
+					Controller: boolPtr(true),
+				}},
+			},
+		}
+		if nodeName != "" {
+			m.Status.NodeRef = &corev1.ObjectReference{Name: nodeName}
+		}
+		return m
+	}
+	node := func(name string, ready corev1.ConditionStatus, since time.Duration) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{
+					Type:               corev1.NodeReady,
+					Status:             ready,
+					LastTransitionTime: metav1.NewTime(now.Add(-since)),
+				}},
+			},
+		}
+	}
+	unowned := machine("unowned", "", time.Hour)
+	unowned.OwnerReferences = nil
+	protected := machine("protected", "", time.Hour)
+	protected.Annotations = map[string]string{machinecontroller.AnnotationDeleteProtection: "true"}
+	maxUnhealthy := intstr.FromInt(1)
+
+	tests := []struct {
+		name            string
+		maxUnhealthy    *intstr.IntOrString
+		objects         []runtime.Object
+		expectedDeleted []string
+		expectedHealthy int32
+		shouldRequeue   bool
+	}{
+		{
+			name: "all machines healthy",
+			objects: []runtime.Object{
+				machine("machine1", "node1", time.Hour), node("node1", corev1.ConditionTrue, time.Hour),
+			},
+			expectedHealthy: 1,
+		},
+		{
+			name: "node not ready for less than the timeout",
+			objects: []runtime.Object{
+				machine("machine1", "node1", time.Hour), node("node1", corev1.ConditionFalse, time.Minute),
+			},
+			expectedHealthy: 1,
+			shouldRequeue:   true,
+		},
+		{
+			name: "node not ready for more than the timeout",
+			objects: []runtime.Object{
+				machine("machine1", "node1", time.Hour), node("node1", corev1.ConditionFalse, 10*time.Minute),
+			},
+			expectedDeleted: []string{"machine1"},
+		},
+		{
+			name: "node is gone",
+			objects: []runtime.Object{
+				machine("machine1", "node1", time.Hour),
+			},
+			expectedDeleted: []string{"machine1"},
+		},
+		{
+			name: "machine still joining",
+			objects: []runtime.Object{
+				machine("machine1", "", time.Minute),
+			},
+			expectedHealthy: 1,
+			shouldRequeue:   true,
+		},
+		{
+			name: "machine stuck joining",
+			objects: []runtime.Object{
+				machine("machine1", "", time.Hour),
+			},
+			expectedDeleted: []string{"machine1"},
+		},
+		{
+			name: "machine not owned by a MachineSet",
+			objects: []runtime.Object{
+				unowned,
+			},
+		},
+		{
+			name: "unhealthy machine with delete protection",
+			objects: []runtime.Object{
+				protected,
+				machine("machine1", "", time.Hour),
+			},
+			expectedDeleted: []string{"machine1"},
+		},
+		{
+			name:         "more unhealthy machines than allowed",
+			maxUnhealthy: &maxUnhealthy,
+			objects: []runtime.Object{
+				machine("machine1", "", time.Hour),
+				machine("machine2", "node2", time.Hour),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			healthCheck := &clusterv1alpha1.MachineHealthCheck{
+				ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: metav1.NamespaceSystem},
+				Spec: clusterv1alpha1.MachineHealthCheckSpec{
+					Selector: metav1.LabelSelector{MatchLabels: map[string]string{"pool": "workers"}},
+					UnhealthyConditions: []clusterv1alpha1.UnhealthyCondition{{
+						Type:    corev1.NodeReady,
+						Status:  corev1.ConditionFalse,
+						Timeout: metav1.Duration{Duration: 5 * time.Minute},
+					}},
+					MaxUnhealthy: test.maxUnhealthy,
+				},
+			}
+			client := ctrlruntimefake.NewFakeClient(append(test.objects, healthCheck)...)
+			r := &reconciler{Client: client, targetClient: client, recorder: record.NewFakeRecorder(10)}
+
+			result, err := r.reconcile(context.Background(), healthCheck, now)
+			if err != nil {
+				t.Fatalf("reconcile failed: %v", err)
+			}
+			if requeued := result.RequeueAfter > 0; requeued != test.shouldRequeue {
+				t.Errorf("Expected to be requeued: %t, but requeued after %s", test.shouldRequeue, result.RequeueAfter)
+			}
+
+			deleted := map[string]bool{}
+			for _, name := range test.expectedDeleted {
+				deleted[name] = true
+			}
+			for _, obj := range test.objects {
+				m, ok := obj.(*clusterv1alpha1.Machine)
+				if !ok {
+					continue
+				}
+				err := client.Get(context.Background(), types.NamespacedName{Namespace: m.Namespace, Name: m.Name}, &clusterv1alpha1.Machine{})
+				if isDeleted := kerrors.IsNotFound(err); isDeleted != deleted[m.Name] {
+					t.Errorf("Expected machine %s to be deleted: %t, but deleted: %t (err: %v)", m.Name, deleted[m.Name], isDeleted, err)
+				}
+			}
+
+			updated := &clusterv1alpha1.MachineHealthCheck{}
+			if err := client.Get(context.Background(), types.NamespacedName{Namespace: healthCheck.Namespace, Name: healthCheck.Name}, updated); err != nil {
+				t.Fatalf("failed to get MachineHealthCheck: %v", err)
+			}
+			if updated.Status.CurrentHealthy != test.expectedHealthy {
+				t.Errorf("Expected %d healthy machines, but got %d", test.expectedHealthy, updated.Status.CurrentHealthy)
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machineset
+
+import (
+	"context"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// capacityRecheckInterval is how long a MachineSet whose missing replicas exceed the quotas of the
+// cloud provider waits before the quotas are checked again.
+var capacityRecheckInterval = 2 * time.Minute
+
+// checkCapacity checks once whether the quotas of the cloud provider allow creating the missing replicas of
+// the MachineSet, instead of letting each of the machines run into the quota. It returns the
+// CapacityAvailable condition, or nil if the MachineSet doesn't scale up or the provider can't check its
+// quotas. Failing checks are logged and don't block the MachineSet.
+func (r *ReconcileMachineSet) checkCapacity(ctx context.Context, ms *clusterv1alpha1.MachineSet, machines []*clusterv1alpha1.Machine) *clusterv1alpha1.MachineSetCondition {
+	if ms.Spec.Replicas == nil || int(*ms.Spec.Replicas) <= len(machines) {
+		return nil
+	}
+	missing := int(*ms.Spec.Replicas) - len(machines)
+
+	providerConfig, err := providerconfigtypes.GetConfig(ms.Spec.Template.Spec.ProviderSpec)
+	if err != nil {
+		klog.V(4).Infof("Not checking capacity of MachineSet %s/%s: failed to get provider config: %v", ms.Namespace, ms.Name, err)
+		return nil
+	}
+	prov, err := cloudprovider.ForProvider(providerConfig.CloudProvider, providerconfig.NewConfigVarResolver(ctx, r.Client))
+	if err != nil {
+		klog.V(4).Infof("Not checking capacity of MachineSet %s/%s: %v", ms.Namespace, ms.Name, err)
+		return nil
+	}
+	checker, ok := prov.(cloudprovidertypes.CapacityChecker)
+	if !ok {
+		return nil
+	}
+
+	err = checker.CheckCapacity(ms.Spec.Template.Spec, missing)
+	if err == cloudprovidererrors.ErrCapacityCheckNotSupported {
+		return nil
+	}
+	if ok, reason, message := cloudprovidererrors.IsTerminalError(err); ok && reason == common.QuotaExceededMachineError {
+		return &clusterv1alpha1.MachineSetCondition{
+			Type:    clusterv1alpha1.MachineSetCapacityAvailable,
+			Status:  corev1.ConditionFalse,
+			Reason:  string(reason),
+			Message: message,
+		}
+	}
+	if err != nil {
+		klog.Warningf("Failed to check capacity of MachineSet %s/%s, creating its machines anyway: %v", ms.Namespace, ms.Name, err)
+		return nil
+	}
+	return &clusterv1alpha1.MachineSetCondition{
+		Type:   clusterv1alpha1.MachineSetCapacityAvailable,
+		Status: corev1.ConditionTrue,
+	}
+}
+
+// getCondition returns the condition of the given type or nil
+func getCondition(conditions []clusterv1alpha1.MachineSetCondition, conditionType clusterv1alpha1.MachineSetConditionType) *clusterv1alpha1.MachineSetCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// setCondition returns a copy of the conditions with the given condition added or replaced. The last
+// transition time is kept if the status of the condition didn't change.
+func setCondition(conditions []clusterv1alpha1.MachineSetCondition, condition clusterv1alpha1.MachineSetCondition, now metav1.Time) []clusterv1alpha1.MachineSetCondition {
+	result := append([]clusterv1alpha1.MachineSetCondition{}, conditions...)
+	existing := getCondition(result, condition.Type)
+	if existing == nil {
+		condition.LastTransitionTime = now
+		return append(result, condition)
+	}
+	if existing.Status == condition.Status {
+		condition.LastTransitionTime = existing.LastTransitionTime
+	} else {
+		condition.LastTransitionTime = now
+	}
+	*existing = condition
+	return result
+}
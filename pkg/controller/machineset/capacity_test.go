@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machineset
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	before := metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(before.Add(time.Hour))
+	exceeded := v1alpha1.MachineSetCondition{
+		Type:    v1alpha1.MachineSetCapacityAvailable,
+		Status:  corev1.ConditionFalse,
+		Reason:  "QuotaExceeded",
+		Message: "droplet limit reached",
+	}
+	available := v1alpha1.MachineSetCondition{
+		Type:   v1alpha1.MachineSetCapacityAvailable,
+		Status: corev1.ConditionTrue,
+	}
+
+	tests := []struct {
+		name                       string
+		conditions                 []v1alpha1.MachineSetCondition
+		condition                  v1alpha1.MachineSetCondition
+		expectedStatus             corev1.ConditionStatus
+		expectedLastTransitionTime metav1.Time
+	}{
+		{
+			name:                       "new condition",
+			condition:                  exceeded,
+			expectedStatus:             corev1.ConditionFalse,
+			expectedLastTransitionTime: now,
+		},
+		{
+			name:                       "unchanged status keeps the transition time",
+			conditions:                 []v1alpha1.MachineSetCondition{withTransition(exceeded, before)},
+			condition:                  exceeded,
+			expectedStatus:             corev1.ConditionFalse,
+			expectedLastTransitionTime: before,
+		},
+		{
+			name:                       "changed status",
+			conditions:                 []v1alpha1.MachineSetCondition{withTransition(exceeded, before)},
+			condition:                  available,
+			expectedStatus:             corev1.ConditionTrue,
+			expectedLastTransitionTime: now,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conditions := setCondition(test.conditions, test.condition, now)
+			if len(conditions) != 1 {
+				t.Fatalf("expected 1 condition, got %d", len(conditions))
+			}
+			if conditions[0].Status != test.expectedStatus {
+				t.Errorf("expected status %s, got %s", test.expectedStatus, conditions[0].Status)
+			}
+			if !conditions[0].LastTransitionTime.Equal(&test.expectedLastTransitionTime) {
+				t.Errorf("expected last transition time %v, got %v", test.expectedLastTransitionTime, conditions[0].LastTransitionTime)
+			}
+			if len(test.conditions) > 0 && !test.conditions[0].LastTransitionTime.Equal(&before) {
+				t.Errorf("expected the given conditions to be left unchanged")
+			}
+		})
+	}
+}
+
+func withTransition(condition v1alpha1.MachineSetCondition, lastTransitionTime metav1.Time) v1alpha1.MachineSetCondition {
+	condition.LastTransitionTime = lastTransitionTime
+	return condition
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machineset
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+	cloudprovidertypes "github.com/kubermatic/machine-controller/pkg/cloudprovider/types"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	gocache "github.com/patrickmn/go-cache"
+	"k8s.io/klog"
+)
+
+// unknownInstanceType is reported for machines whose cloud provider doesn't tell their instance type
+const unknownInstanceType = "unknown"
+
+// priceTTL is how long the prices of instance types are cached. They rarely change, while MachineSets get
+// reconciled on every change of their machines.
+const priceTTL = time.Hour
+
+type hourlyPrice struct {
+	price    float64
+	currency string
+}
+
+// prices caches the hourly prices by the cloud provider and the hash of the provider spec they were looked up for
+var prices = gocache.New(priceTTL, priceTTL)
+
+// priceFunc returns the hourly price of an instance of the given instance type and its currency
+type priceFunc func(instanceType string) (float64, string, error)
+
+// reportCost returns the cost status of the MachineSet: its cost center labels, the number of its machines with
+// an instance by instance type and, if the cloud provider publishes them, their prices. Machines being deleted
+// are included, as their instances cost until they are gone. Failing lookups of prices are logged and leave the
+// prices unset.
+func (r *ReconcileMachineSet) reportCost(ctx context.Context, ms *clusterv1alpha1.MachineSet, machines []*clusterv1alpha1.Machine) *clusterv1alpha1.MachineSetCostStatus {
+	costCenter := map[string]string{}
+	for _, key := range r.costCenterLabels {
+		if value, ok := ms.Spec.Template.Spec.Labels[key]; ok {
+			costCenter[key] = value
+		}
+	}
+
+	providerConfig, err := providerconfigtypes.GetConfig(ms.Spec.Template.Spec.ProviderSpec)
+	if err != nil {
+		klog.V(4).Infof("Not reporting cost of MachineSet %s/%s: failed to get provider config: %v", ms.Namespace, ms.Name, err)
+		return costStatus(costCenter, nil, nil)
+	}
+	prov, err := cloudprovider.ForProvider(providerConfig.CloudProvider, providerconfig.NewConfigVarResolver(ctx, r.Client))
+	if err != nil {
+		klog.V(4).Infof("Not reporting cost of MachineSet %s/%s: %v", ms.Namespace, ms.Name, err)
+		return costStatus(costCenter, nil, nil)
+	}
+
+	counts := map[string]int32{}
+	// The prices are looked up for the spec of a machine of each instance type, as the instance type of
+	// the template may be resolved from its instance requirements
+	specs := map[string]clusterv1alpha1.MachineSpec{}
+	for _, machine := range machines {
+		if !machinecontroller.HasInstance(machine) {
+			continue
+		}
+		instanceType := unknownInstanceType
+		if labels, err := prov.MachineMetricsLabels(machine); err == nil && labels["size"] != "" {
+			instanceType = labels["size"]
+		}
+		counts[instanceType]++
+		specs[instanceType] = machine.Spec
+	}
+
+	return costStatus(costCenter, counts, func(instanceType string) (float64, string, error) {
+		if instanceType == unknownInstanceType {
+			return 0, "", cloudprovidererrors.ErrPricingNotSupported
+		}
+		return lookupPrice(prov, providerConfig.CloudProvider, specs[instanceType])
+	})
+}
+
+// lookupPrice returns the hourly price of an instance of the spec, which is cached for priceTTL
+func lookupPrice(prov cloudprovidertypes.Provider, cloudProvider providerconfigtypes.CloudProvider, spec clusterv1alpha1.MachineSpec) (float64, string, error) {
+	pricer, ok := prov.(cloudprovidertypes.InstancePricer)
+	if !ok || spec.ProviderSpec.Value == nil {
+		return 0, "", cloudprovidererrors.ErrPricingNotSupported
+	}
+	key := fmt.Sprintf("%s-%x", cloudProvider, sha256.Sum256(spec.ProviderSpec.Value.Raw))
+	if cached, found := prices.Get(key); found {
+		return cached.(hourlyPrice).price, cached.(hourlyPrice).currency, nil
+	}
+	price, currency, err := pricer.HourlyPrice(spec)
+	if err != nil {
+		return 0, "", err
+	}
+	prices.SetDefault(key, hourlyPrice{price: price, currency: currency})
+	return price, currency, nil
+}
+
+// costStatus builds the cost status from the number of instances by instance type. The total price is only
+// set if the prices of all instance types are known and share their currency.
+func costStatus(costCenter map[string]string, counts map[string]int32, price priceFunc) *clusterv1alpha1.MachineSetCostStatus {
+	status := &clusterv1alpha1.MachineSetCostStatus{}
+	if len(costCenter) > 0 {
+		status.CostCenter = costCenter
+	}
+	for instanceType, count := range counts {
+		status.InstanceTypes = append(status.InstanceTypes, clusterv1alpha1.MachineSetInstanceTypeCost{InstanceType: instanceType, Instances: count})
+	}
+	sort.Slice(status.InstanceTypes, func(i, j int) bool {
+		return status.InstanceTypes[i].InstanceType < status.InstanceTypes[j].InstanceType
+	})
+
+	allPriced := len(status.InstanceTypes) > 0
+	var total float64
+	for i := range status.InstanceTypes {
+		instanceType := &status.InstanceTypes[i]
+		hourly, currency, err := price(instanceType.InstanceType)
+		if err != nil {
+			if err != cloudprovidererrors.ErrPricingNotSupported {
+				klog.V(2).Infof("Failed to get the price of instance type %s: %v", instanceType.InstanceType, err)
+			}
+			allPriced = false
+			continue
+		}
+		if status.Currency != "" && currency != status.Currency {
+			allPriced = false
+			continue
+		}
+		status.Currency = currency
+		instanceType.HourlyPrice = formatPrice(hourly)
+		total += hourly * float64(instanceType.Instances)
+	}
+	if allPriced {
+		status.HourlyPrice = formatPrice(total)
+	}
+	return status
+}
+
+// formatPrice formats the price with at most 6 decimals, so sums are not reported with rounding errors
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(math.Round(price*1e6)/1e6, 'f', -1, 64)
+}
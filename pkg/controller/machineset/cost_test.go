@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machineset
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+)
+
+func TestCostStatus(t *testing.T) {
+	usd := func(prices map[string]float64) priceFunc {
+		return func(instanceType string) (float64, string, error) {
+			price, ok := prices[instanceType]
+			if !ok {
+				return 0, "", errors.New("no price")
+			}
+			return price, "USD", nil
+		}
+	}
+	notSupported := func(string) (float64, string, error) {
+		return 0, "", cloudprovidererrors.ErrPricingNotSupported
+	}
+
+	tests := []struct {
+		name     string
+		counts   map[string]int32
+		price    priceFunc
+		expected *v1alpha1.MachineSetCostStatus
+	}{
+		{
+			name:   "priced instance types",
+			counts: map[string]int32{"s-2vcpu-4gb": 2, "s-1vcpu-1gb": 3},
+			price:  usd(map[string]float64{"s-1vcpu-1gb": 0.00744, "s-2vcpu-4gb": 0.02976}),
+			expected: &v1alpha1.MachineSetCostStatus{
+				InstanceTypes: []v1alpha1.MachineSetInstanceTypeCost{
+					{InstanceType: "s-1vcpu-1gb", Instances: 3, HourlyPrice: "0.00744"},
+					{InstanceType: "s-2vcpu-4gb", Instances: 2, HourlyPrice: "0.02976"},
+				},
+				HourlyPrice: "0.08184",
+				Currency:    "USD",
+			},
+		},
+		{
+			name:   "missing price",
+			counts: map[string]int32{"s-1vcpu-1gb": 1, "unknown": 1},
+			price:  usd(map[string]float64{"s-1vcpu-1gb": 0.00744}),
+			expected: &v1alpha1.MachineSetCostStatus{
+				InstanceTypes: []v1alpha1.MachineSetInstanceTypeCost{
+					{InstanceType: "s-1vcpu-1gb", Instances: 1, HourlyPrice: "0.00744"},
+					{InstanceType: "unknown", Instances: 1},
+				},
+				Currency: "USD",
+			},
+		},
+		{
+			name:   "pricing not supported",
+			counts: map[string]int32{"m5.large": 4},
+			price:  notSupported,
+			expected: &v1alpha1.MachineSetCostStatus{
+				InstanceTypes: []v1alpha1.MachineSetInstanceTypeCost{{InstanceType: "m5.large", Instances: 4}},
+			},
+		},
+		{
+			name:     "no instances",
+			price:    notSupported,
+			expected: &v1alpha1.MachineSetCostStatus{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := costStatus(nil, test.counts, test.price)
+			if !reflect.DeepEqual(status, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, status)
+			}
+		})
+	}
+}
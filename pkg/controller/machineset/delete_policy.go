@@ -23,6 +23,8 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+	"github.com/kubermatic/machine-controller/pkg/placement"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -120,6 +122,64 @@ func getMachinesToDeletePrioritized(filteredMachines []*v1alpha1.Machine, diff i
 	return sortable.machines[:diff]
 }
 
+// getMachinesToDeleteSpread picks the machines to delete like getMachinesToDeletePrioritized, but each one from
+// the zone most over its share, so the remaining machines stay spread. Machines which are deleted already, failed
+// or marked for deletion are picked first regardless of their zone.
+func getMachinesToDeleteSpread(filteredMachines []*v1alpha1.Machine, diff int, fun deletePriorityFunc, spread *placement.Placement) []*v1alpha1.Machine {
+	if diff >= len(filteredMachines) {
+		return filteredMachines
+	} else if diff <= 0 {
+		return []*v1alpha1.Machine{}
+	}
+
+	sortable := sortableMachines{
+		machines: append([]*v1alpha1.Machine{}, filteredMachines...),
+		priority: fun,
+	}
+	sort.Sort(sortable)
+	remaining := sortable.machines
+	counts := machinesPerZone(remaining)
+
+	var machinesToDelete []*v1alpha1.Machine
+	for len(machinesToDelete) < diff {
+		index := 0
+		if !preferredForDeletion(remaining[0]) {
+			zone := spread.MostOverShare(counts)
+			for i, machine := range remaining {
+				if machine.Annotations[placement.ZoneAnnotation] == zone {
+					index = i
+					break
+				}
+			}
+		}
+		machine := remaining[index]
+		counts[machine.Annotations[placement.ZoneAnnotation]]--
+		machinesToDelete = append(machinesToDelete, machine)
+		remaining = append(remaining[:index:index], remaining[index+1:]...)
+	}
+	return machinesToDelete
+}
+
+// preferredForDeletion returns whether the machine is deleted already, failed or marked for deletion
+func preferredForDeletion(machine *v1alpha1.Machine) bool {
+	return (machine.DeletionTimestamp != nil && !machine.DeletionTimestamp.IsZero()) ||
+		machine.Annotations[DeleteNodeAnnotation] != "" ||
+		machine.Status.ErrorReason != nil || machine.Status.ErrorMessage != nil
+}
+
+// deletableMachines returns the machines which may be deleted on scale-down, which are all but the ones with
+// the delete protection annotation. Protected machines which are already being deleted are kept.
+func deletableMachines(machines []*v1alpha1.Machine) []*v1alpha1.Machine {
+	var deletable []*v1alpha1.Machine
+	for _, machine := range machines {
+		if machinecontroller.IsDeleteProtected(machine) && machine.DeletionTimestamp == nil {
+			continue
+		}
+		deletable = append(deletable, machine)
+	}
+	return deletable
+}
+
 func getDeletePriorityFunc(ms *v1alpha1.MachineSet) (deletePriorityFunc, error) {
 	// Map the Spec.DeletePolicy value to the appropriate delete priority function
 	switch msdp := v1alpha1.MachineSetDeletePolicy(ms.Spec.DeletePolicy); msdp {
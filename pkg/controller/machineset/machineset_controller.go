@@ -26,12 +26,15 @@ import (
 	"github.com/pkg/errors"
 
 	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+	"github.com/kubermatic/machine-controller/pkg/placement"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
@@ -56,18 +59,38 @@ var (
 	// stateConfirmationInterval is the amount of time between polling for the desired state.
 	// The polling is against a local memory cache.
 	stateConfirmationInterval = 100 * time.Millisecond
+
+	// DefaultMaxConcurrentDeletions is the default number of machines deleted at once when a MachineSet scales down.
+	DefaultMaxConcurrentDeletions = 10
 )
 
+// Options configure the MachineSet controller added by Add.
+type Options struct {
+	// CostReport makes the MachineSets report the cost of their instances and the CostCenterLabels of their template.
+	CostReport       bool
+	CostCenterLabels []string
+	// MaxConcurrentDeletions is the number of machines deleted at once when a MachineSet scales down. Defaults to
+	// DefaultMaxConcurrentDeletions.
+	MaxConcurrentDeletions int
+}
+
 // Add creates a new MachineSet Controller and adds it to the Manager with default RBAC.
 // The Manager will set fields on the Controller and Start it when the Manager is Started.
-func Add(mgr manager.Manager) error {
-	r := newReconciler(mgr)
+func Add(mgr manager.Manager, opts Options) error {
+	r := newReconciler(mgr, opts)
 	return add(mgr, r, r.MachineToMachineSets)
 }
 
 // newReconciler returns a new reconcile.Reconciler.
-func newReconciler(mgr manager.Manager) *ReconcileMachineSet {
-	return &ReconcileMachineSet{Client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor(controllerName)}
+func newReconciler(mgr manager.Manager, opts Options) *ReconcileMachineSet {
+	return &ReconcileMachineSet{
+		Client:                 mgr.GetClient(),
+		scheme:                 mgr.GetScheme(),
+		recorder:               mgr.GetEventRecorderFor(controllerName),
+		costReport:             opts.CostReport,
+		costCenterLabels:       opts.CostCenterLabels,
+		maxConcurrentDeletions: opts.MaxConcurrentDeletions,
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler.
@@ -110,6 +133,12 @@ type ReconcileMachineSet struct {
 	client.Client
 	scheme   *runtime.Scheme
 	recorder record.EventRecorder
+	// costReport adds the cost of the instances to the status of the MachineSets
+	costReport bool
+	// costCenterLabels are the keys of the labels of the template reported with the cost
+	costCenterLabels []string
+	// maxConcurrentDeletions is the number of machines deleted at once when a MachineSet scales down
+	maxConcurrentDeletions int
 }
 
 // Reconcile reads that state of the cluster for a MachineSet object and makes changes based on the state read
@@ -185,8 +214,13 @@ func (r *ReconcileMachineSet) reconcile(ctx context.Context, machineSet *cluster
 
 	// Filter out irrelevant machines (deleting/mismatch labels) and claim orphaned machines.
 	filteredMachines := make([]*clusterv1alpha1.Machine, 0, len(allMachines.Items))
+	// The provisioning status includes deleting machines, as failed machines get deleted
+	var ownedMachines []*clusterv1alpha1.Machine
 	for idx := range allMachines.Items {
 		machine := &allMachines.Items[idx]
+		if metav1.IsControlledBy(machine, machineSet) {
+			ownedMachines = append(ownedMachines, machine)
+		}
 		if shouldExcludeMachine(machineSet, machine) {
 			continue
 		}
@@ -202,10 +236,30 @@ func (r *ReconcileMachineSet) reconcile(ctx context.Context, machineSet *cluster
 		filteredMachines = append(filteredMachines, machine)
 	}
 
-	syncErr := r.syncReplicas(machineSet, filteredMachines)
+	// Missing replicas exceeding the quotas of the cloud provider are not created at all, so the MachineSet
+	// gets a single condition instead of each machine failing on the quota
+	capacity := r.checkCapacity(ctx, machineSet, filteredMachines)
+	capacityExceeded := capacity != nil && capacity.Status == corev1.ConditionFalse
+	var syncErr error
+	if capacityExceeded {
+		klog.Infof("Not creating machines of MachineSet %s/%s: %s", machineSet.Namespace, machineSet.Name, capacity.Message)
+		if existing := getCondition(machineSet.Status.Conditions, capacity.Type); existing == nil || existing.Status != capacity.Status {
+			r.recorder.Event(machineSet, corev1.EventTypeWarning, capacity.Reason, capacity.Message)
+		}
+	} else {
+		syncErr = r.syncReplicas(machineSet, filteredMachines)
+	}
 
 	ms := machineSet.DeepCopy()
-	newStatus := r.calculateStatus(ms, filteredMachines)
+	newStatus := r.calculateStatus(ms, filteredMachines, ownedMachines)
+	if capacity != nil {
+		newStatus.Conditions = setCondition(newStatus.Conditions, *capacity, metav1.Now())
+	}
+	// The cost is removed again once the report gets disabled
+	newStatus.Cost = nil
+	if r.costReport {
+		newStatus.Cost = r.reportCost(ctx, ms, ownedMachines)
+	}
 
 	// Always updates status as machines come up or die.
 	updatedMS, err := updateMachineSetStatus(r.Client, machineSet, newStatus)
@@ -220,6 +274,10 @@ func (r *ReconcileMachineSet) reconcile(ctx context.Context, machineSet *cluster
 		return reconcile.Result{}, errors.Wrapf(syncErr, "failed to sync Machineset replicas")
 	}
 
+	if capacityExceeded {
+		return reconcile.Result{RequeueAfter: capacityRecheckInterval}, nil
+	}
+
 	var replicas int32
 	if updatedMS.Spec.Replicas != nil {
 		replicas = *updatedMS.Spec.Replicas
@@ -255,6 +313,12 @@ func (r *ReconcileMachineSet) syncReplicas(ms *clusterv1alpha1.MachineSet, machi
 		klog.Infof("Too few replicas for %v %s/%s, need %d, creating %d",
 			controllerKind, ms.Namespace, ms.Name, *(ms.Spec.Replicas), diff)
 
+		spread, err := placement.Parse(ms.Annotations)
+		if err != nil {
+			return errors.Wrapf(err, "invalid placement of machineset %v", ms.Name)
+		}
+		zoneCounts := machinesPerZone(machines)
+
 		var machineList []*clusterv1alpha1.Machine
 		var errstrings []string
 		for i := 0; i < diff; i++ {
@@ -262,6 +326,13 @@ func (r *ReconcileMachineSet) syncReplicas(ms *clusterv1alpha1.MachineSet, machi
 				i+1, diff, *(ms.Spec.Replicas), len(machines))
 
 			machine := r.createMachine(ms)
+			if spread != nil {
+				zone := spread.Next(zoneCounts)
+				if err := placeMachine(machine, spread.Field, zone); err != nil {
+					return errors.Wrapf(err, "failed to place machine of machineset %v in zone %s", ms.Name, zone)
+				}
+				zoneCounts[zone]++
+			}
 			if err := r.Client.Create(context.Background(), machine); err != nil {
 				klog.Errorf("Unable to create Machine %q: %v", machine.Name, err)
 				errstrings = append(errstrings, err.Error())
@@ -285,40 +356,76 @@ func (r *ReconcileMachineSet) syncReplicas(ms *clusterv1alpha1.MachineSet, machi
 			return err
 		}
 		klog.Infof("Found %s delete policy", ms.Spec.DeletePolicy)
-		// Choose which Machines to delete.
-		machinesToDelete := getMachinesToDeletePrioritized(machines, diff, deletePriorityFunc)
-
-		// TODO: Add cap to limit concurrent delete calls.
-		errCh := make(chan error, diff)
-		var wg sync.WaitGroup
-		wg.Add(diff)
-		for _, machine := range machinesToDelete {
-			go func(targetMachine *clusterv1alpha1.Machine) {
-				defer wg.Done()
-				err := r.Client.Delete(context.Background(), targetMachine)
-				if err != nil {
-					klog.Errorf("Unable to delete Machine %s: %v", targetMachine.Name, err)
-					errCh <- err
-				}
-			}(machine)
+		spread, err := placement.Parse(ms.Annotations)
+		if err != nil {
+			return errors.Wrapf(err, "invalid placement of machineset %v", ms.Name)
 		}
-		wg.Wait()
-
-		select {
-		case err := <-errCh:
-			// all errors have been reported before and they're likely to be the same, so we'll only return the first one we hit.
-			if err != nil {
-				return err
+		// Protected machines are never picked, their deletion would not finish until the annotation is removed
+		deletable := deletableMachines(machines)
+		if len(deletable) < diff {
+			klog.Infof("Only deleting %d of %d machines of %v %s/%s, the others are protected", len(deletable), diff, controllerKind, ms.Namespace, ms.Name)
+			r.recorder.Eventf(ms, corev1.EventTypeWarning, "DeletionProtected", "Not deleting %d machines because of the %q annotation",
+				diff-len(deletable), machinecontroller.AnnotationDeleteProtection)
+			diff = len(deletable)
+			if diff == 0 {
+				return nil
 			}
-		default:
+		}
+		// Choose which Machines to delete.
+		var machinesToDelete []*clusterv1alpha1.Machine
+		if spread != nil {
+			machinesToDelete = getMachinesToDeleteSpread(deletable, diff, deletePriorityFunc, spread)
+		} else {
+			machinesToDelete = getMachinesToDeletePrioritized(deletable, diff, deletePriorityFunc)
 		}
 
+		if err := r.deleteMachines(ms, machinesToDelete); err != nil {
+			return err
+		}
 		return r.waitForMachineDeletion(machinesToDelete)
 	}
 
 	return nil
 }
 
+// deleteMachines deletes the given machines of the MachineSet with at most maxConcurrentDeletions requests at
+// once, so scaling down by many replicas neither takes a request per machine in a row nor floods the apiserver.
+// The errors of all machines are returned.
+//
+// The instances are not deleted here but by the machine controller: its -worker-count workers are the bounded
+// pool the provider deletions run in, concurrently for all deleted machines. Deleting the instances here would skip
+// the drain, the approval, the audit and the retries of the machine controller, and deleting machines whose
+// instance is already gone would race with its finalizer.
+func (r *ReconcileMachineSet) deleteMachines(ms *clusterv1alpha1.MachineSet, machines []*clusterv1alpha1.Machine) error {
+	maxConcurrentDeletions := r.maxConcurrentDeletions
+	if maxConcurrentDeletions < 1 {
+		maxConcurrentDeletions = DefaultMaxConcurrentDeletions
+	}
+	errs := make([]error, len(machines))
+	slots := make(chan struct{}, maxConcurrentDeletions)
+	var wg sync.WaitGroup
+	for i, machine := range machines {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, targetMachine *clusterv1alpha1.Machine) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := r.Client.Delete(context.Background(), targetMachine); err != nil && !apierrors.IsNotFound(err) {
+				klog.Errorf("Unable to delete Machine %s: %v", targetMachine.Name, err)
+				errs[i] = fmt.Errorf("failed to delete machine %s: %v", targetMachine.Name, err)
+			}
+		}(i, machine)
+	}
+	wg.Wait()
+
+	err := utilerrors.NewAggregate(errs)
+	if err != nil {
+		return err
+	}
+	r.recorder.Eventf(ms, corev1.EventTypeNormal, "ScaledDown", "Deleted %d machines", len(machines))
+	return nil
+}
+
 // createMachine creates a Machine resource. The name of the newly created resource is going
 // to be created by the API server, we set the generateName field.
 func (r *ReconcileMachineSet) createMachine(machineSet *clusterv1alpha1.MachineSet) *clusterv1alpha1.Machine {
@@ -328,8 +435,8 @@ func (r *ReconcileMachineSet) createMachine(machineSet *clusterv1alpha1.MachineS
 			Kind:       gv.WithKind("Machine").Kind,
 			APIVersion: gv.String(),
 		},
-		ObjectMeta: machineSet.Spec.Template.ObjectMeta,
-		Spec:       machineSet.Spec.Template.Spec,
+		ObjectMeta: *machineSet.Spec.Template.ObjectMeta.DeepCopy(),
+		Spec:       *machineSet.Spec.Template.Spec.DeepCopy(),
 	}
 	machine.ObjectMeta.GenerateName = fmt.Sprintf("%s-", machineSet.Name)
 	machine.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(machineSet, controllerKind)}
@@ -337,6 +444,27 @@ func (r *ReconcileMachineSet) createMachine(machineSet *clusterv1alpha1.MachineS
 	return machine
 }
 
+// placeMachine sets the zone of the given machine, in its spec and its ZoneAnnotation
+func placeMachine(machine *clusterv1alpha1.Machine, fieldName, zone string) error {
+	if err := placement.SetZone(machine.Spec.ProviderSpec.Value, fieldName, zone); err != nil {
+		return err
+	}
+	if machine.Annotations == nil {
+		machine.Annotations = map[string]string{}
+	}
+	machine.Annotations[placement.ZoneAnnotation] = zone
+	return nil
+}
+
+// machinesPerZone counts the given machines by their zone, machines without one are counted under ""
+func machinesPerZone(machines []*clusterv1alpha1.Machine) map[string]int {
+	counts := map[string]int{}
+	for _, machine := range machines {
+		counts[machine.Annotations[placement.ZoneAnnotation]]++
+	}
+	return counts
+}
+
 // shouldExcludeMachine returns true if the machine should be filtered out, false otherwise.
 func shouldExcludeMachine(machineSet *clusterv1alpha1.MachineSet, machine *clusterv1alpha1.Machine) bool {
 	// Ignore inactive machines.
@@ -0,0 +1,167 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machineset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
+	"github.com/kubermatic/machine-controller/pkg/placement"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// deletingClient records the concurrent deletions, the other methods are not implemented
+type deletingClient struct {
+	client.Client
+
+	lock           sync.Mutex
+	inFlight       int
+	maxInFlight    int
+	deleted        int
+	failingMachine string
+}
+
+func (c *deletingClient) Delete(_ context.Context, obj runtime.Object, _ ...client.DeleteOption) error {
+	c.lock.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.lock.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.inFlight--
+	if obj.(*v1alpha1.Machine).Name == c.failingMachine {
+		return errors.New("apiserver unavailable")
+	}
+	c.deleted++
+	return nil
+}
+
+func TestDeleteMachines(t *testing.T) {
+	var machines []*v1alpha1.Machine
+	const maxConcurrentDeletions = 4
+	for i := 0; i < 3*maxConcurrentDeletions; i++ {
+		machines = append(machines, &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("machine-%d", i)}})
+	}
+	fakeClient := &deletingClient{failingMachine: "machine-7"}
+	r := &ReconcileMachineSet{Client: fakeClient, recorder: record.NewFakeRecorder(10), maxConcurrentDeletions: maxConcurrentDeletions}
+
+	err := r.deleteMachines(&v1alpha1.MachineSet{}, machines)
+	if err == nil || !strings.Contains(err.Error(), "failed to delete machine machine-7") {
+		t.Errorf("expected the error of machine-7, got %v", err)
+	}
+	if fakeClient.deleted != len(machines)-1 {
+		t.Errorf("expected all other machines to be deleted, got %d deletions", fakeClient.deleted)
+	}
+	if fakeClient.maxInFlight > maxConcurrentDeletions {
+		t.Errorf("expected at most %d concurrent deletions, got %d", maxConcurrentDeletions, fakeClient.maxInFlight)
+	}
+}
+
+func TestGetMachinesToDeleteSpread(t *testing.T) {
+	spread := &placement.Placement{Field: "zone", Zones: []placement.Zone{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}}}
+	machineInZone := func(name, zone string) *v1alpha1.Machine {
+		return &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Annotations:       map[string]string{placement.ZoneAnnotation: zone},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+		}}
+	}
+	failed := machineInZone("failed", "b")
+	failed.Status.ErrorMessage = new(string)
+	machines := []*v1alpha1.Machine{
+		machineInZone("a-1", "a"),
+		machineInZone("a-2", "a"),
+		machineInZone("a-3", "a"),
+		machineInZone("b-1", "b"),
+		failed,
+	}
+
+	toDelete := getMachinesToDeleteSpread(machines, 2, oldestDeletePriority, spread)
+	if len(toDelete) != 2 {
+		t.Fatalf("Expected 2 machines to be deleted, got %d", len(toDelete))
+	}
+	if toDelete[0].Name != "failed" {
+		t.Errorf("Expected the failed machine to be deleted first, got %s", toDelete[0].Name)
+	}
+	if zone := toDelete[1].Annotations[placement.ZoneAnnotation]; zone != "a" {
+		t.Errorf("Expected a machine of the zone over its share to be deleted, got one of zone %s", zone)
+	}
+	if len(machines) != 5 || machines[0].Name != "a-1" {
+		t.Error("Expected the given machines to be left unchanged")
+	}
+}
+
+func TestDeletableMachines(t *testing.T) {
+	protected := func(name string) *v1alpha1.Machine {
+		return &v1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{machinecontroller.AnnotationDeleteProtection: "true"},
+		}}
+	}
+	deleting := protected("protected-deleting")
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	failed := protected("protected-failed")
+	failed.Status.ErrorMessage = new(string)
+	machines := []*v1alpha1.Machine{
+		protected("protected"),
+		failed,
+		deleting,
+		{ObjectMeta: metav1.ObjectMeta{Name: "unprotected", CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))}},
+	}
+
+	deletable := deletableMachines(machines)
+	if len(deletable) != 2 || deletable[0].Name != "protected-deleting" || deletable[1].Name != "unprotected" {
+		t.Fatalf("Expected only the deleting and the unprotected machine to be deletable, got %v", deletable)
+	}
+	toDelete := getMachinesToDeletePrioritized(deletable, 1, newestDeletePriority)
+	if len(toDelete) != 1 || toDelete[0].Name != "protected-deleting" {
+		t.Errorf("Expected the deleting machine to be picked, got %v", toDelete)
+	}
+}
+
+func TestPlaceMachine(t *testing.T) {
+	ms := &v1alpha1.MachineSet{}
+	ms.Spec.Template.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(`{"cloudProviderSpec":{"zone":"a"}}`)}
+	r := &ReconcileMachineSet{}
+	machine := r.createMachine(ms)
+	if err := placeMachine(machine, "zone", "b"); err != nil {
+		t.Fatalf("failed to place machine: %v", err)
+	}
+	if zone := machine.Annotations[placement.ZoneAnnotation]; zone != "b" {
+		t.Errorf("Expected the zone to be recorded on the machine, got %q", zone)
+	}
+	if ms.Spec.Template.Annotations != nil || string(ms.Spec.Template.Spec.ProviderSpec.Value.Raw) != `{"cloudProviderSpec":{"zone":"a"}}` {
+		t.Error("Expected the template of the MachineSet to be left unchanged")
+	}
+}
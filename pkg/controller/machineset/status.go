@@ -19,12 +19,15 @@ package machineset
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	machinecontroller "github.com/kubermatic/machine-controller/pkg/controller/machine"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog"
@@ -34,9 +37,11 @@ import (
 const (
 	// The number of times we retry updating a MachineSet's status.
 	statusUpdateRetries = 1
+	// The number of recently provisioned machines the provisioning status of a MachineSet covers.
+	maxRecentProvisionings = 20
 )
 
-func (c *ReconcileMachineSet) calculateStatus(ms *v1alpha1.MachineSet, filteredMachines []*v1alpha1.Machine) v1alpha1.MachineSetStatus {
+func (c *ReconcileMachineSet) calculateStatus(ms *v1alpha1.MachineSet, filteredMachines, ownedMachines []*v1alpha1.Machine) v1alpha1.MachineSetStatus {
 	newStatus := ms.Status
 	// Count the number of machines that have labels matching the labels of the machine
 	// template of the replica set, the matching machines may have more
@@ -68,6 +73,97 @@ func (c *ReconcileMachineSet) calculateStatus(ms *v1alpha1.MachineSet, filteredM
 	newStatus.FullyLabeledReplicas = int32(fullyLabeledReplicasCount)
 	newStatus.ReadyReplicas = int32(readyReplicasCount)
 	newStatus.AvailableReplicas = int32(availableReplicasCount)
+	// The scale subresource reports the selector, the webhook already rejected invalid ones
+	if selector, err := metav1.LabelSelectorAsSelector(&ms.Spec.Selector); err == nil {
+		newStatus.LabelSelector = selector.String()
+	}
+	newStatus.Provisioning = recordProvisionings(ms.Status.Provisioning, c.finishedProvisionings(ms.Status.Provisioning, ownedMachines))
+	return newStatus
+}
+
+// finishedProvisionings returns the machines which finished provisioning and are not part of the given status
+// yet, ordered by the creation of their instance. A machine succeeded once its node joined the cluster and
+// failed if it got an error before, e.g. because its node didn't join within the join cluster timeout.
+// Machines whose instance was not created by the machine-controller are skipped.
+func (c *ReconcileMachineSet) finishedProvisionings(status *v1alpha1.MachineSetProvisioningStatus, ownedMachines []*v1alpha1.Machine) []v1alpha1.MachineProvisioning {
+	known := map[string]bool{}
+	if status != nil {
+		for _, provisioning := range status.Recent {
+			known[provisioning.MachineName] = true
+		}
+	}
+
+	var finished []v1alpha1.MachineProvisioning
+	instanceCreated := map[string]time.Time{}
+	for _, machine := range ownedMachines {
+		if known[machine.Name] {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, machine.Annotations[machinecontroller.AnnotationInstanceCreationTimestamp])
+		if err != nil {
+			continue
+		}
+
+		provisioning := v1alpha1.MachineProvisioning{MachineName: machine.Name}
+		switch {
+		case machine.Status.NodeRef != nil:
+			node, err := c.getMachineNode(machine)
+			if err != nil {
+				klog.V(4).Infof("Unable to get node for machine %v, %v", machine.Name, err)
+				continue
+			}
+			timeToJoin := node.CreationTimestamp.Sub(created)
+			if timeToJoin < 0 {
+				timeToJoin = 0
+			}
+			provisioning.Succeeded = true
+			provisioning.TimeToJoin = &metav1.Duration{Duration: timeToJoin}
+		case machine.Status.ErrorReason != nil:
+		default:
+			continue
+		}
+		finished = append(finished, provisioning)
+		instanceCreated[machine.Name] = created
+	}
+
+	sort.SliceStable(finished, func(i, j int) bool {
+		return instanceCreated[finished[i].MachineName].Before(instanceCreated[finished[j].MachineName])
+	})
+	return finished
+}
+
+// recordProvisionings adds the finished provisionings to the given status, keeps the most recent
+// maxRecentProvisionings and computes the success rate and average time to join of those.
+func recordProvisionings(status *v1alpha1.MachineSetProvisioningStatus, finished []v1alpha1.MachineProvisioning) *v1alpha1.MachineSetProvisioningStatus {
+	if len(finished) == 0 {
+		return status
+	}
+
+	var recent []v1alpha1.MachineProvisioning
+	if status != nil {
+		recent = append(recent, status.Recent...)
+	}
+	recent = append(recent, finished...)
+	if len(recent) > maxRecentProvisionings {
+		recent = recent[len(recent)-maxRecentProvisionings:]
+	}
+
+	newStatus := &v1alpha1.MachineSetProvisioningStatus{Recent: recent}
+	var succeeded int
+	var timeToJoin time.Duration
+	for _, provisioning := range recent {
+		if !provisioning.Succeeded {
+			continue
+		}
+		succeeded++
+		if provisioning.TimeToJoin != nil {
+			timeToJoin += provisioning.TimeToJoin.Duration
+		}
+	}
+	newStatus.SucceededPercent = int32(succeeded * 100 / len(recent))
+	if succeeded > 0 {
+		newStatus.AverageTimeToJoin = &metav1.Duration{Duration: (timeToJoin / time.Duration(succeeded)).Round(time.Second)}
+	}
 	return newStatus
 }
 
@@ -80,6 +176,10 @@ func updateMachineSetStatus(c client.Client, ms *v1alpha1.MachineSet, newStatus
 		ms.Status.FullyLabeledReplicas == newStatus.FullyLabeledReplicas &&
 		ms.Status.ReadyReplicas == newStatus.ReadyReplicas &&
 		ms.Status.AvailableReplicas == newStatus.AvailableReplicas &&
+		ms.Status.LabelSelector == newStatus.LabelSelector &&
+		apiequality.Semantic.DeepEqual(ms.Status.Provisioning, newStatus.Provisioning) &&
+		apiequality.Semantic.DeepEqual(ms.Status.Conditions, newStatus.Conditions) &&
+		apiequality.Semantic.DeepEqual(ms.Status.Cost, newStatus.Cost) &&
 		ms.Generation == ms.Status.ObservedGeneration {
 		return ms, nil
 	}
@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machineset
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func succeeded(name string, timeToJoin time.Duration) v1alpha1.MachineProvisioning {
+	return v1alpha1.MachineProvisioning{MachineName: name, Succeeded: true, TimeToJoin: &metav1.Duration{Duration: timeToJoin}}
+}
+
+func failed(name string) v1alpha1.MachineProvisioning {
+	return v1alpha1.MachineProvisioning{MachineName: name}
+}
+
+func TestRecordProvisionings(t *testing.T) {
+	var full []v1alpha1.MachineProvisioning
+	for i := 0; i < maxRecentProvisionings; i++ {
+		full = append(full, failed(fmt.Sprintf("machine-%d", i)))
+	}
+
+	tests := []struct {
+		name                  string
+		status                *v1alpha1.MachineSetProvisioningStatus
+		finished              []v1alpha1.MachineProvisioning
+		expectedRecent        int
+		expectedFirst         string
+		expectedPercent       int32
+		expectedAverageJoin   time.Duration
+		expectedNoAverageJoin bool
+	}{
+		{
+			name:                "first machines",
+			finished:            []v1alpha1.MachineProvisioning{succeeded("a", 2*time.Minute), succeeded("b", 4*time.Minute), failed("c")},
+			expectedRecent:      3,
+			expectedFirst:       "a",
+			expectedPercent:     66,
+			expectedAverageJoin: 3 * time.Minute,
+		},
+		{
+			name:                  "only failures",
+			status:                &v1alpha1.MachineSetProvisioningStatus{Recent: []v1alpha1.MachineProvisioning{failed("a")}},
+			finished:              []v1alpha1.MachineProvisioning{failed("b")},
+			expectedRecent:        2,
+			expectedFirst:         "a",
+			expectedPercent:       0,
+			expectedNoAverageJoin: true,
+		},
+		{
+			name:                "oldest machines are dropped",
+			status:              &v1alpha1.MachineSetProvisioningStatus{Recent: full},
+			finished:            []v1alpha1.MachineProvisioning{succeeded("new", time.Minute)},
+			expectedRecent:      maxRecentProvisionings,
+			expectedFirst:       "machine-1",
+			expectedPercent:     5,
+			expectedAverageJoin: time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := recordProvisionings(test.status, test.finished)
+			if len(status.Recent) != test.expectedRecent || status.Recent[0].MachineName != test.expectedFirst {
+				t.Fatalf("expected %d recent machines starting with %s, got %+v", test.expectedRecent, test.expectedFirst, status.Recent)
+			}
+			if status.SucceededPercent != test.expectedPercent {
+				t.Errorf("expected %d%% to succeed, got %d%%", test.expectedPercent, status.SucceededPercent)
+			}
+			if test.expectedNoAverageJoin {
+				if status.AverageTimeToJoin != nil {
+					t.Errorf("expected no average time to join, got %v", status.AverageTimeToJoin.Duration)
+				}
+			} else if status.AverageTimeToJoin == nil || status.AverageTimeToJoin.Duration != test.expectedAverageJoin {
+				t.Errorf("expected an average time to join of %v, got %v", test.expectedAverageJoin, status.AverageTimeToJoin)
+			}
+		})
+	}
+}
+
+func TestRecordProvisioningsKeepsStatusWithoutFinishedMachines(t *testing.T) {
+	status := &v1alpha1.MachineSetProvisioningStatus{Recent: []v1alpha1.MachineProvisioning{failed("a")}}
+	if recordProvisionings(status, nil) != status {
+		t.Error("expected the status to be kept if no machine finished provisioning")
+	}
+	if recordProvisionings(nil, nil) != nil {
+		t.Error("expected no status for a MachineSet without provisioned machines")
+	}
+}
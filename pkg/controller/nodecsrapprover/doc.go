@@ -16,6 +16,7 @@ limitations under the License.
 
 /*
 Package nodecsrapprover contains a controller responsible for autoapproving CSRs created by nodes
-for serving certificates.
+of machines for serving and client certificates. Client certificates are either requested with the
+bootstrap token of the machine or renewed by its node.
 */
 package nodecsrapprover
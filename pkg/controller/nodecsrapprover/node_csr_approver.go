@@ -24,9 +24,14 @@ import (
 	"strings"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/controller/bootstraptoken"
+	"github.com/kubermatic/machine-controller/pkg/targetcluster"
 
 	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	certificatesv1beta1client "k8s.io/client-go/kubernetes/typed/certificates/v1beta1"
 	"k8s.io/klog"
@@ -35,7 +40,6 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
-	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
@@ -47,27 +51,36 @@ const (
 
 	nodeGroup          = "system:nodes"
 	authenticatedGroup = "system:authenticated"
+
+	bootstrapUserPrefix        = "system:bootstrap:"
+	bootstrapGroup             = "system:bootstrappers"
+	bootstrapTokenSecretPrefix = "bootstrap-token-"
 )
 
 type reconciler struct {
 	client.Client
+	// targetClient accesses the cluster the nodes join, which holds the CSRs
+	targetClient client.Client
 	// Have to use the typed client because csr approval is a subresource
 	// the dynamic client does not approve
 	certClient certificatesv1beta1client.CertificateSigningRequestInterface
 }
 
-func Add(mgr manager.Manager) error {
-	certClient, err := certificatesv1beta1client.NewForConfig(mgr.GetConfig())
-	if err != nil {
-		return fmt.Errorf("failed to create certificate client: %v", err)
+func Add(mgr manager.Manager, targetCluster *targetcluster.Cluster) error {
+	r := &reconciler{
+		Client:       mgr.GetClient(),
+		targetClient: targetCluster.Client,
+		certClient:   targetCluster.KubeClient.CertificatesV1beta1().CertificateSigningRequests(),
 	}
-
-	r := &reconciler{Client: mgr.GetClient(), certClient: certClient.CertificateSigningRequests()}
 	c, err := controller.New(ControllerName, mgr, controller.Options{Reconciler: r})
 	if err != nil {
 		return fmt.Errorf("failed to construct controller: %v", err)
 	}
-	return c.Watch(&source.Kind{Type: &certificatesv1beta1.CertificateSigningRequest{}}, &handler.EnqueueRequestForObject{})
+	csrSource, err := targetCluster.Source(&certificatesv1beta1.CertificateSigningRequest{})
+	if err != nil {
+		return err
+	}
+	return c.Watch(csrSource, &handler.EnqueueRequestForObject{})
 }
 
 func (r *reconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
@@ -84,10 +97,14 @@ var allowedUsages = []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigi
 	certificatesv1beta1.UsageKeyEncipherment,
 	certificatesv1beta1.UsageServerAuth}
 
+var allowedClientUsages = []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature,
+	certificatesv1beta1.UsageKeyEncipherment,
+	certificatesv1beta1.UsageClientAuth}
+
 func (r *reconciler) reconcile(ctx context.Context, request reconcile.Request) error {
 	// Get the CSR object
 	csr := &certificatesv1beta1.CertificateSigningRequest{}
-	if err := r.Get(ctx, request.NamespacedName, csr); err != nil {
+	if err := r.targetClient.Get(ctx, request.NamespacedName, csr); err != nil {
 		if kerrors.IsNotFound(err) {
 			return nil
 		}
@@ -103,6 +120,12 @@ func (r *reconciler) reconcile(ctx context.Context, request reconcile.Request) e
 		}
 	}
 
+	// Client certificates are requested with a bootstrap token before the node exists
+	// and renewed by the node later on, so they get validated differently
+	if isUsageInUsageList(certificatesv1beta1.UsageClientAuth, csr.Spec.Usages) {
+		return r.reconcileClientCSR(ctx, csr)
+	}
+
 	// Validate the CSR object and get the node name
 	nodeName, err := r.validateCSRObject(csr)
 	if err != nil {
@@ -118,16 +141,13 @@ func (r *reconciler) reconcile(ctx context.Context, request reconcile.Request) e
 	if !found {
 		return fmt.Errorf("no machine found for given node '%s'", nodeName)
 	}
-
-	// Parse the certificate request
-	csrBlock, rest := pem.Decode(csr.Spec.Request)
-	if csrBlock == nil {
-		return fmt.Errorf("no certificate request found for the given CSR")
-	}
-	if len(rest) != 0 {
-		return fmt.Errorf("found more than one PEM encoded block in the result")
+	// The addresses of a machine which gets deleted may already be released and reused
+	if machine.DeletionTimestamp != nil {
+		klog.V(4).Infof("Skipping reconciling CSR '%s' because machine %s/%s is being deleted", csr.ObjectMeta.Name, machine.Namespace, machine.Name)
+		return nil
 	}
-	certRequest, err := x509.ParseCertificateRequest(csrBlock.Bytes)
+
+	certRequest, err := parseCertificateRequest(csr)
 	if err != nil {
 		return err
 	}
@@ -137,11 +157,56 @@ func (r *reconciler) reconcile(ctx context.Context, request reconcile.Request) e
 		return fmt.Errorf("error validating the x509 certificate request: %v", err)
 	}
 
-	// Approve CSR
+	return r.approve(csr, "machine-controller NodeCSRApprover controller approved node serving cert")
+}
+
+func (r *reconciler) reconcileClientCSR(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest) error {
+	// Validate the CSR object
+	if err := r.validateClientCSRObject(csr); err != nil {
+		klog.V(4).Infof("Skipping reconciling CSR '%s' because CSR object is not valid: %v", csr.ObjectMeta.Name, err)
+		return nil
+	}
+
+	certRequest, err := parseCertificateRequest(csr)
+	if err != nil {
+		return err
+	}
+
+	// Validate the certificate request and get the node name
+	nodeName, err := r.validateX509ClientCSR(certRequest)
+	if err != nil {
+		return fmt.Errorf("error validating the x509 certificate request: %v", err)
+	}
+
+	// Get the machine of the node
+	machine, found, err := r.getMachineForClientCSR(ctx, csr, nodeName)
+	if err != nil {
+		return fmt.Errorf("failed to get machine for node '%s': %v", nodeName, err)
+	}
+	if !found {
+		return fmt.Errorf("no machine found for given node '%s'", nodeName)
+	}
+	klog.V(4).Infof("CSR %s requests the client certificate of node %s of machine %s/%s", csr.ObjectMeta.Name, nodeName, machine.Namespace, machine.Name)
+
+	return r.approve(csr, "machine-controller NodeCSRApprover controller approved node client cert")
+}
+
+func parseCertificateRequest(csr *certificatesv1beta1.CertificateSigningRequest) (*x509.CertificateRequest, error) {
+	csrBlock, rest := pem.Decode(csr.Spec.Request)
+	if csrBlock == nil {
+		return nil, fmt.Errorf("no certificate request found for the given CSR")
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("found more than one PEM encoded block in the result")
+	}
+	return x509.ParseCertificateRequest(csrBlock.Bytes)
+}
+
+func (r *reconciler) approve(csr *certificatesv1beta1.CertificateSigningRequest, reason string) error {
 	klog.V(4).Infof("Approving CSR %s", csr.ObjectMeta.Name)
 	approvalCondition := certificatesv1beta1.CertificateSigningRequestCondition{
 		Type:   certificatesv1beta1.CertificateApproved,
-		Reason: "machine-controller NodeCSRApprover controller approved node serving cert",
+		Reason: reason,
 	}
 	csr.Status.Conditions = append(csr.Status.Conditions, approvalCondition)
 
@@ -186,7 +251,8 @@ func (r *reconciler) validateCSRObject(csr *certificatesv1beta1.CertificateSigni
 }
 
 // validateX509CSR validates the certificate request by comparing CN with username,
-// and organization with groups.
+// organization with groups and the SANs with the addresses the cloud provider reported
+// for the instance of the machine.
 func (r *reconciler) validateX509CSR(csr *certificatesv1beta1.CertificateSigningRequest, certReq *x509.CertificateRequest, machine v1alpha1.Machine) error {
 	// Validate Subject CommonName
 	if certReq.Subject.CommonName != csr.Spec.Username {
@@ -201,6 +267,12 @@ func (r *reconciler) validateX509CSR(csr *certificatesv1beta1.CertificateSigning
 		return fmt.Errorf("organization '%s' doesn't match node group '%s'", certReq.Subject.Organization[0], nodeGroup)
 	}
 
+	// The node could put any identity into email addresses or URIs, which other
+	// components may trust
+	if len(certReq.EmailAddresses) > 0 || len(certReq.URIs) > 0 {
+		return fmt.Errorf("serving certificates must not have email addresses or URIs")
+	}
+
 	machineAddressSet := sets.NewString(machine.Status.NodeRef.Name)
 	for _, addr := range machine.Status.Addresses {
 		machineAddressSet.Insert(addr.Address)
@@ -229,6 +301,125 @@ func (r *reconciler) validateX509CSR(csr *certificatesv1beta1.CertificateSigning
 	return nil
 }
 
+// validateClientCSRObject validates the CSR object of a client certificate. It must be requested
+// either with a bootstrap token or by the node itself.
+func (r *reconciler) validateClientCSRObject(csr *certificatesv1beta1.CertificateSigningRequest) error {
+	groups := sets.NewString(csr.Spec.Groups...)
+	switch {
+	case strings.HasPrefix(csr.Spec.Username, bootstrapUserPrefix):
+		if len(strings.TrimPrefix(csr.Spec.Username, bootstrapUserPrefix)) == 0 {
+			return fmt.Errorf("bootstrap token id is empty")
+		}
+		if !groups.Has(bootstrapGroup) {
+			return fmt.Errorf("'%s' is not in its groups", bootstrapGroup)
+		}
+	case strings.HasPrefix(csr.Spec.Username, nodeUserPrefix):
+		if len(strings.TrimPrefix(csr.Spec.Username, nodeUserPrefix)) == 0 {
+			return fmt.Errorf("node name is empty")
+		}
+		if !groups.Has(nodeGroup) {
+			return fmt.Errorf("'%s' is not in its groups", nodeGroup)
+		}
+	default:
+		return fmt.Errorf("username must have the '%s' or '%s' prefix", nodeUserPrefix, bootstrapUserPrefix)
+	}
+
+	// Newer kubelets omit key encipherment for non-RSA keys
+	for _, usage := range csr.Spec.Usages {
+		if !isUsageInUsageList(usage, allowedClientUsages) {
+			return fmt.Errorf("usage %v is not in the list of allowed usages (%v)", usage, allowedClientUsages)
+		}
+	}
+
+	return nil
+}
+
+// validateX509ClientCSR validates the certificate request of a node client certificate
+// and returns the name of the node.
+func (r *reconciler) validateX509ClientCSR(certReq *x509.CertificateRequest) (string, error) {
+	// Validate Subject CommonName
+	if !strings.HasPrefix(certReq.Subject.CommonName, nodeUserPrefix) {
+		return "", fmt.Errorf("commonName '%s' doesn't have the '%s' prefix", certReq.Subject.CommonName, nodeUserPrefix)
+	}
+	nodeName := strings.TrimPrefix(certReq.Subject.CommonName, nodeUserPrefix)
+	if len(nodeName) == 0 {
+		return "", fmt.Errorf("node name is empty")
+	}
+
+	// Validate Subject Organization
+	if len(certReq.Subject.Organization) != 1 {
+		return "", fmt.Errorf("expected only one organization but got %d instead", len(certReq.Subject.Organization))
+	}
+	if certReq.Subject.Organization[0] != nodeGroup {
+		return "", fmt.Errorf("organization '%s' doesn't match node group '%s'", certReq.Subject.Organization[0], nodeGroup)
+	}
+
+	// Client certificates identify the node by their subject only
+	if len(certReq.DNSNames) > 0 || len(certReq.IPAddresses) > 0 || len(certReq.EmailAddresses) > 0 || len(certReq.URIs) > 0 {
+		return "", fmt.Errorf("client certificates must not have subject alternative names")
+	}
+
+	return nodeName, nil
+}
+
+// getMachineForClientCSR returns the machine the client certificate of the given node
+// may be issued for. Nodes may only renew their own certificate, bootstrap tokens are
+// bound to the machine they were created for.
+func (r *reconciler) getMachineForClientCSR(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest, nodeName string) (v1alpha1.Machine, bool, error) {
+	if strings.HasPrefix(csr.Spec.Username, nodeUserPrefix) {
+		if csr.Spec.Username != nodeUserPrefix+nodeName {
+			return v1alpha1.Machine{}, false, fmt.Errorf("username '%s' may not request a certificate for node '%s'", csr.Spec.Username, nodeName)
+		}
+		return r.getMachineForNode(nodeName)
+	}
+
+	tokenID := strings.TrimPrefix(csr.Spec.Username, bootstrapUserPrefix)
+	secret := &corev1.Secret{}
+	if err := r.targetClient.Get(ctx, types.NamespacedName{Namespace: metav1.NamespaceSystem, Name: bootstrapTokenSecretPrefix + tokenID}, secret); err != nil {
+		if kerrors.IsNotFound(err) {
+			return v1alpha1.Machine{}, false, fmt.Errorf("bootstrap token '%s' does not exist anymore", tokenID)
+		}
+		return v1alpha1.Machine{}, false, fmt.Errorf("failed to get bootstrap token secret: %v", err)
+	}
+	machineName, ok := secret.Labels[bootstraptoken.MachineNameLabelKey]
+	if !ok || secret.Type != bootstraptoken.SecretTypeBootstrapToken {
+		return v1alpha1.Machine{}, false, fmt.Errorf("bootstrap token '%s' was not created for a machine", tokenID)
+	}
+
+	machines := &v1alpha1.MachineList{}
+	if err := r.Client.List(ctx, machines); err != nil {
+		return v1alpha1.Machine{}, false, fmt.Errorf("failed to list all machine objects: %v", err)
+	}
+	// The label of the token only holds the name of the machine, so machines with
+	// the same name in other namespaces are candidates as well
+	for _, machine := range machines.Items {
+		if machine.Name != machineName || machine.DeletionTimestamp != nil {
+			continue
+		}
+		if machineNodeNames(machine).Has(nodeName) {
+			return machine, true, nil
+		}
+	}
+
+	return v1alpha1.Machine{}, false, nil
+}
+
+// machineNodeNames returns the names the node of the given machine may register with.
+func machineNodeNames(machine v1alpha1.Machine) sets.String {
+	names := sets.NewString(machine.Name, machine.Spec.Name)
+	if machine.Status.NodeRef != nil {
+		names.Insert(machine.Status.NodeRef.Name)
+	}
+	for _, addr := range machine.Status.Addresses {
+		switch addr.Type {
+		case corev1.NodeHostName, corev1.NodeInternalDNS, corev1.NodeExternalDNS:
+			names.Insert(addr.Address)
+		}
+	}
+	names.Delete("")
+	return names
+}
+
 func (r *reconciler) getMachineForNode(nodeName string) (v1alpha1.Machine, bool, error) {
 	// List all Machines in all namespaces
 	machines := &v1alpha1.MachineList{}
@@ -17,18 +17,30 @@ limitations under the License.
 package nodecsrapprover
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"testing"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/controller/bootstraptoken"
 
 	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog"
+	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
+func init() {
+	if err := v1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		klog.Fatalf("failed to add v1alpha1 api to scheme: %v", err)
+	}
+}
+
 /*
 	Certificate generation (cfssl required):
 cat <<EOF | cfssl genkey - | cfssljson -bare server
@@ -156,6 +168,41 @@ OC5ldS13ZXN0LTMuY29tcHV0ZS5pbnRlcm5hbIcEwAACGIcEwAACGTAKBggqhkjO
 PQQDAgNJADBGAiEA3HDpVRYYgcmdCzq5o6mwkMzegZ0P0aZNPdCQLyJt3GoCIQDo
 /iL1+piFJXAOI2GjsZNpeQJ4rPJ7l/t95tzgcVAUtw==
 -----END CERTIFICATE REQUEST-----
+`
+
+	testClientCSR = `-----BEGIN CERTIFICATE REQUEST-----
+MIIBFDCBuwIBADBZMRUwEwYDVQQKDAxzeXN0ZW06bm9kZXMxQDA+BgNVBAMMN3N5
+c3RlbTpub2RlOmlwLTE3Mi0zMS0xMTQtNDguZXUtd2VzdC0zLmNvbXB1dGUuaW50
+ZXJuYWwwWTATBgcqhkjOPQIBBggqhkjOPQMBBwNCAATx9Qp6J2M7TdIC8Pgmp6Z0
+dAVmJVI13m/NFO2KHJ20AuAmfwQcBqRbeznNkCNN3/ruhjGiO2LrPD575L2d9tjn
+oAAwCgYIKoZIzj0EAwIDSAAwRQIgWpmslOm/gKhW0d5OjEzfuieqZ33Y5JYeql4B
+O0c2WBcCIQCuSYbsybWCXnZ+lkWANppFAPmoJYQa7XeUIJdnNHWEng==
+-----END CERTIFICATE REQUEST-----
+`
+
+	testURICSR = `-----BEGIN CERTIFICATE REQUEST-----
+MIIBlTCCAToCAQAwWTEVMBMGA1UECgwMc3lzdGVtOm5vZGVzMUAwPgYDVQQDDDdz
+eXN0ZW06bm9kZTppcC0xNzItMzEtMTE0LTQ4LmV1LXdlc3QtMy5jb21wdXRlLmlu
+dGVybmFsMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE8fUKeidjO03SAvD4Jqem
+dHQFZiVSNd5vzRTtihydtALgJn8EHAakW3s5zZAjTd/67oYxojti6zw+e+S9nfbY
+56B/MH0GCSqGSIb3DQEJDjFwMG4wbAYDVR0RBGUwY4IraXAtMTcyLTMxLTExNC00
+OC5ldS13ZXN0LTMuY29tcHV0ZS5pbnRlcm5hbIcEwAACGIYuc3BpZmZlOi8vY2x1
+c3Rlci5sb2NhbC9ucy9rdWJlLXN5c3RlbS9zYS9hZG1pbjAKBggqhkjOPQQDAgNJ
+ADBGAiEA7iJtqb/QWWaCOdBfOxgSClMiFlrcfg88d3s7Efj59jgCIQCXA1R6zol/
+7fLCV3u3wf6WdMUs/V7x7SxfGjgMIn53/w==
+-----END CERTIFICATE REQUEST-----
+`
+
+	testEmailAddressCSR = `-----BEGIN CERTIFICATE REQUEST-----
+MIIBdzCCAR0CAQAwWTEVMBMGA1UECgwMc3lzdGVtOm5vZGVzMUAwPgYDVQQDDDdz
+eXN0ZW06bm9kZTppcC0xNzItMzEtMTE0LTQ4LmV1LXdlc3QtMy5jb21wdXRlLmlu
+dGVybmFsMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE8fUKeidjO03SAvD4Jqem
+dHQFZiVSNd5vzRTtihydtALgJn8EHAakW3s5zZAjTd/67oYxojti6zw+e+S9nfbY
+56BiMGAGCSqGSIb3DQEJDjFTMFEwTwYDVR0RBEgwRoIraXAtMTcyLTMxLTExNC00
+OC5ldS13ZXN0LTMuY29tcHV0ZS5pbnRlcm5hbIcEwAACGIERYWRtaW5AZXhhbXBs
+ZS5jb20wCgYIKoZIzj0EAwIDSAAwRQIgVjpsjdM8QakW+FXXSbkHE+iqHwK1e+Ae
+G7k8O2gHdgYCIQDKMAWISncwYxRgZO6ah+v04dXpd2co9lI9jIUV9BJE3A==
+-----END CERTIFICATE REQUEST-----
 `
 
 	testNoDNSNameCSR = `-----BEGIN CERTIFICATE REQUEST-----
@@ -693,6 +740,54 @@ func TestValidateX509CSR(t *testing.T) {
 			machine: machine,
 			err:     fmt.Errorf("ip address '%v' cannot be associated with node '%s'", "192.0.2.25", machine.Status.NodeRef.Name),
 		},
+		{
+			name: "validate csr with uri",
+			csr: &certificatesv1beta1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "csr",
+					Namespace: metav1.NamespaceSystem,
+				},
+				Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+					Request: []byte(testURICSR),
+					Usages: []certificatesv1beta1.KeyUsage{
+						certificatesv1beta1.UsageDigitalSignature,
+						certificatesv1beta1.UsageKeyEncipherment,
+						certificatesv1beta1.UsageServerAuth,
+					},
+					Username: "system:node:ip-172-31-114-48.eu-west-3.compute.internal",
+					Groups: []string{
+						"system:nodes",
+						"system:authenticated",
+					},
+				},
+			},
+			machine: machine,
+			err:     fmt.Errorf("serving certificates must not have email addresses or URIs"),
+		},
+		{
+			name: "validate csr with email address",
+			csr: &certificatesv1beta1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "csr",
+					Namespace: metav1.NamespaceSystem,
+				},
+				Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+					Request: []byte(testEmailAddressCSR),
+					Usages: []certificatesv1beta1.KeyUsage{
+						certificatesv1beta1.UsageDigitalSignature,
+						certificatesv1beta1.UsageKeyEncipherment,
+						certificatesv1beta1.UsageServerAuth,
+					},
+					Username: "system:node:ip-172-31-114-48.eu-west-3.compute.internal",
+					Groups: []string{
+						"system:nodes",
+						"system:authenticated",
+					},
+				},
+			},
+			machine: machine,
+			err:     fmt.Errorf("serving certificates must not have email addresses or URIs"),
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -720,3 +815,243 @@ func TestValidateX509CSR(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateClientCSRObject(t *testing.T) {
+	testCases := []struct {
+		name     string
+		username string
+		groups   []string
+		usages   []certificatesv1beta1.KeyUsage
+		err      error
+	}{
+		{
+			name:     "validate csr requested with a bootstrap token",
+			username: "system:bootstrap:abcdef",
+			groups:   []string{"system:bootstrappers", "system:bootstrappers:machine-controller:default-node-token", "system:authenticated"},
+			usages:   allowedClientUsages,
+		},
+		{
+			name:     "validate csr requested by the node",
+			username: "system:node:ip-172-31-114-48.eu-west-3.compute.internal",
+			groups:   []string{"system:nodes", "system:authenticated"},
+			usages:   allowedClientUsages,
+		},
+		{
+			name:     "validate csr without key encipherment usage",
+			username: "system:node:ip-172-31-114-48.eu-west-3.compute.internal",
+			groups:   []string{"system:nodes", "system:authenticated"},
+			usages:   []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageClientAuth},
+		},
+		{
+			name:     "validate csr of another user",
+			username: "system:serviceaccount:kube-system:default",
+			groups:   []string{"system:serviceaccounts", "system:authenticated"},
+			usages:   allowedClientUsages,
+			err:      fmt.Errorf("username must have the '%s' or '%s' prefix", nodeUserPrefix, bootstrapUserPrefix),
+		},
+		{
+			name:     "validate csr with empty bootstrap token id",
+			username: "system:bootstrap:",
+			groups:   []string{"system:bootstrappers"},
+			usages:   allowedClientUsages,
+			err:      fmt.Errorf("bootstrap token id is empty"),
+		},
+		{
+			name:     "validate csr with bootstrap user not in the bootstrappers group",
+			username: "system:bootstrap:abcdef",
+			groups:   []string{"system:authenticated"},
+			usages:   allowedClientUsages,
+			err:      fmt.Errorf("'%s' is not in its groups", bootstrapGroup),
+		},
+		{
+			name:     "validate csr with node user not in the nodes group",
+			username: "system:node:ip-172-31-114-48.eu-west-3.compute.internal",
+			groups:   []string{"system:authenticated"},
+			usages:   allowedClientUsages,
+			err:      fmt.Errorf("'%s' is not in its groups", nodeGroup),
+		},
+		{
+			name:     "validate csr with server auth usage",
+			username: "system:bootstrap:abcdef",
+			groups:   []string{"system:bootstrappers"},
+			usages:   []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageClientAuth, certificatesv1beta1.UsageServerAuth},
+			err:      fmt.Errorf("usage %v is not in the list of allowed usages (%v)", "server auth", allowedClientUsages),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &reconciler{}
+			csr := &certificatesv1beta1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "csr"},
+				Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+					Request:  []byte(testClientCSR),
+					Usages:   tc.usages,
+					Username: tc.username,
+					Groups:   tc.groups,
+				},
+			}
+			err := r.validateClientCSRObject(csr)
+			if err != nil && (tc.err == nil || err.Error() != tc.err.Error()) {
+				t.Errorf("expected error '%v', but got '%v'", tc.err, err)
+			} else if err == nil && tc.err != nil {
+				t.Errorf("expected error '%v'", tc.err)
+			}
+		})
+	}
+}
+
+func TestValidateX509ClientCSR(t *testing.T) {
+	testCases := []struct {
+		name     string
+		request  string
+		nodeName string
+		err      error
+	}{
+		{
+			name:     "validate valid client csr",
+			request:  testClientCSR,
+			nodeName: "ip-172-31-114-48.eu-west-3.compute.internal",
+		},
+		{
+			name:    "validate csr with subject alternative names",
+			request: testValidCSR,
+			err:     fmt.Errorf("client certificates must not have subject alternative names"),
+		},
+		{
+			name:    "validate csr with common name of another user",
+			request: testInvalidCommonNameCSR,
+			err:     fmt.Errorf("commonName '%s' doesn't have the '%s' prefix", "test", nodeUserPrefix),
+		},
+		{
+			name:    "validate csr with organization not matching system:nodes",
+			request: testInvalidOrganizationCSR,
+			err:     fmt.Errorf("organization '%s' doesn't match node group '%s'", "test", nodeGroup),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &reconciler{}
+			certReq, err := parseCertificateRequest(&certificatesv1beta1.CertificateSigningRequest{
+				Spec: certificatesv1beta1.CertificateSigningRequestSpec{Request: []byte(tc.request)},
+			})
+			if err != nil {
+				t.Fatalf("failed to parse x509 certificate request: %v", err)
+			}
+
+			nodeName, err := r.validateX509ClientCSR(certReq)
+			if err != nil && (tc.err == nil || err.Error() != tc.err.Error()) {
+				t.Errorf("expected error '%v', but got '%v'", tc.err, err)
+			} else if err == nil && tc.err != nil {
+				t.Errorf("expected error '%v'", tc.err)
+			}
+			if nodeName != tc.nodeName {
+				t.Errorf("expected node name '%s', but got '%s'", tc.nodeName, nodeName)
+			}
+		})
+	}
+}
+
+func TestGetMachineForClientCSR(t *testing.T) {
+	const nodeName = "ip-172-31-114-48.eu-west-3.compute.internal"
+
+	machine := func(name, nodeRef string, addresses ...corev1.NodeAddress) *v1alpha1.Machine {
+		m := &v1alpha1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceSystem},
+			Status:     v1alpha1.MachineStatus{Addresses: addresses},
+		}
+		if nodeRef != "" {
+			m.Status.NodeRef = &corev1.ObjectReference{Name: nodeRef}
+		}
+		return m
+	}
+	tokenSecret := func(machineName string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "bootstrap-token-abcdef",
+				Namespace: metav1.NamespaceSystem,
+				Labels:    map[string]string{bootstraptoken.MachineNameLabelKey: machineName},
+			},
+			Type: bootstraptoken.SecretTypeBootstrapToken,
+		}
+	}
+	internalDNS := corev1.NodeAddress{Type: corev1.NodeInternalDNS, Address: nodeName}
+
+	testCases := []struct {
+		name     string
+		username string
+		objects  []runtime.Object
+		found    bool
+		err      error
+	}{
+		{
+			name:     "bootstrap token of a machine whose node registers with its address",
+			username: "system:bootstrap:abcdef",
+			objects:  []runtime.Object{tokenSecret("machine1"), machine("machine1", "", internalDNS)},
+			found:    true,
+		},
+		{
+			name:     "bootstrap token of a machine whose node registers with the machine name",
+			username: "system:bootstrap:abcdef",
+			objects:  []runtime.Object{tokenSecret(nodeName), machine(nodeName, "")},
+			found:    true,
+		},
+		{
+			name:     "bootstrap token of a machine with another node name",
+			username: "system:bootstrap:abcdef",
+			objects:  []runtime.Object{tokenSecret("machine1"), machine("machine1", ""), machine("machine2", "", internalDNS)},
+			found:    false,
+		},
+		{
+			name:     "bootstrap token without a machine",
+			username: "system:bootstrap:abcdef",
+			objects:  []runtime.Object{tokenSecret("machine1"), machine("machine2", "", internalDNS)},
+			found:    false,
+		},
+		{
+			name:     "bootstrap token which was not created for a machine",
+			username: "system:bootstrap:abcdef",
+			objects: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-abcdef", Namespace: metav1.NamespaceSystem},
+				Type:       bootstraptoken.SecretTypeBootstrapToken,
+			}, machine("machine1", "", internalDNS)},
+			err: fmt.Errorf("bootstrap token '%s' was not created for a machine", "abcdef"),
+		},
+		{
+			name:     "bootstrap token which does not exist",
+			username: "system:bootstrap:abcdef",
+			objects:  []runtime.Object{machine("machine1", "", internalDNS)},
+			err:      fmt.Errorf("bootstrap token '%s' does not exist anymore", "abcdef"),
+		},
+		{
+			name:     "node renewing its own certificate",
+			username: "system:node:" + nodeName,
+			objects:  []runtime.Object{machine("machine1", nodeName)},
+			found:    true,
+		},
+		{
+			name:     "node requesting the certificate of another node",
+			username: "system:node:ip-172-31-114-49.eu-west-3.compute.internal",
+			objects:  []runtime.Object{machine("machine1", nodeName)},
+			err:      fmt.Errorf("username '%s' may not request a certificate for node '%s'", "system:node:ip-172-31-114-49.eu-west-3.compute.internal", nodeName),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := ctrlruntimefake.NewFakeClient(tc.objects...)
+			r := &reconciler{Client: client, targetClient: client}
+			csr := &certificatesv1beta1.CertificateSigningRequest{
+				Spec: certificatesv1beta1.CertificateSigningRequestSpec{Username: tc.username},
+			}
+
+			_, found, err := r.getMachineForClientCSR(context.Background(), csr, nodeName)
+			if err != nil && (tc.err == nil || err.Error() != tc.err.Error()) {
+				t.Errorf("expected error '%v', but got '%v'", tc.err, err)
+			} else if err == nil && tc.err != nil {
+				t.Errorf("expected error '%v'", tc.err)
+			}
+			if found != tc.found {
+				t.Errorf("expected machine to be found: %t, but found: %t", tc.found, found)
+			}
+		})
+	}
+}
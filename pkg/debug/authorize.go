@@ -0,0 +1,89 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package debug serves the endpoints which expose the internal state of the machine-controller
+package debug
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// Authorize returns a handler which only passes requests to the given handler if they carry the bearer token
+// of a user who is allowed to get the non-resource URL of the request, e.g. through a ClusterRole with
+// nonResourceURLs: ["/debug/machines"]. The token is reviewed by the apiserver.
+func Authorize(client kubernetes.Interface, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == r.Header.Get("Authorization") {
+			http.Error(w, "a bearer token is required", http.StatusUnauthorized)
+			return
+		}
+
+		allowed, err := authorize(client, token, r.URL.Path)
+		if err != nil {
+			klog.Errorf("Failed to authorize request for %s: %v", r.URL.Path, err)
+			http.Error(w, "failed to authorize the request", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// authorize returns whether the user of the given token may get the given path
+func authorize(client kubernetes.Interface, token, path string) (bool, error) {
+	tokenReview, err := client.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to review token: %v", err)
+	}
+	if !tokenReview.Status.Authenticated {
+		return false, nil
+	}
+
+	user := tokenReview.Status.User
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	accessReview, err := client.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: path,
+				Verb: "get",
+			},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to review access: %v", err)
+	}
+	return accessReview.Status.Allowed, nil
+}
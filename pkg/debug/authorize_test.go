@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package debug
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+	}{
+		{
+			name:           "no token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "basic auth",
+			header:         "Basic YWRtaW46YWRtaW4=",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "invalid token",
+			header:         "Bearer invalid",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "user without access",
+			header:         "Bearer viewer",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "user with access",
+			header:         "Bearer admin",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token != "invalid" {
+			review.Status.Authenticated = true
+			review.Status.User.Username = review.Spec.Token
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes := review.Spec.NonResourceAttributes
+		review.Status.Allowed = review.Spec.User == "admin" && attributes.Path == "/debug/machines" && attributes.Verb == "get"
+		return true, review, nil
+	})
+	handler := Authorize(client, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/debug/machines", nil)
+			if test.header != "" {
+				request.Header.Set("Authorization", test.header)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedStatus {
+				t.Errorf("expected status %d, got %d", test.expectedStatus, recorder.Code)
+			}
+		})
+	}
+}
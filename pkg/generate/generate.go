@@ -0,0 +1,330 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package generate renders the manifests of machines and MachineDeployments for a cloud provider and operating
+// system, with the fields the cloud provider needs and references to the secret of its credentials
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kubermatic/machine-controller/pkg/cloudprovider"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	kyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	// KindMachine generates a single machine
+	KindMachine = "Machine"
+	// KindMachineDeployment generates a MachineDeployment
+	KindMachineDeployment = "MachineDeployment"
+)
+
+// Field is a field of the cloudProviderSpec which is generated for a cloud provider
+type Field struct {
+	// Name is the name of the field in the cloudProviderSpec
+	Name string
+	// Description is shown when the value is asked for
+	Description string
+	// Default is the value of the field if none is given. Fields without default need a value.
+	Default interface{}
+	// Secret fields are credentials, they always reference a key of the secret of the cloud provider
+	Secret bool
+}
+
+// fields are the fields generated for the cloud providers. Optional fields without a sensible default are left out.
+var fields = map[providerconfigtypes.CloudProvider][]Field{
+	providerconfigtypes.CloudProviderAWS: {
+		{Name: "accessKeyId", Secret: true},
+		{Name: "secretAccessKey", Secret: true},
+		{Name: "region", Description: "AWS region", Default: "eu-central-1"},
+		{Name: "availabilityZone", Description: "availability zone of the instances", Default: "eu-central-1a"},
+		{Name: "vpcId", Description: "ID of the VPC of the instances"},
+		{Name: "instanceType", Description: "EC2 instance type", Default: "t3.medium"},
+		{Name: "diskSize", Description: "size of the root volume in GB", Default: 50},
+		{Name: "diskType", Description: "EBS volume type of the root volume", Default: "gp2"},
+	},
+	providerconfigtypes.CloudProviderAzure: {
+		{Name: "tenantID", Secret: true},
+		{Name: "clientID", Secret: true},
+		{Name: "clientSecret", Secret: true},
+		{Name: "subscriptionID", Secret: true},
+		{Name: "location", Description: "Azure location", Default: "westeurope"},
+		{Name: "resourceGroup", Description: "resource group of the virtual machines"},
+		{Name: "vmSize", Description: "size of the virtual machines", Default: "Standard_F2"},
+		{Name: "vnetName", Description: "name of the virtual network"},
+		{Name: "subnetName", Description: "name of the subnet"},
+	},
+	providerconfigtypes.CloudProviderDigitalocean: {
+		{Name: "token", Secret: true},
+		{Name: "region", Description: "DigitalOcean region", Default: "fra1"},
+		{Name: "size", Description: "droplet size", Default: "s-2vcpu-4gb"},
+	},
+	providerconfigtypes.CloudProviderGoogle: {
+		{Name: "serviceAccount", Secret: true},
+		{Name: "zone", Description: "GCE zone", Default: "europe-west3-a"},
+		{Name: "machineType", Description: "GCE machine type", Default: "n1-standard-2"},
+		{Name: "diskSize", Description: "size of the boot disk in GB", Default: 50},
+		{Name: "diskType", Description: "type of the boot disk", Default: "pd-standard"},
+	},
+	providerconfigtypes.CloudProviderHetzner: {
+		{Name: "token", Secret: true},
+		{Name: "serverType", Description: "Hetzner server type", Default: "cx21"},
+		{Name: "location", Description: "Hetzner location", Default: "fsn1"},
+	},
+	providerconfigtypes.CloudProviderLinode: {
+		{Name: "token", Secret: true},
+		{Name: "region", Description: "Linode region", Default: "eu-west"},
+		{Name: "type", Description: "Linode type", Default: "g6-standard-2"},
+	},
+	providerconfigtypes.CloudProviderOpenstack: {
+		{Name: "identityEndpoint", Secret: true},
+		{Name: "username", Secret: true},
+		{Name: "password", Secret: true},
+		{Name: "domainName", Secret: true},
+		{Name: "tenantName", Secret: true},
+		{Name: "region", Secret: true},
+		{Name: "image", Description: "name of the image of the instances"},
+		{Name: "flavor", Description: "flavor of the instances", Default: "m1.small"},
+	},
+	providerconfigtypes.CloudProviderPacket: {
+		{Name: "apiKey", Secret: true},
+		{Name: "projectID", Description: "ID of the Equinix Metal project"},
+		{Name: "instanceType", Description: "Equinix Metal plan", Default: "c3.small.x86"},
+		{Name: "facilities", Description: "facilities of the devices", Default: []interface{}{"ewr1"}},
+	},
+	providerconfigtypes.CloudProviderVsphere: {
+		{Name: "username", Secret: true},
+		{Name: "password", Secret: true},
+		{Name: "vsphereURL", Description: "URL of the vCenter"},
+		{Name: "datacenter", Description: "datacenter of the virtual machines"},
+		{Name: "datastore", Description: "datastore of the virtual machines"},
+		{Name: "templateVMName", Description: "name of the template virtual machine"},
+		{Name: "cpus", Description: "number of CPUs", Default: 2},
+		{Name: "memoryMB", Description: "memory in MB", Default: 4096},
+	},
+	providerconfigtypes.CloudProviderScaleway: {
+		{Name: "accessKey", Secret: true},
+		{Name: "secretKey", Secret: true},
+		{Name: "projectId", Description: "ID of the Scaleway project"},
+		{Name: "zone", Description: "Scaleway zone", Default: "fr-par-1"},
+		{Name: "commercialType", Description: "Scaleway instance type", Default: "DEV1-M"},
+	},
+	providerconfigtypes.CloudProviderAlibaba: {
+		{Name: "accessKeyID", Secret: true},
+		{Name: "accessKeySecret", Secret: true},
+		{Name: "regionID", Description: "Alibaba region", Default: "eu-central-1"},
+		{Name: "zoneID", Description: "Alibaba zone", Default: "eu-central-1a"},
+		{Name: "vSwitchID", Description: "ID of the vSwitch of the instances"},
+		{Name: "instanceType", Description: "ECS instance type", Default: "ecs.t1.xsmall"},
+		{Name: "diskType", Description: "type of the system disk", Default: "cloud_efficiency"},
+		{Name: "diskSize", Description: "size of the system disk in GB", Default: "40"},
+		{Name: "internetMaxBandwidthOut", Description: "maximum outbound bandwidth in Mbps", Default: "10"},
+	},
+	providerconfigtypes.CloudProviderAnexia: {
+		{Name: "token", Secret: true},
+		{Name: "locationID", Description: "ID of the Anexia location"},
+		{Name: "templateID", Description: "ID of the template"},
+		{Name: "vlanID", Description: "ID of the VLAN"},
+		{Name: "cpus", Description: "number of CPUs", Default: 2},
+		{Name: "memory", Description: "memory in MB", Default: 4096},
+		{Name: "diskSize", Description: "size of the disk in GB", Default: 20},
+	},
+	providerconfigtypes.CloudProviderKubeVirt: {
+		{Name: "kubeconfig", Secret: true},
+		{Name: "sourceURL", Description: "URL of the image of the virtual machines"},
+		{Name: "storageClassName", Description: "storage class of the disks"},
+		{Name: "pvcSize", Description: "size of the disks", Default: "10Gi"},
+		{Name: "cpus", Description: "number of CPUs", Default: "2"},
+		{Name: "memory", Description: "memory", Default: "4096M"},
+	},
+	providerconfigtypes.CloudProviderFake: {},
+}
+
+// ErrUnsupportedCloudProvider is returned for cloud providers manifests can't be generated for
+var ErrUnsupportedCloudProvider = errors.New("manifests of the cloud provider can't be generated")
+
+// Fields returns the fields of the cloudProviderSpec which are generated for the cloud provider
+func Fields(provider providerconfigtypes.CloudProvider) ([]Field, error) {
+	providerFields, found := fields[provider]
+	if !found {
+		return nil, ErrUnsupportedCloudProvider
+	}
+	return providerFields, nil
+}
+
+// Options are the options of the generated manifest
+type Options struct {
+	// Kind is KindMachine or KindMachineDeployment
+	Kind            string
+	Name            string
+	Namespace       string
+	Replicas        int32
+	CloudProvider   providerconfigtypes.CloudProvider
+	OperatingSystem providerconfigtypes.OperatingSystem
+	KubeletVersion  string
+	SSHPublicKeys   []string
+	// SecretName is the name of the secret in the namespace with the credentials, whose keys are the names of
+	// the secret fields
+	SecretName string
+	// Values are the values of fields of the cloudProviderSpec, they take precedence over the defaults. Fields
+	// which are not generated by default must be known fields of the cloud provider.
+	Values map[string]interface{}
+}
+
+// Generate returns the YAML manifest of the machine or MachineDeployment and the keys the secret must have
+func Generate(opts Options) ([]byte, []string, error) {
+	providerFields, err := Fields(opts.CloudProvider)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkOptions(opts); err != nil {
+		return nil, nil, err
+	}
+	known, err := cloudProviderSpecFields(opts.CloudProvider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cloudProviderSpec := map[string]interface{}{}
+	var missing, secretKeys []string
+	for _, field := range providerFields {
+		switch {
+		case field.Secret:
+			if _, set := opts.Values[field.Name]; set {
+				return nil, nil, fmt.Errorf("%s is a credential, it must be a key of the secret %s instead of a value", field.Name, opts.SecretName)
+			}
+			cloudProviderSpec[field.Name] = map[string]interface{}{
+				"secretKeyRef": map[string]interface{}{
+					"namespace": opts.Namespace,
+					"name":      opts.SecretName,
+					"key":       field.Name,
+				},
+			}
+			secretKeys = append(secretKeys, field.Name)
+		case opts.Values[field.Name] != nil:
+		case field.Default != nil:
+			cloudProviderSpec[field.Name] = field.Default
+		default:
+			missing = append(missing, field.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("the %s fields %s need a value", opts.CloudProvider, strings.Join(missing, ", "))
+	}
+	for name, value := range opts.Values {
+		if !known[name] {
+			return nil, nil, fmt.Errorf("%s is no field of the cloudProviderSpec of %s", name, opts.CloudProvider)
+		}
+		cloudProviderSpec[name] = value
+	}
+
+	providerSpec := map[string]interface{}{
+		"cloudProvider":       string(opts.CloudProvider),
+		"cloudProviderSpec":   cloudProviderSpec,
+		"operatingSystem":     string(opts.OperatingSystem),
+		"operatingSystemSpec": map[string]interface{}{},
+	}
+	if len(opts.SSHPublicKeys) > 0 {
+		providerSpec["sshPublicKeys"] = opts.SSHPublicKeys
+	}
+	machineSpec := map[string]interface{}{
+		"providerSpec": map[string]interface{}{"value": providerSpec},
+		"versions":     map[string]interface{}{"kubelet": opts.KubeletVersion},
+	}
+	metadata := map[string]interface{}{"name": opts.Name, "namespace": opts.Namespace}
+
+	object := map[string]interface{}{
+		"apiVersion": "cluster.k8s.io/v1alpha1",
+		"kind":       opts.Kind,
+		"metadata":   metadata,
+		"spec":       machineSpec,
+	}
+	if opts.Kind == KindMachineDeployment {
+		labels := map[string]interface{}{"name": opts.Name}
+		object["spec"] = map[string]interface{}{
+			"replicas": opts.Replicas,
+			"selector": map[string]interface{}{"matchLabels": labels},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec":     machineSpec,
+			},
+		}
+	}
+
+	manifest, err := kyaml.Marshal(object)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal the %s: %v", opts.Kind, err)
+	}
+	sort.Strings(secretKeys)
+	return manifest, secretKeys, nil
+}
+
+func checkOptions(opts Options) error {
+	if opts.Kind != KindMachine && opts.Kind != KindMachineDeployment {
+		return fmt.Errorf("kind must be %s or %s, got %q", KindMachine, KindMachineDeployment, opts.Kind)
+	}
+	if opts.Name == "" || opts.Namespace == "" {
+		return errors.New("name and namespace must be set")
+	}
+	if opts.Replicas < 0 {
+		return fmt.Errorf("replicas must not be negative, got %d", opts.Replicas)
+	}
+	found := false
+	for _, os := range providerconfigtypes.AllOperatingSystems {
+		found = found || os == opts.OperatingSystem
+	}
+	if !found {
+		return fmt.Errorf("unknown operating system %q", opts.OperatingSystem)
+	}
+	if opts.KubeletVersion == "" {
+		return errors.New("the kubelet version must be set")
+	}
+	return nil
+}
+
+// cloudProviderSpecFields returns the names of the fields of the cloudProviderSpec of the cloud provider
+func cloudProviderSpecFields(provider providerconfigtypes.CloudProvider) (map[string]bool, error) {
+	schema, err := cloudprovider.ProviderSpecSchema(provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the schema of %s: %v", provider, err)
+	}
+	known := map[string]bool{}
+	properties, _ := schema["properties"].(map[string]interface{})
+	cloudProviderSpec, _ := properties["cloudProviderSpec"].(map[string]interface{})
+	specProperties, _ := cloudProviderSpec["properties"].(map[string]interface{})
+	for name := range specProperties {
+		known[name] = true
+	}
+	return known, nil
+}
+
+// ParseValue returns the value of a field given on the command line, YAML scalars and lists are taken as such,
+// e.g. 50 as number and [a, b] as list. Anything else is taken as string.
+func ParseValue(value string) interface{} {
+	var parsed interface{}
+	if err := kyaml.Unmarshal([]byte(value), &parsed); err != nil || parsed == nil {
+		return value
+	}
+	if _, isMap := parsed.(map[string]interface{}); isMap {
+		return value
+	}
+	return parsed
+}
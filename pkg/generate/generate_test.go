@@ -0,0 +1,196 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generate
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	kyaml "sigs.k8s.io/yaml"
+)
+
+func options(provider providerconfigtypes.CloudProvider) Options {
+	return Options{
+		Kind:            KindMachineDeployment,
+		Name:            "workers",
+		Namespace:       "kube-system",
+		Replicas:        2,
+		CloudProvider:   provider,
+		OperatingSystem: providerconfigtypes.OperatingSystemUbuntu,
+		KubeletVersion:  "1.19.16",
+		SecretName:      "machine-controller-" + string(provider),
+		Values:          map[string]interface{}{},
+	}
+}
+
+func TestGenerateAllProviders(t *testing.T) {
+	for provider, providerFields := range fields {
+		t.Run(string(provider), func(t *testing.T) {
+			known, err := cloudProviderSpecFields(provider)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := options(provider)
+			var expectedKeys []string
+			for _, field := range providerFields {
+				if !known[field.Name] {
+					t.Errorf("%s is no field of the cloudProviderSpec", field.Name)
+				}
+				if field.Secret {
+					expectedKeys = append(expectedKeys, field.Name)
+				} else if field.Default == nil {
+					opts.Values[field.Name] = "value"
+				}
+			}
+
+			manifest, secretKeys, err := Generate(opts)
+			if err != nil {
+				t.Fatalf("Unexpected error generating the manifest: %v", err)
+			}
+			if len(expectedKeys) > 0 || len(secretKeys) > 0 {
+				sort.Strings(expectedKeys)
+				if !reflect.DeepEqual(secretKeys, expectedKeys) {
+					t.Errorf("Expected secret keys %v, got %v", expectedKeys, secretKeys)
+				}
+			}
+
+			machineDeployment := &clusterv1alpha1.MachineDeployment{}
+			if err := kyaml.UnmarshalStrict(manifest, machineDeployment); err != nil {
+				t.Fatalf("Failed to parse the MachineDeployment: %v\n%s", err, manifest)
+			}
+			if *machineDeployment.Spec.Replicas != 2 || machineDeployment.Spec.Template.Labels["name"] != "workers" {
+				t.Errorf("Unexpected MachineDeployment:\n%s", manifest)
+			}
+			providerConfig, err := providerconfigtypes.GetConfig(machineDeployment.Spec.Template.Spec.ProviderSpec)
+			if err != nil {
+				t.Fatalf("Failed to get the provider config: %v", err)
+			}
+			if providerConfig.CloudProvider != provider || providerConfig.OperatingSystem != providerconfigtypes.OperatingSystemUbuntu {
+				t.Errorf("Unexpected provider config %+v", providerConfig)
+			}
+		})
+	}
+}
+
+func TestGenerateMachine(t *testing.T) {
+	opts := options(providerconfigtypes.CloudProviderHetzner)
+	opts.Kind = KindMachine
+	opts.SSHPublicKeys = []string{"ssh-ed25519 AAAA"}
+	opts.Values["serverType"] = ParseValue("cx31")
+	opts.Values["networks"] = ParseValue("[network-1, network-2]")
+
+	manifest, secretKeys, err := Generate(opts)
+	if err != nil {
+		t.Fatalf("Unexpected error generating the manifest: %v", err)
+	}
+	if !reflect.DeepEqual(secretKeys, []string{"token"}) {
+		t.Errorf("Expected the token key, got %v", secretKeys)
+	}
+	machine := &clusterv1alpha1.Machine{}
+	if err := kyaml.UnmarshalStrict(manifest, machine); err != nil {
+		t.Fatalf("Failed to parse the machine: %v\n%s", err, manifest)
+	}
+	providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		t.Fatalf("Failed to get the provider config: %v", err)
+	}
+	spec := map[string]interface{}{}
+	if err := json.Unmarshal(providerConfig.CloudProviderSpec.Raw, &spec); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"token": map[string]interface{}{"secretKeyRef": map[string]interface{}{
+			"namespace": "kube-system", "name": "machine-controller-hetzner", "key": "token",
+		}},
+		"serverType": "cx31",
+		"location":   "fsn1",
+		"networks":   []interface{}{"network-1", "network-2"},
+	}
+	if !reflect.DeepEqual(spec, expected) {
+		t.Errorf("Expected cloudProviderSpec %v, got %v", expected, spec)
+	}
+	if !reflect.DeepEqual(providerConfig.SSHPublicKeys, opts.SSHPublicKeys) {
+		t.Errorf("Expected ssh public keys %v, got %v", opts.SSHPublicKeys, providerConfig.SSHPublicKeys)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Options)
+		err    string
+	}{
+		{
+			name:   "missing required field",
+			modify: func(o *Options) { o.CloudProvider = providerconfigtypes.CloudProviderAWS },
+			err:    "vpcId",
+		},
+		{
+			name:   "credential as value",
+			modify: func(o *Options) { o.Values["token"] = "secret" },
+			err:    "credential",
+		},
+		{
+			name:   "unknown field",
+			modify: func(o *Options) { o.Values["serverTyp"] = "cx31" },
+			err:    "serverTyp",
+		},
+		{
+			name:   "unknown operating system",
+			modify: func(o *Options) { o.OperatingSystem = "plan9" },
+			err:    "plan9",
+		},
+		{
+			name:   "unknown kind",
+			modify: func(o *Options) { o.Kind = "MachineSet" },
+			err:    "MachineSet",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := options(providerconfigtypes.CloudProviderHetzner)
+			test.modify(&opts)
+			_, _, err := Generate(opts)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected an error about %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	for value, expected := range map[string]interface{}{
+		"fsn1":        "fsn1",
+		"50":          float64(50),
+		"true":        true,
+		"[a, b]":      []interface{}{"a", "b"},
+		"a: b":        "a: b",
+		`"0123"`:      "0123",
+		"eu-west-1a ": "eu-west-1a",
+	} {
+		if parsed := ParseValue(value); !reflect.DeepEqual(parsed, expected) {
+			t.Errorf("Expected %q to be parsed as %#v, got %#v", value, expected, parsed)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/heptiolabs/healthcheck"
+)
+
+// ControllerStatus tracks whether this replica runs the controllers and whether their caches are
+// synced. The zero value is ready to use.
+type ControllerStatus struct {
+	lock         sync.RWMutex
+	leading      bool
+	cachesSynced bool
+}
+
+// SetLeading records that this replica acquired the leadership, or starts the controllers without
+// leader election
+func (s *ControllerStatus) SetLeading() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.leading = true
+}
+
+// SetCachesSynced records that the caches of the controllers are synced
+func (s *ControllerStatus) SetCachesSynced() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cachesSynced = true
+}
+
+// CachesSynced returns a check which fails while this replica leads, but the caches of its
+// controllers are not synced yet. Replicas waiting for the leadership are ready, so rollouts don't
+// wait for the leader to step down.
+func CachesSynced(status *ControllerStatus) healthcheck.Check {
+	return func() error {
+		status.lock.RLock()
+		defer status.lock.RUnlock()
+		if status.leading && !status.cachesSynced {
+			return errors.New("the caches of the controllers are not synced yet")
+		}
+		return nil
+	}
+}
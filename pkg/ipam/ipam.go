@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ipam allocates static addresses to machines from IP pools, for environments without DHCP
+// like vSphere. A pool is a configmap in the namespace of its machines:
+//
+//	cidr: 10.0.0.0/24
+//	range: 10.0.0.100-10.0.0.200
+//	gateway: 10.0.0.1
+//	dns: 10.0.0.2,10.0.0.3
+//
+// The allocated addresses are recorded in annotations of the machines, so they are released
+// together with the machines.
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// AnnotationAddress records the address allocated to a machine
+	AnnotationAddress = "machine-controller.kubermatic.io/ip-address"
+	// AnnotationPool records the pool the address of a machine was allocated from
+	AnnotationPool = "machine-controller.kubermatic.io/ip-pool"
+
+	cidrKey    = "cidr"
+	rangeKey   = "range"
+	gatewayKey = "gateway"
+	dnsKey     = "dns"
+)
+
+// Pool is a range of addresses of a network
+type Pool struct {
+	Name    string
+	Network *net.IPNet
+	First   net.IP
+	Last    net.IP
+	Gateway net.IP
+	DNS     []string
+}
+
+// ParsePool returns the pool defined by the given configmap
+func ParsePool(configMap *corev1.ConfigMap) (*Pool, error) {
+	_, network, err := net.ParseCIDR(configMap.Data[cidrKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", cidrKey, configMap.Data[cidrKey], err)
+	}
+	pool := &Pool{Name: configMap.Name, Network: network}
+
+	if gateway := configMap.Data[gatewayKey]; gateway != "" {
+		pool.Gateway = net.ParseIP(gateway)
+		if pool.Gateway == nil || !network.Contains(pool.Gateway) {
+			return nil, fmt.Errorf("invalid %s %q, must be an address of %s", gatewayKey, gateway, network)
+		}
+	}
+
+	for _, server := range strings.Split(configMap.Data[dnsKey], ",") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		if net.ParseIP(server) == nil {
+			return nil, fmt.Errorf("invalid %s server %q", dnsKey, server)
+		}
+		pool.DNS = append(pool.DNS, server)
+	}
+
+	if addressRange := configMap.Data[rangeKey]; addressRange != "" {
+		bounds := strings.SplitN(addressRange, "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid %s %q, must be <first>-<last>", rangeKey, addressRange)
+		}
+		pool.First, pool.Last = net.ParseIP(strings.TrimSpace(bounds[0])), net.ParseIP(strings.TrimSpace(bounds[1]))
+		if pool.First == nil || pool.Last == nil || !network.Contains(pool.First) || !network.Contains(pool.Last) ||
+			bytes.Compare(normalize(pool.First), normalize(pool.Last)) > 0 {
+			return nil, fmt.Errorf("invalid %s %q, must be addresses of %s in ascending order", rangeKey, addressRange, network)
+		}
+	} else {
+		// Skip the network address and, for IPv4, the broadcast address
+		pool.First = next(network.IP)
+		pool.Last = broadcast(network)
+		if network.IP.To4() != nil {
+			pool.Last = previous(pool.Last)
+		}
+	}
+	pool.First, pool.Last = normalize(pool.First), normalize(pool.Last)
+
+	return pool, nil
+}
+
+// Allocate returns the first address of the pool which is neither used nor the gateway
+func (p *Pool) Allocate(used sets.String) (net.IP, error) {
+	if bytes.Compare(p.First, p.Last) > 0 {
+		return nil, fmt.Errorf("pool %s has no addresses", p.Name)
+	}
+	for ip := p.First; ; ip = next(ip) {
+		if !used.Has(ip.String()) && !ip.Equal(p.Gateway) {
+			return ip, nil
+		}
+		// Compared before incrementing, as the last address may be the highest one of the family
+		if ip.Equal(p.Last) {
+			return nil, fmt.Errorf("no address left in pool %s", p.Name)
+		}
+	}
+}
+
+// NetworkConfig returns the static network configuration of the given address of the pool,
+// the gateway and the DNS servers already set in the given configuration take precedence.
+func (p *Pool) NetworkConfig(ip net.IP, config providerconfigtypes.NetworkConfig) *providerconfigtypes.NetworkConfig {
+	ones, _ := p.Network.Mask.Size()
+	config.CIDR = fmt.Sprintf("%s/%d", ip, ones)
+	if config.Gateway == "" && p.Gateway != nil {
+		config.Gateway = p.Gateway.String()
+	}
+	if len(config.DNS.Servers) == 0 {
+		config.DNS.Servers = p.DNS
+	}
+	return &config
+}
+
+// normalize returns the 4 byte form of IPv4 addresses, so addresses of the same family compare
+func normalize(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+func next(ip net.IP) net.IP {
+	ip = append(net.IP{}, normalize(ip)...)
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]++
+		if ip[i] != 0 {
+			break
+		}
+	}
+	return ip
+}
+
+func previous(ip net.IP) net.IP {
+	ip = append(net.IP{}, normalize(ip)...)
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]--
+		if ip[i] != 0xff {
+			break
+		}
+	}
+	return ip
+}
+
+func broadcast(network *net.IPNet) net.IP {
+	ip := append(net.IP{}, normalize(network.IP)...)
+	mask := network.Mask
+	if len(mask) != len(ip) {
+		mask = mask[len(mask)-len(ip):]
+	}
+	for i := range ip {
+		ip[i] |= ^mask[i]
+	}
+	return ip
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"reflect"
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        map[string]string
+		used        []string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "first address of the network",
+			data:     map[string]string{"cidr": "10.0.0.0/24"},
+			expected: "10.0.0.1",
+		},
+		{
+			name:     "gateway and used addresses are skipped",
+			data:     map[string]string{"cidr": "10.0.0.0/24", "gateway": "10.0.0.1"},
+			used:     []string{"10.0.0.2", "10.0.0.4"},
+			expected: "10.0.0.3",
+		},
+		{
+			name:     "first address of the range",
+			data:     map[string]string{"cidr": "10.0.0.0/16", "range": "10.0.1.254-10.0.2.10"},
+			used:     []string{"10.0.1.254", "10.0.1.255"},
+			expected: "10.0.2.0",
+		},
+		{
+			name:        "broadcast address is not allocated",
+			data:        map[string]string{"cidr": "10.0.0.0/30"},
+			used:        []string{"10.0.0.1", "10.0.0.2"},
+			expectedErr: true,
+		},
+		{
+			name:        "exhausted range",
+			data:        map[string]string{"cidr": "10.0.0.0/24", "range": "10.0.0.10-10.0.0.11"},
+			used:        []string{"10.0.0.10", "10.0.0.11"},
+			expectedErr: true,
+		},
+		{
+			name:     "ipv6",
+			data:     map[string]string{"cidr": "fd00::/64", "range": "fd00::ffff-fd00::1:10"},
+			used:     []string{"fd00::ffff"},
+			expected: "fd00::1:0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool, err := ParsePool(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "pool"}, Data: test.data})
+			if err != nil {
+				t.Fatalf("failed to parse pool: %v", err)
+			}
+			ip, err := pool.Allocate(sets.NewString(test.used...))
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if err == nil && ip.String() != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, ip)
+			}
+		})
+	}
+}
+
+func TestParsePoolInvalid(t *testing.T) {
+	for _, data := range []map[string]string{
+		{},
+		{"cidr": "10.0.0.0/24", "gateway": "10.0.1.1"},
+		{"cidr": "10.0.0.0/24", "dns": "dns.example.com"},
+		{"cidr": "10.0.0.0/24", "range": "10.0.0.10"},
+		{"cidr": "10.0.0.0/24", "range": "10.0.0.20-10.0.0.10"},
+		{"cidr": "10.0.0.0/24", "range": "10.0.0.10-10.0.1.10"},
+	} {
+		if _, err := ParsePool(&corev1.ConfigMap{Data: data}); err == nil {
+			t.Errorf("expected an error for %v", data)
+		}
+	}
+}
+
+func TestNetworkConfig(t *testing.T) {
+	pool, err := ParsePool(&corev1.ConfigMap{Data: map[string]string{
+		"cidr":    "10.0.0.0/24",
+		"gateway": "10.0.0.1",
+		"dns":     "192.168.0.53, 192.168.0.54",
+	}})
+	if err != nil {
+		t.Fatalf("failed to parse pool: %v", err)
+	}
+	ip, err := pool.Allocate(sets.NewString())
+	if err != nil {
+		t.Fatalf("failed to allocate: %v", err)
+	}
+
+	config := pool.NetworkConfig(ip, providerconfigtypes.NetworkConfig{IPPool: "pool"})
+	expected := &providerconfigtypes.NetworkConfig{
+		CIDR:    "10.0.0.2/24",
+		Gateway: "10.0.0.1",
+		DNS:     providerconfigtypes.DNSConfig{Servers: []string{"192.168.0.53", "192.168.0.54"}},
+		IPPool:  "pool",
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	config = pool.NetworkConfig(ip, providerconfigtypes.NetworkConfig{Gateway: "10.0.0.254", DNS: providerconfigtypes.DNSConfig{Servers: []string{"1.1.1.1"}}})
+	if config.Gateway != "10.0.0.254" || !reflect.DeepEqual(config.DNS.Servers, []string{"1.1.1.1"}) {
+		t.Errorf("expected the gateway and the DNS servers of the machine to take precedence, got %+v", config)
+	}
+}
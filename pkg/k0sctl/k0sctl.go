@@ -0,0 +1,226 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package k0sctl renders machines of the k0s bootstrap flavor as hosts of a k0sctl configuration, for clusters
+// mixing nodes of the machine-controller with nodes managed by k0sctl
+package k0sctl
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/semver"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+	userdatamanager "github.com/kubermatic/machine-controller/pkg/userdata/manager"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// APIVersion is the API version of the k0sctl configurations
+	APIVersion = "k0sctl.k0sproject.io/v1beta1"
+	// Kind is the kind of the k0sctl configurations
+	Kind = "Cluster"
+
+	// RoleWorker is the k0sctl role of k0s workers
+	RoleWorker = "worker"
+	// RoleControllerWorker is the k0sctl role of k0s controllers running a worker, which is how the
+	// machine-controller installs controllers
+	RoleControllerWorker = "controller+worker"
+
+	// defaultSSHUser is the default user of the Ubuntu images, the only operating system of the k0s flavor
+	defaultSSHUser = "ubuntu"
+	defaultSSHPort = 22
+)
+
+// Cluster is a k0sctl configuration
+type Cluster struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Metadata   Metadata `json:"metadata"`
+	Spec       Spec     `json:"spec"`
+}
+
+// Metadata of a k0sctl configuration
+type Metadata struct {
+	Name string `json:"name"`
+}
+
+// Spec of a k0sctl configuration
+type Spec struct {
+	Hosts []Host `json:"hosts"`
+	K0s   K0s    `json:"k0s"`
+}
+
+// Host is a node k0sctl manages via SSH
+type Host struct {
+	Role string `json:"role"`
+	SSH  SSH    `json:"ssh"`
+	// PrivateAddress is the address the node is reached at by the other nodes
+	PrivateAddress string `json:"privateAddress,omitempty"`
+	// InstallFlags are passed to k0s install when k0sctl installs the node
+	InstallFlags []string `json:"installFlags,omitempty"`
+}
+
+// SSH are the connection details of a host
+type SSH struct {
+	Address string `json:"address"`
+	User    string `json:"user"`
+	Port    int    `json:"port"`
+	KeyPath string `json:"keyPath,omitempty"`
+}
+
+// K0s configures the k0s release of the cluster
+type K0s struct {
+	Version string `json:"version"`
+	// DynamicConfig must be set for clusters with controllers of the machine-controller, which join with it
+	DynamicConfig bool `json:"dynamicConfig,omitempty"`
+}
+
+// Export returns the k0sctl configuration with the given name and SSH key listing the given machines as hosts.
+// k0sctl only supports a single k0s release, which is the newest one of the machines. Machines which are being
+// deleted, don't use the k0s flavor, run a single node cluster of their own or have no address yet are skipped. The returned warnings name the skipped
+// machines and machines running another release.
+func Export(name, keyPath string, machines []clusterv1alpha1.Machine) (*Cluster, []string) {
+	cluster := &Cluster{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Metadata:   Metadata{Name: name},
+		Spec:       Spec{Hosts: []Host{}},
+	}
+
+	var warnings []string
+	versions := map[string]*semver.Version{}
+	for _, machine := range machines {
+		if machine.DeletionTimestamp != nil {
+			warnings = append(warnings, fmt.Sprintf("skipping machine %s, it is being deleted", machine.Name))
+			continue
+		}
+		providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("skipping machine %s, failed to get its provider config: %v", machine.Name, err))
+			continue
+		}
+		flavor := providerConfig.BootstrapFlavor
+		if flavor == "" {
+			flavor = userdatamanager.DefaultBootstrapFlavor(providerConfig.OperatingSystem)
+		}
+		if flavor != providerconfigtypes.BootstrapFlavorK0s {
+			warnings = append(warnings, fmt.Sprintf("skipping machine %s, it uses the %s bootstrap flavor", machine.Name, flavor))
+			continue
+		}
+		if providerConfig.Role == providerconfigtypes.NodeRoleSingle {
+			warnings = append(warnings, fmt.Sprintf("skipping machine %s, it runs a single node cluster of its own", machine.Name))
+			continue
+		}
+		host, ok := hostOf(machine, providerConfig, keyPath)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("skipping machine %s, it has no address yet", machine.Name))
+			continue
+		}
+		cluster.Spec.Hosts = append(cluster.Spec.Hosts, host)
+		if host.Role == RoleControllerWorker {
+			cluster.Spec.K0s.DynamicConfig = true
+		}
+
+		version := providerConfig.K0sVersion
+		if version == "" {
+			version = userdatahelper.DefaultK0sVersion
+		}
+		if _, ok := versions[version]; !ok {
+			parsed, err := semver.NewVersion(version)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("ignoring invalid k0s version %q of machine %s: %v", version, machine.Name, err))
+				continue
+			}
+			versions[version] = parsed
+		}
+	}
+
+	// Build metadata like the k0s revision doesn't count in comparisons, sorting breaks the ties
+	var sorted []string
+	for version := range versions {
+		sorted = append(sorted, version)
+	}
+	sort.Strings(sorted)
+	var newest *semver.Version
+	for _, version := range sorted {
+		if newest == nil || !versions[version].LessThan(newest) {
+			newest = versions[version]
+			cluster.Spec.K0s.Version = version
+		}
+	}
+	if len(sorted) > 1 {
+		var others []string
+		for _, version := range sorted {
+			if version != cluster.Spec.K0s.Version {
+				others = append(others, version)
+			}
+		}
+		warnings = append(warnings, fmt.Sprintf("the machines run several k0s releases, k0sctl would upgrade the ones running %v to %s", others, cluster.Spec.K0s.Version))
+	}
+	return cluster, warnings
+}
+
+// hostOf returns the k0sctl host of the given machine and whether it has an address to connect to
+func hostOf(machine clusterv1alpha1.Machine, providerConfig *providerconfigtypes.Config, keyPath string) (Host, bool) {
+	var externalIP, internalIP string
+	for _, address := range machine.Status.Addresses {
+		switch {
+		case address.Type == corev1.NodeExternalIP && externalIP == "":
+			externalIP = address.Address
+		case address.Type == corev1.NodeInternalIP && internalIP == "":
+			internalIP = address.Address
+		}
+	}
+	if externalIP == "" && internalIP == "" {
+		return Host{}, false
+	}
+
+	host := Host{
+		Role: RoleWorker,
+		SSH: SSH{
+			Address: externalIP,
+			User:    defaultSSHUser,
+			Port:    defaultSSHPort,
+			KeyPath: keyPath,
+		},
+	}
+	// Nodes without public address are only reachable within their network, e.g. via a bastion
+	if externalIP == "" {
+		host.SSH.Address = internalIP
+	} else {
+		host.PrivateAddress = internalIP
+	}
+	if providerConfig.SSH != nil && providerConfig.SSH.User != "" {
+		host.SSH.User = providerConfig.SSH.User
+	}
+
+	// The flags k0sctl passes when it reinstalls the node, matching the ones of the userdata
+	if providerConfig.Role == providerconfigtypes.NodeRoleController {
+		host.Role = RoleControllerWorker
+		if providerConfig.Controller != nil && providerConfig.Controller.Schedulable {
+			host.InstallFlags = append(host.InstallFlags, "--no-taints")
+		}
+	}
+	if providerConfig.WorkerProfile != "" {
+		host.InstallFlags = append(host.InstallFlags, fmt.Sprintf("--profile=%s", providerConfig.WorkerProfile))
+	}
+	return host, true
+}
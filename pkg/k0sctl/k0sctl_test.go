@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k0sctl
+
+import (
+	"reflect"
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestExport(t *testing.T) {
+	machine := func(name, providerSpec string, addresses ...corev1.NodeAddress) clusterv1alpha1.Machine {
+		m := clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		m.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(providerSpec)}
+		m.Status.Addresses = addresses
+		return m
+	}
+	external := corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.10"}
+	internal := corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.10"}
+	deleted := machine("deleted", `{"operatingSystem":"ubuntu"}`, internal)
+	deleted.DeletionTimestamp = &metav1.Time{}
+
+	machines := []clusterv1alpha1.Machine{
+		machine("controller", `{"operatingSystem":"ubuntu","k0sVersion":"v1.30.1+k0s.0","role":"controller","controller":{"schedulable":true},"ssh":{"user":"admin"}}`, internal, external),
+		machine("worker", `{"operatingSystem":"ubuntu","k0sVersion":"v1.30.0+k0s.0","workerProfile":"high-density"}`, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.11"}),
+		machine("pending", `{"operatingSystem":"ubuntu"}`),
+		machine("kubeadm", `{"operatingSystem":"centos"}`, internal),
+		machine("edge", `{"operatingSystem":"ubuntu","role":"single"}`, internal),
+		deleted,
+	}
+
+	cluster, warnings := Export("k0s-cluster", "~/.ssh/id_ed25519", machines)
+
+	expectedHosts := []Host{
+		{
+			Role:           RoleControllerWorker,
+			SSH:            SSH{Address: "203.0.113.10", User: "admin", Port: 22, KeyPath: "~/.ssh/id_ed25519"},
+			PrivateAddress: "10.0.0.10",
+			InstallFlags:   []string{"--no-taints"},
+		},
+		{
+			Role:         RoleWorker,
+			SSH:          SSH{Address: "10.0.0.11", User: "ubuntu", Port: 22, KeyPath: "~/.ssh/id_ed25519"},
+			InstallFlags: []string{"--profile=high-density"},
+		},
+	}
+	if !reflect.DeepEqual(cluster.Spec.Hosts, expectedHosts) {
+		t.Errorf("expected hosts\n%+v\ngot\n%+v", expectedHosts, cluster.Spec.Hosts)
+	}
+	expectedK0s := K0s{Version: "v1.30.1+k0s.0", DynamicConfig: true}
+	if cluster.Spec.K0s != expectedK0s {
+		t.Errorf("expected k0s settings %+v, got %+v", expectedK0s, cluster.Spec.K0s)
+	}
+	expectedWarnings := []string{
+		"skipping machine pending, it has no address yet",
+		"skipping machine kubeadm, it uses the kubeadm bootstrap flavor",
+		"skipping machine edge, it runs a single node cluster of its own",
+		"skipping machine deleted, it is being deleted",
+		"the machines run several k0s releases, k0sctl would upgrade the ones running [v1.30.0+k0s.0] to v1.30.1+k0s.0",
+	}
+	if !reflect.DeepEqual(warnings, expectedWarnings) {
+		t.Errorf("expected warnings\n%v\ngot\n%v", expectedWarnings, warnings)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubectlplugin implements the operations of the kubectl machine plugin on the status of machines,
+// so operators don't need the consoles of the cloud providers for them
+package kubectlplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// StatusHeader is the header of the rows returned by StatusRow
+var StatusHeader = []string{"NAME", "PHASE", "PROVIDER", "INSTANCE", "INSTANCE STATUS", "ADDRESS", "NODE", "LOCATION", "AGE", "ERROR"}
+
+// providerStatus holds the fields the machine-controller sets in the provider status of machines
+type providerStatus struct {
+	InstanceID     string `json:"instanceID,omitempty"`
+	InstanceStatus string `json:"instanceStatus,omitempty"`
+}
+
+// InstanceID returns the ID of the instance of the machine, as last seen by the machine-controller
+func InstanceID(machine *clusterv1alpha1.Machine) string {
+	return getProviderStatus(machine).InstanceID
+}
+
+func getProviderStatus(machine *clusterv1alpha1.Machine) providerStatus {
+	status := providerStatus{}
+	if machine.Status.ProviderStatus != nil && len(machine.Status.ProviderStatus.Raw) > 0 {
+		// Machines of older versions have no or other fields, they are shown without instance
+		_ = json.Unmarshal(machine.Status.ProviderStatus.Raw, &status)
+	}
+	return status
+}
+
+// StatusRow returns the columns of StatusHeader for the given machine. Missing values are shown as <none>.
+func StatusRow(machine *clusterv1alpha1.Machine, now time.Time) []string {
+	cloudProvider := ""
+	if providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec); err == nil {
+		cloudProvider = string(providerConfig.CloudProvider)
+	}
+	phase := ""
+	if machine.Status.Phase != nil {
+		phase = *machine.Status.Phase
+	}
+	node := ""
+	if machine.Status.NodeRef != nil {
+		node = machine.Status.NodeRef.Name
+	}
+	location := ""
+	if machine.Status.InstanceMetadata != nil {
+		location = machine.Status.InstanceMetadata.Location
+	}
+	errorMessage := ""
+	if machine.Status.ErrorReason != nil {
+		errorMessage = string(*machine.Status.ErrorReason)
+		if machine.Status.ErrorMessage != nil {
+			errorMessage += ": " + *machine.Status.ErrorMessage
+		}
+	}
+	status := getProviderStatus(machine)
+	address, _ := preferredAddress(machine, false)
+
+	columns := []string{
+		machine.Name,
+		phase,
+		cloudProvider,
+		status.InstanceID,
+		status.InstanceStatus,
+		address,
+		node,
+		location,
+		duration.HumanDuration(now.Sub(machine.CreationTimestamp.Time)),
+		errorMessage,
+	}
+	for i := range columns {
+		if columns[i] == "" {
+			columns[i] = "<none>"
+		}
+	}
+	return columns
+}
+
+// preferredAddress returns the external address of the machine, or its internal one if it has none or
+// preferInternal is set
+func preferredAddress(machine *clusterv1alpha1.Machine, preferInternal bool) (string, bool) {
+	var externalIP, internalIP string
+	for _, address := range machine.Status.Addresses {
+		switch {
+		case address.Type == corev1.NodeExternalIP && externalIP == "":
+			externalIP = address.Address
+		case address.Type == corev1.NodeInternalIP && internalIP == "":
+			internalIP = address.Address
+		}
+	}
+	if internalIP != "" && (preferInternal || externalIP == "") {
+		return internalIP, true
+	}
+	return externalIP, externalIP != ""
+}
+
+// SSHTarget returns the user and the address to connect to the instance of the machine with SSH. The user
+// is the one of the sshSettings of the machine or the default user of its operating system.
+func SSHTarget(machine *clusterv1alpha1.Machine, preferInternal bool) (string, string, error) {
+	providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get provider config: %v", err)
+	}
+	if providerConfig.SSH != nil && providerConfig.SSH.Disabled {
+		return "", "", fmt.Errorf("the SSH daemon of machine %s is disabled", machine.Name)
+	}
+	address, ok := preferredAddress(machine, preferInternal)
+	if !ok {
+		return "", "", fmt.Errorf("machine %s has no address in its status yet", machine.Name)
+	}
+	user := defaultSSHUser(providerConfig.OperatingSystem)
+	if providerConfig.SSH != nil && providerConfig.SSH.User != "" {
+		user = providerConfig.SSH.User
+	}
+	return user, address, nil
+}
+
+// defaultSSHUser returns the default user of the cloud images of the operating system
+func defaultSSHUser(os providerconfigtypes.OperatingSystem) string {
+	switch os {
+	case providerconfigtypes.OperatingSystemCoreos, providerconfigtypes.OperatingSystemFlatcar, providerconfigtypes.OperatingSystemFedoraCoreOS:
+		return "core"
+	case providerconfigtypes.OperatingSystemRHEL:
+		return "cloud-user"
+	case providerconfigtypes.OperatingSystemRockyLinux:
+		return "rocky"
+	case providerconfigtypes.OperatingSystemAmazonLinux2023:
+		return "ec2-user"
+	default:
+		return string(os)
+	}
+}
+
+// ConsoleURL returns the URL of the instance of the machine in the web console of its cloud provider. Providers
+// whose URLs need more than the status of the machine, e.g. the project, are not supported.
+func ConsoleURL(machine *clusterv1alpha1.Machine) (string, error) {
+	providerConfig, err := providerconfigtypes.GetConfig(machine.Spec.ProviderSpec)
+	if err != nil {
+		return "", fmt.Errorf("failed to get provider config: %v", err)
+	}
+	instanceID := InstanceID(machine)
+	if instanceID == "" {
+		return "", fmt.Errorf("machine %s has no instance in its status yet", machine.Name)
+	}
+
+	switch providerConfig.CloudProvider {
+	case providerconfigtypes.CloudProviderAWS:
+		region := ""
+		if machine.Status.InstanceMetadata != nil {
+			region = awsRegion(machine.Status.InstanceMetadata.Location)
+		}
+		if region == "" {
+			return "", fmt.Errorf("machine %s has no location in its status yet", machine.Name)
+		}
+		return fmt.Sprintf("https://console.aws.amazon.com/ec2/v2/home?region=%s#InstanceDetails:instanceId=%s", region, url.QueryEscape(instanceID)), nil
+	case providerconfigtypes.CloudProviderAzure:
+		// The ID is the resource ID of the virtual machine
+		return fmt.Sprintf("https://portal.azure.com/#@/resource%s/overview", instanceID), nil
+	case providerconfigtypes.CloudProviderDigitalocean:
+		return fmt.Sprintf("https://cloud.digitalocean.com/droplets/%s", url.PathEscape(instanceID)), nil
+	case providerconfigtypes.CloudProviderLinode:
+		return fmt.Sprintf("https://cloud.linode.com/linodes/%s", url.PathEscape(instanceID)), nil
+	case providerconfigtypes.CloudProviderPacket:
+		return fmt.Sprintf("https://console.equinix.com/devices/%s", url.PathEscape(instanceID)), nil
+	default:
+		return "", fmt.Errorf("console URLs of cloud provider %s are not supported", providerConfig.CloudProvider)
+	}
+}
+
+// awsRegion returns the region of an availability zone, e.g. us-east-1 of us-east-1a. Local zones like
+// us-west-2-lax-1a are in the region of their first three parts.
+func awsRegion(zone string) string {
+	region := strings.TrimRight(zone, "abcdefghijklmnopqrstuvwxyz")
+	if parts := strings.Split(region, "-"); len(parts) > 3 {
+		region = strings.Join(parts[:3], "-")
+	}
+	return region
+}
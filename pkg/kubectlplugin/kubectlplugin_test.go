@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubectlplugin
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newMachine(providerSpec, providerStatus string, addresses ...corev1.NodeAddress) *clusterv1alpha1.Machine {
+	m := &clusterv1alpha1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine"}}
+	m.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(providerSpec)}
+	if providerStatus != "" {
+		m.Status.ProviderStatus = &runtime.RawExtension{Raw: []byte(providerStatus)}
+	}
+	m.Status.Addresses = addresses
+	return m
+}
+
+var (
+	external = corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.10"}
+	internal = corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.10"}
+)
+
+func TestStatusRow(t *testing.T) {
+	now := time.Now()
+	machine := newMachine(`{"cloudProvider":"hetzner","operatingSystem":"ubuntu"}`, `{"instanceID":"42","instanceStatus":"running"}`, internal, external)
+	machine.CreationTimestamp = metav1.NewTime(now.Add(-5 * time.Hour))
+	phase := "Failed"
+	machine.Status.Phase = &phase
+	reason := common.CreateMachineError
+	message := "quota exceeded"
+	machine.Status.ErrorReason = &reason
+	machine.Status.ErrorMessage = &message
+	machine.Status.InstanceMetadata = &clusterv1alpha1.InstanceMetadata{Location: "fsn1"}
+
+	expected := []string{"machine", "Failed", "hetzner", "42", "running", "203.0.113.10", "<none>", "fsn1", "5h", "CreateError: quota exceeded"}
+	if row := StatusRow(machine, now); !reflect.DeepEqual(row, expected) {
+		t.Errorf("Expected row %v, got %v", expected, row)
+	}
+	if len(expected) != len(StatusHeader) {
+		t.Errorf("Expected %d columns like the header, got %d", len(StatusHeader), len(expected))
+	}
+}
+
+func TestSSHTarget(t *testing.T) {
+	tests := []struct {
+		name           string
+		machine        *clusterv1alpha1.Machine
+		preferInternal bool
+		user           string
+		address        string
+		err            bool
+	}{
+		{
+			name:    "external address and default user",
+			machine: newMachine(`{"operatingSystem":"flatcar"}`, "", internal, external),
+			user:    "core",
+			address: "203.0.113.10",
+		},
+		{
+			name:           "internal address preferred",
+			machine:        newMachine(`{"operatingSystem":"ubuntu"}`, "", internal, external),
+			preferInternal: true,
+			user:           "ubuntu",
+			address:        "10.0.0.10",
+		},
+		{
+			name:    "internal address only and user of the ssh settings",
+			machine: newMachine(`{"operatingSystem":"ubuntu","ssh":{"user":"admin"}}`, "", internal),
+			user:    "admin",
+			address: "10.0.0.10",
+		},
+		{
+			name:    "no address",
+			machine: newMachine(`{"operatingSystem":"ubuntu"}`, ""),
+			err:     true,
+		},
+		{
+			name:    "ssh disabled",
+			machine: newMachine(`{"operatingSystem":"ubuntu","ssh":{"disabled":true}}`, "", external),
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, address, err := SSHTarget(test.machine, test.preferInternal)
+			if (err != nil) != test.err {
+				t.Fatalf("Expected error to be %t, got %v", test.err, err)
+			}
+			if user != test.user || address != test.address {
+				t.Errorf("Expected %s@%s, got %s@%s", test.user, test.address, user, address)
+			}
+		})
+	}
+}
+
+func TestConsoleURL(t *testing.T) {
+	withLocation := func(m *clusterv1alpha1.Machine, location string) *clusterv1alpha1.Machine {
+		m.Status.InstanceMetadata = &clusterv1alpha1.InstanceMetadata{Location: location}
+		return m
+	}
+	tests := []struct {
+		name     string
+		machine  *clusterv1alpha1.Machine
+		expected string
+		err      bool
+	}{
+		{
+			name:     "aws",
+			machine:  withLocation(newMachine(`{"cloudProvider":"aws"}`, `{"instanceID":"i-0123"}`), "eu-central-1b"),
+			expected: "https://console.aws.amazon.com/ec2/v2/home?region=eu-central-1#InstanceDetails:instanceId=i-0123",
+		},
+		{
+			name:     "aws local zone",
+			machine:  withLocation(newMachine(`{"cloudProvider":"aws"}`, `{"instanceID":"i-0123"}`), "us-west-2-lax-1a"),
+			expected: "https://console.aws.amazon.com/ec2/v2/home?region=us-west-2#InstanceDetails:instanceId=i-0123",
+		},
+		{
+			name:    "aws without location",
+			machine: newMachine(`{"cloudProvider":"aws"}`, `{"instanceID":"i-0123"}`),
+			err:     true,
+		},
+		{
+			name:     "azure",
+			machine:  newMachine(`{"cloudProvider":"azure"}`, `{"instanceID":"/subscriptions/s/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm"}`),
+			expected: "https://portal.azure.com/#@/resource/subscriptions/s/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm/overview",
+		},
+		{
+			name:     "digitalocean",
+			machine:  newMachine(`{"cloudProvider":"digitalocean"}`, `{"instanceID":"1234"}`),
+			expected: "https://cloud.digitalocean.com/droplets/1234",
+		},
+		{
+			name:    "no instance",
+			machine: newMachine(`{"cloudProvider":"linode"}`, ""),
+			err:     true,
+		},
+		{
+			name:    "unsupported provider",
+			machine: newMachine(`{"cloudProvider":"hetzner"}`, `{"instanceID":"42"}`),
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consoleURL, err := ConsoleURL(test.machine)
+			if (err != nil) != test.err {
+				t.Fatalf("Expected error to be %t, got %v", test.err, err)
+			}
+			if consoleURL != test.expected {
+				t.Errorf("Expected URL %q, got %q", test.expected, consoleURL)
+			}
+		})
+	}
+}
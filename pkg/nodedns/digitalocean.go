@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodedns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/digitalocean/godo"
+	"golang.org/x/oauth2"
+)
+
+// digitalOceanProvider manages the records of a domain hosted by DigitalOcean
+type digitalOceanProvider struct {
+	domains godo.DomainsService
+	zone    string
+}
+
+func newDigitalOcean(zone string) (*digitalOceanProvider, error) {
+	token := os.Getenv("DO_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("the DO_TOKEN environment variable is required")
+	}
+	client := godo.NewClient(oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+	return &digitalOceanProvider{domains: client.Domains, zone: zone}, nil
+}
+
+// records returns the A and AAAA records of the given name, relative to the domain
+func (p *digitalOceanProvider) records(ctx context.Context, name string) ([]godo.DomainRecord, error) {
+	var records []godo.DomainRecord
+	opt := &godo.ListOptions{PerPage: 200}
+	for {
+		page, resp, err := p.domains.Records(ctx, p.zone, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list records of %s: %v", p.zone, err)
+		}
+		for _, record := range page {
+			if record.Name == name && (record.Type == "A" || record.Type == "AAAA") {
+				records = append(records, record)
+			}
+		}
+		if resp == nil || resp.Links == nil || resp.Links.IsLastPage() {
+			return records, nil
+		}
+		current, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the current page of the records of %s: %v", p.zone, err)
+		}
+		opt.Page = current + 1
+	}
+}
+
+func (p *digitalOceanProvider) Ensure(ctx context.Context, name string, addresses []net.IP) error {
+	existing, err := p.records(ctx, name)
+	if err != nil {
+		return err
+	}
+	missing := map[string]net.IP{}
+	for _, address := range addresses {
+		missing[address.String()] = address
+	}
+	for _, record := range existing {
+		if _, ok := missing[record.Data]; ok && recordType(missing[record.Data]) == record.Type {
+			delete(missing, record.Data)
+			continue
+		}
+		if _, err := p.domains.DeleteRecord(ctx, p.zone, record.ID); err != nil {
+			return fmt.Errorf("failed to delete %s record %s of %s: %v", record.Type, record.Data, name, err)
+		}
+	}
+	for data, address := range missing {
+		request := &godo.DomainRecordEditRequest{Type: recordType(address), Name: name, Data: data}
+		if _, _, err := p.domains.CreateRecord(ctx, p.zone, request); err != nil {
+			return fmt.Errorf("failed to create %s record %s of %s: %v", request.Type, data, name, err)
+		}
+	}
+	return nil
+}
+
+func (p *digitalOceanProvider) Remove(ctx context.Context, name string) error {
+	existing, err := p.records(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, record := range existing {
+		if _, err := p.domains.DeleteRecord(ctx, p.zone, record.ID); err != nil {
+			return fmt.Errorf("failed to delete %s record %s of %s: %v", record.Type, record.Data, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nodedns registers DNS records for the addresses of machines, keyed by the name of the machine,
+// e.g. for ingress nodes or SSH bastions which should be reachable under a stable name.
+package nodedns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// ProviderRoute53 manages the records in an AWS Route53 hosted zone
+	ProviderRoute53 = "route53"
+	// ProviderDigitalOcean manages the records of a DigitalOcean domain
+	ProviderDigitalOcean = "digitalocean"
+
+	// recordTTL is the TTL of the records in seconds, it is kept low as addresses change with new instances
+	recordTTL = 300
+)
+
+// Provider manages the A and AAAA records of names in a zone
+type Provider interface {
+	// Ensure makes the A and AAAA records of the given name, relative to the zone, resolve to exactly the
+	// given addresses
+	Ensure(ctx context.Context, name string, addresses []net.IP) error
+	// Remove deletes the A and AAAA records of the given name, relative to the zone
+	Remove(ctx context.Context, name string) error
+}
+
+// New returns the provider of the given name for the given zone, e.g. example.com. Its credentials are
+// read from the environment, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY for Route53, DO_TOKEN for DigitalOcean.
+func New(provider, zone string) (Provider, error) {
+	zone = strings.TrimSuffix(zone, ".")
+	if zone == "" {
+		return nil, fmt.Errorf("a zone is required")
+	}
+	switch provider {
+	case ProviderRoute53:
+		return newRoute53(zone)
+	case ProviderDigitalOcean:
+		return newDigitalOcean(zone)
+	default:
+		return nil, fmt.Errorf("unknown provider %q, must be one of %s, %s", provider, ProviderRoute53, ProviderDigitalOcean)
+	}
+}
+
+// Registrar registers the records of machines. The addresses registered last are remembered, so the
+// provider is only called once they change.
+type Registrar struct {
+	provider Provider
+
+	// registered holds the addresses registered for a machine name, joined by commas
+	registered sync.Map
+}
+
+// NewRegistrar returns a registrar for the given provider
+func NewRegistrar(provider Provider) *Registrar {
+	return &Registrar{provider: provider}
+}
+
+// Register points the records of the machine to its external addresses, or its internal ones if it has none.
+// Machines without addresses are not registered yet.
+func (r *Registrar) Register(ctx context.Context, machineName string, addresses []corev1.NodeAddress) error {
+	ips := recordAddresses(addresses)
+	if len(ips) == 0 {
+		return nil
+	}
+	key := joinIPs(ips)
+	if registered, ok := r.registered.Load(machineName); ok && registered.(string) == key {
+		return nil
+	}
+	if err := r.provider.Ensure(ctx, machineName, ips); err != nil {
+		return fmt.Errorf("failed to register dns records of %s: %v", machineName, err)
+	}
+	klog.V(2).Infof("Registered dns records of machine %s for %s", machineName, key)
+	r.registered.Store(machineName, key)
+	return nil
+}
+
+// Deregister deletes the records of the machine
+func (r *Registrar) Deregister(ctx context.Context, machineName string) error {
+	if err := r.provider.Remove(ctx, machineName); err != nil {
+		return fmt.Errorf("failed to deregister dns records of %s: %v", machineName, err)
+	}
+	r.registered.Delete(machineName)
+	return nil
+}
+
+// recordAddresses returns the sorted external addresses, or the internal ones if there are no external ones
+func recordAddresses(addresses []corev1.NodeAddress) []net.IP {
+	for _, addressType := range []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeInternalIP} {
+		var ips []net.IP
+		for _, address := range addresses {
+			if address.Type != addressType {
+				continue
+			}
+			if ip := net.ParseIP(address.Address); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+		if len(ips) > 0 {
+			sort.Slice(ips, func(i, j int) bool { return ips[i].String() < ips[j].String() })
+			return ips
+		}
+	}
+	return nil
+}
+
+func joinIPs(ips []net.IP) string {
+	values := make([]string, len(ips))
+	for i, ip := range ips {
+		values[i] = ip.String()
+	}
+	return strings.Join(values, ",")
+}
+
+// recordType returns the type of the record of the given address
+func recordType(ip net.IP) string {
+	if ip.To4() != nil {
+		return "A"
+	}
+	return "AAAA"
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodedns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type fakeProvider struct {
+	records map[string]string
+	calls   int
+}
+
+func (p *fakeProvider) Ensure(_ context.Context, name string, addresses []net.IP) error {
+	p.calls++
+	p.records[name] = joinIPs(addresses)
+	return nil
+}
+
+func (p *fakeProvider) Remove(_ context.Context, name string) error {
+	p.calls++
+	delete(p.records, name)
+	return nil
+}
+
+func TestRegistrar(t *testing.T) {
+	provider := &fakeProvider{records: map[string]string{}}
+	registrar := NewRegistrar(provider)
+	ctx := context.Background()
+
+	if err := registrar.Register(ctx, "no-addresses", nil); err != nil {
+		t.Fatalf("failed to register machine without addresses: %v", err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("Expected machines without addresses not to be registered, got %d calls", provider.calls)
+	}
+
+	addresses := []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+		{Type: corev1.NodeExternalIP, Address: "2001:db8::1"},
+		{Type: corev1.NodeExternalIP, Address: "192.0.2.1"},
+		{Type: corev1.NodeHostName, Address: "bastion"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := registrar.Register(ctx, "bastion", addresses); err != nil {
+			t.Fatalf("failed to register machine: %v", err)
+		}
+	}
+	if records := provider.records["bastion"]; records != "192.0.2.1,2001:db8::1" {
+		t.Errorf("Expected the external addresses to be registered, got %q", records)
+	}
+	if provider.calls != 1 {
+		t.Errorf("Expected unchanged addresses to be registered once, got %d calls", provider.calls)
+	}
+
+	internal := []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.2"}}
+	if err := registrar.Register(ctx, "bastion", internal); err != nil {
+		t.Fatalf("failed to register machine: %v", err)
+	}
+	if records := provider.records["bastion"]; records != "10.0.0.2" {
+		t.Errorf("Expected the internal address to be registered without external ones, got %q", records)
+	}
+
+	if err := registrar.Deregister(ctx, "bastion"); err != nil {
+		t.Fatalf("failed to deregister machine: %v", err)
+	}
+	if _, ok := provider.records["bastion"]; ok {
+		t.Error("Expected the records to be removed")
+	}
+	if err := registrar.Register(ctx, "bastion", internal); err != nil {
+		t.Fatalf("failed to register machine: %v", err)
+	}
+	if _, ok := provider.records["bastion"]; !ok {
+		t.Error("Expected a deregistered machine to be registered again")
+	}
+}
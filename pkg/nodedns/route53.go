@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodedns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+// route53Provider manages the records in the public hosted zone of the zone name
+type route53Provider struct {
+	client *route53.Route53
+	zone   string
+
+	lock sync.Mutex
+	// zoneID is looked up on first use
+	zoneID string
+}
+
+func newRoute53(zone string) (*route53Provider, error) {
+	// Route53 is a global service, its API is served from us-east-1
+	sess, err := session.NewSession(aws.NewConfig().WithRegion("us-east-1"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aws session: %v", err)
+	}
+	return &route53Provider{client: route53.New(sess), zone: zone}, nil
+}
+
+func (p *route53Provider) hostedZoneID(ctx context.Context) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.zoneID != "" {
+		return p.zoneID, nil
+	}
+	out, err := p.client.ListHostedZonesByNameWithContext(ctx, &route53.ListHostedZonesByNameInput{DNSName: aws.String(p.zone + ".")})
+	if err != nil {
+		return "", fmt.Errorf("failed to list hosted zones: %v", err)
+	}
+	for _, zone := range out.HostedZones {
+		if aws.StringValue(zone.Name) == p.zone+"." && (zone.Config == nil || !aws.BoolValue(zone.Config.PrivateZone)) {
+			p.zoneID = aws.StringValue(zone.Id)
+			return p.zoneID, nil
+		}
+	}
+	return "", fmt.Errorf("no public hosted zone %s found", p.zone)
+}
+
+// recordSets returns the A and AAAA record sets of the given fully qualified name
+func (p *route53Provider) recordSets(ctx context.Context, zoneID, fqdn string) ([]*route53.ResourceRecordSet, error) {
+	out, err := p.client.ListResourceRecordSetsWithContext(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(fqdn),
+		MaxItems:        aws.String("10"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list record sets: %v", err)
+	}
+	var sets []*route53.ResourceRecordSet
+	for _, set := range out.ResourceRecordSets {
+		if aws.StringValue(set.Name) != fqdn {
+			break
+		}
+		if recordType := aws.StringValue(set.Type); recordType == route53.RRTypeA || recordType == route53.RRTypeAaaa {
+			sets = append(sets, set)
+		}
+	}
+	return sets, nil
+}
+
+func (p *route53Provider) Ensure(ctx context.Context, name string, addresses []net.IP) error {
+	zoneID, err := p.hostedZoneID(ctx)
+	if err != nil {
+		return err
+	}
+	fqdn := name + "." + p.zone + "."
+
+	records := map[string][]*route53.ResourceRecord{}
+	for _, address := range addresses {
+		recordType := recordType(address)
+		records[recordType] = append(records[recordType], &route53.ResourceRecord{Value: aws.String(address.String())})
+	}
+	var changes []*route53.Change
+	for recordType, values := range records {
+		changes = append(changes, &route53.Change{
+			Action: aws.String(route53.ChangeActionUpsert),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name:            aws.String(fqdn),
+				Type:            aws.String(recordType),
+				TTL:             aws.Int64(recordTTL),
+				ResourceRecords: values,
+			},
+		})
+	}
+	// Record sets of an address family the machine no longer has are deleted
+	existing, err := p.recordSets(ctx, zoneID, fqdn)
+	if err != nil {
+		return err
+	}
+	for _, set := range existing {
+		if _, ok := records[aws.StringValue(set.Type)]; !ok {
+			changes = append(changes, &route53.Change{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: set})
+		}
+	}
+	return p.change(ctx, zoneID, changes)
+}
+
+func (p *route53Provider) Remove(ctx context.Context, name string) error {
+	zoneID, err := p.hostedZoneID(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := p.recordSets(ctx, zoneID, name+"."+p.zone+".")
+	if err != nil {
+		return err
+	}
+	var changes []*route53.Change
+	for _, set := range existing {
+		changes = append(changes, &route53.Change{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: set})
+	}
+	return p.change(ctx, zoneID, changes)
+}
+
+func (p *route53Provider) change(ctx context.Context, zoneID string, changes []*route53.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	_, err := p.client.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+		ChangeBatch:  &route53.ChangeBatch{Changes: changes},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to change record sets: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package placement spreads the machines of a MachineSet across zones, so the failure of a zone only takes
+// down a share of them.
+package placement
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// FieldAnnotation names the field of the cloudProviderSpec which selects the zone of an instance, e.g.
+	// availabilityZone on AWS, zone on GCE or location on Hetzner. It is set on MachineSets or MachineDeployments.
+	FieldAnnotation = "machine-controller.kubermatic.io/placement-field"
+	// ZonesAnnotation lists the zones the machines of a MachineSet or MachineDeployment are spread across,
+	// separated by commas. Each zone may be followed by a weight, e.g. "eu-central-1a:2,eu-central-1b", which
+	// defaults to 1.
+	ZonesAnnotation = "machine-controller.kubermatic.io/placement-zones"
+	// ZoneAnnotation holds the zone chosen for a machine
+	ZoneAnnotation = "machine-controller.kubermatic.io/placement-zone"
+)
+
+// Placement is the spreading of the machines of a MachineSet
+type Placement struct {
+	// Field is the field of the cloudProviderSpec set to the zone
+	Field string
+	Zones []Zone
+}
+
+// Zone is a zone of a placement
+type Zone struct {
+	Name string
+	// Weight is the share of the machines in the zone, relative to the weights of the other zones
+	Weight int
+}
+
+// Parse returns the placement of the given annotations, which is nil if they don't set one
+func Parse(annotations map[string]string) (*Placement, error) {
+	fieldName, hasField := annotations[FieldAnnotation]
+	zones, hasZones := annotations[ZonesAnnotation]
+	if !hasField && !hasZones {
+		return nil, nil
+	}
+	if fieldName == "" || zones == "" {
+		return nil, fmt.Errorf("%s and %s must be set together", FieldAnnotation, ZonesAnnotation)
+	}
+
+	placement := &Placement{Field: fieldName}
+	seen := map[string]bool{}
+	for _, value := range strings.Split(zones, ",") {
+		zone := Zone{Name: strings.TrimSpace(value), Weight: 1}
+		if i := strings.LastIndex(zone.Name, ":"); i >= 0 {
+			weight, err := strconv.Atoi(zone.Name[i+1:])
+			if err != nil || weight < 1 {
+				return nil, fmt.Errorf("the weight of zone %q must be a positive integer", zone.Name)
+			}
+			zone.Name, zone.Weight = zone.Name[:i], weight
+		}
+		if zone.Name == "" {
+			return nil, fmt.Errorf("%s must not contain empty zones", ZonesAnnotation)
+		}
+		if seen[zone.Name] {
+			return nil, fmt.Errorf("zone %q is listed twice", zone.Name)
+		}
+		seen[zone.Name] = true
+		placement.Zones = append(placement.Zones, zone)
+	}
+	return placement, nil
+}
+
+// Next returns the zone for the next machine, given the number of machines per zone. It is the zone furthest
+// below its share, the first one listed on a tie, so equal weights spread the machines round-robin.
+func (p *Placement) Next(counts map[string]int) string {
+	next := 0
+	for i, zone := range p.Zones {
+		// counts[i]/weight[i] < counts[next]/weight[next]
+		if counts[zone.Name]*p.Zones[next].Weight < counts[p.Zones[next].Name]*zone.Weight {
+			next = i
+		}
+	}
+	return p.Zones[next].Name
+}
+
+// MostOverShare returns the zone with the most machines relative to its share among the zones with machines,
+// which is where a machine should be removed from. Zones which are not listed anymore come first, ties are
+// broken by the name of the zone.
+func (p *Placement) MostOverShare(counts map[string]int) string {
+	weights := map[string]int{}
+	for _, zone := range p.Zones {
+		weights[zone.Name] = zone.Weight
+	}
+	var names []string
+	for name, count := range counts {
+		if count > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	most := ""
+	for _, name := range names {
+		if most == "" || weights[most] > 0 && (weights[name] == 0 || counts[name]*weights[most] > counts[most]*weights[name]) {
+			most = name
+		}
+	}
+	return most
+}
+
+// SetZone sets the field of the cloudProviderSpec in the given provider spec to the zone
+func SetZone(providerSpec *runtime.RawExtension, fieldName, zone string) error {
+	if providerSpec == nil || len(providerSpec.Raw) == 0 {
+		return fmt.Errorf("the provider spec is empty")
+	}
+	config := map[string]json.RawMessage{}
+	if err := json.Unmarshal(providerSpec.Raw, &config); err != nil {
+		return fmt.Errorf("failed to parse provider spec: %v", err)
+	}
+	cloudProviderSpec := map[string]interface{}{}
+	if raw, ok := config["cloudProviderSpec"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &cloudProviderSpec); err != nil {
+			return fmt.Errorf("failed to parse cloudProviderSpec: %v", err)
+		}
+	}
+	cloudProviderSpec[fieldName] = zone
+
+	raw, err := json.Marshal(cloudProviderSpec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cloudProviderSpec: %v", err)
+	}
+	config["cloudProviderSpec"] = raw
+	if providerSpec.Raw, err = json.Marshal(config); err != nil {
+		return fmt.Errorf("failed to marshal provider spec: %v", err)
+	}
+	providerSpec.Object = nil
+	return nil
+}
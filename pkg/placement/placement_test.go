@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    *Placement
+		expectError bool
+	}{
+		{
+			name: "no placement",
+		},
+		{
+			name: "weighted zones",
+			annotations: map[string]string{
+				FieldAnnotation: "availabilityZone",
+				ZonesAnnotation: "eu-central-1a:2, eu-central-1b",
+			},
+			expected: &Placement{Field: "availabilityZone", Zones: []Zone{{Name: "eu-central-1a", Weight: 2}, {Name: "eu-central-1b", Weight: 1}}},
+		},
+		{
+			name:        "zones without field",
+			annotations: map[string]string{ZonesAnnotation: "eu-central-1a"},
+			expectError: true,
+		},
+		{
+			name:        "invalid weight",
+			annotations: map[string]string{FieldAnnotation: "zone", ZonesAnnotation: "a:0"},
+			expectError: true,
+		},
+		{
+			name:        "duplicate zone",
+			annotations: map[string]string{FieldAnnotation: "zone", ZonesAnnotation: "a,b,a"},
+			expectError: true,
+		},
+		{
+			name:        "empty zone",
+			annotations: map[string]string{FieldAnnotation: "zone", ZonesAnnotation: "a,,b"},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			placement, err := Parse(test.annotations)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Expected error: %v, got: %v", test.expectError, err)
+			}
+			if test.expectError {
+				return
+			}
+			if (placement == nil) != (test.expected == nil) {
+				t.Fatalf("Expected placement %+v, got %+v", test.expected, placement)
+			}
+			if placement == nil {
+				return
+			}
+			if placement.Field != test.expected.Field || len(placement.Zones) != len(test.expected.Zones) {
+				t.Fatalf("Expected placement %+v, got %+v", test.expected, placement)
+			}
+			for i := range placement.Zones {
+				if placement.Zones[i] != test.expected.Zones[i] {
+					t.Errorf("Expected zone %+v, got %+v", test.expected.Zones[i], placement.Zones[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	placement := &Placement{Zones: []Zone{{Name: "a", Weight: 2}, {Name: "b", Weight: 1}, {Name: "c", Weight: 1}}}
+	counts := map[string]int{}
+	var chosen []string
+	for i := 0; i < 8; i++ {
+		zone := placement.Next(counts)
+		counts[zone]++
+		chosen = append(chosen, zone)
+	}
+	if counts["a"] != 4 || counts["b"] != 2 || counts["c"] != 2 {
+		t.Errorf("Expected the machines to be spread by the weights of the zones, got %v", chosen)
+	}
+	if chosen[0] != "a" || chosen[1] != "b" || chosen[2] != "c" {
+		t.Errorf("Expected the zones to be filled round-robin, got %v", chosen)
+	}
+}
+
+func TestMostOverShare(t *testing.T) {
+	placement := &Placement{Zones: []Zone{{Name: "a", Weight: 2}, {Name: "b", Weight: 1}}}
+	tests := []struct {
+		counts   map[string]int
+		expected string
+	}{
+		{counts: map[string]int{"a": 2, "b": 1}, expected: "a"},
+		{counts: map[string]int{"a": 2, "b": 2}, expected: "b"},
+		{counts: map[string]int{"a": 4, "b": 1, "gone": 1}, expected: "gone"},
+		{counts: map[string]int{"a": 4, "b": 1, "": 1}, expected: ""},
+		{counts: map[string]int{"a": 0, "b": 1}, expected: "b"},
+	}
+	for _, test := range tests {
+		if zone := placement.MostOverShare(test.counts); zone != test.expected {
+			t.Errorf("Expected zone %q for %v, got %q", test.expected, test.counts, zone)
+		}
+	}
+}
+
+func TestSetZone(t *testing.T) {
+	providerSpec := &runtime.RawExtension{Raw: []byte(`{"cloudProvider":"aws","cloudProviderSpec":{"region":"eu-central-1","availabilityZone":"eu-central-1a"}}`)}
+	if err := SetZone(providerSpec, "availabilityZone", "eu-central-1b"); err != nil {
+		t.Fatalf("failed to set zone: %v", err)
+	}
+	config := struct {
+		CloudProvider     string            `json:"cloudProvider"`
+		CloudProviderSpec map[string]string `json:"cloudProviderSpec"`
+	}{}
+	if err := json.Unmarshal(providerSpec.Raw, &config); err != nil {
+		t.Fatalf("failed to unmarshal provider spec: %v", err)
+	}
+	if config.CloudProvider != "aws" || config.CloudProviderSpec["region"] != "eu-central-1" {
+		t.Errorf("Expected the other fields to be kept, got %+v", config)
+	}
+	if zone := config.CloudProviderSpec["availabilityZone"]; zone != "eu-central-1b" {
+		t.Errorf("Expected zone eu-central-1b, got %q", zone)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/cluster/common"
+	cloudprovidererrors "github.com/kubermatic/machine-controller/pkg/cloudprovider/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+// allowedNamespacesKey of a credential profile lists the namespaces, separated by commas, whose
+// machines may use the profile. Profiles without it may be used in all namespaces.
+const allowedNamespacesKey = "allowedNamespaces"
+
+var credentialProfiles = struct {
+	mu     sync.RWMutex
+	secret types.NamespacedName
+}{}
+
+// SetCredentialProfilesSecret configures the secret with the credential profiles machines select with
+// credentialProfile, passed in namespace/name format. Each key of the secret is the name of a profile, its
+// value a YAML map of the environment variables the cloud providers fall back to, e.g. DO_TOKEN, to their
+// values. Credential profiles are disabled if it is empty.
+func SetCredentialProfilesSecret(namespacedName string) error {
+	secret := types.NamespacedName{}
+	if namespacedName != "" {
+		parts := strings.Split(namespacedName, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("%q is not in namespace/name format", namespacedName)
+		}
+		secret = types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	}
+
+	credentialProfiles.mu.Lock()
+	defer credentialProfiles.mu.Unlock()
+	credentialProfiles.secret = secret
+	return nil
+}
+
+// CredentialProfilesSecret returns the secret configured with SetCredentialProfilesSecret
+func CredentialProfilesSecret() types.NamespacedName {
+	credentialProfiles.mu.RLock()
+	defer credentialProfiles.mu.RUnlock()
+	return credentialProfiles.secret
+}
+
+// ForCredentialProfile returns a resolver which takes the values of config vars that are not set from
+// the given credential profile instead of the environment, so a machine can use other credentials than
+// the machine-controller. Values set in the spec, including references to secrets, still take
+// precedence. The resolver itself is returned for an empty profile.
+//
+// The resolver does not check whether the machine may use the profile, callers knowing the namespace
+// of the machine must do so with ValidateCredentialProfile first.
+func (cvr *ConfigVarResolver) ForCredentialProfile(profile string) *ConfigVarResolver {
+	if profile == "" {
+		return cvr
+	}
+	return &ConfigVarResolver{ctx: cvr.ctx, client: cvr.client, credentialProfile: profile, secrets: cvr.secrets}
+}
+
+// ValidateCredentialProfile returns an error if machines in the given namespace may not use the given
+// credential profile, see allowedNamespacesKey. The error is terminal if the profile is restricted to
+// other namespaces.
+func (cvr *ConfigVarResolver) ValidateCredentialProfile(profile, namespace string) error {
+	if profile == "" {
+		return nil
+	}
+	values, err := cvr.credentialProfileValues(profile)
+	if err != nil {
+		return err
+	}
+	allowedNamespaces, restricted := values[allowedNamespacesKey]
+	if !restricted {
+		return nil
+	}
+	for _, allowedNamespace := range strings.Split(allowedNamespaces, ",") {
+		if strings.TrimSpace(allowedNamespace) == namespace {
+			return nil
+		}
+	}
+	return cloudprovidererrors.TerminalError{
+		Reason:  common.InvalidConfigurationMachineError,
+		Message: fmt.Sprintf("credential profile '%s' may not be used in namespace '%s'", profile, namespace),
+	}
+}
+
+// credentialProfileValue returns the value of the given environment variable in the credential profile
+// of the resolver. The profile is read on every call, so changed credentials are used right away.
+func (cvr *ConfigVarResolver) credentialProfileValue(envVarName string) (string, bool, error) {
+	values, err := cvr.credentialProfileValues(cvr.credentialProfile)
+	if err != nil {
+		return "", false, err
+	}
+	if envVarName == allowedNamespacesKey {
+		return "", false, nil
+	}
+	value, found := values[envVarName]
+	return value, found, nil
+}
+
+// credentialProfileValues reads the given credential profile from the credential profiles secret
+func (cvr *ConfigVarResolver) credentialProfileValues(profile string) (map[string]string, error) {
+	secretName := CredentialProfilesSecret()
+	if secretName.Name == "" {
+		return nil, fmt.Errorf("credential profile '%s' can't be used, the machine-controller has no -credential-profiles-secret", profile)
+	}
+	secret := &corev1.Secret{}
+	if err := cvr.client.Get(cvr.ctx, secretName, secret); err != nil {
+		return nil, fmt.Errorf("error retrieving secret '%s' from namespace '%s': '%v'", secretName.Name, secretName.Namespace, err)
+	}
+	raw, ok := secret.Data[profile]
+	if !ok {
+		return nil, fmt.Errorf("secret '%s' in namespace '%s' has no credential profile '%s'", secretName.Name, secretName.Namespace, profile)
+	}
+	// The values are credentials, so they must not end up in the error
+	values := map[string]string{}
+	if err := kyaml.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("credential profile '%s' must be a YAML map of strings", profile)
+	}
+	return values, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCredentialProfiles(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "credential-profiles"},
+		Data: map[string][]byte{
+			"team-a":  []byte("DO_TOKEN: team-a-token\nVSPHERE_ALLOW_INSECURE: \"true\"\n"),
+			"invalid": []byte("- not a map"),
+			"team-c":  []byte("allowedNamespaces: team-c, team-d\nDO_TOKEN: team-c-token\n"),
+		},
+	}
+	resolver := NewConfigVarResolver(context.Background(), ctrlruntimefake.NewFakeClient(secret))
+	os.Setenv("DO_TOKEN", "env-token")
+	defer os.Unsetenv("DO_TOKEN")
+
+	if err := SetCredentialProfilesSecret(""); err != nil {
+		t.Fatalf("failed to disable credential profiles: %v", err)
+	}
+	if _, err := resolver.ForCredentialProfile("team-a").GetConfigVarStringValueOrEnv(providerconfigtypes.ConfigVarString{}, "DO_TOKEN"); err == nil {
+		t.Errorf("expected an error for a credential profile without -credential-profiles-secret")
+	}
+
+	if err := SetCredentialProfilesSecret("credential-profiles"); err == nil {
+		t.Errorf("expected an error for a secret name without namespace")
+	}
+	if err := SetCredentialProfilesSecret("kube-system/credential-profiles"); err != nil {
+		t.Fatalf("failed to set the credential profiles secret: %v", err)
+	}
+	defer func() { _ = SetCredentialProfilesSecret("") }()
+
+	value, err := resolver.ForCredentialProfile("").GetConfigVarStringValueOrEnv(providerconfigtypes.ConfigVarString{}, "DO_TOKEN")
+	if err != nil || value != "env-token" {
+		t.Errorf("expected the environment variable without profile, got %q, %v", value, err)
+	}
+	value, err = resolver.ForCredentialProfile("team-a").GetConfigVarStringValueOrEnv(providerconfigtypes.ConfigVarString{}, "DO_TOKEN")
+	if err != nil || value != "team-a-token" {
+		t.Errorf("expected the token of the profile, got %q, %v", value, err)
+	}
+	value, err = resolver.ForCredentialProfile("team-a").GetConfigVarStringValueOrEnv(providerconfigtypes.ConfigVarString{Value: "inline-token"}, "DO_TOKEN")
+	if err != nil || value != "inline-token" {
+		t.Errorf("expected the inline token to take precedence over the profile, got %q, %v", value, err)
+	}
+	value, err = resolver.ForCredentialProfile("team-a").GetConfigVarStringValueOrEnv(providerconfigtypes.ConfigVarString{}, "HZ_TOKEN")
+	if err != nil || value != "" {
+		t.Errorf("expected no value for a variable missing in the profile, got %q, %v", value, err)
+	}
+	allowInsecure, err := resolver.ForCredentialProfile("team-a").GetConfigVarBoolValueOrEnv(providerconfigtypes.ConfigVarBool{}, "VSPHERE_ALLOW_INSECURE")
+	if err != nil || !allowInsecure {
+		t.Errorf("expected the bool of the profile, got %v, %v", allowInsecure, err)
+	}
+	for _, profile := range []string{"team-b", "invalid"} {
+		if _, err := resolver.ForCredentialProfile(profile).GetConfigVarStringValueOrEnv(providerconfigtypes.ConfigVarString{}, "DO_TOKEN"); err == nil {
+			t.Errorf("expected an error for credential profile %q", profile)
+		}
+	}
+
+	if err := resolver.ValidateCredentialProfile("team-a", "default"); err != nil {
+		t.Errorf("expected a profile without allowedNamespaces to be allowed in all namespaces, got %v", err)
+	}
+	for _, namespace := range []string{"team-c", "team-d"} {
+		if err := resolver.ValidateCredentialProfile("team-c", namespace); err != nil {
+			t.Errorf("expected profile team-c to be allowed in namespace %q, got %v", namespace, err)
+		}
+	}
+	if err := resolver.ValidateCredentialProfile("team-c", "team-a"); err == nil {
+		t.Errorf("expected profile team-c not to be allowed in namespace team-a")
+	}
+	if err := resolver.ValidateCredentialProfile("team-b", "team-b"); err == nil {
+		t.Errorf("expected an error for a missing credential profile")
+	}
+	value, err = resolver.ForCredentialProfile("team-c").GetConfigVarStringValueOrEnv(providerconfigtypes.ConfigVarString{}, "allowedNamespaces")
+	if err != nil || value != "" {
+		t.Errorf("expected allowedNamespaces not to be a value of the profile, got %q, %v", value, err)
+	}
+
+	spec := &runtime.RawExtension{Raw: []byte(`{"cloudProvider":"digitalocean","credentialProfile":"team-a"}`)}
+	if !ReferencesSecret(spec, "kube-system", "credential-profiles") {
+		t.Errorf("expected a spec with a credential profile to reference the credential profiles secret")
+	}
+	spec = &runtime.RawExtension{Raw: []byte(`{"cloudProvider":"digitalocean"}`)}
+	if ReferencesSecret(spec, "kube-system", "credential-profiles") {
+		t.Errorf("expected a spec without credential profile not to reference the credential profiles secret")
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+// MachineDefaults are applied to the specs of machines before they get defaulted and
+// validated by their cloud provider, so machine manifests only need to contain what
+// differs from them.
+type MachineDefaults struct {
+	// KubeletVersion is used for machines without a kubelet version.
+	KubeletVersion string `json:"kubeletVersion,omitempty"`
+	// ProviderSpecs are the provider spec defaults by cloud provider. Fields set in the
+	// machine take precedence, objects are merged.
+	ProviderSpecs map[string]map[string]interface{} `json:"providerSpecs,omitempty"`
+	// CostCenterLabels are the keys of the labels of the spec, e.g. cost-center, which are added to the tags
+	// of the instances for chargeback. Tags set in the provider spec take precedence.
+	CostCenterLabels []string `json:"costCenterLabels,omitempty"`
+}
+
+// costCenterTagFields are the fields of the cloud provider specs which hold key-value tags of the instances,
+// the tags of the other providers are plain values
+var costCenterTagFields = map[string]string{
+	"alibaba":   "labels",
+	"aws":       "tags",
+	"azure":     "tags",
+	"gce":       "labels",
+	"hetzner":   "labels",
+	"openstack": "tags",
+}
+
+// LoadMachineDefaults reads the MachineDefaults from the given YAML file.
+func LoadMachineDefaults(path string) (*MachineDefaults, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	defaults := &MachineDefaults{}
+	if err := kyaml.UnmarshalStrict(content, defaults); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return defaults, nil
+}
+
+// Apply sets the kubelet version and the provider spec defaults of the given spec where they are missing.
+func (d *MachineDefaults) Apply(spec *clusterv1alpha1.MachineSpec) error {
+	if d == nil {
+		return nil
+	}
+	if spec.Versions.Kubelet == "" {
+		spec.Versions.Kubelet = d.KubeletVersion
+	}
+	if (len(d.ProviderSpecs) == 0 && len(d.CostCenterLabels) == 0) || spec.ProviderSpec.Value == nil {
+		return nil
+	}
+
+	providerSpec := map[string]interface{}{}
+	if err := json.Unmarshal(spec.ProviderSpec.Value.Raw, &providerSpec); err != nil {
+		return fmt.Errorf("failed to unmarshal machine.spec.providerSpec: %v", err)
+	}
+	cloudProvider, _ := providerSpec["cloudProvider"].(string)
+	var changed bool
+	if defaults, ok := d.ProviderSpecs[cloudProvider]; ok {
+		changed = MergeDefaults(providerSpec, defaults)
+	}
+	if tags := d.costCenterTags(cloudProvider, spec.Labels); tags != nil && MergeDefaults(providerSpec, tags) {
+		changed = true
+	}
+	// The spec is kept as is if nothing is missing, so unchanged machines are not updated
+	if !changed {
+		return nil
+	}
+
+	raw, err := json.Marshal(providerSpec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal machine.spec.providerSpec: %v", err)
+	}
+	spec.ProviderSpec.Value = &runtime.RawExtension{Raw: raw}
+	return nil
+}
+
+// costCenterTags returns the cost center labels of the spec as defaults of the tags of the cloud provider
+// spec, or nil if there are none or the cloud provider has no key-value tags
+func (d *MachineDefaults) costCenterTags(cloudProvider string, labels map[string]string) map[string]interface{} {
+	field, ok := costCenterTagFields[cloudProvider]
+	if !ok {
+		return nil
+	}
+	tags := map[string]interface{}{}
+	for _, key := range d.CostCenterLabels {
+		if value, ok := labels[key]; ok {
+			tags[key] = value
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"cloudProviderSpec": map[string]interface{}{field: tags}}
+}
+
+// MergeDefaults sets the fields of values which are missing or null to the ones of defaults,
+// recursing into objects present in both. It returns whether any field was set.
+func MergeDefaults(values, defaults map[string]interface{}) bool {
+	var changed bool
+	for key, defaultValue := range defaults {
+		value, ok := values[key]
+		if !ok || value == nil {
+			values[key] = defaultValue
+			changed = true
+			continue
+		}
+		valueObject, isObject := value.(map[string]interface{})
+		defaultObject, defaultIsObject := defaultValue.(map[string]interface{})
+		if isObject && defaultIsObject && MergeDefaults(valueObject, defaultObject) {
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestApplyMachineDefaults(t *testing.T) {
+	defaults := &MachineDefaults{
+		KubeletVersion: "1.17.3",
+		ProviderSpecs: map[string]map[string]interface{}{
+			"hetzner": {
+				"sshPublicKeys": []interface{}{"ssh-rsa AAAA"},
+				"cloudProviderSpec": map[string]interface{}{
+					"location":   "fsn1",
+					"serverType": "cx21",
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name                 string
+		defaults             *MachineDefaults
+		kubeletVersion       string
+		labels               map[string]string
+		providerSpec         string
+		expectedKubelet      string
+		expectedProviderSpec string
+	}{
+		{
+			name:                 "no defaults",
+			providerSpec:         `{"cloudProvider":"hetzner"}`,
+			expectedProviderSpec: `{"cloudProvider":"hetzner"}`,
+		},
+		{
+			name:                 "minimal machine",
+			defaults:             defaults,
+			providerSpec:         `{"cloudProvider":"hetzner"}`,
+			expectedKubelet:      "1.17.3",
+			expectedProviderSpec: `{"cloudProvider":"hetzner","sshPublicKeys":["ssh-rsa AAAA"],"cloudProviderSpec":{"location":"fsn1","serverType":"cx21"}}`,
+		},
+		{
+			name:                 "machine values take precedence",
+			defaults:             defaults,
+			kubeletVersion:       "1.18.0",
+			providerSpec:         `{"cloudProvider":"hetzner","sshPublicKeys":[],"cloudProviderSpec":{"serverType":"cx31","token":{"secretKeyRef":{"name":"hetzner"}}}}`,
+			expectedKubelet:      "1.18.0",
+			expectedProviderSpec: `{"cloudProvider":"hetzner","sshPublicKeys":[],"cloudProviderSpec":{"location":"fsn1","serverType":"cx31","token":{"secretKeyRef":{"name":"hetzner"}}}}`,
+		},
+		{
+			name:                 "other cloud provider",
+			defaults:             defaults,
+			providerSpec:         `{"cloudProvider":"aws"}`,
+			expectedKubelet:      "1.17.3",
+			expectedProviderSpec: `{"cloudProvider":"aws"}`,
+		},
+		{
+			name:                 "cost center labels",
+			defaults:             &MachineDefaults{CostCenterLabels: []string{"cost-center", "team"}},
+			labels:               map[string]string{"cost-center": "4711", "team": "payments", "tier": "web"},
+			providerSpec:         `{"cloudProvider":"aws","cloudProviderSpec":{"tags":{"team":"checkout"}}}`,
+			expectedProviderSpec: `{"cloudProvider":"aws","cloudProviderSpec":{"tags":{"cost-center":"4711","team":"checkout"}}}`,
+		},
+		{
+			name:                 "cost center labels of a cloud provider without key-value tags",
+			defaults:             &MachineDefaults{CostCenterLabels: []string{"cost-center"}},
+			labels:               map[string]string{"cost-center": "4711"},
+			providerSpec:         `{"cloudProvider":"digitalocean"}`,
+			expectedProviderSpec: `{"cloudProvider":"digitalocean"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := &clusterv1alpha1.MachineSpec{}
+			spec.Labels = test.labels
+			spec.Versions.Kubelet = test.kubeletVersion
+			spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(test.providerSpec)}
+
+			if err := test.defaults.Apply(spec); err != nil {
+				t.Fatalf("failed to apply defaults: %v", err)
+			}
+
+			if spec.Versions.Kubelet != test.expectedKubelet {
+				t.Errorf("Expected kubelet version %q, but got %q", test.expectedKubelet, spec.Versions.Kubelet)
+			}
+			var providerSpec, expectedProviderSpec map[string]interface{}
+			if err := json.Unmarshal(spec.ProviderSpec.Value.Raw, &providerSpec); err != nil {
+				t.Fatalf("failed to unmarshal provider spec: %v", err)
+			}
+			if err := json.Unmarshal([]byte(test.expectedProviderSpec), &expectedProviderSpec); err != nil {
+				t.Fatalf("failed to unmarshal expected provider spec: %v", err)
+			}
+			if !reflect.DeepEqual(providerSpec, expectedProviderSpec) {
+				t.Errorf("Expected provider spec %s, but got %s", test.expectedProviderSpec, spec.ProviderSpec.Value.Raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+)
+
+// MachineClassSpecAnnotation holds the provider spec of the MachineClass which was last merged into
+// the spec of a machine, or of the template of a MachineSet or MachineDeployment. It is set on the
+// metadata next to that spec, so the fields taken from the class can be told apart from the ones of
+// the object once the class changes.
+const MachineClassSpecAnnotation = "machine-controller.kubermatic.io/machine-class-spec"
+
+// MachineClassSpec returns the provider spec of the given MachineClass as stored in the
+// MachineClassSpecAnnotation.
+func MachineClassSpec(machineClass *clusterv1alpha1.MachineClass) (string, error) {
+	classSpec := map[string]interface{}{}
+	if err := json.Unmarshal(machineClass.ProviderSpec.Raw, &classSpec); err != nil {
+		return "", fmt.Errorf("failed to unmarshal the providerSpec of machine class %q: %v", machineClass.Name, err)
+	}
+	// Marshalling sorts the keys, so equal specs always result in the same annotation
+	raw, err := json.Marshal(classSpec)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal the providerSpec of machine class %q: %v", machineClass.Name, err)
+	}
+	return string(raw), nil
+}
+
+// StripDefaults removes the fields of values which are equal to the ones of defaults, recursing
+// into objects present in both. Objects left empty are removed as well. It reverts MergeDefaults
+// for all fields which weren't changed since.
+func StripDefaults(values, defaults map[string]interface{}) {
+	for key, defaultValue := range defaults {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		valueObject, isObject := value.(map[string]interface{})
+		defaultObject, defaultIsObject := defaultValue.(map[string]interface{})
+		if isObject && defaultIsObject {
+			StripDefaults(valueObject, defaultObject)
+			if len(valueObject) == 0 {
+				delete(values, key)
+			}
+			continue
+		}
+		if reflect.DeepEqual(value, defaultValue) {
+			delete(values, key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestMachineClassSpec(t *testing.T) {
+	machineClass := &clusterv1alpha1.MachineClass{
+		ObjectMeta:   metav1.ObjectMeta{Name: "hetzner-cx21"},
+		ProviderSpec: runtime.RawExtension{Raw: []byte(`{ "operatingSystem": "ubuntu", "cloudProvider": "hetzner" }`)},
+	}
+	classSpec, err := MachineClassSpec(machineClass)
+	if err != nil {
+		t.Fatalf("failed to get machine class spec: %v", err)
+	}
+	if expected := `{"cloudProvider":"hetzner","operatingSystem":"ubuntu"}`; classSpec != expected {
+		t.Errorf("Expected machine class spec %s, but got %s", expected, classSpec)
+	}
+}
+
+func TestStripDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   string
+		defaults string
+		expected string
+	}{
+		{
+			name:     "fields equal to the defaults are removed",
+			values:   `{"cloudProvider":"hetzner","operatingSystem":"ubuntu"}`,
+			defaults: `{"cloudProvider":"hetzner","operatingSystem":"ubuntu"}`,
+			expected: `{}`,
+		},
+		{
+			name:     "changed fields are kept",
+			values:   `{"cloudProvider":"hetzner","operatingSystem":"flatcar","sshPublicKeys":["ssh-rsa AAAA"]}`,
+			defaults: `{"cloudProvider":"hetzner","operatingSystem":"ubuntu"}`,
+			expected: `{"operatingSystem":"flatcar","sshPublicKeys":["ssh-rsa AAAA"]}`,
+		},
+		{
+			name:     "objects are merged",
+			values:   `{"cloudProviderSpec":{"location":"nbg1","serverType":"cx21"},"operatingSystemSpec":{"distUpgradeOnBoot":false}}`,
+			defaults: `{"cloudProviderSpec":{"location":"fsn1","serverType":"cx21"},"operatingSystemSpec":{"distUpgradeOnBoot":false}}`,
+			expected: `{"cloudProviderSpec":{"location":"nbg1"}}`,
+		},
+		{
+			name:     "lists are compared as a whole",
+			values:   `{"sshPublicKeys":["ssh-rsa AAAA","ssh-rsa BBBB"]}`,
+			defaults: `{"sshPublicKeys":["ssh-rsa AAAA"]}`,
+			expected: `{"sshPublicKeys":["ssh-rsa AAAA","ssh-rsa BBBB"]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var values, defaults, expected map[string]interface{}
+			if err := json.Unmarshal([]byte(test.values), &values); err != nil {
+				t.Fatalf("failed to unmarshal values: %v", err)
+			}
+			if err := json.Unmarshal([]byte(test.defaults), &defaults); err != nil {
+				t.Fatalf("failed to unmarshal defaults: %v", err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+				t.Fatalf("failed to unmarshal expected values: %v", err)
+			}
+
+			StripDefaults(values, defaults)
+
+			if !reflect.DeepEqual(values, expected) {
+				t.Errorf("Expected %s, but got %v", test.expected, values)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Redacted replaces sensitive values in logs, events and the status of machines
+const Redacted = "<redacted>"
+
+// sensitiveFieldNames are parts of the lower case names of fields holding credentials, e.g. token,
+// clientSecret or secretAccessKey. It is the only list of them, the webhook uses it through
+// IsCredentialField as well.
+var sensitiveFieldNames = []string{"token", "password", "secret", "apikey", "accesskey", "privatekey", "kubeconfig", "serviceaccount", "credentials"}
+
+// isSensitiveField returns whether the field with the given name of an object holds credentials, given
+// whether the object itself does. References like secretKeyRef only name where the credentials are, so
+// they are not sensitive.
+func isSensitiveField(objectSensitive bool, name string) bool {
+	name = strings.ToLower(name)
+	if strings.HasSuffix(name, "ref") {
+		return false
+	}
+	if objectSensitive {
+		return true
+	}
+	for _, sensitive := range sensitiveFieldNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCredentialField returns whether the field of a cloudProviderSpec with the given name holds credentials
+func IsCredentialField(name string) bool {
+	return isSensitiveField(false, name)
+}
+
+// RedactJSON returns the given JSON document with the values of fields holding credentials replaced,
+// e.g. the token of a cloudProviderSpec. Only inline values are replaced, references to secrets are
+// kept. Documents which can't be parsed are replaced entirely, as it is unknown what they contain.
+func RedactJSON(raw []byte) []byte {
+	var document interface{}
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return []byte(fmt.Sprintf("%q", Redacted))
+	}
+	redacted, err := json.Marshal(redactValue(document, false))
+	if err != nil {
+		return []byte(fmt.Sprintf("%q", Redacted))
+	}
+	return redacted
+}
+
+func redactValue(value interface{}, sensitive bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, fieldValue := range v {
+			v[name] = redactValue(fieldValue, isSensitiveField(sensitive, name))
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i], sensitive)
+		}
+		return v
+	case nil:
+		return nil
+	default:
+		if sensitive {
+			return Redacted
+		}
+		return v
+	}
+}
+
+// RedactMessage replaces the inline credentials of the given provider spec and the given secrets in a
+// message, e.g. an error of a cloud provider, before it is logged or stored in an event or the status of
+// a machine. The secrets are the credentials resolved for the machine, see
+// ConfigVarResolver.ResolvedSecrets.
+func RedactMessage(message string, providerSpec *runtime.RawExtension, secrets ...string) string {
+	var values []string
+	if providerSpec != nil && len(providerSpec.Raw) > 0 {
+		var document interface{}
+		if err := json.Unmarshal(providerSpec.Raw, &document); err == nil {
+			collectSensitiveValues(document, false, &values)
+		}
+	}
+	for _, secret := range secrets {
+		if isRedactable(secret) {
+			values = append(values, secret)
+		}
+	}
+	// Longer values first, so values containing others get replaced as a whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, value := range values {
+		message = strings.ReplaceAll(message, value, Redacted)
+	}
+	return message
+}
+
+// isRedactable returns whether the given credentials are replaced in messages. Short values like "true"
+// would redact unrelated parts of them.
+func isRedactable(value string) bool {
+	return len(value) >= 6
+}
+
+func collectSensitiveValues(value interface{}, sensitive bool, values *[]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, fieldValue := range v {
+			collectSensitiveValues(fieldValue, isSensitiveField(sensitive, name), values)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectSensitiveValues(item, sensitive, values)
+		}
+	case string:
+		if sensitive && isRedactable(v) {
+			*values = append(*values, v)
+		}
+	}
+}
+
+// resolvedSecrets are the credentials resolved by a ConfigVarResolver. They are shared by the resolvers
+// of a machine, which may be used concurrently by a cloud provider.
+type resolvedSecrets struct {
+	mu     sync.Mutex
+	values []string
+}
+
+func (r *resolvedSecrets) add(value string) {
+	if r == nil || !isRedactable(value) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.values {
+		if existing == value {
+			return
+		}
+	}
+	r.values = append(r.values, value)
+}
+
+func (r *resolvedSecrets) list() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.values...)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const redactTestSpec = `{
+  "cloudProvider": "aws",
+  "cloudProviderSpec": {
+    "accessKeyId": "AKIAEXAMPLEKEY",
+    "secretAccessKey": {"secretKeyRef": {"namespace": "kube-system", "name": "aws", "key": "secretAccessKey"}},
+    "region": "eu-central-1"
+  },
+  "registryCredentials": {"docker.io": {"username": "deploy-bot", "password": {"value": "registry-password"}}}
+}`
+
+func TestRedactJSON(t *testing.T) {
+	expected := `{
+  "cloudProvider": "aws",
+  "cloudProviderSpec": {
+    "accessKeyId": "<redacted>",
+    "secretAccessKey": {"secretKeyRef": {"namespace": "kube-system", "name": "aws", "key": "secretAccessKey"}},
+    "region": "eu-central-1"
+  },
+  "registryCredentials": {"docker.io": {"username": "<redacted>", "password": {"value": "<redacted>"}}}
+}`
+
+	var redacted, expectedValue interface{}
+	if err := json.Unmarshal(RedactJSON([]byte(redactTestSpec)), &redacted); err != nil {
+		t.Fatalf("failed to unmarshal the redacted spec: %v", err)
+	}
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Fatalf("failed to unmarshal the expected spec: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(redacted, expectedValue) {
+		t.Errorf("expected %v, got %v", expectedValue, redacted)
+	}
+
+	if redacted := string(RedactJSON([]byte(`{"token": "abc`))); redacted != `"<redacted>"` {
+		t.Errorf("expected an invalid document to be redacted entirely, got %s", redacted)
+	}
+}
+
+func TestRedactMessage(t *testing.T) {
+	providerSpec := &runtime.RawExtension{Raw: []byte(redactTestSpec)}
+	message := RedactMessage("failed to create instance in eu-central-1 with key AKIAEXAMPLEKEY: unauthorized", providerSpec)
+	if expected := "failed to create instance in eu-central-1 with key <redacted>: unauthorized"; message != expected {
+		t.Errorf("expected %q, got %q", expected, message)
+	}
+	if message := RedactMessage("invalid token AKIAEXAMPLEKEY", nil); message != "invalid token AKIAEXAMPLEKEY" {
+		t.Errorf("expected the message to be kept without provider spec, got %q", message)
+	}
+
+	message = RedactMessage("invalid secret access key resolved-secret for AKIAEXAMPLEKEY, retry: true", providerSpec, "resolved-secret", "true")
+	if expected := "invalid secret access key <redacted> for <redacted>, retry: true"; message != expected {
+		t.Errorf("expected resolved secrets to be redacted, got %q", message)
+	}
+}
@@ -18,13 +18,16 @@ package providerconfig
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -32,6 +35,10 @@ import (
 type ConfigVarResolver struct {
 	ctx    context.Context
 	client ctrlruntimeclient.Client
+	// credentialProfile replaces the environment as fallback, see ForCredentialProfile
+	credentialProfile string
+	// secrets are the credentials resolved so far, see ResolvedSecrets
+	secrets *resolvedSecrets
 }
 
 func (cvr *ConfigVarResolver) GetConfigVarStringValue(configVar providerconfigtypes.ConfigVarString) (string, error) {
@@ -43,6 +50,7 @@ func (cvr *ConfigVarResolver) GetConfigVarStringValue(configVar providerconfigty
 			return "", fmt.Errorf("error retrieving secret '%s' from namespace '%s': '%v'", configVar.SecretKeyRef.Name, configVar.SecretKeyRef.Namespace, err)
 		}
 		if val, ok := secret.Data[configVar.SecretKeyRef.Key]; ok {
+			cvr.secrets.add(string(val))
 			return string(val), nil
 		}
 		return "", fmt.Errorf("secret '%s' in namespace '%s' has no key '%s'", configVar.SecretKeyRef.Name, configVar.SecretKeyRef.Namespace, configVar.SecretKeyRef.Key)
@@ -61,23 +69,66 @@ func (cvr *ConfigVarResolver) GetConfigVarStringValue(configVar providerconfigty
 		return "", fmt.Errorf("configmap '%s' in namespace '%s' has no key '%s'", configVar.ConfigMapKeyRef.Name, configVar.ConfigMapKeyRef.Namespace, configVar.ConfigMapKeyRef.Key)
 	}
 
+	// We need the path and the key to read a secret from vault
+	if configVar.VaultKeyRef.Path != "" && configVar.VaultKeyRef.Key != "" {
+		val, err := vault.read(cvr.ctx, configVar.VaultKeyRef)
+		if err != nil {
+			return "", fmt.Errorf("error retrieving key '%s' of vault secret '%s': '%v'", configVar.VaultKeyRef.Key, configVar.VaultKeyRef.Path, err)
+		}
+		cvr.secrets.add(val)
+		return val, nil
+	}
+
 	return configVar.Value, nil
 }
 
-// GetConfigVarStringValueOrEnv tries to get the value from ConfigVarString, when it fails, it falls back to
-// getting the value from an environment variable specified by envVarName parameter
+// GetConfigVarStringValueOrEnv gets the value from ConfigVarString, falling back to the environment variable
+// specified by envVarName if it is empty. Errors of a referenced secret or configmap are returned, so missing
+// credentials are not silently taken from the environment. With a credential profile, the variable is taken
+// from the profile instead of the environment.
 func (cvr *ConfigVarResolver) GetConfigVarStringValueOrEnv(configVar providerconfigtypes.ConfigVarString, envVarName string) (string, error) {
 	cfgVar, err := cvr.GetConfigVarStringValue(configVar)
-	if err == nil && len(cfgVar) > 0 {
-		return cfgVar, err
+	if err != nil {
+		return "", err
+	}
+	if len(cfgVar) > 0 {
+		return cfgVar, nil
 	}
 
+	if cvr.credentialProfile != "" {
+		profileVal, _, err := cvr.credentialProfileValue(envVarName)
+		if err != nil {
+			return "", err
+		}
+		cvr.addSecretFromEnv(envVarName, profileVal)
+		return profileVal, nil
+	}
 	envVal, _ := os.LookupEnv(envVarName)
+	cvr.addSecretFromEnv(envVarName, envVal)
 	return envVal, nil
 }
 
+// addSecretFromEnv records the value of the given environment variable or credential profile entry if its
+// name marks it as credentials, e.g. AWS_SECRET_ACCESS_KEY but not AWS_REGION
+func (cvr *ConfigVarResolver) addSecretFromEnv(envVarName, value string) {
+	if IsCredentialField(strings.ReplaceAll(envVarName, "_", "")) {
+		cvr.secrets.add(value)
+	}
+}
+
+// ResolvedSecrets returns the credentials the resolver took from secrets, vault, a credential profile or
+// the environment so far, so they can be redacted from messages, see RedactMessage. Resolvers returned by
+// ForCredentialProfile share them with the resolver they were created from.
+func (cvr *ConfigVarResolver) ResolvedSecrets() []string {
+	return cvr.secrets.list()
+}
+
 func (cvr *ConfigVarResolver) GetConfigVarBoolValue(configVar providerconfigtypes.ConfigVarBool) (bool, error) {
-	cvs := providerconfigtypes.ConfigVarString{Value: strconv.FormatBool(configVar.Value), SecretKeyRef: configVar.SecretKeyRef}
+	cvs := providerconfigtypes.ConfigVarString{
+		Value:           strconv.FormatBool(configVar.Value),
+		SecretKeyRef:    configVar.SecretKeyRef,
+		ConfigMapKeyRef: configVar.ConfigMapKeyRef,
+	}
 	stringVal, err := cvr.GetConfigVarStringValue(cvs)
 	if err != nil {
 		return false, err
@@ -89,29 +140,81 @@ func (cvr *ConfigVarResolver) GetConfigVarBoolValue(configVar providerconfigtype
 	return boolVal, nil
 }
 
+// GetConfigVarBoolValueOrEnv gets the value from ConfigVarBool, falling back to the environment variable
+// specified by envVarName if neither the value is true nor a secret or configmap is referenced. It is false
+// if the environment variable is not set either. With a credential profile, the variable is taken from the
+// profile instead of the environment.
 func (cvr *ConfigVarResolver) GetConfigVarBoolValueOrEnv(configVar providerconfigtypes.ConfigVarBool, envVarName string) (bool, error) {
-	cvs := providerconfigtypes.ConfigVarString{Value: strconv.FormatBool(configVar.Value), SecretKeyRef: configVar.SecretKeyRef}
-	stringVal, err := cvr.GetConfigVarStringValue(cvs)
-	if err != nil {
-		return false, err
+	if configVar.Value || configVar.SecretKeyRef.Name != "" || configVar.ConfigMapKeyRef.Name != "" {
+		return cvr.GetConfigVarBoolValue(configVar)
 	}
-	if stringVal == "" {
-		envVal, envValFound := os.LookupEnv(envVarName)
-		if !envValFound {
-			return false, fmt.Errorf("all mechanisms(value, secret, configMap) of getting the value failed, including reading from environment variable = %s which was not set", envVarName)
+
+	if cvr.credentialProfile != "" {
+		profileVal, profileValFound, err := cvr.credentialProfileValue(envVarName)
+		if err != nil || !profileValFound {
+			return false, err
 		}
-		stringVal = envVal
+		boolVal, err := strconv.ParseBool(profileVal)
+		if err != nil {
+			return false, fmt.Errorf("invalid value %q of %s in credential profile '%s': %v", profileVal, envVarName, cvr.credentialProfile, err)
+		}
+		return boolVal, nil
 	}
-	boolVal, err := strconv.ParseBool(stringVal)
+
+	envVal, envValFound := os.LookupEnv(envVarName)
+	if !envValFound {
+		return false, nil
+	}
+	boolVal, err := strconv.ParseBool(envVal)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("invalid value %q of environment variable %s: %v", envVal, envVarName, err)
 	}
 	return boolVal, nil
 }
 
+// ReferencesSecret returns whether the given provider spec references the given secret with a
+// secretKeyRef anywhere, or uses a credential profile of it.
+func ReferencesSecret(providerSpec *runtime.RawExtension, namespace, name string) bool {
+	if providerSpec == nil || len(providerSpec.Raw) == 0 {
+		return false
+	}
+	var value interface{}
+	if err := json.Unmarshal(providerSpec.Raw, &value); err != nil {
+		return false
+	}
+	if config, ok := value.(map[string]interface{}); ok && config["credentialProfile"] != nil && config["credentialProfile"] != "" {
+		if profilesSecret := CredentialProfilesSecret(); profilesSecret.Namespace == namespace && profilesSecret.Name == name {
+			return true
+		}
+	}
+	return referencesSecret(value, namespace, name)
+}
+
+func referencesSecret(value interface{}, namespace, name string) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["secretKeyRef"].(map[string]interface{}); ok && ref["namespace"] == namespace && ref["name"] == name {
+			return true
+		}
+		for _, nested := range v {
+			if referencesSecret(nested, namespace, name) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, nested := range v {
+			if referencesSecret(nested, namespace, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func NewConfigVarResolver(ctx context.Context, client ctrlruntimeclient.Client) *ConfigVarResolver {
 	return &ConfigVarResolver{
-		ctx:    ctx,
-		client: client,
+		ctx:     ctx,
+		client:  client,
+		secrets: &resolvedSecrets{},
 	}
 }
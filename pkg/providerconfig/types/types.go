@@ -27,18 +27,58 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 // OperatingSystem defines the host operating system.
 type OperatingSystem string
 
 const (
-	OperatingSystemCoreos  OperatingSystem = "coreos"
-	OperatingSystemUbuntu  OperatingSystem = "ubuntu"
-	OperatingSystemCentOS  OperatingSystem = "centos"
-	OperatingSystemSLES    OperatingSystem = "sles"
-	OperatingSystemRHEL    OperatingSystem = "rhel"
-	OperatingSystemFlatcar OperatingSystem = "flatcar"
+	OperatingSystemCoreos          OperatingSystem = "coreos"
+	OperatingSystemUbuntu          OperatingSystem = "ubuntu"
+	OperatingSystemCentOS          OperatingSystem = "centos"
+	OperatingSystemSLES            OperatingSystem = "sles"
+	OperatingSystemRHEL            OperatingSystem = "rhel"
+	OperatingSystemFlatcar         OperatingSystem = "flatcar"
+	OperatingSystemRockyLinux      OperatingSystem = "rockylinux"
+	OperatingSystemAlmaLinux       OperatingSystem = "almalinux"
+	OperatingSystemAmazonLinux2023 OperatingSystem = "amzn2023"
+	OperatingSystemFedoraCoreOS    OperatingSystem = "fcos"
+	OperatingSystemOpenSUSE        OperatingSystem = "opensuse"
+	// OperatingSystemWindows is experimental.
+	OperatingSystemWindows OperatingSystem = "windows"
+)
+
+// BootstrapFlavor defines how a node joins the cluster.
+type BootstrapFlavor string
+
+const (
+	// BootstrapFlavorKubeadm nodes run a kubelet joining with a bootstrap kubeconfig.
+	BootstrapFlavorKubeadm BootstrapFlavor = "kubeadm"
+	// BootstrapFlavorK0s nodes run a k0s worker.
+	BootstrapFlavorK0s BootstrapFlavor = "k0s"
+)
+
+// NodeRole defines which k0s components run on a node.
+type NodeRole string
+
+const (
+	// NodeRoleWorker nodes run a k0s worker.
+	NodeRoleWorker NodeRole = "worker"
+	// NodeRoleController nodes run a k0s controller, including an etcd member,
+	// and a worker.
+	NodeRoleController NodeRole = "controller"
+	// NodeRoleSingle nodes run a k0s controller and worker as a cluster of their own,
+	// e.G. at edge sites. They don't join the cluster of the machine-controller.
+	NodeRoleSingle NodeRole = "single"
+)
+
+// HardeningProfile defines the security benchmark applied to a node.
+type HardeningProfile string
+
+const (
+	// HardeningProfileCIS applies the settings of the CIS benchmarks.
+	HardeningProfileCIS HardeningProfile = "cis"
 )
 
 type CloudProvider string
@@ -71,6 +111,18 @@ var (
 		OperatingSystemSLES,
 		OperatingSystemRHEL,
 		OperatingSystemFlatcar,
+		OperatingSystemRockyLinux,
+		OperatingSystemAlmaLinux,
+		OperatingSystemAmazonLinux2023,
+		OperatingSystemFedoraCoreOS,
+		OperatingSystemOpenSUSE,
+		OperatingSystemWindows,
+	}
+
+	// AllBootstrapFlavors is a slice containing all supported bootstrap flavors.
+	AllBootstrapFlavors = []BootstrapFlavor{
+		BootstrapFlavorKubeadm,
+		BootstrapFlavorK0s,
 	}
 
 	// AllCloudProviders is a slice containing all supported cloud providers.
@@ -102,6 +154,211 @@ type NetworkConfig struct {
 	CIDR    string    `json:"cidr"`
 	Gateway string    `json:"gateway"`
 	DNS     DNSConfig `json:"dns"`
+	// IPPool names the configmap of an IP pool in the namespace of the machine. The
+	// address of the machine is allocated from the pool and replaces the CIDR, the
+	// gateway and the DNS servers of the pool are used unless set.
+	// +optional
+	IPPool string `json:"ipPool,omitempty"`
+}
+
+// ProxySettings contains the proxies a node uses
+type ProxySettings struct {
+	HTTPProxy string `json:"httpProxy,omitempty"`
+	// Defaults to HTTPProxy.
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	NoProxy    string `json:"noProxy,omitempty"`
+}
+
+// KubeletSettings configures the kubelet of a node
+type KubeletSettings struct {
+	// MaxPods is the maximum number of pods which can run on the node.
+	MaxPods *int32 `json:"maxPods,omitempty"`
+	// EvictionHard maps eviction signals, e.G. "memory.available", to the
+	// thresholds which trigger pod evictions, e.G. "100Mi".
+	EvictionHard map[string]string `json:"evictionHard,omitempty"`
+	// KubeReserved and SystemReserved replace the default reservations.
+	KubeReserved   map[string]string `json:"kubeReserved,omitempty"`
+	SystemReserved map[string]string `json:"systemReserved,omitempty"`
+	// FeatureGates get merged over the node-wide feature gates.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+	// ExtraArgs are additional kubelet flags without the leading dashes,
+	// e.G. "image-gc-high-threshold": "80".
+	ExtraArgs map[string]string `json:"extraArgs,omitempty"`
+}
+
+// SwapSettings configures a swapfile on the node
+type SwapSettings struct {
+	// Size of the swapfile, e.G. "4Gi".
+	Size string `json:"size"`
+	// SwapBehavior configures how pods may use swap, either "LimitedSwap" or
+	// "UnlimitedSwap". Defaults to "LimitedSwap".
+	SwapBehavior string `json:"swapBehavior,omitempty"`
+}
+
+// PreJoinChecks configures the checks a node runs before it joins the cluster
+type PreJoinChecks struct {
+	// MinFreeDiskMB is the disk space in MiB which must be free below /var/lib.
+	// Defaults to 2048.
+	MinFreeDiskMB int64 `json:"minFreeDiskMB,omitempty"`
+	// RequireCgroupV2 fails the checks on nodes which don't run with the unified
+	// cgroup hierarchy.
+	RequireCgroupV2 bool `json:"requireCgroupV2,omitempty"`
+	// FailJoin stops the setup of the node when a check failed, instead of only
+	// reporting the failure and joining anyway.
+	FailJoin bool `json:"failJoin,omitempty"`
+}
+
+// SSHSettings configures the login user and the SSH daemon of a node
+type SSHSettings struct {
+	// User replaces the name of the default user of the image, which gets
+	// the SSH public keys. Defaults to the default user of the image.
+	User string `json:"user,omitempty"`
+	// PasswordAuthentication allows SSH logins with a password.
+	PasswordAuthentication bool `json:"passwordAuthentication,omitempty"`
+	// Disabled stops and disables the SSH daemon.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// NodeIPFamily is the IP family of the addresses a node registers with
+type NodeIPFamily string
+
+const (
+	NodeIPFamilyIPv4 NodeIPFamily = "IPv4"
+	NodeIPFamilyIPv6 NodeIPFamily = "IPv6"
+	// Dual-stack with IPv4 as primary family.
+	NodeIPFamilyIPv4IPv6 NodeIPFamily = "IPv4IPv6"
+	// Dual-stack with IPv6 as primary family.
+	NodeIPFamilyIPv6IPv4 NodeIPFamily = "IPv6IPv4"
+)
+
+// NodeNetworkSettings configures the network of a node
+type NodeNetworkSettings struct {
+	// IPFamily selects the addresses of the default route interfaces the node
+	// registers with. Defaults to "IPv4".
+	IPFamily NodeIPFamily `json:"ipFamily,omitempty"`
+	// MTU is set on the default route interface.
+	MTU int32 `json:"mtu,omitempty"`
+	// ResolvConf configures the resolver of the node.
+	ResolvConf *ResolvConfSettings `json:"resolvConf,omitempty"`
+}
+
+// ResolvConfSettings are written to /etc/resolv.conf, the nameservers are
+// kept from the network configuration of the node
+type ResolvConfSettings struct {
+	// Search domains, e.G. "example.com".
+	Search []string `json:"search,omitempty"`
+	// Options, e.G. "ndots:2" or "single-request-reopen".
+	Options []string `json:"options,omitempty"`
+}
+
+// UpdatePolicySettings configures the package updates of a node
+type UpdatePolicySettings struct {
+	// AutomaticUpdates enables or disables the unattended upgrades of the
+	// operating system. Unset keeps the default of the image.
+	AutomaticUpdates *bool `json:"automaticUpdates,omitempty"`
+	// PinPackages holds the container runtime packages on the version the
+	// node got provisioned with, so updates do not restart them.
+	PinPackages bool `json:"pinPackages,omitempty"`
+}
+
+// KernelSettings configures the kernel of a node
+type KernelSettings struct {
+	// Modules get loaded on boot, e.G. "ip_vs".
+	Modules []string `json:"modules,omitempty"`
+	// Sysctls get applied on boot and override the ones of the operating
+	// system plugin, e.G. "net.netfilter.nf_conntrack_max": "1048576".
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+}
+
+// GPUDriver is the vendor of the GPU driver installed on a node
+type GPUDriver string
+
+const (
+	GPUDriverNvidia GPUDriver = "nvidia"
+)
+
+// GPUSettings configures the GPU driver of a node
+type GPUSettings struct {
+	// Driver is the vendor of the driver, only "nvidia" is supported.
+	Driver GPUDriver `json:"driver"`
+	// Version is the branch of the driver, e.G. "535". Defaults to "535".
+	Version string `json:"version,omitempty"`
+}
+
+// InstanceRequirements are the resources an instance type must at least offer
+type InstanceRequirements struct {
+	// CPUs is the number of virtual CPUs.
+	CPUs int32 `json:"cpus"`
+	// MemoryMB is the memory in MiB.
+	MemoryMB int64 `json:"memoryMB"`
+	// GPUs is the number of GPUs.
+	// +optional
+	GPUs int32 `json:"gpus,omitempty"`
+}
+
+// AddOn is a node agent from the add-on registry of the machine-controller
+// which gets installed on a node
+type AddOn struct {
+	// Name of the add-on, one of "node-problem-detector", "amazon-ssm-agent"
+	// or "elastic-agent".
+	Name string `json:"name"`
+	// Settings of the add-on, either inline or from a secret or configmap.
+	// +optional
+	Settings map[string]ConfigVarString `json:"settings,omitempty"`
+}
+
+// File is a file which gets written to a node
+type File struct {
+	// Path is the absolute path of the file.
+	Path string `json:"path"`
+	// Permissions of the file in octal notation, e.G. "0600". Defaults to "0644".
+	Permissions string `json:"permissions,omitempty"`
+	// Content of the file, either inline or from a secret or configmap.
+	Content ConfigVarString `json:"content"`
+}
+
+// SystemdUnit is a systemd unit which gets written to /etc/systemd/system,
+// enabled and started on a node
+type SystemdUnit struct {
+	// Name of the unit, e.G. "node-agent.service".
+	Name string `json:"name"`
+	// Content of the unit, either inline or from a secret or configmap.
+	Content ConfigVarString `json:"content"`
+}
+
+// StaticPod is a pod manifest which gets written to the static pod path of the
+// kubelet of a node
+type StaticPod struct {
+	// Name of the manifest file without extension, e.G. "keepalived".
+	Name string `json:"name"`
+	// Manifest of the pod, either inline or from a secret or configmap.
+	Manifest ConfigVarString `json:"manifest"`
+}
+
+// UpdateStrategy controls how changes of the spec of an existing machine are applied
+type UpdateStrategy string
+
+const (
+	// UpdateStrategyImmutable rejects changes of the spec, the machine has to be replaced instead.
+	UpdateStrategyImmutable UpdateStrategy = "Immutable"
+	// UpdateStrategyRecreate drains the node and recreates the instance from the changed spec.
+	UpdateStrategyRecreate UpdateStrategy = "Recreate"
+	// UpdateStrategyInPlace applies the changes to the existing instance, e.g. a resize.
+	UpdateStrategyInPlace UpdateStrategy = "InPlace"
+)
+
+// ControllerSettings configure nodes which join as k0s controllers.
+type ControllerSettings struct {
+	// Schedulable keeps the control plane taint off the node, so it runs
+	// regular workloads as well.
+	// +optional
+	Schedulable bool `json:"schedulable,omitempty"`
+}
+
+// RegistryCredentials contains the credentials images get pulled from a registry with
+type RegistryCredentials struct {
+	Username ConfigVarString `json:"username"`
+	Password ConfigVarString `json:"password"`
 }
 
 type Config struct {
@@ -113,6 +370,176 @@ type Config struct {
 	OperatingSystem     OperatingSystem      `json:"operatingSystem"`
 	OperatingSystemSpec runtime.RawExtension `json:"operatingSystemSpec"`
 
+	// BootstrapFlavor selects how the node joins the cluster. Defaults to
+	// the first flavor the operating system supports.
+	// +optional
+	BootstrapFlavor BootstrapFlavor `json:"bootstrapFlavor,omitempty"`
+
+	// K0sVersion is the k0s release installed on the node, e.G. "v1.21.2+k0s.1".
+	// Only used by the k0s bootstrap flavor. Defaults to the k0s release
+	// the machine-controller was tested with.
+	// +optional
+	K0sVersion string `json:"k0sVersion,omitempty"`
+
+	// AirgapBundleURL is the URL of a k0s airgap image bundle which gets preloaded
+	// on the node, so it comes up without registry access. Only used by the k0s
+	// bootstrap flavor.
+	// +optional
+	AirgapBundleURL string `json:"airgapBundleURL,omitempty"`
+
+	// Role selects whether the node joins as k0s worker or controller, or runs
+	// a single node cluster. Defaults to worker. Only used by the k0s bootstrap
+	// flavor.
+	// +optional
+	Role NodeRole `json:"role,omitempty"`
+
+	// Controller configures nodes with the controller role.
+	// +optional
+	Controller *ControllerSettings `json:"controller,omitempty"`
+
+	// WorkerProfile selects the worker profile of the k0s ClusterConfig the kubelet
+	// of the node gets configured with, instead of the kubelet settings. Only used
+	// by the k0s bootstrap flavor.
+	// +optional
+	WorkerProfile string `json:"workerProfile,omitempty"`
+
+	// JoinAddresses are the URLs of the kube-apiservers workers join the cluster
+	// with, e.G. "https://10.0.0.10:6443", instead of the address of the
+	// cluster-info ConfigMap. With several addresses, like the ones of the
+	// controllers of a control plane without load balancer, the worker joins with
+	// the first one which responds. Only used by the k0s bootstrap flavor.
+	// +optional
+	JoinAddresses []string `json:"joinAddresses,omitempty"`
+
+	// RegistryMirrors maps registries, e.G. "docker.io", to the mirror endpoints
+	// containerd pulls their images from. Only used by the k0s bootstrap flavor.
+	// +optional
+	RegistryMirrors map[string][]string `json:"registryMirrors,omitempty"`
+
+	// InsecureRegistries are pulled from without verifying their TLS certificate,
+	// registries without mirrors get pulled from via plain HTTP. Only used by
+	// the k0s bootstrap flavor.
+	// +optional
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"`
+
+	// RegistryCredentials maps registries to the credentials containerd pulls
+	// their images with. Only used by the k0s bootstrap flavor.
+	// +optional
+	RegistryCredentials map[string]RegistryCredentials `json:"registryCredentials,omitempty"`
+
+	// Proxy configures the proxies of the node, replacing the node-wide proxy
+	// settings of the machine-controller.
+	// +optional
+	Proxy *ProxySettings `json:"proxy,omitempty"`
+
+	// CABundle contains additional PEM encoded CA certificates which get installed
+	// into the trust store of the node before anything is downloaded.
+	// +optional
+	CABundle *ConfigVarString `json:"caBundle,omitempty"`
+
+	// Kubelet configures the kubelet of the node.
+	// +optional
+	Kubelet *KubeletSettings `json:"kubelet,omitempty"`
+
+	// Swap provisions a swapfile on the node and allows the kubelet to run with
+	// swap enabled. Requires Kubernetes 1.22 or newer.
+	// +optional
+	Swap *SwapSettings `json:"swap,omitempty"`
+
+	// SSH configures the login user and the SSH daemon of the node.
+	// Only supported on operating systems provisioned with cloud-init.
+	// +optional
+	SSH *SSHSettings `json:"ssh,omitempty"`
+
+	// NodeNetwork configures the node IP selection, the MTU and the resolver
+	// of the node instead of taking what DHCP hands out.
+	// +optional
+	NodeNetwork *NodeNetworkSettings `json:"nodeNetwork,omitempty"`
+
+	// UpdatePolicy controls the automatic package updates of the node.
+	// Only supported on Ubuntu, RHEL based operating systems and Amazon Linux 2023.
+	// +optional
+	UpdatePolicy *UpdatePolicySettings `json:"updatePolicy,omitempty"`
+
+	// Kernel configures the kernel modules and sysctls of the node.
+	// +optional
+	Kernel *KernelSettings `json:"kernel,omitempty"`
+
+	// GPU installs the GPU driver and the container toolkit, which exposes
+	// the GPUs to containers, on the node.
+	// Only supported on Ubuntu and RHEL based operating systems.
+	// +optional
+	GPU *GPUSettings `json:"gpu,omitempty"`
+
+	// AddOns get installed on the node through files and systemd units, so
+	// common node agents need no custom files or operating system profiles.
+	// Not supported on Windows.
+	// +optional
+	AddOns []AddOn `json:"addOns,omitempty"`
+
+	// Files get written to the node in addition to the files of the
+	// operating system plugin.
+	// +optional
+	Files []File `json:"files,omitempty"`
+
+	// SystemdUnits get written to the node, enabled and started after
+	// the node has been set up.
+	// +optional
+	SystemdUnits []SystemdUnit `json:"systemdUnits,omitempty"`
+
+	// StaticPods get written to the static pod path of the kubelet before
+	// the kubelet starts.
+	// +optional
+	StaticPods []StaticPod `json:"staticPods,omitempty"`
+
+	// Hardening applies the given security benchmark to the node.
+	// Only supported on Ubuntu and RHEL based operating systems.
+	// +optional
+	Hardening HardeningProfile `json:"hardening,omitempty"`
+
+	// PreJoinChecks checks the clock synchronization, the free disk space, the
+	// cgroup version and the connectivity to the controllers before the node
+	// joins. Failures of workers are reported as warning events of their node.
+	// Only used by the k0s bootstrap flavor.
+	// +optional
+	PreJoinChecks *PreJoinChecks `json:"preJoinChecks,omitempty"`
+
+	// OperatingSystemProfile is the name of an OperatingSystemProfile in the namespace
+	// of the machine to render the userdata from instead of the operating system plugin.
+	// +optional
+	OperatingSystemProfile string `json:"operatingSystemProfile,omitempty"`
+
+	// UpdateStrategy controls how changes of the spec are applied after the
+	// machine got created, one of Immutable, Recreate or InPlace. Defaults
+	// to Immutable.
+	// +optional
+	UpdateStrategy UpdateStrategy `json:"updateStrategy,omitempty"`
+
+	// FetchUserDataOnBoot makes the instance fetch its userdata from the
+	// machine-controller on boot instead of passing it to the cloud provider,
+	// which works around the userdata size limits of the cloud providers.
+	// +optional
+	FetchUserDataOnBoot bool `json:"fetchUserDataOnBoot,omitempty"`
+
+	// ExternalCloudProvider sets --cloud-provider=external on the kubelet to
+	// run an out-of-tree cloud controller manager. Overrides the
+	// -external-cloud-provider flag of the machine-controller.
+	// +optional
+	ExternalCloudProvider *bool `json:"externalCloudProvider,omitempty"`
+
+	// CredentialProfile selects a set of cloud provider credentials from the
+	// credential profiles secret of the machine-controller. Credentials not
+	// set in the cloudProviderSpec are taken from it instead of the
+	// environment of the machine-controller.
+	// +optional
+	CredentialProfile string `json:"credentialProfile,omitempty"`
+
+	// InstanceRequirements lets the cloud provider pick the cheapest instance
+	// type meeting them, when the cloudProviderSpec doesn't set a type.
+	// Only supported on Hetzner and DigitalOcean.
+	// +optional
+	InstanceRequirements *InstanceRequirements `json:"instanceRequirements,omitempty"`
+
 	// +optional
 	Network *NetworkConfig `json:"network,omitempty"`
 
@@ -130,10 +557,23 @@ type GlobalObjectKeySelector struct {
 type GlobalSecretKeySelector GlobalObjectKeySelector
 type GlobalConfigMapKeySelector GlobalObjectKeySelector
 
+// VaultKeySelector references a key of a secret in HashiCorp Vault, which the
+// machine-controller reads after logging in with the Kubernetes auth method
+type VaultKeySelector struct {
+	// Path of the secret, e.G. "secret/data/hetzner" for a KV version 2 engine.
+	Path string `json:"path,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// Role of the Kubernetes auth method to log in with. Defaults to the
+	// -vault-role of the machine-controller.
+	// +optional
+	Role string `json:"role,omitempty"`
+}
+
 type ConfigVarString struct {
 	Value           string                     `json:"value,omitempty"`
 	SecretKeyRef    GlobalSecretKeySelector    `json:"secretKeyRef,omitempty"`
 	ConfigMapKeyRef GlobalConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	VaultKeyRef     VaultKeySelector           `json:"vaultKeyRef,omitempty"`
 }
 
 // This type only exists to have the same fields as ConfigVarString but
@@ -159,8 +599,10 @@ func (configVarString ConfigVarString) MarshalJSON() ([]byte, error) {
 		configMapKeyRefEmpty = true
 	}
 
-	if secretKeyRefEmpty && configMapKeyRefEmpty {
-		return []byte(fmt.Sprintf(`"%s"`, configVarString.Value)), nil
+	vaultKeyRefEmpty := configVarString.VaultKeyRef == VaultKeySelector{}
+
+	if secretKeyRefEmpty && configMapKeyRefEmpty && vaultKeyRefEmpty {
+		return json.Marshal(configVarString.Value)
 	}
 
 	buffer := bytes.NewBufferString("{")
@@ -184,8 +626,24 @@ func (configVarString ConfigVarString) MarshalJSON() ([]byte, error) {
 		buffer.WriteString(fmt.Sprintf(`%s"configMapKeyRef":%s`, leadingComma, jsonVal))
 	}
 
+	if !vaultKeyRefEmpty {
+		var leadingComma string
+		if !secretKeyRefEmpty || !configMapKeyRefEmpty {
+			leadingComma = ","
+		}
+		jsonVal, err := json.Marshal(configVarString.VaultKeyRef)
+		if err != nil {
+			return nil, err
+		}
+		buffer.WriteString(fmt.Sprintf(`%s"vaultKeyRef":%s`, leadingComma, jsonVal))
+	}
+
 	if configVarString.Value != "" {
-		buffer.WriteString(fmt.Sprintf(`,"value":"%s"`, configVarString.Value))
+		jsonVal, err := json.Marshal(configVarString.Value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.WriteString(fmt.Sprintf(`,"value":%s`, jsonVal))
 	}
 
 	buffer.WriteString("}")
@@ -193,6 +651,10 @@ func (configVarString ConfigVarString) MarshalJSON() ([]byte, error) {
 }
 
 func (configVarString *ConfigVarString) UnmarshalJSON(b []byte) error {
+	// Values containing escaped characters like the newlines of certificates
+	if bytes.HasPrefix(b, []byte(`"`)) {
+		return json.Unmarshal(b, &configVarString.Value)
+	}
 	if !bytes.HasPrefix(b, []byte("{")) {
 		b = bytes.TrimPrefix(b, []byte(`"`))
 		b = bytes.TrimSuffix(b, []byte(`"`))
@@ -209,6 +671,7 @@ func (configVarString *ConfigVarString) UnmarshalJSON(b []byte) error {
 	configVarString.Value = cvsDummy.Value
 	configVarString.SecretKeyRef = cvsDummy.SecretKeyRef
 	configVarString.ConfigMapKeyRef = cvsDummy.ConfigMapKeyRef
+	configVarString.VaultKeyRef = cvsDummy.VaultKeyRef
 	return nil
 }
 
@@ -272,7 +735,8 @@ func (configVarBool *ConfigVarBool) UnmarshalJSON(b []byte) error {
 	if !bytes.HasPrefix(b, []byte("{")) {
 		value, err := strconv.ParseBool(string(b))
 		if err != nil {
-			return fmt.Errorf("Error converting string to bool: '%v'", err)
+			// The value is not part of the error, it might be a misplaced credential
+			return errors.New("Error converting string to bool: must be true or false")
 		}
 		configVarBool.Value = value
 		return nil
@@ -288,6 +752,11 @@ func (configVarBool *ConfigVarBool) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// CloudProviderSpecPath is the path of the cloud provider spec within the provider config. Cloud
+// providers return field errors below it from Validate, the webhook prefixes them with the path
+// of the provider config within the object.
+var CloudProviderSpecPath = field.NewPath("cloudProviderSpec")
+
 func GetConfig(r clusterv1alpha1.ProviderSpec) (*Config, error) {
 	if r.Value == nil {
 		return nil, fmt.Errorf("machine.spec.providerSpec.value is nil")
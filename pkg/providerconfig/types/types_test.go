@@ -73,10 +73,18 @@ func TestConfigVarStringMarshalling(t *testing.T) {
 			cvs:      ConfigVarString{Value: "val"},
 			expected: `"val"`,
 		},
+		{
+			cvs:      ConfigVarString{Value: "-----BEGIN CERTIFICATE-----\n\"cert\"\n"},
+			expected: `"-----BEGIN CERTIFICATE-----\n\"cert\"\n"`,
+		},
 		{
 			cvs:      ConfigVarString{SecretKeyRef: GlobalSecretKeySelector{ObjectReference: v1.ObjectReference{Namespace: "ns", Name: "name"}, Key: "key"}},
 			expected: `{"secretKeyRef":{"namespace":"ns","name":"name","key":"key"}}`,
 		},
+		{
+			cvs:      ConfigVarString{VaultKeyRef: VaultKeySelector{Path: "secret/data/hetzner", Key: "token"}},
+			expected: `{"vaultKeyRef":{"path":"secret/data/hetzner","key":"token"}}`,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -121,6 +129,7 @@ func TestConfigVarStringMarshallingAndUnmarshalling(t *testing.T) {
 
 	testCases := []ConfigVarString{
 		{Value: "val"},
+		{Value: "-----BEGIN CERTIFICATE-----\n\"cert\"\n-----END CERTIFICATE-----\n"},
 		{SecretKeyRef: GlobalSecretKeySelector{ObjectReference: v1.ObjectReference{Namespace: "ns", Name: "name"}, Key: "key"}},
 		{Value: "val", SecretKeyRef: GlobalSecretKeySelector{ObjectReference: v1.ObjectReference{Namespace: "ns", Name: "name"}, Key: "key"}},
 		{ConfigMapKeyRef: GlobalConfigMapKeySelector{ObjectReference: v1.ObjectReference{Namespace: "ns", Name: "name"}, Key: "key"}},
@@ -0,0 +1,274 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	ctrlruntimefake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testEnvVar = "MACHINE_CONTROLLER_TEST_CONFIG_VAR"
+
+func newTestResolver() *ConfigVarResolver {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "credentials"},
+		Data: map[string][]byte{
+			"token":   []byte("secret-token"),
+			"enabled": []byte("true"),
+			"empty":   []byte(""),
+		},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "settings"},
+		Data: map[string]string{
+			"region":  "fra1",
+			"enabled": "true",
+		},
+	}
+	return NewConfigVarResolver(context.Background(), ctrlruntimefake.NewFakeClient(secret, configMap))
+}
+
+func secretKeyRef(key string) providerconfigtypes.GlobalSecretKeySelector {
+	selector := providerconfigtypes.GlobalSecretKeySelector{Key: key}
+	selector.Namespace = "kube-system"
+	selector.Name = "credentials"
+	return selector
+}
+
+func configMapKeyRef(key string) providerconfigtypes.GlobalConfigMapKeySelector {
+	selector := providerconfigtypes.GlobalConfigMapKeySelector{Key: key}
+	selector.Namespace = "kube-system"
+	selector.Name = "settings"
+	return selector
+}
+
+func TestGetConfigVarStringValueOrEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		configVar providerconfigtypes.ConfigVarString
+		env       *string
+		expected  string
+		err       bool
+	}{
+		{
+			name:      "value",
+			configVar: providerconfigtypes.ConfigVarString{Value: "inline-token"},
+			env:       pointer.StringPtr("env-token"),
+			expected:  "inline-token",
+		},
+		{
+			name:      "secret",
+			configVar: providerconfigtypes.ConfigVarString{SecretKeyRef: secretKeyRef("token")},
+			env:       pointer.StringPtr("env-token"),
+			expected:  "secret-token",
+		},
+		{
+			name:      "configmap",
+			configVar: providerconfigtypes.ConfigVarString{ConfigMapKeyRef: configMapKeyRef("region")},
+			expected:  "fra1",
+		},
+		{
+			name:     "environment variable",
+			env:      pointer.StringPtr("env-token"),
+			expected: "env-token",
+		},
+		{
+			name:      "empty secret value falls back to the environment variable",
+			configVar: providerconfigtypes.ConfigVarString{SecretKeyRef: secretKeyRef("empty")},
+			env:       pointer.StringPtr("env-token"),
+			expected:  "env-token",
+		},
+		{
+			name: "nothing set",
+		},
+		{
+			name:      "missing secret key",
+			configVar: providerconfigtypes.ConfigVarString{SecretKeyRef: secretKeyRef("password")},
+			env:       pointer.StringPtr("env-token"),
+			err:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestEnvVar(t, test.env)
+			defer os.Unsetenv(testEnvVar)
+
+			value, err := newTestResolver().GetConfigVarStringValueOrEnv(test.configVar, testEnvVar)
+			if (err != nil) != test.err {
+				t.Fatalf("expected err to be %v, but got %v", test.err, err)
+			}
+			if value != test.expected {
+				t.Errorf("expected value %q, but got %q", test.expected, value)
+			}
+		})
+	}
+}
+
+func TestGetConfigVarBoolValueOrEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		configVar providerconfigtypes.ConfigVarBool
+		env       *string
+		expected  bool
+		err       bool
+	}{
+		{
+			name:      "value",
+			configVar: providerconfigtypes.ConfigVarBool{Value: true},
+			env:       pointer.StringPtr("false"),
+			expected:  true,
+		},
+		{
+			name:      "secret",
+			configVar: providerconfigtypes.ConfigVarBool{SecretKeyRef: secretKeyRef("enabled")},
+			env:       pointer.StringPtr("false"),
+			expected:  true,
+		},
+		{
+			name:      "configmap",
+			configVar: providerconfigtypes.ConfigVarBool{ConfigMapKeyRef: configMapKeyRef("enabled")},
+			expected:  true,
+		},
+		{
+			name:     "environment variable",
+			env:      pointer.StringPtr("true"),
+			expected: true,
+		},
+		{
+			name: "nothing set",
+		},
+		{
+			name: "invalid environment variable",
+			env:  pointer.StringPtr("yes please"),
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestEnvVar(t, test.env)
+			defer os.Unsetenv(testEnvVar)
+
+			value, err := newTestResolver().GetConfigVarBoolValueOrEnv(test.configVar, testEnvVar)
+			if (err != nil) != test.err {
+				t.Fatalf("expected err to be %v, but got %v", test.err, err)
+			}
+			if value != test.expected {
+				t.Errorf("expected value %v, but got %v", test.expected, value)
+			}
+		})
+	}
+}
+
+func TestResolvedSecrets(t *testing.T) {
+	const tokenEnvVar = "MACHINE_CONTROLLER_TEST_TOKEN"
+	if err := os.Setenv(tokenEnvVar, "env-token"); err != nil {
+		t.Fatalf("failed to set %s: %v", tokenEnvVar, err)
+	}
+	defer os.Unsetenv(tokenEnvVar)
+	setTestEnvVar(t, pointer.StringPtr("eu-central-1"))
+	defer os.Unsetenv(testEnvVar)
+
+	resolver := newTestResolver()
+	for _, configVar := range []providerconfigtypes.ConfigVarString{
+		{SecretKeyRef: secretKeyRef("token")},
+		{ConfigMapKeyRef: configMapKeyRef("region")},
+		{Value: "inline-token"},
+	} {
+		if _, err := resolver.GetConfigVarStringValue(configVar); err != nil {
+			t.Fatalf("failed to get config var: %v", err)
+		}
+	}
+	for _, envVarName := range []string{tokenEnvVar, testEnvVar} {
+		if _, err := resolver.ForCredentialProfile("").GetConfigVarStringValueOrEnv(providerconfigtypes.ConfigVarString{}, envVarName); err != nil {
+			t.Fatalf("failed to get %s: %v", envVarName, err)
+		}
+	}
+
+	// Inline values are redacted through the provider spec, configmaps and variables not named like
+	// credentials don't hold any
+	expected := []string{"secret-token", "env-token"}
+	if secrets := resolver.ResolvedSecrets(); !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("expected resolved secrets %v, but got %v", expected, secrets)
+	}
+}
+
+func TestReferencesSecret(t *testing.T) {
+	tests := []struct {
+		name         string
+		providerSpec string
+		expected     bool
+	}{
+		{
+			name:         "cloud provider credentials",
+			providerSpec: `{"cloudProviderSpec":{"token":{"secretKeyRef":{"namespace":"kube-system","name":"credentials","key":"token"}}}}`,
+			expected:     true,
+		},
+		{
+			name:         "list element",
+			providerSpec: `{"cloudProviderSpec":{"securityGroups":[{"secretKeyRef":{"namespace":"kube-system","name":"credentials","key":"group"}}]}}`,
+			expected:     true,
+		},
+		{
+			name:         "secret of another namespace",
+			providerSpec: `{"cloudProviderSpec":{"token":{"secretKeyRef":{"namespace":"default","name":"credentials","key":"token"}}}}`,
+		},
+		{
+			name:         "configmap",
+			providerSpec: `{"cloudProviderSpec":{"token":{"configMapKeyRef":{"namespace":"kube-system","name":"credentials","key":"token"}}}}`,
+		},
+		{
+			name:         "inline value",
+			providerSpec: `{"cloudProviderSpec":{"token":"credentials"}}`,
+		},
+		{
+			name: "no provider spec",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			providerSpec := &runtime.RawExtension{Raw: []byte(test.providerSpec)}
+			if referenced := ReferencesSecret(providerSpec, "kube-system", "credentials"); referenced != test.expected {
+				t.Errorf("expected %v, but got %v", test.expected, referenced)
+			}
+		})
+	}
+}
+
+func setTestEnvVar(t *testing.T, value *string) {
+	if value == nil {
+		if err := os.Unsetenv(testEnvVar); err != nil {
+			t.Fatalf("failed to unset %s: %v", testEnvVar, err)
+		}
+		return
+	}
+	if err := os.Setenv(testEnvVar, *value); err != nil {
+		t.Fatalf("failed to set %s: %v", testEnvVar, err)
+	}
+}
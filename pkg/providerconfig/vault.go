@@ -0,0 +1,233 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+// DefaultVaultTokenFile is the service account token the machine-controller logs in to Vault with
+const DefaultVaultTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultSettings configure the HashiCorp Vault server secrets referenced with vaultKeyRef are read from
+type VaultSettings struct {
+	// Address of the server, e.G. https://vault.example.com:8200. Vault is disabled if empty.
+	Address string
+	// AuthMount is the path the Kubernetes auth method is mounted at, e.G. "kubernetes".
+	AuthMount string
+	// Role of the Kubernetes auth method references without a role of their own log in with.
+	Role string
+	// TokenFile is the service account token to log in with.
+	TokenFile string
+	// CAFile verifies the certificate of the server instead of the system roots, if set.
+	CAFile string
+}
+
+var vault = &vaultClient{}
+
+// SetVault configures the Vault server secrets referenced with vaultKeyRef are read from
+func SetVault(settings VaultSettings) error {
+	httpClient := &http.Client{Timeout: 15 * time.Second}
+	if settings.CAFile != "" {
+		caBundle, err := ioutil.ReadFile(settings.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", settings.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return fmt.Errorf("%s contains no PEM encoded certificates", settings.CAFile)
+		}
+		httpClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	vault.settings = settings
+	vault.httpClient = httpClient
+	vault.tokens = map[string]vaultToken{}
+	return nil
+}
+
+type vaultClient struct {
+	mu         sync.Mutex
+	settings   VaultSettings
+	httpClient *http.Client
+	// tokens holds the client tokens by role, so not every read logs in again
+	tokens map[string]vaultToken
+}
+
+type vaultToken struct {
+	token   string
+	renewAt time.Time
+}
+
+// read returns the value of the key of the secret the given selector references. Values are
+// read on every call, so rotated secrets are used right away.
+func (c *vaultClient) read(ctx context.Context, ref providerconfigtypes.VaultKeySelector) (string, error) {
+	c.mu.Lock()
+	settings, httpClient := c.settings, c.httpClient
+	c.mu.Unlock()
+	if settings.Address == "" {
+		return "", errors.New("no vault server configured, set -vault-address")
+	}
+	role := ref.Role
+	if role == "" {
+		role = settings.Role
+	}
+	if role == "" {
+		return "", errors.New("no vault role set in the reference or with -vault-role")
+	}
+
+	token, err := c.login(ctx, settings, httpClient, role)
+	if err != nil {
+		return "", err
+	}
+
+	secret := struct {
+		Data map[string]interface{} `json:"data"`
+	}{}
+	url := strings.TrimSuffix(settings.Address, "/") + "/v1/" + strings.TrimPrefix(ref.Path, "/")
+	if err := doVaultRequest(ctx, httpClient, http.MethodGet, url, token, nil, &secret); err != nil {
+		if statusErr, ok := err.(*vaultStatusError); ok && statusErr.status == http.StatusForbidden {
+			// The token may have been revoked, the next read logs in again
+			c.mu.Lock()
+			delete(c.tokens, role)
+			c.mu.Unlock()
+		}
+		return "", err
+	}
+
+	values := secret.Data
+	// Secrets of KV version 2 engines are nested, next to their metadata
+	if nested, ok := values["data"].(map[string]interface{}); ok {
+		if _, ok := values["metadata"]; ok {
+			values = nested
+		}
+	}
+	value, exists := values[ref.Key]
+	if !exists {
+		return "", fmt.Errorf("secret has no key '%s'", ref.Key)
+	}
+	stringValue, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("key '%s' of the secret is not a string", ref.Key)
+	}
+	return stringValue, nil
+}
+
+// login returns a client token of the given role, logging in with the Kubernetes auth method
+// if there is no valid one yet
+func (c *vaultClient) login(ctx context.Context, settings VaultSettings, httpClient *http.Client, role string) (string, error) {
+	c.mu.Lock()
+	token, exists := c.tokens[role]
+	c.mu.Unlock()
+	if exists && time.Now().Before(token.renewAt) {
+		return token.token, nil
+	}
+
+	jwt, err := ioutil.ReadFile(settings.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the service account token: %v", err)
+	}
+	login := struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}{}
+	url := fmt.Sprintf("%s/v1/auth/%s/login", strings.TrimSuffix(settings.Address, "/"), strings.Trim(settings.AuthMount, "/"))
+	body := map[string]string{"role": role, "jwt": strings.TrimSpace(string(jwt))}
+	if err := doVaultRequest(ctx, httpClient, http.MethodPost, url, "", body, &login); err != nil {
+		return "", fmt.Errorf("failed to log in with role '%s': %v", role, err)
+	}
+	if login.Auth.ClientToken == "" {
+		return "", fmt.Errorf("failed to log in with role '%s': no client token returned", role)
+	}
+
+	// Renew well before the token expires, so reads in flight don't fail
+	token = vaultToken{
+		token:   login.Auth.ClientToken,
+		renewAt: time.Now().Add(time.Duration(login.Auth.LeaseDuration) * time.Second * 3 / 4),
+	}
+	c.mu.Lock()
+	c.tokens[role] = token
+	c.mu.Unlock()
+	return token.token, nil
+}
+
+// vaultStatusError is returned for responses of the Vault server with an unexpected status
+type vaultStatusError struct {
+	status   int
+	messages []string
+}
+
+func (e *vaultStatusError) Error() string {
+	if len(e.messages) == 0 {
+		return fmt.Sprintf("vault returned status %d", e.status)
+	}
+	return fmt.Sprintf("vault returned status %d: %s", e.status, strings.Join(e.messages, ", "))
+}
+
+func doVaultRequest(ctx context.Context, httpClient *http.Client, method, url, token string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errResp := struct {
+			Errors []string `json:"errors"`
+		}{}
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		return &vaultStatusError{status: resp.StatusCode, messages: errResp.Errors}
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providerconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+// fakeVault serves the Kubernetes auth login and KV secrets like a Vault server
+type fakeVault struct {
+	logins int
+	// revoked makes reads fail with 403 like for a revoked token
+	revoked bool
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/auth/kubernetes/login":
+		login := map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil || login["jwt"] != "sa-token" || login["role"] != "machine-controller" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		v.logins++
+		fmt.Fprintf(w, `{"auth":{"client_token":"client-token-%d","lease_duration":3600}}`, v.logins)
+		return
+	}
+
+	if v.revoked || r.Header.Get("X-Vault-Token") != fmt.Sprintf("client-token-%d", v.logins) {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/secret/data/hetzner":
+		fmt.Fprint(w, `{"data":{"data":{"token":"kv2-token"},"metadata":{"version":3}}}`)
+	case "/v1/kv/hetzner":
+		fmt.Fprint(w, `{"data":{"token":"kv1-token"}}`)
+	default:
+		http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+	}
+}
+
+func TestVaultKeyRef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("sa-token\n"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	server := &fakeVault{}
+	s := httptest.NewServer(server)
+	defer s.Close()
+	if err := SetVault(VaultSettings{Address: s.URL, AuthMount: "kubernetes", Role: "machine-controller", TokenFile: tokenFile}); err != nil {
+		t.Fatalf("failed to configure vault: %v", err)
+	}
+	defer SetVault(VaultSettings{})
+
+	tests := []struct {
+		name     string
+		ref      providerconfigtypes.VaultKeySelector
+		revoked  bool
+		expected string
+		err      string
+		logins   int
+	}{
+		{
+			name:     "kv version 2",
+			ref:      providerconfigtypes.VaultKeySelector{Path: "secret/data/hetzner", Key: "token"},
+			expected: "kv2-token",
+			logins:   1,
+		},
+		{
+			name:     "kv version 1 with the cached token",
+			ref:      providerconfigtypes.VaultKeySelector{Path: "kv/hetzner", Key: "token"},
+			expected: "kv1-token",
+			logins:   1,
+		},
+		{
+			name:   "missing key",
+			ref:    providerconfigtypes.VaultKeySelector{Path: "kv/hetzner", Key: "password"},
+			err:    "error retrieving key 'password' of vault secret 'kv/hetzner': 'secret has no key 'password''",
+			logins: 1,
+		},
+		{
+			name:   "unknown role",
+			ref:    providerconfigtypes.VaultKeySelector{Path: "kv/hetzner", Key: "token", Role: "other"},
+			err:    "error retrieving key 'token' of vault secret 'kv/hetzner': 'failed to log in with role 'other': vault returned status 403: permission denied'",
+			logins: 1,
+		},
+		{
+			name:    "revoked token",
+			ref:     providerconfigtypes.VaultKeySelector{Path: "kv/hetzner", Key: "token"},
+			revoked: true,
+			err:     "error retrieving key 'token' of vault secret 'kv/hetzner': 'vault returned status 403: permission denied'",
+			logins:  1,
+		},
+		{
+			name:     "login after a revoked token",
+			ref:      providerconfigtypes.VaultKeySelector{Path: "kv/hetzner", Key: "token"},
+			expected: "kv1-token",
+			logins:   2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server.revoked = test.revoked
+			value, err := newTestResolver().GetConfigVarStringValue(providerconfigtypes.ConfigVarString{VaultKeyRef: test.ref})
+			if test.err != "" || err != nil {
+				if fmt.Sprint(err) != test.err {
+					t.Fatalf("Expected error to be\n%v\ninstead got\n%v", test.err, err)
+				}
+			}
+			if value != test.expected {
+				t.Errorf("expected value %q, but got %q", test.expected, value)
+			}
+			if server.logins != test.logins {
+				t.Errorf("expected %d logins, but got %d", test.logins, server.logins)
+			}
+		})
+	}
+}
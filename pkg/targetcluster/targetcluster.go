@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package targetcluster provides access to the cluster the nodes of the machines join,
+// which may differ from the cluster the machines are stored in.
+package targetcluster
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Cluster holds the clients of the target cluster. Nodes, bootstrap tokens and
+// certificate signing requests live in it, machines in the cluster of the manager.
+type Cluster struct {
+	Config     *rest.Config
+	Client     ctrlruntimeclient.Client
+	KubeClient kubernetes.Interface
+
+	// cache is nil if the target cluster is the cluster of the manager
+	cache cache.Cache
+	// informers serve the reads of Client, from cache or the cache of the manager
+	informers cache.Informers
+}
+
+// New returns the target cluster for the given config, which is the cluster of the manager if cfg is nil.
+// The cache of a separate target cluster is started by the manager.
+func New(mgr manager.Manager, cfg *rest.Config, syncPeriod time.Duration) (*Cluster, error) {
+	if cfg == nil {
+		kubeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
+		}
+		return &Cluster{Config: mgr.GetConfig(), Client: mgr.GetClient(), KubeClient: kubeClient, informers: mgr.GetCache()}, nil
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client for the target cluster: %v", err)
+	}
+	targetCache, err := cache.New(cfg, cache.Options{Scheme: mgr.GetScheme(), Resync: &syncPeriod})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache for the target cluster: %v", err)
+	}
+	if err := mgr.Add(targetCache); err != nil {
+		return nil, fmt.Errorf("failed to add the cache of the target cluster to the manager: %v", err)
+	}
+	directClient, err := ctrlruntimeclient.New(cfg, ctrlruntimeclient.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for the target cluster: %v", err)
+	}
+
+	// Reads are served from the cache like the client of the manager does
+	client := &ctrlruntimeclient.DelegatingClient{
+		Reader: &ctrlruntimeclient.DelegatingReader{
+			CacheReader:  targetCache,
+			ClientReader: directClient,
+		},
+		Writer:       directClient,
+		StatusClient: directClient,
+	}
+	return &Cluster{Config: cfg, Client: client, KubeClient: kubeClient, cache: targetCache, informers: targetCache}, nil
+}
+
+// Source returns the source to watch objects of the given type in the target cluster with.
+func (c *Cluster) Source(obj runtime.Object) (source.Source, error) {
+	if c.cache == nil {
+		return &source.Kind{Type: obj}, nil
+	}
+	informer, err := c.cache.GetInformer(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get informer for %T in the target cluster: %v", obj, err)
+	}
+	return &source.Informer{Informer: informer}, nil
+}
+
+// Informer returns the informer the reads of objects of the given type in the target cluster are served from.
+// Event handlers can be added to it at any time, unlike indexers, which must be added before the cache starts.
+func (c *Cluster) Informer(obj runtime.Object) (cache.Informer, error) {
+	informer, err := c.informers.GetInformer(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get informer for %T in the target cluster: %v", obj, err)
+	}
+	return informer, nil
+}
+
+// WaitForCacheSync waits until the cache of a separate target cluster is synced.
+func (c *Cluster) WaitForCacheSync(stop <-chan struct{}) bool {
+	if c.cache == nil {
+		return true
+	}
+	return c.cache.WaitForCacheSync(stop)
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// exportInterval is the interval in which the queued spans get exported
+	exportInterval = 5 * time.Second
+	// maxBatchSize is the number of queued spans which get exported without waiting for the interval
+	maxBatchSize = 512
+	// maxQueueSize is the number of spans which get queued at most, further spans are dropped while
+	// the collector is unreachable
+	maxQueueSize = 4 * maxBatchSize
+
+	// OTLP span kind and status codes
+	spanKindInternal = 1
+	statusCodeOK     = 1
+	statusCodeError  = 2
+)
+
+// otlpExporter exports spans in batches to an OpenTelemetry collector with the JSON encoding of OTLP/HTTP
+type otlpExporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+
+	queue chan *Span
+	done  chan struct{}
+}
+
+func newOTLPExporter(endpoint, serviceName string) (*otlpExporter, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the OTLP endpoint: %v", err)
+	}
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+		return nil, fmt.Errorf("the OTLP endpoint must be an http or https URL, got %q", endpoint)
+	}
+	if !strings.HasSuffix(endpointURL.Path, "/v1/traces") {
+		endpointURL.Path = strings.TrimSuffix(endpointURL.Path, "/") + "/v1/traces"
+	}
+
+	e := &otlpExporter{
+		url:         endpointURL.String(),
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan *Span, maxQueueSize),
+		done:        make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+func (e *otlpExporter) export(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		klog.V(4).Infof("Dropping span %q, the queue of spans to export is full", span.name)
+	}
+}
+
+// shutdown exports the queued spans and waits until they got exported
+func (e *otlpExporter) shutdown() {
+	close(e.queue)
+	<-e.done
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case span, ok := <-e.queue:
+			if !ok {
+				e.send(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= maxBatchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		}
+	}
+}
+
+func (e *otlpExporter) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		klog.Errorf("Failed to marshal %d spans: %v", len(batch), err)
+		return
+	}
+	response, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		klog.Errorf("Failed to export %d spans: %v", len(batch), err)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		klog.Errorf("Failed to export %d spans: the collector responded with status code %d", len(batch), response.StatusCode)
+	}
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *otlpExporter) request(batch []*Span) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		s := otlpSpan{
+			TraceID:           span.traceID,
+			SpanID:            span.spanID,
+			ParentSpanID:      span.parentSpanID,
+			Name:              span.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: statusCodeOK},
+		}
+		for key, value := range span.attributes {
+			s.Attributes = append(s.Attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+		}
+		if span.err != "" {
+			s.Status = otlpStatus{Code: statusCodeError, Message: span.err}
+		}
+		spans = append(spans, s)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: e.serviceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/kubermatic/machine-controller"},
+			Spans: spans,
+		}},
+	}}}
+}
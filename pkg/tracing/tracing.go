@@ -0,0 +1,151 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing records spans of the reconciliations of machines and exports them to an
+// OpenTelemetry collector, so the latency of provisioning can be broken down into its steps.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type spanContextKey struct{}
+
+var (
+	exporterLock sync.RWMutex
+	exporter     *otlpExporter
+)
+
+// Setup exports the spans to the OTLP/HTTP endpoint of an OpenTelemetry collector, e.g.
+// http://otel-collector:4318. Tracing is disabled if the endpoint is empty.
+func Setup(endpoint, serviceName string) error {
+	if endpoint == "" {
+		return nil
+	}
+	e, err := newOTLPExporter(endpoint, serviceName)
+	if err != nil {
+		return err
+	}
+
+	exporterLock.Lock()
+	defer exporterLock.Unlock()
+	exporter = e
+	return nil
+}
+
+// Shutdown exports the spans which were not exported yet and disables tracing
+func Shutdown() {
+	exporterLock.Lock()
+	e := exporter
+	exporter = nil
+	exporterLock.Unlock()
+
+	if e != nil {
+		e.shutdown()
+	}
+}
+
+func currentExporter() *otlpExporter {
+	exporterLock.RLock()
+	defer exporterLock.RUnlock()
+	return exporter
+}
+
+// Span is a step of a reconciliation. All its methods can be called on a nil span, which
+// Start returns if tracing is disabled.
+type Span struct {
+	name         string
+	traceID      string
+	spanID       string
+	parentSpanID string
+	start        time.Time
+	end          time.Time
+	attributes   map[string]string
+	err          string
+
+	exporter *otlpExporter
+}
+
+// Start starts a span with the given name, which is a child of the span of the given context if
+// it has one. The returned context holds the new span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	e := currentExporter()
+	if e == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		name:       name,
+		spanID:     randomID(8),
+		start:      time.Now(),
+		attributes: map[string]string{},
+		exporter:   e,
+	}
+	if parent, ok := ctx.Value(spanContextKey{}).(*Span); ok && parent != nil {
+		span.traceID = parent.traceID
+		span.parentSpanID = parent.spanID
+	} else {
+		span.traceID = randomID(16)
+	}
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// TraceID returns the id of the trace of the span of the given context, or an empty string if it
+// has none, e.g. because tracing is disabled
+func TraceID(ctx context.Context) string {
+	if span, ok := ctx.Value(spanContextKey{}).(*Span); ok && span != nil {
+		return span.traceID
+	}
+	return ""
+}
+
+// SetAttribute records an attribute of the span, e.g. the name of the machine
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.attributes[key] = value
+}
+
+// End ends the span and queues it for the export. The span is marked as failed if err is not nil,
+// its message must not contain credentials.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.exporter.export(s)
+}
+
+func randomID(length int) string {
+	id := make([]byte, length)
+	// crypto/rand only fails if the system has no source of randomness, the id is still unique
+	// enough for the correlation of spans then
+	if _, err := rand.Read(id); err != nil {
+		now := time.Now().UnixNano()
+		for i := range id {
+			id[i] = byte(now >> (8 * uint(i%8)))
+		}
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartWithoutSetup(t *testing.T) {
+	ctx := context.Background()
+	spanCtx, span := Start(ctx, "Reconcile")
+	if span != nil {
+		t.Fatalf("expected no span without an exporter")
+	}
+	if spanCtx != ctx {
+		t.Errorf("expected the context to be returned unchanged")
+	}
+	// Must not panic
+	span.SetAttribute("machine", "default/test")
+	span.End(errors.New("failed"))
+}
+
+func TestExport(t *testing.T) {
+	requests := make(chan otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("expected the spans to be sent to /v1/traces, got %s", r.URL.Path)
+		}
+		request := otlpRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		requests <- request
+	}))
+	defer server.Close()
+
+	if err := Setup(server.URL, "machine-controller"); err != nil {
+		t.Fatalf("failed to set up tracing: %v", err)
+	}
+	ctx, parent := Start(context.Background(), "Reconcile")
+	parent.SetAttribute("machine", "default/test")
+	_, child := Start(ctx, "Create")
+	child.End(errors.New("quota exceeded"))
+	parent.End(nil)
+	Shutdown()
+
+	request := <-requests
+	if len(request.ResourceSpans) != 1 || len(request.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("expected a single batch of spans, got %+v", request)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	exportedChild, exportedParent := spans[0], spans[1]
+	if exportedChild.TraceID != exportedParent.TraceID || exportedChild.ParentSpanID != exportedParent.SpanID {
+		t.Errorf("expected the Create span to be a child of the Reconcile span, got %+v and %+v", exportedChild, exportedParent)
+	}
+	if exportedChild.Status.Code != statusCodeError || exportedChild.Status.Message != "quota exceeded" {
+		t.Errorf("expected the Create span to have failed, got status %+v", exportedChild.Status)
+	}
+	if len(exportedParent.Attributes) != 1 || exportedParent.Attributes[0].Value.StringValue != "default/test" {
+		t.Errorf("expected the Reconcile span to have the machine attribute, got %+v", exportedParent.Attributes)
+	}
+
+	if _, span := Start(context.Background(), "Reconcile"); span != nil {
+		t.Errorf("expected no span after the shutdown")
+	}
+}
+
+func TestSetupInvalidEndpoint(t *testing.T) {
+	if err := Setup("otel-collector:4318", "machine-controller"); err == nil {
+		t.Errorf("expected an endpoint without scheme to be rejected")
+	}
+}
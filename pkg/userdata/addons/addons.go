@@ -0,0 +1,291 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package addons is the registry of the node agents which can be installed on nodes by name, through
+// the files and systemd units of the providerSpec
+package addons
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+// addOn is a node agent which gets installed by the files and systemd units it adds to the providerSpec
+type addOn struct {
+	// operatingSystems the add-on can be installed on, all but Windows if empty
+	operatingSystems []providerconfigtypes.OperatingSystem
+	// settings are the defaults of the settings of the add-on, the ones without default are required
+	settings map[string]string
+	files    []providerconfigtypes.File
+	units    []providerconfigtypes.SystemdUnit
+}
+
+// kubeletKubeconfigs are the kubeconfigs of the kubelet by bootstrap flavor, which node agents reporting
+// to the apiserver use
+var kubeletKubeconfigs = map[providerconfigtypes.BootstrapFlavor]string{
+	providerconfigtypes.BootstrapFlavorKubeadm: "/var/lib/kubelet/kubeconfig",
+	providerconfigtypes.BootstrapFlavorK0s:     "/var/lib/k0s/kubelet.conf",
+}
+
+var registry = map[string]addOn{
+	"node-problem-detector": {
+		settings: map[string]string{"version": "v0.8.14"},
+		files: []providerconfigtypes.File{
+			{
+				Path:        "/opt/bin/install-node-problem-detector",
+				Permissions: "0755",
+				Content: providerconfigtypes.ConfigVarString{Value: `#!/bin/bash
+set -xeuo pipefail
+if [ -x /opt/node-problem-detector/bin/node-problem-detector ]; then
+  exit 0
+fi
+arch=$(uname -m | sed -e 's/x86_64/amd64/' -e 's/aarch64/arm64/')
+mkdir -p /opt/node-problem-detector
+curl -fsSL "https://github.com/kubernetes/node-problem-detector/releases/download/{{ .version }}/node-problem-detector-{{ .version }}-linux_${arch}.tar.gz" \
+  | tar -xz -C /opt/node-problem-detector
+`},
+			},
+		},
+		units: []providerconfigtypes.SystemdUnit{
+			{
+				Name: "node-problem-detector.service",
+				Content: providerconfigtypes.ConfigVarString{Value: `[Unit]
+Description=Node problem detector
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Restart=always
+RestartSec=10
+ExecStartPre=/opt/bin/install-node-problem-detector
+ExecStart=/opt/node-problem-detector/bin/node-problem-detector \
+  --apiserver-override="https://kubernetes.default?inClusterConfig=false&auth={{ .kubeconfig }}" \
+  --config.system-log-monitor=/opt/node-problem-detector/config/kernel-monitor.json,/opt/node-problem-detector/config/systemd-monitor.json
+
+[Install]
+WantedBy=multi-user.target
+`},
+			},
+		},
+	},
+	"amazon-ssm-agent": {
+		operatingSystems: []providerconfigtypes.OperatingSystem{
+			providerconfigtypes.OperatingSystemUbuntu,
+			providerconfigtypes.OperatingSystemCentOS,
+			providerconfigtypes.OperatingSystemRHEL,
+			providerconfigtypes.OperatingSystemRockyLinux,
+			providerconfigtypes.OperatingSystemAlmaLinux,
+			providerconfigtypes.OperatingSystemAmazonLinux2023,
+			providerconfigtypes.OperatingSystemSLES,
+			providerconfigtypes.OperatingSystemOpenSUSE,
+		},
+		files: []providerconfigtypes.File{
+			{
+				Path:        "/opt/bin/install-amazon-ssm-agent",
+				Permissions: "0755",
+				Content: providerconfigtypes.ConfigVarString{Value: `#!/bin/bash
+set -xeuo pipefail
+# Amazon Linux ships the agent, Ubuntu images on AWS ship it as a snap
+if systemctl list-unit-files amazon-ssm-agent.service snap.amazon-ssm-agent.amazon-ssm-agent.service | grep -q amazon-ssm-agent; then
+  exit 0
+fi
+arch=$(uname -m | sed -e 's/x86_64/amd64/' -e 's/aarch64/arm64/')
+url="https://s3.amazonaws.com/ec2-downloads-windows/SSMAgent/latest/linux_${arch}"
+if command -v dpkg >/dev/null; then
+  curl -fsSL -o /tmp/amazon-ssm-agent.deb "${url}/amazon-ssm-agent.deb"
+  dpkg -i /tmp/amazon-ssm-agent.deb
+  rm -f /tmp/amazon-ssm-agent.deb
+else
+  rpm -U --replacepkgs "${url}/amazon-ssm-agent.rpm"
+fi
+systemctl enable --now amazon-ssm-agent
+`},
+			},
+		},
+		units: []providerconfigtypes.SystemdUnit{
+			{
+				Name: "install-amazon-ssm-agent.service",
+				Content: providerconfigtypes.ConfigVarString{Value: `[Unit]
+Description=Install the AWS Systems Manager agent
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=true
+ExecStart=/opt/bin/install-amazon-ssm-agent
+
+[Install]
+WantedBy=multi-user.target
+`},
+			},
+		},
+	},
+	"elastic-agent": {
+		settings: map[string]string{"version": "8.11.4", "url": "", "enrollmentToken": ""},
+		files: []providerconfigtypes.File{
+			{
+				Path:        "/opt/bin/install-elastic-agent",
+				Permissions: "0700",
+				Content: providerconfigtypes.ConfigVarString{Value: `#!/bin/bash
+set -euo pipefail
+if [ -x /opt/Elastic/Agent/elastic-agent ]; then
+  exit 0
+fi
+arch=$(uname -m | sed -e 's/aarch64/arm64/')
+curl -fsSL "https://artifacts.elastic.co/downloads/beats/elastic-agent/elastic-agent-{{ .version }}-linux-${arch}.tar.gz" \
+  | tar -xz -C /tmp
+/tmp/elastic-agent-{{ .version }}-linux-${arch}/elastic-agent install --non-interactive \
+  --url={{ .url | printf "%q" }} --enrollment-token={{ .enrollmentToken | printf "%q" }}
+rm -rf /tmp/elastic-agent-{{ .version }}-linux-${arch}
+`},
+			},
+		},
+		units: []providerconfigtypes.SystemdUnit{
+			{
+				Name: "install-elastic-agent.service",
+				Content: providerconfigtypes.ConfigVarString{Value: `[Unit]
+Description=Install and enroll the Elastic agent
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=true
+ExecStart=/opt/bin/install-elastic-agent
+
+[Install]
+WantedBy=multi-user.target
+`},
+			},
+		},
+	},
+}
+
+// Names returns the sorted names of the add-ons of the registry
+func Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate returns an error if the given add-on is not in the registry, can't be installed on the operating
+// system or lacks a required setting
+func Validate(config providerconfigtypes.AddOn, os providerconfigtypes.OperatingSystem) error {
+	addOn, found := registry[config.Name]
+	if !found {
+		return fmt.Errorf("unknown add-on %q", config.Name)
+	}
+	if !addOn.supports(os) {
+		return fmt.Errorf("add-on %q is not supported on %s", config.Name, os)
+	}
+	for name := range config.Settings {
+		if _, found := addOn.settings[name]; !found {
+			return fmt.Errorf("unknown setting %q of add-on %q", name, config.Name)
+		}
+	}
+	for name, defaultValue := range addOn.settings {
+		if _, found := config.Settings[name]; !found && defaultValue == "" {
+			return fmt.Errorf("setting %q of add-on %q is required", name, config.Name)
+		}
+	}
+	return nil
+}
+
+func (a addOn) supports(os providerconfigtypes.OperatingSystem) bool {
+	if os == providerconfigtypes.OperatingSystemWindows {
+		return false
+	}
+	if len(a.operatingSystems) == 0 {
+		return true
+	}
+	for _, supported := range a.operatingSystems {
+		if supported == os {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply adds the files and systemd units of the add-ons of the given config to it. The settings of the
+// add-ons must have been resolved already, as they are rendered into the files and units.
+func Apply(config *providerconfigtypes.Config, flavor providerconfigtypes.BootstrapFlavor) error {
+	files := append([]providerconfigtypes.File{}, config.Files...)
+	units := append([]providerconfigtypes.SystemdUnit{}, config.SystemdUnits...)
+	for _, addOnConfig := range config.AddOns {
+		if err := Validate(addOnConfig, config.OperatingSystem); err != nil {
+			return err
+		}
+		addOn := registry[addOnConfig.Name]
+
+		settings := map[string]string{"kubeconfig": kubeletKubeconfigs[flavor]}
+		for name, value := range addOn.settings {
+			settings[name] = value
+		}
+		for name, value := range addOnConfig.Settings {
+			settings[name] = value.Value
+		}
+
+		for _, file := range addOn.files {
+			for _, existing := range files {
+				if existing.Path == file.Path {
+					return fmt.Errorf("file %s of add-on %q is already set", file.Path, addOnConfig.Name)
+				}
+			}
+			content, err := render(file.Content.Value, settings)
+			if err != nil {
+				return fmt.Errorf("failed to render file %s of add-on %q: %v", file.Path, addOnConfig.Name, err)
+			}
+			file.Content = providerconfigtypes.ConfigVarString{Value: content}
+			files = append(files, file)
+		}
+		for _, unit := range addOn.units {
+			for _, existing := range units {
+				if existing.Name == unit.Name {
+					return fmt.Errorf("systemd unit %s of add-on %q is already set", unit.Name, addOnConfig.Name)
+				}
+			}
+			content, err := render(unit.Content.Value, settings)
+			if err != nil {
+				return fmt.Errorf("failed to render systemd unit %s of add-on %q: %v", unit.Name, addOnConfig.Name, err)
+			}
+			unit.Content = providerconfigtypes.ConfigVarString{Value: content}
+			units = append(units, unit)
+		}
+	}
+	config.Files = files
+	config.SystemdUnits = units
+	return nil
+}
+
+func render(text string, settings map[string]string) (string, error) {
+	tmpl, err := template.New("addon").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, settings); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
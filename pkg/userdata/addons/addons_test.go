@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		addOn providerconfigtypes.AddOn
+		os    providerconfigtypes.OperatingSystem
+		err   error
+	}{
+		{
+			name:  "defaults",
+			addOn: providerconfigtypes.AddOn{Name: "node-problem-detector"},
+			os:    providerconfigtypes.OperatingSystemFlatcar,
+		},
+		{
+			name:  "unknown add-on",
+			addOn: providerconfigtypes.AddOn{Name: "datadog-agent"},
+			os:    providerconfigtypes.OperatingSystemUbuntu,
+			err:   fmt.Errorf(`unknown add-on "datadog-agent"`),
+		},
+		{
+			name:  "unsupported operating system",
+			addOn: providerconfigtypes.AddOn{Name: "amazon-ssm-agent"},
+			os:    providerconfigtypes.OperatingSystemFlatcar,
+			err:   fmt.Errorf(`add-on "amazon-ssm-agent" is not supported on flatcar`),
+		},
+		{
+			name: "unknown setting",
+			addOn: providerconfigtypes.AddOn{
+				Name:     "node-problem-detector",
+				Settings: map[string]providerconfigtypes.ConfigVarString{"image": {Value: "npd"}},
+			},
+			os:  providerconfigtypes.OperatingSystemUbuntu,
+			err: fmt.Errorf(`unknown setting "image" of add-on "node-problem-detector"`),
+		},
+		{
+			name: "missing setting",
+			addOn: providerconfigtypes.AddOn{
+				Name:     "elastic-agent",
+				Settings: map[string]providerconfigtypes.ConfigVarString{"url": {Value: "https://fleet.example.com"}},
+			},
+			os:  providerconfigtypes.OperatingSystemUbuntu,
+			err: fmt.Errorf(`setting "enrollmentToken" of add-on "elastic-agent" is required`),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.addOn, test.os)
+			if fmt.Sprint(err) != fmt.Sprint(test.err) {
+				t.Errorf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	config := &providerconfigtypes.Config{
+		OperatingSystem: providerconfigtypes.OperatingSystemUbuntu,
+		Files:           []providerconfigtypes.File{{Path: "/etc/motd"}},
+		AddOns: []providerconfigtypes.AddOn{
+			{Name: "node-problem-detector"},
+			{
+				Name: "elastic-agent",
+				Settings: map[string]providerconfigtypes.ConfigVarString{
+					"url":             {Value: "https://fleet.example.com"},
+					"enrollmentToken": {Value: "secret"},
+				},
+			},
+		},
+	}
+	if err := Apply(config, providerconfigtypes.BootstrapFlavorK0s); err != nil {
+		t.Fatalf("failed to apply add-ons: %v", err)
+	}
+
+	if len(config.Files) != 3 || len(config.SystemdUnits) != 2 {
+		t.Fatalf("expected 3 files and 2 systemd units, got %d files and %d systemd units", len(config.Files), len(config.SystemdUnits))
+	}
+	if unit := config.SystemdUnits[0].Content.Value; !strings.Contains(unit, "auth=/var/lib/k0s/kubelet.conf") {
+		t.Errorf("expected node-problem-detector to use the kubeconfig of the k0s kubelet, got\n%s", unit)
+	}
+	if script := config.Files[2].Content.Value; !strings.Contains(script, `--url="https://fleet.example.com" --enrollment-token="secret"`) {
+		t.Errorf("expected the settings in the install script of elastic-agent, got\n%s", script)
+	}
+
+	if err := Apply(config, providerconfigtypes.BootstrapFlavorK0s); err == nil {
+		t.Errorf("expected an error when applying the add-ons twice")
+	}
+}
@@ -22,7 +22,6 @@ package centos
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"text/template"
 
@@ -62,10 +61,6 @@ func (p Provider) UserData(req plugin.UserDataRequest) (string, error) {
 		req.CloudConfig = *pconfig.OverwriteCloudConfig
 	}
 
-	if pconfig.Network != nil {
-		return "", errors.New("static IP config is not supported with CentOS")
-	}
-
 	centosConfig, err := LoadConfig(pconfig.OperatingSystemSpec)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse OperatingSystemSpec: '%v'", err)
@@ -105,7 +100,7 @@ func (p Provider) UserData(req plugin.UserDataRequest) (string, error) {
 		ServerAddr:       serverAddr,
 		Kubeconfig:       kubeconfigString,
 		KubernetesCACert: kubernetesCACert,
-		NodeIPScript:     userdatahelper.SetupNodeIPEnvScript(),
+		NodeIPScript:     userdatahelper.SetupNodeIPEnvScript(pconfig.NodeNetwork),
 	}
 	b := &bytes.Buffer{}
 	err = tmpl.Execute(b, data)
@@ -127,7 +122,15 @@ package_upgrade: true
 package_reboot_if_required: true
 {{- end }}
 
-ssh_pwauth: no
+ssh_pwauth: {{ sshPasswordAuthentication .ProviderSpec.SSH }}
+{{- with .ProviderSpec.SSH }}
+{{- if .User }}
+
+system_info:
+  default_user:
+    name: "{{ .User }}"
+{{- end }}
+{{- end }}
 
 {{- if ne (len .ProviderSpec.SSHPublicKeys) 0 }}
 ssh_authorized_keys:
@@ -146,6 +149,17 @@ write_files:
 - path: "/etc/systemd/journald.conf.d/max_disk_use.conf"
   content: |
 {{ journalDConfig | indent 4 }}
+{{- with .ProviderSpec.Network }}
+
+- path: "/etc/NetworkManager/system-connections/static-nic.nmconnection"
+  permissions: "0600"
+  content: |
+{{ networkManagerKeyfile . | indent 4 }}
+
+- path: "/etc/cloud/cloud.cfg.d/99-machine-controller-network.cfg"
+  content: |
+    network: {config: disabled}
+{{- end }}
 
 - path: "/opt/load-kernel-modules.sh"
   permissions: "0755"
@@ -155,6 +169,25 @@ write_files:
 - path: "/etc/sysctl.d/k8s.conf"
   content: |
 {{ kernelSettings | indent 4 }}
+{{- with .ProviderSpec.Kernel }}
+{{- if .Modules }}
+
+- path: "/etc/modules-load.d/machine-controller.conf"
+  content: |
+{{- range .Modules }}
+    {{ . }}
+{{- end }}
+{{- end }}
+{{- if .Sysctls }}
+{{- /* Sorts after k8s.conf to override its settings */}}
+
+- path: "/etc/sysctl.d/machine-controller.conf"
+  content: |
+{{- range $name, $value := .Sysctls }}
+    {{ $name }} = {{ $value }}
+{{- end }}
+{{- end }}
+{{- end }}
 
 - path: /etc/selinux/config
   content: |
@@ -169,12 +202,38 @@ write_files:
     #     minimum - Modification of targeted policy. Only selected processes are protected.
     #     mls - Multi Level Security protection.
     SELINUXTYPE=targeted
+{{- if eq .ProviderSpec.Hardening "cis" }}
+
+- path: "/etc/sysctl.d/99-cis.conf"
+  content: |
+{{ cisSysctlSettings | indent 4 }}
+
+- path: "/etc/modprobe.d/cis.conf"
+  content: |
+{{ cisModprobeConfig | indent 4 }}
+
+- path: "/etc/audit/rules.d/cis.rules"
+  permissions: "0640"
+  content: |
+{{ cisAuditRules "/etc/selinux/" "/usr/share/selinux/" | indent 4 }}
+
+- path: "/etc/ssh/sshd_config.cis"
+  permissions: "0600"
+  content: |
+{{ cisSSHDConfig | indent 4 }}
+{{- end }}
 
 - path: "/opt/bin/setup"
   permissions: "0755"
   content: |
     #!/bin/bash
     set -xeuo pipefail
+{{- if .ProviderSpec.Network }}
+
+    # the static address takes precedence over the DHCP configuration cloud-init generated
+    nmcli connection reload
+    nmcli connection up static-nic
+{{- end }}
 
     setenforce 0 || true
 
@@ -182,9 +241,15 @@ write_files:
     systemctl restart systemd-modules-load.service
     sysctl --system
 
+{{- if .ProviderSpec.Swap }}
+{{- /* The kubelet runs with failSwapOn disabled, see its configuration */}}
+
+{{ swapfileScript .ProviderSpec.Swap | indent 4 }}
+{{- else }}
 {{- /* Make sure we always disable swap - Otherwise the kubelet won't start */}}
     sed -i.orig '/.*swap.*/d' /etc/fstab
     swapoff -a
+{{- end }}
     {{ if ne .CloudProviderName "aws" }}
 {{- /*  The normal way of setting it via cloud-init is broken, see */}}
 {{- /*  https://bugs.launchpad.net/cloud-init/+bug/1662542 */}}
@@ -213,11 +278,32 @@ write_files:
       wget \
       curl \
       yum-plugin-versionlock \
+      {{- if eq .ProviderSpec.Hardening "cis" }}
+      audit \
+      {{- end }}
       {{- if eq .CloudProviderName "vsphere" }}
       open-vm-tools \
       {{- end }}
       ipvsadm
     yum versionlock add docker-ce-*
+{{- if eq .ProviderSpec.Hardening "cis" }}
+
+{{ cisHardeningScript | indent 4 }}
+{{- end }}
+{{- with .ProviderSpec.UpdatePolicy }}
+
+{{ updatePolicyScript "centos" . | indent 4 }}
+{{- end }}
+{{- with .ProviderSpec.SSH }}
+{{- if .Disabled }}
+
+    systemctl disable --now sshd
+{{- end }}
+{{- end }}
+{{- with .ProviderSpec.GPU }}
+
+{{ gpuDriverScript "centos" . | indent 4 }}
+{{- end }}
 
 {{ safeDownloadBinariesScript .KubeletVersion | indent 4 }}
     # set kubelet nodeip environment variable
@@ -231,6 +317,34 @@ write_files:
     systemctl enable --now kubelet
     systemctl enable --now --no-block kubelet-healthcheck.service
     systemctl enable --now --no-block docker-healthcheck.service
+{{- if .ProviderSpec.SystemdUnits }}
+
+    systemctl daemon-reload
+{{- range .ProviderSpec.SystemdUnits }}
+    systemctl enable --now {{ .Name }}
+{{- end }}
+{{- end }}
+{{- range .ProviderSpec.Files }}
+
+- path: "{{ .Path }}"
+  permissions: "{{ .Permissions | default "0644" }}"
+  content: |
+{{ .Content.Value | indent 4 }}
+{{- end }}
+{{- range .ProviderSpec.StaticPods }}
+
+- path: "/etc/kubernetes/manifests/{{ .Name }}.yaml"
+  permissions: "0600"
+  content: |
+{{ .Manifest.Value | indent 4 }}
+{{- end }}
+{{- range .ProviderSpec.SystemdUnits }}
+
+- path: "/etc/systemd/system/{{ .Name }}"
+  permissions: "0644"
+  content: |
+{{ .Content.Value | indent 4 }}
+{{- end }}
 
 - path: "/opt/bin/supervise.sh"
   permissions: "0755"
@@ -243,7 +357,7 @@ write_files:
 
 - path: "/etc/systemd/system/kubelet.service"
   content: |
-{{ kubeletSystemdUnit .KubeletVersion .CloudProviderName .MachineSpec.Name .DNSIPs .ExternalCloudProvider .PauseImage .MachineSpec.Taints | indent 4 }}
+{{ kubeletSystemdUnit .KubeletVersion .CloudProviderName .MachineSpec.Name .DNSIPs .ExternalCloudProvider .PauseImage .MachineSpec.Taints .ProviderSpec.Kubelet | indent 4 }}
 
 - path: "/etc/kubernetes/cloud-config"
   permissions: "0600"
@@ -262,7 +376,7 @@ write_files:
 
 - path: "/etc/kubernetes/kubelet.conf"
   content: |
-{{ kubeletConfiguration "cluster.local" .DNSIPs .KubeletFeatureGates | indent 4 }}
+{{ kubeletConfiguration "cluster.local" .DNSIPs .KubeletFeatureGates .ProviderSpec.Kubelet .ProviderSpec.Swap | indent 4 }}
 
 - path: "/etc/kubernetes/pki/ca.crt"
   content: |
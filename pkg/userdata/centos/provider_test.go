@@ -21,12 +21,14 @@ limitations under the License.
 package centos
 
 import (
+	"encoding/json"
 	"flag"
 	"net"
 	"testing"
 
 	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
 	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 	testhelper "github.com/kubermatic/machine-controller/pkg/test"
 	"github.com/kubermatic/machine-controller/pkg/userdata/convert"
 
@@ -89,6 +91,9 @@ type userDataTestCase struct {
 	insecureRegistries    []string
 	registryMirrors       []string
 	pauseImage            string
+	hardening             providerconfigtypes.HardeningProfile
+	swap                  *providerconfigtypes.SwapSettings
+	ssh                   *providerconfigtypes.SSHSettings
 }
 
 // TestUserDataGeneration runs the data generation for different
@@ -172,6 +177,42 @@ func TestUserDataGeneration(t *testing.T) {
 			registryMirrors:   []string{"https://registry.docker-cn.com"},
 			pauseImage:        "192.168.100.100:5000/kubernetes/pause:v3.1",
 		},
+		{
+			name: "kubelet-v1.17-aws-cis-hardening",
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "1.17.3",
+				},
+			},
+			hardening: providerconfigtypes.HardeningProfileCIS,
+		},
+		{
+			name: "kubelet-v1.17-aws-swap",
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "1.17.3",
+				},
+			},
+			swap: &providerconfigtypes.SwapSettings{
+				Size: "8Gi",
+			},
+		},
+		{
+			name: "kubelet-v1.17-aws-ssh",
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "1.17.3",
+				},
+			},
+			ssh: &providerconfigtypes.SSHSettings{
+				User:                   "admin",
+				PasswordAuthentication: true,
+				Disabled:               true,
+			},
+		},
 	}
 
 	defaultCloudProvider := &fakeCloudConfigProvider{
@@ -203,6 +244,13 @@ func TestUserDataGeneration(t *testing.T) {
 			emtpyProviderSpec := clusterv1alpha1.ProviderSpec{
 				Value: &runtime.RawExtension{},
 			}
+			if test.hardening != "" || test.swap != nil || test.ssh != nil {
+				rawProviderSpec, err := json.Marshal(providerconfigtypes.Config{Hardening: test.hardening, Swap: test.swap, SSH: test.ssh})
+				if err != nil {
+					t.Fatalf("failed to marshal provider spec: %v", err)
+				}
+				emtpyProviderSpec.Value.Raw = rawProviderSpec
+			}
 			test.spec.ProviderSpec = emtpyProviderSpec
 			var cloudProvider *fakeCloudConfigProvider
 			if test.cloudProviderName != nil {
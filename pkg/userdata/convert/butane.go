@@ -0,0 +1,177 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	butaneVariant  = "fcos"
+	butaneVersion  = "1.1.0"
+	ignitionV3Spec = "3.1.0"
+)
+
+// butaneConfig is the subset of the Butane "fcos" variant the userdata plugins make use of.
+type butaneConfig struct {
+	Variant string `json:"variant"`
+	Version string `json:"version"`
+	Passwd  struct {
+		Users []struct {
+			Name              string   `json:"name"`
+			SSHAuthorizedKeys []string `json:"ssh_authorized_keys"`
+		} `json:"users"`
+	} `json:"passwd"`
+	Storage struct {
+		Files []struct {
+			Path      string `json:"path"`
+			Mode      *int   `json:"mode"`
+			Overwrite *bool  `json:"overwrite"`
+			Contents  struct {
+				Inline string `json:"inline"`
+			} `json:"contents"`
+		} `json:"files"`
+	} `json:"storage"`
+	Systemd struct {
+		Units []struct {
+			Name     string  `json:"name"`
+			Enabled  *bool   `json:"enabled"`
+			Mask     *bool   `json:"mask"`
+			Contents *string `json:"contents"`
+			Dropins  []struct {
+				Name     string `json:"name"`
+				Contents string `json:"contents"`
+			} `json:"dropins"`
+		} `json:"units"`
+	} `json:"systemd"`
+}
+
+type ignitionV3Config struct {
+	Ignition struct {
+		Version string `json:"version"`
+	} `json:"ignition"`
+	Passwd  *ignitionV3Passwd  `json:"passwd,omitempty"`
+	Storage *ignitionV3Storage `json:"storage,omitempty"`
+	Systemd *ignitionV3Systemd `json:"systemd,omitempty"`
+}
+
+type ignitionV3Passwd struct {
+	Users []ignitionV3User `json:"users"`
+}
+
+type ignitionV3User struct {
+	Name              string   `json:"name"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+}
+
+type ignitionV3Storage struct {
+	Files []ignitionV3File `json:"files"`
+}
+
+type ignitionV3File struct {
+	Path      string `json:"path"`
+	Mode      *int   `json:"mode,omitempty"`
+	Overwrite *bool  `json:"overwrite,omitempty"`
+	Contents  struct {
+		Source string `json:"source"`
+	} `json:"contents"`
+}
+
+type ignitionV3Systemd struct {
+	Units []ignitionV3Unit `json:"units"`
+}
+
+type ignitionV3Unit struct {
+	Name     string             `json:"name"`
+	Enabled  *bool              `json:"enabled,omitempty"`
+	Mask     *bool              `json:"mask,omitempty"`
+	Contents *string            `json:"contents,omitempty"`
+	Dropins  []ignitionV3Dropin `json:"dropins,omitempty"`
+}
+
+type ignitionV3Dropin struct {
+	Name     string `json:"name"`
+	Contents string `json:"contents"`
+}
+
+// ButaneToIgnition converts a Butane config of the "fcos" variant to an Ignition v3 config.
+// Only the fields used by the userdata plugins are supported, unknown fields are rejected.
+func ButaneToIgnition(s string) (string, error) {
+	cfg := &butaneConfig{}
+	if err := yaml.UnmarshalStrict([]byte(s), cfg); err != nil {
+		return "", fmt.Errorf("failed to parse butane config: %v", err)
+	}
+	if cfg.Variant != butaneVariant || cfg.Version != butaneVersion {
+		return "", fmt.Errorf("unsupported butane config variant %q version %q, only %s %s is supported",
+			cfg.Variant, cfg.Version, butaneVariant, butaneVersion)
+	}
+
+	ignCfg := &ignitionV3Config{}
+	ignCfg.Ignition.Version = ignitionV3Spec
+
+	if len(cfg.Passwd.Users) > 0 {
+		ignCfg.Passwd = &ignitionV3Passwd{}
+		for _, user := range cfg.Passwd.Users {
+			ignCfg.Passwd.Users = append(ignCfg.Passwd.Users, ignitionV3User{
+				Name:              user.Name,
+				SSHAuthorizedKeys: user.SSHAuthorizedKeys,
+			})
+		}
+	}
+
+	if len(cfg.Storage.Files) > 0 {
+		ignCfg.Storage = &ignitionV3Storage{}
+		for _, file := range cfg.Storage.Files {
+			ignFile := ignitionV3File{
+				Path:      file.Path,
+				Mode:      file.Mode,
+				Overwrite: file.Overwrite,
+			}
+			ignFile.Contents.Source = "data:;base64," + base64.StdEncoding.EncodeToString([]byte(file.Contents.Inline))
+			ignCfg.Storage.Files = append(ignCfg.Storage.Files, ignFile)
+		}
+	}
+
+	if len(cfg.Systemd.Units) > 0 {
+		ignCfg.Systemd = &ignitionV3Systemd{}
+		for _, unit := range cfg.Systemd.Units {
+			ignUnit := ignitionV3Unit{
+				Name:     unit.Name,
+				Enabled:  unit.Enabled,
+				Mask:     unit.Mask,
+				Contents: unit.Contents,
+			}
+			for _, dropin := range unit.Dropins {
+				ignUnit.Dropins = append(ignUnit.Dropins, ignitionV3Dropin{
+					Name:     dropin.Name,
+					Contents: dropin.Contents,
+				})
+			}
+			ignCfg.Systemd.Units = append(ignCfg.Systemd.Units, ignUnit)
+		}
+	}
+
+	out, err := json.Marshal(ignCfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ignition config: %v", err)
+	}
+	return string(out), nil
+}
@@ -19,6 +19,9 @@ package convert
 import (
 	"bytes"
 	"compress/gzip"
+	"fmt"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 )
 
 func GzipString(s string) (string, error) {
@@ -39,3 +42,21 @@ func GzipString(s string) (string, error) {
 
 	return b.String(), nil
 }
+
+// GzipCloudInit gzips the given cloud-init userdata. Ignition based operating systems
+// and Windows don't support compressed userdata, so their userdata gets returned unchanged.
+func GzipCloudInit(os providerconfigtypes.OperatingSystem, userdata string) (string, error) {
+	switch os {
+	case providerconfigtypes.OperatingSystemCoreos,
+		providerconfigtypes.OperatingSystemFlatcar,
+		providerconfigtypes.OperatingSystemFedoraCoreOS,
+		providerconfigtypes.OperatingSystemWindows:
+		return userdata, nil
+	}
+
+	out, err := GzipString(userdata)
+	if err != nil {
+		return "", fmt.Errorf("failed to gzip the userdata: %v", err)
+	}
+	return out, nil
+}
@@ -103,7 +103,7 @@ func (p Provider) UserData(req plugin.UserDataRequest) (string, error) {
 		KubernetesCACert:       kubernetesCACert,
 		KubeletVersion:         kubeletVersion.String(),
 		InsecureHyperkubeImage: insecureHyperkubeImage,
-		NodeIPScript:           userdatahelper.SetupNodeIPEnvScript(),
+		NodeIPScript:           userdatahelper.SetupNodeIPEnvScript(pconfig.NodeNetwork),
 	}
 	b := &bytes.Buffer{}
 	err = tmpl.Execute(b, data)
@@ -258,7 +258,7 @@ systemd:
         ExecStartPre=/bin/bash /opt/load-kernel-modules.sh
         ExecStart=/usr/lib/coreos/kubelet-wrapper \
 {{ if semverCompare ">=1.17.0" .KubeletVersion }}{{ print "          kubelet \\\n" }}{{ end -}}
-{{ kubeletFlags .KubeletVersion .CloudProviderName .MachineSpec.Name .DNSIPs .ExternalCloudProvider .PauseImage .MachineSpec.Taints | indent 10 }}
+{{ kubeletFlags .KubeletVersion .CloudProviderName .MachineSpec.Name .DNSIPs .ExternalCloudProvider .PauseImage .MachineSpec.Taints .ProviderSpec.Kubelet | indent 10 }}
         ExecStop=-/usr/bin/rkt stop --uuid-file=/var/cache/kubelet-pod.uuid
         Restart=always
         RestartSec=10
@@ -272,6 +272,13 @@ systemd:
         contents: |
           [Service]
           EnvironmentFile=-/etc/environment
+{{- range .ProviderSpec.SystemdUnits }}
+
+    - name: {{ .Name }}
+      enabled: true
+      contents: |
+{{ .Content.Value | indent 8 }}
+{{- end }}
 
 storage:
   files:
@@ -296,7 +303,7 @@ storage:
       mode: 0644
       contents:
         inline: |
-{{ kubeletConfiguration "cluster.local" .DNSIPs .KubeletFeatureGates | indent 10 }}
+{{ kubeletConfiguration "cluster.local" .DNSIPs .KubeletFeatureGates .ProviderSpec.Kubelet .ProviderSpec.Swap | indent 10 }}
 
     - path: /opt/load-kernel-modules.sh
       filesystem: root
@@ -311,6 +318,31 @@ storage:
       contents:
         inline: |
 {{ kernelSettings | indent 10 }}
+{{- with .ProviderSpec.Kernel }}
+{{- if .Modules }}
+
+    - path: /etc/modules-load.d/machine-controller.conf
+      filesystem: root
+      mode: 0644
+      contents:
+        inline: |
+{{- range .Modules }}
+          {{ . }}
+{{- end }}
+{{- end }}
+{{- if .Sysctls }}
+{{- /* Sorts after k8s.conf to override its settings */}}
+
+    - path: /etc/sysctl.d/machine-controller.conf
+      filesystem: root
+      mode: 0644
+      contents:
+        inline: |
+{{- range $name, $value := .Sysctls }}
+          {{ $name }} = {{ $value }}
+{{- end }}
+{{- end }}
+{{- end }}
 
     - path: /proc/sys/kernel/panic_on_oops
       filesystem: root
@@ -401,4 +433,22 @@ storage:
         inline: |
           #!/bin/bash
           set -xeuo pipefail
-{{ safeDownloadBinariesScript .KubeletVersion | indent 10 }}`
+{{ safeDownloadBinariesScript .KubeletVersion | indent 10 }}
+{{- range .ProviderSpec.Files }}
+
+    - path: "{{ .Path }}"
+      filesystem: root
+      mode: {{ .Permissions | default "0644" }}
+      contents:
+        inline: |
+{{ .Content.Value | indent 10 }}
+{{- end }}
+{{- range .ProviderSpec.StaticPods }}
+
+    - path: "/etc/kubernetes/manifests/{{ .Name }}.yaml"
+      filesystem: root
+      mode: 0600
+      contents:
+        inline: |
+{{ .Manifest.Value | indent 10 }}
+{{- end }}`
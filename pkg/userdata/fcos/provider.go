@@ -0,0 +1,350 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+//
+// UserData plugin for Fedora CoreOS.
+//
+
+package fcos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"text/template"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/userdata/convert"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+)
+
+// Provider is a pkg/userdata/plugin.Provider implementation.
+type Provider struct{}
+
+// UserData renders user-data template to string.
+func (p Provider) UserData(req plugin.UserDataRequest) (string, error) {
+	tmpl, err := template.New("user-data").Funcs(userdatahelper.TxtFuncMap()).Parse(userDataTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse user-data template: %v", err)
+	}
+
+	kubeletVersion, err := semver.NewVersion(req.MachineSpec.Versions.Kubelet)
+	if err != nil {
+		return "", fmt.Errorf("invalid kubelet version: '%v'", err)
+	}
+
+	pconfig, err := providerconfigtypes.GetConfig(req.MachineSpec.ProviderSpec)
+	if err != nil {
+		return "", fmt.Errorf("failed to get provider config: %v", err)
+	}
+
+	if pconfig.OverwriteCloudConfig != nil {
+		req.CloudConfig = *pconfig.OverwriteCloudConfig
+	}
+
+	if pconfig.Network != nil {
+		return "", errors.New("static IP config is not supported with Fedora CoreOS")
+	}
+
+	fcosConfig, err := LoadConfig(pconfig.OperatingSystemSpec)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse OperatingSystemSpec: '%v'", err)
+	}
+
+	serverAddr, err := userdatahelper.GetServerAddressFromKubeconfig(req.Kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("error extracting server address from kubeconfig: %v", err)
+	}
+
+	kubeconfigString, err := userdatahelper.StringifyKubeconfig(req.Kubeconfig)
+	if err != nil {
+		return "", err
+	}
+
+	kubernetesCACert, err := userdatahelper.GetCACert(req.Kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("error extracting cacert: %v", err)
+	}
+
+	data := struct {
+		plugin.UserDataRequest
+		ProviderSpec     *providerconfigtypes.Config
+		OSConfig         *Config
+		KubeletVersion   string
+		ServerAddr       string
+		Kubeconfig       string
+		KubernetesCACert string
+		NodeIPScript     string
+	}{
+		UserDataRequest:  req,
+		ProviderSpec:     pconfig,
+		OSConfig:         fcosConfig,
+		KubeletVersion:   kubeletVersion.String(),
+		ServerAddr:       serverAddr,
+		Kubeconfig:       kubeconfigString,
+		KubernetesCACert: kubernetesCACert,
+		NodeIPScript:     userdatahelper.SetupNodeIPEnvScript(pconfig.NodeNetwork),
+	}
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute user-data template: %v", err)
+	}
+	out, err := userdatahelper.CleanupTemplateOutput(b.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to cleanup user-data template: %v", err)
+	}
+
+	return convert.ButaneToIgnition(out)
+}
+
+// UserData template, a Butane config which gets converted to Ignition.
+const userDataTemplate = `variant: fcos
+version: 1.1.0
+
+{{- if ne (len .ProviderSpec.SSHPublicKeys) 0 }}
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys:
+{{- range .ProviderSpec.SSHPublicKeys }}
+        - "{{ . }}"
+{{- end }}
+{{- end }}
+
+systemd:
+  units:
+{{- if .OSConfig.DisableAutoUpdate }}
+    - name: zincati.service
+      mask: true
+{{- end }}
+
+    - name: setup.service
+      enabled: true
+      contents: |
+        [Install]
+        WantedBy=multi-user.target
+
+        [Unit]
+        Requires=network-online.target
+        After=network-online.target
+
+        [Service]
+        Type=oneshot
+        RemainAfterExit=true
+        EnvironmentFile=-/etc/environment
+        ExecStart=/opt/bin/supervise.sh /opt/bin/setup
+
+    - name: kubelet.service
+      contents: |
+{{ kubeletContainerdSystemdUnit .KubeletVersion .CloudProviderName .MachineSpec.Name .DNSIPs .ExternalCloudProvider .PauseImage .MachineSpec.Taints .ProviderSpec.Kubelet | indent 8 }}
+      dropins:
+{{- /* setup_net_env.sh detects CoreOS and writes the node IP to nodeip.conf instead of a kubelet drop-in */}}
+        - name: 10-nodeip.conf
+          contents: |
+            [Service]
+            EnvironmentFile=/etc/kubernetes/nodeip.conf
+
+    - name: kubelet-healthcheck.service
+      contents: |
+{{ kubeletHealthCheckSystemdUnit | indent 8 }}
+
+    - name: containerd.service
+      dropins:
+        - name: 10-environment.conf
+          contents: |
+            [Service]
+            EnvironmentFile=-/etc/environment
+{{- range .ProviderSpec.SystemdUnits }}
+
+    - name: {{ .Name }}
+      enabled: true
+      contents: |
+{{ .Content.Value | indent 8 }}
+{{- end }}
+
+storage:
+  files:
+{{- if .HTTPProxy }}
+    - path: /etc/environment
+      mode: 0644
+      overwrite: true
+      contents:
+        inline: |
+{{ proxyEnvironment .HTTPProxy .NoProxy | indent 10 }}
+{{- end }}
+
+    - path: /etc/systemd/journald.conf.d/max_disk_use.conf
+      mode: 0644
+      contents:
+        inline: |
+{{ journalDConfig | indent 10 }}
+
+    - path: /opt/load-kernel-modules.sh
+      mode: 0755
+      contents:
+        inline: |
+{{ kernelModulesScript | indent 10 }}
+
+    - path: /etc/modules-load.d/containerd.conf
+      mode: 0644
+      contents:
+        inline: |
+          overlay
+          br_netfilter
+
+    - path: /etc/sysctl.d/k8s.conf
+      mode: 0644
+      contents:
+        inline: |
+{{ kernelSettings | indent 10 }}
+{{- with .ProviderSpec.Kernel }}
+{{- if .Modules }}
+
+    - path: /etc/modules-load.d/machine-controller.conf
+      mode: 0644
+      contents:
+        inline: |
+{{- range .Modules }}
+          {{ . }}
+{{- end }}
+{{- end }}
+{{- if .Sysctls }}
+{{- /* Sorts after k8s.conf to override its settings */}}
+
+    - path: /etc/sysctl.d/machine-controller.conf
+      mode: 0644
+      contents:
+        inline: |
+{{- range $name, $value := .Sysctls }}
+          {{ $name }} = {{ $value }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+    - path: /etc/selinux/config
+      mode: 0644
+      overwrite: true
+      contents:
+        inline: |
+          SELINUX=permissive
+          SELINUXTYPE=targeted
+
+    - path: /opt/bin/setup
+      mode: 0755
+      contents:
+        inline: |
+          #!/bin/bash
+          set -xeuo pipefail
+
+          setenforce 0 || true
+
+{{- /* As we added some modules and don't want to reboot, restart the service */}}
+          systemctl restart systemd-modules-load.service
+          sysctl --system
+
+{{ safeDownloadBinariesScript .KubeletVersion | indent 10 }}
+          # set kubelet nodeip environment variable
+          /opt/bin/setup_net_env.sh
+
+          systemctl enable --now containerd
+          systemctl enable --now kubelet
+          systemctl enable --now --no-block kubelet-healthcheck.service
+
+    - path: /opt/bin/supervise.sh
+      mode: 0755
+      contents:
+        inline: |
+          #!/bin/bash
+          set -xeuo pipefail
+          while ! "$@"; do
+            sleep 1
+          done
+
+    - path: /etc/kubernetes/cloud-config
+      mode: 0600
+      contents:
+        inline: |
+{{ .CloudConfig | indent 10 }}
+
+    - path: /opt/bin/setup_net_env.sh
+      mode: 0755
+      contents:
+        inline: |
+{{ .NodeIPScript | indent 10 }}
+
+    - path: /etc/kubernetes/bootstrap-kubelet.conf
+      mode: 0600
+      contents:
+        inline: |
+{{ .Kubeconfig | indent 10 }}
+
+    - path: /etc/kubernetes/kubelet.conf
+      mode: 0644
+      contents:
+        inline: |
+{{ kubeletConfiguration "cluster.local" .DNSIPs .KubeletFeatureGates .ProviderSpec.Kubelet .ProviderSpec.Swap | indent 10 }}
+
+    - path: /etc/kubernetes/pki/ca.crt
+      mode: 0644
+      contents:
+        inline: |
+{{ .KubernetesCACert | indent 10 }}
+
+{{- /* Never set the hostname on AWS nodes. Kubernetes(kube-proxy) requires the hostname to be the private dns name */}}
+{{- if ne .CloudProviderName "aws" }}
+
+    - path: /etc/hostname
+      mode: 0644
+      overwrite: true
+      contents:
+        inline: {{ .MachineSpec.Name }}
+{{- end }}
+
+    - path: /etc/profile.d/opt-bin-path.sh
+      mode: 0644
+      contents:
+        inline: |
+          export PATH="/opt/bin:$PATH"
+
+    - path: /etc/containerd/config.toml
+      mode: 0644
+      overwrite: true
+      contents:
+        inline: |
+{{ containerdConfig .InsecureRegistries .RegistryMirrors .PauseImage | indent 10 }}
+{{- range .ProviderSpec.Files }}
+
+    - path: "{{ .Path }}"
+      mode: {{ .Permissions | default "0644" }}
+      overwrite: true
+      contents:
+        inline: |
+{{ .Content.Value | indent 10 }}
+{{- end }}
+{{- range .ProviderSpec.StaticPods }}
+
+    - path: "/etc/kubernetes/manifests/{{ .Name }}.yaml"
+      mode: 0600
+      overwrite: true
+      contents:
+        inline: |
+{{ .Manifest.Value | indent 10 }}
+{{- end }}
+`
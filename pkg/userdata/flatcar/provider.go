@@ -114,7 +114,7 @@ func (p Provider) UserData(req plugin.UserDataRequest) (string, error) {
 		KubernetesCACert: kubernetesCACert,
 		KubeletImage:     kubeletImage,
 		KubeletVersion:   kubeletVersion.String(),
-		NodeIPScript:     userdatahelper.SetupNodeIPEnvScript(),
+		NodeIPScript:     userdatahelper.SetupNodeIPEnvScript(pconfig.NodeNetwork),
 	}
 	b := &bytes.Buffer{}
 	err = tmpl.Execute(b, data)
@@ -292,7 +292,7 @@ systemd:
           -v /var/lib/kubelet:/var/lib/kubelet:rshared \
           -v /var/log/pods:/var/log/pods \
           {{ .KubeletImage }} \
-{{ kubeletFlags .KubeletVersion .CloudProviderName .MachineSpec.Name .DNSIPs .ExternalCloudProvider .PauseImage .MachineSpec.Taints | indent 10 }}
+{{ kubeletFlags .KubeletVersion .CloudProviderName .MachineSpec.Name .DNSIPs .ExternalCloudProvider .PauseImage .MachineSpec.Taints .ProviderSpec.Kubelet | indent 10 }}
         ExecStop=-/usr/bin/docker stop %n
         Restart=always
         RestartSec=10
@@ -306,6 +306,13 @@ systemd:
         contents: |
           [Service]
           EnvironmentFile=-/etc/environment
+{{- range .ProviderSpec.SystemdUnits }}
+
+    - name: {{ .Name }}
+      enabled: true
+      contents: |
+{{ .Content.Value | indent 8 }}
+{{- end }}
 
 storage:
   files:
@@ -330,7 +337,7 @@ storage:
       mode: 0644
       contents:
         inline: |
-{{ kubeletConfiguration "cluster.local" .DNSIPs .KubeletFeatureGates | indent 10 }}
+{{ kubeletConfiguration "cluster.local" .DNSIPs .KubeletFeatureGates .ProviderSpec.Kubelet .ProviderSpec.Swap | indent 10 }}
 
     - path: /opt/load-kernel-modules.sh
       filesystem: root
@@ -345,6 +352,31 @@ storage:
       contents:
         inline: |
 {{ kernelSettings | indent 10 }}
+{{- with .ProviderSpec.Kernel }}
+{{- if .Modules }}
+
+    - path: /etc/modules-load.d/machine-controller.conf
+      filesystem: root
+      mode: 0644
+      contents:
+        inline: |
+{{- range .Modules }}
+          {{ . }}
+{{- end }}
+{{- end }}
+{{- if .Sysctls }}
+{{- /* Sorts after k8s.conf to override its settings */}}
+
+    - path: /etc/sysctl.d/machine-controller.conf
+      filesystem: root
+      mode: 0644
+      contents:
+        inline: |
+{{- range $name, $value := .Sysctls }}
+          {{ $name }} = {{ $value }}
+{{- end }}
+{{- end }}
+{{- end }}
 
     - path: /proc/sys/kernel/panic_on_oops
       filesystem: root
@@ -455,6 +487,24 @@ storage:
           set -xeuo pipefail
 {{ safeDownloadBinariesScript .KubeletVersion | indent 10 }}
           systemctl disable download-script.service
+{{- range .ProviderSpec.Files }}
+
+    - path: "{{ .Path }}"
+      filesystem: root
+      mode: {{ .Permissions | default "0644" }}
+      contents:
+        inline: |
+{{ .Content.Value | indent 10 }}
+{{- end }}
+{{- range .ProviderSpec.StaticPods }}
+
+    - path: "/etc/kubernetes/manifests/{{ .Name }}.yaml"
+      filesystem: root
+      mode: 0600
+      contents:
+        inline: |
+{{ .Manifest.Value | indent 10 }}
+{{- end }}
 `
 
 // Coreos cloud-config template
@@ -607,7 +657,7 @@ coreos:
         -v /var/lib/kubelet:/var/lib/kubelet:rshared \
         -v /var/log/pods:/var/log/pods \
         {{ .KubeletImage }} \
-{{ kubeletFlags .KubeletVersion .CloudProviderName .MachineSpec.Name .DNSIPs .ExternalCloudProvider .PauseImage .MachineSpec.Taints | indent 10 }}
+{{ kubeletFlags .KubeletVersion .CloudProviderName .MachineSpec.Name .DNSIPs .ExternalCloudProvider .PauseImage .MachineSpec.Taints .ProviderSpec.Kubelet | indent 10 }}
       ExecStop=-/usr/bin/docker stop %n
       Restart=always
       RestartSec=10
@@ -635,6 +685,14 @@ coreos:
       ExecStart=/opt/bin/apply_sysctl_settings.sh
       [Install]
       WantedBy=multi-user.target
+{{- range .ProviderSpec.SystemdUnits }}
+
+  - name: {{ .Name }}
+    enable: true
+    command: start
+    content: |
+{{ .Content.Value | indent 6 }}
+{{- end }}
 
 write_files:
 {{- if .HTTPProxy }}
@@ -652,7 +710,7 @@ write_files:
 - path: "/etc/kubernetes/kubelet.conf"
   permissions: "0644"
   content: |
-{{ kubeletConfiguration "cluster.local" .DNSIPs .KubeletFeatureGates | indent 4 }}
+{{ kubeletConfiguration "cluster.local" .DNSIPs .KubeletFeatureGates .ProviderSpec.Kubelet .ProviderSpec.Swap | indent 4 }}
 
 - path: /opt/load-kernel-modules.sh
   permissions: "0755"
@@ -663,6 +721,27 @@ write_files:
   permissions: "0644"
   content: |
 {{ kernelSettings | indent 4 }}
+{{- with .ProviderSpec.Kernel }}
+{{- if .Modules }}
+
+- path: /etc/modules-load.d/machine-controller.conf
+  permissions: "0644"
+  content: |
+{{- range .Modules }}
+    {{ . }}
+{{- end }}
+{{- end }}
+{{- if .Sysctls }}
+{{- /* Sorts after k8s.conf to override its settings */}}
+
+- path: /etc/sysctl.d/machine-controller.conf
+  permissions: "0644"
+  content: |
+{{- range $name, $value := .Sysctls }}
+    {{ $name }} = {{ $value }}
+{{- end }}
+{{- end }}
+{{- end }}
 
 - path: "/opt/bin/setup_net_env.sh"
   permissions: "0755"
@@ -739,6 +818,25 @@ write_files:
   content: |
     #!/bin/bash
     set -xeuo pipefail
+{{- with .ProviderSpec.Kernel }}
+{{- if .Modules }}
+    systemctl restart systemd-modules-load.service
+{{- end }}
+{{- end }}
     sysctl --system
     systemctl disable apply-sysctl-settings.service
+{{- range .ProviderSpec.Files }}
+
+- path: "{{ .Path }}"
+  permissions: "{{ .Permissions | default "0644" }}"
+  content: |
+{{ .Content.Value | indent 4 }}
+{{- end }}
+{{- range .ProviderSpec.StaticPods }}
+
+- path: "/etc/kubernetes/manifests/{{ .Name }}.yaml"
+  permissions: "0600"
+  content: |
+{{ .Manifest.Value | indent 4 }}
+{{- end }}
 `
@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+const containerdConfigTpl = `version = 2
+
+[plugins."io.containerd.grpc.v1.cri"]
+{{- if .PauseImage }}
+  sandbox_image = "{{ .PauseImage }}"
+{{- end }}
+
+[plugins."io.containerd.grpc.v1.cri".containerd]
+  default_runtime_name = "runc"
+
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+  runtime_type = "io.containerd.runc.v2"
+
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+  SystemdCgroup = true
+{{- if .RegistryMirrors }}
+
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+  endpoint = [{{ range $i, $mirror := .RegistryMirrors }}{{ if $i }}, {{ end }}"{{ $mirror }}"{{ end }}]
+{{- end }}
+{{- range .InsecureRegistries }}
+
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."{{ . }}"]
+  endpoint = ["http://{{ . }}"]
+
+[plugins."io.containerd.grpc.v1.cri".registry.configs."{{ . }}".tls]
+  insecure_skip_verify = true
+{{- end }}
+`
+
+// K0sContainerdConfigPath is the containerd config k0s workers run containerd with.
+const K0sContainerdConfigPath = "/etc/k0s/containerd.toml"
+
+// k0sContainerdConfigTpl only contains the registry settings, containerd defaults
+// everything else, while k0s passes its own root, state and socket paths as flags.
+const k0sContainerdConfigTpl = `version = 2
+{{- range .Registries }}
+{{- if .Endpoints }}
+
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."{{ .Host }}"]
+  endpoint = [{{ range $i, $endpoint := .Endpoints }}{{ if $i }}, {{ end }}"{{ $endpoint }}"{{ end }}]
+{{- end }}
+{{- if .Insecure }}
+
+[plugins."io.containerd.grpc.v1.cri".registry.configs."{{ .Host }}".tls]
+  insecure_skip_verify = true
+{{- end }}
+{{- if .Credentials }}
+
+[plugins."io.containerd.grpc.v1.cri".registry.configs."{{ .Host }}".auth]
+  username = {{ printf "%q" .Credentials.Username.Value }}
+  password = {{ printf "%q" .Credentials.Password.Value }}
+{{- end }}
+{{- end }}
+`
+
+type containerdRegistry struct {
+	Host        string
+	Endpoints   []string
+	Insecure    bool
+	Credentials *providerconfigtypes.RegistryCredentials
+}
+
+// K0sContainerdConfig returns the containerd config.toml of k0s workers. The
+// credentials must already be resolved, only their values are used.
+func K0sContainerdConfig(insecureRegistries []string, registryMirrors map[string][]string, credentials map[string]providerconfigtypes.RegistryCredentials) (string, error) {
+	tmpl, err := template.New("k0s-containerd-config").Parse(k0sContainerdConfigTpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse k0s-containerd-config template: %v", err)
+	}
+
+	registries := map[string]*containerdRegistry{}
+	registry := func(host string) *containerdRegistry {
+		if registries[host] == nil {
+			registries[host] = &containerdRegistry{Host: host}
+		}
+		return registries[host]
+	}
+	for host, endpoints := range registryMirrors {
+		registry(host).Endpoints = endpoints
+	}
+	for _, host := range insecureRegistries {
+		r := registry(host)
+		r.Insecure = true
+		if len(r.Endpoints) == 0 {
+			r.Endpoints = []string{"http://" + host}
+		}
+	}
+	for host := range credentials {
+		c := credentials[host]
+		registry(host).Credentials = &c
+	}
+
+	data := struct {
+		Registries []*containerdRegistry
+	}{}
+	for _, r := range registries {
+		data.Registries = append(data.Registries, r)
+	}
+	sort.Slice(data.Registries, func(i, j int) bool {
+		return data.Registries[i].Host < data.Registries[j].Host
+	})
+
+	b := &bytes.Buffer{}
+	if err := tmpl.Execute(b, data); err != nil {
+		return "", fmt.Errorf("failed to execute k0s-containerd-config template: %v", err)
+	}
+
+	return b.String(), nil
+}
+
+// ContainerdConfig returns the containerd config.toml
+func ContainerdConfig(insecureRegistries, registryMirrors []string, pauseImage string) (string, error) {
+	tmpl, err := template.New("containerd-config").Parse(containerdConfigTpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse containerd-config template: %v", err)
+	}
+
+	data := struct {
+		InsecureRegistries []string
+		RegistryMirrors    []string
+		PauseImage         string
+	}{
+		InsecureRegistries: insecureRegistries,
+		RegistryMirrors:    registryMirrors,
+		PauseImage:         pauseImage,
+	}
+	b := &bytes.Buffer{}
+	if err := tmpl.Execute(b, data); err != nil {
+		return "", fmt.Errorf("failed to execute containerd-config template: %v", err)
+	}
+
+	return b.String(), nil
+}
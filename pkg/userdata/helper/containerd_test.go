@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/test"
+)
+
+func TestContainerdConfig(t *testing.T) {
+	tests := []struct {
+		name               string
+		insecureRegistries []string
+		registryMirrors    []string
+		pauseImage         string
+	}{
+		{
+			name: "containerd_config_default",
+		},
+		{
+			name:               "containerd_config_registries",
+			insecureRegistries: []string{"192.168.100.100:5000"},
+			registryMirrors:    []string{"https://registry.docker-cn.com"},
+			pauseImage:         "192.168.100.100:5000/kubernetes/pause:v3.1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := ContainerdConfig(tc.insecureRegistries, tc.registryMirrors, tc.pauseImage)
+			if err != nil {
+				t.Error(err)
+			}
+			goldenName := tc.name + ".golden"
+			test.CompareOutput(t, goldenName, config, *update)
+		})
+	}
+}
+
+func TestK0sContainerdConfig(t *testing.T) {
+	tests := []struct {
+		name               string
+		insecureRegistries []string
+		registryMirrors    map[string][]string
+		credentials        map[string]providerconfigtypes.RegistryCredentials
+	}{
+		{
+			name: "k0s_containerd_config_default",
+		},
+		{
+			name:               "k0s_containerd_config_registries",
+			insecureRegistries: []string{"192.168.100.100:5000", "registry.local"},
+			registryMirrors: map[string][]string{
+				"docker.io":      {"https://registry.docker-cn.com", "https://mirror.gcr.io"},
+				"registry.local": {"https://registry-mirror.local"},
+			},
+			credentials: map[string]providerconfigtypes.RegistryCredentials{
+				"registry.local": {
+					Username: providerconfigtypes.ConfigVarString{Value: "user"},
+					Password: providerconfigtypes.ConfigVarString{Value: `pa"ss`},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := K0sContainerdConfig(tc.insecureRegistries, tc.registryMirrors, tc.credentials)
+			if err != nil {
+				t.Error(err)
+			}
+			goldenName := tc.name + ".golden"
+			test.CompareOutput(t, goldenName, config, *update)
+		})
+	}
+}
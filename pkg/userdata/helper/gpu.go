@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"fmt"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+const (
+	// DefaultNvidiaDriverVersion is the branch of the NVIDIA driver installed if none is configured.
+	DefaultNvidiaDriverVersion = "535"
+
+	nvidiaContainerToolkitRepo = "https://nvidia.github.io/libnvidia-container"
+
+	// the precompiled and signed kernel modules of Ubuntu also work with secure boot
+	nvidiaAptScriptTpl = `# install the NVIDIA driver and container toolkit
+curl -fsSL %[1]s/gpgkey | gpg --dearmor --yes -o /usr/share/keyrings/nvidia-container-toolkit-keyring.gpg
+curl -fsSL %[1]s/stable/deb/nvidia-container-toolkit.list \
+  | sed 's#deb https://#deb [signed-by=/usr/share/keyrings/nvidia-container-toolkit-keyring.gpg] https://#g' \
+  > /etc/apt/sources.list.d/nvidia-container-toolkit.list
+DEBIAN_FRONTEND=noninteractive apt-get update
+DEBIAN_FRONTEND=noninteractive apt-get -o Dpkg::Options::="--force-confdef" -o Dpkg::Options::="--force-confold" install -y \
+  linux-modules-nvidia-%[2]s-server-$(uname -r) \
+  nvidia-headless-no-dkms-%[2]s-server \
+  nvidia-utils-%[2]s-server \
+  nvidia-container-toolkit
+modprobe nvidia
+nvidia-ctk runtime configure --runtime=containerd --config=%[3]s --set-as-default`
+
+	// the CUDA repository only ships DKMS modules for RHEL, DKMS itself comes from EPEL.
+	// RHEL 7 has no module streams, the branches are packaged instead.
+	nvidiaYumScriptTpl = `# install the NVIDIA driver and container toolkit
+source /etc/os-release
+RHEL_MAJOR_VERSION="${VERSION_ID%%%%.*}"
+yum install -y "https://dl.fedoraproject.org/pub/epel/epel-release-latest-${RHEL_MAJOR_VERSION}.noarch.rpm" || true
+yum-config-manager --add-repo "https://developer.download.nvidia.com/compute/cuda/repos/rhel${RHEL_MAJOR_VERSION}/$(uname -m)/cuda-rhel${RHEL_MAJOR_VERSION}.repo"
+curl -fsSL %[1]s/stable/rpm/nvidia-container-toolkit.repo -o /etc/yum.repos.d/nvidia-container-toolkit.repo
+yum install -y kernel-devel-$(uname -r) kernel-headers-$(uname -r)
+if [[ "${RHEL_MAJOR_VERSION}" == "7" ]]; then
+  yum install -y nvidia-driver-branch-%[2]s
+else
+  yum module install -y nvidia-driver:%[2]s-dkms
+fi
+yum install -y nvidia-container-toolkit
+modprobe nvidia
+nvidia-ctk runtime configure --runtime=docker --set-as-default`
+)
+
+// GPUDriverVersion returns the driver version of the given settings.
+func GPUDriverVersion(gpu *providerconfigtypes.GPUSettings) string {
+	if gpu.Version == "" {
+		return DefaultNvidiaDriverVersion
+	}
+	return gpu.Version
+}
+
+// GPUDriverScript returns the script which installs the GPU driver and configures the
+// container runtime of the given operating system to expose the GPUs to containers.
+func GPUDriverScript(os providerconfigtypes.OperatingSystem, gpu *providerconfigtypes.GPUSettings) (string, error) {
+	if gpu.Driver != providerconfigtypes.GPUDriverNvidia {
+		return "", fmt.Errorf("unsupported GPU driver %q", gpu.Driver)
+	}
+
+	switch os {
+	case providerconfigtypes.OperatingSystemUbuntu:
+		return fmt.Sprintf(nvidiaAptScriptTpl, nvidiaContainerToolkitRepo, GPUDriverVersion(gpu), K0sContainerdConfigPath), nil
+	case providerconfigtypes.OperatingSystemCentOS, providerconfigtypes.OperatingSystemRHEL,
+		providerconfigtypes.OperatingSystemRockyLinux, providerconfigtypes.OperatingSystemAlmaLinux:
+		return fmt.Sprintf(nvidiaYumScriptTpl, nvidiaContainerToolkitRepo, GPUDriverVersion(gpu)), nil
+	default:
+		return "", fmt.Errorf("GPU drivers are not supported on %s", os)
+	}
+}
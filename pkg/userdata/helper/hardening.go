@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// CISSSHDConfigPath is the file the CIS sshd settings get written to before they
+	// are merged into the sshd config.
+	CISSSHDConfigPath = "/etc/ssh/sshd_config.cis"
+
+	cisHardeningScript = `# merge the CIS sshd settings into the sshd config, global settings must precede any Match block
+while read -r key _; do
+  sed -i -E "/^\s*#?\s*${key}\s/Id" /etc/ssh/sshd_config
+done < %[1]s
+cat %[1]s /etc/ssh/sshd_config > /etc/ssh/sshd_config.new
+mv /etc/ssh/sshd_config.new /etc/ssh/sshd_config
+chown root:root /etc/ssh/sshd_config
+chmod 0600 /etc/ssh/sshd_config /etc/ssh/ssh_host_*_key
+sshd -t
+systemctl reload sshd
+
+for path in /etc/crontab /etc/cron.hourly /etc/cron.daily /etc/cron.weekly /etc/cron.monthly /etc/cron.d; do
+  if [[ -e "$path" ]]; then
+    chown root:root "$path"
+    chmod og-rwx "$path"
+  fi
+done
+chmod 0644 /etc/passwd /etc/group
+chmod o-rwx,g-wx /etc/shadow /etc/gshadow
+find /var/log -type f -exec chmod g-wx,o-rwx {} +
+
+sysctl --system
+
+systemctl enable --now auditd
+# the rules are immutable once loaded, from then on auditd loads them on boot
+if ! auditctl -s | grep -q "enabled 2"; then
+  augenrules --load
+fi`
+)
+
+// CISSysctlSettings returns the kernel settings of the CIS benchmarks. IP forwarding
+// stays enabled and reverse path filtering is left to the CNI, as Kubernetes requires them.
+func CISSysctlSettings() string {
+	return `fs.suid_dumpable = 0
+kernel.randomize_va_space = 2
+net.ipv4.conf.all.send_redirects = 0
+net.ipv4.conf.default.send_redirects = 0
+net.ipv4.conf.all.accept_source_route = 0
+net.ipv4.conf.default.accept_source_route = 0
+net.ipv4.conf.all.accept_redirects = 0
+net.ipv4.conf.default.accept_redirects = 0
+net.ipv4.conf.all.secure_redirects = 0
+net.ipv4.conf.default.secure_redirects = 0
+net.ipv4.conf.all.log_martians = 1
+net.ipv4.conf.default.log_martians = 1
+net.ipv4.icmp_echo_ignore_broadcasts = 1
+net.ipv4.icmp_ignore_bogus_error_responses = 1
+net.ipv4.tcp_syncookies = 1
+net.ipv6.conf.all.accept_ra = 0
+net.ipv6.conf.default.accept_ra = 0
+net.ipv6.conf.all.accept_redirects = 0
+net.ipv6.conf.default.accept_redirects = 0
+`
+}
+
+// CISModprobeConfig returns the modprobe config which disables the filesystems and
+// network protocols the CIS benchmarks consider unused. squashfs, udf and vfat as well
+// as sctp stay available, as snaps, cloud provider config drives, EFI partitions and
+// Kubernetes SCTP services rely on them.
+func CISModprobeConfig() string {
+	return `install cramfs /bin/true
+install freevxfs /bin/true
+install jffs2 /bin/true
+install hfs /bin/true
+install hfsplus /bin/true
+install dccp /bin/true
+install rds /bin/true
+install tipc /bin/true
+`
+}
+
+// CISSSHDConfig returns the sshd settings of the CIS benchmarks.
+func CISSSHDConfig() string {
+	return `LogLevel INFO
+X11Forwarding no
+MaxAuthTries 4
+IgnoreRhosts yes
+HostbasedAuthentication no
+PermitRootLogin no
+PermitEmptyPasswords no
+PermitUserEnvironment no
+ClientAliveInterval 300
+ClientAliveCountMax 3
+LoginGraceTime 60
+MaxStartups 10:30:60
+MaxSessions 10
+AllowTcpForwarding no
+`
+}
+
+// CISAuditRules returns the audit rules of the CIS benchmarks. macPolicyPaths are the
+// config paths of the mandatory access control system of the operating system.
+func CISAuditRules(macPolicyPaths ...string) string {
+	var macPolicyRules []string
+	for _, path := range macPolicyPaths {
+		macPolicyRules = append(macPolicyRules, fmt.Sprintf("-w %s -p wa -k MAC-policy", path))
+	}
+
+	return `-a always,exit -F arch=b64 -S adjtimex -S settimeofday -k time-change
+-a always,exit -F arch=b32 -S adjtimex -S settimeofday -S stime -k time-change
+-a always,exit -F arch=b64 -S clock_settime -k time-change
+-a always,exit -F arch=b32 -S clock_settime -k time-change
+-w /etc/localtime -p wa -k time-change
+-w /etc/group -p wa -k identity
+-w /etc/passwd -p wa -k identity
+-w /etc/gshadow -p wa -k identity
+-w /etc/shadow -p wa -k identity
+-w /etc/security/opasswd -p wa -k identity
+-a always,exit -F arch=b64 -S sethostname -S setdomainname -k system-locale
+-a always,exit -F arch=b32 -S sethostname -S setdomainname -k system-locale
+-w /etc/issue -p wa -k system-locale
+-w /etc/issue.net -p wa -k system-locale
+-w /etc/hosts -p wa -k system-locale
+` + strings.Join(macPolicyRules, "\n") + `
+-w /var/log/faillog -p wa -k logins
+-w /var/log/lastlog -p wa -k logins
+-w /var/run/utmp -p wa -k session
+-w /var/log/wtmp -p wa -k logins
+-w /var/log/btmp -p wa -k logins
+-a always,exit -F arch=b64 -S chmod -S fchmod -S fchmodat -F auid>=1000 -F auid!=4294967295 -k perm_mod
+-a always,exit -F arch=b32 -S chmod -S fchmod -S fchmodat -F auid>=1000 -F auid!=4294967295 -k perm_mod
+-a always,exit -F arch=b64 -S chown -S fchown -S fchownat -S lchown -F auid>=1000 -F auid!=4294967295 -k perm_mod
+-a always,exit -F arch=b32 -S chown -S fchown -S fchownat -S lchown -F auid>=1000 -F auid!=4294967295 -k perm_mod
+-a always,exit -F arch=b64 -S setxattr -S lsetxattr -S fsetxattr -S removexattr -S lremovexattr -S fremovexattr -F auid>=1000 -F auid!=4294967295 -k perm_mod
+-a always,exit -F arch=b32 -S setxattr -S lsetxattr -S fsetxattr -S removexattr -S lremovexattr -S fremovexattr -F auid>=1000 -F auid!=4294967295 -k perm_mod
+-a always,exit -F arch=b64 -S creat -S open -S openat -S truncate -S ftruncate -F exit=-EACCES -F auid>=1000 -F auid!=4294967295 -k access
+-a always,exit -F arch=b32 -S creat -S open -S openat -S truncate -S ftruncate -F exit=-EACCES -F auid>=1000 -F auid!=4294967295 -k access
+-a always,exit -F arch=b64 -S creat -S open -S openat -S truncate -S ftruncate -F exit=-EPERM -F auid>=1000 -F auid!=4294967295 -k access
+-a always,exit -F arch=b32 -S creat -S open -S openat -S truncate -S ftruncate -F exit=-EPERM -F auid>=1000 -F auid!=4294967295 -k access
+-a always,exit -F arch=b64 -S mount -F auid>=1000 -F auid!=4294967295 -k mounts
+-a always,exit -F arch=b32 -S mount -F auid>=1000 -F auid!=4294967295 -k mounts
+-a always,exit -F arch=b64 -S unlink -S unlinkat -S rename -S renameat -F auid>=1000 -F auid!=4294967295 -k delete
+-a always,exit -F arch=b32 -S unlink -S unlinkat -S rename -S renameat -F auid>=1000 -F auid!=4294967295 -k delete
+-w /etc/sudoers -p wa -k scope
+-w /etc/sudoers.d/ -p wa -k scope
+-w /sbin/insmod -p x -k modules
+-w /sbin/rmmod -p x -k modules
+-w /sbin/modprobe -p x -k modules
+-a always,exit -F arch=b64 -S init_module -S delete_module -k modules
+-e 2
+`
+}
+
+// CISHardeningScript returns the script which applies the CIS sshd settings, file
+// permissions, kernel settings and audit rules. It expects the files of CISSSHDConfig,
+// CISSysctlSettings and CISAuditRules to be written and auditd to be installed.
+func CISHardeningScript() string {
+	return fmt.Sprintf(cisHardeningScript, CISSSHDConfigPath)
+}
@@ -23,6 +23,8 @@ import (
 
 	"github.com/Masterminds/semver"
 
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
@@ -166,6 +168,22 @@ func DockerVersionYum(kubernetesVersion *semver.Version) (string, error) {
 	return "19.03.12-3.el7", nil
 }
 
+// DockerVersionDnf returns Docker version to be installed on instances using dnf (Rocky Linux/AlmaLinux).
+func DockerVersionDnf(kubernetesVersion *semver.Version) (string, error) {
+	if kubernetesVersion == nil {
+		return "", fmt.Errorf("invalid kubernetes version")
+	}
+
+	lessThen117, _ := semver.NewConstraint("< 1.17")
+
+	if lessThen117.Check(kubernetesVersion) {
+		return "18.09.1-3.el7", nil
+	}
+
+	// return default
+	return "19.03.13-3.el8", nil
+}
+
 func ProxyEnvironment(proxy, noProxy string) string {
 	return fmt.Sprintf(`HTTP_PROXY=%s
 http_proxy=%s
@@ -175,21 +193,41 @@ NO_PROXY=%s
 no_proxy=%s`, proxy, proxy, proxy, proxy, noProxy, noProxy)
 }
 
-func SetupNodeIPEnvScript() string {
-	return `#!/usr/bin/env bash
+// ProxyEnvironmentWithHTTPSProxy returns the environment variables of the given proxies,
+// only the ones which are set are returned. httpsProxy defaults to httpProxy.
+func ProxyEnvironmentWithHTTPSProxy(httpProxy, httpsProxy, noProxy string) string {
+	if httpsProxy == "" {
+		httpsProxy = httpProxy
+	}
+
+	var env []string
+	if httpProxy != "" {
+		env = append(env, "HTTP_PROXY="+httpProxy, "http_proxy="+httpProxy)
+	}
+	if httpsProxy != "" {
+		env = append(env, "HTTPS_PROXY="+httpsProxy, "https_proxy="+httpsProxy)
+	}
+	if noProxy != "" {
+		env = append(env, "NO_PROXY="+noProxy, "no_proxy="+noProxy)
+	}
+	return strings.Join(env, "\n")
+}
+
+// SetupNodeIPEnvScript returns the script which configures the network of the node
+// and passes its IP addresses to the kubelet.
+func SetupNodeIPEnvScript(network *providerconfigtypes.NodeNetworkSettings) string {
+	script := `#!/usr/bin/env bash
 echodate() {
   echo "[$(date -Is)]" "$@"
 }
 
-# get the default interface IP address
-DEFAULT_IFC_IP=$(ip -o  route get 1 | grep -oP "src \K\S+")
+` + NodeIPDetectionScript(network) + "\n"
 
-if [ -z "${DEFAULT_IFC_IP}" ]
-then
-	echodate "Failed to get IP address for the default route interface"
-	exit 1
-fi
+	if networkScript := NodeNetworkScript(network); networkScript != "" {
+		script += "\n" + networkScript + "\n"
+	}
 
+	return script + `
 # write the nodeip_env file
 if grep -q coreos /etc/os-release
 then
@@ -0,0 +1,267 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultK0sVersion is the k0s release installed on k0s workers.
+	DefaultK0sVersion = "v1.21.2+k0s.1"
+
+	// DefaultK0sReleaseURL is the endpoint k0s releases get downloaded from.
+	// Mirrors must serve the binaries under the same layout.
+	DefaultK0sReleaseURL = "https://github.com/k0sproject/k0s/releases/download"
+
+	// K0sJoinTokenPath is the path the join token gets written to on k0s workers.
+	K0sJoinTokenPath = "/etc/k0s/join-token"
+
+	// K0sControllerMinVersion is the first k0s release with EtcdMember objects, which
+	// the etcd member of a controller gets removed with before its instance is deleted.
+	K0sControllerMinVersion = "v1.30.0"
+
+	// K0sAirgapBundlePath is the path the airgap image bundle gets downloaded to,
+	// k0s imports all bundles in /var/lib/k0s/images on start.
+	K0sAirgapBundlePath = "/var/lib/k0s/images/k0s-airgap-bundle.tar"
+
+	// k0sArchScript sets $arch to the architecture of the node as named in the k0s releases.
+	k0sArchScript = `arch=$(uname -m | sed -e 's/x86_64/amd64/' -e 's/aarch64/arm64/' -e 's/armv7l/arm/')`
+
+	k0sInstallTpl = `{{- /* download the pinned k0s release unless it is installed already */ -}}
+if [[ ! -x /usr/local/bin/k0s ]] || [[ "$(/usr/local/bin/k0s version)" != "{{ .Version }}" ]]; then
+    {{ .ArchScript }}
+    curl -Lfo /usr/local/bin/k0s "{{ .BinaryURL }}"
+    chmod +x /usr/local/bin/k0s
+fi
+
+{{- if .AirgapBundleURL }}
+
+{{- /* the images must be in place before the worker starts, as the node might not have registry access */}}
+
+if [[ ! -f {{ .AirgapBundlePath }} ]]; then
+    mkdir -p /var/lib/k0s/images
+    curl -Lfo {{ .AirgapBundlePath }}.tmp "{{ .AirgapBundleURL }}"
+    mv {{ .AirgapBundlePath }}.tmp {{ .AirgapBundlePath }}
+fi
+{{- end }}
+
+{{- /* k0s install creates the systemd unit of the role, which must only happen once */}}
+
+if [[ ! -f /etc/systemd/system/k0s{{ .Role }}.service ]]; then
+{{- if gt (len .JoinAddresses) 1 }}
+{{- /* the token points to the first address, switch to the first one which responds with any status */}}
+    for address in{{ range .JoinAddresses }} "{{ . }}"{{ end }}; do
+        if curl -sk --max-time 5 -o /dev/null "${address}/readyz"; then
+            base64 -d {{ .TokenFile }} | gunzip | sed "s|^\( *server: \).*|\1${address}|" | gzip | base64 -w0 > {{ .TokenFile }}.tmp
+            mv {{ .TokenFile }}.tmp {{ .TokenFile }}
+            break
+        fi
+    done
+{{- end }}
+    /usr/local/bin/k0s install {{ .Role }}{{ if .TokenFile }} --token-file {{ .TokenFile }}{{ end }}
+{{- range .RoleFlags }} {{ . }}{{ end }}
+{{- if .WorkerProfile }} --profile "{{ .WorkerProfile }}"{{ end }}
+{{- if .ExternalCloudProvider }} --enable-cloud-provider{{ end }}
+{{- if .Labels }} --labels "{{ .Labels }}"{{ end }}
+{{- if .Taints }} --taints "{{ .Taints }}"{{ end }}
+{{- if .KubeletExtraArgs }} --kubelet-extra-args "{{ .KubeletExtraArgs }}"{{ end }}
+fi
+
+systemctl daemon-reload
+systemctl enable --now k0s{{ .Role }}
+`
+)
+
+// K0sArchitectures are the architectures k0s releases binaries for, as named in their download URLs.
+var K0sArchitectures = []string{"amd64", "arm64", "arm"}
+
+// K0sBinaryURL returns the download URL of the k0s binary of the given release and architecture.
+func K0sBinaryURL(releaseURL, version, arch string) string {
+	if releaseURL == "" {
+		releaseURL = DefaultK0sReleaseURL
+	}
+	return fmt.Sprintf("%s/%s/k0s-%s-%s", strings.TrimSuffix(releaseURL, "/"), version, version, arch)
+}
+
+// ValidateK0sVersion checks that the k0s binary of the given release can be
+// downloaded from the release endpoint. The check is aborted when the given
+// context is done.
+func ValidateK0sVersion(ctx context.Context, releaseURL, version string) error {
+	if !strings.HasPrefix(version, "v") {
+		return fmt.Errorf("k0s version %q must start with a 'v'", version)
+	}
+
+	// Every release has an amd64 binary, the architecture of the nodes is only known on boot
+	binaryURL := K0sBinaryURL(releaseURL, version, "amd64")
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, binaryURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request for k0s release %q: %v", version, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to check k0s release %q: %v", version, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("k0s release %q does not exist: %s returned %s", version, binaryURL, resp.Status)
+	}
+	return nil
+}
+
+// kubeletLabelNamespaces are the namespaces of the kubernetes.io and k8s.io labels
+// the kubelet may set on its node, see the NodeRestriction admission plugin.
+var kubeletLabelNamespaces = []string{"kubelet.kubernetes.io", "node.kubernetes.io"}
+
+// kubeletLabels are the kubernetes.io and k8s.io labels the kubelet may set on its node.
+var kubeletLabels = map[string]bool{
+	"kubernetes.io/hostname":                   true,
+	"kubernetes.io/instance-type":              true,
+	"kubernetes.io/os":                         true,
+	"kubernetes.io/arch":                       true,
+	"beta.kubernetes.io/instance-type":         true,
+	"beta.kubernetes.io/os":                    true,
+	"beta.kubernetes.io/arch":                  true,
+	"failure-domain.beta.kubernetes.io/zone":   true,
+	"failure-domain.beta.kubernetes.io/region": true,
+	"topology.kubernetes.io/zone":              true,
+	"topology.kubernetes.io/region":            true,
+	"node.kubernetes.io/instance-type":         true,
+}
+
+// isKubeletLabel returns whether the kubelet may register its node with the given
+// label, other labels get set by the machine-controller once the node joined.
+func isKubeletLabel(key string) bool {
+	if kubeletLabels[key] {
+		return true
+	}
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return true
+	}
+	namespace := parts[0]
+	for _, ns := range kubeletLabelNamespaces {
+		if namespace == ns || strings.HasSuffix(namespace, "."+ns) {
+			return true
+		}
+	}
+	return !(namespace == "kubernetes.io" || strings.HasSuffix(namespace, ".kubernetes.io") ||
+		namespace == "k8s.io" || strings.HasSuffix(namespace, ".k8s.io"))
+}
+
+// K0sInstallWorkerScript returns the script which downloads the given k0s
+// release and installs and starts the k0s worker with the join token.
+// If airgapBundleURL is set, the airgap image bundle gets preloaded as well.
+// The kubelet gets configured by the given k0s worker profile, unless it is empty.
+// With several join addresses, the worker joins with the first one which responds.
+// The node gets registered with the given labels and taints, the kubelet
+// settings are passed as extra kubelet flags.
+func K0sInstallWorkerScript(releaseURL, version, airgapBundleURL, workerProfile string, joinAddresses []string, externalCloudProvider bool, labels map[string]string, taints []corev1.Taint, kubeletSettings *providerconfigtypes.KubeletSettings) (string, error) {
+	return k0sInstallScript(providerconfigtypes.NodeRoleWorker, nil, K0sJoinTokenPath, releaseURL, version, airgapBundleURL, workerProfile, joinAddresses, externalCloudProvider, labels, taints, kubeletSettings)
+}
+
+// K0sInstallControllerScript returns the script which installs and starts a k0s
+// controller joining with the controller join token, like K0sInstallWorkerScript
+// does for workers. The controller runs a worker as well, so it registers a node
+// the machine gets matched with. k0s taints the node unless it is schedulable.
+func K0sInstallControllerScript(releaseURL, version, airgapBundleURL, workerProfile string, externalCloudProvider, schedulable bool, labels map[string]string, taints []corev1.Taint, kubeletSettings *providerconfigtypes.KubeletSettings) (string, error) {
+	// Joining controllers take the cluster wide settings from the ClusterConfig of the cluster
+	roleFlags := []string{"--enable-worker", "--enable-dynamic-config"}
+	if schedulable {
+		roleFlags = append(roleFlags, "--no-taints")
+	}
+	return k0sInstallScript(providerconfigtypes.NodeRoleController, roleFlags, K0sJoinTokenPath, releaseURL, version, airgapBundleURL, workerProfile, nil, externalCloudProvider, labels, taints, kubeletSettings)
+}
+
+// K0sInstallSingleScript returns the script which installs and starts a k0s
+// controller with a worker as a cluster of its own, like K0sInstallWorkerScript
+// does for workers. It needs no join token and runs the k0scontroller service.
+func K0sInstallSingleScript(releaseURL, version, airgapBundleURL, workerProfile string, externalCloudProvider bool, labels map[string]string, taints []corev1.Taint, kubeletSettings *providerconfigtypes.KubeletSettings) (string, error) {
+	return k0sInstallScript(providerconfigtypes.NodeRoleController, []string{"--single"}, "", releaseURL, version, airgapBundleURL, workerProfile, nil, externalCloudProvider, labels, taints, kubeletSettings)
+}
+
+func k0sInstallScript(role providerconfigtypes.NodeRole, roleFlags []string, tokenFile, releaseURL, version, airgapBundleURL, workerProfile string, joinAddresses []string, externalCloudProvider bool, labels map[string]string, taints []corev1.Taint, kubeletSettings *providerconfigtypes.KubeletSettings) (string, error) {
+	tmpl, err := template.New("k0s-install").Funcs(TxtFuncMap()).Parse(k0sInstallTpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse k0s-install template: %v", err)
+	}
+
+	var labelArgs []string
+	for key, value := range labels {
+		if isKubeletLabel(key) {
+			labelArgs = append(labelArgs, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	sort.Strings(labelArgs)
+
+	var taintArgs []string
+	for _, taint := range taints {
+		taintArgs = append(taintArgs, fmt.Sprintf("%s=%s:%s", taint.Key, taint.Value, taint.Effect))
+	}
+
+	data := struct {
+		Role                  providerconfigtypes.NodeRole
+		RoleFlags             []string
+		Version               string
+		ArchScript            string
+		BinaryURL             string
+		TokenFile             string
+		AirgapBundleURL       string
+		AirgapBundlePath      string
+		WorkerProfile         string
+		JoinAddresses         []string
+		ExternalCloudProvider bool
+		Labels                string
+		Taints                string
+		KubeletExtraArgs      string
+	}{
+		Role:                  role,
+		RoleFlags:             roleFlags,
+		Version:               version,
+		ArchScript:            k0sArchScript,
+		BinaryURL:             K0sBinaryURL(releaseURL, version, "${arch}"),
+		TokenFile:             tokenFile,
+		AirgapBundleURL:       airgapBundleURL,
+		AirgapBundlePath:      K0sAirgapBundlePath,
+		WorkerProfile:         workerProfile,
+		JoinAddresses:         joinAddresses,
+		ExternalCloudProvider: externalCloudProvider,
+		Labels:                strings.Join(labelArgs, ","),
+		Taints:                strings.Join(taintArgs, ","),
+		KubeletExtraArgs:      strings.Join(KubeletSettingsFlags(kubeletSettings), " "),
+	}
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute k0s-install template: %v", err)
+	}
+
+	return b.String(), nil
+}
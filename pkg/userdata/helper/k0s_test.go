@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/test"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestK0sInstallWorkerScript(t *testing.T) {
+	tests := []struct {
+		name                  string
+		airgapBundleURL       string
+		workerProfile         string
+		joinAddresses         []string
+		externalCloudProvider bool
+		labels                map[string]string
+		taints                []corev1.Taint
+		kubeletSettings       *providerconfigtypes.KubeletSettings
+	}{
+		{
+			name: "k0s_install_worker",
+		},
+		{
+			name:                  "k0s_install_worker_external",
+			externalCloudProvider: true,
+		},
+		{
+			name:            "k0s_install_worker_airgap",
+			airgapBundleURL: "https://mirror.example.com/k0s/k0s-airgap-bundle-v1.21.2+k0s.1-amd64",
+		},
+		{
+			name:          "k0s_install_worker_profile",
+			workerProfile: "high-density",
+		},
+		{
+			name:          "k0s_install_worker_join_addresses",
+			joinAddresses: []string{"https://10.0.0.10:6443", "https://10.0.0.11:6443", "https://10.0.0.12:6443"},
+		},
+		{
+			name: "k0s_install_worker_labels_taints",
+			labels: map[string]string{
+				"pool": "gpu",
+				"node.kubernetes.io/exclude-from-external-load-balancers": "true",
+				"node-role.kubernetes.io/worker":                          "",
+			},
+			taints: []corev1.Taint{
+				{
+					Key:    "nvidia.com/gpu",
+					Value:  "present",
+					Effect: corev1.TaintEffectNoSchedule,
+				},
+			},
+		},
+		{
+			name: "k0s_install_worker_kubelet_settings",
+			kubeletSettings: &providerconfigtypes.KubeletSettings{
+				MaxPods:      pointer.Int32Ptr(200),
+				EvictionHard: map[string]string{"memory.available": "200Mi", "nodefs.available": "10%"},
+				FeatureGates: map[string]bool{"GracefulNodeShutdown": true},
+				ExtraArgs:    map[string]string{"image-gc-high-threshold": "80"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script, err := K0sInstallWorkerScript(DefaultK0sReleaseURL, DefaultK0sVersion, tc.airgapBundleURL, tc.workerProfile, tc.joinAddresses, tc.externalCloudProvider, tc.labels, tc.taints, tc.kubeletSettings)
+			if err != nil {
+				t.Error(err)
+			}
+			goldenName := tc.name + ".golden"
+			test.CompareOutput(t, goldenName, script, *update)
+		})
+	}
+}
+
+func TestK0sInstallControllerScript(t *testing.T) {
+	tests := []struct {
+		name        string
+		schedulable bool
+		taints      []corev1.Taint
+	}{
+		{
+			name: "k0s_install_controller",
+		},
+		{
+			name:        "k0s_install_controller_schedulable",
+			schedulable: true,
+			taints: []corev1.Taint{
+				{
+					Key:    "dedicated",
+					Value:  "ingress",
+					Effect: corev1.TaintEffectNoSchedule,
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script, err := K0sInstallControllerScript(DefaultK0sReleaseURL, "v1.30.0+k0s.0", "", "", false, tc.schedulable, nil, tc.taints, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			goldenName := tc.name + ".golden"
+			test.CompareOutput(t, goldenName, script, *update)
+		})
+	}
+}
+
+func TestK0sInstallSingleScript(t *testing.T) {
+	script, err := K0sInstallSingleScript(DefaultK0sReleaseURL, DefaultK0sVersion, "", "", false, map[string]string{"site": "edge-1"}, nil, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	test.CompareOutput(t, "k0s_install_single.golden", script, *update)
+}
+
+func TestValidateK0sVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.21.2+k0s.1/k0s-v1.21.2+k0s.1-amd64" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		version string
+		wantErr bool
+	}{
+		{
+			name:    "existing release",
+			version: "v1.21.2+k0s.1",
+		},
+		{
+			name:    "missing release",
+			version: "v1.21.99+k0s.0",
+			wantErr: true,
+		},
+		{
+			name:    "version without v prefix",
+			version: "1.21.2+k0s.1",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateK0sVersion(context.Background(), server.URL+"/", tc.version)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("expected error %t, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
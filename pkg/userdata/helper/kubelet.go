@@ -18,11 +18,15 @@ package helper
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 	"text/template"
 
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeletv1b1 "k8s.io/kubelet/config/v1beta1"
@@ -44,6 +48,10 @@ const (
 --cadvisor-port=0 \
 {{- end }}
 --cert-dir=/etc/kubernetes/pki \
+{{- if eq .ContainerRuntime "containerd" }}
+--container-runtime=remote \
+--container-runtime-endpoint=unix:///run/containerd/containerd.sock \
+{{- end }}
 {{- if or (.CloudProvider) (.IsExternal) }}
 {{ cloudProviderFlags .CloudProvider .IsExternal }} \
 {{- end }}
@@ -59,12 +67,15 @@ const (
 {{- if .InitialTaints }}
 --register-with-taints={{- .InitialTaints }} \
 {{- end }}
+{{- range .ExtraArgs }}
+{{ . }} \
+{{- end }}
 --volume-plugin-dir=/var/lib/kubelet/volumeplugins \
 --node-ip ${KUBELET_NODE_IP}`
 
 	kubeletSystemdUnitTpl = `[Unit]
-After=docker.service
-Requires=docker.service
+After={{ .ContainerRuntime }}.service
+Requires={{ .ContainerRuntime }}.service
 
 Description=kubelet: The Kubernetes Node Agent
 Documentation=https://kubernetes.io/docs/home/
@@ -82,12 +93,20 @@ EnvironmentFile=-/etc/environment
 ExecStartPre=/bin/bash /opt/load-kernel-modules.sh
 ExecStartPre=/bin/bash /opt/bin/setup_net_env.sh
 ExecStart=/opt/bin/kubelet $KUBELET_EXTRA_ARGS \
-{{ kubeletFlags .KubeletVersion .CloudProvider .Hostname .ClusterDNSIPs .IsExternal .PauseImage .InitialTaints | indent 2 }}
+{{ .KubeletFlags | indent 2 }}
 
 [Install]
 WantedBy=multi-user.target`
 )
 
+const (
+	containerRuntimeDocker     = "docker"
+	containerRuntimeContainerd = "containerd"
+)
+
+// StaticPodPath is the directory the kubelet runs static pods from.
+const StaticPodPath = "/etc/kubernetes/manifests"
+
 const cpFlags = `--cloud-provider=%s \
 --cloud-config=/etc/kubernetes/cloud-config`
 
@@ -104,28 +123,32 @@ func CloudProviderFlags(cpName string, external bool) (string, error) {
 }
 
 // KubeletSystemdUnit returns the systemd unit for the kubelet
-func KubeletSystemdUnit(kubeletVersion, cloudProvider, hostname string, dnsIPs []net.IP, external bool, pauseImage string, initialTaints []corev1.Taint) (string, error) {
+func KubeletSystemdUnit(kubeletVersion, cloudProvider, hostname string, dnsIPs []net.IP, external bool, pauseImage string, initialTaints []corev1.Taint, settings *providerconfigtypes.KubeletSettings) (string, error) {
+	return kubeletSystemdUnit(containerRuntimeDocker, kubeletVersion, cloudProvider, hostname, dnsIPs, external, pauseImage, initialTaints, settings)
+}
+
+// KubeletSystemdUnitContainerd returns the systemd unit for a kubelet using containerd as container runtime
+func KubeletSystemdUnitContainerd(kubeletVersion, cloudProvider, hostname string, dnsIPs []net.IP, external bool, pauseImage string, initialTaints []corev1.Taint, settings *providerconfigtypes.KubeletSettings) (string, error) {
+	return kubeletSystemdUnit(containerRuntimeContainerd, kubeletVersion, cloudProvider, hostname, dnsIPs, external, pauseImage, initialTaints, settings)
+}
+
+func kubeletSystemdUnit(containerRuntime, kubeletVersion, cloudProvider, hostname string, dnsIPs []net.IP, external bool, pauseImage string, initialTaints []corev1.Taint, settings *providerconfigtypes.KubeletSettings) (string, error) {
 	tmpl, err := template.New("kubelet-systemd-unit").Funcs(TxtFuncMap()).Parse(kubeletSystemdUnitTpl)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse kubelet-systemd-unit template: %v", err)
 	}
 
+	flags, err := kubeletFlags(containerRuntime, kubeletVersion, cloudProvider, hostname, dnsIPs, external, pauseImage, initialTaints, settings)
+	if err != nil {
+		return "", err
+	}
+
 	data := struct {
-		KubeletVersion string
-		CloudProvider  string
-		Hostname       string
-		ClusterDNSIPs  []net.IP
-		IsExternal     bool
-		PauseImage     string
-		InitialTaints  []corev1.Taint
+		ContainerRuntime string
+		KubeletFlags     string
 	}{
-		KubeletVersion: kubeletVersion,
-		CloudProvider:  cloudProvider,
-		Hostname:       hostname,
-		ClusterDNSIPs:  dnsIPs,
-		IsExternal:     external,
-		PauseImage:     pauseImage,
-		InitialTaints:  initialTaints,
+		ContainerRuntime: containerRuntime,
+		KubeletFlags:     flags,
 	}
 	b := &bytes.Buffer{}
 	err = tmpl.Execute(b, data)
@@ -136,8 +159,57 @@ func KubeletSystemdUnit(kubeletVersion, cloudProvider, hostname string, dnsIPs [
 	return b.String(), nil
 }
 
+// kubeletExtraArgs returns the given flags sorted by name.
+func kubeletExtraArgs(extraArgs map[string]string) []string {
+	var args []string
+	for name, value := range extraArgs {
+		args = append(args, fmt.Sprintf("--%s=%s", name, value))
+	}
+	sort.Strings(args)
+	return args
+}
+
+// KubeletSettingsFlags returns the kubelet flags of the given settings, for
+// kubelets which are not configured through a KubeletConfiguration.
+func KubeletSettingsFlags(settings *providerconfigtypes.KubeletSettings) []string {
+	if settings == nil {
+		return nil
+	}
+
+	var flags []string
+	if settings.MaxPods != nil {
+		flags = append(flags, fmt.Sprintf("--max-pods=%d", *settings.MaxPods))
+	}
+	if len(settings.EvictionHard) > 0 {
+		flags = append(flags, "--eviction-hard="+joinSorted(settings.EvictionHard, "<"))
+	}
+	if len(settings.KubeReserved) > 0 {
+		flags = append(flags, "--kube-reserved="+joinSorted(settings.KubeReserved, "="))
+	}
+	if len(settings.SystemReserved) > 0 {
+		flags = append(flags, "--system-reserved="+joinSorted(settings.SystemReserved, "="))
+	}
+	if len(settings.FeatureGates) > 0 {
+		featureGates := map[string]string{}
+		for name, enabled := range settings.FeatureGates {
+			featureGates[name] = fmt.Sprint(enabled)
+		}
+		flags = append(flags, "--feature-gates="+joinSorted(featureGates, "="))
+	}
+	return append(flags, kubeletExtraArgs(settings.ExtraArgs)...)
+}
+
+func joinSorted(m map[string]string, sep string) string {
+	var pairs []string
+	for k, v := range m {
+		pairs = append(pairs, k+sep+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
 // kubeletConfiguration returns marshaled kubelet.config.k8s.io/v1beta1 KubeletConfiguration
-func kubeletConfiguration(clusterDomain string, clusterDNS []net.IP, featureGates map[string]bool) (string, error) {
+func kubeletConfiguration(clusterDomain string, clusterDNS []net.IP, featureGates map[string]bool, settings *providerconfigtypes.KubeletSettings, swap *providerconfigtypes.SwapSettings) (string, error) {
 	clusterDNSstr := make([]string, 0, len(clusterDNS))
 	for _, ip := range clusterDNS {
 		clusterDNSstr = append(clusterDNSstr, ip.String())
@@ -170,17 +242,70 @@ func kubeletConfiguration(clusterDomain string, clusterDNS []net.IP, featureGate
 		ReadOnlyPort:          0,
 		RotateCertificates:    true,
 		ServerTLSBootstrap:    true,
-		StaticPodPath:         "/etc/kubernetes/manifests",
+		StaticPodPath:         StaticPodPath,
 		KubeReserved:          map[string]string{"cpu": "100m", "memory": "100Mi", "ephemeral-storage": "1Gi"},
 		SystemReserved:        map[string]string{"cpu": "100m", "memory": "100Mi", "ephemeral-storage": "1Gi"},
 	}
 
-	buf, err := kyaml.Marshal(cfg)
+	if settings != nil {
+		if settings.MaxPods != nil {
+			cfg.MaxPods = *settings.MaxPods
+		}
+		if len(settings.EvictionHard) > 0 {
+			cfg.EvictionHard = settings.EvictionHard
+		}
+		if len(settings.KubeReserved) > 0 {
+			cfg.KubeReserved = settings.KubeReserved
+		}
+		if len(settings.SystemReserved) > 0 {
+			cfg.SystemReserved = settings.SystemReserved
+		}
+		if len(settings.FeatureGates) > 0 {
+			cfg.FeatureGates = mergeFeatureGates(featureGates, settings.FeatureGates)
+		}
+	}
+
+	if swap == nil {
+		buf, err := kyaml.Marshal(cfg)
+		return string(buf), err
+	}
+
+	cfg.FailSwapOn = pointer.BoolPtr(false)
+	cfg.FeatureGates = mergeFeatureGates(cfg.FeatureGates, map[string]bool{"NodeSwap": true})
+
+	// The vendored KubeletConfiguration predates swap support, so the swap
+	// behavior gets added to the marshaled configuration.
+	buf, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	rawCfg := map[string]interface{}{}
+	if err := json.Unmarshal(buf, &rawCfg); err != nil {
+		return "", err
+	}
+	rawCfg["memorySwap"] = map[string]string{"swapBehavior": SwapBehavior(swap)}
+
+	buf, err = kyaml.Marshal(rawCfg)
 	return string(buf), err
 }
 
+func mergeFeatureGates(featureGates, overrides map[string]bool) map[string]bool {
+	merged := map[string]bool{}
+	for name, enabled := range featureGates {
+		merged[name] = enabled
+	}
+	for name, enabled := range overrides {
+		merged[name] = enabled
+	}
+	return merged
+}
+
 // KubeletFlags returns the kubelet flags
-func KubeletFlags(version, cloudProvider, hostname string, dnsIPs []net.IP, external bool, pauseImage string, initialTaints []corev1.Taint) (string, error) {
+func KubeletFlags(version, cloudProvider, hostname string, dnsIPs []net.IP, external bool, pauseImage string, initialTaints []corev1.Taint, settings *providerconfigtypes.KubeletSettings) (string, error) {
+	return kubeletFlags(containerRuntimeDocker, version, cloudProvider, hostname, dnsIPs, external, pauseImage, initialTaints, settings)
+}
+
+func kubeletFlags(containerRuntime, version, cloudProvider, hostname string, dnsIPs []net.IP, external bool, pauseImage string, initialTaints []corev1.Taint, settings *providerconfigtypes.KubeletSettings) (string, error) {
 	tmpl, err := template.New("kubelet-flags").Funcs(TxtFuncMap()).Parse(kubeletFlagsTpl)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse kubelet-flags template: %v", err)
@@ -192,21 +317,27 @@ func KubeletFlags(version, cloudProvider, hostname string, dnsIPs []net.IP, exte
 	}
 
 	data := struct {
-		CloudProvider  string
-		Hostname       string
-		ClusterDNSIPs  []net.IP
-		KubeletVersion string
-		IsExternal     bool
-		PauseImage     string
-		InitialTaints  string
+		ContainerRuntime string
+		CloudProvider    string
+		Hostname         string
+		ClusterDNSIPs    []net.IP
+		KubeletVersion   string
+		IsExternal       bool
+		PauseImage       string
+		InitialTaints    string
+		ExtraArgs        []string
 	}{
-		CloudProvider:  cloudProvider,
-		Hostname:       hostname,
-		ClusterDNSIPs:  dnsIPs,
-		KubeletVersion: version,
-		IsExternal:     external,
-		PauseImage:     pauseImage,
-		InitialTaints:  strings.Join(initialTaintsArgs, ","),
+		ContainerRuntime: containerRuntime,
+		CloudProvider:    cloudProvider,
+		Hostname:         hostname,
+		ClusterDNSIPs:    dnsIPs,
+		KubeletVersion:   version,
+		IsExternal:       external,
+		PauseImage:       pauseImage,
+		InitialTaints:    strings.Join(initialTaintsArgs, ","),
+	}
+	if settings != nil {
+		data.ExtraArgs = kubeletExtraArgs(settings.ExtraArgs)
 	}
 	b := &bytes.Buffer{}
 	err = tmpl.Execute(b, data)
@@ -23,6 +23,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 	testhelper "github.com/kubermatic/machine-controller/pkg/test"
 
 	"github.com/Masterminds/semver"
@@ -37,6 +38,8 @@ type kubeletFlagTestCase struct {
 	external      bool
 	pauseImage    string
 	initialTaints []corev1.Taint
+	containerd    bool
+	settings      *providerconfigtypes.KubeletSettings
 }
 
 func TestKubeletSystemdUnit(t *testing.T) {
@@ -103,12 +106,38 @@ func TestKubeletSystemdUnit(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:          "containerd",
+			version:       semver.MustParse("v1.17.3"),
+			dnsIPs:        []net.IP{net.ParseIP("10.10.10.10")},
+			hostname:      "some-test-node",
+			cloudProvider: "aws",
+			containerd:    true,
+		},
+		{
+			name:          "extra-args-set",
+			version:       semver.MustParse("v1.17.3"),
+			dnsIPs:        []net.IP{net.ParseIP("10.10.10.10")},
+			hostname:      "some-test-node",
+			cloudProvider: "aws",
+			containerd:    true,
+			settings: &providerconfigtypes.KubeletSettings{
+				ExtraArgs: map[string]string{
+					"image-gc-high-threshold": "80",
+					"image-gc-low-threshold":  "60",
+				},
+			},
+		},
 	}...)
 
 	for _, test := range tests {
 		name := fmt.Sprintf("kublet_systemd_unit_%s", test.name)
 		t.Run(name, func(t *testing.T) {
-			out, err := KubeletSystemdUnit(
+			systemdUnit := KubeletSystemdUnit
+			if test.containerd {
+				systemdUnit = KubeletSystemdUnitContainerd
+			}
+			out, err := systemdUnit(
 				test.version.String(),
 				test.cloudProvider,
 				test.hostname,
@@ -116,6 +145,7 @@ func TestKubeletSystemdUnit(t *testing.T) {
 				test.external,
 				test.pauseImage,
 				test.initialTaints,
+				test.settings,
 			)
 			if err != nil {
 				t.Error(err)
@@ -0,0 +1,207 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+const (
+	ipv4DefaultRouteTpl = `$(ip -o  route get 1 | grep -oP "%s \K\S+")`
+	// the address is only used to look up the route, no traffic is sent
+	ipv6DefaultRouteTpl = `$(ip -o -6 route get 2001:4860:4860::8888 | grep -oP "%s \K\S+")`
+
+	nodeIPFailureCheck = `if [ -z "${DEFAULT_IFC_IP}" ]
+then
+	echodate "Failed to get IP address for the default route interface"
+	exit 1
+fi`
+
+	mtuScriptTpl = `# set the MTU of the default interface, the udev rule keeps it across reboots
+DEFAULT_IFC=%s
+ip link set dev "${DEFAULT_IFC}" mtu %[2]d
+echo "ACTION==\"add\", SUBSYSTEM==\"net\", KERNEL==\"${DEFAULT_IFC}\", ATTR{mtu}=\"%[2]d\"" > /etc/udev/rules.d/90-machine-controller-mtu.rules`
+
+	resolvConfScriptTpl = `# write the resolv.conf of the machine, keeping the nameservers of the network configuration
+RESOLV_CONF_UPSTREAM=/etc/resolv.conf
+if [ -f /run/systemd/resolve/resolv.conf ]
+then
+  RESOLV_CONF_UPSTREAM=/run/systemd/resolve/resolv.conf
+fi
+if [ -d /etc/NetworkManager/conf.d ]
+then
+  echo -e "[main]\ndns=none" > /etc/NetworkManager/conf.d/90-machine-controller-dns.conf
+  systemctl try-reload-or-restart NetworkManager
+fi
+{
+  grep '^nameserver' "${RESOLV_CONF_UPSTREAM}" || true
+%s} > /etc/resolv.conf.machine-controller
+mv -f /etc/resolv.conf.machine-controller /etc/resolv.conf`
+)
+
+func isIPv6Primary(network *providerconfigtypes.NodeNetworkSettings) bool {
+	return network != nil && (network.IPFamily == providerconfigtypes.NodeIPFamilyIPv6 || network.IPFamily == providerconfigtypes.NodeIPFamilyIPv6IPv4)
+}
+
+// NodeIPDetectionScript returns the script which sets DEFAULT_IFC_IP to the addresses
+// of the default route interfaces, comma separated if the node is dual-stack.
+func NodeIPDetectionScript(network *providerconfigtypes.NodeNetworkSettings) string {
+	family := providerconfigtypes.NodeIPFamilyIPv4
+	if network != nil && network.IPFamily != "" {
+		family = network.IPFamily
+	}
+
+	var detection string
+	switch family {
+	case providerconfigtypes.NodeIPFamilyIPv6:
+		detection = `# get the default interface IPv6 address
+DEFAULT_IFC_IP=` + fmt.Sprintf(ipv6DefaultRouteTpl, "src")
+	case providerconfigtypes.NodeIPFamilyIPv4IPv6, providerconfigtypes.NodeIPFamilyIPv6IPv4:
+		primary, secondary := "${DEFAULT_IFC_IPV4}", "${DEFAULT_IFC_IPV6}"
+		if family == providerconfigtypes.NodeIPFamilyIPv6IPv4 {
+			primary, secondary = secondary, primary
+		}
+		detection = fmt.Sprintf(`# get the default interface IP addresses of both families
+DEFAULT_IFC_IPV4=%s
+DEFAULT_IFC_IPV6=%s
+DEFAULT_IFC_IP=""
+if [ -n "${DEFAULT_IFC_IPV4}" ] && [ -n "${DEFAULT_IFC_IPV6}" ]
+then
+  DEFAULT_IFC_IP="%s,%s"
+fi`, fmt.Sprintf(ipv4DefaultRouteTpl, "src"), fmt.Sprintf(ipv6DefaultRouteTpl, "src"), primary, secondary)
+	default:
+		detection = `# get the default interface IP address
+DEFAULT_IFC_IP=` + fmt.Sprintf(ipv4DefaultRouteTpl, "src")
+	}
+
+	return detection + "\n\n" + nodeIPFailureCheck
+}
+
+// NodeNetworkScript returns the script which applies the MTU and the resolv.conf
+// settings of the node. It is empty if there is nothing to apply.
+func NodeNetworkScript(network *providerconfigtypes.NodeNetworkSettings) string {
+	if network == nil {
+		return ""
+	}
+
+	var scripts []string
+	if network.MTU > 0 {
+		routeTpl := ipv4DefaultRouteTpl
+		if isIPv6Primary(network) {
+			routeTpl = ipv6DefaultRouteTpl
+		}
+		scripts = append(scripts, fmt.Sprintf(mtuScriptTpl, fmt.Sprintf(routeTpl, "dev"), network.MTU))
+	}
+	if resolvConf := network.ResolvConf; resolvConf != nil && (len(resolvConf.Search) > 0 || len(resolvConf.Options) > 0) {
+		var lines string
+		if len(resolvConf.Search) > 0 {
+			lines += fmt.Sprintf("  echo \"search %s\"\n", strings.Join(resolvConf.Search, " "))
+		}
+		if len(resolvConf.Options) > 0 {
+			lines += fmt.Sprintf("  echo \"options %s\"\n", strings.Join(resolvConf.Options, " "))
+		}
+		scripts = append(scripts, fmt.Sprintf(resolvConfScriptTpl, lines))
+	}
+	return strings.Join(scripts, "\n\n")
+}
+
+// staticNetwork returns the default route and the family of the address of the given static
+// network configuration.
+func staticNetwork(network *providerconfigtypes.NetworkConfig) (defaultRoute, family string, err error) {
+	ip, _, err := net.ParseCIDR(network.CIDR)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid cidr %q: %v", network.CIDR, err)
+	}
+	if network.Gateway != "" && net.ParseIP(network.Gateway) == nil {
+		return "", "", fmt.Errorf("invalid gateway %q", network.Gateway)
+	}
+	if ip.To4() != nil {
+		return "0.0.0.0/0", "ipv4", nil
+	}
+	return "::/0", "ipv6", nil
+}
+
+// NetplanConfig returns the netplan configuration which assigns the static address of the given
+// network configuration to the ethernet interface of the node. Like on CoreOS, a single NIC is
+// expected, which is matched by the 'en' prefix of ethernet devices.
+func NetplanConfig(network *providerconfigtypes.NetworkConfig) (string, error) {
+	defaultRoute, _, err := staticNetwork(network)
+	if err != nil {
+		return "", err
+	}
+
+	config := fmt.Sprintf(`network:
+  version: 2
+  ethernets:
+    static-nic:
+      match:
+        name: "en*"
+      dhcp4: false
+      dhcp6: false
+      addresses:
+      - %s`, network.CIDR)
+	if network.Gateway != "" {
+		config += fmt.Sprintf(`
+      routes:
+      - to: "%s"
+        via: "%s"`, defaultRoute, network.Gateway)
+	}
+	if len(network.DNS.Servers) > 0 {
+		config += fmt.Sprintf(`
+      nameservers:
+        addresses: ["%s"]`, strings.Join(network.DNS.Servers, `", "`))
+	}
+	return config + "\n", nil
+}
+
+// NetworkManagerKeyfile returns the NetworkManager connection which assigns the static address of
+// the given network configuration to the ethernet interface of the node, see NetplanConfig.
+func NetworkManagerKeyfile(network *providerconfigtypes.NetworkConfig) (string, error) {
+	_, family, err := staticNetwork(network)
+	if err != nil {
+		return "", err
+	}
+	// The method to turn off the other family differs, NetworkManager doesn't accept ignore for IPv4
+	otherFamily := "[ipv6]\nmethod=ignore"
+	if family == "ipv6" {
+		otherFamily = "[ipv4]\nmethod=disabled"
+	}
+
+	address := network.CIDR
+	if network.Gateway != "" {
+		address += "," + network.Gateway
+	}
+	config := fmt.Sprintf(`[connection]
+id=static-nic
+type=ethernet
+autoconnect-priority=100
+
+[match]
+interface-name=en*
+
+[%s]
+method=manual
+address1=%s`, family, address)
+	if len(network.DNS.Servers) > 0 {
+		config += fmt.Sprintf("\ndns=%s;", strings.Join(network.DNS.Servers, ";"))
+	}
+	return config + "\n\n" + otherFamily + "\n", nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/test"
+)
+
+func TestSetupNodeIPEnvScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		network *providerconfigtypes.NodeNetworkSettings
+	}{
+		{
+			name: "setup_node_ip_env_ipv4",
+		},
+		{
+			name: "setup_node_ip_env_ipv6_mtu",
+			network: &providerconfigtypes.NodeNetworkSettings{
+				IPFamily: providerconfigtypes.NodeIPFamilyIPv6,
+				MTU:      1400,
+			},
+		},
+		{
+			name: "setup_node_ip_env_dual_stack_resolv_conf",
+			network: &providerconfigtypes.NodeNetworkSettings{
+				IPFamily: providerconfigtypes.NodeIPFamilyIPv6IPv4,
+				ResolvConf: &providerconfigtypes.ResolvConfSettings{
+					Search:  []string{"example.com", "corp.local"},
+					Options: []string{"ndots:2"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script := SetupNodeIPEnvScript(tc.network)
+			goldenName := tc.name + ".golden"
+			test.CompareOutput(t, goldenName, script, *update)
+		})
+	}
+}
+
+func TestStaticNetworkConfig(t *testing.T) {
+	ipv4 := &providerconfigtypes.NetworkConfig{
+		CIDR:    "10.0.10.12/24",
+		Gateway: "10.0.10.1",
+		DNS:     providerconfigtypes.DNSConfig{Servers: []string{"10.0.0.53", "10.0.0.54"}},
+	}
+	ipv6 := &providerconfigtypes.NetworkConfig{
+		CIDR:    "fd00::12/64",
+		Gateway: "fd00::1",
+		DNS:     providerconfigtypes.DNSConfig{Servers: []string{"fd00::53"}},
+	}
+
+	tests := []struct {
+		name    string
+		render  func(*providerconfigtypes.NetworkConfig) (string, error)
+		network *providerconfigtypes.NetworkConfig
+	}{
+		{
+			name:    "netplan_static_ipv4",
+			render:  NetplanConfig,
+			network: ipv4,
+		},
+		{
+			name:    "netplan_static_ipv6",
+			render:  NetplanConfig,
+			network: ipv6,
+		},
+		{
+			name:    "networkmanager_static_ipv4",
+			render:  NetworkManagerKeyfile,
+			network: ipv4,
+		},
+		{
+			name:    "networkmanager_static_ipv6",
+			render:  NetworkManagerKeyfile,
+			network: ipv6,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := tc.render(tc.network)
+			if err != nil {
+				t.Fatalf("failed to render the network config: %v", err)
+			}
+			test.CompareOutput(t, tc.name+".golden", config, *update)
+		})
+	}
+
+	if _, err := NetplanConfig(&providerconfigtypes.NetworkConfig{CIDR: "10.0.10.12"}); err == nil {
+		t.Error("expected an error for an address without prefix length")
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"fmt"
+	"strings"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+const (
+	// DefaultPreJoinMinFreeDiskMB is the disk space the pre-join checks require if none is configured.
+	DefaultPreJoinMinFreeDiskMB = 2048
+
+	// The join token must not end up in the log of the setup, so the checks run without tracing
+	preJoinChecksHeader = `# pre-join checks
+{ set +x; } 2>/dev/null
+prejoin_failures=()
+prejoin_fail() {
+  echo "pre-join check failed: $1" >&2
+  prejoin_failures+=("$1")
+}`
+
+	preJoinTimeSyncCheck = `for _ in $(seq 30); do
+  [[ "$(timedatectl show -p NTPSynchronized --value)" == "yes" ]] && break
+  sleep 2
+done
+[[ "$(timedatectl show -p NTPSynchronized --value)" == "yes" ]] || prejoin_fail "the clock is not synchronized"`
+
+	preJoinDiskCheckTpl = `prejoin_free_mb=$(df --output=avail -BM /var/lib | tail -n1 | tr -dc '0-9')
+[[ "${prejoin_free_mb}" -ge %[1]d ]] || prejoin_fail "only ${prejoin_free_mb} MiB of disk space are free below /var/lib, at least %[1]d MiB are required"`
+
+	preJoinCgroupV2Check = `[[ "$(stat -fc %T /sys/fs/cgroup)" == "cgroup2fs" ]] || prejoin_fail "the node does not run with cgroup v2"`
+
+	// any HTTP response, even an unauthorized one, means the controller is reachable
+	preJoinControllerCheckTpl = `prejoin_kubeconfig=$(base64 -d < %s | gunzip)
+prejoin_server=$(sed -n 's/^ *server: *//p' <<< "${prejoin_kubeconfig}" | head -n1)
+curl -sk -o /dev/null --max-time 10 "${prejoin_server}" || prejoin_fail "the controller ${prejoin_server} is not reachable"`
+
+	// the bootstrap token of workers may create events, so the failures are visible before the node registers
+	preJoinReportScript = `if [[ ${#prejoin_failures[@]} -gt 0 ]]; then
+  prejoin_node=$(hostname | tr '[:upper:]' '[:lower:]')
+  prejoin_now=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+  prejoin_message=$(printf '%s; ' "${prejoin_failures[@]}")
+  prejoin_token=$(sed -n 's/^ *token: *//p' <<< "${prejoin_kubeconfig}" | head -n1)
+  prejoin_ca=$(mktemp)
+  sed -n 's/^ *certificate-authority-data: *//p' <<< "${prejoin_kubeconfig}" | head -n1 | base64 -d > "${prejoin_ca}"
+  curl -s -o /dev/null --max-time 10 --cacert "${prejoin_ca}" -X POST \
+    -H "Authorization: Bearer ${prejoin_token}" -H "Content-Type: application/json" \
+    -d "{\"metadata\":{\"generateName\":\"${prejoin_node}.\"},\"involvedObject\":{\"kind\":\"Node\",\"name\":\"${prejoin_node}\",\"uid\":\"${prejoin_node}\"},\"reason\":\"PreJoinCheckFailed\",\"message\":\"${prejoin_message%; }\",\"type\":\"Warning\",\"source\":{\"component\":\"machine-controller-prejoin\",\"host\":\"${prejoin_node}\"},\"firstTimestamp\":\"${prejoin_now}\",\"lastTimestamp\":\"${prejoin_now}\",\"count\":1}" \
+    "${prejoin_server}/api/v1/namespaces/default/events" || true
+  rm -f "${prejoin_ca}"
+fi`
+
+	preJoinFailScript = `if [[ ${#prejoin_failures[@]} -gt 0 ]]; then
+  echo "pre-join checks failed, not joining the cluster" >&2
+  exit 1
+fi`
+)
+
+// PreJoinCheckScript returns the script which runs the given pre-join checks on a node with the given role,
+// before it joins with the k0s join token in the given file. Single nodes join no cluster, so their
+// connectivity isn't checked. Only the failures of workers are reported as events of their node, the
+// join tokens of controllers can't authenticate against the kube-apiserver.
+func PreJoinCheckScript(checks *providerconfigtypes.PreJoinChecks, role providerconfigtypes.NodeRole, tokenFile string) string {
+	minFreeDiskMB := checks.MinFreeDiskMB
+	if minFreeDiskMB == 0 {
+		minFreeDiskMB = DefaultPreJoinMinFreeDiskMB
+	}
+
+	scripts := []string{preJoinChecksHeader, preJoinTimeSyncCheck, fmt.Sprintf(preJoinDiskCheckTpl, minFreeDiskMB)}
+	if checks.RequireCgroupV2 {
+		scripts = append(scripts, preJoinCgroupV2Check)
+	}
+	if role != providerconfigtypes.NodeRoleSingle {
+		scripts = append(scripts, fmt.Sprintf(preJoinControllerCheckTpl, tokenFile))
+	}
+	if role == providerconfigtypes.NodeRoleWorker {
+		scripts = append(scripts, preJoinReportScript)
+	}
+	scripts = append(scripts, "set -x")
+	if checks.FailJoin {
+		scripts = append(scripts, preJoinFailScript)
+	}
+	return strings.Join(scripts, "\n")
+}
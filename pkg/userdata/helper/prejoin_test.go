@@ -0,0 +1,55 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/test"
+)
+
+func TestPreJoinCheckScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks *providerconfigtypes.PreJoinChecks
+		role   providerconfigtypes.NodeRole
+	}{
+		{
+			name:   "prejoin_checks_worker",
+			checks: &providerconfigtypes.PreJoinChecks{},
+			role:   providerconfigtypes.NodeRoleWorker,
+		},
+		{
+			name: "prejoin_checks_single_fail_join",
+			checks: &providerconfigtypes.PreJoinChecks{
+				MinFreeDiskMB:   10240,
+				RequireCgroupV2: true,
+				FailJoin:        true,
+			},
+			role: providerconfigtypes.NodeRoleSingle,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script := PreJoinCheckScript(tc.checks, tc.role, K0sJoinTokenPath)
+			goldenName := tc.name + ".golden"
+			test.CompareOutput(t, goldenName, script, *update)
+		})
+	}
+}
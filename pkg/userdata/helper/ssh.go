@@ -0,0 +1,29 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+// SSHPasswordAuthentication returns the cloud-init ssh_pwauth value of the given settings.
+func SSHPasswordAuthentication(ssh *providerconfigtypes.SSHSettings) string {
+	if ssh != nil && ssh.PasswordAuthentication {
+		return "yes"
+	}
+	return "no"
+}
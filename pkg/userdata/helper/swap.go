@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"fmt"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// DefaultSwapBehavior is the swap behavior of the kubelet if none is configured.
+	DefaultSwapBehavior = "LimitedSwap"
+
+	// SwapfilePath is the path of the swapfile provisioned on nodes with swap enabled.
+	SwapfilePath = "/swapfile"
+
+	// dd instead of fallocate, as swapon refuses preallocated files on XFS of older kernels
+	swapfileScriptTpl = `if [[ ! -f %[1]s ]]; then
+  dd if=/dev/zero of=%[1]s bs=1M count=%[2]d
+  chmod 0600 %[1]s
+  mkswap %[1]s
+fi
+grep -q '^%[1]s ' /etc/fstab || echo '%[1]s none swap sw 0 0' >> /etc/fstab
+swapon --show=NAME --noheadings | grep -qx %[1]s || swapon %[1]s`
+)
+
+// SwapBehavior returns the swap behavior of the given settings.
+func SwapBehavior(swap *providerconfigtypes.SwapSettings) string {
+	if swap.SwapBehavior == "" {
+		return DefaultSwapBehavior
+	}
+	return swap.SwapBehavior
+}
+
+// SwapSizeBytes returns the size of the swapfile in bytes.
+func SwapSizeBytes(swap *providerconfigtypes.SwapSettings) (int64, error) {
+	size, err := resource.ParseQuantity(swap.Size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid swap size %q: %v", swap.Size, err)
+	}
+	if size.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid swap size %q: must be greater than 0", swap.Size)
+	}
+	return size.Value(), nil
+}
+
+// SwapfileScript returns the script which provisions and enables the swapfile.
+func SwapfileScript(swap *providerconfigtypes.SwapSettings) (string, error) {
+	size, err := SwapSizeBytes(swap)
+	if err != nil {
+		return "", err
+	}
+	// round up to full MiB
+	sizeMiB := (size + 1<<20 - 1) >> 20
+	return fmt.Sprintf(swapfileScriptTpl, SwapfilePath, sizeMiB), nil
+}
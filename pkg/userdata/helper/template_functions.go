@@ -30,6 +30,7 @@ func TxtFuncMap() template.FuncMap {
 	funcMap["downloadBinariesScript"] = DownloadBinariesScript
 	funcMap["safeDownloadBinariesScript"] = SafeDownloadBinariesScript
 	funcMap["kubeletSystemdUnit"] = KubeletSystemdUnit
+	funcMap["kubeletContainerdSystemdUnit"] = KubeletSystemdUnitContainerd
 	funcMap["kubeletConfiguration"] = kubeletConfiguration
 	funcMap["kubeletFlags"] = KubeletFlags
 	funcMap["cloudProviderFlags"] = CloudProviderFlags
@@ -39,7 +40,24 @@ func TxtFuncMap() template.FuncMap {
 	funcMap["kubeletHealthCheckSystemdUnit"] = KubeletHealthCheckSystemdUnit
 	funcMap["containerRuntimeHealthCheckSystemdUnit"] = ContainerRuntimeHealthCheckSystemdUnit
 	funcMap["dockerConfig"] = DockerConfig
+	funcMap["containerdConfig"] = ContainerdConfig
 	funcMap["proxyEnvironment"] = ProxyEnvironment
+	funcMap["proxyEnvironmentWithHTTPSProxy"] = ProxyEnvironmentWithHTTPSProxy
+	funcMap["k0sInstallWorkerScript"] = K0sInstallWorkerScript
+	funcMap["k0sInstallControllerScript"] = K0sInstallControllerScript
+	funcMap["k0sInstallSingleScript"] = K0sInstallSingleScript
+	funcMap["cisSysctlSettings"] = CISSysctlSettings
+	funcMap["cisModprobeConfig"] = CISModprobeConfig
+	funcMap["cisSSHDConfig"] = CISSSHDConfig
+	funcMap["cisAuditRules"] = CISAuditRules
+	funcMap["cisHardeningScript"] = CISHardeningScript
+	funcMap["swapfileScript"] = SwapfileScript
+	funcMap["sshPasswordAuthentication"] = SSHPasswordAuthentication
+	funcMap["gpuDriverScript"] = GPUDriverScript
+	funcMap["updatePolicyScript"] = UpdatePolicyScript
+	funcMap["preJoinCheckScript"] = PreJoinCheckScript
+	funcMap["netplanConfig"] = NetplanConfig
+	funcMap["networkManagerKeyfile"] = NetworkManagerKeyfile
 
 	return funcMap
 }
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"fmt"
+	"strings"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+const (
+	aptDisableUpdatesScript = `# disable unattended upgrades
+systemctl disable --now apt-daily.timer apt-daily-upgrade.timer unattended-upgrades.service || true
+echo -e 'APT::Periodic::Update-Package-Lists "0";\nAPT::Periodic::Unattended-Upgrade "0";' > /etc/apt/apt.conf.d/20auto-upgrades`
+
+	// nodes never reboot on their own, the machine-controller replaces them instead
+	aptEnableUpdatesScript = `# enable unattended upgrades
+DEBIAN_FRONTEND=noninteractive apt-get -o Dpkg::Options::="--force-confdef" -o Dpkg::Options::="--force-confold" install -y unattended-upgrades
+echo -e 'APT::Periodic::Update-Package-Lists "1";\nAPT::Periodic::Unattended-Upgrade "1";' > /etc/apt/apt.conf.d/20auto-upgrades
+echo 'Unattended-Upgrade::Automatic-Reboot "false";' > /etc/apt/apt.conf.d/52machine-controller-no-reboot
+systemctl enable --now apt-daily.timer apt-daily-upgrade.timer unattended-upgrades.service`
+
+	yumDisableUpdatesScript = `# disable automatic updates
+for unit in dnf-automatic.timer dnf-automatic-install.timer yum-cron.service; do
+  systemctl disable --now "${unit}" 2>/dev/null || true
+done`
+
+	// yum-cron is the predecessor of dnf-automatic on RHEL 7 based operating systems
+	yumEnableUpdatesScript = `# enable automatic updates
+if command -v dnf &> /dev/null; then
+  dnf install -y dnf-automatic
+  sed -i 's/^apply_updates = .*/apply_updates = yes/' /etc/dnf/automatic.conf
+  systemctl enable --now dnf-automatic.timer
+else
+  yum install -y yum-cron
+  sed -i 's/^apply_updates = .*/apply_updates = yes/' /etc/yum/yum-cron.conf
+  systemctl enable --now yum-cron.service
+fi`
+
+	pinPackagesScriptTpl = `# hold the container runtime on its version, updates would restart it
+%s`
+)
+
+// UpdatePolicyScript returns the script which applies the given update policy on the given
+// operating system.
+func UpdatePolicyScript(os providerconfigtypes.OperatingSystem, policy *providerconfigtypes.UpdatePolicySettings) (string, error) {
+	var disable, enable, pin string
+	switch os {
+	case providerconfigtypes.OperatingSystemUbuntu:
+		// k0s ships the kubelet and containerd in its binary, they only change with the k0s version
+		disable, enable = aptDisableUpdatesScript, aptEnableUpdatesScript
+	case providerconfigtypes.OperatingSystemCentOS, providerconfigtypes.OperatingSystemRHEL:
+		disable, enable = yumDisableUpdatesScript, yumEnableUpdatesScript
+		pin = "yum versionlock add containerd.io"
+	case providerconfigtypes.OperatingSystemRockyLinux, providerconfigtypes.OperatingSystemAlmaLinux:
+		disable, enable = yumDisableUpdatesScript, yumEnableUpdatesScript
+		pin = "dnf versionlock add containerd.io"
+	case providerconfigtypes.OperatingSystemAmazonLinux2023:
+		disable, enable = yumDisableUpdatesScript, yumEnableUpdatesScript
+		pin = "dnf install -y python3-dnf-plugin-versionlock\ndnf versionlock add containerd"
+	default:
+		return "", fmt.Errorf("update policies are not supported on %s", os)
+	}
+
+	// pin first, the enabled updates must not pick up the packages
+	var scripts []string
+	if policy.PinPackages && pin != "" {
+		scripts = append(scripts, fmt.Sprintf(pinPackagesScriptTpl, pin))
+	}
+	if policy.AutomaticUpdates != nil {
+		if *policy.AutomaticUpdates {
+			scripts = append(scripts, enable)
+		} else {
+			scripts = append(scripts, disable)
+		}
+	}
+	return strings.Join(scripts, "\n\n"), nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/test"
+
+	"k8s.io/utils/pointer"
+)
+
+func TestUpdatePolicyScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		os     providerconfigtypes.OperatingSystem
+		policy *providerconfigtypes.UpdatePolicySettings
+	}{
+		{
+			name: "update_policy_ubuntu_disabled",
+			os:   providerconfigtypes.OperatingSystemUbuntu,
+			policy: &providerconfigtypes.UpdatePolicySettings{
+				AutomaticUpdates: pointer.BoolPtr(false),
+				PinPackages:      true,
+			},
+		},
+		{
+			name: "update_policy_rockylinux_enabled_pinned",
+			os:   providerconfigtypes.OperatingSystemRockyLinux,
+			policy: &providerconfigtypes.UpdatePolicySettings{
+				AutomaticUpdates: pointer.BoolPtr(true),
+				PinPackages:      true,
+			},
+		},
+		{
+			name: "update_policy_amzn2023_pinned",
+			os:   providerconfigtypes.OperatingSystemAmazonLinux2023,
+			policy: &providerconfigtypes.UpdatePolicySettings{
+				PinPackages: true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script, err := UpdatePolicyScript(tc.os, tc.policy)
+			if err != nil {
+				t.Fatalf("failed to generate update policy script: %v", err)
+			}
+			goldenName := tc.name + ".golden"
+			test.CompareOutput(t, goldenName, script, *update)
+		})
+	}
+}
@@ -25,6 +25,7 @@ package manager
 import (
 	"errors"
 	"flag"
+	"fmt"
 
 	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
@@ -41,54 +42,93 @@ var (
 	// correct ones are installed.
 	ErrPluginNotFound = errors.New("no user data plugin for the given operating system found")
 
-	// supportedOS contains a list of operating systems the machine
-	// controller supports.
-	supportedOS = []providerconfigtypes.OperatingSystem{
-		providerconfigtypes.OperatingSystemCentOS,
-		providerconfigtypes.OperatingSystemCoreos,
-		providerconfigtypes.OperatingSystemUbuntu,
-		providerconfigtypes.OperatingSystemSLES,
-		providerconfigtypes.OperatingSystemRHEL,
-		providerconfigtypes.OperatingSystemFlatcar,
+	// supportedOS maps the operating systems the machine controller supports
+	// to the bootstrap flavors their plugins implement. The first flavor is the
+	// default of the operating system, its plugin is named after the operating
+	// system only. Plugins of other flavors carry the flavor as suffix.
+	supportedOS = map[providerconfigtypes.OperatingSystem][]providerconfigtypes.BootstrapFlavor{
+		providerconfigtypes.OperatingSystemCentOS:          {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemCoreos:          {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemUbuntu:          {providerconfigtypes.BootstrapFlavorK0s},
+		providerconfigtypes.OperatingSystemSLES:            {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemRHEL:            {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemFlatcar:         {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemRockyLinux:      {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemAlmaLinux:       {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemAmazonLinux2023: {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemFedoraCoreOS:    {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemOpenSUSE:        {providerconfigtypes.BootstrapFlavorKubeadm},
+		providerconfigtypes.OperatingSystemWindows:         {providerconfigtypes.BootstrapFlavorKubeadm},
 	}
 )
 
+// key identifies the plugin of an operating system and bootstrap flavor.
+type key struct {
+	os     providerconfigtypes.OperatingSystem
+	flavor providerconfigtypes.BootstrapFlavor
+}
+
 // Manager inits and manages the userdata plugins.
 type Manager struct {
 	debug   bool
-	plugins map[providerconfigtypes.OperatingSystem]*Plugin
+	plugins map[key]*Plugin
 }
 
 // New returns an initialised plugin manager.
 func New() (*Manager, error) {
 	m := &Manager{
-		plugins: make(map[providerconfigtypes.OperatingSystem]*Plugin),
+		plugins: make(map[key]*Plugin),
 	}
 	flag.BoolVar(&m.debug, "plugin-debug", false, "Switch for enabling the plugin debugging")
-	m.locatePlugins()
-	if len(m.plugins) < len(supportedOS) {
-		return nil, ErrLocatingPlugins
+	if err := m.locatePlugins(); err != nil {
+		return nil, err
 	}
 	return m, nil
 }
 
-// ForOS returns the plugin for the given operating system.
-func (m *Manager) ForOS(os providerconfigtypes.OperatingSystem) (p *Plugin, err error) {
+// ForOS returns the plugin for the given operating system and bootstrap
+// flavor. An empty flavor selects the default flavor of the operating system.
+func (m *Manager) ForOS(os providerconfigtypes.OperatingSystem, flavor providerconfigtypes.BootstrapFlavor) (p *Plugin, err error) {
+	if flavor == "" {
+		flavor = DefaultBootstrapFlavor(os)
+	}
 	var found bool
-	if p, found = m.plugins[os]; !found {
+	if p, found = m.plugins[key{os: os, flavor: flavor}]; !found {
 		return nil, ErrPluginNotFound
 	}
 	return p, nil
 }
 
+// DefaultBootstrapFlavor returns the bootstrap flavor used for machines
+// of the given operating system which don't set one.
+func DefaultBootstrapFlavor(os providerconfigtypes.OperatingSystem) providerconfigtypes.BootstrapFlavor {
+	flavors := supportedOS[os]
+	if len(flavors) == 0 {
+		return ""
+	}
+	return flavors[0]
+}
+
 // locatePlugins tries to find the plugins and inits their wrapper.
-func (m *Manager) locatePlugins() {
-	for _, os := range supportedOS {
-		plugin, err := newPlugin(os, m.debug)
-		if err != nil {
-			klog.Errorf("cannot use plugin '%v': %v", os, err)
-			continue
+func (m *Manager) locatePlugins() error {
+	var missing bool
+	for os, flavors := range supportedOS {
+		for i, flavor := range flavors {
+			name := string(os)
+			if i > 0 {
+				name = fmt.Sprintf("%s-%s", os, flavor)
+			}
+			plugin, err := newPlugin(name, m.debug)
+			if err != nil {
+				klog.Errorf("cannot use plugin '%v': %v", name, err)
+				missing = true
+				continue
+			}
+			m.plugins[key{os: os, flavor: flavor}] = plugin
 		}
-		m.plugins[os] = plugin
 	}
+	if missing {
+		return ErrLocatingPlugins
+	}
+	return nil
 }
@@ -29,7 +29,6 @@ import (
 	"strings"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
-	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 
 	"k8s.io/klog"
 )
@@ -48,11 +47,11 @@ type Plugin struct {
 
 // newPlugin creates a new plugin manager. It starts the named
 // binary and connects to it via net/rpc.
-func newPlugin(os providerconfigtypes.OperatingSystem, debug bool) (*Plugin, error) {
+func newPlugin(name string, debug bool) (*Plugin, error) {
 	p := &Plugin{
 		debug: debug,
 	}
-	if err := p.findPlugin(string(os)); err != nil {
+	if err := p.findPlugin(name); err != nil {
 		return nil, err
 	}
 	return p, nil
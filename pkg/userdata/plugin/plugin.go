@@ -29,13 +29,12 @@ import (
 	"os"
 
 	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
+	"github.com/kubermatic/machine-controller/pkg/userdata"
 )
 
 // Provider defines the interface each plugin has to implement
 // for the retrieval of the userdata based on the given arguments.
-type Provider interface {
-	UserData(req plugin.UserDataRequest) (string, error)
-}
+type Provider = userdata.Provider
 
 // Plugin implements a convenient helper to map the request to the given
 // provider and return the response.
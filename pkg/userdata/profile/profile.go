@@ -0,0 +1,210 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+//
+// UserData provider for OperatingSystemProfiles.
+//
+
+// Package profile renders the userdata of machines referencing an
+// OperatingSystemProfile. Unlike the userdata plugins it runs inside
+// the machine controller, as the template comes from the cluster.
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/Masterminds/semver"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	"github.com/kubermatic/machine-controller/pkg/userdata/convert"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// imageFields maps the cloud providers to the cloudProviderSpec field holding the image.
+var imageFields = map[providerconfigtypes.CloudProvider]string{
+	providerconfigtypes.CloudProviderAWS:       "ami",
+	providerconfigtypes.CloudProviderAzure:     "imageID",
+	providerconfigtypes.CloudProviderGoogle:    "customImage",
+	providerconfigtypes.CloudProviderHetzner:   "image",
+	providerconfigtypes.CloudProviderOpenstack: "image",
+	providerconfigtypes.CloudProviderVsphere:   "templateVMName",
+	providerconfigtypes.CloudProviderAnexia:    "templateID",
+}
+
+// Provider is a pkg/userdata/plugin.Provider implementation rendering
+// the template of an OperatingSystemProfile.
+type Provider struct {
+	profile *clusterv1alpha1.OperatingSystemProfile
+}
+
+// New returns a Provider for the given profile.
+func New(profile *clusterv1alpha1.OperatingSystemProfile) *Provider {
+	return &Provider{profile: profile}
+}
+
+// UserData renders the profile template to string.
+func (p *Provider) UserData(req plugin.UserDataRequest) (string, error) {
+	tmpl, err := parseTemplate(p.profile)
+	if err != nil {
+		return "", err
+	}
+
+	kubeletVersion, err := semver.NewVersion(req.MachineSpec.Versions.Kubelet)
+	if err != nil {
+		return "", fmt.Errorf("invalid kubelet version: '%v'", err)
+	}
+
+	pconfig, err := providerconfigtypes.GetConfig(req.MachineSpec.ProviderSpec)
+	if err != nil {
+		return "", fmt.Errorf("failed to get provider config: %v", err)
+	}
+
+	if pconfig.OverwriteCloudConfig != nil {
+		req.CloudConfig = *pconfig.OverwriteCloudConfig
+	}
+
+	serverAddr, err := userdatahelper.GetServerAddressFromKubeconfig(req.Kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("error extracting server address from kubeconfig: %v", err)
+	}
+
+	kubeconfigString, err := userdatahelper.StringifyKubeconfig(req.Kubeconfig)
+	if err != nil {
+		return "", err
+	}
+
+	kubernetesCACert, err := userdatahelper.GetCACert(req.Kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("error extracting cacert: %v", err)
+	}
+
+	data := struct {
+		plugin.UserDataRequest
+		ProviderSpec     *providerconfigtypes.Config
+		KubeletVersion   string
+		ServerAddr       string
+		Kubeconfig       string
+		KubernetesCACert string
+		NodeIPScript     string
+	}{
+		UserDataRequest:  req,
+		ProviderSpec:     pconfig,
+		KubeletVersion:   kubeletVersion.String(),
+		ServerAddr:       serverAddr,
+		Kubeconfig:       kubeconfigString,
+		KubernetesCACert: kubernetesCACert,
+		NodeIPScript:     userdatahelper.SetupNodeIPEnvScript(pconfig.NodeNetwork),
+	}
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute template of operating system profile %q: %v", p.profile.Name, err)
+	}
+	out, err := userdatahelper.CleanupTemplateOutput(b.String())
+	if err != nil {
+		return "", err
+	}
+
+	if p.profile.Spec.Format == clusterv1alpha1.UserDataFormatIgnition {
+		if providerconfigtypes.OperatingSystem(p.profile.Spec.OperatingSystem) == providerconfigtypes.OperatingSystemFedoraCoreOS {
+			return convert.ButaneToIgnition(out)
+		}
+		return convert.ToIgnition(out)
+	}
+	return out, nil
+}
+
+// Validate checks if the given profile can be used to render userdata.
+func Validate(profile *clusterv1alpha1.OperatingSystemProfile) error {
+	if !isSupportedOS(providerconfigtypes.OperatingSystem(profile.Spec.OperatingSystem)) {
+		return fmt.Errorf("operating system %q of operating system profile %q is not supported", profile.Spec.OperatingSystem, profile.Name)
+	}
+
+	switch profile.Spec.Format {
+	case clusterv1alpha1.UserDataFormatCloudInit, clusterv1alpha1.UserDataFormatIgnition:
+	default:
+		return fmt.Errorf("invalid format %q of operating system profile %q, must be one of %q or %q",
+			profile.Spec.Format, profile.Name, clusterv1alpha1.UserDataFormatCloudInit, clusterv1alpha1.UserDataFormatIgnition)
+	}
+
+	_, err := parseTemplate(profile)
+	return err
+}
+
+// ApplyToConfig defaults the operating system and the image of the given provider
+// config from the profile. Images set in the cloudProviderSpec take precedence.
+func ApplyToConfig(profile *clusterv1alpha1.OperatingSystemProfile, pconfig *providerconfigtypes.Config) error {
+	profileOS := providerconfigtypes.OperatingSystem(profile.Spec.OperatingSystem)
+	if pconfig.OperatingSystem == "" {
+		pconfig.OperatingSystem = profileOS
+	}
+	if pconfig.OperatingSystem != profileOS {
+		return fmt.Errorf("operating system %q does not match the operating system %q of operating system profile %q",
+			pconfig.OperatingSystem, profileOS, profile.Name)
+	}
+
+	image := profile.Spec.Images[string(pconfig.CloudProvider)]
+	if image == "" {
+		return nil
+	}
+	field, ok := imageFields[pconfig.CloudProvider]
+	if !ok {
+		return fmt.Errorf("operating system profile %q sets an image for cloud provider %q which does not support custom images",
+			profile.Name, pconfig.CloudProvider)
+	}
+
+	cloudProviderSpec := map[string]interface{}{}
+	if len(pconfig.CloudProviderSpec.Raw) > 0 {
+		if err := json.Unmarshal(pconfig.CloudProviderSpec.Raw, &cloudProviderSpec); err != nil {
+			return fmt.Errorf("failed to unmarshal cloudProviderSpec: %v", err)
+		}
+	}
+	if value, exists := cloudProviderSpec[field]; exists && value != nil && value != "" {
+		return nil
+	}
+	cloudProviderSpec[field] = image
+
+	raw, err := json.Marshal(cloudProviderSpec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cloudProviderSpec: %v", err)
+	}
+	pconfig.CloudProviderSpec = runtime.RawExtension{Raw: raw}
+	return nil
+}
+
+func parseTemplate(profile *clusterv1alpha1.OperatingSystemProfile) (*template.Template, error) {
+	tmpl, err := template.New(profile.Name).Funcs(userdatahelper.TxtFuncMap()).Parse(profile.Spec.Template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template of operating system profile %q: %v", profile.Name, err)
+	}
+	return tmpl, nil
+}
+
+func isSupportedOS(os providerconfigtypes.OperatingSystem) bool {
+	for _, supported := range providerconfigtypes.AllOperatingSystems {
+		if os == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profile
+
+import (
+	"encoding/json"
+	"testing"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const testTemplate = `#cloud-config
+hostname: {{ .MachineSpec.Name }}
+
+ssh_authorized_keys:
+{{- range .ProviderSpec.SSHPublicKeys }}
+  - "{{ . }}"
+{{- end }}
+
+runcmd:
+- /opt/bin/bootstrap --server {{ .ServerAddr }} --kubelet {{ .KubeletVersion }} --cloud-provider {{ .CloudProviderName }}
+`
+
+const expectedUserData = `#cloud-config
+hostname: node1
+
+ssh_authorized_keys:
+  - "ssh-rsa AAABBB"
+
+runcmd:
+- /opt/bin/bootstrap --server server:443 --kubelet 1.17.3 --cloud-provider aws
+`
+
+func newProfile(format clusterv1alpha1.UserDataFormat, template string, images map[string]string) *clusterv1alpha1.OperatingSystemProfile {
+	return &clusterv1alpha1.OperatingSystemProfile{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden-ubuntu"},
+		Spec: clusterv1alpha1.OperatingSystemProfileSpec{
+			OperatingSystem: string(providerconfigtypes.OperatingSystemUbuntu),
+			Format:          format,
+			Template:        template,
+			Images:          images,
+		},
+	}
+}
+
+func TestUserData(t *testing.T) {
+	pconfig := providerconfigtypes.Config{
+		SSHPublicKeys:          []string{"ssh-rsa AAABBB"},
+		CloudProvider:          providerconfigtypes.CloudProviderAWS,
+		OperatingSystem:        providerconfigtypes.OperatingSystemUbuntu,
+		OperatingSystemProfile: "golden-ubuntu",
+	}
+	raw, err := json.Marshal(pconfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := plugin.UserDataRequest{
+		MachineSpec: clusterv1alpha1.MachineSpec{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Versions: clusterv1alpha1.MachineVersionInfo{
+				Kubelet: "1.17.3",
+			},
+			ProviderSpec: clusterv1alpha1.ProviderSpec{
+				Value: &runtime.RawExtension{Raw: raw},
+			},
+		},
+		Kubeconfig: &clientcmdapi.Config{
+			Clusters: map[string]*clientcmdapi.Cluster{
+				"": {
+					Server:                   "https://server:443",
+					CertificateAuthorityData: []byte("ca"),
+				},
+			},
+			AuthInfos: map[string]*clientcmdapi.AuthInfo{
+				"": {
+					Token: "my-token",
+				},
+			},
+		},
+		CloudProviderName: "aws",
+	}
+
+	s, err := New(newProfile(clusterv1alpha1.UserDataFormatCloudInit, testTemplate, nil)).UserData(req)
+	if err != nil {
+		t.Fatalf("error getting userdata: %v", err)
+	}
+	if s != expectedUserData {
+		t.Errorf("unexpected userdata, expected:\n%s\ngot:\n%s", expectedUserData, s)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *clusterv1alpha1.OperatingSystemProfile
+		wantErr bool
+	}{
+		{
+			name:    "valid profile",
+			profile: newProfile(clusterv1alpha1.UserDataFormatCloudInit, testTemplate, nil),
+		},
+		{
+			name:    "invalid format",
+			profile: newProfile("shell", testTemplate, nil),
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			profile: newProfile(clusterv1alpha1.UserDataFormatCloudInit, "{{ .MachineSpec.Name ", nil),
+			wantErr: true,
+		},
+		{
+			name: "unsupported operating system",
+			profile: func() *clusterv1alpha1.OperatingSystemProfile {
+				p := newProfile(clusterv1alpha1.UserDataFormatCloudInit, testTemplate, nil)
+				p.Spec.OperatingSystem = "windows"
+				return p
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.profile)
+			if (err != nil) != test.wantErr {
+				t.Errorf("expected error: %v, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestApplyToConfig(t *testing.T) {
+	images := map[string]string{
+		"aws":     "ami-golden",
+		"packet":  "golden",
+		"vsphere": "golden-template",
+	}
+
+	tests := []struct {
+		name              string
+		config            providerconfigtypes.Config
+		cloudProviderSpec string
+		expectedOS        providerconfigtypes.OperatingSystem
+		expectedSpec      string
+		wantErr           bool
+	}{
+		{
+			name: "defaults operating system and image",
+			config: providerconfigtypes.Config{
+				CloudProvider: providerconfigtypes.CloudProviderAWS,
+			},
+			cloudProviderSpec: `{"instanceType":"t3.small"}`,
+			expectedOS:        providerconfigtypes.OperatingSystemUbuntu,
+			expectedSpec:      `{"ami":"ami-golden","instanceType":"t3.small"}`,
+		},
+		{
+			name: "keeps image of the machine",
+			config: providerconfigtypes.Config{
+				CloudProvider:   providerconfigtypes.CloudProviderVsphere,
+				OperatingSystem: providerconfigtypes.OperatingSystemUbuntu,
+			},
+			cloudProviderSpec: `{"templateVMName":"my-template"}`,
+			expectedOS:        providerconfigtypes.OperatingSystemUbuntu,
+			expectedSpec:      `{"templateVMName":"my-template"}`,
+		},
+		{
+			name: "no image for cloud provider",
+			config: providerconfigtypes.Config{
+				CloudProvider: providerconfigtypes.CloudProviderHetzner,
+			},
+			cloudProviderSpec: `{"serverType":"cx21"}`,
+			expectedOS:        providerconfigtypes.OperatingSystemUbuntu,
+			expectedSpec:      `{"serverType":"cx21"}`,
+		},
+		{
+			name: "mismatching operating system",
+			config: providerconfigtypes.Config{
+				CloudProvider:   providerconfigtypes.CloudProviderAWS,
+				OperatingSystem: providerconfigtypes.OperatingSystemCentOS,
+			},
+			cloudProviderSpec: `{}`,
+			wantErr:           true,
+		},
+		{
+			name: "cloud provider without custom images",
+			config: providerconfigtypes.Config{
+				CloudProvider: providerconfigtypes.CloudProviderPacket,
+			},
+			cloudProviderSpec: `{}`,
+			wantErr:           true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			config.CloudProviderSpec = runtime.RawExtension{Raw: []byte(test.cloudProviderSpec)}
+
+			err := ApplyToConfig(newProfile(clusterv1alpha1.UserDataFormatCloudInit, testTemplate, images), &config)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error: %v, got: %v", test.wantErr, err)
+			}
+			if test.wantErr {
+				return
+			}
+			if config.OperatingSystem != test.expectedOS {
+				t.Errorf("expected operating system %q, got %q", test.expectedOS, config.OperatingSystem)
+			}
+			if string(config.CloudProviderSpec.Raw) != test.expectedSpec {
+				t.Errorf("expected cloudProviderSpec %s, got %s", test.expectedSpec, string(config.CloudProviderSpec.Raw))
+			}
+		})
+	}
+}
@@ -21,12 +21,14 @@ limitations under the License.
 package rhel
 
 import (
+	"encoding/json"
 	"flag"
 	"net"
 	"testing"
 
 	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
 	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
 	testhelper "github.com/kubermatic/machine-controller/pkg/test"
 	"github.com/kubermatic/machine-controller/pkg/userdata/convert"
 
@@ -89,6 +91,7 @@ type userDataTestCase struct {
 	insecureRegistries    []string
 	registryMirrors       []string
 	pauseImage            string
+	osConfig              *Config
 }
 
 // TestUserDataGeneration runs the data generation for different
@@ -172,6 +175,19 @@ func TestUserDataGeneration(t *testing.T) {
 			registryMirrors:   []string{"https://registry.docker-cn.com"},
 			pauseImage:        "192.168.100.100:5000/kubernetes/pause:v3.1",
 		},
+		{
+			name: "kubelet-v1.17-aws-activation-key",
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "1.17.3",
+				},
+			},
+			osConfig: &Config{
+				RHELOrganizationName: providerconfigtypes.ConfigVarString{Value: "kubermatic"},
+				RHELActivationKey:    providerconfigtypes.ConfigVarString{Value: "my-activation-key"},
+			},
+		},
 	}
 
 	defaultCloudProvider := &fakeCloudConfigProvider{
@@ -204,6 +220,20 @@ func TestUserDataGeneration(t *testing.T) {
 				Value: &runtime.RawExtension{},
 			}
 			test.spec.ProviderSpec = emtpyProviderSpec
+			if test.osConfig != nil {
+				osConfigByte, err := json.Marshal(test.osConfig)
+				if err != nil {
+					t.Fatal(err)
+				}
+				providerSpecRaw, err := json.Marshal(providerconfigtypes.Config{
+					OperatingSystem:     providerconfigtypes.OperatingSystemRHEL,
+					OperatingSystemSpec: runtime.RawExtension{Raw: osConfigByte},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				test.spec.ProviderSpec.Value.Raw = providerSpecRaw
+			}
 			var cloudProvider *fakeCloudConfigProvider
 			if test.cloudProviderName != nil {
 				cloudProvider = &fakeCloudConfigProvider{
@@ -19,6 +19,8 @@ package rhel
 import (
 	"encoding/json"
 
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -30,8 +32,11 @@ type Config struct {
 	RHSMOfflineToken                string `json:"rhsmOfflineToken,omitempty"`
 	RHELUseSatelliteServer          bool   `json:"rhelUseSatelliteServer"`
 	RHELSatelliteServer             string `json:"rhelSatelliteServer"`
-	RHELOrganizationName            string `json:"rhelOrganizationName"`
-	RHELActivationKey               string `json:"rhelActivationKey"`
+	// RHELOrganizationName and RHELActivationKey register the instance with subscription-manager
+	// using an activation key. Both can be read from a secret, which gets resolved by the machine
+	// controller before the user data is rendered.
+	RHELOrganizationName providerconfigtypes.ConfigVarString `json:"rhelOrganizationName"`
+	RHELActivationKey    providerconfigtypes.ConfigVarString `json:"rhelActivationKey"`
 }
 
 // LoadConfig retrieves the RHEL configuration from raw data.
@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/klog"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// TTL is the duration the userdata can be fetched for after it got stored.
+	TTL = time.Hour
+
+	secretType         corev1.SecretType = "machine-controller/userdata"
+	secretNamePrefix   string            = "machine-userdata-"
+	machineNameLabel   string            = "machine.k8s.io/machine.name"
+	userdataKey        string            = "userdata"
+	expirationKey      string            = "expiration"
+	tokenLength        int               = 32
+	maxCleanupsOnStore int               = 10
+)
+
+var tokenRegexp = regexp.MustCompile(fmt.Sprintf("^[a-z0-9]{%d}$", tokenLength))
+
+// Store stores the userdata of the given machine in a secret, which expires after the
+// given ttl, and returns the token the userdata can be fetched with. Expired secrets
+// of previously stored userdata get deleted.
+func Store(ctx context.Context, client ctrlruntimeclient.Client, machineName, userdata string, ttl time.Duration) (string, error) {
+	if err := deleteExpired(ctx, client); err != nil {
+		klog.Errorf("failed to delete expired userdata secrets: %v", err)
+	}
+
+	token := rand.String(tokenLength)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretNamePrefix + token,
+			Namespace: metav1.NamespaceSystem,
+			Labels:    map[string]string{machineNameLabel: machineName},
+		},
+		Type: secretType,
+		Data: map[string][]byte{
+			userdataKey:   []byte(userdata),
+			expirationKey: []byte(time.Now().Add(ttl).Format(time.RFC3339)),
+		},
+	}
+	if err := client.Create(ctx, secret); err != nil {
+		return "", fmt.Errorf("failed to create userdata secret: %v", err)
+	}
+	return token, nil
+}
+
+func deleteExpired(ctx context.Context, client ctrlruntimeclient.Client) error {
+	secrets := &corev1.SecretList{}
+	if err := client.List(ctx, secrets, ctrlruntimeclient.InNamespace(metav1.NamespaceSystem), ctrlruntimeclient.HasLabels{machineNameLabel}); err != nil {
+		return fmt.Errorf("failed to list secrets: %v", err)
+	}
+
+	deleted := 0
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Type != secretType || !expired(secret) {
+			continue
+		}
+		if err := client.Delete(ctx, secret); err != nil && !kerrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete secret %s: %v", secret.Name, err)
+		}
+		// keep the creation of instances fast, the remaining ones get deleted on the next run
+		if deleted++; deleted >= maxCleanupsOnStore {
+			break
+		}
+	}
+	return nil
+}
+
+func expired(secret *corev1.Secret) bool {
+	expiration, err := time.Parse(time.RFC3339, string(secret.Data[expirationKey]))
+	return err != nil || time.Now().After(expiration)
+}
+
+// Handler serves the stored userdata under the path /<token>.
+type Handler struct {
+	client ctrlruntimeclient.Client
+}
+
+// NewHandler returns a new Handler. The client should not be cache-backed, to not
+// cache all secrets of the cluster.
+func NewHandler(client ctrlruntimeclient.Client) *Handler {
+	return &Handler{client: client}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := path.Base(r.URL.Path)
+	if !tokenRegexp.MatchString(token) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	secret := &corev1.Secret{}
+	if err := h.client.Get(r.Context(), types.NamespacedName{Namespace: metav1.NamespaceSystem, Name: secretNamePrefix + token}, secret); err != nil {
+		if !kerrors.IsNotFound(err) {
+			klog.Errorf("failed to get userdata secret: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if secret.Type != secretType || expired(secret) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	klog.V(3).Infof("Serving userdata of machine %s", secret.Labels[machineNameLabel])
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := w.Write(secret.Data[userdataKey]); err != nil {
+		klog.Errorf("failed to write userdata of machine %s: %v", secret.Labels[machineNameLabel], err)
+	}
+}
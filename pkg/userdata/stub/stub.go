@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+//
+// Package stub replaces the userdata of instances by a small stub, which fetches
+// the full userdata from the machine-controller on boot. It is used for cloud
+// providers which limit the size of the userdata.
+//
+
+package stub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+// ignitionConfig is the subset of an Ignition config, which is the same for all spec versions.
+type ignitionConfig struct {
+	Ignition struct {
+		Version string                   `json:"version"`
+		Config  *ignitionConfigReference `json:"config,omitempty"`
+	} `json:"ignition"`
+}
+
+type ignitionConfigReference struct {
+	Replace struct {
+		Source string `json:"source"`
+	} `json:"replace"`
+}
+
+// Stub returns the userdata which makes the instance fetch the given userdata from
+// the given URL on boot. Ignition configs get replaced by the fetched config,
+// cloud-init includes it.
+func Stub(os providerconfigtypes.OperatingSystem, userdata, url string) (string, error) {
+	if strings.HasPrefix(userdata, "{") {
+		cfg := &ignitionConfig{}
+		if err := json.Unmarshal([]byte(userdata), cfg); err != nil {
+			return "", fmt.Errorf("failed to parse ignition config: %v", err)
+		}
+
+		stub := &ignitionConfig{}
+		stub.Ignition.Version = cfg.Ignition.Version
+		stub.Ignition.Config = &ignitionConfigReference{}
+		stub.Ignition.Config.Replace.Source = url
+
+		out, err := json.Marshal(stub)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal ignition config: %v", err)
+		}
+		return string(out), nil
+	}
+
+	if os == providerconfigtypes.OperatingSystemFlatcar {
+		return "", errors.New("coreos-cloudinit can not include userdata, use the ignition provisioning utility")
+	}
+	return fmt.Sprintf("#include\n%s\n", url), nil
+}
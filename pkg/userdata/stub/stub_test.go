@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stub
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+)
+
+const url = "https://userdata.example.com/abc"
+
+func TestStub(t *testing.T) {
+	tests := []struct {
+		name     string
+		os       providerconfigtypes.OperatingSystem
+		userdata string
+		expected string
+		err      error
+	}{
+		{
+			name:     "cloud-init",
+			os:       providerconfigtypes.OperatingSystemUbuntu,
+			userdata: "#cloud-config\nruncmd: []\n",
+			expected: "#include\nhttps://userdata.example.com/abc\n",
+		},
+		{
+			name:     "ignition v2",
+			os:       providerconfigtypes.OperatingSystemFlatcar,
+			userdata: `{"ignition":{"version":"2.2.0"},"systemd":{}}`,
+			expected: `{"ignition":{"version":"2.2.0","config":{"replace":{"source":"https://userdata.example.com/abc"}}}}`,
+		},
+		{
+			name:     "ignition v3",
+			os:       providerconfigtypes.OperatingSystemFedoraCoreOS,
+			userdata: `{"ignition":{"version":"3.1.0"},"storage":{}}`,
+			expected: `{"ignition":{"version":"3.1.0","config":{"replace":{"source":"https://userdata.example.com/abc"}}}}`,
+		},
+		{
+			name:     "flatcar cloud-init",
+			os:       providerconfigtypes.OperatingSystemFlatcar,
+			userdata: "#cloud-config\ncoreos: {}\n",
+			err:      errors.New("coreos-cloudinit can not include userdata, use the ignition provisioning utility"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Stub(test.os, test.userdata, url)
+			if fmt.Sprint(err) != fmt.Sprint(test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if out != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, out)
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
     "bytes"
     "errors"
     "fmt"
+    "strings"
     "text/template"
 
     "github.com/Masterminds/semver"
@@ -63,8 +64,86 @@ func (p Provider) UserData(req plugin.UserDataRequest) (string, error) {
         req.CloudConfig = *pconfig.OverwriteCloudConfig
     }
 
-    if pconfig.Network != nil {
-        return "", errors.New("static IP config is not supported with Ubuntu")
+    if req.HTTPSProxy == "" {
+        req.HTTPSProxy = req.HTTPProxy
+    }
+
+    k0sRole := pconfig.Role
+    if k0sRole == "" {
+        k0sRole = providerconfigtypes.NodeRoleWorker
+    }
+    // Single nodes run the k0scontroller service as well, but don't join a cluster
+    k0sService := k0sRole
+    if k0sRole == providerconfigtypes.NodeRoleSingle {
+        k0sService = providerconfigtypes.NodeRoleController
+    } else if req.K0sJoinToken == "" {
+        return "", errors.New("k0s join token is missing")
+    }
+
+    k0sVersion := pconfig.K0sVersion
+    if k0sVersion == "" {
+        k0sVersion = userdatahelper.DefaultK0sVersion
+    }
+    controllerSchedulable := pconfig.Controller != nil && pconfig.Controller.Schedulable
+
+    // k0s configures the kubelet via flags, the extra args of the machine take precedence.
+    extraArgs := map[string]string{}
+    var swapSize int64 = defaultSwapSize
+    if pconfig.Swap != nil {
+        swapSize, err = userdatahelper.SwapSizeBytes(pconfig.Swap)
+        if err != nil {
+            return "", err
+        }
+        // the swap behavior has no flag and keeps its default
+        extraArgs["fail-swap-on"] = "false"
+    }
+    if len(pconfig.StaticPods) > 0 {
+        extraArgs["pod-manifest-path"] = userdatahelper.StaticPodPath
+    }
+
+    // k0s picks the IPv4 address of the node itself, other families get detected
+    // by the setup script before the worker gets installed.
+    var nodeNetworkScript string
+    if network := pconfig.NodeNetwork; network != nil {
+        var scripts []string
+        if network.IPFamily != "" && network.IPFamily != providerconfigtypes.NodeIPFamilyIPv4 {
+            scripts = append(scripts, userdatahelper.NodeIPDetectionScript(network))
+            extraArgs["node-ip"] = "${DEFAULT_IFC_IP}"
+        }
+        if script := userdatahelper.NodeNetworkScript(network); script != "" {
+            scripts = append(scripts, script)
+        }
+        nodeNetworkScript = strings.Join(scripts, "\n\n")
+    }
+    if len(extraArgs) > 0 {
+        kubelet := providerconfigtypes.KubeletSettings{}
+        if pconfig.Kubelet != nil {
+            kubelet = *pconfig.Kubelet
+        }
+        for name, value := range kubelet.ExtraArgs {
+            extraArgs[name] = value
+        }
+        kubelet.ExtraArgs = extraArgs
+        pconfig.Kubelet = &kubelet
+    }
+
+    // The node wide registry mirrors of the machine-controller only apply to docker.io,
+    // the ones of the machine take precedence.
+    insecureRegistries := append(append([]string{}, req.InsecureRegistries...), pconfig.InsecureRegistries...)
+    registryMirrors := map[string][]string{}
+    if len(req.RegistryMirrors) > 0 {
+        registryMirrors["docker.io"] = req.RegistryMirrors
+    }
+    for registry, mirrors := range pconfig.RegistryMirrors {
+        registryMirrors[registry] = mirrors
+    }
+
+    var containerdConfig string
+    if len(insecureRegistries) > 0 || len(registryMirrors) > 0 || len(pconfig.RegistryCredentials) > 0 {
+        containerdConfig, err = userdatahelper.K0sContainerdConfig(insecureRegistries, registryMirrors, pconfig.RegistryCredentials)
+        if err != nil {
+            return "", fmt.Errorf("failed to generate containerd config: %v", err)
+        }
     }
 
     ubuntuConfig, err := LoadConfig(pconfig.OperatingSystemSpec)
@@ -89,24 +168,42 @@ func (p Provider) UserData(req plugin.UserDataRequest) (string, error) {
 
     data := struct {
         plugin.UserDataRequest
-        ProviderSpec     *providerconfigtypes.Config
-        OSConfig         *Config
-        ServerAddr       string
-        KubeletVersion   string
-        DockerVersion    string
-        Kubeconfig       string
-        KubernetesCACert string
-        NodeIPScript     string
+        ProviderSpec          *providerconfigtypes.Config
+        OSConfig              *Config
+        ServerAddr            string
+        KubeletVersion        string
+        DockerVersion         string
+        Kubeconfig            string
+        KubernetesCACert      string
+        NodeIPScript          string
+        K0sVersion            string
+        K0sRole               providerconfigtypes.NodeRole
+        K0sService            providerconfigtypes.NodeRole
+        ControllerSchedulable bool
+        K0sJoinTokenPath      string
+        ContainerdConfig      string
+        ContainerdConfigPath  string
+        SwapSize              int64
+        NodeNetworkScript     string
     }{
-        UserDataRequest:  req,
-        ProviderSpec:     pconfig,
-        OSConfig:         ubuntuConfig,
-        ServerAddr:       serverAddr,
-        KubeletVersion:   kubeletVersion.String(),
-        DockerVersion:    dockerVersion,
-        Kubeconfig:       kubeconfigString,
-        KubernetesCACert: kubernetesCACert,
-        NodeIPScript:     userdatahelper.SetupNodeIPEnvScript(),
+        UserDataRequest:       req,
+        ProviderSpec:          pconfig,
+        OSConfig:              ubuntuConfig,
+        ServerAddr:            serverAddr,
+        KubeletVersion:        kubeletVersion.String(),
+        DockerVersion:         dockerVersion,
+        Kubeconfig:            kubeconfigString,
+        KubernetesCACert:      kubernetesCACert,
+        NodeIPScript:          userdatahelper.SetupNodeIPEnvScript(pconfig.NodeNetwork),
+        K0sVersion:            k0sVersion,
+        K0sRole:               k0sRole,
+        K0sService:            k0sService,
+        ControllerSchedulable: controllerSchedulable,
+        K0sJoinTokenPath:      userdatahelper.K0sJoinTokenPath,
+        ContainerdConfig:      containerdConfig,
+        ContainerdConfigPath:  userdatahelper.K0sContainerdConfigPath,
+        SwapSize:              swapSize,
+        NodeNetworkScript:     nodeNetworkScript,
     }
     b := &bytes.Buffer{}
     err = tmpl.Execute(b, data)
@@ -116,6 +213,9 @@ func (p Provider) UserData(req plugin.UserDataRequest) (string, error) {
     return userdatahelper.CleanupTemplateOutput(b.String())
 }
 
+// defaultSwapSize is the size of the swapfile of nodes without swap settings.
+const defaultSwapSize = 3 << 30
+
 // UserData template.
 const userDataTemplate = `#cloud-config
 {{ if ne .CloudProviderName "aws" }}
@@ -128,12 +228,20 @@ package_upgrade: true
 package_reboot_if_required: true
 {{- end }}
 
-ssh_pwauth: no
+ssh_pwauth: {{ sshPasswordAuthentication .ProviderSpec.SSH }}
+{{- with .ProviderSpec.SSH }}
+{{- if .User }}
+
+system_info:
+  default_user:
+    name: "{{ .User }}"
+{{- end }}
+{{- end }}
 
 swap:
   filename: /swap.img
-  size: "3221225472"
-  maxsize: "3221225472"
+  size: "{{ .SwapSize }}"
+  maxsize: "{{ .SwapSize }}"
 
 {{- if .ProviderSpec.SSHPublicKeys }}
 ssh_authorized_keys:
@@ -143,36 +251,170 @@ ssh_authorized_keys:
 {{- end }}
 
 write_files:
-{{- if .HTTPProxy }}
+{{- if or .HTTPProxy .HTTPSProxy }}
 - path: "/etc/environment"
   content: |
     PATH="/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games"
-{{ proxyEnvironment .HTTPProxy .NoProxy | indent 4 }}
+{{ proxyEnvironmentWithHTTPSProxy .HTTPProxy .HTTPSProxy .NoProxy | indent 4 }}
+
+- path: "/etc/apt/apt.conf.d/90proxy"
+  content: |
+{{- if .HTTPProxy }}
+    Acquire::http::Proxy "{{ .HTTPProxy }}";
+{{- end }}
+{{- if .HTTPSProxy }}
+    Acquire::https::Proxy "{{ .HTTPSProxy }}";
+{{- end }}
+
+{{- /* k0s runs containerd, so both pull through the proxy */}}
+
+- path: "/etc/systemd/system/k0s{{ .K0sService }}.service.d/http-proxy.conf"
+  content: |
+    [Service]
+    EnvironmentFile=/etc/environment
 {{- end }}
 
 - path: "/etc/systemd/journald.conf.d/max_disk_use.conf"
   content: |
 {{ journalDConfig | indent 4 }}
+{{- with .ProviderSpec.Network }}
+
+- path: "/etc/netplan/90-machine-controller.yaml"
+  permissions: "0600"
+  content: |
+{{ netplanConfig . | indent 4 }}
+
+- path: "/etc/cloud/cloud.cfg.d/99-machine-controller-network.cfg"
+  content: |
+    network: {config: disabled}
+{{- end }}
+{{- if .ProviderSpec.CABundle }}
+
+- path: "/usr/local/share/ca-certificates/machine-controller-ca-bundle.crt"
+  permissions: "0644"
+  content: |
+{{ .ProviderSpec.CABundle.Value | indent 4 }}
+{{- end }}
+{{- if eq .ProviderSpec.Hardening "cis" }}
+
+- path: "/etc/sysctl.d/99-cis.conf"
+  content: |
+{{ cisSysctlSettings | indent 4 }}
+
+- path: "/etc/modprobe.d/cis.conf"
+  content: |
+{{ cisModprobeConfig | indent 4 }}
+
+- path: "/etc/audit/rules.d/cis.rules"
+  permissions: "0640"
+  content: |
+{{ cisAuditRules "/etc/apparmor/" "/etc/apparmor.d/" | indent 4 }}
+
+- path: "/etc/ssh/sshd_config.cis"
+  permissions: "0600"
+  content: |
+{{ cisSSHDConfig | indent 4 }}
+{{- end }}
 
 - path: "/opt/bin/setup"
   permissions: "0755"
   content: |
     #!/bin/bash
     set -xeuo pipefail
+{{- if .ProviderSpec.Network }}
 
-    DEBIAN_FRONTEND=noninteractive apt autoremove -y --purge snapd
+    # the static address replaces the DHCP configuration cloud-init generated
+    rm -f /etc/netplan/50-cloud-init.yaml
+    netplan apply
+{{- end }}
+{{- if .ProviderSpec.CABundle }}
 
-    wget -q https://github.com/k0sproject/k0s/releases/download/v0.9.0-rc1/k0s-v0.9.0-rc1-amd64 -O /usr/bin/k0s
-    chmod +x /usr/bin/k0s
+    update-ca-certificates
+{{- end }}
+
+    DEBIAN_FRONTEND=noninteractive apt autoremove -y --purge snapd
 
     DEBIAN_FRONTEND=noninteractive apt-get -o Dpkg::Options::="--force-confdef" -o Dpkg::Options::="--force-confold" install -y \
       curl \
+      {{- if eq .ProviderSpec.Hardening "cis" }}
+      auditd \
+      {{- end }}
       {{- if eq .CloudProviderName "vsphere" }}
       open-vm-tools \
       {{- end }}
+{{- if eq .ProviderSpec.Hardening "cis" }}
+
+{{ cisHardeningScript | indent 4 }}
+{{- end }}
+{{- with .ProviderSpec.UpdatePolicy }}
+
+{{ updatePolicyScript "ubuntu" . | indent 4 }}
+{{- end }}
+{{- with .ProviderSpec.SSH }}
+{{- if .Disabled }}
+
+    systemctl disable --now ssh.service ssh.socket
+{{- end }}
+{{- end }}
+{{- if .ProviderSpec.Kernel }}
+
+    systemctl restart systemd-modules-load.service
+    sysctl --system
+{{- end }}
+{{- if .NodeNetworkScript }}
+
+    echodate() {
+      echo "[$(date -Is)]" "$@"
+    }
+
+{{ .NodeNetworkScript | indent 4 }}
+{{- end }}
+{{- with .ProviderSpec.GPU }}
+
+{{ gpuDriverScript "ubuntu" . | indent 4 }}
+{{- end }}
+{{- with .ProviderSpec.PreJoinChecks }}
+
+{{ preJoinCheckScript . $.K0sRole $.K0sJoinTokenPath | indent 4 }}
+{{- end }}
+{{- if eq .K0sRole "controller" }}
+
+{{ k0sInstallControllerScript .K0sReleaseURL .K0sVersion .ProviderSpec.AirgapBundleURL .ProviderSpec.WorkerProfile .ExternalCloudProvider .ControllerSchedulable .MachineSpec.Labels .MachineSpec.Taints .ProviderSpec.Kubelet | indent 4 }}
+{{- else if eq .K0sRole "single" }}
+
+{{ k0sInstallSingleScript .K0sReleaseURL .K0sVersion .ProviderSpec.AirgapBundleURL .ProviderSpec.WorkerProfile .ExternalCloudProvider .MachineSpec.Labels .MachineSpec.Taints .ProviderSpec.Kubelet | indent 4 }}
+{{- else }}
+
+{{ k0sInstallWorkerScript .K0sReleaseURL .K0sVersion .ProviderSpec.AirgapBundleURL .ProviderSpec.WorkerProfile .ProviderSpec.JoinAddresses .ExternalCloudProvider .MachineSpec.Labels .MachineSpec.Taints .ProviderSpec.Kubelet | indent 4 }}
+{{- end }}
+{{- if .ProviderSpec.SystemdUnits }}
+
+    systemctl daemon-reload
+{{- range .ProviderSpec.SystemdUnits }}
+    systemctl enable --now {{ .Name }}
+{{- end }}
+{{- end }}
+{{- range .ProviderSpec.Files }}
+
+- path: "{{ .Path }}"
+  permissions: "{{ .Permissions | default "0644" }}"
+  content: |
+{{ .Content.Value | indent 4 }}
+{{- end }}
+{{- range .ProviderSpec.StaticPods }}
 
-    cat /etc/k0s/kubeconfig | gzip -f --stdout | base64 > /etc/k0s/kubeconfig-base64
-    systemctl enable --now k0s
+- path: "/etc/kubernetes/manifests/{{ .Name }}.yaml"
+  permissions: "0600"
+  content: |
+{{ .Manifest.Value | indent 4 }}
+{{- end }}
+{{- range .ProviderSpec.SystemdUnits }}
+
+- path: "/etc/systemd/system/{{ .Name }}"
+  permissions: "0644"
+  content: |
+{{ .Content.Value | indent 4 }}
+{{- end }}
 
 - path: "/opt/bin/supervise.sh"
   permissions: "0755"
@@ -182,36 +424,48 @@ write_files:
     while ! "$@"; do
       sleep 1
     done
+{{- with .ProviderSpec.Kernel }}
+{{- if .Modules }}
 
-- path: "/etc/systemd/system/k0s.service"
+- path: "/etc/modules-load.d/machine-controller.conf"
+  permissions: "0644"
   content: |
-    [Unit]
-    Description=k0s worker
-    After=network.target
+{{- range .Modules }}
+    {{ . }}
+{{- end }}
+{{- end }}
+{{- if .Sysctls }}
 
-    [Service]
-    KillMode=process
-    Delegate=yes
-    ExecStart=/usr/bin/k0s worker {{ if .ExternalCloudProvider }} --enable-cloud-provider=true {{ end }} --token-file /etc/k0s/kubeconfig-base64
-    LimitNOFILE=1048576
-    LimitNPROC=infinity
-    LimitCORE=infinity
-    TasksMax=infinity
-    TimeoutStartSec=0
-    Restart=always
-    RestartSec=5s
-    ExecStartPre=-/sbin/modprobe nf_conntrack
-    ExecStartPre=-/sbin/modprobe br_netfilter
-    ExecStartPre=-/sbin/modprobe overlay
+- path: "/etc/sysctl.d/machine-controller.conf"
+  permissions: "0644"
+  content: |
+{{- range $name, $value := .Sysctls }}
+    {{ $name }} = {{ $value }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if ne .K0sRole "single" }}
 
+- path: "{{ .K0sJoinTokenPath }}"
+  permissions: "0600"
+  content: |
+{{ .K0sJoinToken | indent 4 }}
+{{- end }}
+{{- if .ContainerdConfig }}
 
-    [Install]
-    WantedBy=multi-user.target
+- path: "{{ .ContainerdConfigPath }}"
+  permissions: "0600"
+  content: |
+{{ .ContainerdConfig | indent 4 }}
+{{- end }}
+{{- /* the kubelet of k0s only supports external cloud providers, their node components read the cloud-config */}}
+{{- if and .ExternalCloudProvider .CloudConfig }}
 
-- path: "/etc/k0s/kubeconfig"
+- path: "/etc/kubernetes/cloud-config"
   permissions: "0600"
   content: |
-{{ .Kubeconfig | indent 4 }}
+{{ .CloudConfig | indent 4 }}
+{{- end }}
 
 - path: "/etc/systemd/system/setup.service"
   permissions: "0644"
@@ -92,6 +92,7 @@ kPe6XoSbiLm/kxk32T0=
 
 const (
 	defaultVersion = "1.17.3"
+	k0sJoinToken   = "H4sIAAAAAAAC/0zJQa6DIBAA0L1n4QJ/YQGhJj1LF2JbWi0SpBgTwz+yH1rfRvfXr"
 )
 
 type fakeCloudConfigProvider struct {
@@ -115,6 +116,7 @@ type userDataTestCase struct {
 	kubernetesCACert      string
 	externalCloudProvider bool
 	httpProxy             string
+	httpsProxy            string
 	noProxy               string
 	insecureRegistries    []string
 	registryMirrors       []string
@@ -292,6 +294,32 @@ func TestUserDataGeneration(t *testing.T) {
 				DistUpgradeOnBoot: false,
 			},
 		},
+		{
+			name: "openstack-external-cloud-provider",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "openstack",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: defaultVersion,
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "openstack",
+				config: "{openstack-config:true}",
+				err:    nil,
+			},
+			DNSIPs:                []net.IP{net.ParseIP("10.10.10.10"), net.ParseIP("10.10.10.11"), net.ParseIP("10.10.10.12")},
+			kubernetesCACert:      "CACert",
+			externalCloudProvider: true,
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
 		{
 			name: "openstack-overwrite-cloud-config",
 			providerSpec: &providerconfigtypes.Config{
@@ -344,6 +372,39 @@ func TestUserDataGeneration(t *testing.T) {
 				DistUpgradeOnBoot: false,
 			},
 		},
+		{
+			name: "vsphere-static-network",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider:        "vsphere",
+				SSHPublicKeys:        []string{"ssh-rsa AAABBB"},
+				OverwriteCloudConfig: stringPtr("custom\ncloud\nconfig"),
+				Network: &providerconfigtypes.NetworkConfig{
+					CIDR:    "192.168.81.4/24",
+					Gateway: "192.168.81.1",
+					DNS: providerconfigtypes.DNSConfig{
+						Servers: []string{"8.8.8.8"},
+					},
+				},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.17.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "vsphere",
+				config: "{vsphere-config:true}",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
 		{
 			name: "vsphere-proxy",
 			providerSpec: &providerconfigtypes.Config{
@@ -370,6 +431,7 @@ func TestUserDataGeneration(t *testing.T) {
 				DistUpgradeOnBoot: false,
 			},
 			httpProxy:          "http://192.168.100.100:3128",
+			httpsProxy:         "http://192.168.100.100:3129",
 			noProxy:            "192.168.1.0",
 			insecureRegistries: []string{"192.168.100.100:5000", "10.0.0.1:5000"},
 			pauseImage:         "192.168.100.100:5000/kubernetes/pause:v3.1",
@@ -404,6 +466,388 @@ func TestUserDataGeneration(t *testing.T) {
 			registryMirrors: []string{"https://registry.docker-cn.com"},
 			pauseImage:      "192.168.100.100:5000/kubernetes/pause:v3.1",
 		},
+		{
+			name: "k0s-registries",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider:   "",
+				SSHPublicKeys:   []string{"ssh-rsa AAABBB"},
+				K0sVersion:      "v1.21.3+k0s.0",
+				AirgapBundleURL: "https://mirror.example.com/k0s/k0s-airgap-bundle-v1.21.3+k0s.0-amd64",
+				RegistryMirrors: map[string][]string{
+					"docker.io": {"https://mirror.gcr.io"},
+					"quay.io":   {"https://quay-mirror.example.com"},
+				},
+				InsecureRegistries: []string{"registry.local:5000"},
+				RegistryCredentials: map[string]providerconfigtypes.RegistryCredentials{
+					"registry.local:5000": {
+						Username: providerconfigtypes.ConfigVarString{Value: "user"},
+						Password: providerconfigtypes.ConfigVarString{Value: "password"},
+					},
+				},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+			registryMirrors: []string{"https://registry.docker-cn.com"},
+		},
+		{
+			name: "k0s-single",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				Role:          providerconfigtypes.NodeRoleSingle,
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: defaultVersion,
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "k0s-controller",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				K0sVersion:    "v1.30.0+k0s.0",
+				Role:          providerconfigtypes.NodeRoleController,
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: defaultVersion,
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "ca-bundle",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				CABundle:      &providerconfigtypes.ConfigVarString{Value: pemCertificate},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "cis-hardening",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				Hardening:     providerconfigtypes.HardeningProfileCIS,
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "swap",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				Swap:          &providerconfigtypes.SwapSettings{Size: "8Gi"},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "kernel",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				Kernel: &providerconfigtypes.KernelSettings{
+					Modules: []string{"ip_vs", "nf_conntrack"},
+					Sysctls: map[string]string{
+						"net.netfilter.nf_conntrack_max": "1048576",
+						"net.ipv4.ip_local_port_range":   "1024 65000",
+					},
+				},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "gpu",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				GPU:           &providerconfigtypes.GPUSettings{Driver: providerconfigtypes.GPUDriverNvidia},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "node-network",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				NodeNetwork: &providerconfigtypes.NodeNetworkSettings{
+					IPFamily: providerconfigtypes.NodeIPFamilyIPv4IPv6,
+					MTU:      1400,
+					ResolvConf: &providerconfigtypes.ResolvConfSettings{
+						Search:  []string{"example.com"},
+						Options: []string{"ndots:2", "single-request-reopen"},
+					},
+				},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "ssh",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				SSH: &providerconfigtypes.SSHSettings{
+					User:                   "admin",
+					PasswordAuthentication: true,
+					Disabled:               true,
+				},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "files",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				Files: []providerconfigtypes.File{
+					{
+						Path:        "/etc/node-agent/config.yaml",
+						Permissions: "0600",
+						Content:     providerconfigtypes.ConfigVarString{Value: "endpoint: https://collector.example.com\n"},
+					},
+					{
+						Path:    "/etc/motd",
+						Content: providerconfigtypes.ConfigVarString{Value: "Managed by machine-controller\n"},
+					},
+				},
+				SystemdUnits: []providerconfigtypes.SystemdUnit{
+					{
+						Name: "node-agent.service",
+						Content: providerconfigtypes.ConfigVarString{Value: `[Unit]
+Description=Node agent
+
+[Service]
+ExecStart=/usr/local/bin/node-agent --config /etc/node-agent/config.yaml
+
+[Install]
+WantedBy=multi-user.target
+`},
+					},
+				},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
+		{
+			name: "static-pods",
+			providerSpec: &providerconfigtypes.Config{
+				CloudProvider: "",
+				SSHPublicKeys: []string{"ssh-rsa AAABBB"},
+				StaticPods: []providerconfigtypes.StaticPod{
+					{
+						Name: "keepalived",
+						Manifest: providerconfigtypes.ConfigVarString{Value: `apiVersion: v1
+kind: Pod
+metadata:
+  name: keepalived
+  namespace: kube-system
+spec:
+  hostNetwork: true
+  containers:
+  - name: keepalived
+    image: osixia/keepalived:2.0.20
+`},
+					},
+				},
+			},
+			spec: clusterv1alpha1.MachineSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node1",
+				},
+				Versions: clusterv1alpha1.MachineVersionInfo{
+					Kubelet: "v1.21.3",
+				},
+			},
+			ccProvider: &fakeCloudConfigProvider{
+				name:   "",
+				config: "",
+				err:    nil,
+			},
+			DNSIPs:           []net.IP{net.ParseIP("10.10.10.10")},
+			kubernetesCACert: "CACert",
+			osConfig: &Config{
+				DistUpgradeOnBoot: false,
+			},
+		},
 	}...)
 
 	for _, test := range tests {
@@ -441,11 +885,13 @@ func TestUserDataGeneration(t *testing.T) {
 				DNSIPs:                test.DNSIPs,
 				ExternalCloudProvider: test.externalCloudProvider,
 				HTTPProxy:             test.httpProxy,
+				HTTPSProxy:            test.httpsProxy,
 				NoProxy:               test.noProxy,
 				InsecureRegistries:    test.insecureRegistries,
 				RegistryMirrors:       test.registryMirrors,
 				PauseImage:            test.pauseImage,
 				KubeletFeatureGates:   kubeletFeatureGates,
+				K0sJoinToken:          k0sJoinToken,
 			}
 			s, err := provider.UserData(req)
 			if err != nil {
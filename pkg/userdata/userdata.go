@@ -0,0 +1,29 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package userdata defines the interface userdata is generated through.
+// Implementations are the userdata plugins, which the manager registers
+// per operating system and bootstrap flavor, and OperatingSystemProfiles.
+package userdata
+
+import (
+	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
+)
+
+// Provider renders the userdata of a machine.
+type Provider interface {
+	UserData(req plugin.UserDataRequest) (string, error)
+}
@@ -0,0 +1,338 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+//
+// UserData plugin for Windows.
+//
+
+package windows
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/kubermatic/machine-controller/pkg/apis/plugin"
+	providerconfigtypes "github.com/kubermatic/machine-controller/pkg/providerconfig/types"
+	userdatahelper "github.com/kubermatic/machine-controller/pkg/userdata/helper"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeletv1b1 "k8s.io/kubelet/config/v1beta1"
+	"k8s.io/utils/pointer"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+// the kubelet only supports the remote container runtime since 1.27 and dropped the flag
+var containerRuntimeFlagConstraint = mustConstraint("< 1.27")
+
+func mustConstraint(c string) *semver.Constraints {
+	constraint, err := semver.NewConstraint(c)
+	if err != nil {
+		panic(err)
+	}
+	return constraint
+}
+
+// Provider is a pkg/userdata/plugin.Provider implementation.
+type Provider struct{}
+
+// UserData renders user-data template to string.
+func (p Provider) UserData(req plugin.UserDataRequest) (string, error) {
+	tmpl, err := template.New("user-data").Funcs(userdatahelper.TxtFuncMap()).Parse(userDataTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse user-data template: %v", err)
+	}
+
+	kubeletVersion, err := semver.NewVersion(req.MachineSpec.Versions.Kubelet)
+	if err != nil {
+		return "", fmt.Errorf("invalid kubelet version: '%v'", err)
+	}
+
+	pconfig, err := providerconfigtypes.GetConfig(req.MachineSpec.ProviderSpec)
+	if err != nil {
+		return "", fmt.Errorf("failed to get provider config: %v", err)
+	}
+
+	if pconfig.OverwriteCloudConfig != nil {
+		req.CloudConfig = *pconfig.OverwriteCloudConfig
+	}
+
+	if pconfig.Network != nil {
+		return "", errors.New("static IP config is not supported with Windows")
+	}
+
+	windowsConfig, err := LoadConfig(pconfig.OperatingSystemSpec)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse OperatingSystemSpec: '%v'", err)
+	}
+
+	kubeconfigString, err := userdatahelper.StringifyKubeconfig(req.Kubeconfig)
+	if err != nil {
+		return "", err
+	}
+
+	kubernetesCACert, err := userdatahelper.GetCACert(req.Kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("error extracting cacert: %v", err)
+	}
+
+	kubeletConfig, err := kubeletConfiguration(req.DNSIPs, req.KubeletFeatureGates)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate kubelet configuration: %v", err)
+	}
+
+	data := struct {
+		plugin.UserDataRequest
+		ProviderSpec     *providerconfigtypes.Config
+		OSConfig         *Config
+		KubeletVersion   string
+		Kubeconfig       string
+		KubernetesCACert string
+		KubeletConfig    string
+		KubeletFlags     []string
+	}{
+		UserDataRequest:  req,
+		ProviderSpec:     pconfig,
+		OSConfig:         windowsConfig,
+		KubeletVersion:   kubeletVersion.String(),
+		Kubeconfig:       kubeconfigString,
+		KubernetesCACert: kubernetesCACert,
+		KubeletConfig:    kubeletConfig,
+		KubeletFlags:     kubeletFlags(req, pconfig, kubeletVersion),
+	}
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute user-data template: %v", err)
+	}
+	return userdatahelper.CleanupTemplateOutput(b.String())
+}
+
+// kubeletConfiguration returns the KubeletConfiguration of Windows nodes, which
+// differs from the one of Linux nodes in its paths and lacks cgroup settings.
+func kubeletConfiguration(clusterDNS []net.IP, featureGates map[string]bool) (string, error) {
+	clusterDNSstr := make([]string, 0, len(clusterDNS))
+	for _, ip := range clusterDNS {
+		clusterDNSstr = append(clusterDNSstr, ip.String())
+	}
+
+	cfg := kubeletv1b1.KubeletConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "KubeletConfiguration",
+			APIVersion: kubeletv1b1.SchemeGroupVersion.String(),
+		},
+		Authentication: kubeletv1b1.KubeletAuthentication{
+			X509: kubeletv1b1.KubeletX509Authentication{
+				ClientCAFile: `C:\k\pki\ca.crt`,
+			},
+			Webhook: kubeletv1b1.KubeletWebhookAuthentication{
+				Enabled: pointer.BoolPtr(true),
+			},
+			Anonymous: kubeletv1b1.KubeletAnonymousAuthentication{
+				Enabled: pointer.BoolPtr(false),
+			},
+		},
+		Authorization: kubeletv1b1.KubeletAuthorization{
+			Mode: kubeletv1b1.KubeletAuthorizationModeWebhook,
+		},
+		ClusterDNS:         clusterDNSstr,
+		ClusterDomain:      "cluster.local",
+		FeatureGates:       featureGates,
+		RotateCertificates: true,
+		ServerTLSBootstrap: true,
+	}
+
+	buf, err := kyaml.Marshal(cfg)
+	return string(buf), err
+}
+
+// kubeletFlags returns the flags of the kubelet service. The kubelet settings of the
+// machine are passed as flags, they take precedence over the kubelet configuration.
+func kubeletFlags(req plugin.UserDataRequest, pconfig *providerconfigtypes.Config, kubeletVersion *semver.Version) []string {
+	flags := []string{
+		"--windows-service",
+		`--bootstrap-kubeconfig=C:\k\bootstrap-kubelet.conf`,
+		`--kubeconfig=C:\k\kubelet.conf`,
+		`--config=C:\k\kubelet-config.yaml`,
+		`--cert-dir=C:\k\pki`,
+		`--volume-plugin-dir=C:\k\volumeplugins`,
+	}
+	if containerRuntimeFlagConstraint.Check(kubeletVersion) {
+		flags = append(flags, "--container-runtime=remote")
+	}
+	flags = append(flags,
+		"--container-runtime-endpoint=npipe:////./pipe/containerd-containerd",
+		// Windows has neither cgroups nor a resolv.conf
+		"--cgroups-per-qos=false",
+		"--enforce-node-allocatable=",
+		"--resolv-conf=",
+	)
+
+	if req.ExternalCloudProvider {
+		flags = append(flags, "--cloud-provider=external")
+	} else if req.CloudProviderName != "" {
+		flags = append(flags, "--cloud-provider="+req.CloudProviderName, `--cloud-config=C:\k\cloud-config`)
+	}
+	// The computer name of Windows is limited to 15 characters, the node name of AWS nodes
+	// is the private DNS name of the instance.
+	if req.CloudProviderName != "aws" {
+		flags = append(flags, "--hostname-override="+req.MachineSpec.Name)
+	}
+	if req.PauseImage != "" {
+		flags = append(flags, "--pod-infra-container-image="+req.PauseImage)
+	}
+	if len(req.MachineSpec.Taints) > 0 {
+		var taints []string
+		for _, taint := range req.MachineSpec.Taints {
+			taints = append(taints, fmt.Sprintf("%s=%s:%s", taint.Key, taint.Value, taint.Effect))
+		}
+		flags = append(flags, "--register-with-taints="+strings.Join(taints, ","))
+	}
+	flags = append(flags, userdatahelper.KubeletSettingsFlags(pconfig.Kubelet)...)
+
+	// the flags are quoted with single quotes in PowerShell
+	for i := range flags {
+		flags[i] = strings.Replace(flags[i], "'", "''", -1)
+	}
+	return flags
+}
+
+// UserData template. EC2Launch runs PowerShell enclosed in <powershell> tags,
+// cloudbase-init scripts starting with #ps1_sysnative.
+const userDataTemplate = `{{- if eq .CloudProviderName "aws" -}}
+<powershell>
+{{- else -}}
+#ps1_sysnative
+{{- end }}
+$ErrorActionPreference = "Stop"
+$ProgressPreference = "SilentlyContinue"
+
+function Write-File([string]$Path, [string]$Content) {
+  New-Item -ItemType Directory -Force -Path (Split-Path -Parent $Path) | Out-Null
+  [IO.File]::WriteAllText($Path, $Content)
+}
+{{- if .HTTPProxy }}
+
+[Environment]::SetEnvironmentVariable("HTTP_PROXY", "{{ .HTTPProxy }}", "Machine")
+[Environment]::SetEnvironmentVariable("HTTPS_PROXY", "{{ default .HTTPProxy .HTTPSProxy }}", "Machine")
+[Environment]::SetEnvironmentVariable("NO_PROXY", "{{ .NoProxy }}", "Machine")
+[System.Net.WebRequest]::DefaultWebProxy = New-Object System.Net.WebProxy("{{ .HTTPProxy }}", $true)
+{{- end }}
+
+# the containers feature requires a reboot, the userdata runs again on the next boot
+if ((Get-WindowsFeature -Name Containers).InstallState -ne "Installed") {
+  Install-WindowsFeature -Name Containers | Out-Null
+{{- if eq .CloudProviderName "aws" }}
+  Restart-Computer -Force
+  exit 0
+{{- else }}
+  # makes cloudbase-init reboot and run the userdata again
+  exit 1003
+{{- end }}
+}
+
+Write-File "C:\k\pki\ca.crt" @'
+{{ .KubernetesCACert }}
+'@
+
+Write-File "C:\k\bootstrap-kubelet.conf" @'
+{{ .Kubeconfig }}
+'@
+
+Write-File "C:\k\kubelet-config.yaml" @'
+{{ .KubeletConfig }}
+'@
+{{- if .CloudConfig }}
+
+Write-File "C:\k\cloud-config" @'
+{{ .CloudConfig }}
+'@
+{{- end }}
+
+$ContainerdVersion = "{{ .OSConfig.ContainerdVersion }}"
+$ContainerdPath = "$env:ProgramFiles\containerd"
+if (-not (Test-Path "$ContainerdPath\containerd.exe")) {
+  Invoke-WebRequest -UseBasicParsing -OutFile "$env:TEMP\containerd.tar.gz" "https://github.com/containerd/containerd/releases/download/v$ContainerdVersion/containerd-$ContainerdVersion-windows-amd64.tar.gz"
+  tar.exe -xzf "$env:TEMP\containerd.tar.gz" -C "$env:TEMP"
+  New-Item -ItemType Directory -Force -Path $ContainerdPath | Out-Null
+  Copy-Item -Force -Path "$env:TEMP\bin\*" -Destination $ContainerdPath
+}
+
+if (-not (Test-Path "$ContainerdPath\cni\bin\win-overlay.exe")) {
+  New-Item -ItemType Directory -Force -Path "$ContainerdPath\cni\bin", "$ContainerdPath\cni\conf" | Out-Null
+  Invoke-WebRequest -UseBasicParsing -OutFile "$env:TEMP\cni-plugins.tgz" "https://github.com/containernetworking/plugins/releases/download/v0.8.7/cni-plugins-windows-amd64-v0.8.7.tgz"
+  tar.exe -xzf "$env:TEMP\cni-plugins.tgz" -C "$ContainerdPath\cni\bin"
+}
+
+Write-File "$ContainerdPath\config.toml" @'
+version = 2
+
+[plugins."io.containerd.grpc.v1.cri"]
+{{- if .PauseImage }}
+  sandbox_image = "{{ .PauseImage }}"
+{{- end }}
+
+[plugins."io.containerd.grpc.v1.cri".cni]
+  bin_dir = "C:\\Program Files\\containerd\\cni\\bin"
+  conf_dir = "C:\\Program Files\\containerd\\cni\\conf"
+{{- if .RegistryMirrors }}
+
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+  endpoint = [{{ range $i, $mirror := .RegistryMirrors }}{{ if $i }}, {{ end }}"{{ $mirror }}"{{ end }}]
+{{- end }}
+{{- range .InsecureRegistries }}
+
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."{{ . }}"]
+  endpoint = ["http://{{ . }}"]
+
+[plugins."io.containerd.grpc.v1.cri".registry.configs."{{ . }}".tls]
+  insecure_skip_verify = true
+{{- end }}
+'@
+
+if (-not (Get-Service -Name containerd -ErrorAction SilentlyContinue)) {
+  & "$ContainerdPath\containerd.exe" --register-service
+}
+Start-Service -Name containerd
+
+if (-not (Test-Path "C:\k\kubelet.exe")) {
+  Invoke-WebRequest -UseBasicParsing -OutFile "C:\k\kubelet.exe" "https://storage.googleapis.com/kubernetes-release/release/v{{ .KubeletVersion }}/bin/windows/amd64/kubelet.exe"
+}
+
+$KubeletArgs = @(
+{{- range .KubeletFlags }}
+  '{{ . }}'
+{{- end }}
+)
+if (-not (Get-Service -Name kubelet -ErrorAction SilentlyContinue)) {
+  New-Service -Name kubelet -StartupType Automatic -DependsOn containerd -BinaryPathName "C:\k\kubelet.exe $($KubeletArgs -join ' ')" | Out-Null
+  sc.exe failure kubelet reset= 0 actions= restart/10000 | Out-Null
+}
+
+if (-not (Get-NetFirewallRule -Name kubelet -ErrorAction SilentlyContinue)) {
+  New-NetFirewallRule -Name kubelet -DisplayName kubelet -Enabled True -Direction Inbound -Protocol TCP -Action Allow -LocalPort 10250 | Out-Null
+}
+Start-Service -Name kubelet
+{{- if eq .CloudProviderName "aws" }}
+</powershell>
+<persist>true</persist>
+{{- end }}
+`
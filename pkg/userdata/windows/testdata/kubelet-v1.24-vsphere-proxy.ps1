@@ -0,0 +1,185 @@
+#ps1_sysnative
+$ErrorActionPreference = "Stop"
+$ProgressPreference = "SilentlyContinue"
+
+function Write-File([string]$Path, [string]$Content) {
+  New-Item -ItemType Directory -Force -Path (Split-Path -Parent $Path) | Out-Null
+  [IO.File]::WriteAllText($Path, $Content)
+}
+
+[Environment]::SetEnvironmentVariable("HTTP_PROXY", "http://192.168.100.100:3128", "Machine")
+[Environment]::SetEnvironmentVariable("HTTPS_PROXY", "http://192.168.100.100:3128", "Machine")
+[Environment]::SetEnvironmentVariable("NO_PROXY", "192.168.1.0", "Machine")
+[System.Net.WebRequest]::DefaultWebProxy = New-Object System.Net.WebProxy("http://192.168.100.100:3128", $true)
+
+# the containers feature requires a reboot, the userdata runs again on the next boot
+if ((Get-WindowsFeature -Name Containers).InstallState -ne "Installed") {
+  Install-WindowsFeature -Name Containers | Out-Null
+  # makes cloudbase-init reboot and run the userdata again
+  exit 1003
+}
+
+Write-File "C:\k\pki\ca.crt" @'
+-----BEGIN CERTIFICATE-----
+MIIEWjCCA0KgAwIBAgIJALfRlWsI8YQHMA0GCSqGSIb3DQEBBQUAMHsxCzAJBgNV
+BAYTAlVTMQswCQYDVQQIEwJDQTEWMBQGA1UEBxMNU2FuIEZyYW5jaXNjbzEUMBIG
+A1UEChMLQnJhZGZpdHppbmMxEjAQBgNVBAMTCWxvY2FsaG9zdDEdMBsGCSqGSIb3
+DQEJARYOYnJhZEBkYW5nYS5jb20wHhcNMTQwNzE1MjA0NjA1WhcNMTcwNTA0MjA0
+NjA1WjB7MQswCQYDVQQGEwJVUzELMAkGA1UECBMCQ0ExFjAUBgNVBAcTDVNhbiBG
+cmFuY2lzY28xFDASBgNVBAoTC0JyYWRmaXR6aW5jMRIwEAYDVQQDEwlsb2NhbGhv
+c3QxHTAbBgkqhkiG9w0BCQEWDmJyYWRAZGFuZ2EuY29tMIIBIjANBgkqhkiG9w0B
+AQEFAAOCAQ8AMIIBCgKCAQEAt5fAjp4fTcekWUTfzsp0kyih1OYbsGL0KX1eRbSS
+R8Od0+9Q62Hyny+GFwMTb4A/KU8mssoHvcceSAAbwfbxFK/+s51TobqUnORZrOoT
+ZjkUygbyXDSK99YBbcR1Pip8vwMTm4XKuLtCigeBBdjjAQdgUO28LENGlsMnmeYk
+JfODVGnVmr5Ltb9ANA8IKyTfsnHJ4iOCS/PlPbUj2q7YnoVLposUBMlgUb/CykX3
+mOoLb4yJJQyA/iST6ZxiIEj36D4yWZ5lg7YJl+UiiBQHGCnPdGyipqV06ex0heYW
+caiW8LWZSUQ93jQ+WVCH8hT7DQO1dmsvUmXlq/JeAlwQ/QIDAQABo4HgMIHdMB0G
+A1UdDgQWBBRcAROthS4P4U7vTfjByC569R7E6DCBrQYDVR0jBIGlMIGigBRcAROt
+hS4P4U7vTfjByC569R7E6KF/pH0wezELMAkGA1UEBhMCVVMxCzAJBgNVBAgTAkNB
+MRYwFAYDVQQHEw1TYW4gRnJhbmNpc2NvMRQwEgYDVQQKEwtCcmFkZml0emluYzES
+MBAGA1UEAxMJbG9jYWxob3N0MR0wGwYJKoZIhvcNAQkBFg5icmFkQGRhbmdhLmNv
+bYIJALfRlWsI8YQHMAwGA1UdEwQFMAMBAf8wDQYJKoZIhvcNAQEFBQADggEBAG6h
+U9f9sNH0/6oBbGGy2EVU0UgITUQIrFWo9rFkrW5k/XkDjQm+3lzjT0iGR4IxE/Ao
+eU6sQhua7wrWeFEn47GL98lnCsJdD7oZNhFmQ95Tb/LnDUjs5Yj9brP0NWzXfYU4
+UK2ZnINJRcJpB8iRCaCxE8DdcUF0XqIEq6pA272snoLmiXLMvNl3kYEdm+je6voD
+58SNVEUsztzQyXmJEhCpwVI0A6QCjzXj+qvpmw3ZZHi8JwXei8ZZBLTSFBki8Z7n
+sH9BBH38/SzUmAN4QHSPy1gjqm00OAE8NaYDkh/bzE4d7mLGGMWp/WE3KPSu82HF
+kPe6XoSbiLm/kxk32T0=
+-----END CERTIFICATE-----
+'@
+
+Write-File "C:\k\bootstrap-kubelet.conf" @'
+apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JSUVXakNDQTBLZ0F3SUJBZ0lKQUxmUmxXc0k4WVFITUEwR0NTcUdTSWIzRFFFQkJRVUFNSHN4Q3pBSkJnTlYKQkFZVEFsVlRNUXN3Q1FZRFZRUUlFd0pEUVRFV01CUUdBMVVFQnhNTlUyRnVJRVp5WVc1amFYTmpiekVVTUJJRwpBMVVFQ2hNTFFuSmhaR1pwZEhwcGJtTXhFakFRQmdOVkJBTVRDV3h2WTJGc2FHOXpkREVkTUJzR0NTcUdTSWIzCkRRRUpBUllPWW5KaFpFQmtZVzVuWVM1amIyMHdIaGNOTVRRd056RTFNakEwTmpBMVdoY05NVGN3TlRBME1qQTAKTmpBMVdqQjdNUXN3Q1FZRFZRUUdFd0pWVXpFTE1Ba0dBMVVFQ0JNQ1EwRXhGakFVQmdOVkJBY1REVk5oYmlCRwpjbUZ1WTJselkyOHhGREFTQmdOVkJBb1RDMEp5WVdSbWFYUjZhVzVqTVJJd0VBWURWUVFERXdsc2IyTmhiR2h2CmMzUXhIVEFiQmdrcWhraUc5dzBCQ1FFV0RtSnlZV1JBWkdGdVoyRXVZMjl0TUlJQklqQU5CZ2txaGtpRzl3MEIKQVFFRkFBT0NBUThBTUlJQkNnS0NBUUVBdDVmQWpwNGZUY2VrV1VUZnpzcDBreWloMU9ZYnNHTDBLWDFlUmJTUwpSOE9kMCs5UTYySHlueStHRndNVGI0QS9LVThtc3NvSHZjY2VTQUFid2ZieEZLLytzNTFUb2JxVW5PUlpyT29UClpqa1V5Z2J5WERTSzk5WUJiY1IxUGlwOHZ3TVRtNFhLdUx0Q2lnZUJCZGpqQVFkZ1VPMjhMRU5HbHNNbm1lWWsKSmZPRFZHblZtcjVMdGI5QU5BOElLeVRmc25ISjRpT0NTL1BsUGJVajJxN1lub1ZMcG9zVUJNbGdVYi9DeWtYMwptT29MYjR5SkpReUEvaVNUNlp4aUlFajM2RDR5V1o1bGc3WUpsK1VpaUJRSEdDblBkR3lpcHFWMDZleDBoZVlXCmNhaVc4TFdaU1VROTNqUStXVkNIOGhUN0RRTzFkbXN2VW1YbHEvSmVBbHdRL1FJREFRQUJvNEhnTUlIZE1CMEcKQTFVZERnUVdCQlJjQVJPdGhTNFA0VTd2VGZqQnlDNTY5UjdFNkRDQnJRWURWUjBqQklHbE1JR2lnQlJjQVJPdApoUzRQNFU3dlRmakJ5QzU2OVI3RTZLRi9wSDB3ZXpFTE1Ba0dBMVVFQmhNQ1ZWTXhDekFKQmdOVkJBZ1RBa05CCk1SWXdGQVlEVlFRSEV3MVRZVzRnUm5KaGJtTnBjMk52TVJRd0VnWURWUVFLRXd0Q2NtRmtabWwwZW1sdVl6RVMKTUJBR0ExVUVBeE1KYkc5allXeG9iM04wTVIwd0d3WUpLb1pJaHZjTkFRa0JGZzVpY21Ga1FHUmhibWRoTG1OdgpiWUlKQUxmUmxXc0k4WVFITUF3R0ExVWRFd1FGTUFNQkFmOHdEUVlKS29aSWh2Y05BUUVGQlFBRGdnRUJBRzZoClU5ZjlzTkgwLzZvQmJHR3kyRVZVMFVnSVRVUUlyRldvOXJGa3JXNWsvWGtEalFtKzNsempUMGlHUjRJeEUvQW8KZVU2c1FodWE3d3JXZUZFbjQ3R0w5OGxuQ3NKZEQ3b1pOaEZtUTk1VGIvTG5EVWpzNVlqOWJyUDBOV3pYZllVNApVSzJabklOSlJjSnBCOGlSQ2FDeEU4RGRjVUYwWHFJRXE2cEEyNzJzbm9MbWlYTE12Tmwza1lFZG0ramU2dm9ECjU4U05WRVVzenR6UXlYbUpFaENwd1ZJMEE2UUNqelhqK3F2cG13M1paSGk4SndYZWk4WlpCTFRTRkJraThaN24Kc0g5QkJIMzgvU3pVbUFONFFIU1B5MWdqcW0wME9BRThOYVlEa2gvYnpFNGQ3bUxHR01XcC9XRTNLUFN1ODJIRgprUGU2WG9TYmlMbS9reGszMlQwPQotLS0tLUVORCBDRVJUSUZJQ0FURS0tLS0t
+    server: https://server:443
+  name: ""
+contexts: []
+current-context: ""
+kind: Config
+preferences: {}
+users:
+- name: ""
+  user:
+    token: my-token
+
+'@
+
+Write-File "C:\k\kubelet-config.yaml" @'
+apiVersion: kubelet.config.k8s.io/v1beta1
+authentication:
+  anonymous:
+    enabled: false
+  webhook:
+    cacheTTL: 0s
+    enabled: true
+  x509:
+    clientCAFile: C:\k\pki\ca.crt
+authorization:
+  mode: Webhook
+  webhook:
+    cacheAuthorizedTTL: 0s
+    cacheUnauthorizedTTL: 0s
+clusterDNS:
+- 10.10.10.10
+clusterDomain: cluster.local
+cpuManagerReconcilePeriod: 0s
+evictionPressureTransitionPeriod: 0s
+featureGates:
+  RotateKubeletServerCertificate: true
+fileCheckFrequency: 0s
+httpCheckFrequency: 0s
+imageMinimumGCAge: 0s
+kind: KubeletConfiguration
+nodeStatusReportFrequency: 0s
+nodeStatusUpdateFrequency: 0s
+rotateCertificates: true
+runtimeRequestTimeout: 0s
+serverTLSBootstrap: true
+streamingConnectionIdleTimeout: 0s
+syncFrequency: 0s
+volumeStatsAggPeriod: 0s
+
+'@
+
+Write-File "C:\k\cloud-config" @'
+{vsphere-config:true}
+'@
+
+$ContainerdVersion = "1.6.21"
+$ContainerdPath = "$env:ProgramFiles\containerd"
+if (-not (Test-Path "$ContainerdPath\containerd.exe")) {
+  Invoke-WebRequest -UseBasicParsing -OutFile "$env:TEMP\containerd.tar.gz" "https://github.com/containerd/containerd/releases/download/v$ContainerdVersion/containerd-$ContainerdVersion-windows-amd64.tar.gz"
+  tar.exe -xzf "$env:TEMP\containerd.tar.gz" -C "$env:TEMP"
+  New-Item -ItemType Directory -Force -Path $ContainerdPath | Out-Null
+  Copy-Item -Force -Path "$env:TEMP\bin\*" -Destination $ContainerdPath
+}
+
+if (-not (Test-Path "$ContainerdPath\cni\bin\win-overlay.exe")) {
+  New-Item -ItemType Directory -Force -Path "$ContainerdPath\cni\bin", "$ContainerdPath\cni\conf" | Out-Null
+  Invoke-WebRequest -UseBasicParsing -OutFile "$env:TEMP\cni-plugins.tgz" "https://github.com/containernetworking/plugins/releases/download/v0.8.7/cni-plugins-windows-amd64-v0.8.7.tgz"
+  tar.exe -xzf "$env:TEMP\cni-plugins.tgz" -C "$ContainerdPath\cni\bin"
+}
+
+Write-File "$ContainerdPath\config.toml" @'
+version = 2
+
+[plugins."io.containerd.grpc.v1.cri"]
+  sandbox_image = "192.168.100.100:5000/kubernetes/pause:v3.1"
+
+[plugins."io.containerd.grpc.v1.cri".cni]
+  bin_dir = "C:\\Program Files\\containerd\\cni\\bin"
+  conf_dir = "C:\\Program Files\\containerd\\cni\\conf"
+
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+  endpoint = ["https://registry.docker-cn.com"]
+
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."192.168.100.100:5000"]
+  endpoint = ["http://192.168.100.100:5000"]
+
+[plugins."io.containerd.grpc.v1.cri".registry.configs."192.168.100.100:5000".tls]
+  insecure_skip_verify = true
+
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."10.0.0.1:5000"]
+  endpoint = ["http://10.0.0.1:5000"]
+
+[plugins."io.containerd.grpc.v1.cri".registry.configs."10.0.0.1:5000".tls]
+  insecure_skip_verify = true
+'@
+
+if (-not (Get-Service -Name containerd -ErrorAction SilentlyContinue)) {
+  & "$ContainerdPath\containerd.exe" --register-service
+}
+Start-Service -Name containerd
+
+if (-not (Test-Path "C:\k\kubelet.exe")) {
+  Invoke-WebRequest -UseBasicParsing -OutFile "C:\k\kubelet.exe" "https://storage.googleapis.com/kubernetes-release/release/v1.24.3/bin/windows/amd64/kubelet.exe"
+}
+
+$KubeletArgs = @(
+  '--windows-service'
+  '--bootstrap-kubeconfig=C:\k\bootstrap-kubelet.conf'
+  '--kubeconfig=C:\k\kubelet.conf'
+  '--config=C:\k\kubelet-config.yaml'
+  '--cert-dir=C:\k\pki'
+  '--volume-plugin-dir=C:\k\volumeplugins'
+  '--container-runtime=remote'
+  '--container-runtime-endpoint=npipe:////./pipe/containerd-containerd'
+  '--cgroups-per-qos=false'
+  '--enforce-node-allocatable='
+  '--resolv-conf='
+  '--cloud-provider=vsphere'
+  '--cloud-config=C:\k\cloud-config'
+  '--hostname-override=node1'
+  '--pod-infra-container-image=192.168.100.100:5000/kubernetes/pause:v3.1'
+)
+if (-not (Get-Service -Name kubelet -ErrorAction SilentlyContinue)) {
+  New-Service -Name kubelet -StartupType Automatic -DependsOn containerd -BinaryPathName "C:\k\kubelet.exe $($KubeletArgs -join ' ')" | Out-Null
+  sc.exe failure kubelet reset= 0 actions= restart/10000 | Out-Null
+}
+
+if (-not (Get-NetFirewallRule -Name kubelet -ErrorAction SilentlyContinue)) {
+  New-NetFirewallRule -Name kubelet -DisplayName kubelet -Enabled True -Direction Inbound -Protocol TCP -Action Allow -LocalPort 10250 | Out-Null
+}
+Start-Service -Name kubelet
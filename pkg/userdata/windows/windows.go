@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package windows
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultContainerdVersion is the version of containerd installed if none is configured.
+const DefaultContainerdVersion = "1.6.21"
+
+// Config contains specific configuration for Windows.
+type Config struct {
+	// ContainerdVersion is the version of containerd installed on the node.
+	ContainerdVersion string `json:"containerdVersion,omitempty"`
+}
+
+// LoadConfig retrieves the Windows configuration from raw data.
+func LoadConfig(r runtime.RawExtension) (*Config, error) {
+	cfg := Config{}
+	if len(r.Raw) != 0 {
+		if err := json.Unmarshal(r.Raw, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ContainerdVersion == "" {
+		cfg.ContainerdVersion = DefaultContainerdVersion
+	}
+	return &cfg, nil
+}
+
+// Spec return the configuration as raw data.
+func (cfg *Config) Spec() (*runtime.RawExtension, error) {
+	ext := &runtime.RawExtension{}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ext.Raw = b
+	return ext, nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	clusterv1alpha1 "github.com/kubermatic/machine-controller/pkg/apis/cluster/v1alpha1"
+	evictiontypes "github.com/kubermatic/machine-controller/pkg/node/eviction/types"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// drainPodImage is the image of the pod which has to be evicted from the node before it is deleted
+const drainPodImage = "k8s.gcr.io/pause:3.2"
+
+// verifyJoinDrainAndDelete returns an executor which verifies that the node of a machine joins the cluster
+// of the given kubeconfig, the cluster of the machines if it is empty, and that a pod scheduled to it is
+// evicted before the machine and its node are deleted
+func verifyJoinDrainAndDelete(targetKubeconfig string) scenarioExecutor {
+	return func(kubeConfig, manifestPath string, parameters []string, timeout time.Duration) error {
+		client, machineDeployment, err := prepareMachineDeployment(kubeConfig, manifestPath, parameters)
+		if err != nil {
+			return err
+		}
+		// The node must be drained in this scenario
+		delete(machineDeployment.Spec.Template.Spec.Annotations, evictiontypes.SkipEvictionAnnotationKey)
+		machineDeployment.Spec.Replicas = getInt32Ptr(1)
+
+		targetClient := client
+		if targetKubeconfig != "" {
+			cfg, err := clientcmd.BuildConfigFromFlags("", targetKubeconfig)
+			if err != nil {
+				return fmt.Errorf("failed to build the target kubeconfig: %v", err)
+			}
+			targetClient, err = ctrlruntimeclient.New(cfg, ctrlruntimeclient.Options{})
+			if err != nil {
+				return fmt.Errorf("failed to create the target client: %v", err)
+			}
+		}
+
+		klog.Infof("creating a new %q MachineDeployment", machineDeployment.Name)
+		if err := client.Create(context.Background(), machineDeployment); err != nil {
+			return err
+		}
+
+		var machine *clusterv1alpha1.Machine
+		var node *corev1.Node
+		if err := wait.Poll(machineReadyCheckPeriod, timeout, func() (bool, error) {
+			machine, node, err = readyNodeOfMachineDeployment(machineDeployment, client, targetClient)
+			return node != nil, err
+		}); err != nil {
+			return fmt.Errorf("failed waiting for MachineDeployment %s to get a ready node: %v", machineDeployment.Name, err)
+		}
+		klog.Infof("Node %s of MachineDeployment %s is ready", node.Name, machineDeployment.Name)
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      machineDeployment.Name + "-drain",
+				Namespace: metav1.NamespaceDefault,
+			},
+			Spec: corev1.PodSpec{
+				NodeName:    node.Name,
+				Containers:  []corev1.Container{{Name: "pause", Image: drainPodImage}},
+				Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			},
+		}
+		if err := targetClient.Create(context.Background(), pod); err != nil {
+			return fmt.Errorf("failed to create pod %s on node %s: %v", pod.Name, node.Name, err)
+		}
+		defer func() {
+			if err := targetClient.Delete(context.Background(), pod); err != nil && !kerrors.IsNotFound(err) {
+				klog.Errorf("Failed to delete pod %s: %v", pod.Name, err)
+			}
+		}()
+		if err := wait.Poll(machineReadyCheckPeriod, timeout, func() (bool, error) {
+			current := &corev1.Pod{}
+			if err := targetClient.Get(context.Background(), types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, current); err != nil {
+				return false, err
+			}
+			return current.Status.Phase == corev1.PodRunning, nil
+		}); err != nil {
+			return fmt.Errorf("failed waiting for pod %s to run on node %s: %v", pod.Name, node.Name, err)
+		}
+
+		if err := deleteAndAssure(machineDeployment, client, timeout); err != nil {
+			return err
+		}
+
+		if err := targetClient.Get(context.Background(), types.NamespacedName{Name: node.Name}, &corev1.Node{}); !kerrors.IsNotFound(err) {
+			return fmt.Errorf("expected node %s to be deleted with its machine, got: %v", node.Name, err)
+		}
+		if err := targetClient.Get(context.Background(), types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &corev1.Pod{}); !kerrors.IsNotFound(err) {
+			return fmt.Errorf("expected pod %s to be evicted from node %s, got: %v", pod.Name, node.Name, err)
+		}
+		evicted, err := machineHasEvent(machine, "Evicting", client)
+		if err != nil {
+			return err
+		}
+		if !evicted {
+			return fmt.Errorf("machine %s has no Evicting event, its node was not drained before it got deleted", machine.Name)
+		}
+
+		klog.Infof("Successfully finished test for MachineDeployment %s", machineDeployment.Name)
+		return nil
+	}
+}
+
+// readyNodeOfMachineDeployment returns a machine of the given MachineDeployment and its node in the target
+// cluster, once the node is ready
+func readyNodeOfMachineDeployment(machineDeployment *clusterv1alpha1.MachineDeployment, client, targetClient ctrlruntimeclient.Client) (*clusterv1alpha1.Machine, *corev1.Node, error) {
+	machines, err := getMatchingMachines(machineDeployment, client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list machines: %v", err)
+	}
+	nodes := &corev1.NodeList{}
+	if err := targetClient.List(context.Background(), nodes); err != nil {
+		return nil, nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	for i := range machines {
+		for j := range nodes.Items {
+			if !isNodeForMachine(&nodes.Items[j], &machines[i]) {
+				continue
+			}
+			for _, condition := range nodes.Items[j].Status.Conditions {
+				if condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionTrue {
+					return &machines[i], &nodes.Items[j], nil
+				}
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// machineHasEvent returns whether the machine-controller recorded an event with the given reason for the machine
+func machineHasEvent(machine *clusterv1alpha1.Machine, reason string, client ctrlruntimeclient.Client) (bool, error) {
+	events := &corev1.EventList{}
+	if err := client.List(context.Background(), events, ctrlruntimeclient.InNamespace(machine.Namespace)); err != nil {
+		return false, fmt.Errorf("failed to list events: %v", err)
+	}
+	for _, event := range events.Items {
+		if event.InvolvedObject.UID == machine.UID && event.Reason == reason {
+			return true, nil
+		}
+	}
+	return false, nil
+}
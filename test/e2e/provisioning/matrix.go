@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioning
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+// providerMatrix lists the cloud providers the e2e tests provision machines with. Forks of the machine-controller
+// can certify their own providers by passing a matrix of their own with -provider-matrix.
+type providerMatrix struct {
+	Providers []matrixProvider `json:"providers"`
+}
+
+type matrixProvider struct {
+	// Name identifies the provider in the test names and in -providers.
+	Name string `json:"name"`
+	// Manifest is the MachineDeployment to provision, relative to the matrix file.
+	Manifest string `json:"manifest"`
+	// Env maps the placeholders of the manifest to the environment variables their values are taken from,
+	// the provider is skipped if one of them is empty.
+	Env map[string]string `json:"env,omitempty"`
+	// Values maps further placeholders of the manifest to literal values.
+	Values map[string]string `json:"values,omitempty"`
+	// OperatingSystem of the machines. Defaults to ubuntu.
+	OperatingSystem string `json:"operatingSystem,omitempty"`
+	// KubernetesVersion of the machines.
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+}
+
+func loadProviderMatrix(path string) (*providerMatrix, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider matrix: %v", err)
+	}
+	matrix := &providerMatrix{}
+	if err := yaml.UnmarshalStrict(raw, matrix); err != nil {
+		return nil, fmt.Errorf("failed to parse provider matrix %s: %v", path, err)
+	}
+	names := map[string]bool{}
+	for i := range matrix.Providers {
+		provider := &matrix.Providers[i]
+		if provider.Name == "" || provider.Manifest == "" {
+			return nil, fmt.Errorf("provider %d of the matrix %s needs a name and a manifest", i, path)
+		}
+		if names[provider.Name] {
+			return nil, fmt.Errorf("provider %s is listed twice in the matrix %s", provider.Name, path)
+		}
+		names[provider.Name] = true
+		if !filepath.IsAbs(provider.Manifest) {
+			provider.Manifest = filepath.Join(filepath.Dir(path), provider.Manifest)
+		}
+		if provider.OperatingSystem == "" {
+			provider.OperatingSystem = "ubuntu"
+		}
+	}
+	return matrix, nil
+}
+
+// params returns the placeholders of the manifest with their values and the environment variables which are
+// required but not set
+func (p *matrixProvider) params() ([]string, []string) {
+	var params, missing []string
+	for placeholder, env := range p.Env {
+		value := os.Getenv(env)
+		if value == "" {
+			missing = append(missing, env)
+			continue
+		}
+		params = append(params, fmt.Sprintf("%s=%s", placeholder, value))
+	}
+	for placeholder, value := range p.Values {
+		params = append(params, fmt.Sprintf("%s=%s", placeholder, value))
+	}
+	sort.Strings(missing)
+	return params, missing
+}
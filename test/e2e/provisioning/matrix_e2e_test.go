@@ -0,0 +1,74 @@
+//go:build e2e
+// +build e2e
+
+/*
+Copyright 2020 The Machine Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioning
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var (
+	providerMatrixPath = flag.String("provider-matrix", "./testdata/provider-matrix.yaml", "The matrix of the providers TestProviderMatrixE2E provisions machines with")
+	matrixProviders    = flag.String("providers", "", "Comma separated names of the providers of the matrix to run, all providers whose environment variables are set if empty")
+	targetKubeconfig   = flag.String("target-kubeconfig", "", "The kubeconfig of the cluster the nodes join, if the machine-controller runs in a management cluster like the kind cluster of hack/e2e-kind.sh. Defaults to the cluster of the machines")
+)
+
+// TestProviderMatrixE2E provisions a machine with each provider of the matrix, verifies that its node joins and
+// gets drained and that the machine, its node and its instance get deleted
+func TestProviderMatrixE2E(t *testing.T) {
+	matrix, err := loadProviderMatrix(*providerMatrixPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected := map[string]bool{}
+	for _, name := range strings.Split(*matrixProviders, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			selected[name] = true
+		}
+	}
+
+	for i := range matrix.Providers {
+		provider := matrix.Providers[i]
+		t.Run(provider.Name, func(t *testing.T) {
+			if len(selected) > 0 && !selected[provider.Name] {
+				t.Skipf("provider %s is not selected with -providers", provider.Name)
+			}
+			params, missing := provider.params()
+			if len(missing) > 0 {
+				// Selected providers must run, the others only run with credentials
+				if selected[provider.Name] {
+					t.Fatalf("environment variables %s of provider %s are not set", strings.Join(missing, ", "), provider.Name)
+				}
+				t.Skipf("environment variables %s of provider %s are not set", strings.Join(missing, ", "), provider.Name)
+			}
+
+			s := scenario{
+				name:              "matrix",
+				osName:            provider.OperatingSystem,
+				containerRuntime:  "docker",
+				kubernetesVersion: provider.KubernetesVersion,
+				executor:          verifyJoinDrainAndDelete(*targetKubeconfig),
+			}
+			testScenario(t, s, fmt.Sprintf("%s-%s", provider.Name, *testRunIdentifier), params, provider.Manifest, true)
+		})
+	}
+}